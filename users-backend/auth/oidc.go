@@ -0,0 +1,269 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// MinRSAKeyBits is the smallest RSA key an OIDCSigner accepts
+const MinRSAKeyBits = 2048
+
+// AccessTokenType is the typ header of the access tokens (RFC 9068), it tells
+// them apart from the ID tokens signed with the same key
+const AccessTokenType = "at+jwt"
+
+type (
+	// UserClaims are the standard OpenID Connect claims of a user, along
+	// with its department and status. Claims outside the granted scopes are
+	// left empty.
+	UserClaims struct {
+		Name              string `json:"name,omitempty"`
+		GivenName         string `json:"given_name,omitempty"`
+		FamilyName        string `json:"family_name,omitempty"`
+		PreferredUsername string `json:"preferred_username,omitempty"`
+		Department        string `json:"department,omitempty"`
+		UserStatus        string `json:"user_status,omitempty"`
+		Email             string `json:"email,omitempty"`
+		EmailVerified     *bool  `json:"email_verified,omitempty"`
+	}
+
+	// IDTokenClaims are the claims of an ID token, the subject is the user
+	// id and the audience the client id
+	IDTokenClaims struct {
+		jwt.StandardClaims
+		Nonce    string `json:"nonce,omitempty"`
+		AuthTime int64  `json:"auth_time"`
+		TenantID int    `json:"tid"`
+		UserClaims
+	}
+
+	// AccessTokenClaims are the claims of an access token to the userinfo
+	// endpoint, the subject is the user id and the audience the client id
+	AccessTokenClaims struct {
+		jwt.StandardClaims
+		ClientID string `json:"client_id"`
+		Scope    string `json:"scope"`
+		TenantID int    `json:"tid"`
+	}
+
+	// JWK is the public part of an RSA signing key (RFC 7517)
+	JWK struct {
+		KeyType   string `json:"kty"`
+		Use       string `json:"use"`
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+		N         string `json:"n"`
+		E         string `json:"e"`
+	}
+
+	// JWKSet is the document clients fetch the signing keys from
+	JWKSet struct {
+		Keys []JWK `json:"keys"`
+	}
+)
+
+// UserID returns the user the token was issued to
+func (c *AccessTokenClaims) UserID() (int, error) {
+	return strconv.Atoi(c.Subject)
+}
+
+// OIDCSigner signs the RS256 ID and access tokens of the OpenID Connect
+// provider, clients verify them with the key published by KeySet
+type OIDCSigner struct {
+	key    *rsa.PrivateKey
+	jwk    JWK
+	issuer string
+	ttl    time.Duration
+	parser *jwt.Parser
+}
+
+// NewOIDCSigner signs tokens valid for ttl issued by issuer with key, which
+// must be at least MinRSAKeyBits long
+func NewOIDCSigner(key *rsa.PrivateKey, issuer string, ttl time.Duration) (*OIDCSigner, error) {
+	if key.N.BitLen() < MinRSAKeyBits {
+		return nil, fmt.Errorf("signing key must be at least %d bits long", MinRSAKeyBits)
+	}
+	if issuer == "" {
+		return nil, errors.New("issuer is empty")
+	}
+	if ttl <= 0 {
+		return nil, fmt.Errorf("token lifetime %s is not positive", ttl)
+	}
+
+	jwk := JWK{
+		KeyType:   "RSA",
+		Use:       "sig",
+		Algorithm: jwt.SigningMethodRS256.Alg(),
+		N:         base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+	// The key id is the JWK thumbprint of the key (RFC 7638)
+	thumbprint := sha256.Sum256([]byte(`{"e":"` + jwk.E + `","kty":"RSA","n":"` + jwk.N + `"}`))
+	jwk.KeyID = base64.RawURLEncoding.EncodeToString(thumbprint[:])
+
+	return &OIDCSigner{
+		key:    key,
+		jwk:    jwk,
+		issuer: issuer,
+		ttl:    ttl,
+		parser: &jwt.Parser{ValidMethods: []string{jwt.SigningMethodRS256.Alg()}},
+	}, nil
+}
+
+// ParseRSAPrivateKey reads a PEM encoded PKCS #1 or PKCS #8 RSA private key
+func ParseRSAPrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		rsaKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%T is not an RSA key", key)
+		}
+		return rsaKey, nil
+	}
+	return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+}
+
+// Issuer is the iss claim of the tokens
+func (s *OIDCSigner) Issuer() string {
+	return s.issuer
+}
+
+// TTL is the lifetime of the tokens
+func (s *OIDCSigner) TTL() time.Duration {
+	return s.ttl
+}
+
+// KeySet returns the public key the tokens are verified with
+func (s *OIDCSigner) KeySet() JWKSet {
+	return JWKSet{Keys: []JWK{s.jwk}}
+}
+
+// stamp sets the id, issuer and validity of claims, from now for the ttl of
+// the signer, and returns when they expire
+func (s *OIDCSigner) stamp(claims *jwt.StandardClaims, now time.Time) (time.Time, error) {
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return time.Time{}, err
+	}
+
+	expiresAt := now.Add(s.ttl).Truncate(time.Second)
+	claims.Id = hex.EncodeToString(jti)
+	claims.Issuer = s.issuer
+	claims.IssuedAt = now.Unix()
+	claims.ExpiresAt = expiresAt.Unix()
+	return expiresAt, nil
+}
+
+func (s *OIDCSigner) sign(claims jwt.Claims, typ string, expiresAt time.Time) (*Token, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = s.jwk.KeyID
+	token.Header["typ"] = typ
+
+	value, err := token.SignedString(s.key)
+	if err != nil {
+		return nil, err
+	}
+	return &Token{Value: value, ExpiresAt: expiresAt}, nil
+}
+
+// SignIDToken issues an ID token with claims, valid from now for the ttl of
+// the signer
+func (s *OIDCSigner) SignIDToken(claims *IDTokenClaims, now time.Time) (*Token, error) {
+	expiresAt, err := s.stamp(&claims.StandardClaims, now)
+	if err != nil {
+		return nil, err
+	}
+	return s.sign(claims, "JWT", expiresAt)
+}
+
+// SignAccessToken issues an access token with claims, valid from now for the
+// ttl of the signer
+func (s *OIDCSigner) SignAccessToken(claims *AccessTokenClaims, now time.Time) (*Token, error) {
+	expiresAt, err := s.stamp(&claims.StandardClaims, now)
+	if err != nil {
+		return nil, err
+	}
+	return s.sign(claims, AccessTokenType, expiresAt)
+}
+
+// VerifyAccessToken checks the signature, type, issuer and expiry of an
+// access token and returns its claims. ID tokens are refused.
+func (s *OIDCSigner) VerifyAccessToken(value string) (*AccessTokenClaims, error) {
+	claims := &AccessTokenClaims{}
+	token, err := s.parser.ParseWithClaims(value, claims, func(t *jwt.Token) (interface{}, error) {
+		if kid, _ := t.Header["kid"].(string); kid != s.jwk.KeyID {
+			return nil, fmt.Errorf("unknown key %q", kid)
+		}
+		return &s.key.PublicKey, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	if typ, _ := token.Header["typ"].(string); typ != AccessTokenType {
+		return nil, fmt.Errorf("%w: type %q", ErrInvalidToken, typ)
+	}
+	if !claims.VerifyIssuer(s.issuer, true) {
+		return nil, fmt.Errorf("%w: issuer %q", ErrInvalidToken, claims.Issuer)
+	}
+	if _, err := claims.UserID(); err != nil {
+		return nil, fmt.Errorf("%w: subject %q", ErrInvalidToken, claims.Subject)
+	}
+	return claims, nil
+}
+
+// PKCEChallenge returns the S256 code challenge of a PKCE code verifier
+// (RFC 7636)
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// ValidPKCEValue reports whether s is a well formed code verifier or S256
+// code challenge, 43 to 128 unreserved URI characters
+func ValidPKCEValue(s string) bool {
+	if len(s) < 43 || len(s) > 128 {
+		return false
+	}
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '.', r == '_', r == '~':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// VerifyPKCE reports whether verifier is well formed and matches the S256
+// challenge
+func VerifyPKCE(verifier, challenge string) bool {
+	if !ValidPKCEValue(verifier) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(PKCEChallenge(verifier)), []byte(challenge)) == 1
+}
@@ -0,0 +1,29 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// opaqueTokenLength is the number of random bytes of an opaque token
+const opaqueTokenLength = 32
+
+// NewOpaqueToken returns a random URL safe token to hand out and its hash to
+// store, the token itself is never stored
+func NewOpaqueToken() (token, hash string, err error) {
+	b := make([]byte, opaqueTokenLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashOpaqueToken(token), nil
+}
+
+// HashOpaqueToken returns the hex encoded SHA-256 of token. Opaque tokens are
+// random enough for an unsalted hash to be safe.
+func HashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,154 @@
+// Package auth hashes the local passwords of users and signs the tokens
+// issued when they log in.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Algorithms a Hasher can hash new passwords with
+const (
+	Argon2id = "argon2id"
+	Bcrypt   = "bcrypt"
+)
+
+// ErrUnknownHash is returned when verifying a hash no supported algorithm
+// produced
+var ErrUnknownHash = errors.New("unknown password hash format")
+
+// Argon2Params are the argon2id costs, Memory is in KiB
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2Params is the second recommended option of RFC 9106, for
+// servers that can not spare 2 GiB per hash
+var DefaultArgon2Params = Argon2Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 4,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// Hasher hashes passwords into strings naming the algorithm and its costs, in
+// the PHC format for argon2id and the modular crypt format for bcrypt. Hashes
+// of either algorithm are verified whatever the algorithm of the hasher, so
+// passwords keep working when it changes.
+type Hasher struct {
+	algorithm  string
+	bcryptCost int
+	argon2     Argon2Params
+}
+
+// NewArgon2idHasher hashes new passwords with argon2id and params
+func NewArgon2idHasher(params Argon2Params) *Hasher {
+	return &Hasher{algorithm: Argon2id, argon2: params}
+}
+
+// NewBcryptHasher hashes new passwords with bcrypt and cost, bcrypt ignores
+// the bytes of a password past the 72nd
+func NewBcryptHasher(cost int) (*Hasher, error) {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("bcrypt cost %d is not between %d and %d", cost, bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	return &Hasher{algorithm: Bcrypt, bcryptCost: cost}, nil
+}
+
+// Algorithm returns the algorithm new passwords are hashed with
+func (h *Hasher) Algorithm() string {
+	return h.algorithm
+}
+
+// Hash returns the encoded hash of password with a random salt
+func (h *Hasher) Hash(password string) (string, error) {
+	if h.algorithm == Bcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.bcryptCost)
+		return string(hash), err
+	}
+
+	salt := make([]byte, h.argon2.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.argon2.Iterations, h.argon2.Memory, h.argon2.Parallelism, h.argon2.KeyLength)
+	return encodeArgon2(h.argon2, salt, key), nil
+}
+
+// Verify reports whether password matches hash, the comparison takes the same
+// time wherever they differ
+func (h *Hasher) Verify(hash, password string) (bool, error) {
+	if isBcrypt(hash) {
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	params, salt, key, err := decodeArgon2(hash)
+	if err != nil {
+		return false, err
+	}
+	other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+// NeedsRehash reports whether hash was made with another algorithm or other
+// costs than the hasher would use now
+func (h *Hasher) NeedsRehash(hash string) bool {
+	if h.algorithm == Bcrypt {
+		cost, err := bcrypt.Cost([]byte(hash))
+		return !isBcrypt(hash) || err != nil || cost != h.bcryptCost
+	}
+
+	params, salt, key, err := decodeArgon2(hash)
+	return err != nil || params.Memory != h.argon2.Memory || params.Iterations != h.argon2.Iterations ||
+		params.Parallelism != h.argon2.Parallelism || uint32(len(salt)) != h.argon2.SaltLength || uint32(len(key)) != h.argon2.KeyLength
+}
+
+func isBcrypt(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+// encodeArgon2 formats an argon2id hash as
+// $argon2id$v=19$m=65536,t=3,p=4$salt$key with unpadded base64
+func encodeArgon2(p Argon2Params, salt, key []byte) string {
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+func decodeArgon2(hash string) (p Argon2Params, salt, key []byte, err error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != Argon2id {
+		return p, nil, nil, ErrUnknownHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("%w: unsupported argon2 version %q", ErrUnknownHash, parts[2])
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil || p.Iterations == 0 || p.Parallelism == 0 {
+		return p, nil, nil, fmt.Errorf("%w: invalid argon2 parameters %q", ErrUnknownHash, parts[3])
+	}
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return p, nil, nil, fmt.Errorf("%w: invalid argon2 salt: %w", ErrUnknownHash, err)
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(key) == 0 {
+		return p, nil, nil, fmt.Errorf("%w: invalid argon2 key", ErrUnknownHash)
+	}
+	p.SaltLength, p.KeyLength = uint32(len(salt)), uint32(len(key))
+	return p, salt, key, nil
+}
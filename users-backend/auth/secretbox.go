@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// MinSecretBoxKeyLength is the shortest key a SecretBox accepts, in bytes
+const MinSecretBoxKeyLength = 32
+
+// ErrSecretBoxOpen is returned for sealed values that are malformed or were
+// sealed with another key
+var ErrSecretBoxOpen = errors.New("cannot open sealed value")
+
+// SecretBox encrypts the secrets the service has to read back, like TOTP
+// secrets, with AES-256-GCM
+type SecretBox struct {
+	aead cipher.AEAD
+}
+
+// NewSecretBox seals with a key derived from key, which must be at least
+// MinSecretBoxKeyLength bytes long
+func NewSecretBox(key []byte) (*SecretBox, error) {
+	if len(key) < MinSecretBoxKeyLength {
+		return nil, fmt.Errorf("encryption key must be at least %d bytes long", MinSecretBoxKeyLength)
+	}
+
+	sum := sha256.Sum256(key)
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &SecretBox{aead: aead}, nil
+}
+
+// Seal encrypts plaintext under a random nonce and returns it base64 encoded
+func (b *SecretBox) Seal(plaintext string) (string, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := b.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a value returned by Seal
+func (b *SecretBox) Open(sealed string) (string, error) {
+	raw, err := base64.RawStdEncoding.DecodeString(sealed)
+	if err != nil || len(raw) < b.aead.NonceSize() {
+		return "", ErrSecretBoxOpen
+	}
+
+	nonce, ciphertext := raw[:b.aead.NonceSize()], raw[b.aead.NonceSize():]
+	plaintext, err := b.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", ErrSecretBoxOpen
+	}
+	return string(plaintext), nil
+}
@@ -0,0 +1,381 @@
+package test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+	"users-backend/auth"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+// fastArgon2 keeps the specs quick, servers use DefaultArgon2Params
+var fastArgon2 = auth.Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+var _ = ginkgo.Describe("Hasher", func() {
+	newBcrypt := func(cost int) *auth.Hasher {
+		h, err := auth.NewBcryptHasher(cost)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		return h
+	}
+
+	ginkgo.It("should verify the passwords it hashed with either algorithm", func() {
+		for _, h := range []*auth.Hasher{auth.NewArgon2idHasher(fastArgon2), newBcrypt(4)} {
+			hash, err := h.Hash("correct horse battery staple")
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(hash).ShouldNot(gomega.ContainSubstring("correct horse"))
+
+			ok, err := h.Verify(hash, "correct horse battery staple")
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(ok).Should(gomega.BeTrue(), h.Algorithm())
+
+			ok, err = h.Verify(hash, "correct horse battery stapler")
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(ok).Should(gomega.BeFalse(), h.Algorithm())
+		}
+	})
+
+	ginkgo.It("should salt every hash", func() {
+		h := auth.NewArgon2idHasher(fastArgon2)
+		first, err := h.Hash("password")
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		second, err := h.Hash("password")
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+		gomega.Expect(first).Should(gomega.HavePrefix("$argon2id$v=19$m=64,t=1,p=1$"))
+		gomega.Expect(first).ShouldNot(gomega.Equal(second))
+	})
+
+	ginkgo.It("should verify hashes of the other algorithm and ask for a rehash", func() {
+		argon, bcrypt := auth.NewArgon2idHasher(fastArgon2), newBcrypt(4)
+		hash, err := bcrypt.Hash("password")
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+		ok, err := argon.Verify(hash, "password")
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(ok).Should(gomega.BeTrue())
+		gomega.Expect(argon.NeedsRehash(hash)).Should(gomega.BeTrue())
+		gomega.Expect(bcrypt.NeedsRehash(hash)).Should(gomega.BeFalse())
+		gomega.Expect(newBcrypt(5).NeedsRehash(hash)).Should(gomega.BeTrue())
+
+		hash, err = argon.Hash("password")
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(argon.NeedsRehash(hash)).Should(gomega.BeFalse())
+		stronger := fastArgon2
+		stronger.Iterations = 2
+		gomega.Expect(auth.NewArgon2idHasher(stronger).NeedsRehash(hash)).Should(gomega.BeTrue())
+	})
+
+	ginkgo.It("should reject unknown hashes and invalid costs", func() {
+		for _, hash := range []string{"", "plain", "$argon2i$v=19$m=64,t=1,p=1$c2FsdA$a2V5", "$argon2id$v=19$m=64,t=0,p=1$c2FsdA$a2V5"} {
+			_, err := auth.NewArgon2idHasher(fastArgon2).Verify(hash, "password")
+			gomega.Expect(errors.Is(err, auth.ErrUnknownHash)).Should(gomega.BeTrue(), "%q got %v", hash, err)
+		}
+
+		_, err := auth.NewBcryptHasher(3)
+		gomega.Expect(err).Should(gomega.HaveOccurred())
+	})
+})
+
+var _ = ginkgo.Describe("TokenSigner", func() {
+	secret := []byte(strings.Repeat("s", auth.MinSecretLength))
+
+	newSigner := func(secret []byte, ttl time.Duration) *auth.TokenSigner {
+		s, err := auth.NewTokenSigner(secret, ttl)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		return s
+	}
+
+	ginkgo.It("should sign tokens it verifies", func() {
+		s := newSigner(secret, time.Hour)
+		now := time.Now()
+
+		token, err := s.Sign(42, 7, "alice", now)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(token.ExpiresAt).Should(gomega.BeTemporally("~", now.Add(time.Hour), time.Second))
+
+		claims, err := s.Verify(token.Value)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		user_id, err := claims.UserID()
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(user_id).Should(gomega.Equal(42))
+		gomega.Expect(claims.TenantID).Should(gomega.Equal(7))
+		gomega.Expect(claims.UserName).Should(gomega.Equal("alice"))
+		gomega.Expect(claims.Issuer).Should(gomega.Equal(auth.TokenIssuer))
+		gomega.Expect(claims.Id).ShouldNot(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should reject expired, tampered and foreign tokens", func() {
+		s := newSigner(secret, time.Minute)
+
+		expired, err := s.Sign(42, 7, "alice", time.Now().Add(-time.Hour))
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		foreign, err := newSigner([]byte(strings.Repeat("x", auth.MinSecretLength)), time.Minute).Sign(42, 7, "alice", time.Now())
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		valid, err := s.Sign(42, 7, "alice", time.Now())
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+		for _, value := range []string{expired.Value, foreign.Value, valid.Value + "x", "not.a.token"} {
+			_, err := s.Verify(value)
+			gomega.Expect(errors.Is(err, auth.ErrInvalidToken)).Should(gomega.BeTrue(), "got %v", err)
+		}
+	})
+
+	ginkgo.It("should refuse short secrets", func() {
+		_, err := auth.NewTokenSigner([]byte("short"), time.Hour)
+		gomega.Expect(err).Should(gomega.HaveOccurred())
+		_, err = auth.NewTokenSigner(secret, 0)
+		gomega.Expect(err).Should(gomega.HaveOccurred())
+	})
+})
+
+var _ = ginkgo.Describe("Opaque tokens", func() {
+	ginkgo.It("should hand out random URL safe tokens and hash them", func() {
+		token, hash, err := auth.NewOpaqueToken()
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		other, otherHash, err := auth.NewOpaqueToken()
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+		gomega.Expect(token).Should(gomega.MatchRegexp(`^[A-Za-z0-9_-]{43}$`))
+		gomega.Expect(token).ShouldNot(gomega.Equal(other))
+		gomega.Expect(hash).Should(gomega.MatchRegexp(`^[0-9a-f]{64}$`))
+		gomega.Expect(hash).Should(gomega.Equal(auth.HashOpaqueToken(token)))
+		gomega.Expect(hash).ShouldNot(gomega.Equal(otherHash))
+	})
+})
+
+var _ = ginkgo.Describe("TOTP", func() {
+	// The SHA1 secret of the RFC 6238 test vectors, base32 encoded
+	const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+	ginkgo.It("should derive the codes of the RFC 6238 test vectors", func() {
+		for at, code := range map[int64]string{59: "287082", 1111111109: "081804", 1234567890: "005924", 2000000000: "279037"} {
+			got, err := auth.TOTPCode(rfcSecret, auth.TOTPStep(time.Unix(at, 0)))
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(got).Should(gomega.Equal(code), "at %d", at)
+		}
+	})
+
+	ginkgo.It("should accept the codes of the adjacent steps only", func() {
+		secret, err := auth.NewTOTPSecret()
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(secret).Should(gomega.MatchRegexp(`^[A-Z2-7]{32}$`))
+
+		now := time.Unix(1700000000, 0)
+		step := auth.TOTPStep(now)
+		for offset, accepted := range map[int64]bool{-2: false, -1: true, 0: true, 1: true, 2: false} {
+			code, err := auth.TOTPCode(secret, step+offset)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			got, ok, err := auth.VerifyTOTP(secret, code, now)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(ok).Should(gomega.Equal(accepted), "offset %d", offset)
+			if ok {
+				gomega.Expect(got).Should(gomega.Equal(step + offset))
+			}
+		}
+
+		_, ok, err := auth.VerifyTOTP(secret, "12345", now)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(ok).Should(gomega.BeFalse())
+		_, _, err = auth.VerifyTOTP("not base32!", "123456", now)
+		gomega.Expect(errors.Is(err, auth.ErrInvalidTOTPSecret)).Should(gomega.BeTrue(), "got %v", err)
+	})
+
+	ginkgo.It("should build otpauth URIs and QR codes", func() {
+		uri := auth.TOTPURI("Users App", "alice", "SECRET")
+		gomega.Expect(uri).Should(gomega.HavePrefix("otpauth://totp/Users%20App:alice?"))
+		gomega.Expect(uri).Should(gomega.ContainSubstring("secret=SECRET"))
+		gomega.Expect(uri).Should(gomega.ContainSubstring("issuer=Users+App"))
+		gomega.Expect(uri).Should(gomega.ContainSubstring("digits=6"))
+		gomega.Expect(uri).Should(gomega.ContainSubstring("period=30"))
+
+		png, err := auth.TOTPQRCode(uri)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(string(png)).Should(gomega.HavePrefix("\x89PNG"))
+	})
+
+	ginkgo.It("should hand out recovery codes matched whatever their case and dashes", func() {
+		codes, hashes, err := auth.NewRecoveryCodes(10)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(codes).Should(gomega.HaveLen(10))
+		gomega.Expect(hashes).Should(gomega.HaveLen(10))
+		gomega.Expect(codes[0]).Should(gomega.MatchRegexp(`^[a-z2-7]{4}-[a-z2-7]{4}-[a-z2-7]{4}-[a-z2-7]{4}$`))
+		gomega.Expect(codes[0]).ShouldNot(gomega.Equal(codes[1]))
+
+		gomega.Expect(auth.HashRecoveryCode(codes[0])).Should(gomega.Equal(hashes[0]))
+		typed := strings.ToUpper(strings.ReplaceAll(codes[0], "-", " "))
+		gomega.Expect(auth.HashRecoveryCode(typed)).Should(gomega.Equal(hashes[0]))
+	})
+})
+
+var _ = ginkgo.Describe("SecretBox", func() {
+	key := []byte(strings.Repeat("k", auth.MinSecretBoxKeyLength))
+
+	ginkgo.It("should open what it sealed and nothing else", func() {
+		box, err := auth.NewSecretBox(key)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+		sealed, err := box.Seal("JBSWY3DPEHPK3PXP")
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(sealed).ShouldNot(gomega.ContainSubstring("JBSWY3DPEHPK3PXP"))
+		again, err := box.Seal("JBSWY3DPEHPK3PXP")
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(again).ShouldNot(gomega.Equal(sealed))
+
+		opened, err := box.Open(sealed)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(opened).Should(gomega.Equal("JBSWY3DPEHPK3PXP"))
+
+		other, err := auth.NewSecretBox([]byte(strings.Repeat("o", auth.MinSecretBoxKeyLength)))
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		_, err = other.Open(sealed)
+		gomega.Expect(err).Should(gomega.Equal(auth.ErrSecretBoxOpen))
+		_, err = box.Open("garbage")
+		gomega.Expect(err).Should(gomega.Equal(auth.ErrSecretBoxOpen))
+	})
+
+	ginkgo.It("should refuse short keys", func() {
+		_, err := auth.NewSecretBox(key[1:])
+		gomega.Expect(err).Should(gomega.HaveOccurred())
+	})
+})
+
+var _ = ginkgo.Describe("OIDCSigner", func() {
+	const issuer = "https://users.example.com"
+
+	newKey := func(bits int) *rsa.PrivateKey {
+		key, err := rsa.GenerateKey(rand.Reader, bits)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		return key
+	}
+	key := newKey(auth.MinRSAKeyBits)
+
+	newSigner := func(key *rsa.PrivateKey, ttl time.Duration) *auth.OIDCSigner {
+		s, err := auth.NewOIDCSigner(key, issuer, ttl)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		return s
+	}
+
+	ginkgo.It("should sign access tokens it verifies", func() {
+		s := newSigner(key, time.Hour)
+		now := time.Now()
+
+		token, err := s.SignAccessToken(&auth.AccessTokenClaims{
+			StandardClaims: jwt.StandardClaims{Subject: "42", Audience: "wiki"},
+			ClientID:       "wiki",
+			Scope:          "openid email",
+			TenantID:       7,
+		}, now)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(token.ExpiresAt).Should(gomega.BeTemporally("~", now.Add(time.Hour), time.Second))
+
+		claims, err := s.VerifyAccessToken(token.Value)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		user_id, err := claims.UserID()
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(user_id).Should(gomega.Equal(42))
+		gomega.Expect(claims.Issuer).Should(gomega.Equal(issuer))
+		gomega.Expect(claims.ClientID).Should(gomega.Equal("wiki"))
+		gomega.Expect(claims.Scope).Should(gomega.Equal("openid email"))
+		gomega.Expect(claims.TenantID).Should(gomega.Equal(7))
+		gomega.Expect(claims.Id).ShouldNot(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should sign ID tokens verifiable with the published key", func() {
+		s := newSigner(key, time.Hour)
+		verified := true
+
+		token, err := s.SignIDToken(&auth.IDTokenClaims{
+			StandardClaims: jwt.StandardClaims{Subject: "42", Audience: "wiki"},
+			Nonce:          "n-0S6_WzA2Mj",
+			AuthTime:       time.Now().Unix(),
+			UserClaims:     auth.UserClaims{PreferredUsername: "alice", Email: "alice@email.com", EmailVerified: &verified},
+		}, time.Now())
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+		keys := s.KeySet().Keys
+		gomega.Expect(keys).Should(gomega.HaveLen(1))
+		gomega.Expect(keys[0].KeyType).Should(gomega.Equal("RSA"))
+		gomega.Expect(keys[0].Algorithm).Should(gomega.Equal("RS256"))
+		n, err := base64.RawURLEncoding.DecodeString(keys[0].N)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		e, err := base64.RawURLEncoding.DecodeString(keys[0].E)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		public := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+
+		claims := jwt.MapClaims{}
+		parsed, err := jwt.ParseWithClaims(token.Value, claims, func(*jwt.Token) (interface{}, error) { return public, nil })
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(parsed.Header["kid"]).Should(gomega.Equal(keys[0].KeyID))
+		gomega.Expect(claims["iss"]).Should(gomega.Equal(issuer))
+		gomega.Expect(claims["aud"]).Should(gomega.Equal("wiki"))
+		gomega.Expect(claims["nonce"]).Should(gomega.Equal("n-0S6_WzA2Mj"))
+		gomega.Expect(claims["preferred_username"]).Should(gomega.Equal("alice"))
+		gomega.Expect(claims["email_verified"]).Should(gomega.BeTrue())
+		gomega.Expect(claims).ShouldNot(gomega.HaveKey("given_name"))
+
+		// ID tokens are not access tokens
+		_, err = s.VerifyAccessToken(token.Value)
+		gomega.Expect(errors.Is(err, auth.ErrInvalidToken)).Should(gomega.BeTrue(), "got %v", err)
+	})
+
+	ginkgo.It("should reject expired, tampered and foreign access tokens", func() {
+		s := newSigner(key, time.Minute)
+		sign := func(s *auth.OIDCSigner, now time.Time) string {
+			token, err := s.SignAccessToken(&auth.AccessTokenClaims{StandardClaims: jwt.StandardClaims{Subject: "42"}}, now)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			return token.Value
+		}
+
+		foreign := newSigner(newKey(auth.MinRSAKeyBits), time.Minute)
+		for _, value := range []string{sign(s, time.Now().Add(-time.Hour)), sign(foreign, time.Now()), sign(s, time.Now()) + "x", "not.a.token"} {
+			_, err := s.VerifyAccessToken(value)
+			gomega.Expect(errors.Is(err, auth.ErrInvalidToken)).Should(gomega.BeTrue(), "got %v", err)
+		}
+	})
+
+	ginkgo.It("should read PEM keys and refuse short ones", func() {
+		pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		for _, block := range []*pem.Block{
+			{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)},
+			{Type: "PRIVATE KEY", Bytes: pkcs8},
+		} {
+			parsed, err := auth.ParseRSAPrivateKey(pem.EncodeToMemory(block))
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(parsed.Equal(key)).Should(gomega.BeTrue())
+		}
+		_, err = auth.ParseRSAPrivateKey([]byte("not a key"))
+		gomega.Expect(err).Should(gomega.HaveOccurred())
+
+		_, err = auth.NewOIDCSigner(newKey(1024), issuer, time.Hour)
+		gomega.Expect(err).Should(gomega.HaveOccurred())
+		_, err = auth.NewOIDCSigner(key, "", time.Hour)
+		gomega.Expect(err).Should(gomega.HaveOccurred())
+	})
+
+	ginkgo.It("should match PKCE verifiers with their S256 challenge", func() {
+		// The example of RFC 7636 appendix B
+		verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+		gomega.Expect(auth.PKCEChallenge(verifier)).Should(gomega.Equal("E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"))
+		gomega.Expect(auth.VerifyPKCE(verifier, "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM")).Should(gomega.BeTrue())
+		gomega.Expect(auth.VerifyPKCE(verifier+"x", "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM")).Should(gomega.BeFalse())
+		gomega.Expect(auth.VerifyPKCE("short", auth.PKCEChallenge("short"))).Should(gomega.BeFalse())
+		gomega.Expect(auth.ValidPKCEValue(strings.Repeat("a", 129))).Should(gomega.BeFalse())
+		gomega.Expect(auth.ValidPKCEValue(strings.Repeat("a", 42) + "+")).Should(gomega.BeFalse())
+	})
+})
+
+func TestAuth(t *testing.T) {
+	gomega.RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "Auth Suite")
+}
@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// TokenIssuer is the iss claim of the tokens signed by a TokenSigner
+const TokenIssuer = "users-backend"
+
+// MinSecretLength is the shortest HS256 secret a TokenSigner accepts, in bytes
+const MinSecretLength = 32
+
+// ErrInvalidToken is wrapped by the errors returned for tokens that are
+// malformed, expired or not signed by the signer
+var ErrInvalidToken = errors.New("invalid token")
+
+// Claims are the claims of a login token, the subject is the user id
+type Claims struct {
+	jwt.StandardClaims
+	TenantID int    `json:"tid"`
+	UserName string `json:"preferred_username"`
+}
+
+// UserID returns the user the token was issued to
+func (c *Claims) UserID() (int, error) {
+	return strconv.Atoi(c.Subject)
+}
+
+// Token is a signed token and when it expires
+type Token struct {
+	Value     string
+	ExpiresAt time.Time
+}
+
+// TokenSigner signs and verifies the HS256 JWTs issued on login
+type TokenSigner struct {
+	secret []byte
+	ttl    time.Duration
+	parser *jwt.Parser
+}
+
+// NewTokenSigner signs tokens valid for ttl with secret, which must be at
+// least MinSecretLength bytes long
+func NewTokenSigner(secret []byte, ttl time.Duration) (*TokenSigner, error) {
+	if len(secret) < MinSecretLength {
+		return nil, fmt.Errorf("token secret must be at least %d bytes long", MinSecretLength)
+	}
+	if ttl <= 0 {
+		return nil, fmt.Errorf("token lifetime %s is not positive", ttl)
+	}
+
+	return &TokenSigner{
+		secret: secret,
+		ttl:    ttl,
+		parser: &jwt.Parser{ValidMethods: []string{jwt.SigningMethodHS256.Alg()}},
+	}, nil
+}
+
+// Sign issues a token for the user of the tenant, valid from now for the ttl
+// of the signer
+func (s *TokenSigner) Sign(user_id, tenant_id int, userName string, now time.Time) (*Token, error) {
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return nil, err
+	}
+
+	expiresAt := now.Add(s.ttl).Truncate(time.Second)
+	claims := &Claims{
+		StandardClaims: jwt.StandardClaims{
+			Id:        hex.EncodeToString(jti),
+			Issuer:    TokenIssuer,
+			Subject:   strconv.Itoa(user_id),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: expiresAt.Unix(),
+		},
+		TenantID: tenant_id,
+		UserName: userName,
+	}
+
+	value, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secret)
+	if err != nil {
+		return nil, err
+	}
+	return &Token{Value: value, ExpiresAt: expiresAt}, nil
+}
+
+// Verify checks the signature, issuer and expiry of a token and returns its
+// claims
+func (s *TokenSigner) Verify(value string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := s.parser.ParseWithClaims(value, claims, func(*jwt.Token) (interface{}, error) { return s.secret, nil })
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	if !claims.VerifyIssuer(TokenIssuer, true) {
+		return nil, fmt.Errorf("%w: issuer %q", ErrInvalidToken, claims.Issuer)
+	}
+	if _, err := claims.UserID(); err != nil {
+		return nil, fmt.Errorf("%w: subject %q", ErrInvalidToken, claims.Subject)
+	}
+	return claims, nil
+}
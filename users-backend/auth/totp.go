@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"rsc.io/qr"
+)
+
+// TOTP parameters, the defaults of RFC 6238 which every authenticator app
+// supports
+const (
+	TOTPDigits = 6
+	TOTPPeriod = 30 * time.Second
+
+	// totpSecretLength is the number of random bytes of a secret, the
+	// length of the HMAC-SHA1 key recommended by RFC 4226
+	totpSecretLength = 20
+	// totpSkew is the number of steps a code may be late or early, to
+	// allow for clock drift and slow typing
+	totpSkew = 1
+)
+
+// ErrInvalidTOTPSecret is returned for secrets that are not base32
+var ErrInvalidTOTPSecret = errors.New("invalid TOTP secret")
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewTOTPSecret returns a random base32 encoded TOTP secret
+func NewTOTPSecret() (string, error) {
+	b := make([]byte, totpSecretLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(b), nil
+}
+
+// TOTPStep returns the time step of t, the counter the codes are derived from
+func TOTPStep(t time.Time) int64 {
+	return t.Unix() / int64(TOTPPeriod/time.Second)
+}
+
+// TOTPCode returns the code of the step for the base32 encoded secret
+func TOTPCode(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidTOTPSecret, err)
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation of RFC 4226
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", TOTPDigits, value%1_000_000), nil
+}
+
+// VerifyTOTP checks code against the steps around now and returns the step
+// it matched. Callers must refuse steps not after the last one they accepted
+// so that a code is used once.
+func VerifyTOTP(secret, code string, now time.Time) (int64, bool, error) {
+	if len(code) != TOTPDigits {
+		return 0, false, nil
+	}
+
+	current := TOTPStep(now)
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		expected, err := TOTPCode(secret, step)
+		if err != nil {
+			return 0, false, err
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// TOTPURI returns the otpauth URI authenticator apps enroll the secret from,
+// labelled with the issuer and the account
+func TOTPURI(issuer, account, secret string) string {
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", issuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(TOTPDigits))
+	q.Set("period", fmt.Sprint(int(TOTPPeriod/time.Second)))
+
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: q.Encode(),
+	}
+	return u.String()
+}
+
+// TOTPQRCode returns a PNG QR code of the otpauth URI, for the apps to scan
+func TOTPQRCode(uri string) ([]byte, error) {
+	c, err := qr.Encode(uri, qr.M)
+	if err != nil {
+		return nil, err
+	}
+	return c.PNG(), nil
+}
+
+// recoveryCodeGroups and recoveryCodeGroupLength shape a recovery code as
+// xxxx-xxxx-xxxx-xxxx, 80 random bits
+const (
+	recoveryCodeGroups      = 4
+	recoveryCodeGroupLength = 4
+)
+
+var recoveryEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// NewRecoveryCodes returns n random recovery codes to hand out and their
+// hashes to store
+func NewRecoveryCodes(n int) (codes, hashes []string, err error) {
+	length := recoveryCodeGroups * recoveryCodeGroupLength
+	b := make([]byte, length*5/8)
+	for range n {
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		raw := recoveryEncoding.EncodeToString(b)
+
+		groups := make([]string, recoveryCodeGroups)
+		for i := range groups {
+			groups[i] = raw[i*recoveryCodeGroupLength : (i+1)*recoveryCodeGroupLength]
+		}
+		codes = append(codes, strings.Join(groups, "-"))
+		hashes = append(hashes, HashRecoveryCode(raw))
+	}
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode returns the hash to look code up with, ignoring case,
+// dashes and spaces users may type it with
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	return HashOpaqueToken(code)
+}
@@ -0,0 +1,140 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"users-backend/controller"
+	"users-backend/model"
+)
+
+// attributeJSON is the attribute printed by attribute list, with the field
+// names of the API
+type attributeJSON struct {
+	AttributeID int      `json:"attribute_id"`
+	Name        string   `json:"name"`
+	Type        string   `json:"type"`
+	Required    bool     `json:"required"`
+	Unique      bool     `json:"unique"`
+	EnumValues  []string `json:"enum_values,omitempty"`
+}
+
+// runAttribute lists, defines and deletes the custom attributes of a tenant
+func runAttribute(ctx context.Context, e env, args []string) error {
+	if len(args) == 0 {
+		return e.usageError("attribute needs list, create or delete")
+	}
+
+	switch args[0] {
+	case "list":
+		return runAttributeList(ctx, e, args[1:])
+	case "create":
+		return runAttributeCreate(ctx, e, args[1:])
+	case "delete":
+		return runAttributeDelete(ctx, e, args[1:])
+	}
+	return e.usageError("unknown attribute command %q", args[0])
+}
+
+func runAttributeList(ctx context.Context, e env, args []string) error {
+	fs := e.flagSet("attribute list")
+	tenantSlug := tenantFlag(fs)
+	if err := e.parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return e.usageError("attribute list takes no arguments")
+	}
+
+	return e.withTenant(ctx, *tenantSlug, func(ctx context.Context, db database, log *slog.Logger) error {
+		defs, err := controller.NewAttributeController(db, log).GetAttributes(ctx)
+		if err != nil {
+			return err
+		}
+
+		list := []attributeJSON{}
+		for _, def := range *defs {
+			list = append(list, attributeJSON{
+				AttributeID: def.AttributeID,
+				Name:        def.Name,
+				Type:        string(def.Type),
+				Required:    def.Required,
+				Unique:      def.Unique,
+				EnumValues:  def.EnumValues,
+			})
+		}
+
+		enc := json.NewEncoder(e.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(list)
+	})
+}
+
+func runAttributeCreate(ctx context.Context, e env, args []string) error {
+	fs := e.flagSet("attribute create")
+	tenantSlug := tenantFlag(fs)
+	name := fs.String("name", "", "name, lower case letters, digits and '_' (required)")
+	attrType := fs.String("type", "", "type, string, number, date or enum (required)")
+	required := fs.Bool("required", false, "every user must have a value")
+	unique := fs.Bool("unique", false, "no two users of the tenant may have the same value")
+	values := fs.String("values", "", "comma separated values of an enum attribute")
+	if err := e.parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return e.usageError("attribute create takes no arguments")
+	}
+
+	var enumValues []string
+	if *values != "" {
+		enumValues = strings.Split(*values, ",")
+	}
+
+	return e.withTenant(ctx, *tenantSlug, func(ctx context.Context, db database, log *slog.Logger) error {
+		id, err := controller.NewAttributeController(db, log).CreateAttribute(ctx, *name, model.AttributeType(*attrType), *required, *unique, enumValues)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(e.stdout, id)
+		return nil
+	})
+}
+
+func runAttributeDelete(ctx context.Context, e env, args []string) error {
+	fs := e.flagSet("attribute delete")
+	tenantSlug := tenantFlag(fs)
+	if err := e.parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return e.usageError("attribute delete needs an attribute id")
+	}
+	id, err := strconv.Atoi(fs.Arg(0))
+	if err != nil || id < 1 {
+		return e.usageError("invalid attribute id %q", fs.Arg(0))
+	}
+
+	return e.withTenant(ctx, *tenantSlug, func(ctx context.Context, db database, log *slog.Logger) error {
+		return controller.NewAttributeController(db, log).DeleteAttribute(ctx, id)
+	})
+}
+
+// attributeFlag collects the repeated --attr NAME=VALUE flags of user create
+type attributeFlag model.Attributes
+
+func (f attributeFlag) String() string {
+	return ""
+}
+
+func (f attributeFlag) Set(s string) error {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok {
+		return fmt.Errorf("%q is not NAME=VALUE", s)
+	}
+	f[name] = value
+	return nil
+}
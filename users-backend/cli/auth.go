@@ -0,0 +1,176 @@
+package cli
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+	"users-backend/auth"
+	"users-backend/controller"
+	"users-backend/repo"
+)
+
+// authOptions reads the password hashing, policy and lockout settings.
+// PASSWORD_HASH picks argon2id (default) or bcrypt with BCRYPT_COST,
+// PASSWORD_MIN_LENGTH and PASSWORD_MIN_CLASSES tighten the policy and
+// LOGIN_MAX_FAILURES failed logins in a row lock an account for LOGIN_LOCKOUT.
+func authOptions() ([]controller.AuthOption, error) {
+	var hasher *auth.Hasher
+	switch algorithm := os.Getenv("PASSWORD_HASH"); algorithm {
+	case "", auth.Argon2id:
+		hasher = auth.NewArgon2idHasher(auth.DefaultArgon2Params)
+	case auth.Bcrypt:
+		cost, err := envInt("BCRYPT_COST", 12)
+		if err != nil {
+			return nil, err
+		}
+		if hasher, err = auth.NewBcryptHasher(cost); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown PASSWORD_HASH %q, use argon2id or bcrypt", algorithm)
+	}
+
+	policy := controller.DefaultPasswordPolicy()
+	lockout := controller.DefaultLockoutPolicy()
+	var err error
+	if policy.MinLength, err = envInt("PASSWORD_MIN_LENGTH", policy.MinLength); err != nil {
+		return nil, err
+	}
+	if policy.MinClasses, err = envInt("PASSWORD_MIN_CLASSES", policy.MinClasses); err != nil {
+		return nil, err
+	}
+	if lockout.MaxFailures, err = envInt("LOGIN_MAX_FAILURES", lockout.MaxFailures); err != nil {
+		return nil, err
+	}
+	if s := os.Getenv("LOGIN_LOCKOUT"); s != "" {
+		if lockout.Duration, err = time.ParseDuration(s); err != nil {
+			return nil, fmt.Errorf("invalid LOGIN_LOCKOUT: %w", err)
+		}
+	}
+
+	return []controller.AuthOption{controller.WithHasher(hasher), controller.WithPasswordPolicy(policy), controller.WithLockout(lockout)}, nil
+}
+
+// twoFactorOption enables the TOTP second factor. Its secrets are encrypted
+// with TOTP_ENCRYPTION_KEY, without it users can not enroll and those who did
+// can not log in. Authenticator apps show TOTP_ISSUER (users-backend).
+func twoFactorOption(factors repo.TwoFactorRepo) (controller.AuthOption, error) {
+	var secrets *auth.SecretBox
+	if key := os.Getenv("TOTP_ENCRYPTION_KEY"); key != "" {
+		var err error
+		if secrets, err = auth.NewSecretBox([]byte(key)); err != nil {
+			return nil, fmt.Errorf("invalid TOTP_ENCRYPTION_KEY: %w", err)
+		}
+	}
+	return controller.WithTwoFactor(factors, secrets, os.Getenv("TOTP_ISSUER")), nil
+}
+
+// oidcOption makes the service an OpenID Connect provider when OIDC_ISSUER,
+// its external base URL, is set. Tokens are signed with the RSA key in
+// OIDC_SIGNING_KEY_FILE and valid for OIDC_TOKEN_TTL (1h). Without key file
+// a key is generated at start, the tokens it signed are refused after a
+// restart and by the other replicas. It returns nil when OIDC_ISSUER is not
+// set.
+func oidcOption(clients repo.ClientRepo, codes repo.AuthorizationCodeRepo, log *slog.Logger) (controller.AuthOption, error) {
+	issuer := os.Getenv("OIDC_ISSUER")
+	if issuer == "" {
+		return nil, nil
+	}
+	if u, err := url.Parse(issuer); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+		return nil, fmt.Errorf("invalid OIDC_ISSUER %q, it must be an http or https URL without query or fragment", issuer)
+	}
+
+	ttl := time.Hour
+	if s := os.Getenv("OIDC_TOKEN_TTL"); s != "" {
+		var err error
+		if ttl, err = time.ParseDuration(s); err != nil {
+			return nil, fmt.Errorf("invalid OIDC_TOKEN_TTL: %w", err)
+		}
+	}
+
+	var key *rsa.PrivateKey
+	if file := os.Getenv("OIDC_SIGNING_KEY_FILE"); file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OIDC_SIGNING_KEY_FILE: %w", err)
+		}
+		if key, err = auth.ParseRSAPrivateKey(data); err != nil {
+			return nil, fmt.Errorf("invalid OIDC_SIGNING_KEY_FILE: %w", err)
+		}
+	} else {
+		var err error
+		if key, err = rsa.GenerateKey(rand.Reader, auth.MinRSAKeyBits); err != nil {
+			return nil, err
+		}
+		log.Warn("no OIDC_SIGNING_KEY_FILE, signing OpenID Connect tokens with a generated key that does not survive restarts")
+	}
+
+	signer, err := auth.NewOIDCSigner(key, issuer, ttl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OpenID Connect settings: %w", err)
+	}
+	log.Info("OpenID Connect provider enabled", "issuer", issuer, "token_ttl", ttl.String(), "key_id", signer.KeySet().Keys[0].KeyID)
+	return controller.WithOIDC(clients, codes, signer), nil
+}
+
+// authController enables the password login when AUTH_TOKEN_SECRET is set,
+// tokens are valid for AUTH_TOKEN_TTL (1h). It returns nil otherwise.
+func authController(users repo.UserRepo, credentials repo.CredentialRepo, factors repo.TwoFactorRepo, clients repo.ClientRepo, codes repo.AuthorizationCodeRepo, log *slog.Logger) (controller.AuthController, error) {
+	secret := os.Getenv("AUTH_TOKEN_SECRET")
+	if secret == "" {
+		if os.Getenv("OIDC_ISSUER") != "" {
+			return nil, errors.New("OIDC_ISSUER requires AUTH_TOKEN_SECRET, the provider logs users in with their password")
+		}
+		return nil, nil
+	}
+
+	ttl := time.Hour
+	if s := os.Getenv("AUTH_TOKEN_TTL"); s != "" {
+		var err error
+		if ttl, err = time.ParseDuration(s); err != nil {
+			return nil, fmt.Errorf("invalid AUTH_TOKEN_TTL: %w", err)
+		}
+	}
+	tokens, err := auth.NewTokenSigner([]byte(secret), ttl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid AUTH_TOKEN_SECRET: %w", err)
+	}
+
+	opts, err := authOptions()
+	if err != nil {
+		return nil, err
+	}
+	twoFactor, err := twoFactorOption(factors)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, twoFactor)
+	oidc, err := oidcOption(clients, codes, log)
+	if err != nil {
+		return nil, err
+	}
+	if oidc != nil {
+		opts = append(opts, oidc)
+	}
+	log.Info("password login enabled", "token_ttl", ttl.String(), "two_factor", os.Getenv("TOTP_ENCRYPTION_KEY") != "")
+	return controller.NewAuthController(users, credentials, tokens, log, opts...), nil
+}
+
+// envInt reads an integer environment variable, fallback when unset
+func envInt(name string, fallback int) (int, error) {
+	s := os.Getenv(name)
+	if s == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return n, nil
+}
@@ -0,0 +1,239 @@
+// Package cli implements the users-backend commands. serve runs the HTTP
+// server, the other commands let operators maintain the database from scripts
+// and go through the same controller as the API.
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"users-backend/controller"
+	"users-backend/logging"
+	"users-backend/model"
+	"users-backend/repo"
+	"users-backend/repo/postgres"
+	"users-backend/repo/sqlite"
+	"users-backend/tenant"
+)
+
+// ErrUsage is returned for unknown commands and invalid flags or arguments,
+// the usage has already been written to stderr
+var ErrUsage = errors.New("invalid usage")
+
+const usage = `Usage: users-backend <command> [arguments]
+
+Commands:
+  serve                                  run the HTTP server (default)
+  migrate up                             apply the pending migrations
+  migrate down [--steps N]               revert the last N migrations (1)
+  migrate status                         list the migrations and when they were applied
+  seed [--count N] [--seed S]            create N fake users (10)
+  export [--format csv] [--output FILE]  write every user to FILE or stdout
+  import FILE                            create the users of a CSV file, all or none
+  user get ID                            print a user as JSON
+  user create --user-name NAME ...       create a user and print its id, --attr NAME=VALUE
+                                         sets a custom attribute
+  user set-status ID STATUS              set the status of a user (A, I or T)
+  user set-password --password-file F ID set the password of a user to the first line of F
+  user reset-two-factor ID               remove the second factor and recovery codes of a user
+  tenant list                            print the tenants as JSON
+  tenant create --slug SLUG --name NAME  create a tenant and print its id
+  attribute list                         print the custom attributes as JSON
+  attribute create --name NAME --type T  define a custom attribute and print its id
+  attribute delete ID                    delete a custom attribute and its values
+  group list                             print the groups as JSON
+  group create --name NAME [--parent ID] create a group and print its id
+  group add ID USER_ID...                add users to a group
+  group remove ID USER_ID...             remove users from a group
+
+seed, export, import, user, attribute and group work on the default tenant, pass
+--tenant SLUG to pick another one.
+
+The database is selected by DATABASE_URL, logs are written to stderr at the
+LOG_LEVEL level (warn by default).
+`
+
+// env is what every command gets
+type env struct {
+	stdout io.Writer
+	stderr io.Writer
+}
+
+type command func(ctx context.Context, e env, args []string) error
+
+var commands = map[string]command{
+	"serve":     runServe,
+	"migrate":   runMigrate,
+	"seed":      runSeed,
+	"export":    runExport,
+	"import":    runImport,
+	"user":      runUser,
+	"tenant":    runTenant,
+	"attribute": runAttribute,
+	"group":     runGroup,
+}
+
+// Run runs the command named by args[0], serve when args is empty
+func Run(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	e := env{stdout: stdout, stderr: stderr}
+	if len(args) == 0 {
+		return runServe(ctx, e, nil)
+	}
+
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return nil
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return e.usageError("unknown command %q", args[0])
+	}
+
+	// -h has already printed the flags of the command
+	if err := cmd(ctx, e, args[1:]); !errors.Is(err, flag.ErrHelp) {
+		return err
+	}
+	return nil
+}
+
+// usageError writes the problem and the usage to stderr
+func (e env) usageError(format string, args ...any) error {
+	fmt.Fprintf(e.stderr, format+"\n\n", args...)
+	fmt.Fprint(e.stderr, usage)
+	return ErrUsage
+}
+
+// flagSet returns a flag set reporting its errors to stderr
+func (e env) flagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	return fs
+}
+
+// parse parses args into fs, a -h request is returned as flag.ErrHelp
+func (e env) parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return ErrUsage
+	}
+	return nil
+}
+
+// logger returns a JSON logger writing to w at the LOG_LEVEL level, fallback
+// when unset or invalid
+func logger(w io.Writer, fallback slog.Level) *slog.Logger {
+	level := fallback
+	if err := level.UnmarshalText([]byte(os.Getenv("LOG_LEVEL"))); err != nil {
+		level = fallback
+	}
+	return logging.New(w, level)
+}
+
+// database holds every repo and can report its own health and migrate its
+// schema
+type database interface {
+	repo.UserRepo
+	repo.TenantRepo
+	repo.AttributeRepo
+	repo.GroupRepo
+	repo.CredentialRepo
+	repo.UserTokenRepo
+	repo.TwoFactorRepo
+	repo.ClientRepo
+	repo.AuthorizationCodeRepo
+	repo.Migrator
+	Ping(ctx context.Context) error
+	CheckSchema(ctx context.Context) error
+}
+
+// openDatabase picks the repo from the DATABASE_URL scheme, sqlite:// URLs use
+// a SQLite file and anything else Postgres. POSTGRES_ROW_LEVEL_SECURITY=true
+// sets the tenant of every Postgres transaction for the tenant_isolation
+// policy.
+func openDatabase(log *slog.Logger) (database, func()) {
+	databaseURL := os.Getenv("DATABASE_URL")
+	if strings.HasPrefix(databaseURL, "sqlite:") {
+		return sqlite.NewSQLiteRepo(databaseURL, log)
+	}
+
+	var opts []postgres.Option
+	if rls, _ := strconv.ParseBool(os.Getenv("POSTGRES_ROW_LEVEL_SECURITY")); rls {
+		opts = append(opts, postgres.WithRowLevelSecurity())
+	}
+	return postgres.NewPostgresRepo(log, opts...)
+}
+
+// newController builds the controller every command goes through, with the
+// validation rules from RESERVED_USERNAMES and ALLOWED_EMAIL_DOMAINS, wrapped
+// in decorators after the audit
+func newController(userRepo repo.UserRepo, attributes repo.AttributeRepo, log *slog.Logger, decorators ...controller.Decorator) controller.UserController {
+	validation := controller.DefaultValidationConfig()
+	validation.ReservedUserNames = append(validation.ReservedUserNames, splitList(os.Getenv("RESERVED_USERNAMES"))...)
+	validation.AllowedEmailDomains = splitList(os.Getenv("ALLOWED_EMAIL_DOMAINS"))
+
+	// Decorators are applied outermost first, add caching, authorization etc.
+	// here without changing the controller itself
+	return controller.Chain(
+		controller.NewUserController(userRepo, log, controller.WithValidation(validation), controller.WithAttributes(attributes)),
+		append([]controller.Decorator{controller.WithAudit(log)}, decorators...)...,
+	)
+}
+
+// withDatabase opens the database and runs fn with it, for the maintenance
+// commands. The schema must have been migrated.
+func (e env) withDatabase(ctx context.Context, fn func(db database, log *slog.Logger) error) error {
+	log := logger(e.stderr, slog.LevelWarn)
+	db, cleanup := openDatabase(log)
+	defer cleanup()
+
+	if err := db.CheckSchema(ctx); err != nil {
+		return fmt.Errorf("%w, run migrate up first", err)
+	}
+	return fn(db, log)
+}
+
+// withTenant runs fn with the database and a context scoped to the tenant
+// named by slug
+func (e env) withTenant(ctx context.Context, slug string, fn func(ctx context.Context, db database, log *slog.Logger) error) error {
+	return e.withDatabase(ctx, func(db database, log *slog.Logger) error {
+		t, err := controller.NewTenantController(db, log).GetTenantBySlug(ctx, slug)
+		if err != nil {
+			return fmt.Errorf("tenant %q: %w", slug, err)
+		}
+		return fn(tenant.WithID(ctx, t.TenantID), db, log)
+	})
+}
+
+// withController runs fn with a controller on top of the database and a
+// context scoped to the tenant named by slug
+func (e env) withController(ctx context.Context, slug string, fn func(ctx context.Context, c controller.UserController) error) error {
+	return e.withTenant(ctx, slug, func(ctx context.Context, db database, log *slog.Logger) error {
+		return fn(ctx, newController(db, db, log))
+	})
+}
+
+// tenantFlag adds the --tenant flag of the commands working on users
+func tenantFlag(fs *flag.FlagSet) *string {
+	return fs.String("tenant", model.DefaultTenantSlug, "slug of the tenant to work on")
+}
+
+// splitList splits a comma separated environment variable, ignoring blanks
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
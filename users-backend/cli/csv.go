@@ -0,0 +1,163 @@
+package cli
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"users-backend/controller"
+	"users-backend/model"
+)
+
+// csvHeader is the header written by export, import only needs the columns
+// passed to CreateUser and ignores user_id. The custom attributes are written
+// as a JSON object, empty for a user without any.
+var csvHeader = []string{"user_id", "user_name", "first_name", "last_name", "email", "user_status", "department", "attributes"}
+
+var requiredImportColumns = []string{"user_name", "first_name", "last_name", "email", "user_status"}
+
+// runExport writes every user as CSV
+func runExport(ctx context.Context, e env, args []string) error {
+	fs := e.flagSet("export")
+	tenantSlug := tenantFlag(fs)
+	format := fs.String("format", "csv", "output format, only csv is supported")
+	output := fs.String("output", "-", "file to write, - for stdout")
+	if err := e.parse(fs, args); err != nil {
+		return err
+	}
+	if *format != "csv" {
+		return e.usageError("unsupported export format %q", *format)
+	}
+
+	return e.withController(ctx, *tenantSlug, func(ctx context.Context, c controller.UserController) error {
+		users, err := c.GetAllUsers(ctx)
+		if err != nil {
+			return err
+		}
+
+		if *output == "-" {
+			return writeCSV(e.stdout, *users)
+		}
+
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		if err := writeCSV(f, *users); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	})
+}
+
+func writeCSV(out io.Writer, users []model.User) error {
+	w := csv.NewWriter(out)
+	if err := w.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, u := range users {
+		var attributes string
+		if len(u.Attributes) > 0 {
+			b, err := json.Marshal(u.Attributes)
+			if err != nil {
+				return err
+			}
+			attributes = string(b)
+		}
+
+		err := w.Write([]string{
+			strconv.Itoa(u.UserID), u.UserName, u.FirstName, u.LastName, u.Email, u.UserStatus, u.Department.String, attributes,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// runImport creates the users of a CSV file with a header row in a single
+// transaction, the first invalid row aborts the import
+func runImport(ctx context.Context, e env, args []string) error {
+	fs := e.flagSet("import")
+	tenantSlug := tenantFlag(fs)
+	if err := e.parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return e.usageError("import needs a single CSV file, - for stdin")
+	}
+
+	var in io.Reader = os.Stdin
+	if name := fs.Arg(0); name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	r := csv.NewReader(in)
+	header, err := r.Read()
+	if err != nil {
+		return fmt.Errorf("reading header: %w", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[name] = i
+	}
+	for _, name := range requiredImportColumns {
+		if _, ok := columns[name]; !ok {
+			return fmt.Errorf("header has no %s column", name)
+		}
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok {
+			return record[i]
+		}
+		return ""
+	}
+
+	return e.withController(ctx, *tenantSlug, func(ctx context.Context, c controller.UserController) error {
+		imported := 0
+		err := c.RunInTx(ctx, func(ctx context.Context) error {
+			for {
+				record, err := r.Read()
+				if errors.Is(err, io.EOF) {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				line, _ := r.FieldPos(0)
+
+				var attributes model.Attributes
+				if s := field(record, "attributes"); s != "" {
+					if err := json.Unmarshal([]byte(s), &attributes); err != nil {
+						return fmt.Errorf("line %d: attributes: %w", line, err)
+					}
+				}
+
+				_, err = c.CreateUser(ctx,
+					field(record, "user_name"), field(record, "first_name"), field(record, "last_name"),
+					field(record, "email"), field(record, "user_status"), field(record, "department"), 0, attributes)
+				if err != nil {
+					return fmt.Errorf("line %d: %w", line, err)
+				}
+				imported++
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("nothing imported, %w", err)
+		}
+
+		fmt.Fprintf(e.stdout, "imported %d users\n", imported)
+		return nil
+	})
+}
@@ -0,0 +1,126 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"users-backend/controller"
+)
+
+// groupJSON is the group printed by group list, with the field names of the
+// API
+type groupJSON struct {
+	GroupID     int    `json:"group_id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	ParentID    *int   `json:"parent_id,omitempty"`
+}
+
+// runGroup lists and creates the groups of a tenant and manages their members
+func runGroup(ctx context.Context, e env, args []string) error {
+	if len(args) == 0 {
+		return e.usageError("group needs list, create, add or remove")
+	}
+
+	switch args[0] {
+	case "list":
+		return runGroupList(ctx, e, args[1:])
+	case "create":
+		return runGroupCreate(ctx, e, args[1:])
+	case "add":
+		return runGroupMembers(ctx, e, "group add", args[1:], controller.GroupController.AddGroupMembers)
+	case "remove":
+		return runGroupMembers(ctx, e, "group remove", args[1:], controller.GroupController.RemoveGroupMembers)
+	}
+	return e.usageError("unknown group command %q", args[0])
+}
+
+func runGroupList(ctx context.Context, e env, args []string) error {
+	fs := e.flagSet("group list")
+	tenantSlug := tenantFlag(fs)
+	if err := e.parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return e.usageError("group list takes no arguments")
+	}
+
+	return e.withTenant(ctx, *tenantSlug, func(ctx context.Context, db database, log *slog.Logger) error {
+		groups, err := controller.NewGroupController(db, db, log).GetGroups(ctx)
+		if err != nil {
+			return err
+		}
+
+		list := []groupJSON{}
+		for _, g := range *groups {
+			item := groupJSON{GroupID: g.GroupID, Name: g.Name, Description: g.Description}
+			if g.ParentID.Valid {
+				parentID := int(g.ParentID.Int64)
+				item.ParentID = &parentID
+			}
+			list = append(list, item)
+		}
+
+		enc := json.NewEncoder(e.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(list)
+	})
+}
+
+func runGroupCreate(ctx context.Context, e env, args []string) error {
+	fs := e.flagSet("group create")
+	tenantSlug := tenantFlag(fs)
+	name := fs.String("name", "", "name (required)")
+	description := fs.String("description", "", "description")
+	parentID := fs.Int("parent", 0, "id of the group to nest the group in")
+	if err := e.parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return e.usageError("group create takes no arguments")
+	}
+
+	return e.withTenant(ctx, *tenantSlug, func(ctx context.Context, db database, log *slog.Logger) error {
+		id, err := controller.NewGroupController(db, db, log).CreateGroup(ctx, *name, *description, *parentID)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(e.stdout, id)
+		return nil
+	})
+}
+
+// runGroupMembers adds or removes the users given after the group id and
+// prints how many were added or removed
+func runGroupMembers(ctx context.Context, e env, name string, args []string, update func(c controller.GroupController, ctx context.Context, group_id int, user_ids []int) (int, error)) error {
+	fs := e.flagSet(name)
+	tenantSlug := tenantFlag(fs)
+	if err := e.parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() < 2 {
+		return e.usageError("%s needs a group id and user ids", name)
+	}
+
+	ids := make([]int, fs.NArg())
+	for i, arg := range fs.Args() {
+		id, err := strconv.Atoi(arg)
+		if err != nil || id < 1 {
+			return e.usageError("invalid id %q", arg)
+		}
+		ids[i] = id
+	}
+
+	return e.withTenant(ctx, *tenantSlug, func(ctx context.Context, db database, log *slog.Logger) error {
+		n, err := update(controller.NewGroupController(db, db, log), ctx, ids[0], ids[1:])
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(e.stdout, n)
+		return nil
+	})
+}
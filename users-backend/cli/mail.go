@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+	"users-backend/controller"
+	"users-backend/mail"
+	"users-backend/repo"
+)
+
+// defaultLinkBaseURL is the Angular dev server, like the default CORS origin
+const defaultLinkBaseURL = "http://localhost:4200"
+
+// mailer builds the Mailer picked by MAIL_TRANSPORT: smtp relays through
+// SMTP_ADDR, authenticating with SMTP_USERNAME and SMTP_PASSWORD when set and
+// over implicit TLS when SMTP_TLS is implicit. file writes .eml files to
+// MAIL_DIR and log logs the messages. It returns nil when unset.
+func mailer(log *slog.Logger) (mail.Mailer, error) {
+	from := os.Getenv("MAIL_FROM")
+
+	switch transport := os.Getenv("MAIL_TRANSPORT"); transport {
+	case "":
+		return nil, nil
+	case "smtp":
+		if from == "" {
+			return nil, errors.New("the smtp mail transport needs MAIL_FROM")
+		}
+		cfg := mail.SMTPConfig{
+			Addr:     os.Getenv("SMTP_ADDR"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}
+		switch tls := os.Getenv("SMTP_TLS"); tls {
+		case "", "starttls":
+		case "implicit":
+			cfg.ImplicitTLS = true
+		default:
+			return nil, fmt.Errorf("unknown SMTP_TLS %q, use starttls or implicit", tls)
+		}
+		m, err := mail.NewSMTPMailer(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SMTP settings: %w", err)
+		}
+		log.Info("mail sent through smtp", "addr", cfg.Addr, "implicit_tls", cfg.ImplicitTLS)
+		return m, nil
+	case "file":
+		if from == "" {
+			from = "no-reply@localhost"
+		}
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "mail"
+		}
+		m, err := mail.NewFileMailer(dir, from)
+		if err != nil {
+			return nil, err
+		}
+		log.Warn("mail written to files, not sent", "dir", dir)
+		return m, nil
+	case "log":
+		log.Warn("mail logged, not sent")
+		return mail.NewLogMailer(log), nil
+	default:
+		return nil, fmt.Errorf("unknown MAIL_TRANSPORT %q, use smtp, file or log", transport)
+	}
+}
+
+// accountController enables the email verification and password reset links
+// when MAIL_TRANSPORT is set, it returns nil otherwise. The links open the
+// frontend at ACCOUNT_LINK_BASE_URL and are valid for EMAIL_VERIFICATION_TTL
+// (48h) and PASSWORD_RESET_TTL (1h). MAIL_TEMPLATES_DIR replaces the default
+// templates.
+func accountController(users repo.UserRepo, tokens repo.UserTokenRepo, credentials repo.CredentialRepo, log *slog.Logger) (controller.AccountController, error) {
+	m, err := mailer(log)
+	if m == nil || err != nil {
+		return nil, err
+	}
+
+	verifyTTL, resetTTL := 48*time.Hour, time.Hour
+	for name, ttl := range map[string]*time.Duration{"EMAIL_VERIFICATION_TTL": &verifyTTL, "PASSWORD_RESET_TTL": &resetTTL} {
+		if s := os.Getenv(name); s != "" {
+			if *ttl, err = time.ParseDuration(s); err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", name, err)
+			}
+		}
+	}
+	opts := []controller.AccountOption{controller.WithTokenTTL(verifyTTL, resetTTL)}
+
+	if dir := os.Getenv("MAIL_TEMPLATES_DIR"); dir != "" {
+		templates, err := mail.ParseTemplates(os.DirFS(dir))
+		if err != nil {
+			return nil, fmt.Errorf("invalid MAIL_TEMPLATES_DIR: %w", err)
+		}
+		opts = append(opts, controller.WithTemplates(templates))
+	}
+
+	baseURL := os.Getenv("ACCOUNT_LINK_BASE_URL")
+	if baseURL == "" {
+		baseURL = defaultLinkBaseURL
+	}
+
+	// Resets go through the password policy, without signing tokens
+	authOpts, err := authOptions()
+	if err != nil {
+		return nil, err
+	}
+	passwords := controller.NewAuthController(users, credentials, nil, log, authOpts...)
+
+	log.Info("email verification and password reset enabled", "link_base_url", baseURL)
+	return controller.NewAccountController(users, tokens, passwords, m, baseURL, log, opts...), nil
+}
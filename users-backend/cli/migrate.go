@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"text/tabwriter"
+	"time"
+	"users-backend/repo/migrate"
+)
+
+// runMigrate applies, reverts or lists the schema migrations
+func runMigrate(ctx context.Context, e env, args []string) error {
+	if len(args) == 0 {
+		return e.usageError("migrate needs up, down or status")
+	}
+	switch args[0] {
+	case "up", "down", "status":
+	default:
+		return e.usageError("unknown migrate command %q", args[0])
+	}
+
+	db, cleanup := openDatabase(logger(e.stderr, slog.LevelWarn))
+	defer cleanup()
+
+	switch args[0] {
+	case "up":
+		if err := e.parse(e.flagSet("migrate up"), args[1:]); err != nil {
+			return err
+		}
+		applied, err := db.MigrateUp(ctx)
+		printMigrations(e, "applied", applied)
+		return err
+
+	case "down":
+		fs := e.flagSet("migrate down")
+		steps := fs.Int("steps", 1, "number of migrations to revert")
+		if err := e.parse(fs, args[1:]); err != nil {
+			return err
+		}
+		if *steps < 1 {
+			return e.usageError("--steps must be at least 1")
+		}
+		reverted, err := db.MigrateDown(ctx, *steps)
+		printMigrations(e, "reverted", reverted)
+		return err
+
+	case "status":
+		if err := e.parse(e.flagSet("migrate status"), args[1:]); err != nil {
+			return err
+		}
+		statuses, err := db.MigrationStatus(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(e.stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "MIGRATION\tAPPLIED AT")
+		for _, st := range statuses {
+			appliedAt := "pending"
+			if st.Applied() {
+				appliedAt = st.AppliedAt.UTC().Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%s\t%s\n", st.Migration, appliedAt)
+		}
+		return w.Flush()
+	}
+	return nil
+}
+
+func printMigrations(e env, verb string, migrations []migrate.Migration) {
+	if len(migrations) == 0 {
+		fmt.Fprintf(e.stdout, "no migration %s\n", verb)
+		return
+	}
+	for _, m := range migrations {
+		fmt.Fprintf(e.stdout, "%s %s\n", verb, m)
+	}
+}
@@ -0,0 +1,98 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+	"users-backend/controller"
+	"users-backend/model"
+)
+
+// maxNameAttempts bounds the numbered variants tried when a generated user
+// name is taken
+const maxNameAttempts = 100
+
+var (
+	seedFirstNames = []string{
+		"Alice", "Amelia", "Aria", "Ben", "Carlos", "Chloe", "Daniel", "Elena",
+		"Emma", "Ethan", "Fatima", "Grace", "Hana", "Isaac", "Jack", "James",
+		"Julia", "Kenji", "Leo", "Liam", "Lucas", "Maya", "Mia", "Noah",
+		"Olivia", "Omar", "Priya", "Sofia", "Wei", "Zoe",
+	}
+	seedLastNames = []string{
+		"Anderson", "Brown", "Chen", "Davis", "Garcia", "Hernandez", "Ivanov",
+		"Jackson", "Johnson", "Kim", "Kowalski", "Lee", "Lopez", "Martin",
+		"Miller", "Moore", "Nguyen", "Okafor", "Patel", "Rossi", "Sato",
+		"Schmidt", "Silva", "Smith", "Taylor", "Thomas", "Walker", "White",
+		"Williams", "Wilson",
+	}
+	seedDepartments = []string{
+		"Engineering", "Finance", "Human Resources", "Legal", "Marketing",
+		"Operations", "Sales", "Support",
+	}
+)
+
+// runSeed creates fake users with plausible names, emails and departments
+func runSeed(ctx context.Context, e env, args []string) error {
+	fs := e.flagSet("seed")
+	tenantSlug := tenantFlag(fs)
+	count := fs.Int("count", 10, "number of users to create")
+	seed := fs.Uint64("seed", 0, "random seed, the same seed creates the same users (random when 0)")
+	if err := e.parse(fs, args); err != nil {
+		return err
+	}
+	if *count < 1 {
+		return e.usageError("--count must be at least 1")
+	}
+	if *seed == 0 {
+		*seed = uint64(time.Now().UnixNano())
+	}
+
+	rnd := rand.New(rand.NewPCG(*seed, *seed))
+	return e.withController(ctx, *tenantSlug, func(ctx context.Context, c controller.UserController) error {
+		for i := 0; i < *count; i++ {
+			if _, err := createFakeUser(ctx, c, rnd); err != nil {
+				return fmt.Errorf("user %d of %d: %w", i+1, *count, err)
+			}
+		}
+		fmt.Fprintf(e.stdout, "created %d users\n", *count)
+		return nil
+	})
+}
+
+// createFakeUser creates a random user, numbering its user name when the plain
+// first.last is taken
+func createFakeUser(ctx context.Context, c controller.UserController, rnd *rand.Rand) (int, error) {
+	firstName := seedFirstNames[rnd.IntN(len(seedFirstNames))]
+	lastName := seedLastNames[rnd.IntN(len(seedLastNames))]
+	base := strings.ToLower(firstName + "." + lastName)
+
+	department := ""
+	if rnd.IntN(10) > 0 {
+		department = seedDepartments[rnd.IntN(len(seedDepartments))]
+	}
+
+	status := model.Active
+	switch n := rnd.IntN(20); {
+	case n == 0:
+		status = model.Terminated
+	case n < 3:
+		status = model.Inactive
+	}
+
+	for attempt := 1; ; attempt++ {
+		userName := base
+		if attempt > 1 {
+			userName = fmt.Sprintf("%s%d", base, attempt)
+		}
+
+		id, err := c.CreateUser(ctx, userName, firstName, lastName, userName+"@example.com", status, department, 0, nil)
+		if errors.Is(err, controller.ErrUserAlreadyExists) && attempt < maxNameAttempts {
+			continue
+		}
+		return id, err
+	}
+}
@@ -0,0 +1,333 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"users-backend/controller"
+	"users-backend/handler"
+	"users-backend/health"
+	"users-backend/idempotency"
+	"users-backend/model"
+	"users-backend/ratelimit"
+	"users-backend/repo"
+	"users-backend/repo/cache"
+	"users-backend/repo/metrics"
+	"users-backend/repo/postgres"
+	"users-backend/tlsconfig"
+	"users-backend/tracing"
+	"users-backend/web"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// runServe runs the HTTP server until ctx is cancelled, over TLS and HTTP/2
+// when TLS_CERT_FILE is set. Pending migrations are applied on start unless
+// AUTO_MIGRATE is false.
+func runServe(ctx context.Context, e env, args []string) error {
+	fs := e.flagSet("serve")
+	addr := fs.String("addr", ":8080", "address to listen on")
+	if err := e.parse(fs, args); err != nil {
+		return err
+	}
+
+	log := logger(e.stdout, slog.LevelInfo)
+	slog.SetDefault(log)
+
+	shutdownTracing, err := tracing.Init(ctx)
+	if err != nil {
+		return err
+	}
+
+	tlsCfg, useTLS, err := tlsconfig.FromEnv()
+	if err != nil {
+		return err
+	}
+	var certs *tlsconfig.Reloader
+	if useTLS {
+		if certs, err = tlsconfig.NewReloader(tlsCfg, log); err != nil {
+			return err
+		}
+		go certs.Run(ctx)
+	}
+
+	db, cleanup := openDatabase(log)
+	defer cleanup()
+	if pgRepo, ok := db.(*postgres.PostgresRepo); ok {
+		prometheus.MustRegister(postgres.NewPoolStatsCollector(pgRepo))
+	}
+
+	if autoMigrate, err := strconv.ParseBool(os.Getenv("AUTO_MIGRATE")); err != nil || autoMigrate {
+		applied, err := db.MigrateUp(ctx)
+		if err != nil {
+			return err
+		}
+		for _, m := range applied {
+			log.Info("migration applied", "migration", m.String())
+		}
+	}
+
+	// USER_CACHE=memory keeps looked up users in process, only enable it with a
+	// single replica or when stale reads for USER_CACHE_TTL are acceptable
+	var userRepo repo.UserRepo = metrics.NewMetricsRepo(db)
+	var tokenRepo repo.UserTokenRepo = db
+	var attributeRepo repo.AttributeRepo = db
+	if os.Getenv("USER_CACHE") == "memory" {
+		ttl, err := time.ParseDuration(os.Getenv("USER_CACHE_TTL"))
+		if err != nil {
+			ttl = time.Minute
+		}
+		size, err := strconv.Atoi(os.Getenv("USER_CACHE_SIZE"))
+		if err != nil {
+			size = 10000
+		}
+
+		cached := cache.NewCacheRepo(userRepo, cache.NewLRUStore(size), ttl)
+		// Writes to the users from the other repos must drop them as well
+		userRepo = cached
+		tokenRepo = cache.NewTokenRepo(db, cached)
+		attributeRepo = cache.NewAttributeRepo(db, cached)
+		log.Info("user cache enabled", "ttl", ttl.String(), "size", size)
+	}
+
+	accountCtl, err := accountController(userRepo, tokenRepo, db, log)
+	if err != nil {
+		return err
+	}
+	var decorators []controller.Decorator
+	if accountCtl != nil {
+		decorators = append(decorators, controller.WithEmailVerification(accountCtl, log))
+	}
+
+	c := newController(userRepo, db, log, decorators...)
+	tenantCfg, err := tenantConfig(controller.NewTenantController(db, log))
+	if err != nil {
+		return err
+	}
+
+	authCtl, err := authController(userRepo, db, db, db, db, log)
+	if err != nil {
+		return err
+	}
+	twoFactorCtl, _ := authCtl.(controller.TwoFactorController)
+	var oidcCtl controller.OIDCController
+	if os.Getenv("OIDC_ISSUER") != "" {
+		oidcCtl, _ = authCtl.(controller.OIDCController)
+	}
+
+	h := health.New(2 * time.Second)
+	h.AddReadinessCheck("database", db.Ping)
+	h.AddReadinessCheck("migrations", db.CheckSchema)
+
+	srv := echo.New()
+	srv.HideBanner = true
+	srv.HidePort = true
+	idempotencyTTL, err := time.ParseDuration(os.Getenv("IDEMPOTENCY_TTL"))
+	if err != nil {
+		idempotencyTTL = 24 * time.Hour
+	}
+	rateLimit, err := rateLimitConfig()
+	if err != nil {
+		return err
+	}
+	maxBodySize, _ := strconv.ParseInt(os.Getenv("MAX_BODY_SIZE"), 10, 64)
+	trustedProxies, err := parseCIDRs(splitList(os.Getenv("TRUSTED_PROXIES")))
+	if err != nil {
+		return err
+	}
+
+	handler.InitRouter(srv, c, handler.RouterConfig{
+		Health:           h,
+		Logger:           log,
+		IdempotencyStore: idempotency.NewMemoryStore(),
+		IdempotencyTTL:   idempotencyTTL,
+		AllowOrigins:     splitList(os.Getenv("CORS_ALLOW_ORIGINS")),
+		SPA:              spaConfig(log),
+		RateLimit:        rateLimit,
+		MaxBodySize:      maxBodySize,
+		TrustedProxies:   trustedProxies,
+		Tenant:           tenantCfg,
+		Attributes:       controller.NewAttributeController(attributeRepo, log),
+		Groups:           controller.NewGroupController(db, userRepo, log),
+		Auth:             authCtl,
+		Account:          accountCtl,
+		TwoFactor:        twoFactorCtl,
+		OIDC:             oidcCtl,
+	})
+
+	server := &http.Server{
+		Addr:     *addr,
+		Handler:  srv,
+		ErrorLog: slog.NewLogLogger(log.With("component", "http").Handler(), slog.LevelWarn),
+	}
+	if useTLS {
+		server.TLSConfig = certs.TLSConfig()
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		log.Info("starting server", "addr", *addr, "tls", useTLS, "mtls", tlsCfg.ClientCAFile != "")
+
+		var err error
+		if useTLS {
+			// The certificates come from TLSConfig
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errc <- err
+		}
+	}()
+
+	select {
+	case err := <-errc:
+		log.Error("shutting down the server", "error", err)
+		return err
+	case <-ctx.Done():
+	}
+
+	// Fail readiness first and give load balancers time to notice before the
+	// listener closes
+	h.Shutdown()
+	drainDelay, _ := time.ParseDuration(os.Getenv("SHUTDOWN_DRAIN_DELAY"))
+	log.Info("shutting down", "drain_delay", drainDelay.String())
+	time.Sleep(drainDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Error("failed to shut down the server", "error", err)
+		return err
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Error("failed to flush traces", "error", err)
+	}
+	return nil
+}
+
+// spaConfig serves the frontend from SPA_DIR, or the build embedded in the
+// binary when there is one. SPA_API_BASE_URL tells the frontend where the API
+// is, it defaults to the origin serving it.
+func spaConfig(log *slog.Logger) *handler.SPAConfig {
+	var fsys fs.FS
+	if dir := os.Getenv("SPA_DIR"); dir != "" {
+		fsys = os.DirFS(dir)
+		log.Info("serving frontend", "dir", dir)
+	} else if dist, ok := web.Dist(); ok {
+		fsys = dist
+		log.Info("serving embedded frontend")
+	} else {
+		return nil
+	}
+
+	return &handler.SPAConfig{
+		FS: fsys,
+		RuntimeConfig: map[string]string{
+			"apiBaseUrl": os.Getenv("SPA_API_BASE_URL"),
+		},
+	}
+}
+
+// rateLimitConfig reads the rules from RATE_LIMITS, the defaults when unset and
+// no limit when it is off
+func rateLimitConfig() (*handler.RateLimitConfig, error) {
+	rules := handler.DefaultRateLimitRules
+	switch s := os.Getenv("RATE_LIMITS"); s {
+	case "":
+	case "off":
+		return nil, nil
+	default:
+		var err error
+		if rules, err = ratelimit.ParseRules(s); err != nil {
+			return nil, err
+		}
+	}
+
+	return &handler.RateLimitConfig{
+		Store:        ratelimit.NewMemoryStore(),
+		Rules:        rules,
+		APIKeyHeader: os.Getenv("RATE_LIMIT_API_KEY_HEADER"),
+		APIKeys:      splitList(os.Getenv("RATE_LIMIT_API_KEYS")),
+	}, nil
+}
+
+// tenantConfig builds the tenant resolution from TENANT_RESOLVERS, a comma
+// separated list of header, subdomain and token tried in order. Requests naming
+// no tenant use TENANT_DEFAULT, the default tenant when unset and a 400 when it
+// is none.
+func tenantConfig(c controller.TenantController) (*handler.TenantConfig, error) {
+	cfg := &handler.TenantConfig{
+		Controller: c,
+		Default:    model.DefaultTenantSlug,
+		AdminToken: os.Getenv("ADMIN_API_TOKEN"),
+	}
+	switch d := os.Getenv("TENANT_DEFAULT"); d {
+	case "":
+	case "none":
+		cfg.Default = ""
+	default:
+		cfg.Default = d
+	}
+
+	for _, name := range splitList(os.Getenv("TENANT_RESOLVERS")) {
+		switch name {
+		case "header":
+			header := os.Getenv("TENANT_HEADER")
+			if header == "" {
+				header = handler.HeaderTenant
+			}
+			cfg.Resolvers = append(cfg.Resolvers, handler.TenantFromHeader(header))
+		case "subdomain":
+			domain := os.Getenv("TENANT_DOMAIN")
+			if domain == "" {
+				return nil, errors.New("the subdomain tenant resolver needs TENANT_DOMAIN")
+			}
+			cfg.Resolvers = append(cfg.Resolvers, handler.TenantFromSubdomain(domain))
+		case "token":
+			secret := os.Getenv("TENANT_TOKEN_SECRET")
+			if secret == "" {
+				return nil, errors.New("the token tenant resolver needs TENANT_TOKEN_SECRET")
+			}
+			claim := os.Getenv("TENANT_TOKEN_CLAIM")
+			if claim == "" {
+				claim = "tenant"
+			}
+			cfg.Resolvers = append(cfg.Resolvers, handler.TenantFromToken([]byte(secret), claim))
+		default:
+			return nil, fmt.Errorf("unknown tenant resolver %q in TENANT_RESOLVERS", name)
+		}
+	}
+
+	return cfg, nil
+}
+
+// parseCIDRs parses networks, a bare IP is a network of one address
+func parseCIDRs(items []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, item := range items {
+		if !strings.Contains(item, "/") {
+			if ip := net.ParseIP(item); ip != nil && ip.To4() != nil {
+				item += "/32"
+			} else {
+				item += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
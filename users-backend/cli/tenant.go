@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"users-backend/controller"
+)
+
+// tenantJSON is the tenant printed by tenant list, with the field names of the
+// API
+type tenantJSON struct {
+	TenantID int    `json:"tenant_id"`
+	Slug     string `json:"slug"`
+	Name     string `json:"name"`
+}
+
+// runTenant lists and creates tenants
+func runTenant(ctx context.Context, e env, args []string) error {
+	if len(args) == 0 {
+		return e.usageError("tenant needs list or create")
+	}
+
+	switch args[0] {
+	case "list":
+		return runTenantList(ctx, e, args[1:])
+	case "create":
+		return runTenantCreate(ctx, e, args[1:])
+	}
+	return e.usageError("unknown tenant command %q", args[0])
+}
+
+func runTenantList(ctx context.Context, e env, args []string) error {
+	fs := e.flagSet("tenant list")
+	if err := e.parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return e.usageError("tenant list takes no arguments")
+	}
+
+	return e.withDatabase(ctx, func(db database, log *slog.Logger) error {
+		tenants, err := controller.NewTenantController(db, log).GetAllTenants(ctx)
+		if err != nil {
+			return err
+		}
+
+		list := []tenantJSON{}
+		for _, t := range *tenants {
+			list = append(list, tenantJSON{TenantID: t.TenantID, Slug: t.Slug, Name: t.Name})
+		}
+
+		enc := json.NewEncoder(e.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(list)
+	})
+}
+
+func runTenantCreate(ctx context.Context, e env, args []string) error {
+	fs := e.flagSet("tenant create")
+	slug := fs.String("slug", "", "slug, used in subdomains and the tenant header (required)")
+	name := fs.String("name", "", "display name (required)")
+	if err := e.parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return e.usageError("tenant create takes no arguments")
+	}
+
+	return e.withDatabase(ctx, func(db database, log *slog.Logger) error {
+		id, err := controller.NewTenantController(db, log).CreateTenant(ctx, *slug, *name)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(e.stdout, id)
+		return nil
+	})
+}
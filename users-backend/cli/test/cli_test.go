@@ -0,0 +1,278 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"users-backend/cli"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("CLI", func() {
+	var (
+		dir            string
+		stdout, stderr *bytes.Buffer
+		ctx            = context.Background()
+	)
+
+	run := func(args ...string) error {
+		stdout.Reset()
+		stderr.Reset()
+		return cli.Run(ctx, args, stdout, stderr)
+	}
+
+	mustRun := func(args ...string) string {
+		gomega.Expect(run(args...)).Should(gomega.Succeed(), "stderr: %s", stderr)
+		return stdout.String()
+	}
+
+	exportRecords := func() [][]string {
+		records, err := csv.NewReader(strings.NewReader(mustRun("export"))).ReadAll()
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		return records
+	}
+
+	ginkgo.BeforeEach(func() {
+		dir = ginkgo.GinkgoT().TempDir()
+		ginkgo.GinkgoT().Setenv("DATABASE_URL", "sqlite://"+filepath.Join(dir, "users.db"))
+		stdout, stderr = &bytes.Buffer{}, &bytes.Buffer{}
+	})
+
+	ginkgo.It("should reject unknown commands", func() {
+		gomega.Expect(errors.Is(run("frobnicate"), cli.ErrUsage)).Should(gomega.BeTrue())
+		gomega.Expect(stderr.String()).Should(gomega.ContainSubstring("Usage:"))
+	})
+
+	ginkgo.Describe("migrate", func() {
+		ginkgo.It("should apply, list and revert the migrations", func() {
+			gomega.Expect(mustRun("migrate", "status")).Should(gomega.MatchRegexp(`0001_create_users\s+pending`))
+
+			gomega.Expect(mustRun("migrate", "up")).Should(gomega.Equal("applied 0001_create_users\napplied 0002_create_tenants\napplied 0003_add_user_attributes\napplied 0004_add_user_managers\napplied 0005_create_groups\napplied 0006_create_user_credentials\napplied 0007_create_user_tokens\napplied 0008_create_user_two_factor\napplied 0009_create_oauth_clients\n"))
+			gomega.Expect(mustRun("migrate", "up")).Should(gomega.Equal("no migration applied\n"))
+			gomega.Expect(mustRun("migrate", "status")).ShouldNot(gomega.ContainSubstring("pending"))
+
+			gomega.Expect(mustRun("migrate", "down", "--steps", "1")).Should(gomega.Equal("reverted 0009_create_oauth_clients\n"))
+			gomega.Expect(mustRun("migrate", "status")).Should(gomega.ContainSubstring("pending"))
+		})
+
+		ginkgo.It("should ask for a migration before other commands run", func() {
+			err := run("user", "get", "1")
+			gomega.Expect(err).Should(gomega.MatchError(gomega.ContainSubstring("migrate up")))
+		})
+	})
+
+	ginkgo.Describe("with a migrated database", func() {
+		ginkgo.BeforeEach(func() {
+			mustRun("migrate", "up")
+		})
+
+		ginkgo.It("should seed the same users for the same seed", func() {
+			gomega.Expect(mustRun("seed", "--count", "5", "--seed", "42")).Should(gomega.Equal("created 5 users\n"))
+			first := exportRecords()
+			gomega.Expect(first).Should(gomega.HaveLen(6))
+
+			ginkgo.GinkgoT().Setenv("DATABASE_URL", "sqlite://"+filepath.Join(dir, "other.db"))
+			mustRun("migrate", "up")
+			mustRun("seed", "--count", "5", "--seed", "42")
+			gomega.Expect(exportRecords()).Should(gomega.Equal(first))
+		})
+
+		ginkgo.It("should number user names already taken when seeding", func() {
+			mustRun("seed", "--count", "100", "--seed", "1")
+
+			names := map[string]bool{}
+			for _, record := range exportRecords()[1:] {
+				gomega.Expect(names).ShouldNot(gomega.HaveKey(record[1]))
+				names[record[1]] = true
+				gomega.Expect(record[4]).Should(gomega.Equal(record[1] + "@example.com"))
+			}
+			gomega.Expect(names).Should(gomega.HaveLen(100))
+		})
+
+		ginkgo.It("should create, get and change the status of a user", func() {
+			id := strings.TrimSpace(mustRun("user", "create", "--user-name", "johndoe", "--first-name", "John", "--last-name", "Doe", "--email", "johndoe@email.com", "--department", "IT"))
+			gomega.Expect(id).Should(gomega.Equal("1"))
+
+			mustRun("user", "set-status", id, "inactive")
+
+			var user map[string]any
+			gomega.Expect(json.Unmarshal([]byte(mustRun("user", "get", id)), &user)).Should(gomega.Succeed())
+			gomega.Expect(user).Should(gomega.Equal(map[string]any{
+				"user_id":     float64(1),
+				"user_name":   "johndoe",
+				"first_name":  "John",
+				"last_name":   "Doe",
+				"email":       "johndoe@email.com",
+				"user_status": "I",
+				"department":  "IT",
+			}))
+		})
+
+		ginkgo.It("should validate users like the API", func() {
+			err := run("user", "create", "--user-name", "admin", "--first-name", "John", "--last-name", "Doe", "--email", "johndoe@email.com")
+			gomega.Expect(err).Should(gomega.MatchError(gomega.ContainSubstring("reserved")))
+
+			err = run("user", "set-status", "1", "X")
+			gomega.Expect(err).Should(gomega.HaveOccurred())
+		})
+
+		ginkgo.It("should import an export into another database", func() {
+			mustRun("seed", "--count", "3", "--seed", "7")
+			file := filepath.Join(dir, "users.csv")
+			mustRun("export", "--output", file)
+
+			ginkgo.GinkgoT().Setenv("DATABASE_URL", "sqlite://"+filepath.Join(dir, "other.db"))
+			mustRun("migrate", "up")
+			gomega.Expect(mustRun("import", file)).Should(gomega.Equal("imported 3 users\n"))
+
+			exported, err := os.ReadFile(file)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(mustRun("export")).Should(gomega.Equal(string(exported)))
+		})
+
+		ginkgo.It("should import nothing when a row is invalid", func() {
+			file := filepath.Join(dir, "users.csv")
+			gomega.Expect(os.WriteFile(file, []byte(
+				"user_name,first_name,last_name,email,user_status\n"+
+					"johndoe,John,Doe,johndoe@email.com,A\n"+
+					"janedoe,Jane,Doe,not-an-email,A\n"), 0o600)).Should(gomega.Succeed())
+
+			err := run("import", file)
+			gomega.Expect(err).Should(gomega.MatchError(gomega.ContainSubstring("line 3")))
+			gomega.Expect(exportRecords()).Should(gomega.HaveLen(1))
+		})
+
+		ginkgo.It("should create and list tenants", func() {
+			gomega.Expect(strings.TrimSpace(mustRun("tenant", "create", "--slug", "Acme", "--name", "Acme Corp"))).Should(gomega.Equal("2"))
+
+			var tenants []map[string]any
+			gomega.Expect(json.Unmarshal([]byte(mustRun("tenant", "list")), &tenants)).Should(gomega.Succeed())
+			gomega.Expect(tenants).Should(gomega.Equal([]map[string]any{
+				{"tenant_id": float64(1), "slug": "default", "name": "Default"},
+				{"tenant_id": float64(2), "slug": "acme", "name": "Acme Corp"},
+			}))
+
+			err := run("tenant", "create", "--slug", "-acme", "--name", "Acme")
+			gomega.Expect(err).Should(gomega.MatchError(gomega.ContainSubstring("invalid tenant")))
+		})
+
+		ginkgo.It("should keep the users of each tenant apart", func() {
+			mustRun("tenant", "create", "--slug", "acme", "--name", "Acme Corp")
+			mustRun("seed", "--count", "2", "--seed", "7")
+			mustRun("seed", "--count", "3", "--seed", "7", "--tenant", "acme")
+
+			gomega.Expect(exportRecords()).Should(gomega.HaveLen(3))
+			records, err := csv.NewReader(strings.NewReader(mustRun("export", "--tenant", "acme"))).ReadAll()
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(records).Should(gomega.HaveLen(4))
+
+			err = run("user", "get", "--tenant", "acme", "1")
+			gomega.Expect(err).Should(gomega.HaveOccurred())
+
+			err = run("export", "--tenant", "nope")
+			gomega.Expect(err).Should(gomega.MatchError(gomega.ContainSubstring(`tenant "nope"`)))
+		})
+
+		ginkgo.It("should define attributes and carry them through export and import", func() {
+			gomega.Expect(strings.TrimSpace(mustRun("attribute", "create", "--name", "employee_number", "--type", "number", "--unique"))).Should(gomega.Equal("1"))
+			mustRun("attribute", "create", "--name", "location", "--type", "enum", "--values", "Paris,Berlin")
+
+			var attributes []map[string]any
+			gomega.Expect(json.Unmarshal([]byte(mustRun("attribute", "list")), &attributes)).Should(gomega.Succeed())
+			gomega.Expect(attributes).Should(gomega.HaveLen(2))
+			gomega.Expect(attributes[1]).Should(gomega.Equal(map[string]any{
+				"attribute_id": float64(2), "name": "location", "type": "enum", "required": false, "unique": false,
+				"enum_values": []any{"Paris", "Berlin"},
+			}))
+
+			id := strings.TrimSpace(mustRun("user", "create", "--user-name", "johndoe", "--first-name", "John", "--last-name", "Doe", "--email", "johndoe@email.com",
+				"--attr", "employee_number=42", "--attr", "location=Paris"))
+			err := run("user", "create", "--user-name", "janedoe", "--first-name", "Jane", "--last-name", "Doe", "--email", "janedoe@email.com", "--attr", "employee_number=42")
+			gomega.Expect(err).Should(gomega.MatchError(gomega.ContainSubstring("attributes.employee_number is already taken")))
+
+			var user map[string]any
+			gomega.Expect(json.Unmarshal([]byte(mustRun("user", "get", id)), &user)).Should(gomega.Succeed())
+			gomega.Expect(user["attributes"]).Should(gomega.Equal(map[string]any{"employee_number": float64(42), "location": "Paris"}))
+
+			file := filepath.Join(dir, "users.csv")
+			mustRun("export", "--output", file)
+			gomega.Expect(exportRecords()[1][7]).Should(gomega.Equal(`{"employee_number":42,"location":"Paris"}`))
+
+			ginkgo.GinkgoT().Setenv("DATABASE_URL", "sqlite://"+filepath.Join(dir, "other.db"))
+			mustRun("migrate", "up")
+			err = run("import", file)
+			gomega.Expect(err).Should(gomega.MatchError(gomega.ContainSubstring("attributes.employee_number is not a defined attribute")))
+
+			mustRun("attribute", "create", "--name", "employee_number", "--type", "number")
+			mustRun("attribute", "create", "--name", "location", "--type", "enum", "--values", "Paris,Berlin")
+			gomega.Expect(mustRun("import", file)).Should(gomega.Equal("imported 1 users\n"))
+
+			mustRun("attribute", "delete", "2")
+			gomega.Expect(json.Unmarshal([]byte(mustRun("user", "get", "1")), &user)).Should(gomega.Succeed())
+			gomega.Expect(user["attributes"]).Should(gomega.Equal(map[string]any{"employee_number": float64(42)}))
+		})
+
+		ginkgo.It("should create groups and manage their members", func() {
+			mustRun("seed", "--count", "3", "--seed", "7")
+			gomega.Expect(strings.TrimSpace(mustRun("group", "create", "--name", "Engineering"))).Should(gomega.Equal("1"))
+			gomega.Expect(strings.TrimSpace(mustRun("group", "create", "--name", "Backend", "--parent", "1"))).Should(gomega.Equal("2"))
+
+			var groups []map[string]any
+			gomega.Expect(json.Unmarshal([]byte(mustRun("group", "list")), &groups)).Should(gomega.Succeed())
+			gomega.Expect(groups).Should(gomega.Equal([]map[string]any{
+				{"group_id": float64(2), "name": "Backend", "parent_id": float64(1)},
+				{"group_id": float64(1), "name": "Engineering"},
+			}))
+
+			gomega.Expect(mustRun("group", "add", "2", "1", "2", "2")).Should(gomega.Equal("2\n"))
+			gomega.Expect(mustRun("group", "remove", "2", "2", "3")).Should(gomega.Equal("1\n"))
+
+			err := run("group", "add", "2", "42")
+			gomega.Expect(err).Should(gomega.MatchError(gomega.ContainSubstring("user_ids[0] must be an existing user")))
+			gomega.Expect(errors.Is(run("group", "add", "2"), cli.ErrUsage)).Should(gomega.BeTrue())
+		})
+
+		ginkgo.It("should set the password of a user from a file", func() {
+			ginkgo.GinkgoT().Setenv("PASSWORD_HASH", "bcrypt")
+			ginkgo.GinkgoT().Setenv("BCRYPT_COST", "4")
+			id := strings.TrimSpace(mustRun("user", "create", "--user-name", "johndoe", "--first-name", "John", "--last-name", "Doe", "--email", "johndoe@email.com"))
+
+			file := filepath.Join(dir, "password")
+			gomega.Expect(os.WriteFile(file, []byte("correct horse battery staple\n"), 0o600)).Should(gomega.Succeed())
+			mustRun("user", "set-password", "--password-file", file, id)
+
+			gomega.Expect(os.WriteFile(file, []byte("short\n"), 0o600)).Should(gomega.Succeed())
+			err := run("user", "set-password", "--password-file", file, id)
+			gomega.Expect(err).Should(gomega.MatchError(gomega.ContainSubstring("password must be at least 12 characters")))
+			gomega.Expect(errors.Is(run("user", "set-password", id), cli.ErrUsage)).Should(gomega.BeTrue())
+
+			ginkgo.GinkgoT().Setenv("PASSWORD_HASH", "md5")
+			gomega.Expect(run("user", "set-password", "--password-file", file, id)).Should(gomega.MatchError(gomega.ContainSubstring("unknown PASSWORD_HASH")))
+		})
+
+		ginkgo.It("should reset the second factor of a user", func() {
+			id := strings.TrimSpace(mustRun("user", "create", "--user-name", "johndoe", "--first-name", "John", "--last-name", "Doe", "--email", "johndoe@email.com"))
+
+			gomega.Expect(mustRun("user", "reset-two-factor", id)).Should(gomega.BeEmpty())
+			gomega.Expect(run("user", "reset-two-factor", "4242")).Should(gomega.MatchError(gomega.ContainSubstring("user not found")))
+			gomega.Expect(errors.Is(run("user", "reset-two-factor"), cli.ErrUsage)).Should(gomega.BeTrue())
+		})
+
+		ginkgo.It("should reject unsupported export formats", func() {
+			gomega.Expect(errors.Is(run("export", "--format", "xml"), cli.ErrUsage)).Should(gomega.BeTrue())
+		})
+	})
+})
+
+func TestCLI(t *testing.T) {
+	gomega.RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "CLI Suite")
+}
@@ -0,0 +1,217 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"users-backend/controller"
+	"users-backend/model"
+)
+
+// userJSON is the user printed by user get, with the field names of the API
+type userJSON struct {
+	UserID     int     `json:"user_id"`
+	UserName   string  `json:"user_name"`
+	FirstName  string  `json:"first_name"`
+	LastName   string  `json:"last_name"`
+	Email      string  `json:"email"`
+	UserStatus string  `json:"user_status"`
+	Department *string `json:"department,omitempty"`
+	ManagerID  *int    `json:"manager_id,omitempty"`
+
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// runUser reads and changes single users
+func runUser(ctx context.Context, e env, args []string) error {
+	if len(args) == 0 {
+		return e.usageError("user needs get, create, set-status, set-password or reset-two-factor")
+	}
+
+	switch args[0] {
+	case "get":
+		return runUserGet(ctx, e, args[1:])
+	case "create":
+		return runUserCreate(ctx, e, args[1:])
+	case "set-status":
+		return runUserSetStatus(ctx, e, args[1:])
+	case "set-password":
+		return runUserSetPassword(ctx, e, args[1:])
+	case "reset-two-factor":
+		return runUserResetTwoFactor(ctx, e, args[1:])
+	}
+	return e.usageError("unknown user command %q", args[0])
+}
+
+// parseUserID parses the ID argument of the user commands
+func (e env) parseUserID(s string) (int, error) {
+	id, err := strconv.Atoi(s)
+	if err != nil || id < 1 {
+		return 0, e.usageError("invalid user id %q", s)
+	}
+	return id, nil
+}
+
+func runUserGet(ctx context.Context, e env, args []string) error {
+	fs := e.flagSet("user get")
+	tenantSlug := tenantFlag(fs)
+	if err := e.parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return e.usageError("user get needs a user id")
+	}
+	id, err := e.parseUserID(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	return e.withController(ctx, *tenantSlug, func(ctx context.Context, c controller.UserController) error {
+		user, err := c.GetUser(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		enc := json.NewEncoder(e.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(newUserJSON(user))
+	})
+}
+
+func runUserCreate(ctx context.Context, e env, args []string) error {
+	fs := e.flagSet("user create")
+	tenantSlug := tenantFlag(fs)
+	userName := fs.String("user-name", "", "user name (required)")
+	firstName := fs.String("first-name", "", "first name (required)")
+	lastName := fs.String("last-name", "", "last name (required)")
+	email := fs.String("email", "", "email (required)")
+	status := fs.String("status", model.Active, "status, A, I or T")
+	department := fs.String("department", "", "department")
+	manager := fs.Int("manager", 0, "id of the user's manager")
+	attributes := attributeFlag{}
+	fs.Var(attributes, "attr", "custom attribute as NAME=VALUE, repeat for every attribute")
+	if err := e.parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return e.usageError("user create takes no arguments")
+	}
+
+	return e.withController(ctx, *tenantSlug, func(ctx context.Context, c controller.UserController) error {
+		id, err := c.CreateUser(ctx, *userName, *firstName, *lastName, *email, *status, *department, *manager, model.Attributes(attributes))
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(e.stdout, id)
+		return nil
+	})
+}
+
+func runUserSetStatus(ctx context.Context, e env, args []string) error {
+	fs := e.flagSet("user set-status")
+	tenantSlug := tenantFlag(fs)
+	if err := e.parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return e.usageError("user set-status needs a user id and a status")
+	}
+	id, err := e.parseUserID(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	status := fs.Arg(1)
+
+	return e.withController(ctx, *tenantSlug, func(ctx context.Context, c controller.UserController) error {
+		return c.RunInTx(ctx, func(ctx context.Context) error {
+			user, err := c.GetUser(ctx, id)
+			if err != nil {
+				return err
+			}
+
+			_, err = c.UpdateUser(ctx, id, user.UserName, user.FirstName, user.LastName, user.Email, status, user.Department.String, nil, nil)
+			return err
+		})
+	})
+}
+
+// runUserSetPassword reads the password from a file rather than an argument,
+// which other users of the host could see
+func runUserSetPassword(ctx context.Context, e env, args []string) error {
+	fs := e.flagSet("user set-password")
+	tenantSlug := tenantFlag(fs)
+	passwordFile := fs.String("password-file", "", "file holding the password on its first line (required)")
+	if err := e.parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || *passwordFile == "" {
+		return e.usageError("user set-password needs a user id and --password-file")
+	}
+	id, err := e.parseUserID(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	content, err := os.ReadFile(*passwordFile)
+	if err != nil {
+		return err
+	}
+	password, _, _ := strings.Cut(string(content), "\n")
+	password = strings.TrimSuffix(password, "\r")
+
+	opts, err := authOptions()
+	if err != nil {
+		return err
+	}
+	return e.withTenant(ctx, *tenantSlug, func(ctx context.Context, db database, log *slog.Logger) error {
+		// Setting a password signs no token
+		return controller.NewAuthController(db, db, nil, log, opts...).SetPassword(ctx, id, password)
+	})
+}
+
+// runUserResetTwoFactor lets users who lost their authenticator app log in
+// with their password again
+func runUserResetTwoFactor(ctx context.Context, e env, args []string) error {
+	fs := e.flagSet("user reset-two-factor")
+	tenantSlug := tenantFlag(fs)
+	if err := e.parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return e.usageError("user reset-two-factor needs a user id")
+	}
+	id, err := e.parseUserID(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	return e.withTenant(ctx, *tenantSlug, func(ctx context.Context, db database, log *slog.Logger) error {
+		// Deleting the factor needs neither the encryption key nor tokens
+		return controller.NewAuthController(db, db, nil, log, controller.WithTwoFactor(db, nil, "")).ResetTwoFactor(ctx, id)
+	})
+}
+
+func newUserJSON(u *model.User) userJSON {
+	user := userJSON{
+		UserID:     u.UserID,
+		UserName:   u.UserName,
+		FirstName:  u.FirstName,
+		LastName:   u.LastName,
+		Email:      u.Email,
+		UserStatus: u.UserStatus,
+		Attributes: u.Attributes,
+	}
+	if u.Department.Valid {
+		user.Department = &u.Department.String
+	}
+	if u.ManagerID.Valid {
+		id := int(u.ManagerID.Int64)
+		user.ManagerID = &id
+	}
+	return user
+}
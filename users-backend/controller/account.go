@@ -0,0 +1,251 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+	"users-backend/auth"
+	"users-backend/logging"
+	"users-backend/mail"
+	"users-backend/model"
+	"users-backend/repo"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/text/unicode/norm"
+)
+
+var (
+	// ErrInvalidAccountToken is returned for verification and reset tokens
+	// that are unknown, used, expired or were sent to an email the user no
+	// longer has
+	ErrInvalidAccountToken = errors.New("invalid or expired token")
+	// ErrEmailAlreadyVerified is returned when asking to verify an email
+	// that is verified
+	ErrEmailAlreadyVerified = errors.New("email already verified")
+
+	_ AccountController = new(AccountControllerImpl)
+)
+
+// The pages of the frontend the mailed links open, with the token in the
+// token query parameter
+const (
+	VerifyEmailPath   = "/verify-email"
+	ResetPasswordPath = "/reset-password"
+)
+
+// AccountMailData is what the mail templates are executed with
+type AccountMailData struct {
+	User model.User
+	// Link opens the page of the frontend consuming Token
+	Link      string
+	Token     string
+	ExpiresAt time.Time
+}
+
+type AccountControllerImpl struct {
+	users     repo.UserRepo
+	tokens    repo.UserTokenRepo
+	passwords AuthController
+	mailer    mail.Mailer
+	templates *mail.Templates
+	baseURL   string
+	verifyTTL time.Duration
+	resetTTL  time.Duration
+	now       func() time.Time
+	log       *slog.Logger
+}
+
+// AccountOption configures an AccountControllerImpl
+type AccountOption func(c *AccountControllerImpl)
+
+// WithTemplates replaces the default mail templates
+func WithTemplates(t *mail.Templates) AccountOption {
+	return func(c *AccountControllerImpl) {
+		c.templates = t
+	}
+}
+
+// WithTokenTTL replaces how long verification and reset links are valid,
+// 48 hours and 1 hour by default
+func WithTokenTTL(verify, reset time.Duration) AccountOption {
+	return func(c *AccountControllerImpl) {
+		c.verifyTTL = verify
+		c.resetTTL = reset
+	}
+}
+
+// WithAccountClock replaces time.Now, for tests
+func WithAccountClock(now func() time.Time) AccountOption {
+	return func(c *AccountControllerImpl) {
+		c.now = now
+	}
+}
+
+// NewAccountController mails the links users verify their email and reset
+// their password with through mailer, the links point to the frontend at
+// baseURL. New passwords are set through passwords.
+func NewAccountController(users repo.UserRepo, tokens repo.UserTokenRepo, passwords AuthController, mailer mail.Mailer, baseURL string, log *slog.Logger, opts ...AccountOption) *AccountControllerImpl {
+	c := &AccountControllerImpl{
+		users:     users,
+		tokens:    tokens,
+		passwords: passwords,
+		mailer:    mailer,
+		templates: mail.DefaultTemplates(),
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+		verifyTTL: 48 * time.Hour,
+		resetTTL:  time.Hour,
+		now:       time.Now,
+		log:       log.With("component", "controller"),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *AccountControllerImpl) logger(ctx context.Context) *slog.Logger {
+	return logging.FromContext(ctx, c.log)
+}
+
+// send stores a new token of the purpose for the email of user and mails the
+// link to it with the template
+func (c *AccountControllerImpl) send(ctx context.Context, user *model.User, purpose, template, path string, ttl time.Duration) error {
+	l := c.logger(ctx).With("user_id", user.UserID, "purpose", purpose)
+
+	token, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		l.ErrorContext(ctx, "failed to generate token", "error", err)
+		return err
+	}
+	expiresAt := c.now().Add(ttl)
+	_, err = c.tokens.CreateUserToken(ctx, &model.UserToken{
+		UserID:    user.UserID,
+		Purpose:   purpose,
+		TokenHash: hash,
+		Email:     user.Email,
+		ExpiresAt: expiresAt,
+	})
+	if errors.Is(err, repo.ErrNotFound) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		l.ErrorContext(ctx, "failed to store token", "error", err)
+		return err
+	}
+
+	msg, err := c.templates.Render(template, user.Email, AccountMailData{
+		User:      *user,
+		Link:      c.baseURL + path + "?" + url.Values{"token": {token}}.Encode(),
+		Token:     token,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		l.ErrorContext(ctx, "failed to render mail", "template", template, "error", err)
+		return err
+	}
+	if err := c.mailer.Send(ctx, msg); err != nil {
+		l.ErrorContext(ctx, "failed to send mail", "template", template, "error", err)
+		return err
+	}
+
+	l.InfoContext(ctx, "sent account mail", "template", template, "expires_at", expiresAt)
+	return nil
+}
+
+func (c *AccountControllerImpl) SendEmailVerification(ctx context.Context, user_id int) (err error) {
+	ctx, span := tracer.Start(ctx, "AccountController.SendEmailVerification", trace.WithAttributes(attribute.Int("user.id", user_id)))
+	defer func() { endSpan(span, err) }()
+
+	user, err := c.users.GetById(ctx, user_id)
+	if errors.Is(err, repo.ErrNotFound) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		c.logger(ctx).ErrorContext(ctx, "failed to get user", "user_id", user_id, "error", err)
+		return err
+	}
+	if user.EmailVerified {
+		return ErrEmailAlreadyVerified
+	}
+
+	return c.send(ctx, user, model.TokenVerifyEmail, mail.TemplateVerifyEmail, VerifyEmailPath, c.verifyTTL)
+}
+
+// consume marks the token used and checks it was sent to the email the user
+// still has, verifying it. fn runs in the same transaction, the token stays
+// usable when it fails.
+func (c *AccountControllerImpl) consume(ctx context.Context, purpose, token string, fn func(ctx context.Context, t *model.UserToken) error) error {
+	return c.users.RunInTx(ctx, func(ctx context.Context) error {
+		t, err := c.tokens.ConsumeUserToken(ctx, purpose, auth.HashOpaqueToken(token), c.now())
+		if errors.Is(err, repo.ErrUserTokenNotFound) {
+			c.logger(ctx).InfoContext(ctx, "rejected invalid token", "purpose", purpose)
+			return ErrInvalidAccountToken
+		}
+		if err != nil {
+			c.logger(ctx).ErrorContext(ctx, "failed to consume token", "purpose", purpose, "error", err)
+			return err
+		}
+
+		// Following the link proves the user reads that email
+		verified, err := c.tokens.MarkEmailVerified(ctx, t.UserID, t.Email)
+		if err != nil {
+			c.logger(ctx).ErrorContext(ctx, "failed to verify email", "user_id", t.UserID, "error", err)
+			return err
+		}
+		if !verified {
+			c.logger(ctx).InfoContext(ctx, "rejected token sent to a former email", "user_id", t.UserID, "purpose", purpose)
+			return ErrInvalidAccountToken
+		}
+
+		return fn(ctx, t)
+	})
+}
+
+func (c *AccountControllerImpl) VerifyEmail(ctx context.Context, token string) (err error) {
+	ctx, span := tracer.Start(ctx, "AccountController.VerifyEmail")
+	defer func() { endSpan(span, err) }()
+
+	return c.consume(ctx, model.TokenVerifyEmail, token, func(ctx context.Context, t *model.UserToken) error {
+		c.logger(ctx).InfoContext(ctx, "verified email", "user_id", t.UserID)
+		return nil
+	})
+}
+
+func (c *AccountControllerImpl) RequestPasswordReset(ctx context.Context, userName string) (err error) {
+	ctx, span := tracer.Start(ctx, "AccountController.RequestPasswordReset")
+	defer func() { endSpan(span, err) }()
+
+	user, err := c.users.GetByUsername(ctx, norm.NFKC.String(strings.TrimSpace(userName)))
+	if errors.Is(err, repo.ErrNotFound) {
+		c.logger(ctx).InfoContext(ctx, "ignored password reset of unknown user", "user_name", userName)
+		return nil
+	}
+	if err != nil {
+		c.logger(ctx).ErrorContext(ctx, "failed to get user", "user_name", userName, "error", err)
+		return err
+	}
+	span.SetAttributes(attribute.Int("user.id", user.UserID))
+	if user.UserStatus != model.Active || user.Email == "" {
+		c.logger(ctx).InfoContext(ctx, "ignored password reset of disabled user", "user_id", user.UserID, "user_status", user.UserStatus)
+		return nil
+	}
+
+	return c.send(ctx, user, model.TokenResetPassword, mail.TemplateResetPassword, ResetPasswordPath, c.resetTTL)
+}
+
+func (c *AccountControllerImpl) ResetPassword(ctx context.Context, token, password string) (err error) {
+	ctx, span := tracer.Start(ctx, "AccountController.ResetPassword")
+	defer func() { endSpan(span, err) }()
+
+	return c.consume(ctx, model.TokenResetPassword, token, func(ctx context.Context, t *model.UserToken) error {
+		if err := c.passwords.SetPassword(ctx, t.UserID, password); err != nil {
+			return err
+		}
+		c.logger(ctx).InfoContext(ctx, "reset password", "user_id", t.UserID)
+		return nil
+	})
+}
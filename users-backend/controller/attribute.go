@@ -0,0 +1,399 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+	"users-backend/logging"
+	"users-backend/model"
+	"users-backend/repo"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/text/unicode/norm"
+)
+
+var (
+	ErrAttributeNotFound      = errors.New("attribute not found")
+	ErrAttributeAlreadyExists = errors.New("attribute already exists")
+
+	_ AttributeController = new(AttributeControllerImpl)
+
+	// AttributeNamePattern keeps attribute names usable as JSON keys and query
+	// parameters without escaping
+	AttributeNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,62}$`)
+)
+
+const (
+	attributeValueMaxLength = 255
+	attributeEnumMaxValues  = 100
+	attributeDateLayout     = "2006-01-02"
+)
+
+type AttributeControllerImpl struct {
+	repo repo.AttributeRepo
+	log  *slog.Logger
+}
+
+func NewAttributeController(repo repo.AttributeRepo, log *slog.Logger) *AttributeControllerImpl {
+	return &AttributeControllerImpl{
+		repo: repo,
+		log:  log.With("component", "controller"),
+	}
+}
+
+// WithAttributes lets users carry the custom attributes defined in r, without
+// it every attribute is rejected as unknown
+func WithAttributes(r repo.AttributeRepo) Option {
+	return func(c *UserControllerImpl) {
+		c.attributes = r
+	}
+}
+
+func (c *AttributeControllerImpl) logger(ctx context.Context) *slog.Logger {
+	return logging.FromContext(ctx, c.log)
+}
+
+// attributeError maps the repo errors to the controller ones
+func attributeError(err error) error {
+	switch {
+	case errors.Is(err, repo.ErrAttributeNotFound):
+		return ErrAttributeNotFound
+	case errors.Is(err, repo.ErrDuplicateAttribute):
+		return ErrAttributeAlreadyExists
+	}
+	return err
+}
+
+// validateAttribute normalizes a definition and checks it, returning a
+// *ValidationError listing every rejected field
+func validateAttribute(def *model.AttributeDefinition) error {
+	def.Name = strings.TrimSpace(def.Name)
+	def.Type = model.AttributeType(strings.ToLower(strings.TrimSpace(string(def.Type))))
+
+	var errs []FieldError
+	if !AttributeNamePattern.MatchString(def.Name) {
+		errs = append(errs, FieldError{Field: "name", Rule: "pattern", Message: "must be 1 to 63 lower case letters, digits or '_', starting with a letter"})
+	}
+
+	switch def.Type {
+	case model.AttributeString, model.AttributeNumber, model.AttributeDate:
+		if len(def.EnumValues) > 0 {
+			errs = append(errs, FieldError{Field: "enum_values", Rule: "excluded", Message: "are only allowed for enum attributes"})
+		}
+		def.EnumValues = nil
+	case model.AttributeEnum:
+		errs = append(errs, validateEnumValues(def)...)
+	default:
+		errs = append(errs, FieldError{Field: "type", Rule: "oneof", Message: "must be one of: string, number, date, enum"})
+	}
+
+	if len(errs) > 0 {
+		return &ValidationError{Fields: errs, entity: "attribute"}
+	}
+	return nil
+}
+
+func validateEnumValues(def *model.AttributeDefinition) []FieldError {
+	switch {
+	case len(def.EnumValues) == 0:
+		return []FieldError{{Field: "enum_values", Rule: "required", Message: "are required for enum attributes"}}
+	case len(def.EnumValues) > attributeEnumMaxValues:
+		return []FieldError{{Field: "enum_values", Rule: "max", Message: fmt.Sprintf("must be at most %d values", attributeEnumMaxValues)}}
+	}
+
+	seen := make(map[string]struct{}, len(def.EnumValues))
+	for i, v := range def.EnumValues {
+		v = norm.NFC.String(strings.TrimSpace(v))
+		if v == "" || utf8.RuneCountInString(v) > attributeValueMaxLength || strings.IndexFunc(v, unicode.IsControl) >= 0 {
+			return []FieldError{{Field: "enum_values", Rule: "printable", Message: fmt.Sprintf("must be 1 to %d printable characters", attributeValueMaxLength)}}
+		}
+		if _, ok := seen[v]; ok {
+			return []FieldError{{Field: "enum_values", Rule: "unique", Message: fmt.Sprintf("contain %q more than once", v)}}
+		}
+		seen[v] = struct{}{}
+		def.EnumValues[i] = v
+	}
+	return nil
+}
+
+func (c *AttributeControllerImpl) CreateAttribute(ctx context.Context, name string, attrType model.AttributeType, required, unique bool, enumValues []string) (_ int, err error) {
+	ctx, span := tracer.Start(ctx, "AttributeController.CreateAttribute", trace.WithAttributes(attribute.String("attribute.name", name)))
+	defer func() { endSpan(span, err) }()
+
+	def := &model.AttributeDefinition{
+		Name:       name,
+		Type:       attrType,
+		Required:   required,
+		Unique:     unique,
+		EnumValues: append([]string(nil), enumValues...),
+	}
+	if err = validateAttribute(def); err != nil {
+		c.logger(ctx).InfoContext(ctx, "rejected invalid attribute", "attribute_name", name, "error", err)
+		return -1, err
+	}
+
+	attributeID, err := c.repo.CreateAttribute(ctx, def)
+	if err != nil {
+		c.logger(ctx).InfoContext(ctx, "failed to create attribute", "attribute_name", def.Name, "error", err)
+		return -1, attributeError(err)
+	}
+
+	c.logger(ctx).InfoContext(ctx, "created attribute", "attribute_id", attributeID, "attribute_name", def.Name)
+	return attributeID, nil
+}
+
+func (c *AttributeControllerImpl) GetAttribute(ctx context.Context, attribute_id int) (_ *model.AttributeDefinition, err error) {
+	ctx, span := tracer.Start(ctx, "AttributeController.GetAttribute", trace.WithAttributes(attribute.Int("attribute.id", attribute_id)))
+	defer func() { endSpan(span, err) }()
+
+	def, err := c.repo.GetAttribute(ctx, attribute_id)
+	if err != nil {
+		return nil, attributeError(err)
+	}
+	return def, nil
+}
+
+func (c *AttributeControllerImpl) GetAttributes(ctx context.Context) (_ *[]model.AttributeDefinition, err error) {
+	ctx, span := tracer.Start(ctx, "AttributeController.GetAttributes")
+	defer func() { endSpan(span, err) }()
+
+	defs, err := c.repo.GetAttributes(ctx)
+	if err != nil {
+		c.logger(ctx).ErrorContext(ctx, "failed to get attributes", "error", err)
+		return nil, err
+	}
+	return defs, nil
+}
+
+func (c *AttributeControllerImpl) DeleteAttribute(ctx context.Context, attribute_id int) (err error) {
+	ctx, span := tracer.Start(ctx, "AttributeController.DeleteAttribute", trace.WithAttributes(attribute.Int("attribute.id", attribute_id)))
+	defer func() { endSpan(span, err) }()
+
+	if err = c.repo.DeleteAttribute(ctx, attribute_id); err != nil {
+		c.logger(ctx).ErrorContext(ctx, "failed to delete attribute", "attribute_id", attribute_id, "error", err)
+		return err
+	}
+
+	c.logger(ctx).InfoContext(ctx, "deleted attribute", "attribute_id", attribute_id)
+	return nil
+}
+
+// definitions returns the attribute definitions of the tenant of ctx by name
+func (c *UserControllerImpl) definitions(ctx context.Context) (map[string]model.AttributeDefinition, error) {
+	if c.attributes == nil {
+		return nil, nil
+	}
+
+	defs, err := c.attributes.GetAttributes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]model.AttributeDefinition, len(*defs))
+	for _, def := range *defs {
+		m[def.Name] = def
+	}
+	return m, nil
+}
+
+// attributeField is the field name attribute errors are reported under
+func attributeField(name string) string {
+	return "attributes." + name
+}
+
+// checkAttributes normalizes the attributes of the user user_id, 0 for a new
+// user, against the definitions of its tenant. Empty values are dropped and
+// nil attributes are kept as is on update. Unique values are checked by
+// checkUniqueAttributes in the transaction writing them.
+func (c *UserControllerImpl) checkAttributes(ctx context.Context, user_id int, attributes model.Attributes) (model.Attributes, []FieldError, error) {
+	if attributes == nil && user_id != 0 {
+		return nil, nil, nil
+	}
+
+	defs, err := c.definitions(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		errs []FieldError
+		m    = model.Attributes{}
+	)
+	for _, name := range sortedKeys(attributes) {
+		def, ok := defs[name]
+		if !ok {
+			errs = append(errs, FieldError{Field: attributeField(name), Rule: "unknown", Message: "is not a defined attribute"})
+			continue
+		}
+
+		v, ferr := parseAttributeValue(def, attributes[name])
+		if ferr != nil {
+			errs = append(errs, *ferr)
+		} else if v != nil {
+			m[name] = v
+		}
+	}
+
+	for _, name := range sortedKeys(defs) {
+		if _, ok := m[name]; !ok && defs[name].Required && !hasFieldError(errs, attributeField(name)) {
+			errs = append(errs, FieldError{Field: attributeField(name), Rule: "required", Message: "is required"})
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs, nil
+	}
+
+	if len(m) == 0 {
+		// an empty non nil map clears the attributes on update
+		if user_id != 0 {
+			return model.Attributes{}, nil, nil
+		}
+		return nil, nil, nil
+	}
+	return m, nil, nil
+}
+
+// checkUniqueAttributes rejects the values of unique attributes already taken
+// by another user than user_id. Each unique attribute is locked first, in
+// name order, so the value stays free until the transaction of ctx ends.
+func (c *UserControllerImpl) checkUniqueAttributes(ctx context.Context, user_id int, attributes model.Attributes) ([]FieldError, error) {
+	if len(attributes) == 0 {
+		return nil, nil
+	}
+
+	defs, err := c.definitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []FieldError
+	for _, name := range sortedKeys(attributes) {
+		if !defs[name].Unique {
+			continue
+		}
+		if err := c.repo.LockAttribute(ctx, name); err != nil {
+			return nil, err
+		}
+
+		users, err := c.repo.FindByAttributes(ctx, model.Attributes{name: attributes[name]})
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range *users {
+			if u.UserID != user_id {
+				errs = append(errs, FieldError{Field: attributeField(name), Rule: "unique", Message: "is already taken"})
+				break
+			}
+		}
+	}
+	return errs, nil
+}
+
+// parseAttributeValue checks value against def, returning the value to store
+// or nil for an empty value
+func parseAttributeValue(def model.AttributeDefinition, value interface{}) (interface{}, *FieldError) {
+	fail := func(rule, format string, args ...interface{}) (interface{}, *FieldError) {
+		return nil, &FieldError{Field: attributeField(def.Name), Rule: rule, Message: fmt.Sprintf(format, args...)}
+	}
+
+	if value == nil {
+		return nil, nil
+	}
+
+	if def.Type == model.AttributeNumber {
+		var f float64
+		switch v := value.(type) {
+		case float64:
+			f = v
+		case int:
+			f = float64(v)
+		case string:
+			if strings.TrimSpace(v) == "" {
+				return nil, nil
+			}
+			var err error
+			if f, err = strconv.ParseFloat(strings.TrimSpace(v), 64); err != nil {
+				return fail("type", "must be a number")
+			}
+		default:
+			return fail("type", "must be a number")
+		}
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return fail("type", "must be a finite number")
+		}
+		return f, nil
+	}
+
+	s, ok := value.(string)
+	if !ok {
+		return fail("type", "must be a string")
+	}
+	s = norm.NFC.String(strings.TrimSpace(s))
+	if s == "" {
+		return nil, nil
+	}
+
+	switch def.Type {
+	case model.AttributeDate:
+		if _, err := time.Parse(attributeDateLayout, s); err != nil {
+			return fail("date", "must be a date formatted as YYYY-MM-DD")
+		}
+	case model.AttributeEnum:
+		for _, v := range def.EnumValues {
+			if v == s {
+				return s, nil
+			}
+		}
+		return fail("enum", "must be one of: %s", strings.Join(def.EnumValues, ", "))
+	default:
+		if utf8.RuneCountInString(s) > attributeValueMaxLength {
+			return fail("max", "must be at most %d characters", attributeValueMaxLength)
+		}
+		if strings.IndexFunc(s, unicode.IsControl) >= 0 {
+			return fail("printable", "must not contain control characters")
+		}
+	}
+	return s, nil
+}
+
+// withFieldErrors adds fields to the *ValidationError err, err may be nil
+func withFieldErrors(err error, fields []FieldError) error {
+	if len(fields) == 0 {
+		return err
+	}
+
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		verr.Fields = append(verr.Fields, fields...)
+		return verr
+	}
+	return &ValidationError{Fields: fields}
+}
+
+func hasFieldError(errs []FieldError, field string) bool {
+	for _, e := range errs {
+		if e.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
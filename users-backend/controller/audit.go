@@ -0,0 +1,54 @@
+package controller
+
+import (
+	"context"
+	"log/slog"
+	"users-backend/logging"
+	"users-backend/model"
+)
+
+var _ UserController = new(auditController)
+
+// auditController writes an audit record for every mutation with its outcome
+type auditController struct {
+	UserController
+	log *slog.Logger
+}
+
+// WithAudit records every create, update and delete to log under the "audit"
+// component
+func WithAudit(log *slog.Logger) Decorator {
+	return func(next UserController) UserController {
+		return &auditController{
+			UserController: next,
+			log:            log.With("component", "audit"),
+		}
+	}
+}
+
+func (a *auditController) record(ctx context.Context, action string, err error, args ...any) {
+	args = append(args, "action", action, "success", err == nil)
+	if err != nil {
+		args = append(args, "error", err)
+	}
+
+	logging.FromContext(ctx, a.log).InfoContext(ctx, "audit", args...)
+}
+
+func (a *auditController) CreateUser(ctx context.Context, userName, firstName, lastName, email, userStatus, department string, managerID int, attributes model.Attributes) (int, error) {
+	userID, err := a.UserController.CreateUser(ctx, userName, firstName, lastName, email, userStatus, department, managerID, attributes)
+	a.record(ctx, "create_user", err, "user_id", userID, "user_name", userName)
+	return userID, err
+}
+
+func (a *auditController) UpdateUser(ctx context.Context, user_id int, userName, firstName, lastName, email, userStatus, department string, managerID *int, attributes model.Attributes) (int, error) {
+	userID, err := a.UserController.UpdateUser(ctx, user_id, userName, firstName, lastName, email, userStatus, department, managerID, attributes)
+	a.record(ctx, "update_user", err, "user_id", user_id, "user_name", userName)
+	return userID, err
+}
+
+func (a *auditController) DeleteUser(ctx context.Context, user_id int) error {
+	err := a.UserController.DeleteUser(ctx, user_id)
+	a.record(ctx, "delete_user", err, "user_id", user_id)
+	return err
+}
@@ -0,0 +1,480 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+	"users-backend/auth"
+	"users-backend/logging"
+	"users-backend/model"
+	"users-backend/repo"
+	"users-backend/tenant"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/text/unicode/norm"
+)
+
+var (
+	// ErrInvalidCredentials is returned for unknown users, users without
+	// password and wrong passwords alike
+	ErrInvalidCredentials = errors.New("invalid user name or password")
+	// ErrAccountLocked is wrapped by the *LockedError returned while an
+	// account is locked after too many failed logins
+	ErrAccountLocked = errors.New("account locked")
+	// ErrAccountDisabled is returned for the right password of a user that
+	// is not active
+	ErrAccountDisabled = errors.New("account disabled")
+	ErrUserNotFound    = errors.New("user not found")
+
+	_ AuthController = new(AuthControllerImpl)
+)
+
+// LockedError is returned by Login while the account is locked
+type LockedError struct {
+	Until time.Time
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("account locked until %s", e.Until.UTC().Format(time.RFC3339))
+}
+
+func (e *LockedError) Unwrap() error {
+	return ErrAccountLocked
+}
+
+// PasswordPolicy holds the rules passwords are checked against when set.
+// MinLength is counted in characters and MaxLength in bytes, it must not be
+// above 72 with bcrypt which ignores the bytes past the 72nd.
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	// MinClasses is how many of lower case letters, upper case letters,
+	// digits and other characters a password mixes at least
+	MinClasses int
+}
+
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength: 12,
+		MaxLength: 72,
+	}
+}
+
+// LockoutPolicy locks an account for Duration after MaxFailures failed logins
+// in a row, a MaxFailures of 0 never locks
+type LockoutPolicy struct {
+	MaxFailures int
+	Duration    time.Duration
+}
+
+func DefaultLockoutPolicy() LockoutPolicy {
+	return LockoutPolicy{
+		MaxFailures: 5,
+		Duration:    15 * time.Minute,
+	}
+}
+
+type AuthControllerImpl struct {
+	users       repo.UserRepo
+	credentials repo.CredentialRepo
+	hasher      *auth.Hasher
+	tokens      *auth.TokenSigner
+	factors     repo.TwoFactorRepo
+	secrets     *auth.SecretBox
+	issuer      string
+	clients     repo.ClientRepo
+	codes       repo.AuthorizationCodeRepo
+	oidc        *auth.OIDCSigner
+	policy      PasswordPolicy
+	lockout     LockoutPolicy
+	now         func() time.Time
+	log         *slog.Logger
+
+	// dummyHash is verified for unknown users so that they take as long to
+	// reject as wrong passwords
+	dummyHash     string
+	dummyHashOnce sync.Once
+}
+
+// AuthOption configures an AuthControllerImpl
+type AuthOption func(c *AuthControllerImpl)
+
+// WithHasher replaces the default argon2id hasher
+func WithHasher(h *auth.Hasher) AuthOption {
+	return func(c *AuthControllerImpl) {
+		c.hasher = h
+	}
+}
+
+// WithPasswordPolicy replaces the default password rules
+func WithPasswordPolicy(p PasswordPolicy) AuthOption {
+	return func(c *AuthControllerImpl) {
+		c.policy = p
+	}
+}
+
+// WithLockout replaces the default lockout after failed logins
+func WithLockout(l LockoutPolicy) AuthOption {
+	return func(c *AuthControllerImpl) {
+		c.lockout = l
+	}
+}
+
+// WithClock replaces time.Now, for tests
+func WithClock(now func() time.Time) AuthOption {
+	return func(c *AuthControllerImpl) {
+		c.now = now
+	}
+}
+
+// NewAuthController checks the passwords stored in credentials for the users
+// stored in users and signs the login tokens with tokens
+func NewAuthController(users repo.UserRepo, credentials repo.CredentialRepo, tokens *auth.TokenSigner, log *slog.Logger, opts ...AuthOption) *AuthControllerImpl {
+	c := &AuthControllerImpl{
+		users:       users,
+		credentials: credentials,
+		hasher:      auth.NewArgon2idHasher(auth.DefaultArgon2Params),
+		tokens:      tokens,
+		policy:      DefaultPasswordPolicy(),
+		lockout:     DefaultLockoutPolicy(),
+		issuer:      DefaultTwoFactorIssuer,
+		now:         time.Now,
+		log:         log.With("component", "controller"),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *AuthControllerImpl) logger(ctx context.Context) *slog.Logger {
+	return logging.FromContext(ctx, c.log)
+}
+
+// normalizePassword puts passwords in NFKC so the same password typed on
+// different keyboards hashes the same
+func normalizePassword(password string) string {
+	return norm.NFKC.String(password)
+}
+
+// checkPassword returns the rules of the policy password breaks, it must not
+// contain the user name or the local part of the email of user either
+func (p PasswordPolicy) checkPassword(password string, user *model.User) []FieldError {
+	var errs []FieldError
+	add := func(rule, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Field: "password", Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch {
+	case utf8.RuneCountInString(password) < p.MinLength:
+		add("min", "must be at least %d characters", p.MinLength)
+	case p.MaxLength > 0 && len(password) > p.MaxLength:
+		add("max", "must be at most %d bytes", p.MaxLength)
+	case passwordClasses(password) < p.MinClasses:
+		add("classes", "must mix at least %d of lower case letters, upper case letters, digits and symbols", p.MinClasses)
+	}
+
+	lower := strings.ToLower(password)
+	local, _, _ := strings.Cut(user.Email, "@")
+	for _, personal := range []string{user.UserName, local} {
+		if utf8.RuneCountInString(personal) >= 3 && strings.Contains(lower, strings.ToLower(personal)) {
+			add("personal", "must not contain the user name or email")
+			break
+		}
+	}
+	return errs
+}
+
+// passwordClasses counts the kinds of characters password mixes
+func passwordClasses(password string) int {
+	var lower, upper, digit, other int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			other = 1
+		}
+	}
+	return lower + upper + digit + other
+}
+
+// rejectSlowly verifies password against a throwaway hash, so rejecting an
+// unknown user takes as long as a wrong password
+func (c *AuthControllerImpl) rejectSlowly(ctx context.Context, password string) {
+	c.dummyHashOnce.Do(func() {
+		var err error
+		if c.dummyHash, err = c.hasher.Hash("not a password"); err != nil {
+			c.logger(ctx).ErrorContext(ctx, "failed to hash the dummy password", "error", err)
+		}
+	})
+	if c.dummyHash != "" {
+		_, _ = c.hasher.Verify(c.dummyHash, password)
+	}
+}
+
+func (c *AuthControllerImpl) Login(ctx context.Context, userName, password, code string) (_ *auth.Token, err error) {
+	ctx, span := tracer.Start(ctx, "AuthController.Login")
+	defer func() { endSpan(span, err) }()
+
+	now := c.now()
+	user, l, err := c.authenticate(ctx, userName, password, code, now)
+	if err != nil {
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("user.id", user.UserID))
+
+	token, err := c.tokens.Sign(user.UserID, user.TenantID, user.UserName, now)
+	if err != nil {
+		l.ErrorContext(ctx, "failed to sign token", "error", err)
+		return nil, err
+	}
+
+	l.InfoContext(ctx, "user logged in")
+	return token, nil
+}
+
+// authenticate returns the user when the password and the second factor code
+// are right, the account is not locked and the user is active, along with a
+// logger for the user. Successful logins clear the failed ones.
+func (c *AuthControllerImpl) authenticate(ctx context.Context, userName, password, code string, now time.Time) (*model.User, *slog.Logger, error) {
+	password = normalizePassword(password)
+	user, err := c.users.GetByUsername(ctx, norm.NFKC.String(strings.TrimSpace(userName)))
+	if errors.Is(err, repo.ErrNotFound) {
+		c.rejectSlowly(ctx, password)
+		c.logger(ctx).InfoContext(ctx, "rejected login of unknown user", "user_name", userName)
+		return nil, nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		c.logger(ctx).ErrorContext(ctx, "failed to get user", "user_name", userName, "error", err)
+		return nil, nil, err
+	}
+
+	l := c.logger(ctx).With("user_id", user.UserID)
+	cred, err := c.credentials.GetCredential(ctx, user.UserID)
+	if errors.Is(err, repo.ErrCredentialNotFound) {
+		c.rejectSlowly(ctx, password)
+		l.InfoContext(ctx, "rejected login of user without password")
+		return nil, nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		l.ErrorContext(ctx, "failed to get credential", "error", err)
+		return nil, nil, err
+	}
+
+	if cred.LockedUntil.After(now) {
+		l.InfoContext(ctx, "rejected login of locked user", "locked_until", cred.LockedUntil)
+		return nil, nil, &LockedError{Until: cred.LockedUntil}
+	}
+
+	ok, err := c.hasher.Verify(cred.PasswordHash, password)
+	if err != nil {
+		l.ErrorContext(ctx, "failed to verify password", "error", err)
+		return nil, nil, err
+	}
+	if !ok {
+		return nil, nil, c.recordFailure(ctx, l, user.UserID, now, ErrInvalidCredentials)
+	}
+
+	// Only the right password tells whether the account is disabled
+	if user.UserStatus != model.Active {
+		l.InfoContext(ctx, "rejected login of disabled user", "user_status", user.UserStatus)
+		return nil, nil, ErrAccountDisabled
+	}
+	if err := c.checkSecondFactor(ctx, l, user.UserID, code, now); err != nil {
+		return nil, nil, err
+	}
+
+	if cred.FailedAttempts > 0 || !cred.LockedUntil.IsZero() {
+		if err := c.credentials.RecordLoginSuccess(ctx, user.UserID); err != nil {
+			l.ErrorContext(ctx, "failed to clear failed logins", "error", err)
+			return nil, nil, err
+		}
+	}
+	c.rehash(ctx, l, user.UserID, cred.PasswordHash, password)
+	return user, l, nil
+}
+
+func (c *AuthControllerImpl) Authenticate(ctx context.Context, token string) (_ int, err error) {
+	ctx, span := tracer.Start(ctx, "AuthController.Authenticate")
+	defer func() { endSpan(span, err) }()
+
+	if c.tokens == nil {
+		return 0, fmt.Errorf("%w: login is disabled", auth.ErrInvalidToken)
+	}
+	claims, err := c.tokens.Verify(token)
+	if err != nil {
+		c.logger(ctx).InfoContext(ctx, "rejected token", "error", err)
+		return 0, err
+	}
+	if tenant_id, ok := tenant.ID(ctx); !ok || tenant_id != claims.TenantID {
+		c.logger(ctx).InfoContext(ctx, "rejected token of another tenant", "token_tenant_id", claims.TenantID)
+		return 0, fmt.Errorf("%w: issued for tenant %d", auth.ErrInvalidToken, claims.TenantID)
+	}
+
+	user_id, _ := claims.UserID()
+	span.SetAttributes(attribute.Int("user.id", user_id))
+	user, err := c.users.GetById(ctx, user_id)
+	if errors.Is(err, repo.ErrNotFound) {
+		return 0, fmt.Errorf("%w: user %d does not exist", auth.ErrInvalidToken, user_id)
+	}
+	if err != nil {
+		c.logger(ctx).ErrorContext(ctx, "failed to get user", "user_id", user_id, "error", err)
+		return 0, err
+	}
+	// Tokens outlive the status of their user, disabling a user must lock
+	// it out right away
+	if user.UserStatus != model.Active {
+		return 0, fmt.Errorf("%w: user %d is not active", auth.ErrInvalidToken, user_id)
+	}
+	return user_id, nil
+}
+
+func (c *AuthControllerImpl) VerifyToken(token string) (int, int, error) {
+	if c.tokens == nil {
+		return 0, 0, fmt.Errorf("%w: login is disabled", auth.ErrInvalidToken)
+	}
+	claims, err := c.tokens.Verify(token)
+	if err != nil {
+		return 0, 0, err
+	}
+	user_id, _ := claims.UserID()
+	return claims.TenantID, user_id, nil
+}
+
+// recordFailure counts a wrong password or second factor code and locks the
+// account once the lockout policy is reached, returning rejected until then
+func (c *AuthControllerImpl) recordFailure(ctx context.Context, l *slog.Logger, user_id int, now time.Time, rejected error) error {
+	failures, err := c.credentials.RecordLoginFailure(ctx, user_id)
+	if err != nil {
+		l.ErrorContext(ctx, "failed to record failed login", "error", err)
+		return err
+	}
+
+	if c.lockout.MaxFailures <= 0 || failures < c.lockout.MaxFailures {
+		l.InfoContext(ctx, "rejected login", "error", rejected, "failed_attempts", failures)
+		return rejected
+	}
+
+	until := now.Add(c.lockout.Duration)
+	if err := c.credentials.LockCredential(ctx, user_id, until); err != nil {
+		l.ErrorContext(ctx, "failed to lock account", "error", err)
+		return err
+	}
+	l.WarnContext(ctx, "locked account after failed logins", "failed_attempts", failures, "locked_until", until)
+	return &LockedError{Until: until}
+}
+
+// rehash stores the password again when its hash was made with another
+// algorithm or other costs, a failure only delays it to the next login
+func (c *AuthControllerImpl) rehash(ctx context.Context, l *slog.Logger, user_id int, hash, password string) {
+	if !c.hasher.NeedsRehash(hash) {
+		return
+	}
+
+	newHash, err := c.hasher.Hash(password)
+	if err == nil {
+		err = c.credentials.SetPassword(ctx, user_id, newHash)
+	}
+	if err != nil {
+		l.WarnContext(ctx, "failed to rehash password", "error", err)
+		return
+	}
+	l.InfoContext(ctx, "rehashed password", "algorithm", c.hasher.Algorithm())
+}
+
+func (c *AuthControllerImpl) SetPassword(ctx context.Context, user_id int, password string) (err error) {
+	ctx, span := tracer.Start(ctx, "AuthController.SetPassword", trace.WithAttributes(attribute.Int("user.id", user_id)))
+	defer func() { endSpan(span, err) }()
+
+	user, err := c.users.GetById(ctx, user_id)
+	if errors.Is(err, repo.ErrNotFound) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		c.logger(ctx).ErrorContext(ctx, "failed to get user", "user_id", user_id, "error", err)
+		return err
+	}
+
+	password = normalizePassword(password)
+	if errs := c.policy.checkPassword(password, user); len(errs) > 0 {
+		err = &ValidationError{Fields: errs, entity: "password"}
+		c.logger(ctx).InfoContext(ctx, "rejected invalid password", "user_id", user_id, "error", err)
+		return err
+	}
+
+	hash, err := c.hasher.Hash(password)
+	if err != nil {
+		c.logger(ctx).ErrorContext(ctx, "failed to hash password", "user_id", user_id, "error", err)
+		return err
+	}
+	if err = c.credentials.SetPassword(ctx, user_id, hash); err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			return ErrUserNotFound
+		}
+		c.logger(ctx).ErrorContext(ctx, "failed to set password", "user_id", user_id, "error", err)
+		return err
+	}
+
+	c.logger(ctx).InfoContext(ctx, "set password", "user_id", user_id, "algorithm", c.hasher.Algorithm())
+	return nil
+}
+
+func (c *AuthControllerImpl) ChangePassword(ctx context.Context, user_id int, current, password string) (err error) {
+	ctx, span := tracer.Start(ctx, "AuthController.ChangePassword", trace.WithAttributes(attribute.Int("user.id", user_id)))
+	defer func() { endSpan(span, err) }()
+
+	now := c.now()
+	l := c.logger(ctx).With("user_id", user_id)
+	current = normalizePassword(current)
+	cred, err := c.credentials.GetCredential(ctx, user_id)
+	if errors.Is(err, repo.ErrCredentialNotFound) {
+		c.rejectSlowly(ctx, current)
+		l.InfoContext(ctx, "rejected password change of user without password")
+		return ErrInvalidCredentials
+	}
+	if err != nil {
+		l.ErrorContext(ctx, "failed to get credential", "error", err)
+		return err
+	}
+
+	// A stolen login token must not give unlimited guesses at the password
+	if cred.LockedUntil.After(now) {
+		l.InfoContext(ctx, "rejected password change of locked user", "locked_until", cred.LockedUntil)
+		return &LockedError{Until: cred.LockedUntil}
+	}
+	ok, err := c.hasher.Verify(cred.PasswordHash, current)
+	if err != nil {
+		l.ErrorContext(ctx, "failed to verify password", "error", err)
+		return err
+	}
+	if !ok {
+		return c.recordFailure(ctx, l, user_id, now, ErrInvalidCredentials)
+	}
+
+	return c.SetPassword(ctx, user_id, password)
+}
+
+func (c *AuthControllerImpl) DeletePassword(ctx context.Context, user_id int) (err error) {
+	ctx, span := tracer.Start(ctx, "AuthController.DeletePassword", trace.WithAttributes(attribute.Int("user.id", user_id)))
+	defer func() { endSpan(span, err) }()
+
+	if err = c.credentials.DeleteCredential(ctx, user_id); err != nil {
+		c.logger(ctx).ErrorContext(ctx, "failed to delete password", "user_id", user_id, "error", err)
+		return err
+	}
+
+	c.logger(ctx).InfoContext(ctx, "deleted password", "user_id", user_id)
+	return nil
+}
@@ -0,0 +1,17 @@
+package controller
+
+// Decorator wraps a UserController to layer cross-cutting behaviour (caching,
+// authorization, auditing...) on top of it without touching business logic.
+// Decorators can embed the UserController they wrap and only override the
+// methods they care about.
+type Decorator func(next UserController) UserController
+
+// Chain wraps c with the decorators in order, the first decorator is the
+// outermost one and sees every call first
+func Chain(c UserController, decorators ...Decorator) UserController {
+	for i := len(decorators) - 1; i >= 0; i-- {
+		c = decorators[i](c)
+	}
+
+	return c
+}
@@ -0,0 +1,348 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+	"users-backend/logging"
+	"users-backend/model"
+	"users-backend/repo"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/text/unicode/norm"
+)
+
+var (
+	ErrGroupNotFound      = errors.New("group not found")
+	ErrGroupAlreadyExists = errors.New("group already exists")
+
+	_ GroupController = new(GroupControllerImpl)
+)
+
+const (
+	groupNameMaxLength        = 255
+	groupDescriptionMaxLength = 1000
+	// groupMembersMaxPerRequest bounds the users added or removed at once,
+	// each of them is looked up before being added
+	groupMembersMaxPerRequest = 100
+)
+
+type GroupControllerImpl struct {
+	repo  repo.GroupRepo
+	users repo.UserRepo
+	log   *slog.Logger
+}
+
+// NewGroupController manages the groups stored in groups, users is where the
+// members are looked up
+func NewGroupController(groups repo.GroupRepo, users repo.UserRepo, log *slog.Logger) *GroupControllerImpl {
+	return &GroupControllerImpl{
+		repo:  groups,
+		users: users,
+		log:   log.With("component", "controller"),
+	}
+}
+
+func (c *GroupControllerImpl) logger(ctx context.Context) *slog.Logger {
+	return logging.FromContext(ctx, c.log)
+}
+
+// groupError maps the repo errors to the controller ones
+func groupError(err error) error {
+	switch {
+	case errors.Is(err, repo.ErrGroupNotFound):
+		return ErrGroupNotFound
+	case errors.Is(err, repo.ErrDuplicateGroupName):
+		return ErrGroupAlreadyExists
+	}
+	return err
+}
+
+// validateGroup normalizes the name and description of a group and checks
+// them, returning the rejected fields
+func validateGroup(g *model.Group) []FieldError {
+	g.Name = norm.NFC.String(strings.TrimSpace(g.Name))
+	g.Description = norm.NFC.String(strings.TrimSpace(g.Description))
+
+	var errs []FieldError
+	switch {
+	case g.Name == "":
+		errs = append(errs, FieldError{Field: "name", Rule: "required", Message: "is required"})
+	case utf8.RuneCountInString(g.Name) > groupNameMaxLength:
+		errs = append(errs, FieldError{Field: "name", Rule: "max", Message: fmt.Sprintf("must be at most %d characters", groupNameMaxLength)})
+	case strings.IndexFunc(g.Name, unicode.IsControl) >= 0:
+		errs = append(errs, FieldError{Field: "name", Rule: "printable", Message: "must not contain control characters"})
+	}
+	if utf8.RuneCountInString(g.Description) > groupDescriptionMaxLength {
+		errs = append(errs, FieldError{Field: "description", Rule: "max", Message: fmt.Sprintf("must be at most %d characters", groupDescriptionMaxLength)})
+	}
+	return errs
+}
+
+// checkParent validates the parent given to group_id, 0 for a new group. The
+// parent must be a group of the tenant that is not nested in group_id
+// already, which would close a cycle.
+func (c *GroupControllerImpl) checkParent(ctx context.Context, group_id, parentID int) ([]FieldError, error) {
+	if parentID == 0 {
+		return nil, nil
+	}
+	if parentID == group_id {
+		return []FieldError{{Field: "parent_id", Rule: "cycle", Message: "can not be the group itself"}}, nil
+	}
+
+	if _, err := c.repo.GetGroup(ctx, parentID); errors.Is(err, repo.ErrGroupNotFound) {
+		return []FieldError{{Field: "parent_id", Rule: "exists", Message: "must be an existing group"}}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if group_id == 0 {
+		return nil, nil
+	}
+
+	ancestors, err := c.repo.GetGroupAncestors(ctx, parentID)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range *ancestors {
+		if g.GroupID == group_id {
+			return []FieldError{{Field: "parent_id", Rule: "cycle", Message: "must not be nested in the group"}}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// validate checks a group to be created or updated, returning a
+// *ValidationError listing every rejected field
+func (c *GroupControllerImpl) validate(ctx context.Context, g *model.Group) error {
+	errs := validateGroup(g)
+	parentErrs, err := c.checkParent(ctx, g.GroupID, int(g.ParentID.Int64))
+	if err != nil {
+		return err
+	}
+
+	if errs = append(errs, parentErrs...); len(errs) > 0 {
+		return &ValidationError{Fields: errs, entity: "group"}
+	}
+	return nil
+}
+
+func (c *GroupControllerImpl) CreateGroup(ctx context.Context, name, description string, parentID int) (_ int, err error) {
+	ctx, span := tracer.Start(ctx, "GroupController.CreateGroup", trace.WithAttributes(attribute.String("group.name", name)))
+	defer func() { endSpan(span, err) }()
+
+	g := &model.Group{Name: name, Description: description, ParentID: nullID(parentID)}
+	if err = c.validate(ctx, g); err != nil {
+		c.logger(ctx).InfoContext(ctx, "rejected invalid group", "group_name", name, "error", err)
+		return -1, err
+	}
+
+	groupID, err := c.repo.CreateGroup(ctx, g)
+	if err != nil {
+		c.logger(ctx).InfoContext(ctx, "failed to create group", "group_name", g.Name, "error", err)
+		return -1, groupError(err)
+	}
+
+	c.logger(ctx).InfoContext(ctx, "created group", "group_id", groupID, "group_name", g.Name)
+	return groupID, nil
+}
+
+func (c *GroupControllerImpl) GetGroup(ctx context.Context, group_id int) (_ *model.Group, err error) {
+	ctx, span := tracer.Start(ctx, "GroupController.GetGroup", trace.WithAttributes(attribute.Int("group.id", group_id)))
+	defer func() { endSpan(span, err) }()
+
+	g, err := c.repo.GetGroup(ctx, group_id)
+	if err != nil {
+		return nil, groupError(err)
+	}
+	return g, nil
+}
+
+func (c *GroupControllerImpl) GetGroups(ctx context.Context) (_ *[]model.Group, err error) {
+	ctx, span := tracer.Start(ctx, "GroupController.GetGroups")
+	defer func() { endSpan(span, err) }()
+
+	groups, err := c.repo.GetGroups(ctx)
+	if err != nil {
+		c.logger(ctx).ErrorContext(ctx, "failed to get groups", "error", err)
+		return nil, err
+	}
+	return groups, nil
+}
+
+func (c *GroupControllerImpl) UpdateGroup(ctx context.Context, group_id int, name, description string, parentID int) (_ int, err error) {
+	ctx, span := tracer.Start(ctx, "GroupController.UpdateGroup", trace.WithAttributes(attribute.Int("group.id", group_id), attribute.String("group.name", name)))
+	defer func() { endSpan(span, err) }()
+
+	// The parent is checked and written under the hierarchy lock so that two
+	// updates can not each pass the cycle check and nest the groups in each
+	// other
+	g := &model.Group{GroupID: group_id, Name: name, Description: description, ParentID: nullID(parentID)}
+	err = c.repo.RunInTx(ctx, func(ctx context.Context) error {
+		if parentID != 0 {
+			if err := c.repo.LockGroupHierarchy(ctx); err != nil {
+				return err
+			}
+		}
+		if err := c.validate(ctx, g); err != nil {
+			return err
+		}
+		_, err := c.repo.UpdateGroup(ctx, g)
+		return err
+	})
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		c.logger(ctx).InfoContext(ctx, "rejected invalid group", "group_id", group_id, "error", err)
+		return -1, err
+	}
+	if err != nil {
+		c.logger(ctx).InfoContext(ctx, "failed to update group", "group_id", group_id, "error", err)
+		return -1, groupError(err)
+	}
+
+	c.logger(ctx).InfoContext(ctx, "updated group", "group_id", group_id, "group_name", g.Name)
+	return group_id, nil
+}
+
+func (c *GroupControllerImpl) DeleteGroup(ctx context.Context, group_id int) (err error) {
+	ctx, span := tracer.Start(ctx, "GroupController.DeleteGroup", trace.WithAttributes(attribute.Int("group.id", group_id)))
+	defer func() { endSpan(span, err) }()
+
+	if err = c.repo.DeleteGroup(ctx, group_id); err != nil {
+		c.logger(ctx).ErrorContext(ctx, "failed to delete group", "group_id", group_id, "error", err)
+		return err
+	}
+
+	c.logger(ctx).InfoContext(ctx, "deleted group", "group_id", group_id)
+	return nil
+}
+
+func (c *GroupControllerImpl) GetGroupMembers(ctx context.Context, group_id int, transitive bool) (_ *[]model.User, err error) {
+	ctx, span := tracer.Start(ctx, "GroupController.GetGroupMembers", trace.WithAttributes(attribute.Int("group.id", group_id), attribute.Bool("group.transitive", transitive)))
+	defer func() { endSpan(span, err) }()
+
+	if _, err = c.repo.GetGroup(ctx, group_id); err != nil {
+		return nil, groupError(err)
+	}
+
+	users, err := c.repo.GetGroupMembers(ctx, group_id, transitive)
+	if err != nil {
+		c.logger(ctx).ErrorContext(ctx, "failed to get group members", "group_id", group_id, "error", err)
+		return nil, err
+	}
+	return users, nil
+}
+
+func (c *GroupControllerImpl) GetUserGroups(ctx context.Context, user_id int, transitive bool) (_ *[]model.Group, err error) {
+	ctx, span := tracer.Start(ctx, "GroupController.GetUserGroups", trace.WithAttributes(attribute.Int("user.id", user_id), attribute.Bool("group.transitive", transitive)))
+	defer func() { endSpan(span, err) }()
+
+	if _, err = c.users.GetById(ctx, user_id); err != nil {
+		c.logger(ctx).DebugContext(ctx, "failed to get user", "user_id", user_id, "error", err)
+		return nil, err
+	}
+
+	groups, err := c.repo.GetUserGroups(ctx, user_id, transitive)
+	if err != nil {
+		c.logger(ctx).ErrorContext(ctx, "failed to get user groups", "user_id", user_id, "error", err)
+		return nil, err
+	}
+	return groups, nil
+}
+
+// checkMemberCount bounds the number of users added or removed at once
+func checkMemberCount(user_ids []int) error {
+	switch {
+	case len(user_ids) == 0:
+		return &ValidationError{Fields: []FieldError{{Field: "user_ids", Rule: "required", Message: "is required"}}, entity: "group members"}
+	case len(user_ids) > groupMembersMaxPerRequest:
+		return &ValidationError{Fields: []FieldError{{Field: "user_ids", Rule: "max", Message: fmt.Sprintf("must be at most %d users", groupMembersMaxPerRequest)}}, entity: "group members"}
+	}
+	return nil
+}
+
+// checkMembers drops the duplicates from user_ids and checks each of them is
+// a user of the tenant, returning a *ValidationError listing every rejected id
+func (c *GroupControllerImpl) checkMembers(ctx context.Context, user_ids []int) ([]int, error) {
+	if err := checkMemberCount(user_ids); err != nil {
+		return nil, err
+	}
+
+	var (
+		ids  []int
+		errs []FieldError
+		seen = make(map[int]struct{}, len(user_ids))
+	)
+	for i, id := range user_ids {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+
+		_, err := c.users.GetById(ctx, id)
+		if errors.Is(err, repo.ErrNotFound) {
+			errs = append(errs, FieldError{Field: fmt.Sprintf("user_ids[%d]", i), Rule: "exists", Message: "must be an existing user"})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	if len(errs) > 0 {
+		return nil, &ValidationError{Fields: errs, entity: "group members"}
+	}
+	return ids, nil
+}
+
+func (c *GroupControllerImpl) AddGroupMembers(ctx context.Context, group_id int, user_ids []int) (_ int, err error) {
+	ctx, span := tracer.Start(ctx, "GroupController.AddGroupMembers", trace.WithAttributes(attribute.Int("group.id", group_id), attribute.Int("group.users", len(user_ids))))
+	defer func() { endSpan(span, err) }()
+
+	if _, err = c.repo.GetGroup(ctx, group_id); err != nil {
+		return 0, groupError(err)
+	}
+	ids, err := c.checkMembers(ctx, user_ids)
+	if err != nil {
+		c.logger(ctx).InfoContext(ctx, "rejected invalid group members", "group_id", group_id, "error", err)
+		return 0, err
+	}
+
+	n, err := c.repo.AddGroupMembers(ctx, group_id, ids)
+	if err != nil {
+		c.logger(ctx).ErrorContext(ctx, "failed to add group members", "group_id", group_id, "error", err)
+		return 0, err
+	}
+
+	c.logger(ctx).InfoContext(ctx, "added group members", "group_id", group_id, "members", n)
+	return n, nil
+}
+
+func (c *GroupControllerImpl) RemoveGroupMembers(ctx context.Context, group_id int, user_ids []int) (_ int, err error) {
+	ctx, span := tracer.Start(ctx, "GroupController.RemoveGroupMembers", trace.WithAttributes(attribute.Int("group.id", group_id), attribute.Int("group.users", len(user_ids))))
+	defer func() { endSpan(span, err) }()
+
+	if _, err = c.repo.GetGroup(ctx, group_id); err != nil {
+		return 0, groupError(err)
+	}
+	// Users that no longer exist have no membership left to remove, only the
+	// size of the request is checked
+	if err = checkMemberCount(user_ids); err != nil {
+		return 0, err
+	}
+
+	n, err := c.repo.RemoveGroupMembers(ctx, group_id, user_ids)
+	if err != nil {
+		c.logger(ctx).ErrorContext(ctx, "failed to remove group members", "group_id", group_id, "error", err)
+		return 0, err
+	}
+
+	c.logger(ctx).InfoContext(ctx, "removed group members", "group_id", group_id, "members", n)
+	return n, nil
+}
@@ -1,13 +1,195 @@
 package controller
 
-import "users-backend/model"
+import (
+	"context"
+	"users-backend/auth"
+	"users-backend/model"
+)
 
 type (
+	// UserController manages the users of the tenant of the context. A
+	// managerID of 0 leaves the user without manager.
 	UserController interface {
-		CreateUser(userName, firstName, lastName, email, userStatus, department string) (int, error)
-		GetUser(user_id int) (*model.User, error)
-		GetAllUsers() (*[]model.User, error)
-		UpdateUser(user_id int, userName, firstName, lastName, email, userStatus, department string) (int, error)
-		DeleteUser(user_id int) error
+		CreateUser(ctx context.Context, userName, firstName, lastName, email, userStatus, department string, managerID int, attributes model.Attributes) (int, error)
+		GetUser(ctx context.Context, user_id int) (*model.User, error)
+		GetAllUsers(ctx context.Context) (*[]model.User, error)
+		// GetUsersByAttributes returns the users having every given custom
+		// attribute value, values are parsed by the type of their attribute
+		GetUsersByAttributes(ctx context.Context, attributes map[string]string) (*[]model.User, error)
+		// UpdateUser keeps the custom attributes of the user when attributes is
+		// nil and replaces them otherwise. The manager is kept when managerID is
+		// nil and removed by 0. Terminating a user moves its direct reports to
+		// its own manager.
+		UpdateUser(ctx context.Context, user_id int, userName, firstName, lastName, email, userStatus, department string, managerID *int, attributes model.Attributes) (int, error)
+		// DeleteUser moves the direct reports of the user to its own manager
+		// before deleting it
+		DeleteUser(ctx context.Context, user_id int) error
+
+		// GetDirectReports returns the users whose manager is user_id, ordered
+		// by id
+		GetDirectReports(ctx context.Context, user_id int) (*[]model.User, error)
+		// GetManagementChain returns the managers of the user, from its direct
+		// manager up to the top of the hierarchy
+		GetManagementChain(ctx context.Context, user_id int) (*[]model.User, error)
+		// GetSubordinates returns every user reporting to user_id directly or
+		// not, ordered by depth then id
+		GetSubordinates(ctx context.Context, user_id int) (*[]model.User, error)
+
+		// RunInTx runs fn in a single repository transaction, calls made with
+		// the context passed to fn are rolled back together when fn fails
+		RunInTx(ctx context.Context, fn func(ctx context.Context) error) error
+	}
+
+	// TenantController manages the tenants users are scoped to, its calls are
+	// not scoped to a tenant themselves
+	TenantController interface {
+		CreateTenant(ctx context.Context, slug, name string) (int, error)
+		GetTenant(ctx context.Context, tenant_id int) (*model.Tenant, error)
+		GetTenantBySlug(ctx context.Context, slug string) (*model.Tenant, error)
+		GetAllTenants(ctx context.Context) (*[]model.Tenant, error)
+		UpdateTenant(ctx context.Context, tenant_id int, slug, name string) (int, error)
+		DeleteTenant(ctx context.Context, tenant_id int) error
+	}
+
+	// AttributeController manages the custom user attributes of the tenant of
+	// the context
+	AttributeController interface {
+		CreateAttribute(ctx context.Context, name string, attrType model.AttributeType, required, unique bool, enumValues []string) (int, error)
+		GetAttribute(ctx context.Context, attribute_id int) (*model.AttributeDefinition, error)
+		GetAttributes(ctx context.Context) (*[]model.AttributeDefinition, error)
+		DeleteAttribute(ctx context.Context, attribute_id int) error
+	}
+
+	// GroupController manages the groups of the tenant of the context and
+	// their members. parentID of 0 makes a top level group.
+	GroupController interface {
+		CreateGroup(ctx context.Context, name, description string, parentID int) (int, error)
+		GetGroup(ctx context.Context, group_id int) (*model.Group, error)
+		GetGroups(ctx context.Context) (*[]model.Group, error)
+		UpdateGroup(ctx context.Context, group_id int, name, description string, parentID int) (int, error)
+		// DeleteGroup moves the subgroups of the group to its parent before
+		// deleting it
+		DeleteGroup(ctx context.Context, group_id int) error
+
+		// GetGroupMembers returns the users of the group ordered by id, with
+		// transitive those of its subgroups as well
+		GetGroupMembers(ctx context.Context, group_id int, transitive bool) (*[]model.User, error)
+		// GetUserGroups returns the groups of the user ordered by name, with
+		// transitive the groups they are nested in as well
+		GetUserGroups(ctx context.Context, user_id int, transitive bool) (*[]model.Group, error)
+		// AddGroupMembers adds the users to the group and returns how many
+		// were not members yet
+		AddGroupMembers(ctx context.Context, group_id int, user_ids []int) (int, error)
+		// RemoveGroupMembers removes the users from the group and returns how
+		// many were members
+		RemoveGroupMembers(ctx context.Context, group_id int, user_ids []int) (int, error)
+	}
+
+	// AuthController checks the local passwords of the users of the tenant of
+	// the context and signs the tokens they log in with
+	AuthController interface {
+		// Login returns a token for the user when the password is right, the
+		// account is not locked and the user is active. Wrong user names and
+		// passwords both return ErrInvalidCredentials. Users with a second
+		// factor also need a TOTP or recovery code, ErrTwoFactorRequired is
+		// returned without one and ErrInvalidTwoFactorCode for a wrong one.
+		Login(ctx context.Context, userName, password, code string) (*auth.Token, error)
+		// Authenticate returns the user a login token was issued to, when it
+		// is valid for the tenant of the context and the user is active. It
+		// returns an error wrapping auth.ErrInvalidToken otherwise.
+		Authenticate(ctx context.Context, token string) (int, error)
+		// VerifyToken returns the tenant and the user a login token was issued
+		// for when its signature and expiry are valid, without looking the
+		// user up. It returns an error wrapping auth.ErrInvalidToken otherwise.
+		VerifyToken(token string) (tenant_id, user_id int, err error)
+		// SetPassword checks the password against the policy and replaces
+		// the password of the user, unlocking its account
+		SetPassword(ctx context.Context, user_id int, password string) error
+		// ChangePassword sets the password of a logged in user when current
+		// is its password. A wrong one returns ErrInvalidCredentials and
+		// counts as a failed login for the lockout.
+		ChangePassword(ctx context.Context, user_id int, current, password string) error
+		// DeletePassword removes the password of the user, who can no longer
+		// log in
+		DeletePassword(ctx context.Context, user_id int) error
+	}
+
+	// TwoFactorController manages the TOTP second factor the users of the
+	// tenant of the context log in with
+	TwoFactorController interface {
+		// EnrollTwoFactor generates a new secret for the user, it is only
+		// asked at login once confirmed. It returns ErrTwoFactorEnabled when
+		// the user already has a confirmed one.
+		EnrollTwoFactor(ctx context.Context, user_id int) (*TwoFactorEnrollment, error)
+		// ConfirmTwoFactor enables the enrolled secret when code matches it
+		// and returns the recovery codes of the user
+		ConfirmTwoFactor(ctx context.Context, user_id int, code string) ([]string, error)
+		// RegenerateRecoveryCodes replaces the recovery codes of the user
+		// when code is a current TOTP code
+		RegenerateRecoveryCodes(ctx context.Context, user_id int, code string) ([]string, error)
+		GetTwoFactor(ctx context.Context, user_id int) (*TwoFactorStatus, error)
+		// ResetTwoFactor removes the second factor and the recovery codes of
+		// the user, for users who lost their device
+		ResetTwoFactor(ctx context.Context, user_id int) error
+	}
+
+	// OIDCController is the OpenID Connect provider the internal apps log
+	// the users in with, and manages the clients of the tenant of the
+	// context. The protocol methods are not scoped to a tenant, clients are
+	// found in every tenant and the context is then scoped to theirs.
+	OIDCController interface {
+		// Issuer is the issuer of the tokens, the base URL of the provider
+		Issuer() string
+		// KeySet returns the public keys the tokens are verified with
+		KeySet() auth.JWKSet
+		// FindClient returns the client with that id in any tenant
+		FindClient(ctx context.Context, client_id string) (*model.OAuthClient, error)
+		// CheckAuthorization checks an authorization request of client and
+		// keeps the supported scopes of req. It returns ErrInvalidRedirectURI
+		// when the redirect URI is not one of the client, which must not be
+		// redirected to, and an *OAuthError to send to it otherwise.
+		CheckAuthorization(ctx context.Context, client *model.OAuthClient, req *AuthorizationRequest) error
+		// Authorize logs the user in like Login and returns a single use
+		// code the client exchanges for the tokens
+		Authorize(ctx context.Context, client *model.OAuthClient, req *AuthorizationRequest, userName, password, code string) (string, error)
+		// Exchange returns the tokens of a code issued to client, an
+		// *OAuthError is returned for rejected requests
+		Exchange(ctx context.Context, client *model.OAuthClient, req *TokenRequest) (*OIDCTokens, error)
+		// UserInfo returns the claims of the user an access token was issued
+		// to, when the token, its client and its user are valid. It returns an
+		// error wrapping auth.ErrInvalidToken otherwise.
+		UserInfo(ctx context.Context, token string) (*UserInfo, error)
+
+		GetClients(ctx context.Context) (*[]model.OAuthClient, error)
+		GetClient(ctx context.Context, client_id string) (*model.OAuthClient, error)
+		// CreateClient registers a client and returns its secret, which is
+		// only stored hashed. Public clients have no secret.
+		CreateClient(ctx context.Context, name string, redirectURIs []string, public bool) (*model.OAuthClient, string, error)
+		// UpdateClient replaces the name and redirect URIs of the client
+		UpdateClient(ctx context.Context, client_id, name string, redirectURIs []string) (*model.OAuthClient, error)
+		// RotateClientSecret replaces the secret of a confidential client, the
+		// old one stops working right away
+		RotateClientSecret(ctx context.Context, client_id string) (string, error)
+		// DeleteClient removes the client, its pending codes and the access
+		// tokens it was issued stop working
+		DeleteClient(ctx context.Context, client_id string) error
+	}
+
+	// AccountController mails single use links to the users of the tenant of
+	// the context to verify their email and reset their password
+	AccountController interface {
+		// SendEmailVerification mails a verification link to the email of
+		// the user, replacing the links sent before
+		SendEmailVerification(ctx context.Context, user_id int) error
+		// VerifyEmail verifies the email the token was sent to, it returns
+		// ErrInvalidAccountToken for an unknown, used or expired token
+		VerifyEmail(ctx context.Context, token string) error
+		// RequestPasswordReset mails a reset link to the active user. It
+		// succeeds for unknown and disabled users too, so that it does not
+		// tell which accounts exist.
+		RequestPasswordReset(ctx context.Context, userName string) error
+		// ResetPassword sets the password of the user the token was sent to,
+		// the token can be used again when the password is rejected
+		ResetPassword(ctx context.Context, token, password string) error
 	}
 )
@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"users-backend/model"
+	"users-backend/repo"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// nullID stores an id of 0 as NULL
+func nullID(id int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
+}
+
+// checkManager validates the manager given to user_id, 0 for a new user. The
+// manager must be a user of the tenant that is not terminated and does not
+// report to user_id already, which would close a cycle.
+func (c *UserControllerImpl) checkManager(ctx context.Context, user_id, managerID int) ([]FieldError, error) {
+	if managerID == 0 {
+		return nil, nil
+	}
+	if managerID == user_id {
+		return []FieldError{{Field: "manager_id", Rule: "cycle", Message: "can not be the user itself"}}, nil
+	}
+
+	manager, err := c.repo.GetById(ctx, managerID)
+	if errors.Is(err, repo.ErrNotFound) {
+		return []FieldError{{Field: "manager_id", Rule: "exists", Message: "must be an existing user"}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if manager.UserStatus == model.Terminated {
+		return []FieldError{{Field: "manager_id", Rule: "active", Message: "must not be terminated"}}, nil
+	}
+	if user_id == 0 {
+		return nil, nil
+	}
+
+	chain, err := c.repo.GetManagementChain(ctx, managerID)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range *chain {
+		if u.UserID == user_id {
+			return []FieldError{{Field: "manager_id", Rule: "cycle", Message: "must not report to the user"}}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// reassignReports moves the direct reports of user_id to managerID, so that
+// no one reports to a terminated or deleted user
+func (c *UserControllerImpl) reassignReports(ctx context.Context, user_id, managerID int) error {
+	n, err := c.repo.ReassignReports(ctx, user_id, managerID)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		c.logger(ctx).InfoContext(ctx, "reassigned reports", "user_id", user_id, "manager_id", managerID, "reports", n)
+	}
+	return nil
+}
+
+func (c *UserControllerImpl) GetDirectReports(ctx context.Context, user_id int) (*[]model.User, error) {
+	return c.hierarchy(ctx, "GetDirectReports", user_id, c.repo.GetDirectReports)
+}
+
+func (c *UserControllerImpl) GetManagementChain(ctx context.Context, user_id int) (*[]model.User, error) {
+	return c.hierarchy(ctx, "GetManagementChain", user_id, c.repo.GetManagementChain)
+}
+
+func (c *UserControllerImpl) GetSubordinates(ctx context.Context, user_id int) (*[]model.User, error) {
+	return c.hierarchy(ctx, "GetSubordinates", user_id, c.repo.GetSubordinates)
+}
+
+// hierarchy runs a hierarchy query once user_id is known to exist, so that a
+// missing user is not mistaken for one without reports or manager
+func (c *UserControllerImpl) hierarchy(ctx context.Context, method string, user_id int, query func(ctx context.Context, user_id int) (*[]model.User, error)) (_ *[]model.User, err error) {
+	ctx, span := tracer.Start(ctx, "UserController."+method, trace.WithAttributes(attribute.Int("user.id", user_id)))
+	defer func() { endSpan(span, err) }()
+
+	if _, err = c.repo.GetById(ctx, user_id); err != nil {
+		c.logger(ctx).DebugContext(ctx, "failed to get user", "user_id", user_id, "error", err)
+		return nil, err
+	}
+
+	users, err := query(ctx, user_id)
+	if err != nil {
+		c.logger(ctx).ErrorContext(ctx, "failed to query hierarchy", "user_id", user_id, "method", method, "error", err)
+		return nil, err
+	}
+
+	return users, nil
+}
@@ -0,0 +1,662 @@
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+	"users-backend/auth"
+	"users-backend/model"
+	"users-backend/repo"
+	"users-backend/tenant"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/text/unicode/norm"
+)
+
+var (
+	ErrClientNotFound = errors.New("client not found")
+	// ErrInvalidRedirectURI is returned for authorization requests of an
+	// unknown client or with a redirect URI the client did not register,
+	// they must not be redirected
+	ErrInvalidRedirectURI = errors.New("invalid redirect URI")
+	// ErrPublicClient is returned when rotating the secret of a client that
+	// has none
+	ErrPublicClient = errors.New("client is public")
+	// ErrOIDCUnavailable is returned when the OpenID Connect provider is not
+	// configured
+	ErrOIDCUnavailable = errors.New("OpenID Connect not configured")
+
+	_ OIDCController = new(AuthControllerImpl)
+)
+
+// The error codes of OAuthError (RFC 6749 and OpenID Connect Core)
+const (
+	OAuthInvalidRequest          = "invalid_request"
+	OAuthInvalidClient           = "invalid_client"
+	OAuthInvalidGrant            = "invalid_grant"
+	OAuthUnsupportedGrantType    = "unsupported_grant_type"
+	OAuthUnsupportedResponseType = "unsupported_response_type"
+	OAuthInvalidScope            = "invalid_scope"
+	OAuthLoginRequired           = "login_required"
+	OAuthServerError             = "server_error"
+)
+
+// The scopes granted by the provider, others are ignored
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+// SupportedScopes lists the scopes granted by the provider, in the order
+// granted scopes are listed
+var SupportedScopes = []string{ScopeOpenID, ScopeProfile, ScopeEmail}
+
+// AuthorizationCodeTTL is how long a client has to exchange a code
+const AuthorizationCodeTTL = time.Minute
+
+const (
+	clientNameMaxLength        = 255
+	clientRedirectURIsMax      = 10
+	clientRedirectURIMaxLength = 2000
+)
+
+// OAuthError is an error returned to the client with one of the OAuth error
+// codes, authorization errors are sent to its redirect URI
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Description)
+}
+
+func oauthError(code, format string, args ...interface{}) *OAuthError {
+	return &OAuthError{Code: code, Description: fmt.Sprintf(format, args...)}
+}
+
+// AuthorizationRequest holds the parameters of an authorization request
+type AuthorizationRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Prompt              string
+}
+
+// TokenRequest holds the parameters of a token request, the client is
+// authenticated by the caller apart from its secret
+type TokenRequest struct {
+	GrantType    string
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+	ClientSecret string
+}
+
+// OIDCTokens are issued to a client in exchange for a code
+type OIDCTokens struct {
+	AccessToken *auth.Token
+	IDToken     string
+	// Scope is the space separated list of granted scopes
+	Scope string
+}
+
+// UserInfo holds the claims of the user an access token was issued to
+type UserInfo struct {
+	Subject string
+	auth.UserClaims
+}
+
+// WithOIDC makes the controller an OpenID Connect provider for the clients
+// stored in clients, signing its tokens with signer. Without it the
+// OIDCController methods return ErrOIDCUnavailable.
+func WithOIDC(clients repo.ClientRepo, codes repo.AuthorizationCodeRepo, signer *auth.OIDCSigner) AuthOption {
+	return func(c *AuthControllerImpl) {
+		c.clients = clients
+		c.codes = codes
+		c.oidc = signer
+	}
+}
+
+func (c *AuthControllerImpl) oidcEnabled() bool {
+	return c.clients != nil && c.codes != nil && c.oidc != nil
+}
+
+func (c *AuthControllerImpl) Issuer() string {
+	if c.oidc == nil {
+		return ""
+	}
+	return c.oidc.Issuer()
+}
+
+func (c *AuthControllerImpl) KeySet() auth.JWKSet {
+	if c.oidc == nil {
+		return auth.JWKSet{Keys: []auth.JWK{}}
+	}
+	return c.oidc.KeySet()
+}
+
+func (c *AuthControllerImpl) FindClient(ctx context.Context, client_id string) (_ *model.OAuthClient, err error) {
+	ctx, span := tracer.Start(ctx, "AuthController.FindClient", trace.WithAttributes(attribute.String("client.id", client_id)))
+	defer func() { endSpan(span, err) }()
+
+	if !c.oidcEnabled() {
+		return nil, ErrOIDCUnavailable
+	}
+	if client_id == "" {
+		return nil, ErrClientNotFound
+	}
+
+	client, err := c.clients.FindClient(ctx, client_id)
+	if errors.Is(err, repo.ErrClientNotFound) {
+		return nil, ErrClientNotFound
+	}
+	if err != nil {
+		c.logger(ctx).ErrorContext(ctx, "failed to find client", "client_id", client_id, "error", err)
+		return nil, err
+	}
+	return client, nil
+}
+
+// grantedScopes keeps the supported scopes of scope, openid must be one of
+// them
+func grantedScopes(scope string) (string, error) {
+	requested := map[string]bool{}
+	for _, s := range strings.Fields(scope) {
+		requested[s] = true
+	}
+	if !requested[ScopeOpenID] {
+		return "", oauthError(OAuthInvalidScope, "scope must include %s", ScopeOpenID)
+	}
+
+	var granted []string
+	for _, s := range SupportedScopes {
+		if requested[s] {
+			granted = append(granted, s)
+		}
+	}
+	return strings.Join(granted, " "), nil
+}
+
+// hasScope reports whether the space separated scopes include scope
+func hasScope(scopes, scope string) bool {
+	for _, s := range strings.Fields(scopes) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *AuthControllerImpl) CheckAuthorization(ctx context.Context, client *model.OAuthClient, req *AuthorizationRequest) (err error) {
+	ctx, span := tracer.Start(ctx, "AuthController.CheckAuthorization", trace.WithAttributes(attribute.String("client.id", client.ClientID)))
+	defer func() { endSpan(span, err) }()
+
+	if !c.oidcEnabled() {
+		return ErrOIDCUnavailable
+	}
+	// Errors are only sent back once the redirect URI is known to be the
+	// client's, anything else would make the provider an open redirector
+	if req.ClientID != client.ClientID || !client.AllowsRedirectURI(req.RedirectURI) {
+		c.logger(ctx).InfoContext(ctx, "rejected unregistered redirect URI", "client_id", client.ClientID, "redirect_uri", req.RedirectURI)
+		return ErrInvalidRedirectURI
+	}
+
+	if req.ResponseType != "code" {
+		return oauthError(OAuthUnsupportedResponseType, "response_type must be code")
+	}
+	scope, err := grantedScopes(req.Scope)
+	if err != nil {
+		return err
+	}
+	req.Scope = scope
+	if req.CodeChallengeMethod != "S256" {
+		return oauthError(OAuthInvalidRequest, "code_challenge_method must be S256")
+	}
+	if !auth.ValidPKCEValue(req.CodeChallenge) {
+		return oauthError(OAuthInvalidRequest, "code_challenge is required")
+	}
+	// There is no session to log in silently with
+	if hasScope(req.Prompt, "none") {
+		return oauthError(OAuthLoginRequired, "the user must log in")
+	}
+	return nil
+}
+
+func (c *AuthControllerImpl) Authorize(ctx context.Context, client *model.OAuthClient, req *AuthorizationRequest, userName, password, code string) (_ string, err error) {
+	ctx, span := tracer.Start(ctx, "AuthController.Authorize", trace.WithAttributes(attribute.String("client.id", client.ClientID)))
+	defer func() { endSpan(span, err) }()
+
+	if err = c.CheckAuthorization(ctx, client, req); err != nil {
+		return "", err
+	}
+
+	now := c.now()
+	user, l, err := c.authenticate(ctx, userName, password, code, now)
+	if err != nil {
+		return "", err
+	}
+	span.SetAttributes(attribute.Int("user.id", user.UserID))
+	l = l.With("client_id", client.ClientID)
+
+	value, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		l.ErrorContext(ctx, "failed to generate authorization code", "error", err)
+		return "", err
+	}
+	err = c.codes.CreateAuthorizationCode(ctx, &model.AuthorizationCode{
+		ClientID:      client.ClientID,
+		UserID:        user.UserID,
+		CodeHash:      hash,
+		RedirectURI:   req.RedirectURI,
+		Scope:         req.Scope,
+		Nonce:         req.Nonce,
+		CodeChallenge: req.CodeChallenge,
+		AuthTime:      now,
+		ExpiresAt:     now.Add(AuthorizationCodeTTL),
+	})
+	if err != nil {
+		l.ErrorContext(ctx, "failed to create authorization code", "error", err)
+		return "", err
+	}
+
+	l.InfoContext(ctx, "authorized client")
+	return value, nil
+}
+
+func (c *AuthControllerImpl) Exchange(ctx context.Context, client *model.OAuthClient, req *TokenRequest) (_ *OIDCTokens, err error) {
+	ctx, span := tracer.Start(ctx, "AuthController.Exchange", trace.WithAttributes(attribute.String("client.id", client.ClientID)))
+	defer func() { endSpan(span, err) }()
+
+	if !c.oidcEnabled() {
+		return nil, ErrOIDCUnavailable
+	}
+	l := c.logger(ctx).With("client_id", client.ClientID)
+
+	// Public clients can not keep a secret, the code verifier stands in for
+	// it
+	if !client.Public() {
+		hash := auth.HashOpaqueToken(req.ClientSecret)
+		if req.ClientSecret == "" || subtle.ConstantTimeCompare([]byte(hash), []byte(client.SecretHash)) != 1 {
+			l.InfoContext(ctx, "rejected wrong client secret")
+			return nil, oauthError(OAuthInvalidClient, "client authentication failed")
+		}
+	}
+	if req.GrantType != "authorization_code" {
+		return nil, oauthError(OAuthUnsupportedGrantType, "grant_type must be authorization_code")
+	}
+	if req.Code == "" {
+		return nil, oauthError(OAuthInvalidRequest, "code is required")
+	}
+	if req.CodeVerifier == "" {
+		return nil, oauthError(OAuthInvalidRequest, "code_verifier is required")
+	}
+
+	// The code is spent before it is checked, a code sent with the wrong
+	// verifier may have been stolen and must not be tried again
+	now := c.now()
+	code, err := c.codes.ConsumeAuthorizationCode(ctx, auth.HashOpaqueToken(req.Code), now)
+	if errors.Is(err, repo.ErrAuthorizationCodeNotFound) {
+		l.InfoContext(ctx, "rejected unknown, used or expired authorization code")
+		return nil, oauthError(OAuthInvalidGrant, "code is invalid or expired")
+	}
+	if err != nil {
+		l.ErrorContext(ctx, "failed to consume authorization code", "error", err)
+		return nil, err
+	}
+	l = l.With("user_id", code.UserID)
+
+	switch {
+	case code.ClientID != client.ClientID:
+		l.WarnContext(ctx, "rejected authorization code of another client", "code_client_id", code.ClientID)
+		return nil, oauthError(OAuthInvalidGrant, "code is invalid or expired")
+	case code.RedirectURI != req.RedirectURI:
+		l.InfoContext(ctx, "rejected authorization code with another redirect URI")
+		return nil, oauthError(OAuthInvalidGrant, "redirect_uri does not match the authorization request")
+	case !auth.VerifyPKCE(req.CodeVerifier, code.CodeChallenge):
+		l.WarnContext(ctx, "rejected authorization code with wrong code verifier")
+		return nil, oauthError(OAuthInvalidGrant, "code_verifier does not match the code_challenge")
+	}
+
+	user, err := c.users.GetById(ctx, code.UserID)
+	if errors.Is(err, repo.ErrNotFound) || (err == nil && user.UserStatus != model.Active) {
+		l.InfoContext(ctx, "rejected authorization code of a deleted or disabled user")
+		return nil, oauthError(OAuthInvalidGrant, "user is not active")
+	}
+	if err != nil {
+		l.ErrorContext(ctx, "failed to get user", "error", err)
+		return nil, err
+	}
+
+	// Both tokens are issued to the user for the client
+	idClaims := &auth.IDTokenClaims{
+		Nonce:      code.Nonce,
+		AuthTime:   code.AuthTime.Unix(),
+		TenantID:   user.TenantID,
+		UserClaims: userClaims(user, code.Scope),
+	}
+	idClaims.Subject = strconv.Itoa(user.UserID)
+	idClaims.Audience = client.ClientID
+	idToken, err := c.oidc.SignIDToken(idClaims, now)
+	if err != nil {
+		l.ErrorContext(ctx, "failed to sign ID token", "error", err)
+		return nil, err
+	}
+	accessClaims := &auth.AccessTokenClaims{ClientID: client.ClientID, Scope: code.Scope, TenantID: user.TenantID}
+	accessClaims.Subject = idClaims.Subject
+	accessClaims.Audience = client.ClientID
+	accessToken, err := c.oidc.SignAccessToken(accessClaims, now)
+	if err != nil {
+		l.ErrorContext(ctx, "failed to sign access token", "error", err)
+		return nil, err
+	}
+
+	l.InfoContext(ctx, "issued tokens", "scope", code.Scope)
+	return &OIDCTokens{AccessToken: accessToken, IDToken: idToken.Value, Scope: code.Scope}, nil
+}
+
+func (c *AuthControllerImpl) UserInfo(ctx context.Context, token string) (_ *UserInfo, err error) {
+	ctx, span := tracer.Start(ctx, "AuthController.UserInfo")
+	defer func() { endSpan(span, err) }()
+
+	if !c.oidcEnabled() {
+		return nil, fmt.Errorf("%w: OpenID Connect is disabled", auth.ErrInvalidToken)
+	}
+	claims, err := c.oidc.VerifyAccessToken(token)
+	if err != nil {
+		c.logger(ctx).InfoContext(ctx, "rejected access token", "error", err)
+		return nil, err
+	}
+
+	// The token names the tenant, the request does not
+	user_id, _ := claims.UserID()
+	span.SetAttributes(attribute.Int("tenant.id", claims.TenantID), attribute.Int("user.id", user_id))
+	ctx = tenant.WithID(ctx, claims.TenantID)
+	l := c.logger(ctx).With("tenant_id", claims.TenantID, "user_id", user_id, "client_id", claims.ClientID)
+
+	// Deleting a client revokes its tokens
+	if _, err = c.clients.GetClient(ctx, claims.ClientID); err != nil {
+		if errors.Is(err, repo.ErrClientNotFound) {
+			return nil, fmt.Errorf("%w: client %q does not exist", auth.ErrInvalidToken, claims.ClientID)
+		}
+		l.ErrorContext(ctx, "failed to get client", "error", err)
+		return nil, err
+	}
+	user, err := c.users.GetById(ctx, user_id)
+	if errors.Is(err, repo.ErrNotFound) {
+		return nil, fmt.Errorf("%w: user %d does not exist", auth.ErrInvalidToken, user_id)
+	}
+	if err != nil {
+		l.ErrorContext(ctx, "failed to get user", "error", err)
+		return nil, err
+	}
+	if user.UserStatus != model.Active {
+		return nil, fmt.Errorf("%w: user %d is not active", auth.ErrInvalidToken, user_id)
+	}
+
+	return &UserInfo{Subject: claims.Subject, UserClaims: userClaims(user, claims.Scope)}, nil
+}
+
+// userClaims returns the claims of user granted by scope
+func userClaims(user *model.User, scope string) auth.UserClaims {
+	var claims auth.UserClaims
+	if hasScope(scope, ScopeProfile) {
+		claims.Name = strings.TrimSpace(user.FirstName + " " + user.LastName)
+		claims.GivenName = user.FirstName
+		claims.FamilyName = user.LastName
+		claims.PreferredUsername = user.UserName
+		claims.Department = user.Department.String
+		claims.UserStatus = user.UserStatus
+	}
+	if hasScope(scope, ScopeEmail) && user.Email != "" {
+		verified := user.EmailVerified
+		claims.Email = user.Email
+		claims.EmailVerified = &verified
+	}
+	return claims
+}
+
+// validRedirectURI checks a redirect URI registered for a client. It must be
+// absolute without fragment and use https, or http on the loopback interface
+// for apps running on the machine of the user.
+func validRedirectURI(raw string) (string, bool) {
+	if utf8.RuneCountInString(raw) > clientRedirectURIMaxLength || strings.Contains(raw, "#") {
+		return "must be absolute URIs without fragment", false
+	}
+	u, err := url.Parse(raw)
+	if err != nil || !u.IsAbs() || u.Host == "" {
+		return "must be absolute URIs without fragment", false
+	}
+
+	switch u.Scheme {
+	case "https":
+		return "", true
+	case "http":
+		host := u.Hostname()
+		if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+			return "", true
+		}
+	}
+	return "must use https, or http on a loopback address", false
+}
+
+// validateClient checks the name and redirect URIs of a client to be created
+// or updated, returning a *ValidationError listing every rejected field
+func validateClient(c *model.OAuthClient) error {
+	c.Name = norm.NFC.String(strings.TrimSpace(c.Name))
+
+	var errs []FieldError
+	switch {
+	case c.Name == "":
+		errs = append(errs, FieldError{Field: "name", Rule: "required", Message: "is required"})
+	case utf8.RuneCountInString(c.Name) > clientNameMaxLength:
+		errs = append(errs, FieldError{Field: "name", Rule: "max", Message: fmt.Sprintf("must be at most %d characters", clientNameMaxLength)})
+	case strings.IndexFunc(c.Name, unicode.IsControl) >= 0:
+		errs = append(errs, FieldError{Field: "name", Rule: "printable", Message: "must not contain control characters"})
+	}
+
+	uris := make([]string, 0, len(c.RedirectURIs))
+	seen := map[string]bool{}
+	for _, uri := range c.RedirectURIs {
+		uri = strings.TrimSpace(uri)
+		if !seen[uri] {
+			seen[uri] = true
+			uris = append(uris, uri)
+		}
+	}
+	c.RedirectURIs = uris
+
+	switch {
+	case len(uris) == 0:
+		errs = append(errs, FieldError{Field: "redirect_uris", Rule: "required", Message: "is required"})
+	case len(uris) > clientRedirectURIsMax:
+		errs = append(errs, FieldError{Field: "redirect_uris", Rule: "max", Message: fmt.Sprintf("must be at most %d URIs", clientRedirectURIsMax)})
+	default:
+		for _, uri := range uris {
+			if msg, ok := validRedirectURI(uri); !ok {
+				errs = append(errs, FieldError{Field: "redirect_uris", Rule: "uri", Message: msg})
+				break
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return &ValidationError{Fields: errs, entity: "client"}
+	}
+	return nil
+}
+
+// newClientID returns a random client id
+func newClientID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (c *AuthControllerImpl) GetClients(ctx context.Context) (_ *[]model.OAuthClient, err error) {
+	ctx, span := tracer.Start(ctx, "AuthController.GetClients")
+	defer func() { endSpan(span, err) }()
+
+	if !c.oidcEnabled() {
+		return nil, ErrOIDCUnavailable
+	}
+	clients, err := c.clients.GetClients(ctx)
+	if err != nil {
+		c.logger(ctx).ErrorContext(ctx, "failed to get clients", "error", err)
+		return nil, err
+	}
+	return clients, nil
+}
+
+func (c *AuthControllerImpl) GetClient(ctx context.Context, client_id string) (_ *model.OAuthClient, err error) {
+	ctx, span := tracer.Start(ctx, "AuthController.GetClient", trace.WithAttributes(attribute.String("client.id", client_id)))
+	defer func() { endSpan(span, err) }()
+
+	if !c.oidcEnabled() {
+		return nil, ErrOIDCUnavailable
+	}
+	client, err := c.clients.GetClient(ctx, client_id)
+	if errors.Is(err, repo.ErrClientNotFound) {
+		return nil, ErrClientNotFound
+	}
+	if err != nil {
+		c.logger(ctx).ErrorContext(ctx, "failed to get client", "client_id", client_id, "error", err)
+		return nil, err
+	}
+	return client, nil
+}
+
+func (c *AuthControllerImpl) CreateClient(ctx context.Context, name string, redirectURIs []string, public bool) (_ *model.OAuthClient, _ string, err error) {
+	ctx, span := tracer.Start(ctx, "AuthController.CreateClient", trace.WithAttributes(attribute.String("client.name", name), attribute.Bool("client.public", public)))
+	defer func() { endSpan(span, err) }()
+
+	if !c.oidcEnabled() {
+		return nil, "", ErrOIDCUnavailable
+	}
+	client := &model.OAuthClient{Name: name, RedirectURIs: redirectURIs}
+	if err = validateClient(client); err != nil {
+		c.logger(ctx).InfoContext(ctx, "rejected invalid client", "client_name", name, "error", err)
+		return nil, "", err
+	}
+
+	if client.ClientID, err = newClientID(); err != nil {
+		c.logger(ctx).ErrorContext(ctx, "failed to generate client id", "error", err)
+		return nil, "", err
+	}
+	var secret string
+	if !public {
+		if secret, client.SecretHash, err = auth.NewOpaqueToken(); err != nil {
+			c.logger(ctx).ErrorContext(ctx, "failed to generate client secret", "error", err)
+			return nil, "", err
+		}
+	}
+
+	l := c.logger(ctx).With("client_id", client.ClientID)
+	if err = c.clients.CreateClient(ctx, client); err != nil {
+		l.ErrorContext(ctx, "failed to create client", "error", err)
+		return nil, "", err
+	}
+
+	l.InfoContext(ctx, "created client", "client_name", client.Name, "public", public)
+	return client, secret, nil
+}
+
+func (c *AuthControllerImpl) UpdateClient(ctx context.Context, client_id, name string, redirectURIs []string) (_ *model.OAuthClient, err error) {
+	ctx, span := tracer.Start(ctx, "AuthController.UpdateClient", trace.WithAttributes(attribute.String("client.id", client_id), attribute.String("client.name", name)))
+	defer func() { endSpan(span, err) }()
+
+	if !c.oidcEnabled() {
+		return nil, ErrOIDCUnavailable
+	}
+	l := c.logger(ctx).With("client_id", client_id)
+
+	update := &model.OAuthClient{ClientID: client_id, Name: name, RedirectURIs: redirectURIs}
+	if err = validateClient(update); err != nil {
+		l.InfoContext(ctx, "rejected invalid client", "error", err)
+		return nil, err
+	}
+	if err = c.clients.UpdateClient(ctx, update); err != nil {
+		if errors.Is(err, repo.ErrClientNotFound) {
+			return nil, ErrClientNotFound
+		}
+		l.ErrorContext(ctx, "failed to update client", "error", err)
+		return nil, err
+	}
+
+	client, err := c.clients.GetClient(ctx, client_id)
+	if err != nil {
+		if errors.Is(err, repo.ErrClientNotFound) {
+			return nil, ErrClientNotFound
+		}
+		l.ErrorContext(ctx, "failed to get client", "error", err)
+		return nil, err
+	}
+
+	l.InfoContext(ctx, "updated client", "client_name", client.Name)
+	return client, nil
+}
+
+func (c *AuthControllerImpl) RotateClientSecret(ctx context.Context, client_id string) (_ string, err error) {
+	ctx, span := tracer.Start(ctx, "AuthController.RotateClientSecret", trace.WithAttributes(attribute.String("client.id", client_id)))
+	defer func() { endSpan(span, err) }()
+
+	client, err := c.GetClient(ctx, client_id)
+	if err != nil {
+		return "", err
+	}
+	if client.Public() {
+		return "", ErrPublicClient
+	}
+	l := c.logger(ctx).With("client_id", client_id)
+
+	secret, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		l.ErrorContext(ctx, "failed to generate client secret", "error", err)
+		return "", err
+	}
+	if err = c.clients.SetClientSecret(ctx, client_id, hash); err != nil {
+		if errors.Is(err, repo.ErrClientNotFound) {
+			return "", ErrClientNotFound
+		}
+		l.ErrorContext(ctx, "failed to set client secret", "error", err)
+		return "", err
+	}
+
+	l.InfoContext(ctx, "rotated client secret")
+	return secret, nil
+}
+
+func (c *AuthControllerImpl) DeleteClient(ctx context.Context, client_id string) (err error) {
+	ctx, span := tracer.Start(ctx, "AuthController.DeleteClient", trace.WithAttributes(attribute.String("client.id", client_id)))
+	defer func() { endSpan(span, err) }()
+
+	if !c.oidcEnabled() {
+		return ErrOIDCUnavailable
+	}
+	if err = c.clients.DeleteClient(ctx, client_id); err != nil {
+		c.logger(ctx).ErrorContext(ctx, "failed to delete client", "client_id", client_id, "error", err)
+		return err
+	}
+
+	c.logger(ctx).InfoContext(ctx, "deleted client", "client_id", client_id)
+	return nil
+}
@@ -0,0 +1,172 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+	"users-backend/logging"
+	"users-backend/model"
+	"users-backend/repo"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/text/unicode/norm"
+)
+
+var (
+	ErrTenantNotFound      = errors.New("tenant not found")
+	ErrTenantAlreadyExists = errors.New("tenant already exists")
+	ErrTenantHasUsers      = errors.New("tenant still has users")
+
+	_ TenantController = new(TenantControllerImpl)
+
+	// TenantSlugPattern is a DNS label so a slug can be used as a subdomain
+	TenantSlugPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+)
+
+const tenantNameMaxLength = 255
+
+type TenantControllerImpl struct {
+	repo repo.TenantRepo
+	log  *slog.Logger
+}
+
+func NewTenantController(repo repo.TenantRepo, log *slog.Logger) *TenantControllerImpl {
+	return &TenantControllerImpl{
+		repo: repo,
+		log:  log.With("component", "controller"),
+	}
+}
+
+func (c *TenantControllerImpl) logger(ctx context.Context) *slog.Logger {
+	return logging.FromContext(ctx, c.log)
+}
+
+// validateTenant normalizes the slug to lower case and checks both fields,
+// returning a *ValidationError listing every rejected field
+func validateTenant(slug, name string) (string, string, error) {
+	slug = strings.ToLower(strings.TrimSpace(slug))
+	name = norm.NFC.String(strings.TrimSpace(name))
+
+	var errs []FieldError
+	if !TenantSlugPattern.MatchString(slug) {
+		errs = append(errs, FieldError{Field: "slug", Rule: "pattern", Message: "must be 1 to 63 letters, digits or '-', starting and ending with a letter or digit"})
+	}
+	switch {
+	case name == "":
+		errs = append(errs, FieldError{Field: "name", Rule: "required", Message: "is required"})
+	case utf8.RuneCountInString(name) > tenantNameMaxLength:
+		errs = append(errs, FieldError{Field: "name", Rule: "max", Message: fmt.Sprintf("must be at most %d characters", tenantNameMaxLength)})
+	case strings.IndexFunc(name, unicode.IsControl) >= 0:
+		errs = append(errs, FieldError{Field: "name", Rule: "printable", Message: "must not contain control characters"})
+	}
+
+	if len(errs) > 0 {
+		return slug, name, &ValidationError{Fields: errs, entity: "tenant"}
+	}
+	return slug, name, nil
+}
+
+// tenantError maps the repo errors to the controller ones
+func tenantError(err error) error {
+	switch {
+	case errors.Is(err, repo.ErrTenantNotFound):
+		return ErrTenantNotFound
+	case errors.Is(err, repo.ErrDuplicateTenantSlug):
+		return ErrTenantAlreadyExists
+	case errors.Is(err, repo.ErrTenantInUse):
+		return ErrTenantHasUsers
+	}
+	return err
+}
+
+func (c *TenantControllerImpl) CreateTenant(ctx context.Context, slug, name string) (_ int, err error) {
+	ctx, span := tracer.Start(ctx, "TenantController.CreateTenant", trace.WithAttributes(attribute.String("tenant.slug", slug)))
+	defer func() { endSpan(span, err) }()
+
+	slug, name, err = validateTenant(slug, name)
+	if err != nil {
+		c.logger(ctx).InfoContext(ctx, "rejected invalid tenant", "tenant_slug", slug, "error", err)
+		return -1, err
+	}
+
+	tenantID, err := c.repo.CreateTenant(ctx, &model.Tenant{Slug: slug, Name: name})
+	if err != nil {
+		c.logger(ctx).InfoContext(ctx, "failed to create tenant", "tenant_slug", slug, "error", err)
+		return -1, tenantError(err)
+	}
+
+	c.logger(ctx).InfoContext(ctx, "created tenant", "tenant_id", tenantID, "tenant_slug", slug)
+	return tenantID, nil
+}
+
+func (c *TenantControllerImpl) GetTenant(ctx context.Context, tenant_id int) (_ *model.Tenant, err error) {
+	ctx, span := tracer.Start(ctx, "TenantController.GetTenant", trace.WithAttributes(attribute.Int("tenant.id", tenant_id)))
+	defer func() { endSpan(span, err) }()
+
+	t, err := c.repo.GetTenant(ctx, tenant_id)
+	if err != nil {
+		return nil, tenantError(err)
+	}
+	return t, nil
+}
+
+func (c *TenantControllerImpl) GetTenantBySlug(ctx context.Context, slug string) (_ *model.Tenant, err error) {
+	ctx, span := tracer.Start(ctx, "TenantController.GetTenantBySlug", trace.WithAttributes(attribute.String("tenant.slug", slug)))
+	defer func() { endSpan(span, err) }()
+
+	t, err := c.repo.GetTenantBySlug(ctx, strings.ToLower(slug))
+	if err != nil {
+		return nil, tenantError(err)
+	}
+	return t, nil
+}
+
+func (c *TenantControllerImpl) GetAllTenants(ctx context.Context) (_ *[]model.Tenant, err error) {
+	ctx, span := tracer.Start(ctx, "TenantController.GetAllTenants")
+	defer func() { endSpan(span, err) }()
+
+	tenants, err := c.repo.GetAllTenants(ctx)
+	if err != nil {
+		c.logger(ctx).ErrorContext(ctx, "failed to get all tenants", "error", err)
+		return nil, err
+	}
+	return tenants, nil
+}
+
+func (c *TenantControllerImpl) UpdateTenant(ctx context.Context, tenant_id int, slug, name string) (_ int, err error) {
+	ctx, span := tracer.Start(ctx, "TenantController.UpdateTenant", trace.WithAttributes(attribute.Int("tenant.id", tenant_id), attribute.String("tenant.slug", slug)))
+	defer func() { endSpan(span, err) }()
+
+	slug, name, err = validateTenant(slug, name)
+	if err != nil {
+		c.logger(ctx).InfoContext(ctx, "rejected invalid tenant", "tenant_id", tenant_id, "error", err)
+		return -1, err
+	}
+
+	if _, err = c.repo.UpdateTenant(ctx, &model.Tenant{TenantID: tenant_id, Slug: slug, Name: name}); err != nil {
+		c.logger(ctx).InfoContext(ctx, "failed to update tenant", "tenant_id", tenant_id, "error", err)
+		return -1, tenantError(err)
+	}
+
+	c.logger(ctx).InfoContext(ctx, "updated tenant", "tenant_id", tenant_id, "tenant_slug", slug)
+	return tenant_id, nil
+}
+
+func (c *TenantControllerImpl) DeleteTenant(ctx context.Context, tenant_id int) (err error) {
+	ctx, span := tracer.Start(ctx, "TenantController.DeleteTenant", trace.WithAttributes(attribute.Int("tenant.id", tenant_id)))
+	defer func() { endSpan(span, err) }()
+
+	if err = c.repo.DeleteTenant(ctx, tenant_id); err != nil {
+		c.logger(ctx).InfoContext(ctx, "failed to delete tenant", "tenant_id", tenant_id, "error", err)
+		return tenantError(err)
+	}
+
+	c.logger(ctx).InfoContext(ctx, "deleted tenant", "tenant_id", tenant_id)
+	return nil
+}
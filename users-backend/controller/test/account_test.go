@@ -0,0 +1,250 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+	"users-backend/auth"
+	"users-backend/controller"
+	"users-backend/logging"
+	"users-backend/mail"
+	"users-backend/model"
+	"users-backend/repo"
+	"users-backend/repo/mock"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	testifymock "github.com/stretchr/testify/mock"
+)
+
+// outbox keeps the messages sent instead of sending them
+type outbox struct {
+	messages []mail.Message
+	err      error
+}
+
+func (o *outbox) Send(ctx context.Context, msg mail.Message) error {
+	if o.err != nil {
+		return o.err
+	}
+	o.messages = append(o.messages, msg)
+	return nil
+}
+
+// linkToken returns the token of the only link of the last message
+func (o *outbox) linkToken() string {
+	gomega.Expect(o.messages).ShouldNot(gomega.BeEmpty())
+	for _, field := range strings.Fields(o.messages[len(o.messages)-1].Body) {
+		if u, err := url.Parse(field); err == nil && u.Query().Has("token") {
+			return u.Query().Get("token")
+		}
+	}
+	ginkgo.Fail("no link in the message")
+	return ""
+}
+
+var _ = ginkgo.Describe("Account Controller", func() {
+	const password = "correct horse battery staple"
+
+	var (
+		mockUsers         *mock.UserRepoMock
+		mockTokens        *mock.UserTokenRepoMock
+		mockCredentials   *mock.CredentialRepoMock
+		mailer            *outbox
+		accountController *controller.AccountControllerImpl
+		now               = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+		ctx               = context.Background()
+		alice             *model.User
+	)
+
+	ginkgo.BeforeEach(func() {
+		mockUsers = mock.NewUserRepoMock()
+		mockTokens = mock.NewUserTokenRepoMock()
+		mockCredentials = mock.NewCredentialRepoMock()
+		mailer = &outbox{}
+
+		hasher := auth.NewArgon2idHasher(auth.Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+		passwords := controller.NewAuthController(mockUsers, mockCredentials, nil, logging.Discard(), controller.WithHasher(hasher))
+		accountController = controller.NewAccountController(mockUsers, mockTokens, passwords, mailer, "https://app.example.com/", logging.Discard(),
+			controller.WithAccountClock(func() time.Time { return now }))
+
+		alice = &model.User{UserID: 1, TenantID: model.DefaultTenantID, UserName: "alice", FirstName: "Alice", Email: "alice@email.com", UserStatus: model.Active}
+		mockUsers.On("GetById", 1).Return(alice, nil)
+		mockUsers.On("GetById", 9).Return((*model.User)(nil), fmt.Errorf("%w: no rows", repo.ErrNotFound))
+		mockUsers.On("GetByUsername", "alice").Return(alice, nil)
+		mockUsers.On("GetByUsername", "nobody").Return(nil, fmt.Errorf("%w: no rows", repo.ErrNotFound))
+	})
+
+	ginkgo.Describe("SendEmailVerification", func() {
+		ginkgo.It("should store the hash of the token it mails", func() {
+			var stored *model.UserToken
+			mockTokens.On("CreateUserToken", testifymock.Anything).Run(func(args testifymock.Arguments) {
+				stored = args.Get(0).(*model.UserToken)
+			}).Return(1, nil)
+
+			gomega.Expect(accountController.SendEmailVerification(ctx, 1)).Should(gomega.Succeed())
+
+			gomega.Expect(mailer.messages).Should(gomega.HaveLen(1))
+			gomega.Expect(mailer.messages[0].To).Should(gomega.Equal("alice@email.com"))
+			gomega.Expect(mailer.messages[0].Body).Should(gomega.ContainSubstring("https://app.example.com" + controller.VerifyEmailPath + "?token="))
+			token := mailer.linkToken()
+			gomega.Expect(stored.TokenHash).Should(gomega.Equal(auth.HashOpaqueToken(token)))
+			gomega.Expect(stored.TokenHash).ShouldNot(gomega.ContainSubstring(token))
+			gomega.Expect(stored.Purpose).Should(gomega.Equal(model.TokenVerifyEmail))
+			gomega.Expect(stored.Email).Should(gomega.Equal("alice@email.com"))
+			gomega.Expect(stored.ExpiresAt).Should(gomega.Equal(now.Add(48 * time.Hour)))
+		})
+
+		ginkgo.It("should refuse verified emails and missing users", func() {
+			alice.EmailVerified = true
+
+			gomega.Expect(accountController.SendEmailVerification(ctx, 1)).Should(gomega.MatchError(controller.ErrEmailAlreadyVerified))
+			gomega.Expect(accountController.SendEmailVerification(ctx, 9)).Should(gomega.MatchError(controller.ErrUserNotFound))
+			gomega.Expect(mailer.messages).Should(gomega.BeEmpty())
+		})
+
+		ginkgo.It("should fail when the mail is not sent", func() {
+			mockTokens.On("CreateUserToken", testifymock.Anything).Return(1, nil)
+			mailer.err = errors.New("connection refused")
+
+			gomega.Expect(accountController.SendEmailVerification(ctx, 1)).Should(gomega.MatchError(mailer.err))
+		})
+	})
+
+	ginkgo.Describe("VerifyEmail", func() {
+		ginkgo.It("should verify the email the token was sent to", func() {
+			mockTokens.On("ConsumeUserToken", model.TokenVerifyEmail, auth.HashOpaqueToken("token")).Return(&model.UserToken{UserID: 1, Email: "alice@email.com"}, nil)
+			mockTokens.On("MarkEmailVerified", 1, "alice@email.com").Return(true, nil)
+
+			gomega.Expect(accountController.VerifyEmail(ctx, "token")).Should(gomega.Succeed())
+			mockTokens.AssertExpectations(ginkgo.GinkgoT())
+		})
+
+		ginkgo.It("should refuse unknown tokens and tokens sent to a former email", func() {
+			mockTokens.On("ConsumeUserToken", model.TokenVerifyEmail, auth.HashOpaqueToken("unknown")).Return(nil, fmt.Errorf("%w: no rows", repo.ErrUserTokenNotFound))
+			mockTokens.On("ConsumeUserToken", model.TokenVerifyEmail, auth.HashOpaqueToken("former")).Return(&model.UserToken{UserID: 1, Email: "alice@former.com"}, nil)
+			mockTokens.On("MarkEmailVerified", 1, "alice@former.com").Return(false, nil)
+
+			gomega.Expect(accountController.VerifyEmail(ctx, "unknown")).Should(gomega.MatchError(controller.ErrInvalidAccountToken))
+			gomega.Expect(accountController.VerifyEmail(ctx, "former")).Should(gomega.MatchError(controller.ErrInvalidAccountToken))
+		})
+	})
+
+	ginkgo.Describe("Password reset", func() {
+		ginkgo.It("should mail a reset link to active users only", func() {
+			mockTokens.On("CreateUserToken", testifymock.MatchedBy(func(t *model.UserToken) bool {
+				return t.Purpose == model.TokenResetPassword && t.ExpiresAt.Equal(now.Add(time.Hour))
+			})).Return(1, nil)
+
+			gomega.Expect(accountController.RequestPasswordReset(ctx, " alice ")).Should(gomega.Succeed())
+			gomega.Expect(mailer.messages).Should(gomega.HaveLen(1))
+			gomega.Expect(mailer.messages[0].Body).Should(gomega.ContainSubstring(controller.ResetPasswordPath + "?token="))
+
+			gomega.Expect(accountController.RequestPasswordReset(ctx, "nobody")).Should(gomega.Succeed())
+			alice.UserStatus = model.Terminated
+			gomega.Expect(accountController.RequestPasswordReset(ctx, "alice")).Should(gomega.Succeed())
+			gomega.Expect(mailer.messages).Should(gomega.HaveLen(1))
+		})
+
+		ginkgo.It("should set the password of the user the token was sent to", func() {
+			mockTokens.On("ConsumeUserToken", model.TokenResetPassword, auth.HashOpaqueToken("token")).Return(&model.UserToken{UserID: 1, Email: "alice@email.com"}, nil)
+			mockTokens.On("MarkEmailVerified", 1, "alice@email.com").Return(true, nil)
+			mockCredentials.On("SetPassword", 1, testifymock.AnythingOfType("string")).Return(nil)
+
+			gomega.Expect(accountController.ResetPassword(ctx, "token", password)).Should(gomega.Succeed())
+			mockCredentials.AssertExpectations(ginkgo.GinkgoT())
+
+			err := accountController.ResetPassword(ctx, "token", "short")
+			var verr *controller.ValidationError
+			gomega.Expect(errors.As(err, &verr)).Should(gomega.BeTrue(), "got %v", err)
+			mockCredentials.AssertNumberOfCalls(ginkgo.GinkgoT(), "SetPassword", 1)
+		})
+	})
+})
+
+// stubUsers keeps a single user for the decorator to look up
+type stubUsers struct {
+	controller.UserController
+	user *model.User
+}
+
+func (s *stubUsers) CreateUser(ctx context.Context, userName, firstName, lastName, email, userStatus, department string, managerID int, attributes model.Attributes) (int, error) {
+	s.user = &model.User{UserID: 1, UserName: userName, Email: email}
+	return 1, nil
+}
+
+func (s *stubUsers) GetUser(ctx context.Context, user_id int) (*model.User, error) {
+	u := *s.user
+	return &u, nil
+}
+
+func (s *stubUsers) UpdateUser(ctx context.Context, user_id int, userName, firstName, lastName, email, userStatus, department string, managerID *int, attributes model.Attributes) (int, error) {
+	s.user.Email = email
+	return user_id, nil
+}
+
+// RunInTx runs fn straight away, a failing fn stands for a rolled back
+// transaction
+func (s *stubUsers) RunInTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+// stubAccounts records the users sent a verification link
+type stubAccounts struct {
+	controller.AccountController
+	sent []int
+}
+
+func (s *stubAccounts) SendEmailVerification(ctx context.Context, user_id int) error {
+	s.sent = append(s.sent, user_id)
+	return errors.New("mail server down")
+}
+
+var _ = ginkgo.Describe("WithEmailVerification", func() {
+	ginkgo.It("should send a link to new users and new emails", func() {
+		accounts := &stubAccounts{}
+		c := controller.Chain(&stubUsers{}, controller.WithEmailVerification(accounts, logging.Discard()))
+		ctx := context.Background()
+
+		_, err := c.CreateUser(ctx, "alice", "Alice", "Doe", "alice@email.com", model.Active, "", 0, nil)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred(), "a failed mail does not fail the write")
+		gomega.Expect(accounts.sent).Should(gomega.Equal([]int{1}))
+
+		_, err = c.UpdateUser(ctx, 1, "alice", "Alicia", "Doe", "alice@email.com", model.Active, "", new(int), nil)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(accounts.sent).Should(gomega.Equal([]int{1}))
+
+		_, err = c.UpdateUser(ctx, 1, "alice", "Alicia", "Doe", "alicia@email.com", model.Active, "", new(int), nil)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(accounts.sent).Should(gomega.Equal([]int{1, 1}))
+	})
+
+	ginkgo.It("should only send the links of a transaction once it commits", func() {
+		accounts := &stubAccounts{}
+		c := controller.Chain(&stubUsers{}, controller.WithEmailVerification(accounts, logging.Discard()))
+		ctx := context.Background()
+
+		err := c.RunInTx(ctx, func(ctx context.Context) error {
+			if _, err := c.CreateUser(ctx, "alice", "Alice", "Doe", "alice@email.com", model.Active, "", 0, nil); err != nil {
+				return err
+			}
+			return errors.New("rolled back")
+		})
+		gomega.Expect(err).Should(gomega.MatchError("rolled back"))
+		gomega.Expect(accounts.sent).Should(gomega.BeEmpty())
+
+		err = c.RunInTx(ctx, func(ctx context.Context) error {
+			if _, err := c.CreateUser(ctx, "alice", "Alice", "Doe", "alice@email.com", model.Active, "", 0, nil); err != nil {
+				return err
+			}
+			_, err := c.UpdateUser(ctx, 1, "alice", "Alice", "Doe", "alicia@email.com", model.Active, "", new(int), nil)
+			gomega.Expect(accounts.sent).Should(gomega.BeEmpty(), "nothing is sent before the commit")
+			return err
+		})
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(accounts.sent).Should(gomega.Equal([]int{1}), "a user is mailed once per transaction")
+	})
+})
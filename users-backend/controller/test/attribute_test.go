@@ -0,0 +1,189 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"users-backend/controller"
+	"users-backend/logging"
+	"users-backend/model"
+	"users-backend/repo"
+	"users-backend/repo/mock"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	testifymock "github.com/stretchr/testify/mock"
+)
+
+var _ = ginkgo.Describe("Attribute Controller", func() {
+	var (
+		mockRepo            *mock.AttributeRepoMock
+		attributeController *controller.AttributeControllerImpl
+		ctx                 = context.Background()
+	)
+
+	ginkgo.BeforeEach(func() {
+		mockRepo = mock.NewAttributeRepoMock()
+		attributeController = controller.NewAttributeController(mockRepo, logging.Discard())
+	})
+
+	ginkgo.It("should normalize the definition before creating it", func() {
+		mockRepo.On("CreateAttribute", &model.AttributeDefinition{Name: "location", Type: model.AttributeEnum, Required: true, EnumValues: []string{"Paris", "Berlin"}}).Return(3, nil)
+
+		id, err := attributeController.CreateAttribute(ctx, " location ", "Enum", true, false, []string{" Paris", "Berlin "})
+
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(id).Should(gomega.Equal(3))
+	})
+
+	ginkgo.It("should reject invalid names, types and enum values", func() {
+		for _, tc := range []struct {
+			name       string
+			attrType   model.AttributeType
+			enumValues []string
+			field      string
+		}{
+			{"Location", model.AttributeString, nil, "name"},
+			{"1st", model.AttributeString, nil, "name"},
+			{fmt.Sprintf("a%063d", 0), model.AttributeString, nil, "name"},
+			{"location", "boolean", nil, "type"},
+			{"location", model.AttributeEnum, nil, "enum_values"},
+			{"location", model.AttributeEnum, []string{"Paris", "Paris"}, "enum_values"},
+			{"location", model.AttributeString, []string{"Paris"}, "enum_values"},
+		} {
+			_, err := attributeController.CreateAttribute(ctx, tc.name, tc.attrType, false, false, tc.enumValues)
+
+			var verr *controller.ValidationError
+			gomega.Expect(errors.As(err, &verr)).Should(gomega.BeTrue(), tc.name)
+			gomega.Expect(verr.Fields[0].Field).Should(gomega.Equal(tc.field), tc.name)
+			gomega.Expect(verr.Error()).Should(gomega.HavePrefix("invalid attribute: "))
+		}
+		mockRepo.AssertNotCalled(ginkgo.GinkgoT(), "CreateAttribute")
+	})
+
+	ginkgo.It("should map the repo errors", func() {
+		mockRepo.On("CreateAttribute", testifymock.Anything).Return(-1, fmt.Errorf("%w: duplicate key", repo.ErrDuplicateAttribute))
+		mockRepo.On("GetAttribute", 42).Return(nil, fmt.Errorf("%w: no rows", repo.ErrAttributeNotFound))
+
+		_, err := attributeController.CreateAttribute(ctx, "location", model.AttributeString, false, false, nil)
+		gomega.Expect(err).Should(gomega.MatchError(controller.ErrAttributeAlreadyExists))
+		_, err = attributeController.GetAttribute(ctx, 42)
+		gomega.Expect(err).Should(gomega.MatchError(controller.ErrAttributeNotFound))
+	})
+})
+
+var _ = ginkgo.Describe("User attributes", func() {
+	var (
+		mockRepo       *mock.UserRepoMock
+		mockAttributes *mock.AttributeRepoMock
+		userController *controller.UserControllerImpl
+		ctx            = context.Background()
+	)
+
+	definitions := []model.AttributeDefinition{
+		{AttributeID: 1, Name: "employee_number", Type: model.AttributeNumber, Unique: true},
+		{AttributeID: 2, Name: "hired_on", Type: model.AttributeDate},
+		{AttributeID: 3, Name: "location", Type: model.AttributeEnum, Required: true, EnumValues: []string{"Paris", "Berlin"}},
+		{AttributeID: 4, Name: "phone", Type: model.AttributeString},
+	}
+
+	fieldErrors := func(err error) map[string]string {
+		var verr *controller.ValidationError
+		gomega.Expect(errors.As(err, &verr)).Should(gomega.BeTrue())
+
+		rules := map[string]string{}
+		for _, f := range verr.Fields {
+			rules[f.Field] = f.Rule
+		}
+		return rules
+	}
+
+	ginkgo.BeforeEach(func() {
+		mockRepo = mock.NewUserRepoMock()
+		mockRepo.On("LockAttribute", "employee_number").Return(nil)
+		mockAttributes = mock.NewAttributeRepoMock()
+		mockAttributes.On("GetAttributes").Return(&definitions, nil)
+		userController = controller.NewUserController(mockRepo, logging.Discard(), controller.WithAttributes(mockAttributes))
+	})
+
+	ginkgo.It("should parse the values by type before storing them", func() {
+		mockRepo.On("GetByUsername", "johndoe").Return(nil, errors.New("no rows"))
+		mockRepo.On("FindByAttributes", model.Attributes{"employee_number": float64(42)}).Return(&[]model.User{}, nil)
+		mockRepo.On("Create", &model.User{
+			UserName: "johndoe", FirstName: "John", LastName: "Doe", Email: "johndoe@email.com", UserStatus: "A",
+			Attributes: model.Attributes{"employee_number": float64(42), "hired_on": "2024-02-29", "location": "Paris"},
+		}).Return(1, nil)
+
+		id, err := userController.CreateUser(ctx, "johndoe", "John", "Doe", "johndoe@email.com", "A", "", 0, model.Attributes{
+			"employee_number": "42", "hired_on": "2024-02-29", "location": " Paris ", "phone": "",
+		})
+
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(id).Should(gomega.Equal(1))
+	})
+
+	ginkgo.It("should report every rejected attribute with the user fields", func() {
+		_, err := userController.CreateUser(ctx, "johndoe", "", "Doe", "johndoe@email.com", "A", "", 0, model.Attributes{
+			"employee_number": "forty-two", "hired_on": "2023-02-29", "phone": float64(1), "badge": "x",
+		})
+
+		gomega.Expect(fieldErrors(err)).Should(gomega.Equal(map[string]string{
+			"first_name":                 "required",
+			"attributes.badge":           "unknown",
+			"attributes.employee_number": "type",
+			"attributes.hired_on":        "date",
+			"attributes.location":        "required",
+			"attributes.phone":           "type",
+		}))
+		mockRepo.AssertNotCalled(ginkgo.GinkgoT(), "Create", testifymock.Anything)
+	})
+
+	ginkgo.It("should reject values outside the enum and taken unique values", func() {
+		mockRepo.On("FindByAttributes", model.Attributes{"employee_number": float64(42)}).Return(&[]model.User{{UserID: 7}}, nil)
+
+		_, err := userController.CreateUser(ctx, "johndoe", "John", "Doe", "johndoe@email.com", "A", "", 0, model.Attributes{"location": "Rome"})
+		gomega.Expect(fieldErrors(err)).Should(gomega.Equal(map[string]string{"attributes.location": "enum"}))
+
+		_, err = userController.CreateUser(ctx, "johndoe", "John", "Doe", "johndoe@email.com", "A", "", 0, model.Attributes{"location": "Paris", "employee_number": float64(42)})
+		gomega.Expect(fieldErrors(err)).Should(gomega.Equal(map[string]string{"attributes.employee_number": "unique"}))
+
+		// The value is looked up once the attribute is locked
+		methods := []string{}
+		for _, call := range mockRepo.Calls {
+			methods = append(methods, call.Method)
+		}
+		gomega.Expect(methods).Should(gomega.Equal([]string{"LockAttribute", "FindByAttributes"}))
+	})
+
+	ginkgo.It("should let a user keep its own unique value and its attributes when none are given", func() {
+		mockRepo.On("GetByUsername", "johndoe").Return(&model.User{UserID: 7, UserName: "johndoe"}, nil)
+		mockRepo.On("FindByAttributes", model.Attributes{"employee_number": float64(42)}).Return(&[]model.User{{UserID: 7}}, nil)
+		mockRepo.On("Update", testifymock.Anything).Return(7, nil)
+
+		_, err := userController.UpdateUser(ctx, 7, "johndoe", "John", "Doe", "johndoe@email.com", "A", "", new(int), model.Attributes{"location": "Paris", "employee_number": float64(42)})
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+		_, err = userController.UpdateUser(ctx, 7, "johndoe", "John", "Doe", "johndoe@email.com", "A", "", new(int), nil)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(mockRepo.Calls[len(mockRepo.Calls)-1].Arguments.Get(0).(*model.User).Attributes).Should(gomega.BeNil())
+	})
+
+	ginkgo.It("should reject attributes when none are defined", func() {
+		userController = controller.NewUserController(mockRepo, logging.Discard())
+
+		_, err := userController.CreateUser(ctx, "johndoe", "John", "Doe", "johndoe@email.com", "A", "", 0, model.Attributes{"location": "Paris"})
+		gomega.Expect(fieldErrors(err)).Should(gomega.Equal(map[string]string{"attributes.location": "unknown"}))
+	})
+
+	ginkgo.It("should filter users by parsed attribute values", func() {
+		users := []model.User{{UserID: 7}}
+		mockRepo.On("FindByAttributes", model.Attributes{"employee_number": float64(42), "location": "Paris"}).Return(&users, nil)
+
+		found, err := userController.GetUsersByAttributes(ctx, map[string]string{"employee_number": "42", "location": "Paris"})
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(*found).Should(gomega.Equal(users))
+
+		_, err = userController.GetUsersByAttributes(ctx, map[string]string{"badge": "x", "hired_on": "yesterday"})
+		gomega.Expect(fieldErrors(err)).Should(gomega.Equal(map[string]string{"attributes.badge": "unknown", "attributes.hired_on": "date"}))
+	})
+})
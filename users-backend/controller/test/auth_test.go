@@ -0,0 +1,221 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"users-backend/auth"
+	"users-backend/controller"
+	"users-backend/logging"
+	"users-backend/model"
+	"users-backend/repo"
+	"users-backend/repo/mock"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	testifymock "github.com/stretchr/testify/mock"
+)
+
+var _ = ginkgo.Describe("Auth Controller", func() {
+	const password = "correct horse battery staple"
+
+	var (
+		mockUsers       *mock.UserRepoMock
+		mockCredentials *mock.CredentialRepoMock
+		tokens          *auth.TokenSigner
+		hasher          = auth.NewArgon2idHasher(auth.Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+		authController  *controller.AuthControllerImpl
+		now             = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+		ctx             = context.Background()
+		alice           *model.User
+	)
+
+	credential := func(failures int, lockedUntil time.Time) *model.Credential {
+		hash, err := hasher.Hash(password)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		return &model.Credential{UserID: 1, TenantID: model.DefaultTenantID, PasswordHash: hash, FailedAttempts: failures, LockedUntil: lockedUntil}
+	}
+
+	ginkgo.BeforeEach(func() {
+		var err error
+		tokens, err = auth.NewTokenSigner([]byte(strings.Repeat("s", auth.MinSecretLength)), time.Hour)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+		mockUsers = mock.NewUserRepoMock()
+		mockCredentials = mock.NewCredentialRepoMock()
+		authController = controller.NewAuthController(mockUsers, mockCredentials, tokens, logging.Discard(),
+			controller.WithHasher(hasher),
+			controller.WithLockout(controller.LockoutPolicy{MaxFailures: 3, Duration: 10 * time.Minute}),
+			controller.WithClock(func() time.Time { return now }),
+		)
+
+		alice = &model.User{UserID: 1, TenantID: model.DefaultTenantID, UserName: "alice", Email: "alice.doe@email.com", UserStatus: model.Active}
+		mockUsers.On("GetByUsername", "alice").Return(alice, nil)
+		mockUsers.On("GetByUsername", "nobody").Return(nil, fmt.Errorf("%w: no rows", repo.ErrNotFound))
+		mockUsers.On("GetById", 1).Return(alice, nil)
+		mockUsers.On("GetById", 9).Return((*model.User)(nil), fmt.Errorf("%w: no rows", repo.ErrNotFound))
+	})
+
+	ginkgo.Describe("Login", func() {
+		ginkgo.It("should sign a token for the right password", func() {
+			mockCredentials.On("GetCredential", 1).Return(credential(0, time.Time{}), nil)
+
+			token, err := authController.Login(ctx, " alice ", password, "")
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(token.ExpiresAt).Should(gomega.Equal(now.Add(time.Hour)))
+			mockCredentials.AssertNotCalled(ginkgo.GinkgoT(), "RecordLoginSuccess", testifymock.Anything)
+			mockCredentials.AssertNotCalled(ginkgo.GinkgoT(), "SetPassword", testifymock.Anything, testifymock.Anything)
+		})
+
+		ginkgo.It("should clear the failed logins and rehash outdated hashes", func() {
+			bcrypt, err := auth.NewBcryptHasher(4)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			hash, err := bcrypt.Hash(password)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			mockCredentials.On("GetCredential", 1).Return(&model.Credential{UserID: 1, PasswordHash: hash, FailedAttempts: 2}, nil)
+			mockCredentials.On("RecordLoginSuccess", 1).Return(nil)
+			mockCredentials.On("SetPassword", 1, testifymock.MatchedBy(func(h string) bool { return strings.HasPrefix(h, "$argon2id$") })).Return(nil)
+
+			_, err = authController.Login(ctx, "alice", password, "")
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			mockCredentials.AssertExpectations(ginkgo.GinkgoT())
+		})
+
+		ginkgo.It("should reject unknown users and users without password alike", func() {
+			mockUsers.On("GetByUsername", "bob").Return(&model.User{UserID: 2, UserName: "bob", UserStatus: model.Active}, nil)
+			mockCredentials.On("GetCredential", 2).Return(nil, fmt.Errorf("%w: no rows", repo.ErrCredentialNotFound))
+
+			_, err := authController.Login(ctx, "nobody", password, "")
+			gomega.Expect(err).Should(gomega.MatchError(controller.ErrInvalidCredentials))
+			_, err = authController.Login(ctx, "bob", password, "")
+			gomega.Expect(err).Should(gomega.MatchError(controller.ErrInvalidCredentials))
+		})
+
+		ginkgo.It("should count wrong passwords and lock the account at the limit", func() {
+			mockCredentials.On("GetCredential", 1).Return(credential(1, time.Time{}), nil)
+			mockCredentials.On("RecordLoginFailure", 1).Return(2, nil).Once()
+
+			_, err := authController.Login(ctx, "alice", "wrong password", "")
+			gomega.Expect(err).Should(gomega.MatchError(controller.ErrInvalidCredentials))
+
+			mockCredentials.On("RecordLoginFailure", 1).Return(3, nil).Once()
+			mockCredentials.On("LockCredential", 1, now.Add(10*time.Minute)).Return(nil)
+
+			_, err = authController.Login(ctx, "alice", "wrong password", "")
+			var locked *controller.LockedError
+			gomega.Expect(errors.As(err, &locked)).Should(gomega.BeTrue(), "got %v", err)
+			gomega.Expect(locked.Until).Should(gomega.Equal(now.Add(10 * time.Minute)))
+			gomega.Expect(errors.Is(err, controller.ErrAccountLocked)).Should(gomega.BeTrue())
+			mockCredentials.AssertExpectations(ginkgo.GinkgoT())
+		})
+
+		ginkgo.It("should refuse a locked account even with the right password", func() {
+			mockCredentials.On("GetCredential", 1).Return(credential(0, now.Add(time.Minute)), nil)
+
+			_, err := authController.Login(ctx, "alice", password, "")
+
+			gomega.Expect(errors.Is(err, controller.ErrAccountLocked)).Should(gomega.BeTrue(), "got %v", err)
+			mockCredentials.AssertNotCalled(ginkgo.GinkgoT(), "RecordLoginFailure", testifymock.Anything)
+		})
+
+		ginkgo.It("should let the account in again once the lockout is over", func() {
+			mockCredentials.On("GetCredential", 1).Return(credential(0, now.Add(-time.Minute)), nil)
+			mockCredentials.On("RecordLoginSuccess", 1).Return(nil)
+
+			_, err := authController.Login(ctx, "alice", password, "")
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			mockCredentials.AssertExpectations(ginkgo.GinkgoT())
+		})
+
+		ginkgo.It("should refuse inactive and terminated users", func() {
+			mockCredentials.On("GetCredential", 1).Return(credential(0, time.Time{}), nil)
+
+			for _, status := range []string{model.Inactive, model.Terminated} {
+				alice.UserStatus = status
+				_, err := authController.Login(ctx, "alice", password, "")
+				gomega.Expect(err).Should(gomega.MatchError(controller.ErrAccountDisabled), status)
+			}
+		})
+	})
+
+	ginkgo.Describe("SetPassword", func() {
+		ginkgo.It("should store a hash of the password", func() {
+			mockCredentials.On("SetPassword", 1, testifymock.MatchedBy(func(hash string) bool {
+				ok, err := hasher.Verify(hash, password)
+				return err == nil && ok
+			})).Return(nil)
+
+			gomega.Expect(authController.SetPassword(ctx, 1, password)).Should(gomega.Succeed())
+			mockCredentials.AssertExpectations(ginkgo.GinkgoT())
+		})
+
+		ginkgo.It("should enforce the password policy", func() {
+			strict := controller.NewAuthController(mockUsers, mockCredentials, tokens, logging.Discard(),
+				controller.WithHasher(hasher),
+				controller.WithPasswordPolicy(controller.PasswordPolicy{MinLength: 12, MaxLength: 72, MinClasses: 3}))
+
+			for _, tc := range []struct {
+				password, rule string
+			}{
+				{"short", "min"},
+				{strings.Repeat("long enough ", 7), "max"},
+				{"only lower case", "classes"},
+				{"Secret-Alice-2024", "personal"},
+				{"Secret-alice.doe-2024", "personal"},
+			} {
+				err := strict.SetPassword(ctx, 1, tc.password)
+
+				var verr *controller.ValidationError
+				gomega.Expect(errors.As(err, &verr)).Should(gomega.BeTrue(), "got %v", err)
+				gomega.Expect(verr.Fields).Should(gomega.HaveLen(1), tc.password)
+				gomega.Expect(verr.Fields[0].Rule).Should(gomega.Equal(tc.rule), tc.password)
+				gomega.Expect(verr.Error()).Should(gomega.HavePrefix("invalid password: password "))
+			}
+			mockCredentials.AssertNotCalled(ginkgo.GinkgoT(), "SetPassword", testifymock.Anything, testifymock.Anything)
+		})
+
+		ginkgo.It("should return ErrUserNotFound for a missing user", func() {
+			gomega.Expect(authController.SetPassword(ctx, 9, password)).Should(gomega.MatchError(controller.ErrUserNotFound))
+		})
+	})
+
+	ginkgo.Describe("ChangePassword", func() {
+		const newPassword = "a brand new passphrase"
+
+		ginkgo.It("should set the new password after checking the current one", func() {
+			mockCredentials.On("GetCredential", 1).Return(credential(0, time.Time{}), nil)
+			mockCredentials.On("SetPassword", 1, testifymock.MatchedBy(func(hash string) bool {
+				ok, err := hasher.Verify(hash, newPassword)
+				return err == nil && ok
+			})).Return(nil)
+
+			gomega.Expect(authController.ChangePassword(ctx, 1, password, newPassword)).Should(gomega.Succeed())
+			mockCredentials.AssertExpectations(ginkgo.GinkgoT())
+		})
+
+		ginkgo.It("should count a wrong current password as a failed login", func() {
+			mockCredentials.On("GetCredential", 1).Return(credential(2, time.Time{}), nil)
+			mockCredentials.On("RecordLoginFailure", 1).Return(3, nil)
+			mockCredentials.On("LockCredential", 1, now.Add(10*time.Minute)).Return(nil)
+
+			err := authController.ChangePassword(ctx, 1, "wrong password", newPassword)
+
+			gomega.Expect(err).Should(gomega.MatchError(controller.ErrAccountLocked))
+			mockCredentials.AssertNotCalled(ginkgo.GinkgoT(), "SetPassword", testifymock.Anything, testifymock.Anything)
+		})
+
+		ginkgo.It("should refuse locked accounts and users without password", func() {
+			mockCredentials.On("GetCredential", 1).Return(credential(0, now.Add(time.Minute)), nil).Once()
+			gomega.Expect(authController.ChangePassword(ctx, 1, password, newPassword)).Should(gomega.MatchError(controller.ErrAccountLocked))
+
+			mockCredentials.On("GetCredential", 1).Return(nil, fmt.Errorf("%w: no rows", repo.ErrCredentialNotFound)).Once()
+			gomega.Expect(authController.ChangePassword(ctx, 1, password, newPassword)).Should(gomega.MatchError(controller.ErrInvalidCredentials))
+			mockCredentials.AssertNotCalled(ginkgo.GinkgoT(), "SetPassword", testifymock.Anything, testifymock.Anything)
+		})
+	})
+})
@@ -1,10 +1,12 @@
 package test
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"testing"
 	"users-backend/controller"
+	"users-backend/logging"
 	"users-backend/model"
 	"users-backend/repo/mock"
 
@@ -31,7 +33,7 @@ var _ = ginkgo.Describe("User Controller", func() {
 
 	ginkgo.BeforeEach(func() {
 		mockRepo = mock.NewUserRepoMock()
-		userController = controller.NewUserController(mockRepo)
+		userController = controller.NewUserController(mockRepo, logging.Discard())
 	})
 
 	ginkgo.Describe("CreateUser / processCreateUpdateUser", func() {
@@ -39,7 +41,7 @@ var _ = ginkgo.Describe("User Controller", func() {
 			mockRepo.On("GetByUsername", "username").Return(nil, errors.New("error finding user with username"))
 			mockRepo.On("Create", &mockUser).Return(1, nil)
 
-			val, err := userController.CreateUser("username", "first", "last", "username@email.com", "A", "dept.")
+			val, err := userController.CreateUser(context.Background(), "username", "first", "last", "username@email.com", "A", "dept.", 0, nil)
 
 			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
 			gomega.Expect(val).Should(gomega.Equal(1))
@@ -48,7 +50,7 @@ var _ = ginkgo.Describe("User Controller", func() {
 		ginkgo.It("should return error when username already exists", func() {
 			mockRepo.On("GetByUsername", "username").Return(&model.User{UserName: "username"}, nil)
 
-			_, err := userController.CreateUser("username", "first", "last", "username@email.com", "A", "dept.")
+			_, err := userController.CreateUser(context.Background(), "username", "first", "last", "username@email.com", "A", "dept.", 0, nil)
 
 			gomega.Expect(err).Should(gomega.HaveOccurred())
 			gomega.Expect(err).Should(gomega.Equal(controller.ErrUserAlreadyExists))
@@ -58,7 +60,7 @@ var _ = ginkgo.Describe("User Controller", func() {
 			mockRepo.On("GetByUsername", "username").Return(nil, errors.New("error finding user with username"))
 			mockRepo.On("Create", &mockUser).Return(1, nil)
 
-			val, err := userController.CreateUser("username", "first", "last", "username@email.com", "Active", "dept.")
+			val, err := userController.CreateUser(context.Background(), "username", "first", "last", "username@email.com", "Active", "dept.", 0, nil)
 
 			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
 			gomega.Expect(val).Should(gomega.Equal(1))
@@ -71,14 +73,14 @@ var _ = ginkgo.Describe("User Controller", func() {
 			mockRepo.On("GetByUsername", "username").Return(nil, errors.New("error finding user with username"))
 			mockRepo.On("Create", &mockUserNull).Return(1, nil)
 
-			val, err := userController.CreateUser("username", "first", "last", "username@email.com", "A", "")
+			val, err := userController.CreateUser(context.Background(), "username", "first", "last", "username@email.com", "A", "", 0, nil)
 
 			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
 			gomega.Expect(val).Should(gomega.Equal(1))
 		})
 
 		ginkgo.It("should return error when bad status is given", func() {
-			_, err := userController.CreateUser("", "", "", "", "Bad Status", "")
+			_, err := userController.CreateUser(context.Background(), "", "", "", "", "Bad Status", "", 0, nil)
 
 			gomega.Expect(err).Should(gomega.HaveOccurred())
 			gomega.Expect(err).Should(gomega.Equal(controller.ErrUserStatusIncorrect))
@@ -93,7 +95,7 @@ var _ = ginkgo.Describe("User Controller", func() {
 			mockRepo.On("GetByUsername", "username").Return(nil, errors.New("error finding user with username"))
 			mockRepo.On("Update", &mockUserUpdate).Return(10, nil)
 
-			val, err := userController.UpdateUser(10, "username", "first", "last", "username@email.com", "A", "dept.")
+			val, err := userController.UpdateUser(context.Background(), 10, "username", "first", "last", "username@email.com", "A", "dept.", new(int), nil)
 
 			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
 			gomega.Expect(val).Should(gomega.Equal(10))
@@ -106,7 +108,7 @@ var _ = ginkgo.Describe("User Controller", func() {
 
 			mockRepo.On("GetAll").Return(&mockUsers, nil)
 
-			val, err := userController.GetAllUsers()
+			val, err := userController.GetAllUsers(context.Background())
 
 			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
 			gomega.Expect(val).Should(gomega.Equal(&mockUsers))
@@ -120,7 +122,7 @@ var _ = ginkgo.Describe("User Controller", func() {
 
 			mockRepo.On("GetById", mockUserId.UserID).Return(&mockUserId, nil)
 
-			val, err := userController.GetUser(mockUserId.UserID)
+			val, err := userController.GetUser(context.Background(), mockUserId.UserID)
 
 			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
 			gomega.Expect(val).Should(gomega.Equal(&mockUserId))
@@ -129,9 +131,11 @@ var _ = ginkgo.Describe("User Controller", func() {
 
 	ginkgo.Describe("GetAllUsers", func() {
 		ginkgo.It("should return users", func() {
+			mockRepo.On("GetById", mockUser.UserID).Return(&mockUser, nil)
+			mockRepo.On("ReassignReports", mockUser.UserID, 0).Return(0, nil)
 			mockRepo.On("Delete", mockUser.UserID).Return(nil)
 
-			err := userController.DeleteUser(mockUser.UserID)
+			err := userController.DeleteUser(context.Background(), mockUser.UserID)
 
 			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
 		})
@@ -0,0 +1,79 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"users-backend/controller"
+	"users-backend/logging"
+	"users-backend/model"
+	"users-backend/repo/mock"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+// recordingController records the name of each decorator a call passes through
+type recordingController struct {
+	controller.UserController
+	name  string
+	calls *[]string
+}
+
+func (r *recordingController) DeleteUser(ctx context.Context, user_id int) error {
+	*r.calls = append(*r.calls, r.name)
+	return r.UserController.DeleteUser(ctx, user_id)
+}
+
+func recording(name string, calls *[]string) controller.Decorator {
+	return func(next controller.UserController) controller.UserController {
+		return &recordingController{UserController: next, name: name, calls: calls}
+	}
+}
+
+var _ = ginkgo.Describe("Controller Decorators", func() {
+	var mockRepo *mock.UserRepoMock
+
+	ginkgo.BeforeEach(func() {
+		mockRepo = mock.NewUserRepoMock()
+	})
+
+	ginkgo.Describe("Chain", func() {
+		ginkgo.It("should call the first decorator first", func() {
+			var calls []string
+			mockRepo.On("GetById", 1).Return(&model.User{UserID: 1}, nil)
+			mockRepo.On("ReassignReports", 1, 0).Return(0, nil)
+			mockRepo.On("Delete", 1).Return(nil)
+
+			c := controller.Chain(controller.NewUserController(mockRepo, logging.Discard()), recording("outer", &calls), recording("inner", &calls))
+			err := c.DeleteUser(context.Background(), 1)
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(calls).Should(gomega.Equal([]string{"outer", "inner"}))
+			mockRepo.AssertCalled(ginkgo.GinkgoT(), "Delete", 1)
+		})
+
+		ginkgo.It("should return the controller unchanged without decorators", func() {
+			base := controller.NewUserController(mockRepo, logging.Discard())
+
+			gomega.Expect(controller.Chain(base)).Should(gomega.BeIdenticalTo(base))
+		})
+	})
+
+	ginkgo.Describe("WithAudit", func() {
+		ginkgo.It("should record the outcome of mutations", func() {
+			buf := &bytes.Buffer{}
+			mockRepo.On("GetById", 7).Return(&model.User{UserID: 7}, nil)
+			mockRepo.On("ReassignReports", 7, 0).Return(0, nil)
+			mockRepo.On("Delete", 7).Return(errors.New("no rows"))
+
+			c := controller.Chain(controller.NewUserController(mockRepo, logging.Discard()), controller.WithAudit(logging.New(buf, slog.LevelInfo)))
+			err := c.DeleteUser(context.Background(), 7)
+
+			gomega.Expect(err).Should(gomega.HaveOccurred())
+			gomega.Expect(buf.String()).Should(gomega.ContainSubstring(`"action":"delete_user"`))
+			gomega.Expect(buf.String()).Should(gomega.ContainSubstring(`"success":false`))
+		})
+	})
+})
@@ -0,0 +1,149 @@
+package test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"users-backend/controller"
+	"users-backend/logging"
+	"users-backend/model"
+	"users-backend/repo"
+	"users-backend/repo/mock"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	testifymock "github.com/stretchr/testify/mock"
+)
+
+var _ = ginkgo.Describe("Group Controller", func() {
+	var (
+		mockGroups      *mock.GroupRepoMock
+		mockUsers       *mock.UserRepoMock
+		groupController *controller.GroupControllerImpl
+		ctx             = context.Background()
+	)
+
+	fieldRules := func(err error) map[string]string {
+		var verr *controller.ValidationError
+		gomega.Expect(errors.As(err, &verr)).Should(gomega.BeTrue(), "got %v", err)
+
+		rules := map[string]string{}
+		for _, f := range verr.Fields {
+			rules[f.Field] = f.Rule
+		}
+		return rules
+	}
+
+	nestedIn := func(group_id, parent_id int) *model.Group {
+		return &model.Group{GroupID: group_id, Name: fmt.Sprintf("group%d", group_id), ParentID: sql.NullInt64{Int64: int64(parent_id), Valid: parent_id != 0}}
+	}
+
+	ginkgo.BeforeEach(func() {
+		mockGroups = mock.NewGroupRepoMock()
+		mockUsers = mock.NewUserRepoMock()
+		groupController = controller.NewGroupController(mockGroups, mockUsers, logging.Discard())
+		mockGroups.On("GetGroup", 9).Return(nil, fmt.Errorf("%w: no rows", repo.ErrGroupNotFound))
+		mockGroups.On("LockGroupHierarchy").Return(nil)
+	})
+
+	ginkgo.It("should normalize the group before creating it", func() {
+		mockGroups.On("GetGroup", 1).Return(nestedIn(1, 0), nil)
+		mockGroups.On("CreateGroup", &model.Group{Name: "Backend", Description: "APIs", ParentID: sql.NullInt64{Int64: 1, Valid: true}}).Return(2, nil)
+
+		id, err := groupController.CreateGroup(ctx, " Backend ", "APIs ", 1)
+
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(id).Should(gomega.Equal(2))
+	})
+
+	ginkgo.It("should reject invalid names and missing parents", func() {
+		_, err := groupController.CreateGroup(ctx, " ", "", 9)
+
+		gomega.Expect(fieldRules(err)).Should(gomega.Equal(map[string]string{"name": "required", "parent_id": "exists"}))
+		gomega.Expect(err.Error()).Should(gomega.HavePrefix("invalid group: "))
+		mockGroups.AssertNotCalled(ginkgo.GinkgoT(), "CreateGroup", testifymock.Anything)
+	})
+
+	ginkgo.It("should refuse to nest a group in itself or its subgroups", func() {
+		// 1 <- 2 <- 3, nesting 1 in 3 closes the loop
+		mockGroups.On("GetGroup", 3).Return(nestedIn(3, 2), nil)
+		mockGroups.On("GetGroupAncestors", 3).Return(&[]model.Group{*nestedIn(2, 1), *nestedIn(1, 0)}, nil)
+
+		_, err := groupController.UpdateGroup(ctx, 1, "group1", "", 1)
+		gomega.Expect(fieldRules(err)).Should(gomega.Equal(map[string]string{"parent_id": "cycle"}))
+
+		_, err = groupController.UpdateGroup(ctx, 1, "group1", "", 3)
+		gomega.Expect(fieldRules(err)).Should(gomega.Equal(map[string]string{"parent_id": "cycle"}))
+		mockGroups.AssertNotCalled(ginkgo.GinkgoT(), "UpdateGroup", testifymock.Anything)
+		mockGroups.AssertNumberOfCalls(ginkgo.GinkgoT(), "LockGroupHierarchy", 2)
+	})
+
+	ginkgo.It("should map the repo errors", func() {
+		mockGroups.On("CreateGroup", testifymock.Anything).Return(-1, fmt.Errorf("%w: duplicate key", repo.ErrDuplicateGroupName))
+
+		_, err := groupController.CreateGroup(ctx, "Backend", "", 0)
+		gomega.Expect(err).Should(gomega.MatchError(controller.ErrGroupAlreadyExists))
+		_, err = groupController.GetGroup(ctx, 9)
+		gomega.Expect(err).Should(gomega.MatchError(controller.ErrGroupNotFound))
+		_, err = groupController.GetGroupMembers(ctx, 9, true)
+		gomega.Expect(err).Should(gomega.MatchError(controller.ErrGroupNotFound))
+		_, err = groupController.AddGroupMembers(ctx, 9, []int{1})
+		gomega.Expect(err).Should(gomega.MatchError(controller.ErrGroupNotFound))
+	})
+
+	ginkgo.Describe("members", func() {
+		ginkgo.BeforeEach(func() {
+			mockGroups.On("GetGroup", 1).Return(nestedIn(1, 0), nil)
+			mockUsers.On("GetById", 1).Return(&model.User{UserID: 1}, nil)
+			mockUsers.On("GetById", 2).Return(&model.User{UserID: 2}, nil)
+			mockUsers.On("GetById", 42).Return((*model.User)(nil), fmt.Errorf("%w: no rows", repo.ErrNotFound))
+		})
+
+		ginkgo.It("should add each user once", func() {
+			mockGroups.On("AddGroupMembers", 1, []int{1, 2}).Return(1, nil)
+
+			n, err := groupController.AddGroupMembers(ctx, 1, []int{1, 2, 1})
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(n).Should(gomega.Equal(1))
+		})
+
+		ginkgo.It("should report every missing user and add none", func() {
+			mockUsers.On("GetById", 43).Return((*model.User)(nil), fmt.Errorf("%w: no rows", repo.ErrNotFound))
+
+			_, err := groupController.AddGroupMembers(ctx, 1, []int{1, 42, 2, 43})
+
+			gomega.Expect(fieldRules(err)).Should(gomega.Equal(map[string]string{"user_ids[1]": "exists", "user_ids[3]": "exists"}))
+			mockGroups.AssertNotCalled(ginkgo.GinkgoT(), "AddGroupMembers", testifymock.Anything, testifymock.Anything)
+		})
+
+		ginkgo.It("should bound the number of users of a request", func() {
+			_, err := groupController.AddGroupMembers(ctx, 1, nil)
+			gomega.Expect(fieldRules(err)).Should(gomega.Equal(map[string]string{"user_ids": "required"}))
+
+			_, err = groupController.RemoveGroupMembers(ctx, 1, make([]int, 101))
+			gomega.Expect(fieldRules(err)).Should(gomega.Equal(map[string]string{"user_ids": "max"}))
+		})
+
+		ginkgo.It("should remove users without looking them up", func() {
+			mockGroups.On("RemoveGroupMembers", 1, []int{42}).Return(0, nil)
+
+			n, err := groupController.RemoveGroupMembers(ctx, 1, []int{42})
+
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(n).Should(gomega.BeZero())
+		})
+
+		ginkgo.It("should report a missing user instead of no groups", func() {
+			mockGroups.On("GetUserGroups", 1, true).Return(&[]model.Group{*nestedIn(1, 0)}, nil)
+
+			_, err := groupController.GetUserGroups(ctx, 42, true)
+			gomega.Expect(errors.Is(err, repo.ErrNotFound)).Should(gomega.BeTrue())
+
+			groups, err := groupController.GetUserGroups(ctx, 1, true)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(*groups).Should(gomega.HaveLen(1))
+		})
+	})
+})
@@ -0,0 +1,149 @@
+package test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"users-backend/controller"
+	"users-backend/logging"
+	"users-backend/model"
+	"users-backend/repo"
+	"users-backend/repo/mock"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	testifymock "github.com/stretchr/testify/mock"
+)
+
+var _ = ginkgo.Describe("User managers", func() {
+	var (
+		mockRepo       *mock.UserRepoMock
+		userController *controller.UserControllerImpl
+		ctx            = context.Background()
+	)
+
+	managerRule := func(err error) string {
+		var verr *controller.ValidationError
+		gomega.Expect(errors.As(err, &verr)).Should(gomega.BeTrue(), "got %v", err)
+		for _, f := range verr.Fields {
+			if f.Field == "manager_id" {
+				return f.Rule
+			}
+		}
+		return ""
+	}
+
+	manager := func(id int) *int {
+		return &id
+	}
+
+	managedBy := func(user_id, manager_id int) *model.User {
+		return &model.User{UserID: user_id, UserName: fmt.Sprintf("user%d", user_id), UserStatus: model.Active, ManagerID: sql.NullInt64{Int64: int64(manager_id), Valid: manager_id != 0}}
+	}
+
+	ginkgo.BeforeEach(func() {
+		mockRepo = mock.NewUserRepoMock()
+		userController = controller.NewUserController(mockRepo, logging.Discard())
+		mockRepo.On("GetByUsername", testifymock.Anything).Return(nil, fmt.Errorf("%w: no rows", repo.ErrNotFound))
+		mockRepo.On("LockHierarchy").Return(nil)
+	})
+
+	ginkgo.It("should store the manager of a new user", func() {
+		mockRepo.On("GetById", 1).Return(managedBy(1, 0), nil)
+		mockRepo.On("Create", testifymock.MatchedBy(func(u *model.User) bool {
+			return u.ManagerID == sql.NullInt64{Int64: 1, Valid: true}
+		})).Return(2, nil)
+
+		id, err := userController.CreateUser(ctx, "johndoe", "John", "Doe", "johndoe@email.com", "A", "", 1, nil)
+
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(id).Should(gomega.Equal(2))
+	})
+
+	ginkgo.It("should reject missing and terminated managers", func() {
+		mockRepo.On("GetById", 9).Return((*model.User)(nil), fmt.Errorf("%w: no rows", repo.ErrNotFound))
+		terminated := managedBy(4, 0)
+		terminated.UserStatus = model.Terminated
+		mockRepo.On("GetById", 4).Return(terminated, nil)
+
+		_, err := userController.CreateUser(ctx, "johndoe", "John", "Doe", "johndoe@email.com", "A", "", 9, nil)
+		gomega.Expect(managerRule(err)).Should(gomega.Equal("exists"))
+
+		_, err = userController.CreateUser(ctx, "johndoe", "John", "Doe", "johndoe@email.com", "A", "", 4, nil)
+		gomega.Expect(managerRule(err)).Should(gomega.Equal("active"))
+		mockRepo.AssertNotCalled(ginkgo.GinkgoT(), "Create", testifymock.Anything)
+	})
+
+	ginkgo.It("should refuse to create a cycle", func() {
+		// 1 <- 2 <- 3, making 3 the manager of 1 closes the loop
+		mockRepo.On("GetById", 3).Return(managedBy(3, 2), nil)
+		mockRepo.On("GetManagementChain", 3).Return(&[]model.User{*managedBy(2, 1), *managedBy(1, 0)}, nil)
+
+		_, err := userController.UpdateUser(ctx, 1, "user1", "John", "Doe", "johndoe@email.com", "A", "", manager(1), nil)
+		gomega.Expect(managerRule(err)).Should(gomega.Equal("cycle"))
+
+		_, err = userController.UpdateUser(ctx, 1, "user1", "John", "Doe", "johndoe@email.com", "A", "", manager(3), nil)
+		gomega.Expect(managerRule(err)).Should(gomega.Equal("cycle"))
+		mockRepo.AssertNotCalled(ginkgo.GinkgoT(), "Update", testifymock.Anything)
+	})
+
+	ginkgo.It("should check for a cycle once the hierarchy is locked", func() {
+		mockRepo.On("GetById", 3).Return(managedBy(3, 0), nil)
+		mockRepo.On("GetManagementChain", 3).Return(&[]model.User{}, nil)
+		mockRepo.On("Update", testifymock.Anything).Return(1, nil)
+
+		_, err := userController.UpdateUser(ctx, 1, "user1", "John", "Doe", "johndoe@email.com", "A", "", manager(3), nil)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+		methods := []string{}
+		for _, call := range mockRepo.Calls {
+			methods = append(methods, call.Method)
+		}
+		gomega.Expect(methods).Should(gomega.Equal([]string{"LockHierarchy", "GetById", "GetManagementChain", "GetByUsername", "Update"}))
+	})
+
+	ginkgo.It("should move the reports of a terminated user to its manager", func() {
+		mockRepo.On("GetById", 1).Return(managedBy(1, 0), nil)
+		mockRepo.On("GetManagementChain", 1).Return(&[]model.User{}, nil)
+		mockRepo.On("Update", testifymock.Anything).Return(2, nil)
+		mockRepo.On("ReassignReports", 2, 1).Return(3, nil)
+
+		_, err := userController.UpdateUser(ctx, 2, "user2", "John", "Doe", "johndoe@email.com", "T", "", manager(1), nil)
+
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		mockRepo.AssertCalled(ginkgo.GinkgoT(), "ReassignReports", 2, 1)
+	})
+
+	ginkgo.It("should keep the reports of users that stay active", func() {
+		mockRepo.On("Update", testifymock.Anything).Return(2, nil)
+
+		_, err := userController.UpdateUser(ctx, 2, "user2", "John", "Doe", "johndoe@email.com", "I", "", new(int), nil)
+
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		mockRepo.AssertNotCalled(ginkgo.GinkgoT(), "ReassignReports", testifymock.Anything, testifymock.Anything)
+		mockRepo.AssertNotCalled(ginkgo.GinkgoT(), "LockHierarchy")
+	})
+
+	ginkgo.It("should move the reports of a deleted user to its manager", func() {
+		mockRepo.On("GetById", 2).Return(managedBy(2, 1), nil)
+		mockRepo.On("ReassignReports", 2, 1).Return(1, nil)
+		mockRepo.On("Delete", 2).Return(nil)
+
+		gomega.Expect(userController.DeleteUser(ctx, 2)).Should(gomega.Succeed())
+		mockRepo.AssertCalled(ginkgo.GinkgoT(), "ReassignReports", 2, 1)
+	})
+
+	ginkgo.It("should report a missing user instead of an empty hierarchy", func() {
+		mockRepo.On("GetById", 9).Return((*model.User)(nil), fmt.Errorf("%w: no rows", repo.ErrNotFound))
+		mockRepo.On("GetById", 1).Return(managedBy(1, 0), nil)
+		mockRepo.On("GetSubordinates", 1).Return(&[]model.User{*managedBy(2, 1), *managedBy(3, 2)}, nil)
+
+		_, err := userController.GetSubordinates(ctx, 9)
+		gomega.Expect(errors.Is(err, repo.ErrNotFound)).Should(gomega.BeTrue())
+
+		users, err := userController.GetSubordinates(ctx, 1)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(*users).Should(gomega.HaveLen(2))
+	})
+})
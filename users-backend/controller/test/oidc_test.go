@@ -0,0 +1,331 @@
+package test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"users-backend/auth"
+	"users-backend/controller"
+	"users-backend/logging"
+	"users-backend/model"
+	"users-backend/repo"
+	"users-backend/repo/mock"
+	"users-backend/tenant"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	testifymock "github.com/stretchr/testify/mock"
+)
+
+var _ = ginkgo.Describe("OpenID Connect", func() {
+	const (
+		password = "correct horse battery staple"
+		issuer   = "https://users.example.com"
+		verifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+		secret   = "the client secret"
+	)
+
+	var (
+		key             *rsa.PrivateKey
+		mockUsers       *mock.UserRepoMock
+		mockCredentials *mock.CredentialRepoMock
+		mockClients     *mock.ClientRepoMock
+		mockCodes       *mock.AuthorizationCodeRepoMock
+		hasher          = auth.NewArgon2idHasher(auth.Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+		authController  *controller.AuthControllerImpl
+		now             = time.Now().UTC().Truncate(time.Second)
+		ctx             = tenant.WithID(context.Background(), model.DefaultTenantID)
+		client          *model.OAuthClient
+		alice           *model.User
+	)
+
+	request := func() *controller.AuthorizationRequest {
+		return &controller.AuthorizationRequest{
+			ResponseType:        "code",
+			ClientID:            client.ClientID,
+			RedirectURI:         "https://app.example.com/callback",
+			Scope:               "email openid offline_access profile",
+			State:               "xyz",
+			Nonce:               "n-0S6_WzA2Mj",
+			CodeChallenge:       auth.PKCEChallenge(verifier),
+			CodeChallengeMethod: "S256",
+		}
+	}
+
+	// authorize returns a code issued to alice for req and the code stored
+	authorize := func(req *controller.AuthorizationRequest) (string, *model.AuthorizationCode) {
+		var stored *model.AuthorizationCode
+		mockCodes.On("CreateAuthorizationCode", testifymock.Anything).Run(func(args testifymock.Arguments) {
+			stored = args.Get(0).(*model.AuthorizationCode)
+		}).Return(nil).Once()
+
+		code, err := authController.Authorize(ctx, client, req, "alice", password, "")
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		return code, stored
+	}
+
+	oauthCode := func(err error) string {
+		var oerr *controller.OAuthError
+		gomega.Expect(errors.As(err, &oerr)).Should(gomega.BeTrue(), "%v is not an OAuthError", err)
+		return oerr.Code
+	}
+
+	ginkgo.BeforeEach(func() {
+		if key == nil {
+			var err error
+			key, err = rsa.GenerateKey(rand.Reader, auth.MinRSAKeyBits)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		}
+		signer, err := auth.NewOIDCSigner(key, issuer, time.Hour)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		tokens, err := auth.NewTokenSigner([]byte(strings.Repeat("s", auth.MinSecretLength)), time.Hour)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+		mockUsers = mock.NewUserRepoMock()
+		mockCredentials = mock.NewCredentialRepoMock()
+		mockClients = mock.NewClientRepoMock()
+		mockCodes = mock.NewAuthorizationCodeRepoMock()
+		authController = controller.NewAuthController(mockUsers, mockCredentials, tokens, logging.Discard(),
+			controller.WithHasher(hasher),
+			controller.WithClock(func() time.Time { return now }),
+			controller.WithOIDC(mockClients, mockCodes, signer),
+		)
+
+		client = &model.OAuthClient{
+			ClientID:     "c0ffee",
+			TenantID:     model.DefaultTenantID,
+			Name:         "Wiki",
+			SecretHash:   auth.HashOpaqueToken(secret),
+			RedirectURIs: []string{"https://app.example.com/callback"},
+		}
+		alice = &model.User{
+			UserID: 1, TenantID: model.DefaultTenantID, UserName: "alice", FirstName: "Alice", LastName: "Liddell",
+			Email: "alice@email.com", EmailVerified: true, UserStatus: model.Active,
+		}
+		alice.Department.String, alice.Department.Valid = "Research", true
+		mockUsers.On("GetByUsername", "alice").Return(alice, nil)
+		mockUsers.On("GetById", 1).Return(alice, nil)
+
+		hash, err := hasher.Hash(password)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		mockCredentials.On("GetCredential", 1).Return(&model.Credential{UserID: 1, TenantID: model.DefaultTenantID, PasswordHash: hash}, nil)
+	})
+
+	ginkgo.Describe("authorization code flow", func() {
+		ginkgo.It("should issue tokens carrying the claims of the granted scopes", func() {
+			code, stored := authorize(request())
+			gomega.Expect(stored.CodeHash).Should(gomega.Equal(auth.HashOpaqueToken(code)))
+			gomega.Expect(stored.Scope).Should(gomega.Equal("openid profile email"))
+			gomega.Expect(stored.ExpiresAt).Should(gomega.Equal(now.Add(controller.AuthorizationCodeTTL)))
+
+			mockCodes.On("ConsumeAuthorizationCode", stored.CodeHash).Return(stored, nil)
+			tokens, err := authController.Exchange(ctx, client, &controller.TokenRequest{
+				GrantType: "authorization_code", Code: code, RedirectURI: stored.RedirectURI, CodeVerifier: verifier, ClientSecret: secret,
+			})
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(tokens.Scope).Should(gomega.Equal("openid profile email"))
+
+			claims := &auth.IDTokenClaims{}
+			_, err = (&jwt.Parser{SkipClaimsValidation: true}).ParseWithClaims(tokens.IDToken, claims, func(*jwt.Token) (interface{}, error) {
+				return &key.PublicKey, nil
+			})
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(claims.Issuer).Should(gomega.Equal(issuer))
+			gomega.Expect(claims.Subject).Should(gomega.Equal("1"))
+			gomega.Expect(claims.Audience).Should(gomega.Equal(client.ClientID))
+			gomega.Expect(claims.Nonce).Should(gomega.Equal("n-0S6_WzA2Mj"))
+			gomega.Expect(claims.AuthTime).Should(gomega.Equal(now.Unix()))
+			gomega.Expect(claims.Name).Should(gomega.Equal("Alice Liddell"))
+			gomega.Expect(claims.Department).Should(gomega.Equal("Research"))
+			gomega.Expect(claims.UserStatus).Should(gomega.Equal(model.Active))
+			gomega.Expect(claims.Email).Should(gomega.Equal("alice@email.com"))
+			gomega.Expect(*claims.EmailVerified).Should(gomega.BeTrue())
+
+			mockClients.On("GetClient", client.ClientID).Return(client, nil)
+			info, err := authController.UserInfo(context.Background(), tokens.AccessToken.Value)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(info.Subject).Should(gomega.Equal("1"))
+			gomega.Expect(info.PreferredUsername).Should(gomega.Equal("alice"))
+			gomega.Expect(info.GivenName).Should(gomega.Equal("Alice"))
+
+			_, err = authController.UserInfo(context.Background(), tokens.IDToken)
+			gomega.Expect(err).Should(gomega.MatchError(auth.ErrInvalidToken))
+		})
+
+		ginkgo.It("should leave out the claims of scopes not granted", func() {
+			req := request()
+			req.Scope = "openid"
+			code, stored := authorize(req)
+
+			mockCodes.On("ConsumeAuthorizationCode", stored.CodeHash).Return(stored, nil)
+			tokens, err := authController.Exchange(ctx, client, &controller.TokenRequest{
+				GrantType: "authorization_code", Code: code, RedirectURI: stored.RedirectURI, CodeVerifier: verifier, ClientSecret: secret,
+			})
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+			mockClients.On("GetClient", client.ClientID).Return(client, nil)
+			info, err := authController.UserInfo(context.Background(), tokens.AccessToken.Value)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(info.UserClaims).Should(gomega.Equal(auth.UserClaims{}))
+		})
+
+		ginkgo.It("should not issue a code for a wrong password", func() {
+			mockCredentials.On("RecordLoginFailure", 1).Return(1, nil)
+			_, err := authController.Authorize(ctx, client, request(), "alice", "wrong", "")
+			gomega.Expect(err).Should(gomega.MatchError(controller.ErrInvalidCredentials))
+			mockCodes.AssertNotCalled(ginkgo.GinkgoT(), "CreateAuthorizationCode", testifymock.Anything)
+		})
+	})
+
+	ginkgo.It("should check the authorization requests", func() {
+		req := request()
+		req.RedirectURI = "https://evil.example.com/callback"
+		gomega.Expect(authController.CheckAuthorization(ctx, client, req)).Should(gomega.MatchError(controller.ErrInvalidRedirectURI))
+
+		req = request()
+		req.ClientID = "another"
+		gomega.Expect(authController.CheckAuthorization(ctx, client, req)).Should(gomega.MatchError(controller.ErrInvalidRedirectURI))
+
+		for code, change := range map[string]func(*controller.AuthorizationRequest){
+			controller.OAuthUnsupportedResponseType: func(r *controller.AuthorizationRequest) { r.ResponseType = "token" },
+			controller.OAuthInvalidScope:            func(r *controller.AuthorizationRequest) { r.Scope = "profile email" },
+			controller.OAuthInvalidRequest:          func(r *controller.AuthorizationRequest) { r.CodeChallengeMethod = "plain" },
+			controller.OAuthLoginRequired:           func(r *controller.AuthorizationRequest) { r.Prompt = "none" },
+		} {
+			req := request()
+			change(req)
+			gomega.Expect(oauthCode(authController.CheckAuthorization(ctx, client, req))).Should(gomega.Equal(code))
+		}
+
+		req = request()
+		req.CodeChallenge = ""
+		gomega.Expect(oauthCode(authController.CheckAuthorization(ctx, client, req))).Should(gomega.Equal(controller.OAuthInvalidRequest))
+	})
+
+	ginkgo.It("should refuse token requests of the wrong client, verifier or redirect URI", func() {
+		code, stored := authorize(request())
+		exchange := func(c *model.OAuthClient, req controller.TokenRequest) error {
+			req.GrantType, req.Code = "authorization_code", code
+			_, err := authController.Exchange(ctx, c, &req)
+			return err
+		}
+
+		err := exchange(client, controller.TokenRequest{RedirectURI: stored.RedirectURI, CodeVerifier: verifier, ClientSecret: "wrong"})
+		gomega.Expect(oauthCode(err)).Should(gomega.Equal(controller.OAuthInvalidClient))
+		err = exchange(client, controller.TokenRequest{RedirectURI: stored.RedirectURI, CodeVerifier: verifier})
+		gomega.Expect(oauthCode(err)).Should(gomega.Equal(controller.OAuthInvalidClient))
+		mockCodes.AssertNotCalled(ginkgo.GinkgoT(), "ConsumeAuthorizationCode", testifymock.Anything)
+
+		_, err = authController.Exchange(ctx, client, &controller.TokenRequest{GrantType: "password", ClientSecret: secret})
+		gomega.Expect(oauthCode(err)).Should(gomega.Equal(controller.OAuthUnsupportedGrantType))
+
+		mockCodes.On("ConsumeAuthorizationCode", stored.CodeHash).Return(stored, nil)
+		err = exchange(client, controller.TokenRequest{RedirectURI: stored.RedirectURI, CodeVerifier: strings.Repeat("a", 43), ClientSecret: secret})
+		gomega.Expect(oauthCode(err)).Should(gomega.Equal(controller.OAuthInvalidGrant))
+		err = exchange(client, controller.TokenRequest{RedirectURI: "https://app.example.com/other", CodeVerifier: verifier, ClientSecret: secret})
+		gomega.Expect(oauthCode(err)).Should(gomega.Equal(controller.OAuthInvalidGrant))
+
+		public := &model.OAuthClient{ClientID: "public", TenantID: model.DefaultTenantID, RedirectURIs: client.RedirectURIs}
+		err = exchange(public, controller.TokenRequest{RedirectURI: stored.RedirectURI, CodeVerifier: verifier})
+		gomega.Expect(oauthCode(err)).Should(gomega.Equal(controller.OAuthInvalidGrant))
+
+		mockCodes.On("ConsumeAuthorizationCode", auth.HashOpaqueToken("used")).Return(nil, fmt.Errorf("%w: no rows", repo.ErrAuthorizationCodeNotFound))
+		_, err = authController.Exchange(ctx, client, &controller.TokenRequest{
+			GrantType: "authorization_code", Code: "used", RedirectURI: stored.RedirectURI, CodeVerifier: verifier, ClientSecret: secret,
+		})
+		gomega.Expect(oauthCode(err)).Should(gomega.Equal(controller.OAuthInvalidGrant))
+	})
+
+	ginkgo.It("should refuse the access tokens of deleted clients and disabled users", func() {
+		code, stored := authorize(request())
+		mockCodes.On("ConsumeAuthorizationCode", stored.CodeHash).Return(stored, nil)
+		tokens, err := authController.Exchange(ctx, client, &controller.TokenRequest{
+			GrantType: "authorization_code", Code: code, RedirectURI: stored.RedirectURI, CodeVerifier: verifier, ClientSecret: secret,
+		})
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+		mockClients.On("GetClient", client.ClientID).Return(nil, fmt.Errorf("%w: no rows", repo.ErrClientNotFound)).Once()
+		_, err = authController.UserInfo(context.Background(), tokens.AccessToken.Value)
+		gomega.Expect(err).Should(gomega.MatchError(auth.ErrInvalidToken))
+
+		mockClients.On("GetClient", client.ClientID).Return(client, nil)
+		alice.UserStatus = model.Inactive
+		_, err = authController.UserInfo(context.Background(), tokens.AccessToken.Value)
+		gomega.Expect(err).Should(gomega.MatchError(auth.ErrInvalidToken))
+	})
+
+	ginkgo.Describe("clients", func() {
+		ginkgo.It("should register confidential clients with a secret stored hashed", func() {
+			var created *model.OAuthClient
+			mockClients.On("CreateClient", testifymock.Anything).Run(func(args testifymock.Arguments) {
+				created = args.Get(0).(*model.OAuthClient)
+			}).Return(nil)
+
+			c, secret, err := authController.CreateClient(ctx, " Wiki ", []string{"https://wiki.example.com/cb", "http://127.0.0.1:8000/cb", "https://wiki.example.com/cb"}, false)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(c).Should(gomega.BeIdenticalTo(created))
+			gomega.Expect(c.ClientID).Should(gomega.HaveLen(32))
+			gomega.Expect(c.Name).Should(gomega.Equal("Wiki"))
+			gomega.Expect(c.RedirectURIs).Should(gomega.Equal([]string{"https://wiki.example.com/cb", "http://127.0.0.1:8000/cb"}))
+			gomega.Expect(c.SecretHash).Should(gomega.Equal(auth.HashOpaqueToken(secret)))
+
+			c, secret, err = authController.CreateClient(ctx, "SPA", []string{"http://localhost:4200/cb"}, true)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(c.Public()).Should(gomega.BeTrue())
+			gomega.Expect(secret).Should(gomega.BeEmpty())
+		})
+
+		ginkgo.It("should reject invalid names and redirect URIs", func() {
+			for _, uris := range [][]string{
+				nil,
+				{"http://app.example.com/cb"},
+				{"https://app.example.com/cb#fragment"},
+				{"/relative"},
+				{"myapp://callback"},
+			} {
+				_, _, err := authController.CreateClient(ctx, "Wiki", uris, false)
+				var verr *controller.ValidationError
+				gomega.Expect(errors.As(err, &verr)).Should(gomega.BeTrue(), "%v should be rejected", uris)
+				gomega.Expect(verr.Fields[0].Field).Should(gomega.Equal("redirect_uris"))
+			}
+
+			_, err := authController.UpdateClient(ctx, client.ClientID, "", client.RedirectURIs)
+			var verr *controller.ValidationError
+			gomega.Expect(errors.As(err, &verr)).Should(gomega.BeTrue())
+			gomega.Expect(verr.Fields[0].Field).Should(gomega.Equal("name"))
+			mockClients.AssertNotCalled(ginkgo.GinkgoT(), "CreateClient", testifymock.Anything)
+			mockClients.AssertNotCalled(ginkgo.GinkgoT(), "UpdateClient", testifymock.Anything)
+		})
+
+		ginkgo.It("should only rotate the secret of confidential clients", func() {
+			mockClients.On("GetClient", client.ClientID).Return(client, nil)
+			mockClients.On("SetClientSecret", client.ClientID, testifymock.Anything).Return(nil)
+			secret, err := authController.RotateClientSecret(ctx, client.ClientID)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			mockClients.AssertCalled(ginkgo.GinkgoT(), "SetClientSecret", client.ClientID, auth.HashOpaqueToken(secret))
+
+			mockClients.On("GetClient", "public").Return(&model.OAuthClient{ClientID: "public"}, nil)
+			_, err = authController.RotateClientSecret(ctx, "public")
+			gomega.Expect(err).Should(gomega.MatchError(controller.ErrPublicClient))
+
+			mockClients.On("GetClient", "unknown").Return(nil, fmt.Errorf("%w: no rows", repo.ErrClientNotFound))
+			_, err = authController.RotateClientSecret(ctx, "unknown")
+			gomega.Expect(err).Should(gomega.MatchError(controller.ErrClientNotFound))
+		})
+
+		ginkgo.It("should be unavailable without provider", func() {
+			c := controller.NewAuthController(mockUsers, mock.NewCredentialRepoMock(), nil, logging.Discard())
+			_, err := c.GetClients(ctx)
+			gomega.Expect(err).Should(gomega.MatchError(controller.ErrOIDCUnavailable))
+			_, err = c.FindClient(ctx, client.ClientID)
+			gomega.Expect(err).Should(gomega.MatchError(controller.ErrOIDCUnavailable))
+			_, err = c.UserInfo(ctx, "token")
+			gomega.Expect(err).Should(gomega.MatchError(auth.ErrInvalidToken))
+		})
+	})
+})
@@ -0,0 +1,61 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"users-backend/controller"
+	"users-backend/logging"
+	"users-backend/model"
+	"users-backend/repo"
+	"users-backend/repo/mock"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Tenant Controller", func() {
+	var (
+		mockRepo         *mock.TenantRepoMock
+		tenantController *controller.TenantControllerImpl
+		ctx              = context.Background()
+	)
+
+	ginkgo.BeforeEach(func() {
+		mockRepo = mock.NewTenantRepoMock()
+		tenantController = controller.NewTenantController(mockRepo, logging.Discard())
+	})
+
+	ginkgo.It("should normalize the slug before creating the tenant", func() {
+		mockRepo.On("CreateTenant", &model.Tenant{Slug: "acme", Name: "Acme"}).Return(2, nil)
+
+		id, err := tenantController.CreateTenant(ctx, " ACME ", "Acme")
+
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(id).Should(gomega.Equal(2))
+	})
+
+	ginkgo.It("should reject slugs that are not a DNS label and empty names", func() {
+		for _, slug := range []string{"", "-acme", "acme-", "ac_me", "acme.corp", fmt.Sprintf("%064d", 0)} {
+			_, err := tenantController.CreateTenant(ctx, slug, "")
+
+			var verr *controller.ValidationError
+			gomega.Expect(errors.As(err, &verr)).Should(gomega.BeTrue(), slug)
+			gomega.Expect(verr.Fields).Should(gomega.HaveLen(2))
+			gomega.Expect(verr.Error()).Should(gomega.HavePrefix("invalid tenant: slug"))
+		}
+		mockRepo.AssertNotCalled(ginkgo.GinkgoT(), "CreateTenant")
+	})
+
+	ginkgo.It("should map the repo errors", func() {
+		mockRepo.On("CreateTenant", &model.Tenant{Slug: "acme", Name: "Acme"}).Return(-1, fmt.Errorf("%w: duplicate key", repo.ErrDuplicateTenantSlug))
+		mockRepo.On("GetTenant", 42).Return(nil, fmt.Errorf("%w: no rows", repo.ErrTenantNotFound))
+		mockRepo.On("DeleteTenant", 2).Return(fmt.Errorf("%w: foreign key", repo.ErrTenantInUse))
+
+		_, err := tenantController.CreateTenant(ctx, "acme", "Acme")
+		gomega.Expect(err).Should(gomega.MatchError(controller.ErrTenantAlreadyExists))
+		_, err = tenantController.GetTenant(ctx, 42)
+		gomega.Expect(err).Should(gomega.MatchError(controller.ErrTenantNotFound))
+		gomega.Expect(tenantController.DeleteTenant(ctx, 2)).Should(gomega.MatchError(controller.ErrTenantHasUsers))
+	})
+})
@@ -0,0 +1,128 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"users-backend/auth"
+	"users-backend/controller"
+	"users-backend/logging"
+	"users-backend/model"
+	"users-backend/repo"
+	"users-backend/repo/mock"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// spans records the spans of the whole suite, the controller tracer is only
+// bound to the first global provider so it is installed once
+var spans = func() *tracetest.SpanRecorder {
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	return sr
+}()
+
+var _ = ginkgo.Describe("Controller Tracing", func() {
+	const password = "correct horse battery staple"
+
+	var (
+		mockUsers       *mock.UserRepoMock
+		mockCredentials *mock.CredentialRepoMock
+		authController  *controller.AuthControllerImpl
+		userController  *controller.UserControllerImpl
+		ctx             = context.Background()
+		mark            int
+	)
+
+	// ended returns the span of name ended since the spec started
+	ended := func(name string) sdktrace.ReadOnlySpan {
+		for _, s := range spans.Ended()[mark:] {
+			if s.Name() == name {
+				return s
+			}
+		}
+		ginkgo.Fail(fmt.Sprintf("no span %q was ended", name))
+		return nil
+	}
+
+	attributes := func(s sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+		a := map[attribute.Key]attribute.Value{}
+		for _, kv := range s.Attributes() {
+			a[kv.Key] = kv.Value
+		}
+		return a
+	}
+
+	ginkgo.BeforeEach(func() {
+		mark = len(spans.Ended())
+
+		hasher := auth.NewArgon2idHasher(auth.Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+		hash, err := hasher.Hash(password)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		tokens, err := auth.NewTokenSigner([]byte(strings.Repeat("s", auth.MinSecretLength)), time.Hour)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+		mockUsers = mock.NewUserRepoMock()
+		mockCredentials = mock.NewCredentialRepoMock()
+		mockUsers.On("GetByUsername", "alice").Return(&model.User{UserID: 1, TenantID: model.DefaultTenantID, UserName: "alice", UserStatus: model.Active}, nil)
+		mockUsers.On("GetByUsername", "nobody").Return(nil, fmt.Errorf("%w: no rows", repo.ErrNotFound))
+		mockCredentials.On("GetCredential", 1).Return(&model.Credential{UserID: 1, TenantID: model.DefaultTenantID, PasswordHash: hash}, nil)
+
+		authController = controller.NewAuthController(mockUsers, mockCredentials, tokens, logging.Discard(), controller.WithHasher(hasher))
+		userController = controller.NewUserController(mockUsers, logging.Discard())
+	})
+
+	ginkgo.AfterEach(func() {
+		for _, s := range spans.Ended()[mark:] {
+			gomega.Expect(attributes(s)).ShouldNot(gomega.HaveKey(attribute.Key("user.name")), "user names must not reach the trace backend")
+		}
+	})
+
+	ginkgo.It("should record the user id of a login", func() {
+		_, err := authController.Login(ctx, "alice", password, "")
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+		s := ended("AuthController.Login")
+		gomega.Expect(attributes(s)).Should(gomega.HaveKeyWithValue(attribute.Key("user.id"), attribute.IntValue(1)))
+		gomega.Expect(s.Status().Code).Should(gomega.Equal(codes.Unset))
+	})
+
+	ginkgo.It("should record the error of a rejected login", func() {
+		_, err := authController.Login(ctx, "nobody", password, "")
+		gomega.Expect(err).Should(gomega.MatchError(controller.ErrInvalidCredentials))
+
+		s := ended("AuthController.Login")
+		gomega.Expect(attributes(s)).ShouldNot(gomega.HaveKey(attribute.Key("user.id")))
+		gomega.Expect(s.Status().Code).Should(gomega.Equal(codes.Error))
+		gomega.Expect(s.Status().Description).Should(gomega.Equal(controller.ErrInvalidCredentials.Error()))
+		gomega.Expect(s.Events()).Should(gomega.ContainElement(gomega.HaveField("Name", "exception")))
+	})
+
+	ginkgo.It("should record the id of a created user", func() {
+		mockUsers.On("GetByUsername", "johndoe").Return(nil, errors.New("error finding user with username"))
+		mockUsers.On("Create", &model.User{UserName: "johndoe", FirstName: "John", LastName: "Doe", Email: "johndoe@email.com", UserStatus: model.Active}).Return(7, nil)
+
+		_, err := userController.CreateUser(ctx, "johndoe", "John", "Doe", "johndoe@email.com", "A", "", 0, nil)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+		s := ended("UserController.CreateUser")
+		gomega.Expect(attributes(s)).Should(gomega.HaveKeyWithValue(attribute.Key("user.id"), attribute.IntValue(7)))
+	})
+
+	ginkgo.It("should record the id of an updated user", func() {
+		_, err := userController.UpdateUser(ctx, 3, "john doe", "John", "Doe", "johndoe@email.com", "A", "", new(int), nil)
+		gomega.Expect(err).Should(gomega.HaveOccurred())
+
+		s := ended("UserController.UpdateUser")
+		gomega.Expect(attributes(s)).Should(gomega.HaveKeyWithValue(attribute.Key("user.id"), attribute.IntValue(3)))
+		gomega.Expect(s.Status().Code).Should(gomega.Equal(codes.Error))
+	})
+})
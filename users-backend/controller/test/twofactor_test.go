@@ -0,0 +1,247 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"users-backend/auth"
+	"users-backend/controller"
+	"users-backend/logging"
+	"users-backend/model"
+	"users-backend/repo"
+	"users-backend/repo/mock"
+	"users-backend/tenant"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	testifymock "github.com/stretchr/testify/mock"
+)
+
+var _ = ginkgo.Describe("Two-factor", func() {
+	const password = "correct horse battery staple"
+
+	var (
+		mockUsers       *mock.UserRepoMock
+		mockCredentials *mock.CredentialRepoMock
+		mockFactors     *mock.TwoFactorRepoMock
+		tokens          *auth.TokenSigner
+		secrets         *auth.SecretBox
+		hasher          = auth.NewArgon2idHasher(auth.Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+		authController  *controller.AuthControllerImpl
+		now             = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+		ctx             = tenant.WithID(context.Background(), model.DefaultTenantID)
+		alice           *model.User
+	)
+
+	// enrolled returns a factor of alice sealing secret
+	enrolled := func(secret string, confirmed bool) *model.TwoFactor {
+		sealed, err := secrets.Seal(secret)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		f := &model.TwoFactor{UserID: 1, TenantID: model.DefaultTenantID, Secret: sealed}
+		if confirmed {
+			f.ConfirmedAt = now.Add(-time.Hour)
+		}
+		return f
+	}
+
+	codeAt := func(secret string, t time.Time) string {
+		code, err := auth.TOTPCode(secret, auth.TOTPStep(t))
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		return code
+	}
+
+	ginkgo.BeforeEach(func() {
+		var err error
+		tokens, err = auth.NewTokenSigner([]byte(strings.Repeat("s", auth.MinSecretLength)), time.Hour)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		secrets, err = auth.NewSecretBox([]byte(strings.Repeat("k", auth.MinSecretBoxKeyLength)))
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+		mockUsers = mock.NewUserRepoMock()
+		mockCredentials = mock.NewCredentialRepoMock()
+		mockFactors = mock.NewTwoFactorRepoMock()
+		authController = controller.NewAuthController(mockUsers, mockCredentials, tokens, logging.Discard(),
+			controller.WithHasher(hasher),
+			controller.WithLockout(controller.LockoutPolicy{MaxFailures: 3, Duration: 10 * time.Minute}),
+			controller.WithClock(func() time.Time { return now }),
+			controller.WithTwoFactor(mockFactors, secrets, "Users"),
+		)
+
+		alice = &model.User{UserID: 1, TenantID: model.DefaultTenantID, UserName: "alice", Email: "alice@email.com", UserStatus: model.Active}
+		mockUsers.On("GetByUsername", "alice").Return(alice, nil)
+		mockUsers.On("GetById", 1).Return(alice, nil)
+		mockUsers.On("GetById", 9).Return((*model.User)(nil), fmt.Errorf("%w: no rows", repo.ErrNotFound))
+
+		hash, err := hasher.Hash(password)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		mockCredentials.On("GetCredential", 1).Return(&model.Credential{UserID: 1, TenantID: model.DefaultTenantID, PasswordHash: hash}, nil)
+	})
+
+	ginkgo.Describe("enrollment", func() {
+		ginkgo.It("should hand out a secret stored encrypted and confirm it with a code", func() {
+			var sealed string
+			mockFactors.On("GetTwoFactor", 1).Return(nil, fmt.Errorf("%w: no rows", repo.ErrTwoFactorNotFound)).Once()
+			mockFactors.On("EnrollTwoFactor", 1, testifymock.Anything).Run(func(args testifymock.Arguments) {
+				sealed = args.String(1)
+			}).Return(nil)
+
+			enrollment, err := authController.EnrollTwoFactor(ctx, 1)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(enrollment.URI).Should(gomega.HavePrefix("otpauth://totp/Users:alice?"))
+			gomega.Expect(enrollment.URI).Should(gomega.ContainSubstring("secret=" + enrollment.Secret))
+			gomega.Expect(string(enrollment.QRCode)).Should(gomega.HavePrefix("\x89PNG"))
+			gomega.Expect(sealed).ShouldNot(gomega.ContainSubstring(enrollment.Secret))
+
+			mockFactors.On("GetTwoFactor", 1).Return(&model.TwoFactor{UserID: 1, Secret: sealed}, nil)
+			_, err = authController.ConfirmTwoFactor(ctx, 1, codeAt(enrollment.Secret, now.Add(-time.Hour)))
+			gomega.Expect(err).Should(gomega.MatchError(controller.ErrInvalidTwoFactorCode))
+
+			mockFactors.On("ConfirmTwoFactor", 1, auth.TOTPStep(now), testifymock.Anything).Return(nil)
+			codes, err := authController.ConfirmTwoFactor(ctx, 1, codeAt(enrollment.Secret, now))
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(codes).Should(gomega.HaveLen(controller.RecoveryCodeCount))
+
+			hashes := mockFactors.Calls[len(mockFactors.Calls)-1].Arguments.Get(2).([]string)
+			gomega.Expect(hashes).Should(gomega.HaveLen(controller.RecoveryCodeCount))
+			gomega.Expect(hashes[0]).Should(gomega.Equal(auth.HashRecoveryCode(codes[0])))
+		})
+
+		ginkgo.It("should refuse enabled, missing and unconfigured factors", func() {
+			mockFactors.On("GetTwoFactor", 1).Return(enrolled("JBSWY3DPEHPK3PXP", true), nil)
+			_, err := authController.EnrollTwoFactor(ctx, 1)
+			gomega.Expect(err).Should(gomega.MatchError(controller.ErrTwoFactorEnabled))
+			_, err = authController.ConfirmTwoFactor(ctx, 1, "123456")
+			gomega.Expect(err).Should(gomega.MatchError(controller.ErrTwoFactorEnabled))
+			_, err = authController.EnrollTwoFactor(ctx, 9)
+			gomega.Expect(err).Should(gomega.MatchError(controller.ErrUserNotFound))
+
+			mockFactors.On("GetTwoFactor", 2).Return(nil, fmt.Errorf("%w: no rows", repo.ErrTwoFactorNotFound))
+			_, err = authController.ConfirmTwoFactor(ctx, 2, "123456")
+			gomega.Expect(err).Should(gomega.MatchError(controller.ErrTwoFactorNotEnrolled))
+			_, err = authController.RegenerateRecoveryCodes(ctx, 2, "123456")
+			gomega.Expect(err).Should(gomega.MatchError(controller.ErrTwoFactorNotEnrolled))
+
+			keyless := controller.NewAuthController(mockUsers, mockCredentials, tokens, logging.Discard(), controller.WithTwoFactor(mockFactors, nil, ""))
+			_, err = keyless.EnrollTwoFactor(ctx, 1)
+			gomega.Expect(err).Should(gomega.MatchError(controller.ErrTwoFactorUnavailable))
+			mockFactors.AssertNotCalled(ginkgo.GinkgoT(), "EnrollTwoFactor", testifymock.Anything, testifymock.Anything)
+		})
+
+		ginkgo.It("should regenerate the recovery codes with a current code only", func() {
+			const secret = "JBSWY3DPEHPK3PXP"
+			mockFactors.On("GetTwoFactor", 1).Return(enrolled(secret, true), nil)
+			mockFactors.On("UseTwoFactorStep", 1, auth.TOTPStep(now)).Return(true, nil)
+			mockFactors.On("ReplaceRecoveryCodes", 1, testifymock.Anything).Return(nil)
+			mockCredentials.On("RecordLoginFailure", 1).Return(1, nil)
+
+			_, err := authController.RegenerateRecoveryCodes(ctx, 1, codeAt(secret, now.Add(-time.Hour)))
+			gomega.Expect(err).Should(gomega.MatchError(controller.ErrInvalidTwoFactorCode))
+			mockCredentials.AssertCalled(ginkgo.GinkgoT(), "RecordLoginFailure", 1)
+
+			codes, err := authController.RegenerateRecoveryCodes(ctx, 1, codeAt(secret, now))
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(codes).Should(gomega.HaveLen(controller.RecoveryCodeCount))
+		})
+	})
+
+	ginkgo.Describe("Login", func() {
+		const secret = "JBSWY3DPEHPK3PXP"
+
+		ginkgo.BeforeEach(func() {
+			mockFactors.On("GetTwoFactor", 1).Return(enrolled(secret, true), nil)
+		})
+
+		ginkgo.It("should ask for a code after the right password", func() {
+			_, err := authController.Login(ctx, "alice", password, "")
+			gomega.Expect(err).Should(gomega.MatchError(controller.ErrTwoFactorRequired))
+			mockCredentials.AssertNotCalled(ginkgo.GinkgoT(), "RecordLoginFailure", testifymock.Anything)
+		})
+
+		ginkgo.It("should accept a TOTP code once", func() {
+			mockFactors.On("UseTwoFactorStep", 1, auth.TOTPStep(now)).Return(true, nil).Once()
+			token, err := authController.Login(ctx, "alice", password, codeAt(secret, now))
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(token.Value).ShouldNot(gomega.BeEmpty())
+
+			mockFactors.On("UseTwoFactorStep", 1, auth.TOTPStep(now)).Return(false, nil)
+			mockCredentials.On("RecordLoginFailure", 1).Return(1, nil)
+			_, err = authController.Login(ctx, "alice", password, codeAt(secret, now))
+			gomega.Expect(err).Should(gomega.MatchError(controller.ErrInvalidTwoFactorCode))
+		})
+
+		ginkgo.It("should count wrong codes as failed logins", func() {
+			mockCredentials.On("RecordLoginFailure", 1).Return(3, nil)
+			mockCredentials.On("LockCredential", 1, now.Add(10*time.Minute)).Return(nil)
+
+			_, err := authController.Login(ctx, "alice", password, codeAt(secret, now.Add(-time.Hour)))
+			var locked *controller.LockedError
+			gomega.Expect(errors.As(err, &locked)).Should(gomega.BeTrue(), "got %v", err)
+			mockFactors.AssertNotCalled(ginkgo.GinkgoT(), "UseTwoFactorStep", testifymock.Anything, testifymock.Anything)
+		})
+
+		ginkgo.It("should accept recovery codes whatever their case", func() {
+			mockFactors.On("UseRecoveryCode", 1, auth.HashRecoveryCode("abcd-efgh-ijkl-mnop")).Return(true, nil)
+			_, err := authController.Login(ctx, "alice", password, "ABCD-EFGH-IJKL-MNOP")
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		})
+
+		ginkgo.It("should fail closed without encryption key", func() {
+			keyless := controller.NewAuthController(mockUsers, mockCredentials, tokens, logging.Discard(),
+				controller.WithHasher(hasher), controller.WithTwoFactor(mockFactors, nil, ""))
+			_, err := keyless.Login(ctx, "alice", password, codeAt(secret, now))
+			gomega.Expect(err).Should(gomega.MatchError(controller.ErrTwoFactorUnavailable))
+		})
+
+		ginkgo.It("should not ask unconfirmed factors", func() {
+			factors := mock.NewTwoFactorRepoMock()
+			factors.On("GetTwoFactor", 1).Return(enrolled(secret, false), nil)
+			unconfirmed := controller.NewAuthController(mockUsers, mockCredentials, tokens, logging.Discard(),
+				controller.WithHasher(hasher), controller.WithTwoFactor(factors, secrets, ""))
+
+			_, err := unconfirmed.Login(ctx, "alice", password, "")
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		})
+	})
+
+	ginkgo.Describe("Authenticate", func() {
+		ginkgo.It("should return the active user of the tenant a token was issued to", func() {
+			token, err := tokens.Sign(1, model.DefaultTenantID, "alice", time.Now())
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+			user_id, err := authController.Authenticate(ctx, token.Value)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(user_id).Should(gomega.Equal(1))
+
+			_, err = authController.Authenticate(tenant.WithID(context.Background(), model.DefaultTenantID+1), token.Value)
+			gomega.Expect(errors.Is(err, auth.ErrInvalidToken)).Should(gomega.BeTrue(), "got %v", err)
+			_, err = authController.Authenticate(ctx, token.Value+"x")
+			gomega.Expect(errors.Is(err, auth.ErrInvalidToken)).Should(gomega.BeTrue(), "got %v", err)
+
+			alice.UserStatus = model.Terminated
+			_, err = authController.Authenticate(ctx, token.Value)
+			gomega.Expect(errors.Is(err, auth.ErrInvalidToken)).Should(gomega.BeTrue(), "got %v", err)
+		})
+	})
+
+	ginkgo.Describe("admin", func() {
+		ginkgo.It("should report and reset the factor of a user", func() {
+			mockFactors.On("GetTwoFactor", 1).Return(enrolled("JBSWY3DPEHPK3PXP", true), nil)
+			mockFactors.On("CountRecoveryCodes", 1).Return(7, nil)
+			mockFactors.On("DeleteTwoFactor", 1).Return(nil)
+
+			status, err := authController.GetTwoFactor(ctx, 1)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(status.Enabled).Should(gomega.BeTrue())
+			gomega.Expect(status.RecoveryCodesLeft).Should(gomega.Equal(7))
+
+			gomega.Expect(authController.ResetTwoFactor(ctx, 1)).Should(gomega.Succeed())
+			mockFactors.AssertCalled(ginkgo.GinkgoT(), "DeleteTwoFactor", 1)
+
+			gomega.Expect(authController.ResetTwoFactor(ctx, 9)).Should(gomega.MatchError(controller.ErrUserNotFound))
+			_, err = authController.GetTwoFactor(ctx, 9)
+			gomega.Expect(err).Should(gomega.MatchError(controller.ErrUserNotFound))
+		})
+	})
+})
@@ -0,0 +1,103 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"users-backend/controller"
+	"users-backend/logging"
+	"users-backend/model"
+	"users-backend/repo/mock"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	testify "github.com/stretchr/testify/mock"
+)
+
+var _ = ginkgo.Describe("User Validation", func() {
+	var mockRepo *mock.UserRepoMock
+
+	fieldErrors := func(err error) []controller.FieldError {
+		var verr *controller.ValidationError
+		gomega.Expect(errors.As(err, &verr)).Should(gomega.BeTrue())
+		return verr.Fields
+	}
+
+	ginkgo.BeforeEach(func() {
+		mockRepo = mock.NewUserRepoMock()
+	})
+
+	ginkgo.It("should reject user names longer than the column", func() {
+		c := controller.NewUserController(mockRepo, logging.Discard())
+
+		_, err := c.CreateUser(context.Background(), strings.Repeat("a", 51), "first", "last", "a@email.com", "A", "", 0, nil)
+
+		gomega.Expect(fieldErrors(err)).Should(gomega.Equal([]controller.FieldError{
+			{Field: "user_name", Rule: "max", Message: "must be at most 50 characters"},
+		}))
+		mockRepo.AssertNotCalled(ginkgo.GinkgoT(), "Create", testify.Anything)
+	})
+
+	ginkgo.It("should reject invalid characters and reserved names", func() {
+		c := controller.NewUserController(mockRepo, logging.Discard())
+
+		_, err := c.CreateUser(context.Background(), "john doe", "first", "last", "a@email.com", "A", "", 0, nil)
+		gomega.Expect(fieldErrors(err)[0].Rule).Should(gomega.Equal("pattern"))
+
+		_, err = c.CreateUser(context.Background(), "Admin", "first", "last", "a@email.com", "A", "", 0, nil)
+		gomega.Expect(fieldErrors(err)[0].Rule).Should(gomega.Equal("reserved"))
+	})
+
+	ginkgo.It("should reject missing and malformed emails", func() {
+		c := controller.NewUserController(mockRepo, logging.Discard())
+
+		_, err := c.CreateUser(context.Background(), "username", "first", "last", "", "A", "", 0, nil)
+		gomega.Expect(fieldErrors(err)).Should(gomega.Equal([]controller.FieldError{
+			{Field: "email", Rule: "required", Message: "is required"},
+		}))
+
+		_, err = c.CreateUser(context.Background(), "username", "first", "last", "John <username@email.com>", "A", "", 0, nil)
+		gomega.Expect(fieldErrors(err)).Should(gomega.Equal([]controller.FieldError{
+			{Field: "email", Rule: "email", Message: "must be a valid email address"},
+		}))
+	})
+
+	ginkgo.It("should only accept the configured email domains", func() {
+		cfg := controller.DefaultValidationConfig()
+		cfg.AllowedEmailDomains = []string{"example.com"}
+		c := controller.NewUserController(mockRepo, logging.Discard(), controller.WithValidation(cfg))
+
+		_, err := c.CreateUser(context.Background(), "username", "first", "last", "username@gmail.com", "A", "", 0, nil)
+		gomega.Expect(fieldErrors(err)).Should(gomega.Equal([]controller.FieldError{
+			{Field: "email", Rule: "domain", Message: "must use one of the domains: example.com"},
+		}))
+
+		mockRepo.On("GetByUsername", "username").Return(nil, errors.New("error finding user with username"))
+		mockRepo.On("Create", testify.Anything).Return(1, nil)
+
+		_, err = c.CreateUser(context.Background(), "username", "first", "last", "username@mail.Example.com", "A", "", 0, nil)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	})
+
+	ginkgo.It("should normalize names before saving them", func() {
+		c := controller.NewUserController(mockRepo, logging.Discard())
+		mockRepo.On("GetByUsername", "username").Return(nil, errors.New("error finding user with username"))
+		mockRepo.On("Create", testify.Anything).Return(1, nil)
+
+		// Full-width user name and a decomposed "é"
+		_, err := c.CreateUser(context.Background(), " ｕｓｅｒｎａｍｅ ", "Rene\u0301", "last", "username@email.com", "A", "", 0, nil)
+
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		saved := mockRepo.Calls[len(mockRepo.Calls)-1].Arguments.Get(0).(*model.User)
+		gomega.Expect(saved.UserName).Should(gomega.Equal("username"))
+		gomega.Expect(saved.FirstName).Should(gomega.Equal("Ren\u00e9"))
+	})
+
+	ginkgo.It("should report every invalid field at once", func() {
+		c := controller.NewUserController(mockRepo, logging.Discard())
+
+		_, err := c.UpdateUser(context.Background(), 1, "ab", "", "last\x00", "a@email.com", "A", "", new(int), nil)
+
+		gomega.Expect(fieldErrors(err)).Should(gomega.HaveLen(3))
+	})
+})
@@ -0,0 +1,404 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+	"users-backend/auth"
+	"users-backend/model"
+	"users-backend/repo"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// ErrTwoFactorRequired is returned by Login for the right password of a
+	// user with a second factor when no code was given
+	ErrTwoFactorRequired = errors.New("two-factor code required")
+	// ErrInvalidTwoFactorCode is returned for wrong, reused and expired TOTP
+	// codes and for unknown or used recovery codes
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+	// ErrTwoFactorEnabled is returned when enrolling or confirming a user
+	// whose second factor is already confirmed
+	ErrTwoFactorEnabled = errors.New("two-factor already enabled")
+	// ErrTwoFactorNotEnrolled is returned when confirming without enrolling
+	// first, or replacing the recovery codes of a user without confirmed
+	// second factor
+	ErrTwoFactorNotEnrolled = errors.New("two-factor not enrolled")
+	// ErrTwoFactorUnavailable is returned when no encryption key for the
+	// TOTP secrets is configured
+	ErrTwoFactorUnavailable = errors.New("two-factor not configured")
+
+	_ TwoFactorController = new(AuthControllerImpl)
+)
+
+// RecoveryCodeCount is the number of recovery codes handed out at once
+const RecoveryCodeCount = 10
+
+// DefaultTwoFactorIssuer names the service in authenticator apps
+const DefaultTwoFactorIssuer = "users-backend"
+
+// TwoFactorEnrollment is what the user adds to an authenticator app, by hand
+// or by scanning the QR code
+type TwoFactorEnrollment struct {
+	// Secret is the base32 encoded TOTP secret
+	Secret string
+	// URI is the otpauth URI of the secret
+	URI string
+	// QRCode is a PNG QR code of the URI
+	QRCode []byte
+}
+
+// TwoFactorStatus tells whether a user logs in with a second factor
+type TwoFactorStatus struct {
+	Enabled bool
+	// Pending is true between enrolling and confirming
+	Pending           bool
+	ConfirmedAt       time.Time
+	RecoveryCodesLeft int
+}
+
+// WithTwoFactor asks the users who enrolled a TOTP second factor for a code
+// at login. The secrets are encrypted with secrets, without it enrolling
+// returns ErrTwoFactorUnavailable and users with a second factor can not log
+// in. Authenticator apps label the secrets with issuer.
+func WithTwoFactor(factors repo.TwoFactorRepo, secrets *auth.SecretBox, issuer string) AuthOption {
+	return func(c *AuthControllerImpl) {
+		c.factors = factors
+		c.secrets = secrets
+		if issuer != "" {
+			c.issuer = issuer
+		}
+	}
+}
+
+// checkSecondFactor checks code when the user has a confirmed second factor,
+// a wrong code counts as a failed login. Six digits are taken as a TOTP code
+// and anything else as a recovery code.
+func (c *AuthControllerImpl) checkSecondFactor(ctx context.Context, l *slog.Logger, user_id int, code string, now time.Time) error {
+	if c.factors == nil {
+		return nil
+	}
+
+	f, err := c.factors.GetTwoFactor(ctx, user_id)
+	if errors.Is(err, repo.ErrTwoFactorNotFound) {
+		return nil
+	}
+	if err != nil {
+		l.ErrorContext(ctx, "failed to get two-factor", "error", err)
+		return err
+	}
+	if !f.Confirmed() {
+		return nil
+	}
+
+	code = strings.TrimSpace(code)
+	if code == "" {
+		l.InfoContext(ctx, "asked for two-factor code")
+		return ErrTwoFactorRequired
+	}
+
+	var ok bool
+	if isTOTPCode(code) {
+		ok, err = c.useTOTPCode(ctx, l, f, code, now)
+	} else {
+		if ok, err = c.factors.UseRecoveryCode(ctx, user_id, auth.HashRecoveryCode(code)); err != nil {
+			l.ErrorContext(ctx, "failed to use recovery code", "error", err)
+		} else if ok {
+			l.WarnContext(ctx, "user logged in with a recovery code")
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return c.recordFailure(ctx, l, user_id, now, ErrInvalidTwoFactorCode)
+	}
+	return nil
+}
+
+// isTOTPCode tells TOTP codes from recovery codes
+func isTOTPCode(code string) bool {
+	if len(code) != auth.TOTPDigits {
+		return false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// useTOTPCode checks code against the secret of f and records its step, so
+// that it is not accepted again
+func (c *AuthControllerImpl) useTOTPCode(ctx context.Context, l *slog.Logger, f *model.TwoFactor, code string, now time.Time) (bool, error) {
+	secret, err := c.openSecret(ctx, l, f)
+	if err != nil {
+		return false, err
+	}
+
+	step, ok, err := auth.VerifyTOTP(secret, code, now)
+	if err != nil {
+		l.ErrorContext(ctx, "failed to verify TOTP code", "error", err)
+		return false, err
+	}
+	if !ok {
+		return false, nil
+	}
+
+	ok, err = c.factors.UseTwoFactorStep(ctx, f.UserID, step)
+	if err != nil {
+		l.ErrorContext(ctx, "failed to use TOTP step", "error", err)
+		return false, err
+	}
+	if !ok {
+		l.InfoContext(ctx, "rejected reused TOTP code")
+	}
+	return ok, nil
+}
+
+// openSecret decrypts the TOTP secret of f
+func (c *AuthControllerImpl) openSecret(ctx context.Context, l *slog.Logger, f *model.TwoFactor) (string, error) {
+	if c.secrets == nil {
+		l.ErrorContext(ctx, "cannot check the second factor without encryption key")
+		return "", ErrTwoFactorUnavailable
+	}
+
+	secret, err := c.secrets.Open(f.Secret)
+	if err != nil {
+		l.ErrorContext(ctx, "failed to decrypt TOTP secret", "error", err)
+		return "", err
+	}
+	return secret, nil
+}
+
+func (c *AuthControllerImpl) EnrollTwoFactor(ctx context.Context, user_id int) (_ *TwoFactorEnrollment, err error) {
+	ctx, span := tracer.Start(ctx, "AuthController.EnrollTwoFactor", trace.WithAttributes(attribute.Int("user.id", user_id)))
+	defer func() { endSpan(span, err) }()
+
+	if c.factors == nil || c.secrets == nil {
+		return nil, ErrTwoFactorUnavailable
+	}
+	l := c.logger(ctx).With("user_id", user_id)
+
+	user, err := c.users.GetById(ctx, user_id)
+	if errors.Is(err, repo.ErrNotFound) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		l.ErrorContext(ctx, "failed to get user", "error", err)
+		return nil, err
+	}
+
+	f, err := c.factors.GetTwoFactor(ctx, user_id)
+	switch {
+	case err == nil && f.Confirmed():
+		return nil, ErrTwoFactorEnabled
+	case err != nil && !errors.Is(err, repo.ErrTwoFactorNotFound):
+		l.ErrorContext(ctx, "failed to get two-factor", "error", err)
+		return nil, err
+	}
+
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		l.ErrorContext(ctx, "failed to generate TOTP secret", "error", err)
+		return nil, err
+	}
+	sealed, err := c.secrets.Seal(secret)
+	if err != nil {
+		l.ErrorContext(ctx, "failed to encrypt TOTP secret", "error", err)
+		return nil, err
+	}
+	if err = c.factors.EnrollTwoFactor(ctx, user_id, sealed); err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			return nil, ErrUserNotFound
+		}
+		l.ErrorContext(ctx, "failed to enroll two-factor", "error", err)
+		return nil, err
+	}
+
+	uri := auth.TOTPURI(c.issuer, user.UserName, secret)
+	qrCode, err := auth.TOTPQRCode(uri)
+	if err != nil {
+		l.ErrorContext(ctx, "failed to encode QR code", "error", err)
+		return nil, err
+	}
+
+	l.InfoContext(ctx, "enrolled two-factor")
+	return &TwoFactorEnrollment{Secret: secret, URI: uri, QRCode: qrCode}, nil
+}
+
+func (c *AuthControllerImpl) ConfirmTwoFactor(ctx context.Context, user_id int, code string) (_ []string, err error) {
+	ctx, span := tracer.Start(ctx, "AuthController.ConfirmTwoFactor", trace.WithAttributes(attribute.Int("user.id", user_id)))
+	defer func() { endSpan(span, err) }()
+
+	if c.factors == nil || c.secrets == nil {
+		return nil, ErrTwoFactorUnavailable
+	}
+	l := c.logger(ctx).With("user_id", user_id)
+
+	f, err := c.factors.GetTwoFactor(ctx, user_id)
+	if errors.Is(err, repo.ErrTwoFactorNotFound) {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+	if err != nil {
+		l.ErrorContext(ctx, "failed to get two-factor", "error", err)
+		return nil, err
+	}
+	if f.Confirmed() {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	secret, err := c.openSecret(ctx, l, f)
+	if err != nil {
+		return nil, err
+	}
+	step, ok, err := auth.VerifyTOTP(secret, strings.TrimSpace(code), c.now())
+	if err != nil {
+		l.ErrorContext(ctx, "failed to verify TOTP code", "error", err)
+		return nil, err
+	}
+	if !ok {
+		l.InfoContext(ctx, "rejected two-factor confirmation")
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	codes, hashes, err := auth.NewRecoveryCodes(RecoveryCodeCount)
+	if err != nil {
+		l.ErrorContext(ctx, "failed to generate recovery codes", "error", err)
+		return nil, err
+	}
+	if err = c.factors.ConfirmTwoFactor(ctx, user_id, step, hashes); err != nil {
+		if errors.Is(err, repo.ErrTwoFactorNotFound) {
+			return nil, ErrTwoFactorNotEnrolled
+		}
+		l.ErrorContext(ctx, "failed to confirm two-factor", "error", err)
+		return nil, err
+	}
+
+	l.InfoContext(ctx, "enabled two-factor")
+	return codes, nil
+}
+
+func (c *AuthControllerImpl) RegenerateRecoveryCodes(ctx context.Context, user_id int, code string) (_ []string, err error) {
+	ctx, span := tracer.Start(ctx, "AuthController.RegenerateRecoveryCodes", trace.WithAttributes(attribute.Int("user.id", user_id)))
+	defer func() { endSpan(span, err) }()
+
+	if c.factors == nil || c.secrets == nil {
+		return nil, ErrTwoFactorUnavailable
+	}
+	l := c.logger(ctx).With("user_id", user_id)
+
+	f, err := c.factors.GetTwoFactor(ctx, user_id)
+	if errors.Is(err, repo.ErrTwoFactorNotFound) || (err == nil && !f.Confirmed()) {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+	if err != nil {
+		l.ErrorContext(ctx, "failed to get two-factor", "error", err)
+		return nil, err
+	}
+
+	// Wrong codes count as failed logins, so that a stolen login token can
+	// not be used to guess them
+	now := c.now()
+	cred, err := c.credentials.GetCredential(ctx, user_id)
+	if err != nil && !errors.Is(err, repo.ErrCredentialNotFound) {
+		l.ErrorContext(ctx, "failed to get credential", "error", err)
+		return nil, err
+	}
+	if cred != nil && cred.LockedUntil.After(now) {
+		return nil, &LockedError{Until: cred.LockedUntil}
+	}
+
+	ok, err := c.useTOTPCode(ctx, l, f, strings.TrimSpace(code), now)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if cred == nil {
+			return nil, ErrInvalidTwoFactorCode
+		}
+		return nil, c.recordFailure(ctx, l, user_id, now, ErrInvalidTwoFactorCode)
+	}
+
+	codes, hashes, err := auth.NewRecoveryCodes(RecoveryCodeCount)
+	if err != nil {
+		l.ErrorContext(ctx, "failed to generate recovery codes", "error", err)
+		return nil, err
+	}
+	if err = c.factors.ReplaceRecoveryCodes(ctx, user_id, hashes); err != nil {
+		if errors.Is(err, repo.ErrTwoFactorNotFound) {
+			return nil, ErrTwoFactorNotEnrolled
+		}
+		l.ErrorContext(ctx, "failed to replace recovery codes", "error", err)
+		return nil, err
+	}
+
+	l.InfoContext(ctx, "regenerated recovery codes")
+	return codes, nil
+}
+
+func (c *AuthControllerImpl) GetTwoFactor(ctx context.Context, user_id int) (_ *TwoFactorStatus, err error) {
+	ctx, span := tracer.Start(ctx, "AuthController.GetTwoFactor", trace.WithAttributes(attribute.Int("user.id", user_id)))
+	defer func() { endSpan(span, err) }()
+
+	if c.factors == nil {
+		return nil, ErrTwoFactorUnavailable
+	}
+	l := c.logger(ctx).With("user_id", user_id)
+
+	if _, err = c.users.GetById(ctx, user_id); err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			return nil, ErrUserNotFound
+		}
+		l.ErrorContext(ctx, "failed to get user", "error", err)
+		return nil, err
+	}
+
+	f, err := c.factors.GetTwoFactor(ctx, user_id)
+	if errors.Is(err, repo.ErrTwoFactorNotFound) {
+		return &TwoFactorStatus{}, nil
+	}
+	if err != nil {
+		l.ErrorContext(ctx, "failed to get two-factor", "error", err)
+		return nil, err
+	}
+
+	status := &TwoFactorStatus{Enabled: f.Confirmed(), Pending: !f.Confirmed(), ConfirmedAt: f.ConfirmedAt}
+	if status.Enabled {
+		if status.RecoveryCodesLeft, err = c.factors.CountRecoveryCodes(ctx, user_id); err != nil {
+			l.ErrorContext(ctx, "failed to count recovery codes", "error", err)
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+func (c *AuthControllerImpl) ResetTwoFactor(ctx context.Context, user_id int) (err error) {
+	ctx, span := tracer.Start(ctx, "AuthController.ResetTwoFactor", trace.WithAttributes(attribute.Int("user.id", user_id)))
+	defer func() { endSpan(span, err) }()
+
+	if c.factors == nil {
+		return ErrTwoFactorUnavailable
+	}
+	l := c.logger(ctx).With("user_id", user_id)
+
+	if _, err = c.users.GetById(ctx, user_id); err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			return ErrUserNotFound
+		}
+		l.ErrorContext(ctx, "failed to get user", "error", err)
+		return err
+	}
+	if err = c.factors.DeleteTwoFactor(ctx, user_id); err != nil {
+		l.ErrorContext(ctx, "failed to reset two-factor", "error", err)
+		return err
+	}
+
+	l.WarnContext(ctx, "reset two-factor")
+	return nil
+}
@@ -1,11 +1,19 @@
 package controller
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"log/slog"
 	"strings"
+	"users-backend/logging"
 	"users-backend/model"
 	"users-backend/repo"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
@@ -14,18 +22,43 @@ var (
 	ErrUsernameCollision   = errors.New("username is already in use")
 
 	_ UserController = new(UserControllerImpl)
+
+	tracer = otel.Tracer("users-backend/controller")
 )
 
 type UserControllerImpl struct {
-	repo repo.UserRepo
+	repo       repo.UserRepo
+	attributes repo.AttributeRepo
+	log        *slog.Logger
+	validator  *Validator
 }
 
-func NewUserController(repo repo.UserRepo) *UserControllerImpl {
-	return &UserControllerImpl{
-		repo: repo,
+// Option configures a UserControllerImpl
+type Option func(c *UserControllerImpl)
+
+// WithValidation replaces the default validation rules
+func WithValidation(cfg ValidationConfig) Option {
+	return func(c *UserControllerImpl) {
+		c.validator = NewValidator(cfg)
 	}
 }
 
+func NewUserController(repo repo.UserRepo, log *slog.Logger, opts ...Option) *UserControllerImpl {
+	c := &UserControllerImpl{
+		repo:      repo,
+		log:       log.With("component", "controller"),
+		validator: NewValidator(DefaultValidationConfig()),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *UserControllerImpl) logger(ctx context.Context) *slog.Logger {
+	return logging.FromContext(ctx, c.log)
+}
+
 func updateUserStatus(userStatus string) (string, error) {
 	if userStatus == "A" || userStatus == "I" || userStatus == "T" {
 		return userStatus, nil
@@ -45,67 +78,281 @@ func updateUserStatus(userStatus string) (string, error) {
 	return "", ErrUserStatusIncorrect
 }
 
-func (c *UserControllerImpl) CreateUser(userName, firstName, lastName, email, userStatus, department string) (int, error) {
+// endSpan records err on the span before ending it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (c *UserControllerImpl) CreateUser(ctx context.Context, userName, firstName, lastName, email, userStatus, department string, managerID int, attributes model.Attributes) (_ int, err error) {
+	ctx, span := tracer.Start(ctx, "UserController.CreateUser")
+	defer func() { endSpan(span, err) }()
+
 	us, err := updateUserStatus(userStatus)
 	if err != nil {
 		return -1, ErrUserStatusIncorrect
 	}
 
-	_, err = c.repo.GetByUsername(userName)
-	if err == nil {
+	f, verr := c.validator.validate(userFields{userName, firstName, lastName, email, department})
+	attributes, attrErrs, aerr := c.checkAttributes(ctx, 0, attributes)
+	if aerr != nil {
+		c.logger(ctx).ErrorContext(ctx, "failed to check attributes", "user_name", userName, "error", aerr)
+		return -1, aerr
+	}
+	managerErrs, merr := c.checkManager(ctx, 0, managerID)
+	if merr != nil {
+		c.logger(ctx).ErrorContext(ctx, "failed to check manager", "user_name", userName, "error", merr)
+		return -1, merr
+	}
+
+	// Unique attributes are checked in the transaction creating the user, once
+	// locked, or two creations could each find the value free and store it
+	var userID int
+	err = c.repo.RunInTx(ctx, func(ctx context.Context) error {
+		uniqueErrs, err := c.checkUniqueAttributes(ctx, 0, attributes)
+		if err != nil {
+			return err
+		}
+		if err := withFieldErrors(verr, append(append(managerErrs, attrErrs...), uniqueErrs...)); err != nil {
+			return err
+		}
+		userName, firstName, lastName, email, department = f.userName, f.firstName, f.lastName, f.email, f.department
+
+		if _, err := c.repo.GetByUsername(ctx, userName); err == nil {
+			return ErrUserAlreadyExists
+		}
+
+		m := &model.User{
+			UserName:   userName,
+			FirstName:  firstName,
+			LastName:   lastName,
+			Email:      email,
+			UserStatus: us,
+			Department: sql.NullString{
+				String: department,
+				Valid:  department != "",
+			},
+			Attributes: attributes,
+			ManagerID:  nullID(managerID),
+		}
+		userID, err = c.repo.Create(ctx, m)
+		return err
+	})
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		c.logger(ctx).InfoContext(ctx, "rejected invalid user", "user_name", userName, "error", err)
+		return -1, err
+	}
+	if errors.Is(err, ErrUserAlreadyExists) || errors.Is(err, repo.ErrDuplicateUserName) {
+		c.logger(ctx).InfoContext(ctx, "rejected duplicate username", "user_name", userName)
 		return -1, ErrUserAlreadyExists
 	}
+	if err != nil {
+		c.logger(ctx).ErrorContext(ctx, "failed to create user", "user_name", userName, "error", err)
+		return -1, err
+	}
 
-	m := &model.User{
-		UserName:   userName,
-		FirstName:  firstName,
-		LastName:   lastName,
-		Email:      email,
-		UserStatus: us,
-		Department: sql.NullString{
-			String: department,
-			Valid:  department != "",
-		},
+	span.SetAttributes(attribute.Int("user.id", userID))
+	c.logger(ctx).InfoContext(ctx, "created user", "user_id", userID, "user_name", userName)
+	return userID, nil
+}
+
+func (c *UserControllerImpl) GetAllUsers(ctx context.Context) (_ *[]model.User, err error) {
+	ctx, span := tracer.Start(ctx, "UserController.GetAllUsers")
+	defer func() { endSpan(span, err) }()
+
+	users, err := c.repo.GetAll(ctx)
+	if err != nil {
+		c.logger(ctx).ErrorContext(ctx, "failed to get all users", "error", err)
+		return nil, err
 	}
 
-	return c.repo.Create(m)
+	return users, nil
 }
 
-func (c *UserControllerImpl) GetAllUsers() (*[]model.User, error) {
-	return c.repo.GetAll()
+func (c *UserControllerImpl) GetUsersByAttributes(ctx context.Context, attributes map[string]string) (_ *[]model.User, err error) {
+	ctx, span := tracer.Start(ctx, "UserController.GetUsersByAttributes")
+	defer func() { endSpan(span, err) }()
+
+	defs, err := c.definitions(ctx)
+	if err != nil {
+		c.logger(ctx).ErrorContext(ctx, "failed to get attributes", "error", err)
+		return nil, err
+	}
+
+	var (
+		errs    []FieldError
+		filters = make(model.Attributes, len(attributes))
+	)
+	for _, name := range sortedKeys(attributes) {
+		def, ok := defs[name]
+		if !ok {
+			errs = append(errs, FieldError{Field: attributeField(name), Rule: "unknown", Message: "is not a defined attribute"})
+			continue
+		}
+
+		v, ferr := parseAttributeValue(def, attributes[name])
+		switch {
+		case ferr != nil:
+			errs = append(errs, *ferr)
+		case v == nil:
+			errs = append(errs, FieldError{Field: attributeField(name), Rule: "required", Message: "is required"})
+		default:
+			filters[name] = v
+		}
+	}
+	if len(errs) > 0 {
+		return nil, &ValidationError{Fields: errs}
+	}
+
+	users, err := c.repo.FindByAttributes(ctx, filters)
+	if err != nil {
+		c.logger(ctx).ErrorContext(ctx, "failed to find users by attributes", "error", err)
+		return nil, err
+	}
+
+	return users, nil
 }
 
-func (c *UserControllerImpl) GetUser(user_id int) (*model.User, error) {
-	return c.repo.GetById(user_id)
+func (c *UserControllerImpl) GetUser(ctx context.Context, user_id int) (_ *model.User, err error) {
+	ctx, span := tracer.Start(ctx, "UserController.GetUser", trace.WithAttributes(attribute.Int("user.id", user_id)))
+	defer func() { endSpan(span, err) }()
+
+	user, err := c.repo.GetById(ctx, user_id)
+	if err != nil {
+		c.logger(ctx).DebugContext(ctx, "failed to get user", "user_id", user_id, "error", err)
+		return nil, err
+	}
+
+	return user, nil
 }
 
-func (c *UserControllerImpl) UpdateUser(user_id int, userName, firstName, lastName, email, userStatus, department string) (int, error) {
+func (c *UserControllerImpl) UpdateUser(ctx context.Context, user_id int, userName, firstName, lastName, email, userStatus, department string, managerID *int, attributes model.Attributes) (_ int, err error) {
+	ctx, span := tracer.Start(ctx, "UserController.UpdateUser", trace.WithAttributes(attribute.Int("user.id", user_id)))
+	defer func() { endSpan(span, err) }()
+
 	us, err := updateUserStatus(userStatus)
 	if err != nil {
 		return -1, ErrUserStatusIncorrect
 	}
 
-	u, err := c.repo.GetByUsername(userName)
-	if err == nil && u.UserName == userName && u.UserID != user_id {
+	f, verr := c.validator.validate(userFields{userName, firstName, lastName, email, department})
+	attributes, attrErrs, aerr := c.checkAttributes(ctx, user_id, attributes)
+	if aerr != nil {
+		c.logger(ctx).ErrorContext(ctx, "failed to check attributes", "user_id", user_id, "error", aerr)
+		return -1, aerr
+	}
+
+	// The manager and unique attributes are checked in the transaction writing
+	// them, once locked, or two updates could each pass and close a cycle or
+	// store the same value together
+	var updatedUserID int
+	err = c.repo.RunInTx(ctx, func(ctx context.Context) error {
+		var (
+			manager     sql.NullInt64
+			managerErrs []FieldError
+			err         error
+		)
+		if managerID == nil {
+			current, err := c.repo.GetById(ctx, user_id)
+			if err != nil {
+				return err
+			}
+			manager = current.ManagerID
+		} else {
+			if *managerID != 0 {
+				if err := c.repo.LockHierarchy(ctx); err != nil {
+					return err
+				}
+			}
+			if managerErrs, err = c.checkManager(ctx, user_id, *managerID); err != nil {
+				return err
+			}
+			manager = nullID(*managerID)
+		}
+		uniqueErrs, err := c.checkUniqueAttributes(ctx, user_id, attributes)
+		if err != nil {
+			return err
+		}
+		if err := withFieldErrors(verr, append(append(managerErrs, attrErrs...), uniqueErrs...)); err != nil {
+			return err
+		}
+		userName, firstName, lastName, email, department = f.userName, f.firstName, f.lastName, f.email, f.department
+
+		u, err := c.repo.GetByUsername(ctx, userName)
+		if err == nil && u.UserName == userName && u.UserID != user_id {
+			return ErrUsernameCollision
+		}
+
+		m := &model.User{
+			UserID:     user_id,
+			UserName:   userName,
+			FirstName:  firstName,
+			LastName:   lastName,
+			Email:      email,
+			UserStatus: us,
+			Department: sql.NullString{
+				String: department,
+				Valid:  department != "",
+			},
+			Attributes: attributes,
+			ManagerID:  manager,
+		}
+		if updatedUserID, err = c.repo.Update(ctx, m); err != nil || us != model.Terminated {
+			return err
+		}
+		return c.reassignReports(ctx, user_id, int(manager.Int64))
+	})
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		c.logger(ctx).InfoContext(ctx, "rejected invalid user", "user_name", userName, "error", err)
+		return -1, err
+	}
+	if errors.Is(err, ErrUsernameCollision) || errors.Is(err, repo.ErrDuplicateUserName) {
+		c.logger(ctx).InfoContext(ctx, "rejected username collision", "user_id", user_id, "user_name", userName)
 		return -1, ErrUsernameCollision
 	}
+	if err != nil {
+		c.logger(ctx).ErrorContext(ctx, "failed to update user", "user_id", user_id, "error", err)
+		return -1, err
+	}
 
-	m := &model.User{
-		UserID:     user_id,
-		UserName:   userName,
-		FirstName:  firstName,
-		LastName:   lastName,
-		Email:      email,
-		UserStatus: us,
-		Department: sql.NullString{
-			String: department,
-			Valid:  department != "",
-		},
+	c.logger(ctx).InfoContext(ctx, "updated user", "user_id", updatedUserID, "user_name", userName)
+	return updatedUserID, nil
+}
+
+func (c *UserControllerImpl) DeleteUser(ctx context.Context, user_id int) (err error) {
+	ctx, span := tracer.Start(ctx, "UserController.DeleteUser", trace.WithAttributes(attribute.Int("user.id", user_id)))
+	defer func() { endSpan(span, err) }()
+
+	err = c.repo.RunInTx(ctx, func(ctx context.Context) error {
+		user, err := c.repo.GetById(ctx, user_id)
+		if errors.Is(err, repo.ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := c.reassignReports(ctx, user_id, int(user.ManagerID.Int64)); err != nil {
+			return err
+		}
+		return c.repo.Delete(ctx, user_id)
+	})
+	if err != nil {
+		c.logger(ctx).ErrorContext(ctx, "failed to delete user", "user_id", user_id, "error", err)
+		return err
 	}
 
-	return c.repo.Update(m)
+	c.logger(ctx).InfoContext(ctx, "deleted user", "user_id", user_id)
+	return nil
 }
 
-func (c *UserControllerImpl) DeleteUser(user_id int) error {
-	return c.repo.Delete(user_id)
+func (c *UserControllerImpl) RunInTx(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	ctx, span := tracer.Start(ctx, "UserController.RunInTx")
+	defer func() { endSpan(span, err) }()
+
+	return c.repo.RunInTx(ctx, fn)
 }
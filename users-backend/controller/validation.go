@@ -0,0 +1,197 @@
+package controller
+
+import (
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+var (
+	// DefaultUserNamePattern allows letters, digits, dots, dashes and
+	// underscores, starting with a letter or digit
+	DefaultUserNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+	// DefaultReservedUserNames can not be registered as they could be mistaken
+	// for the service or its operators
+	DefaultReservedUserNames = []string{"admin", "administrator", "root", "system", "support", "security", "api", "null"}
+)
+
+// ValidationConfig holds the rules user fields are checked against. Lengths
+// are counted in characters and match the columns of model.User.
+type ValidationConfig struct {
+	UserNameMinLength   int
+	UserNameMaxLength   int
+	NameMaxLength       int
+	EmailMaxLength      int
+	DepartmentMaxLength int
+
+	UserNamePattern *regexp.Regexp
+
+	// ReservedUserNames are rejected regardless of case
+	ReservedUserNames []string
+
+	// AllowedEmailDomains restricts emails to these domains and their
+	// subdomains, an empty list allows every domain
+	AllowedEmailDomains []string
+}
+
+func DefaultValidationConfig() ValidationConfig {
+	return ValidationConfig{
+		UserNameMinLength:   3,
+		UserNameMaxLength:   50,
+		NameMaxLength:       255,
+		EmailMaxLength:      255,
+		DepartmentMaxLength: 255,
+		UserNamePattern:     DefaultUserNamePattern,
+		ReservedUserNames:   DefaultReservedUserNames,
+	}
+}
+
+// FieldError describes why a single field was rejected
+type FieldError struct {
+	Field   string
+	Rule    string
+	Message string
+}
+
+// ValidationError is returned when one or more user or tenant fields break
+// the configured rules
+type ValidationError struct {
+	Fields []FieldError
+
+	// entity names what was rejected in the message, user when empty
+	entity string
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = fmt.Sprintf("%s %s", f.Field, f.Message)
+	}
+
+	entity := e.entity
+	if entity == "" {
+		entity = "user"
+	}
+	return "invalid " + entity + ": " + strings.Join(msgs, "; ")
+}
+
+// userFields are the user fields as they are stored, field names match the
+// json names used by the API
+type userFields struct {
+	userName, firstName, lastName, email, department string
+}
+
+// Validator normalizes and checks user fields
+type Validator struct {
+	cfg      ValidationConfig
+	reserved map[string]struct{}
+}
+
+func NewValidator(cfg ValidationConfig) *Validator {
+	reserved := make(map[string]struct{}, len(cfg.ReservedUserNames))
+	for _, n := range cfg.ReservedUserNames {
+		reserved[strings.ToLower(n)] = struct{}{}
+	}
+
+	return &Validator{cfg: cfg, reserved: reserved}
+}
+
+// normalize trims surrounding whitespace and puts names in NFC so the same
+// name typed on different keyboards is stored once. User names use NFKC so
+// compatibility characters such as full-width letters fold to ASCII.
+func (v *Validator) normalize(f userFields) userFields {
+	return userFields{
+		userName:   norm.NFKC.String(strings.TrimSpace(f.userName)),
+		firstName:  norm.NFC.String(strings.TrimSpace(f.firstName)),
+		lastName:   norm.NFC.String(strings.TrimSpace(f.lastName)),
+		email:      strings.TrimSpace(f.email),
+		department: norm.NFC.String(strings.TrimSpace(f.department)),
+	}
+}
+
+// validate normalizes f and checks it, returning the normalized fields or a
+// *ValidationError listing every rejected field
+func (v *Validator) validate(f userFields) (userFields, error) {
+	f = v.normalize(f)
+	var errs []FieldError
+	add := func(field, rule, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Field: field, Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch n := utf8.RuneCountInString(f.userName); {
+	case n < v.cfg.UserNameMinLength:
+		add("user_name", "min", "must be at least %d characters", v.cfg.UserNameMinLength)
+	case n > v.cfg.UserNameMaxLength:
+		add("user_name", "max", "must be at most %d characters", v.cfg.UserNameMaxLength)
+	case v.cfg.UserNamePattern != nil && !v.cfg.UserNamePattern.MatchString(f.userName):
+		add("user_name", "pattern", "may only contain letters, digits, '.', '-' and '_' and must start with a letter or digit")
+	default:
+		if _, ok := v.reserved[strings.ToLower(f.userName)]; ok {
+			add("user_name", "reserved", "is reserved")
+		}
+	}
+
+	for _, name := range []struct{ field, value string }{{"first_name", f.firstName}, {"last_name", f.lastName}} {
+		switch {
+		case name.value == "":
+			add(name.field, "required", "is required")
+		case utf8.RuneCountInString(name.value) > v.cfg.NameMaxLength:
+			add(name.field, "max", "must be at most %d characters", v.cfg.NameMaxLength)
+		case strings.IndexFunc(name.value, unicode.IsControl) >= 0:
+			add(name.field, "printable", "must not contain control characters")
+		}
+	}
+
+	switch {
+	case f.email == "":
+		add("email", "required", "is required")
+	case utf8.RuneCountInString(f.email) > v.cfg.EmailMaxLength:
+		add("email", "max", "must be at most %d characters", v.cfg.EmailMaxLength)
+	case !validEmail(f.email):
+		add("email", "email", "must be a valid email address")
+	case !v.emailDomainAllowed(f.email):
+		add("email", "domain", "must use one of the domains: %s", strings.Join(v.cfg.AllowedEmailDomains, ", "))
+	}
+
+	if utf8.RuneCountInString(f.department) > v.cfg.DepartmentMaxLength {
+		add("department", "max", "must be at most %d characters", v.cfg.DepartmentMaxLength)
+	}
+
+	if len(errs) > 0 {
+		return f, &ValidationError{Fields: errs}
+	}
+	return f, nil
+}
+
+// validEmail accepts a bare address without a display name, the HTTP handler
+// checks emails too but the CLI only goes through the controller
+func validEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
+}
+
+func (v *Validator) emailDomainAllowed(email string) bool {
+	if len(v.cfg.AllowedEmailDomains) == 0 {
+		return true
+	}
+
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+
+	domain := strings.ToLower(email[at+1:])
+	for _, allowed := range v.cfg.AllowedEmailDomains {
+		allowed = strings.ToLower(allowed)
+		if domain == allowed || strings.HasSuffix(domain, "."+allowed) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"users-backend/logging"
+	"users-backend/model"
+)
+
+var _ UserController = new(verificationController)
+
+// verificationController mails a verification link to new emails
+type verificationController struct {
+	UserController
+	accounts AccountController
+	log      *slog.Logger
+}
+
+// pendingVerifications collects the users to mail once the transaction they
+// were written in commits
+type pendingVerifications struct {
+	mu    sync.Mutex
+	users []int
+}
+
+type pendingVerificationsKey struct{}
+
+// WithEmailVerification mails a verification link through accounts when a
+// user is created or its email changes. Failing to send the link is logged
+// and does not fail the write, the link can be sent again. Inside RunInTx the
+// links are only sent once the transaction commits.
+func WithEmailVerification(accounts AccountController, log *slog.Logger) Decorator {
+	return func(next UserController) UserController {
+		return &verificationController{
+			UserController: next,
+			accounts:       accounts,
+			log:            log.With("component", "controller"),
+		}
+	}
+}
+
+func (v *verificationController) sendVerification(ctx context.Context, user_id int) {
+	if p, ok := ctx.Value(pendingVerificationsKey{}).(*pendingVerifications); ok {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if !slices.Contains(p.users, user_id) {
+			p.users = append(p.users, user_id)
+		}
+		return
+	}
+
+	if err := v.accounts.SendEmailVerification(ctx, user_id); err != nil {
+		logging.FromContext(ctx, v.log).WarnContext(ctx, "failed to send email verification", "user_id", user_id, "error", err)
+	}
+}
+
+func (v *verificationController) CreateUser(ctx context.Context, userName, firstName, lastName, email, userStatus, department string, managerID int, attributes model.Attributes) (int, error) {
+	userID, err := v.UserController.CreateUser(ctx, userName, firstName, lastName, email, userStatus, department, managerID, attributes)
+	if err == nil {
+		v.sendVerification(ctx, userID)
+	}
+	return userID, err
+}
+
+func (v *verificationController) UpdateUser(ctx context.Context, user_id int, userName, firstName, lastName, email, userStatus, department string, managerID *int, attributes model.Attributes) (int, error) {
+	// A missing user fails the update below
+	before, _ := v.UserController.GetUser(ctx, user_id)
+
+	userID, err := v.UserController.UpdateUser(ctx, user_id, userName, firstName, lastName, email, userStatus, department, managerID, attributes)
+	if err != nil || before == nil {
+		return userID, err
+	}
+
+	after, err := v.UserController.GetUser(ctx, user_id)
+	if err != nil {
+		logging.FromContext(ctx, v.log).WarnContext(ctx, "failed to get updated user for email verification", "user_id", user_id, "error", err)
+		return userID, nil
+	}
+	if after.Email != before.Email {
+		v.sendVerification(ctx, user_id)
+	}
+	return userID, nil
+}
+
+func (v *verificationController) RunInTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(pendingVerificationsKey{}).(*pendingVerifications); ok {
+		return v.UserController.RunInTx(ctx, fn)
+	}
+
+	p := &pendingVerifications{}
+	if err := v.UserController.RunInTx(context.WithValue(ctx, pendingVerificationsKey{}, p), fn); err != nil {
+		// Rolled back, the users or emails were never written
+		return err
+	}
+
+	for _, user_id := range p.users {
+		v.sendVerification(ctx, user_id)
+	}
+	return nil
+}
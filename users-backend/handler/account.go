@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"users-backend/controller"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	HttpVerifyEmail struct {
+		Token string `json:"token" validate:"required"`
+	}
+
+	HttpPasswordResetRequest struct {
+		UserName string `json:"user_name" validate:"required"`
+	}
+
+	HttpPasswordReset struct {
+		Token    string `json:"token" validate:"required"`
+		Password string `json:"password" validate:"required"`
+	}
+
+	AccountHttpHandler struct {
+		group      *echo.Group
+		users      *echo.Group
+		controller controller.AccountController
+	}
+)
+
+// NewAccountHttpHandler serves the email verification and password reset
+// links under eg and the verification mails of each user under users
+func NewAccountHttpHandler(eg *echo.Group, users *echo.Group, c controller.AccountController) *AccountHttpHandler {
+	return &AccountHttpHandler{
+		group:      eg,
+		users:      users,
+		controller: c,
+	}
+}
+
+func (h *AccountHttpHandler) RegisterRoutes() {
+	h.group.POST("/verify-email", h.VerifyEmail)
+	h.group.POST("/password-reset", h.RequestPasswordReset)
+	h.group.POST("/password-reset/confirm", h.ResetPassword)
+	h.users.POST("/:user_id/email/verification", h.SendEmailVerification)
+}
+
+// @Summary		Mails an email verification link to a user
+// @Description	Mails a single use link verifying the email of the user, the links sent before stop working. New users and users whose email changes are sent one automatically.
+// @ID				SendEmailVerification
+// @Tags			users
+// @Produce		json
+// @Param			user_id	path		int	true	"User ID"
+// @Param			Idempotency-Key	header	string	false	"Replays the original response when a request is retried with the same key"
+// @Success		202		{object}	HttpSuccess
+// @Failure		400		{object}	HttpError
+// @Failure		404		{object}	HttpError
+// @Failure		409		{object}	HttpError	"The email is already verified"
+// @Failure		500		{object}	HttpError
+// @Router			/users/{user_id}/email/verification [POST]
+func (h *AccountHttpHandler) SendEmailVerification(c echo.Context) error {
+	userIdParam := c.Param("user_id")
+	user_id, err := strconv.Atoi(userIdParam)
+	if err != nil {
+		return respError(c, http.StatusBadRequest, "Invalid user_id", fmt.Sprintf("user_id %q is not a valid user_id as it is not a number", userIdParam), ProblemInvalidUserID)
+	}
+
+	err = h.controller.SendEmailVerification(c.Request().Context(), user_id)
+	switch {
+	case errors.Is(err, controller.ErrUserNotFound):
+		return respError(c, http.StatusNotFound, "User not found", fmt.Sprintf("User %q does not exist", userIdParam), ProblemUserNotFound)
+	case errors.Is(err, controller.ErrEmailAlreadyVerified):
+		return respError(c, http.StatusConflict, "Email already verified", fmt.Sprintf("The email of user %s is already verified", userIdParam), ProblemEmailAlreadyVerified)
+	case err != nil:
+		return respError(c, http.StatusInternalServerError, "Internal Server Error", fmt.Sprintf("Unexpected error trying to send the email verification of user %s", userIdParam), ProblemInternal)
+	}
+
+	return respSuccess(c, http.StatusAccepted, success)
+}
+
+// @Summary		Verifies an email
+// @Description	Verifies the email a verification link was mailed to with the token of the link. A token can be used once.
+// @ID				VerifyEmail
+// @Tags			auth
+// @Accept			json
+// @Produce		json,application/problem+json
+// @Param			token	body		HttpVerifyEmail	true	"Token of the link"
+// @Success		200		{object}	HttpSuccess
+// @Failure		400		{object}	HttpError	"Missing, unknown, used or expired token"
+// @Failure		500		{object}	HttpError
+// @Router			/auth/verify-email [POST]
+func (h *AccountHttpHandler) VerifyEmail(c echo.Context) error {
+	body := HttpVerifyEmail{}
+	if err := c.Bind(&body); err != nil {
+		return respError(c, http.StatusBadRequest, "Invalid body", fmt.Sprintf("Invalid body: %v", err), ProblemInvalidBody)
+	}
+	if err := structValidator.Struct(body); err != nil {
+		return respond(c, http.StatusBadRequest, newValidationError(err))
+	}
+
+	err := h.controller.VerifyEmail(c.Request().Context(), body.Token)
+	switch {
+	case errors.Is(err, controller.ErrInvalidAccountToken):
+		return respError(c, http.StatusBadRequest, "Invalid link", "The link is invalid, used or expired", ProblemInvalidLink)
+	case err != nil:
+		return respError(c, http.StatusInternalServerError, "Internal Server Error", "Unexpected error trying to verify the email", ProblemInternal)
+	}
+
+	return respSuccess(c, http.StatusOK, success)
+}
+
+// @Summary		Requests a password reset
+// @Description	Mails a single use password reset link to the user when it is active. The response is the same for unknown users so that it does not tell which accounts exist.
+// @ID				RequestPasswordReset
+// @Tags			auth
+// @Accept			json
+// @Produce		json,application/problem+json
+// @Param			user	body		HttpPasswordResetRequest	true	"User name"
+// @Success		202		{object}	HttpSuccess
+// @Failure		400		{object}	HttpError
+// @Failure		500		{object}	HttpError
+// @Router			/auth/password-reset [POST]
+func (h *AccountHttpHandler) RequestPasswordReset(c echo.Context) error {
+	body := HttpPasswordResetRequest{}
+	if err := c.Bind(&body); err != nil {
+		return respError(c, http.StatusBadRequest, "Invalid body", fmt.Sprintf("Invalid body: %v", err), ProblemInvalidBody)
+	}
+	if err := structValidator.Struct(body); err != nil {
+		return respond(c, http.StatusBadRequest, newValidationError(err))
+	}
+
+	if err := h.controller.RequestPasswordReset(c.Request().Context(), body.UserName); err != nil {
+		return respError(c, http.StatusInternalServerError, "Internal Server Error", "Unexpected error trying to request a password reset", ProblemInternal)
+	}
+
+	return respSuccess(c, http.StatusAccepted, success)
+}
+
+// @Summary		Resets a password
+// @Description	Sets the password of the user a reset link was mailed to with the token of the link, unlocking its account. A rejected password leaves the token usable.
+// @ID				ResetPassword
+// @Tags			auth
+// @Accept			json
+// @Produce		json,application/problem+json
+// @Param			reset	body		HttpPasswordReset	true	"Token of the link and new password"
+// @Success		200		{object}	HttpSuccess
+// @Failure		400		{object}	HttpError	"Invalid token, or HttpProblem with field errors when Accept is application/problem+json"
+// @Failure		500		{object}	HttpError
+// @Router			/auth/password-reset/confirm [POST]
+func (h *AccountHttpHandler) ResetPassword(c echo.Context) error {
+	body := HttpPasswordReset{}
+	if err := c.Bind(&body); err != nil {
+		return respError(c, http.StatusBadRequest, "Invalid body", fmt.Sprintf("Invalid body: %v", err), ProblemInvalidBody)
+	}
+	if err := structValidator.Struct(body); err != nil {
+		return respond(c, http.StatusBadRequest, newValidationError(err))
+	}
+
+	err := h.controller.ResetPassword(c.Request().Context(), body.Token, body.Password)
+	var verr *controller.ValidationError
+	switch {
+	case errors.As(err, &verr):
+		return respond(c, http.StatusBadRequest, newControllerValidationError(verr))
+	case errors.Is(err, controller.ErrInvalidAccountToken), errors.Is(err, controller.ErrUserNotFound):
+		return respError(c, http.StatusBadRequest, "Invalid link", "The link is invalid, used or expired", ProblemInvalidLink)
+	case err != nil:
+		return respError(c, http.StatusInternalServerError, "Internal Server Error", "Unexpected error trying to reset the password", ProblemInternal)
+	}
+
+	return respSuccess(c, http.StatusOK, success)
+}
@@ -0,0 +1,201 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"users-backend/controller"
+	"users-backend/model"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	HttpAttributePost struct {
+		Name     string `json:"name" validate:"required"`
+		Type     string `json:"type" validate:"required" enums:"string,number,date,enum"`
+		Required bool   `json:"required"`
+		Unique   bool   `json:"unique"`
+		// EnumValues are the values allowed for an enum attribute
+		EnumValues []string `json:"enum_values,omitempty"`
+	}
+
+	HttpAttributeIdResponse struct {
+		AttributeID int `json:"attribute_id"`
+	}
+
+	HttpAttributeResponse struct {
+		AttributeID int      `json:"attribute_id"`
+		Name        string   `json:"name"`
+		Type        string   `json:"type" enums:"string,number,date,enum"`
+		Required    bool     `json:"required"`
+		Unique      bool     `json:"unique"`
+		EnumValues  []string `json:"enum_values,omitempty"`
+	}
+
+	AttributeHttpHandler struct {
+		group      *echo.Group
+		controller controller.AttributeController
+	}
+)
+
+var attributeNameTaken = HttpFieldError{Field: "name", Rule: "unique", Message: "is already taken"}
+
+func NewAttributeHttpHandler(eg *echo.Group, c controller.AttributeController) *AttributeHttpHandler {
+	return &AttributeHttpHandler{
+		group:      eg,
+		controller: c,
+	}
+}
+
+func (h *AttributeHttpHandler) RegisterRoutes() {
+	h.group.GET("/:attribute_id", h.GetAttribute)
+	h.group.GET("", h.GetAttributes)
+	h.group.POST("", h.CreateAttribute)
+	h.group.DELETE("/:attribute_id", h.DeleteAttribute)
+}
+
+// @Summary		Define a custom attribute
+// @Description	Define a custom user attribute of the tenant, requires the admin token. Users then carry its value in
+// @Description	their attributes object: strings, numbers, YYYY-MM-DD dates or one of the enum_values.
+// @ID				CreateAttribute
+// @Tags			attributes
+// @Produce		json,application/problem+json
+// @Param			tenant_id	path		int	true	"Tenant ID"
+// @Param			attribute	body		HttpAttributePost	true	"Attribute definition"
+// @Param			Idempotency-Key	header	string	false	"Replays the original response when a request is retried with the same key"
+// @Success		201		{object}	HttpSuccess{data=handler.HttpAttributeIdResponse,code=int,message=string}
+// @Failure		400		{object}	HttpError	"HttpProblem with field errors when Accept is application/problem+json"
+// @Failure		401		{object}	HttpError
+// @Failure		404		{object}	HttpError
+// @Failure		500		{object}	HttpError
+// @Security		AdminToken
+// @Router			/tenants/{tenant_id}/attributes [POST]
+func (h *AttributeHttpHandler) CreateAttribute(c echo.Context) error {
+	body := HttpAttributePost{}
+
+	if err := c.Bind(&body); err != nil {
+		return respError(c, http.StatusBadRequest, "Invalid body", fmt.Sprintf("Invalid body: %v", err), ProblemInvalidBody)
+	}
+	if err := structValidator.Struct(body); err != nil {
+		return respond(c, http.StatusBadRequest, newValidationError(err))
+	}
+
+	attributeID, err := h.controller.CreateAttribute(c.Request().Context(), body.Name, model.AttributeType(body.Type), body.Required, body.Unique, body.EnumValues)
+	if err != nil {
+		return respAttributeError(c, err, body.Name, "create")
+	}
+
+	return respSuccess(c, http.StatusCreated, success, HttpAttributeIdResponse{AttributeID: attributeID})
+}
+
+// @Summary		Gets all the custom attributes
+// @Description	Gets the custom user attributes of the tenant ordered by name, requires the admin token
+// @ID				GetAttributes
+// @Tags			attributes
+// @Produce		json
+// @Param			tenant_id	path		int	true	"Tenant ID"
+// @Success		200		{object}	HttpSuccess{data=handler.HttpAttributeResponse[],code=int,message=string}
+// @Failure		401		{object}	HttpError
+// @Failure		404		{object}	HttpError
+// @Failure		500		{object}	HttpError
+// @Security		AdminToken
+// @Router			/tenants/{tenant_id}/attributes [GET]
+func (h *AttributeHttpHandler) GetAttributes(c echo.Context) error {
+	defs, err := h.controller.GetAttributes(c.Request().Context())
+	if err != nil {
+		return respError(c, http.StatusInternalServerError, "Internal Server Error", "Unexpected error trying to get all attributes", ProblemInternal)
+	}
+
+	var response []HttpAttributeResponse
+	for _, def := range *defs {
+		response = append(response, NewHttpAttributeResponse(def))
+	}
+
+	return respSuccess(c, http.StatusOK, success, response)
+}
+
+// @Summary		Gets a custom attribute
+// @Description	Gets a custom user attribute of the tenant, requires the admin token
+// @ID				GetAttribute
+// @Tags			attributes
+// @Produce		json
+// @Param			tenant_id	path		int	true	"Tenant ID"
+// @Param			attribute_id	path		int	true	"Attribute ID"
+// @Success		200		{object}	HttpSuccess{data=handler.HttpAttributeResponse,code=int,message=string}
+// @Failure		400		{object}	HttpError
+// @Failure		401		{object}	HttpError
+// @Failure		404		{object}	HttpError
+// @Security		AdminToken
+// @Router			/tenants/{tenant_id}/attributes/{attribute_id} [GET]
+func (h *AttributeHttpHandler) GetAttribute(c echo.Context) error {
+	attributeIdParam := c.Param("attribute_id")
+	attribute_id, err := strconv.Atoi(attributeIdParam)
+	if err != nil {
+		return respError(c, http.StatusBadRequest, "Invalid attribute_id", fmt.Sprintf("attribute_id %q is not a valid attribute_id as it is not a number", attributeIdParam), ProblemInvalidAttributeID)
+	}
+
+	def, err := h.controller.GetAttribute(c.Request().Context(), attribute_id)
+	if err != nil {
+		return respAttributeError(c, err, attributeIdParam, "get")
+	}
+
+	return respSuccess(c, http.StatusOK, success, NewHttpAttributeResponse(*def))
+}
+
+// @Summary		Deletes a custom attribute
+// @Description	Deletes a custom user attribute of the tenant and its value from every user, requires the admin token
+// @ID				DeleteAttribute
+// @Tags			attributes
+// @Produce		json
+// @Param			tenant_id	path		int	true	"Tenant ID"
+// @Param			attribute_id	path		int	true	"Attribute ID"
+// @Param			Idempotency-Key	header	string	false	"Replays the original response when a request is retried with the same key"
+// @Success		200		{object}	HttpSuccess
+// @Failure		400		{object}	HttpError
+// @Failure		401		{object}	HttpError
+// @Failure		404		{object}	HttpError
+// @Failure		500		{object}	HttpError
+// @Security		AdminToken
+// @Router			/tenants/{tenant_id}/attributes/{attribute_id} [DELETE]
+func (h *AttributeHttpHandler) DeleteAttribute(c echo.Context) error {
+	attributeIdParam := c.Param("attribute_id")
+	attribute_id, err := strconv.Atoi(attributeIdParam)
+	if err != nil {
+		return respError(c, http.StatusBadRequest, "Invalid attribute_id", fmt.Sprintf("attribute_id %q is not a valid attribute_id as it is not a number", attributeIdParam), ProblemInvalidAttributeID)
+	}
+
+	if err := h.controller.DeleteAttribute(c.Request().Context(), attribute_id); err != nil {
+		return respAttributeError(c, err, attributeIdParam, "delete")
+	}
+
+	return respSuccess(c, http.StatusOK, success)
+}
+
+// respAttributeError maps the controller errors to their response, attribute
+// is the name or id the request was about
+func respAttributeError(c echo.Context, err error, attribute, action string) error {
+	var verr *controller.ValidationError
+	switch {
+	case errors.As(err, &verr):
+		return respond(c, http.StatusBadRequest, newControllerValidationError(verr))
+	case errors.Is(err, controller.ErrAttributeAlreadyExists):
+		return respond(c, http.StatusBadRequest, newFieldError("Attribute already exists", fmt.Sprintf("attribute %s already exists", attribute), ProblemAttributeAlreadyExists, attributeNameTaken))
+	case errors.Is(err, controller.ErrAttributeNotFound):
+		return respError(c, http.StatusNotFound, "Attribute not found", fmt.Sprintf("Attribute %q does not exist", attribute), ProblemAttributeNotFound)
+	default:
+		return respError(c, http.StatusInternalServerError, "Internal Server Error", fmt.Sprintf("Unexpected error trying to %s attribute %s", action, attribute), ProblemInternal)
+	}
+}
+
+func NewHttpAttributeResponse(def model.AttributeDefinition) HttpAttributeResponse {
+	return HttpAttributeResponse{
+		AttributeID: def.AttributeID,
+		Name:        def.Name,
+		Type:        string(def.Type),
+		Required:    def.Required,
+		Unique:      def.Unique,
+		EnumValues:  def.EnumValues,
+	}
+}
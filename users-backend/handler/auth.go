@@ -0,0 +1,292 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"users-backend/auth"
+	"users-backend/controller"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	HttpLogin struct {
+		UserName string `json:"user_name" validate:"required"`
+		Password string `json:"password" validate:"required"`
+		// Code is the TOTP or recovery code of users with a second factor
+		Code string `json:"code,omitempty"`
+	}
+
+	// HttpLoginResponse follows the OAuth 2.0 token response, the token is
+	// sent back as a bearer token
+	HttpLoginResponse struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		// ExpiresIn is the lifetime of the token in seconds
+		ExpiresIn int       `json:"expires_in"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+
+	HttpPasswordPut struct {
+		Password string `json:"password" validate:"required"`
+	}
+
+	HttpPasswordChange struct {
+		CurrentPassword string `json:"current_password" validate:"required"`
+		Password        string `json:"password" validate:"required"`
+	}
+
+	AuthHttpHandler struct {
+		group      *echo.Group
+		admin      *echo.Group
+		controller controller.AuthController
+	}
+)
+
+// NewAuthHttpHandler serves the login and the password of the logged in user
+// under eg and the password of each user of a tenant under admin, a nil group
+// disables its endpoints
+func NewAuthHttpHandler(eg *echo.Group, admin *echo.Group, c controller.AuthController) *AuthHttpHandler {
+	return &AuthHttpHandler{
+		group:      eg,
+		admin:      admin,
+		controller: c,
+	}
+}
+
+func (h *AuthHttpHandler) RegisterRoutes() {
+	if h.group != nil {
+		h.group.POST("/login", h.Login)
+		h.group.PUT("/password", h.ChangePassword, UserTokenMiddleware(h.controller))
+	}
+	if h.admin != nil {
+		h.admin.PUT("/:user_id/password", h.SetPassword)
+		h.admin.DELETE("/:user_id/password", h.DeletePassword)
+	}
+}
+
+// userIDKey is the echo context key UserTokenMiddleware stores the user in
+const userIDKey = "user_id"
+
+// UserTokenMiddleware only lets through requests with the bearer login token
+// of an active user of the tenant, the user is read with authenticatedUser
+func UserTokenMiddleware(ac controller.AuthController) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			token, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+			if !ok {
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+				return respError(c, http.StatusUnauthorized, "Unauthorized", "A login token is required", ProblemUnauthorized)
+			}
+
+			user_id, err := ac.Authenticate(c.Request().Context(), strings.TrimSpace(token))
+			switch {
+			case errors.Is(err, auth.ErrInvalidToken):
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+				return respError(c, http.StatusUnauthorized, "Unauthorized", "The login token is invalid or expired", ProblemUnauthorized)
+			case err != nil:
+				return respError(c, http.StatusInternalServerError, "Internal Server Error", "Unexpected error trying to check the login token", ProblemInternal)
+			}
+
+			c.Set(userIDKey, user_id)
+			return next(c)
+		}
+	}
+}
+
+// loginTenantMiddleware scopes requests with a valid bearer login token to the
+// tenant the token was issued for and leaves the others to tenantMW. Login
+// tokens are not signed with the tenant token secret, TenantFromToken would
+// reject them before UserTokenMiddleware gets to check them.
+func loginTenantMiddleware(ac controller.AuthController, tenantMW echo.MiddlewareFunc) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		resolve := tenantMW(next)
+		return func(c echo.Context) error {
+			if token, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer "); ok {
+				if tenant_id, _, err := ac.VerifyToken(strings.TrimSpace(token)); err == nil {
+					c.SetRequest(c.Request().WithContext(withTenant(c.Request().Context(), tenant_id)))
+					return next(c)
+				}
+			}
+			return resolve(c)
+		}
+	}
+}
+
+// authenticatedUser returns the user let through by UserTokenMiddleware
+func authenticatedUser(c echo.Context) int {
+	user_id, _ := c.Get(userIDKey).(int)
+	return user_id
+}
+
+// @Summary		Logs a user in
+// @Description	Checks the password of a user of the tenant and returns a signed token. Users with a second factor also send a TOTP or recovery code, a first attempt without it fails with the two-factor-required problem type. Accounts are locked for a while after repeated failures, inactive and terminated users can not log in.
+// @ID				Login
+// @Tags			auth
+// @Accept			json
+// @Produce		json,application/problem+json
+// @Param			credentials	body		HttpLogin	true	"User name, password and second factor code"
+// @Success		200		{object}	HttpSuccess{data=handler.HttpLoginResponse,code=int,message=string}
+// @Failure		400		{object}	HttpError
+// @Failure		401		{object}	HttpError	"Unknown user, wrong password, missing or wrong second factor code"
+// @Failure		403		{object}	HttpError	"Account locked, with Retry-After, or disabled"
+// @Failure		500		{object}	HttpError
+// @Failure		503		{object}	HttpError	"The user has a second factor and no encryption key is configured"
+// @Router			/auth/login [POST]
+func (h *AuthHttpHandler) Login(c echo.Context) error {
+	body := HttpLogin{}
+
+	if err := c.Bind(&body); err != nil {
+		return respError(c, http.StatusBadRequest, "Invalid body", fmt.Sprintf("Invalid body: %v", err), ProblemInvalidBody)
+	}
+	if err := structValidator.Struct(body); err != nil {
+		return respond(c, http.StatusBadRequest, newValidationError(err))
+	}
+
+	token, err := h.controller.Login(c.Request().Context(), body.UserName, body.Password, body.Code)
+	var locked *controller.LockedError
+	switch {
+	case errors.Is(err, controller.ErrInvalidCredentials):
+		return respError(c, http.StatusUnauthorized, "Invalid credentials", "The user name or password is wrong", ProblemInvalidCredentials)
+	case errors.Is(err, controller.ErrTwoFactorRequired):
+		return respError(c, http.StatusUnauthorized, "Two-factor code required", "The user has a second factor, send its TOTP or recovery code in code", ProblemTwoFactorRequired)
+	case errors.Is(err, controller.ErrInvalidTwoFactorCode):
+		return respError(c, http.StatusUnauthorized, "Invalid two-factor code", "The TOTP or recovery code is wrong or was already used", ProblemInvalidTwoFactorCode)
+	case errors.As(err, &locked):
+		c.Response().Header().Set(HeaderRetryAfter, strconv.Itoa(int(time.Until(locked.Until).Seconds())+1))
+		return respError(c, http.StatusForbidden, "Account locked", fmt.Sprintf("The account is locked after too many failed logins until %s", locked.Until.UTC().Format(time.RFC3339)), ProblemAccountLocked)
+	case errors.Is(err, controller.ErrAccountDisabled):
+		return respError(c, http.StatusForbidden, "Account disabled", "The account is inactive or terminated", ProblemAccountDisabled)
+	case errors.Is(err, controller.ErrTwoFactorUnavailable):
+		return respError(c, http.StatusServiceUnavailable, "Two-factor unavailable", "The second factor can not be checked, no encryption key is configured", ProblemTwoFactorUnavailable)
+	case err != nil:
+		return respError(c, http.StatusInternalServerError, "Internal Server Error", "Unexpected error trying to log in", ProblemInternal)
+	}
+
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	return respSuccess(c, http.StatusOK, success, HttpLoginResponse{
+		AccessToken: token.Value,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(time.Until(token.ExpiresAt).Seconds()),
+		ExpiresAt:   token.ExpiresAt.UTC(),
+	})
+}
+
+// @Summary		Changes the password of the logged in user
+// @Description	Checks the current password of the user and replaces it with a new one following the password policy. A wrong current password counts as a failed login for the lockout.
+// @ID				ChangePassword
+// @Tags			auth
+// @Accept			json
+// @Produce		json,application/problem+json
+// @Param			password	body		HttpPasswordChange	true	"Current and new password"
+// @Success		200		{object}	HttpSuccess
+// @Failure		400		{object}	HttpError	"HttpProblem with field errors when Accept is application/problem+json"
+// @Failure		401		{object}	HttpError	"Missing or invalid login token, or wrong current password"
+// @Failure		403		{object}	HttpError	"Account locked, with Retry-After"
+// @Failure		500		{object}	HttpError
+// @Security		UserToken
+// @Router			/auth/password [PUT]
+func (h *AuthHttpHandler) ChangePassword(c echo.Context) error {
+	body := HttpPasswordChange{}
+	if err := c.Bind(&body); err != nil {
+		return respError(c, http.StatusBadRequest, "Invalid body", fmt.Sprintf("Invalid body: %v", err), ProblemInvalidBody)
+	}
+	if err := structValidator.Struct(body); err != nil {
+		return respond(c, http.StatusBadRequest, newValidationError(err))
+	}
+
+	err := h.controller.ChangePassword(c.Request().Context(), authenticatedUser(c), body.CurrentPassword, body.Password)
+	var verr *controller.ValidationError
+	var locked *controller.LockedError
+	switch {
+	case errors.As(err, &verr):
+		return respond(c, http.StatusBadRequest, newControllerValidationError(verr))
+	case errors.Is(err, controller.ErrInvalidCredentials):
+		return respError(c, http.StatusUnauthorized, "Invalid credentials", "The current password is wrong", ProblemInvalidCredentials)
+	case errors.As(err, &locked):
+		c.Response().Header().Set(HeaderRetryAfter, strconv.Itoa(int(time.Until(locked.Until).Seconds())+1))
+		return respError(c, http.StatusForbidden, "Account locked", fmt.Sprintf("The account is locked after too many failed logins until %s", locked.Until.UTC().Format(time.RFC3339)), ProblemAccountLocked)
+	case err != nil:
+		return respError(c, http.StatusInternalServerError, "Internal Server Error", "Unexpected error trying to change the password", ProblemInternal)
+	}
+
+	return respSuccess(c, http.StatusOK, success)
+}
+
+// @Summary		Sets the password of a user
+// @Description	Checks the password against the password policy and replaces the password of a user of the tenant, unlocking its account. Requires the admin token.
+// @ID				SetPassword
+// @Tags			users
+// @Accept			json
+// @Produce		json,application/problem+json
+// @Param			tenant_id	path		int				true	"Tenant ID"
+// @Param			user_id		path		int				true	"User ID"
+// @Param			password	body		HttpPasswordPut	true	"New password"
+// @Param			Idempotency-Key	header	string	false	"Replays the original response when a request is retried with the same key"
+// @Success		200		{object}	HttpSuccess
+// @Failure		400		{object}	HttpError	"HttpProblem with field errors when Accept is application/problem+json"
+// @Failure		401		{object}	HttpError
+// @Failure		404		{object}	HttpError
+// @Failure		500		{object}	HttpError
+// @Security		AdminToken
+// @Router			/tenants/{tenant_id}/users/{user_id}/password [PUT]
+func (h *AuthHttpHandler) SetPassword(c echo.Context) error {
+	userIdParam := c.Param("user_id")
+	user_id, err := strconv.Atoi(userIdParam)
+	if err != nil {
+		return respError(c, http.StatusBadRequest, "Invalid user_id", fmt.Sprintf("user_id %q is not a valid user_id as it is not a number", userIdParam), ProblemInvalidUserID)
+	}
+
+	body := HttpPasswordPut{}
+	if err := c.Bind(&body); err != nil {
+		return respError(c, http.StatusBadRequest, "Invalid body", fmt.Sprintf("Invalid body: %v", err), ProblemInvalidBody)
+	}
+	if err := structValidator.Struct(body); err != nil {
+		return respond(c, http.StatusBadRequest, newValidationError(err))
+	}
+
+	err = h.controller.SetPassword(c.Request().Context(), user_id, body.Password)
+	var verr *controller.ValidationError
+	switch {
+	case errors.As(err, &verr):
+		return respond(c, http.StatusBadRequest, newControllerValidationError(verr))
+	case errors.Is(err, controller.ErrUserNotFound):
+		return respError(c, http.StatusNotFound, "User not found", fmt.Sprintf("User %q does not exist", userIdParam), ProblemUserNotFound)
+	case err != nil:
+		return respError(c, http.StatusInternalServerError, "Internal Server Error", fmt.Sprintf("Unexpected error trying to set the password of user %s", userIdParam), ProblemInternal)
+	}
+
+	return respSuccess(c, http.StatusOK, success)
+}
+
+// @Summary		Deletes the password of a user
+// @Description	Removes the password of a user of the tenant, who can no longer log in. Succeeds when the user has no password. Requires the admin token.
+// @ID				DeletePassword
+// @Tags			users
+// @Produce		json
+// @Param			tenant_id	path		int	true	"Tenant ID"
+// @Param			user_id	path		int	true	"User ID"
+// @Param			Idempotency-Key	header	string	false	"Replays the original response when a request is retried with the same key"
+// @Success		200		{object}	HttpSuccess
+// @Failure		400		{object}	HttpError
+// @Failure		401		{object}	HttpError
+// @Failure		500		{object}	HttpError
+// @Security		AdminToken
+// @Router			/tenants/{tenant_id}/users/{user_id}/password [DELETE]
+func (h *AuthHttpHandler) DeletePassword(c echo.Context) error {
+	userIdParam := c.Param("user_id")
+	user_id, err := strconv.Atoi(userIdParam)
+	if err != nil {
+		return respError(c, http.StatusBadRequest, "Invalid user_id", fmt.Sprintf("user_id %q is not a valid user_id as it is not a number", userIdParam), ProblemInvalidUserID)
+	}
+
+	if err := h.controller.DeletePassword(c.Request().Context(), user_id); err != nil {
+		return respError(c, http.StatusInternalServerError, "Internal Server Error", fmt.Sprintf("Unexpected error trying to delete the password of user %s", userIdParam), ProblemInternal)
+	}
+
+	return respSuccess(c, http.StatusOK, success)
+}
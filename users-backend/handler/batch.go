@@ -0,0 +1,225 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"users-backend/repo"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	batchCreate = "create"
+	batchUpdate = "update"
+	batchPatch  = "patch"
+	batchDelete = "delete"
+)
+
+var errBatchRolledBack = errors.New("batch rolled back")
+
+type (
+	HttpBatchOperation struct {
+		Op     string          `json:"op" validate:"required,oneof=create update patch delete" enums:"create,update,patch,delete"`
+		UserID int             `json:"user_id,omitempty"`
+		Body   json.RawMessage `json:"body,omitempty" swaggertype:"object"`
+	}
+
+	HttpBatchRequest struct {
+		Atomic     bool                 `json:"atomic"`
+		Operations []HttpBatchOperation `json:"operations" validate:"required,min=1,max=100,dive"`
+	}
+
+	HttpUserPatch struct {
+		UserName   *string `json:"user_name,omitempty" validate:"omitempty,min=1"`
+		FirstName  *string `json:"first_name,omitempty" validate:"omitempty,min=1"`
+		LastName   *string `json:"last_name,omitempty" validate:"omitempty,min=1"`
+		Email      *string `json:"email,omitempty" validate:"omitempty,email"`
+		UserStatus *string `json:"user_status,omitempty" validate:"omitempty,min=1"`
+		Department *string `json:"department,omitempty"`
+		// ManagerID replaces the manager of the user, 0 or null removes it
+		ManagerID *int `json:"manager_id,omitempty" validate:"omitempty,min=0"`
+		// Attributes are merged into the custom attributes of the user, a null
+		// value removes the attribute
+		Attributes map[string]interface{} `json:"attributes,omitempty" swaggertype:"object"`
+	}
+
+	HttpBatchResult struct {
+		Index  int         `json:"index"`
+		Op     string      `json:"op"`
+		Status int         `json:"status"`
+		Body   interface{} `json:"body"`
+	}
+
+	HttpBatchResponse struct {
+		Atomic    bool              `json:"atomic"`
+		Committed bool              `json:"committed"`
+		Results   []HttpBatchResult `json:"results"`
+	}
+)
+
+// @Summary		Applies several operations at once
+// @Description	Runs create, update, patch and delete operations in order. Each result has the status and body the single
+// @Description	endpoint would have returned. With atomic=true (body or query) every operation runs in one transaction and
+// @Description	the first failure rolls back the whole batch, the other operations are then reported with a 424.
+// @ID				BatchUsers
+// @Tags			users
+// @Produce		json,application/problem+json
+// @Param			batch	body		HttpBatchRequest	true	"Operations"
+// @Param			atomic	query		bool				false	"Run every operation in a single transaction"
+// @Param			Idempotency-Key	header	string	false	"Replays the original response when a request is retried with the same key"
+// @Success		200		{object}	HttpSuccess{data=handler.HttpBatchResponse,code=int,message=string}
+// @Failure		400		{object}	HttpError	"HttpProblem with field errors when Accept is application/problem+json"
+// @Failure		500		{object}	HttpError
+// @Router			/users/batch [POST]
+func (h *UserHttpHandler) Batch(c echo.Context) error {
+	body := HttpBatchRequest{}
+
+	if err := c.Bind(&body); err != nil {
+		return respError(c, http.StatusBadRequest, "Invalid body", fmt.Sprintf("Invalid body: %v", err), ProblemInvalidBody)
+	}
+	if err := structValidator.Struct(body); err != nil {
+		return respond(c, http.StatusBadRequest, newValidationError(err))
+	}
+
+	atomic := body.Atomic || c.QueryParam("atomic") == "true"
+	results := make([]HttpBatchResult, len(body.Operations))
+	failed := -1
+
+	run := func(ctx context.Context) error {
+		for i, op := range body.Operations {
+			status, resp := h.runBatchOperation(ctx, op)
+			results[i] = HttpBatchResult{Index: i, Op: op.Op, Status: status, Body: problemBody(c, resp)}
+
+			if atomic && status >= http.StatusBadRequest {
+				failed = i
+				return errBatchRolledBack
+			}
+		}
+		return nil
+	}
+
+	ctx := c.Request().Context()
+	if !atomic {
+		run(ctx)
+		return respSuccess(c, http.StatusOK, success, HttpBatchResponse{Atomic: false, Committed: true, Results: results})
+	}
+
+	err := h.controller.RunInTx(ctx, run)
+	if err != nil && !errors.Is(err, errBatchRolledBack) {
+		return respError(c, http.StatusInternalServerError, "Internal Server Error", "Unexpected error trying to commit the batch", ProblemInternal)
+	}
+
+	if failed < 0 {
+		return respSuccess(c, http.StatusOK, success, HttpBatchResponse{Atomic: true, Committed: true, Results: results})
+	}
+
+	for i, op := range body.Operations {
+		if i == failed {
+			continue
+		}
+
+		details := fmt.Sprintf("Operation rolled back because operation %d failed", failed)
+		if i > failed {
+			details = fmt.Sprintf("Operation not run because operation %d failed", failed)
+		}
+		results[i] = HttpBatchResult{Index: i, Op: op.Op, Status: http.StatusFailedDependency, Body: problemBody(c, newHttpError(http.StatusFailedDependency, "Batch rolled back", details, ProblemBatchRolledBack))}
+	}
+
+	return respSuccess(c, http.StatusOK, "Rolled back", HttpBatchResponse{Atomic: true, Committed: false, Results: results})
+}
+
+// runBatchOperation runs one operation through the same validation and error
+// mapping as the single user endpoints
+func (h *UserHttpHandler) runBatchOperation(ctx context.Context, op HttpBatchOperation) (int, interface{}) {
+	invalidBody := func(err error) (int, interface{}) {
+		return http.StatusBadRequest, newHttpError(http.StatusBadRequest, "Invalid body", fmt.Sprintf("Invalid body: %v", err), ProblemInvalidBody)
+	}
+
+	switch op.Op {
+	case batchCreate:
+		body := HttpUserPost{}
+		if err := json.Unmarshal(op.Body, &body); err != nil {
+			return invalidBody(err)
+		}
+		return h.createUser(ctx, body)
+	case batchUpdate:
+		body := HttpUserPut{}
+		if err := json.Unmarshal(op.Body, &body); err != nil {
+			return invalidBody(err)
+		}
+		return h.updateUser(ctx, body)
+	case batchPatch:
+		body := HttpUserPatch{}
+		if err := json.Unmarshal(op.Body, &body); err != nil {
+			return invalidBody(err)
+		}
+		return h.patchUser(ctx, op.UserID, body)
+	case batchDelete:
+		return h.deleteUser(ctx, op.UserID)
+	default:
+		return http.StatusBadRequest, newHttpError(http.StatusBadRequest, "Invalid operation", fmt.Sprintf("Operation %q is not one of create, update, patch, delete", op.Op), ProblemInvalidOperation)
+	}
+}
+
+// patchUser applies the fields present in body on top of the stored user and
+// saves it as a full update
+func (h *UserHttpHandler) patchUser(ctx context.Context, user_id int, body HttpUserPatch) (int, interface{}) {
+	if err := structValidator.Struct(body); err != nil {
+		return http.StatusBadRequest, newValidationError(err)
+	}
+
+	user, err := h.controller.GetUser(ctx, user_id)
+	if errors.Is(err, repo.ErrNotFound) {
+		return http.StatusNotFound, newHttpError(http.StatusNotFound, "User not found", fmt.Sprintf("User %d does not exist", user_id), ProblemUserNotFound)
+	}
+	if err != nil {
+		return http.StatusInternalServerError, newHttpError(http.StatusInternalServerError, "Internal Server Error", fmt.Sprintf("Unexpected error trying to get user %d", user_id), ProblemInternal)
+	}
+
+	put := HttpUserPut{
+		UserID:     user.UserID,
+		UserName:   user.UserName,
+		FirstName:  user.FirstName,
+		LastName:   user.LastName,
+		Email:      user.Email,
+		UserStatus: user.UserStatus,
+		Department: nullStringToPointer(user.Department),
+		ManagerID:  body.ManagerID,
+	}
+	if body.UserName != nil {
+		put.UserName = *body.UserName
+	}
+	if body.FirstName != nil {
+		put.FirstName = *body.FirstName
+	}
+	if body.LastName != nil {
+		put.LastName = *body.LastName
+	}
+	if body.Email != nil {
+		put.Email = *body.Email
+	}
+	if body.UserStatus != nil {
+		put.UserStatus = *body.UserStatus
+	}
+	if body.Department != nil {
+		put.Department = body.Department
+	}
+	if body.Attributes != nil {
+		put.Attributes = make(map[string]interface{}, len(user.Attributes)+len(body.Attributes))
+		for name, v := range user.Attributes {
+			put.Attributes[name] = v
+		}
+		for name, v := range body.Attributes {
+			if v == nil {
+				delete(put.Attributes, name)
+			} else {
+				put.Attributes[name] = v
+			}
+		}
+	}
+
+	return h.updateUser(ctx, put)
+}
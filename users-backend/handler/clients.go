@@ -0,0 +1,264 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+	"users-backend/controller"
+	"users-backend/model"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	HttpClientPost struct {
+		Name string `json:"name" validate:"required"`
+		// RedirectURIs are the only URIs codes are sent to, https or http on
+		// a loopback address
+		RedirectURIs []string `json:"redirect_uris" validate:"required"`
+		// Public clients, such as single page and mobile apps, get no secret
+		// and rely on PKCE alone
+		Public bool `json:"public"`
+	}
+
+	HttpClientPut struct {
+		Name         string   `json:"name" validate:"required"`
+		RedirectURIs []string `json:"redirect_uris" validate:"required"`
+	}
+
+	HttpClientResponse struct {
+		ClientID     string    `json:"client_id"`
+		Name         string    `json:"name"`
+		RedirectURIs []string  `json:"redirect_uris"`
+		Public       bool      `json:"public"`
+		CreatedAt    time.Time `json:"created_at"`
+		// ClientSecret is only returned when the client is created or its
+		// secret rotated, it can not be read again
+		ClientSecret string `json:"client_secret,omitempty"`
+	}
+
+	HttpClientSecretResponse struct {
+		ClientSecret string `json:"client_secret"`
+	}
+
+	ClientHttpHandler struct {
+		group      *echo.Group
+		controller controller.OIDCController
+	}
+)
+
+func NewClientHttpHandler(eg *echo.Group, c controller.OIDCController) *ClientHttpHandler {
+	return &ClientHttpHandler{
+		group:      eg,
+		controller: c,
+	}
+}
+
+func (h *ClientHttpHandler) RegisterRoutes() {
+	h.group.GET("", h.GetClients)
+	h.group.POST("", h.CreateClient)
+	h.group.GET("/:client_id", h.GetClient)
+	h.group.PUT("/:client_id", h.UpdateClient)
+	h.group.DELETE("/:client_id", h.DeleteClient)
+	h.group.POST("/:client_id/secret", h.RotateClientSecret)
+}
+
+func NewHttpClientResponse(c *model.OAuthClient) HttpClientResponse {
+	return HttpClientResponse{
+		ClientID:     c.ClientID,
+		Name:         c.Name,
+		RedirectURIs: c.RedirectURIs,
+		Public:       c.Public(),
+		CreatedAt:    c.CreatedAt.UTC(),
+	}
+}
+
+// respClientError maps the controller errors to their response, client is
+// the name or id the request was about
+func respClientError(c echo.Context, err error, client, action string) error {
+	var verr *controller.ValidationError
+	switch {
+	case errors.As(err, &verr):
+		return respond(c, http.StatusBadRequest, newControllerValidationError(verr))
+	case errors.Is(err, controller.ErrClientNotFound):
+		return respError(c, http.StatusNotFound, "Client not found", fmt.Sprintf("Client %q does not exist", client), ProblemClientNotFound)
+	case errors.Is(err, controller.ErrPublicClient):
+		return respError(c, http.StatusConflict, "Public client", fmt.Sprintf("Client %q is public and has no secret", client), ProblemPublicClient)
+	default:
+		return respError(c, http.StatusInternalServerError, "Internal Server Error", fmt.Sprintf("Unexpected error trying to %s client %s", action, client), ProblemInternal)
+	}
+}
+
+// @Summary		Registers an OpenID Connect client
+// @Description	Registers an application logging the users of the tenant in, requires the admin token. The client secret
+// @Description	of a confidential client is only returned in this response.
+// @ID				CreateClient
+// @Tags			clients
+// @Accept			json
+// @Produce		json,application/problem+json
+// @Param			tenant_id	path		int				true	"Tenant ID"
+// @Param			client		body		HttpClientPost	true	"Client"
+// @Success		201		{object}	HttpSuccess{data=handler.HttpClientResponse,code=int,message=string}
+// @Failure		400		{object}	HttpError	"HttpProblem with field errors when Accept is application/problem+json"
+// @Failure		401		{object}	HttpError
+// @Failure		404		{object}	HttpError
+// @Failure		500		{object}	HttpError
+// @Security		AdminToken
+// @Router			/tenants/{tenant_id}/oauth-clients [POST]
+func (h *ClientHttpHandler) CreateClient(c echo.Context) error {
+	body := HttpClientPost{}
+
+	if err := c.Bind(&body); err != nil {
+		return respError(c, http.StatusBadRequest, "Invalid body", fmt.Sprintf("Invalid body: %v", err), ProblemInvalidBody)
+	}
+	if err := structValidator.Struct(body); err != nil {
+		return respond(c, http.StatusBadRequest, newValidationError(err))
+	}
+
+	client, secret, err := h.controller.CreateClient(c.Request().Context(), body.Name, body.RedirectURIs, body.Public)
+	if err != nil {
+		return respClientError(c, err, body.Name, "create")
+	}
+
+	response := NewHttpClientResponse(client)
+	response.ClientSecret = secret
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	return respSuccess(c, http.StatusCreated, success, response)
+}
+
+// @Summary		Gets all the OpenID Connect clients
+// @Description	Gets the clients of the tenant ordered by name, requires the admin token
+// @ID				GetClients
+// @Tags			clients
+// @Produce		json
+// @Param			tenant_id	path		int	true	"Tenant ID"
+// @Success		200		{object}	HttpSuccess{data=handler.HttpClientResponse[],code=int,message=string}
+// @Failure		401		{object}	HttpError
+// @Failure		404		{object}	HttpError
+// @Failure		500		{object}	HttpError
+// @Security		AdminToken
+// @Router			/tenants/{tenant_id}/oauth-clients [GET]
+func (h *ClientHttpHandler) GetClients(c echo.Context) error {
+	clients, err := h.controller.GetClients(c.Request().Context())
+	if err != nil {
+		return respError(c, http.StatusInternalServerError, "Internal Server Error", "Unexpected error trying to get all clients", ProblemInternal)
+	}
+
+	response := []HttpClientResponse{}
+	for i := range *clients {
+		response = append(response, NewHttpClientResponse(&(*clients)[i]))
+	}
+
+	return respSuccess(c, http.StatusOK, success, response)
+}
+
+// @Summary		Gets an OpenID Connect client
+// @Description	Gets a client of the tenant without its secret, requires the admin token
+// @ID				GetClient
+// @Tags			clients
+// @Produce		json
+// @Param			tenant_id	path		int		true	"Tenant ID"
+// @Param			client_id	path		string	true	"Client ID"
+// @Success		200		{object}	HttpSuccess{data=handler.HttpClientResponse,code=int,message=string}
+// @Failure		401		{object}	HttpError
+// @Failure		404		{object}	HttpError
+// @Failure		500		{object}	HttpError
+// @Security		AdminToken
+// @Router			/tenants/{tenant_id}/oauth-clients/{client_id} [GET]
+func (h *ClientHttpHandler) GetClient(c echo.Context) error {
+	client_id := c.Param("client_id")
+
+	client, err := h.controller.GetClient(c.Request().Context(), client_id)
+	if err != nil {
+		return respClientError(c, err, client_id, "get")
+	}
+
+	return respSuccess(c, http.StatusOK, success, NewHttpClientResponse(client))
+}
+
+// @Summary		Updates an OpenID Connect client
+// @Description	Replaces the name and redirect URIs of a client of the tenant, requires the admin token
+// @ID				UpdateClient
+// @Tags			clients
+// @Accept			json
+// @Produce		json,application/problem+json
+// @Param			tenant_id	path		int				true	"Tenant ID"
+// @Param			client_id	path		string			true	"Client ID"
+// @Param			client		body		HttpClientPut	true	"Client"
+// @Success		200		{object}	HttpSuccess{data=handler.HttpClientResponse,code=int,message=string}
+// @Failure		400		{object}	HttpError	"HttpProblem with field errors when Accept is application/problem+json"
+// @Failure		401		{object}	HttpError
+// @Failure		404		{object}	HttpError
+// @Failure		500		{object}	HttpError
+// @Security		AdminToken
+// @Router			/tenants/{tenant_id}/oauth-clients/{client_id} [PUT]
+func (h *ClientHttpHandler) UpdateClient(c echo.Context) error {
+	client_id := c.Param("client_id")
+
+	body := HttpClientPut{}
+	if err := c.Bind(&body); err != nil {
+		return respError(c, http.StatusBadRequest, "Invalid body", fmt.Sprintf("Invalid body: %v", err), ProblemInvalidBody)
+	}
+	if err := structValidator.Struct(body); err != nil {
+		return respond(c, http.StatusBadRequest, newValidationError(err))
+	}
+
+	client, err := h.controller.UpdateClient(c.Request().Context(), client_id, body.Name, body.RedirectURIs)
+	if err != nil {
+		return respClientError(c, err, client_id, "update")
+	}
+
+	return respSuccess(c, http.StatusOK, success, NewHttpClientResponse(client))
+}
+
+// @Summary		Rotates the secret of an OpenID Connect client
+// @Description	Replaces the secret of a confidential client of the tenant and returns it once, requires the admin token.
+// @Description	The old secret stops working right away.
+// @ID				RotateClientSecret
+// @Tags			clients
+// @Produce		json
+// @Param			tenant_id	path		int		true	"Tenant ID"
+// @Param			client_id	path		string	true	"Client ID"
+// @Success		200		{object}	HttpSuccess{data=handler.HttpClientSecretResponse,code=int,message=string}
+// @Failure		401		{object}	HttpError
+// @Failure		404		{object}	HttpError
+// @Failure		409		{object}	HttpError	"The client is public"
+// @Failure		500		{object}	HttpError
+// @Security		AdminToken
+// @Router			/tenants/{tenant_id}/oauth-clients/{client_id}/secret [POST]
+func (h *ClientHttpHandler) RotateClientSecret(c echo.Context) error {
+	client_id := c.Param("client_id")
+
+	secret, err := h.controller.RotateClientSecret(c.Request().Context(), client_id)
+	if err != nil {
+		return respClientError(c, err, client_id, "rotate the secret of")
+	}
+
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	return respSuccess(c, http.StatusOK, success, HttpClientSecretResponse{ClientSecret: secret})
+}
+
+// @Summary		Deletes an OpenID Connect client
+// @Description	Deletes a client of the tenant, requires the admin token. Its pending codes and the access tokens it was
+// @Description	issued stop working.
+// @ID				DeleteClient
+// @Tags			clients
+// @Produce		json
+// @Param			tenant_id	path		int		true	"Tenant ID"
+// @Param			client_id	path		string	true	"Client ID"
+// @Success		200		{object}	HttpSuccess
+// @Failure		401		{object}	HttpError
+// @Failure		404		{object}	HttpError
+// @Failure		500		{object}	HttpError
+// @Security		AdminToken
+// @Router			/tenants/{tenant_id}/oauth-clients/{client_id} [DELETE]
+func (h *ClientHttpHandler) DeleteClient(c echo.Context) error {
+	client_id := c.Param("client_id")
+
+	if err := h.controller.DeleteClient(c.Request().Context(), client_id); err != nil {
+		return respClientError(c, err, client_id, "delete")
+	}
+
+	return respSuccess(c, http.StatusOK, success)
+}
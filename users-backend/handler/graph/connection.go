@@ -0,0 +1,188 @@
+package graph
+
+import (
+	"encoding/base64"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"users-backend/model"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+
+	cursorPrefix = "cursor:"
+
+	sortUserID    = "user_id"
+	sortUserName  = "user_name"
+	sortFirstName = "first_name"
+	sortLastName  = "last_name"
+	sortEmail     = "email"
+
+	sortAsc  = "asc"
+	sortDesc = "desc"
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+type (
+	userFilter struct {
+		userName   string
+		firstName  string
+		lastName   string
+		email      string
+		userStatus string
+		department *string
+	}
+
+	userSort struct {
+		field     string
+		direction string
+	}
+)
+
+func newUserFilter(arg interface{}) userFilter {
+	args, _ := arg.(map[string]interface{})
+
+	f := userFilter{
+		userName:   strings.ToLower(stringArg(args, "userName")),
+		firstName:  strings.ToLower(stringArg(args, "firstName")),
+		lastName:   strings.ToLower(stringArg(args, "lastName")),
+		email:      strings.ToLower(stringArg(args, "email")),
+		userStatus: stringArg(args, "userStatus"),
+	}
+	if dept, ok := args["department"].(string); ok {
+		f.department = &dept
+	}
+
+	return f
+}
+
+func (f userFilter) matches(u model.User) bool {
+	if !containsFold(u.UserName, f.userName) ||
+		!containsFold(u.FirstName, f.firstName) ||
+		!containsFold(u.LastName, f.lastName) ||
+		!containsFold(u.Email, f.email) {
+		return false
+	}
+	if f.userStatus != "" && u.UserStatus != f.userStatus {
+		return false
+	}
+	if f.department != nil && u.Department.String != *f.department {
+		return false
+	}
+
+	return true
+}
+
+func containsFold(s, lowerSubstr string) bool {
+	return lowerSubstr == "" || strings.Contains(strings.ToLower(s), lowerSubstr)
+}
+
+func filterUsers(users []model.User, f userFilter) []model.User {
+	filtered := make([]model.User, 0, len(users))
+	for _, u := range users {
+		if f.matches(u) {
+			filtered = append(filtered, u)
+		}
+	}
+
+	return filtered
+}
+
+func newUserSort(arg interface{}) userSort {
+	args, _ := arg.(map[string]interface{})
+
+	s := userSort{field: sortUserID, direction: sortAsc}
+	if field, ok := args["field"].(string); ok {
+		s.field = field
+	}
+	if direction, ok := args["direction"].(string); ok {
+		s.direction = direction
+	}
+
+	return s
+}
+
+func sortUsers(users []model.User, s userSort) {
+	less := func(a, b model.User) bool {
+		switch s.field {
+		case sortUserName:
+			return a.UserName < b.UserName
+		case sortFirstName:
+			return a.FirstName < b.FirstName
+		case sortLastName:
+			return a.LastName < b.LastName
+		case sortEmail:
+			return a.Email < b.Email
+		default:
+			return a.UserID < b.UserID
+		}
+	}
+
+	sort.SliceStable(users, func(i, j int) bool {
+		if s.direction == sortDesc {
+			return less(users[j], users[i])
+		}
+		return less(users[i], users[j])
+	})
+}
+
+// newConnection slices a page of "first" users starting at offset into the
+// relay style connection shape. Cursors encode the position in the filtered
+// and sorted list, so they are only stable for the same filter and sort.
+func newConnection(users []model.User, offset, first int) map[string]interface{} {
+	if offset > len(users) {
+		offset = len(users)
+	}
+	end := offset + first
+	if end > len(users) {
+		end = len(users)
+	}
+
+	edges := make([]map[string]interface{}, 0, end-offset)
+	for i := offset; i < end; i++ {
+		u := users[i]
+		edges = append(edges, map[string]interface{}{
+			"cursor": encodeCursor(i),
+			"node":   &u,
+		})
+	}
+
+	pageInfo := map[string]interface{}{
+		"hasNextPage":     end < len(users),
+		"hasPreviousPage": offset > 0,
+		"startCursor":     nil,
+		"endCursor":       nil,
+	}
+	if len(edges) > 0 {
+		pageInfo["startCursor"] = edges[0]["cursor"]
+		pageInfo["endCursor"] = edges[len(edges)-1]["cursor"]
+	}
+
+	return map[string]interface{}{
+		"edges":      edges,
+		"pageInfo":   pageInfo,
+		"totalCount": len(users),
+	}
+}
+
+func encodeCursor(offset int) string {
+	return base64.StdEncoding.EncodeToString([]byte(cursorPrefix + strconv.Itoa(offset)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	b, err := base64.StdEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, errInvalidCursor
+	}
+
+	offset, err := strconv.Atoi(strings.TrimPrefix(string(b), cursorPrefix))
+	if err != nil || offset < 0 || !strings.HasPrefix(string(b), cursorPrefix) {
+		return 0, errInvalidCursor
+	}
+
+	return offset, nil
+}
@@ -0,0 +1,120 @@
+package graph
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"users-backend/controller"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/labstack/echo/v4"
+)
+
+var errMutationOverGet = errors.New("mutations must be sent with POST")
+
+type (
+	GraphRequest struct {
+		Query         string                 `json:"query"`
+		OperationName string                 `json:"operationName,omitempty"`
+		Variables     map[string]interface{} `json:"variables,omitempty"`
+	}
+
+	GraphHandler struct {
+		schema graphql.Schema
+		limits Limits
+	}
+)
+
+func NewGraphHandler(c controller.UserController, limits Limits) (*GraphHandler, error) {
+	schema, err := NewSchema(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GraphHandler{
+		schema: schema,
+		limits: limits,
+	}, nil
+}
+
+func (h *GraphHandler) RegisterRoutes(e *echo.Echo, m ...echo.MiddlewareFunc) {
+	e.GET("/graphql", h.Serve, m...)
+	e.POST("/graphql", h.Serve, m...)
+}
+
+// Serve executes a GraphQL request. Queries can be sent as a GET with query
+// parameters or as a JSON POST, browsers asking for HTML get the GraphiQL
+// playground instead.
+func (h *GraphHandler) Serve(c echo.Context) error {
+	req := c.Request()
+
+	if req.Method == http.MethodGet && strings.Contains(req.Header.Get(echo.HeaderAccept), echo.MIMETextHTML) {
+		return c.HTML(http.StatusOK, playgroundHTML)
+	}
+
+	body := GraphRequest{}
+	if req.Method == http.MethodGet {
+		body.Query = c.QueryParam("query")
+		body.OperationName = c.QueryParam("operationName")
+		if v := c.QueryParam("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &body.Variables); err != nil {
+				return respErrors(c, http.StatusBadRequest, err)
+			}
+		}
+	} else if err := c.Bind(&body); err != nil {
+		return respErrors(c, http.StatusBadRequest, err)
+	}
+
+	doc, err := parser.Parse(parser.ParseParams{
+		Source: source.NewSource(&source.Source{Body: []byte(body.Query), Name: "GraphQL request"}),
+	})
+	if err != nil {
+		return respErrors(c, http.StatusBadRequest, err)
+	}
+
+	validation := graphql.ValidateDocument(&h.schema, doc, nil)
+	if !validation.IsValid {
+		return c.JSON(http.StatusBadRequest, &graphql.Result{Errors: validation.Errors})
+	}
+
+	if err := checkLimits(doc, body.OperationName, body.Variables, h.limits); err != nil {
+		return respErrors(c, http.StatusBadRequest, err)
+	}
+
+	if req.Method == http.MethodGet && isMutation(doc, body.OperationName) {
+		return respErrors(c, http.StatusMethodNotAllowed, errMutationOverGet)
+	}
+
+	result := graphql.Execute(graphql.ExecuteParams{
+		Schema:        h.schema,
+		AST:           doc,
+		OperationName: body.OperationName,
+		Args:          body.Variables,
+		Context:       req.Context(),
+	})
+
+	return c.JSON(http.StatusOK, result)
+}
+
+func respErrors(c echo.Context, code int, errs ...error) error {
+	return c.JSON(code, &graphql.Result{Errors: gqlerrors.FormatErrors(errs...)})
+}
+
+func isMutation(doc *ast.Document, operationName string) bool {
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if operationName == "" || (op.Name != nil && op.Name.Value == operationName) {
+			return op.Operation == ast.OperationTypeMutation
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,134 @@
+package graph
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// Limits bound how expensive a single GraphQL operation may be. Depth counts
+// nested selection sets, complexity counts every selected field and multiplies
+// the fields under a paginated list by its "first" argument.
+type Limits struct {
+	MaxDepth      int
+	MaxComplexity int
+}
+
+var DefaultLimits = Limits{
+	MaxDepth:      8,
+	MaxComplexity: 1000,
+}
+
+type limitChecker struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+}
+
+// checkLimits measures the operation that will be executed and returns an error
+// when it exceeds the limits. Introspection fields are not counted so that
+// GraphiQL and other tooling keep working.
+func checkLimits(doc *ast.Document, operationName string, variables map[string]interface{}, limits Limits) error {
+	lc := limitChecker{
+		fragments: map[string]*ast.FragmentDefinition{},
+		variables: variables,
+	}
+
+	var operation *ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		switch d := def.(type) {
+		case *ast.FragmentDefinition:
+			lc.fragments[d.Name.Value] = d
+		case *ast.OperationDefinition:
+			if operationName == "" || (d.Name != nil && d.Name.Value == operationName) {
+				operation = d
+			}
+		}
+	}
+	if operation == nil {
+		return nil
+	}
+
+	depth, complexity := lc.measure(operation.SelectionSet, map[string]bool{})
+	if limits.MaxDepth > 0 && depth > limits.MaxDepth {
+		return fmt.Errorf("query depth %d exceeds the maximum of %d", depth, limits.MaxDepth)
+	}
+	if limits.MaxComplexity > 0 && complexity > limits.MaxComplexity {
+		return fmt.Errorf("query complexity %d exceeds the maximum of %d", complexity, limits.MaxComplexity)
+	}
+
+	return nil
+}
+
+func (lc limitChecker) measure(set *ast.SelectionSet, visited map[string]bool) (depth, complexity int) {
+	if set == nil {
+		return 0, 0
+	}
+
+	for _, sel := range set.Selections {
+		var d, c int
+
+		switch s := sel.(type) {
+		case *ast.Field:
+			if strings.HasPrefix(s.Name.Value, "__") {
+				continue
+			}
+			d, c = lc.measure(s.SelectionSet, visited)
+			d, c = d+1, 1+c*lc.multiplier(s)
+		case *ast.InlineFragment:
+			d, c = lc.measure(s.SelectionSet, visited)
+		case *ast.FragmentSpread:
+			name := s.Name.Value
+			frag, ok := lc.fragments[name]
+			if !ok || visited[name] {
+				continue
+			}
+			visited[name] = true
+			d, c = lc.measure(frag.SelectionSet, visited)
+			delete(visited, name)
+		}
+
+		if d > depth {
+			depth = d
+		}
+		complexity += c
+	}
+
+	return depth, complexity
+}
+
+// multiplier returns the page size requested by a connection field or 1 for
+// every other field
+func (lc limitChecker) multiplier(field *ast.Field) int {
+	if field.SelectionSet == nil {
+		return 1
+	}
+
+	for _, arg := range field.Arguments {
+		if arg.Name.Value != "first" {
+			continue
+		}
+
+		switch v := arg.Value.(type) {
+		case *ast.IntValue:
+			if n, err := strconv.Atoi(v.Value); err == nil && n > 0 {
+				return n
+			}
+		case *ast.Variable:
+			switch n := lc.variables[v.Name.Value].(type) {
+			case int:
+				return max(n, 1)
+			case float64:
+				return max(int(n), 1)
+			}
+		}
+		return 1
+	}
+
+	if field.Name.Value == "users" {
+		return defaultPageSize
+	}
+
+	return 1
+}
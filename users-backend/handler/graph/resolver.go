@@ -0,0 +1,232 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"users-backend/controller"
+	"users-backend/model"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/graphql-go/graphql"
+)
+
+const (
+	codeBadUserInput = "BAD_USER_INPUT"
+	codeNotFound     = "NOT_FOUND"
+	codeInternal     = "INTERNAL_SERVER_ERROR"
+)
+
+// Error is returned from resolvers so that clients get a stable code in the
+// "extensions" member of the GraphQL error
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Extensions() map[string]interface{} {
+	return map[string]interface{}{"code": e.Code}
+}
+
+func newError(code, format string, a ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, a...)}
+}
+
+type resolver struct {
+	controller controller.UserController
+}
+
+func (r *resolver) user(p graphql.ResolveParams) (interface{}, error) {
+	id, _ := p.Args["id"].(int)
+
+	user, err := r.controller.GetUser(p.Context, id)
+	if err != nil {
+		return nil, newError(codeNotFound, "user %d not found", id)
+	}
+
+	return user, nil
+}
+
+func (r *resolver) users(p graphql.ResolveParams) (interface{}, error) {
+	first, _ := p.Args["first"].(int)
+	if first < 0 || first > maxPageSize {
+		return nil, newError(codeBadUserInput, "first must be between 0 and %d", maxPageSize)
+	}
+
+	offset := 0
+	if after, ok := p.Args["after"].(string); ok && after != "" {
+		o, err := decodeCursor(after)
+		if err != nil {
+			return nil, newError(codeBadUserInput, "invalid cursor %q", after)
+		}
+		offset = o + 1
+	}
+
+	filter, _ := p.Args["filter"].(map[string]interface{})
+	var (
+		users *[]model.User
+		err   error
+	)
+	if attrs, ok := attributeFilter(filter); ok {
+		users, err = r.controller.GetUsersByAttributes(p.Context, attrs)
+	} else {
+		users, err = r.controller.GetAllUsers(p.Context)
+	}
+	var verr *controller.ValidationError
+	if errors.As(err, &verr) {
+		return nil, newError(codeBadUserInput, "%s", verr.Error())
+	}
+	if err != nil {
+		return nil, newError(codeInternal, "unexpected error trying to get all users")
+	}
+
+	filtered := filterUsers(*users, newUserFilter(p.Args["filter"]))
+	sortUsers(filtered, newUserSort(p.Args["sort"]))
+
+	return newConnection(filtered, offset, first), nil
+}
+
+func (r *resolver) createUser(p graphql.ResolveParams) (interface{}, error) {
+	input, _ := p.Args["input"].(map[string]interface{})
+	userName := stringArg(input, "userName")
+
+	if err := validateEmail(stringArg(input, "email")); err != nil {
+		return nil, err
+	}
+
+	newUserID, err := r.controller.CreateUser(p.Context, userName, stringArg(input, "firstName"), stringArg(input, "lastName"), stringArg(input, "email"), stringArg(input, "userStatus"), stringArg(input, "department"), intArg(input, "managerId"), attributesArg(input))
+	if err != nil {
+		return nil, mutationError(err, userName)
+	}
+
+	return r.controller.GetUser(p.Context, newUserID)
+}
+
+func (r *resolver) updateUser(p graphql.ResolveParams) (interface{}, error) {
+	input, _ := p.Args["input"].(map[string]interface{})
+	userID, _ := input["userId"].(int)
+	userName := stringArg(input, "userName")
+
+	if err := validateEmail(stringArg(input, "email")); err != nil {
+		return nil, err
+	}
+
+	updatedUserID, err := r.controller.UpdateUser(p.Context, userID, userName, stringArg(input, "firstName"), stringArg(input, "lastName"), stringArg(input, "email"), stringArg(input, "userStatus"), stringArg(input, "department"), optionalIntArg(input, "managerId"), attributesArg(input))
+	if err != nil {
+		return nil, mutationError(err, userName)
+	}
+
+	return r.controller.GetUser(p.Context, updatedUserID)
+}
+
+func (r *resolver) deleteUser(p graphql.ResolveParams) (interface{}, error) {
+	id, _ := p.Args["id"].(int)
+
+	if err := r.controller.DeleteUser(p.Context, id); err != nil {
+		return nil, newError(codeNotFound, "unexpected error trying to delete user %d", id)
+	}
+
+	return true, nil
+}
+
+func mutationError(err error, userName string) error {
+	var verr *controller.ValidationError
+	switch {
+	case errors.As(err, &verr):
+		return newError(codeBadUserInput, "%s", verr.Error())
+	case errors.Is(err, controller.ErrUserAlreadyExists), errors.Is(err, controller.ErrUsernameCollision):
+		return newError(codeBadUserInput, "user with username %s already exists", userName)
+	case errors.Is(err, controller.ErrUserStatusIncorrect):
+		return newError(codeBadUserInput, "accepted statuses are: ACTIVE, INACTIVE, TERMINATED")
+	default:
+		return newError(codeInternal, "unexpected error trying to save user %s", userName)
+	}
+}
+
+func validateEmail(email string) error {
+	if err := validator.New().Var(email, "required,email"); err != nil {
+		return newError(codeBadUserInput, "email %q is not a valid email address", email)
+	}
+	return nil
+}
+
+func stringArg(args map[string]interface{}, name string) string {
+	s, _ := args[name].(string)
+	return s
+}
+
+func intArg(args map[string]interface{}, name string) int {
+	i, _ := args[name].(int)
+	return i
+}
+
+// optionalIntArg reads an int input, nil when it is omitted so the stored
+// value is kept
+func optionalIntArg(args map[string]interface{}, name string) *int {
+	i, ok := args[name].(int)
+	if !ok {
+		return nil
+	}
+	return &i
+}
+
+// attributesArg reads the attributes input list, nil when it is omitted so the
+// attributes of an updated user are kept
+func attributesArg(args map[string]interface{}) model.Attributes {
+	list, ok := args["attributes"].([]interface{})
+	if !ok {
+		return nil
+	}
+
+	attrs := make(model.Attributes, len(list))
+	for _, item := range list {
+		a, _ := item.(map[string]interface{})
+		if v, ok := a["value"].(string); ok {
+			attrs[stringArg(a, "name")] = v
+		}
+	}
+	return attrs
+}
+
+// attributeFilter reads the attributes of the user filter, ok is false when
+// the filter has none
+func attributeFilter(filter map[string]interface{}) (map[string]string, bool) {
+	attrs := attributesArg(filter)
+	if len(attrs) == 0 {
+		return nil, false
+	}
+
+	m := make(map[string]string, len(attrs))
+	for name, v := range attrs {
+		m[name], _ = v.(string)
+	}
+	return m, true
+}
+
+// attributeList lists the attributes by name with their values formatted as
+// strings
+func attributeList(attrs model.Attributes) []map[string]interface{} {
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	list := make([]map[string]interface{}, len(names))
+	for i, name := range names {
+		var value string
+		switch v := attrs[name].(type) {
+		case float64:
+			value = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			value = fmt.Sprint(v)
+		}
+		list[i] = map[string]interface{}{"name": name, "value": value}
+	}
+	return list
+}
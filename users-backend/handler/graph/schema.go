@@ -0,0 +1,231 @@
+package graph
+
+import (
+	"users-backend/controller"
+	"users-backend/model"
+
+	"github.com/graphql-go/graphql"
+)
+
+var (
+	userStatusEnum = graphql.NewEnum(graphql.EnumConfig{
+		Name: "UserStatus",
+		Values: graphql.EnumValueConfigMap{
+			"ACTIVE":     &graphql.EnumValueConfig{Value: model.Active},
+			"INACTIVE":   &graphql.EnumValueConfig{Value: model.Inactive},
+			"TERMINATED": &graphql.EnumValueConfig{Value: model.Terminated},
+		},
+	})
+
+	userSortFieldEnum = graphql.NewEnum(graphql.EnumConfig{
+		Name: "UserSortField",
+		Values: graphql.EnumValueConfigMap{
+			"USER_ID":    &graphql.EnumValueConfig{Value: sortUserID},
+			"USER_NAME":  &graphql.EnumValueConfig{Value: sortUserName},
+			"FIRST_NAME": &graphql.EnumValueConfig{Value: sortFirstName},
+			"LAST_NAME":  &graphql.EnumValueConfig{Value: sortLastName},
+			"EMAIL":      &graphql.EnumValueConfig{Value: sortEmail},
+		},
+	})
+
+	sortDirectionEnum = graphql.NewEnum(graphql.EnumConfig{
+		Name: "SortDirection",
+		Values: graphql.EnumValueConfigMap{
+			"ASC":  &graphql.EnumValueConfig{Value: sortAsc},
+			"DESC": &graphql.EnumValueConfig{Value: sortDesc},
+		},
+	})
+
+	userAttributeType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "UserAttribute",
+		Description: "A custom attribute value, numbers are formatted as decimals and dates as YYYY-MM-DD",
+		Fields: graphql.Fields{
+			"name":  &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"value": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		},
+	})
+
+	attributeInput = graphql.NewInputObject(graphql.InputObjectConfig{
+		Name:        "AttributeInput",
+		Description: "A custom attribute value parsed by the type of its attribute, a null value removes it",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"name":  &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"value": &graphql.InputObjectFieldConfig{Type: graphql.String},
+		},
+	})
+
+	userType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "User",
+		Fields: graphql.Fields{
+			"userId":     &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Resolve: userField(func(u *model.User) interface{} { return u.UserID })},
+			"userName":   &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: userField(func(u *model.User) interface{} { return u.UserName })},
+			"firstName":  &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: userField(func(u *model.User) interface{} { return u.FirstName })},
+			"lastName":   &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: userField(func(u *model.User) interface{} { return u.LastName })},
+			"email":      &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: userField(func(u *model.User) interface{} { return u.Email })},
+			"userStatus": &graphql.Field{Type: graphql.NewNonNull(userStatusEnum), Resolve: userField(func(u *model.User) interface{} { return u.UserStatus })},
+			"department": &graphql.Field{Type: graphql.String, Resolve: userField(func(u *model.User) interface{} {
+				if u.Department.Valid {
+					return u.Department.String
+				}
+				return nil
+			})},
+			"managerId": &graphql.Field{Type: graphql.Int, Resolve: userField(func(u *model.User) interface{} {
+				if u.ManagerID.Valid {
+					return int(u.ManagerID.Int64)
+				}
+				return nil
+			})},
+			"attributes": &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(userAttributeType))), Resolve: userField(func(u *model.User) interface{} {
+				return attributeList(u.Attributes)
+			})},
+		},
+	})
+
+	userEdgeType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "UserEdge",
+		Fields: graphql.Fields{
+			"cursor": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"node":   &graphql.Field{Type: graphql.NewNonNull(userType)},
+		},
+	})
+
+	pageInfoType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "PageInfo",
+		Fields: graphql.Fields{
+			"hasNextPage":     &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+			"hasPreviousPage": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+			"startCursor":     &graphql.Field{Type: graphql.String},
+			"endCursor":       &graphql.Field{Type: graphql.String},
+		},
+	})
+
+	userConnectionType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "UserConnection",
+		Fields: graphql.Fields{
+			"edges":      &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(userEdgeType)))},
+			"pageInfo":   &graphql.Field{Type: graphql.NewNonNull(pageInfoType)},
+			"totalCount": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		},
+	})
+
+	userFilterInput = graphql.NewInputObject(graphql.InputObjectConfig{
+		Name:        "UserFilter",
+		Description: "Text fields match case-insensitive substrings, userStatus, department and attributes match exactly",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"userName":   &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"firstName":  &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"lastName":   &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"email":      &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"userStatus": &graphql.InputObjectFieldConfig{Type: userStatusEnum},
+			"department": &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"attributes": &graphql.InputObjectFieldConfig{Type: graphql.NewList(graphql.NewNonNull(attributeInput))},
+		},
+	})
+
+	userSortInput = graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "UserSort",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"field":     &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(userSortFieldEnum)},
+			"direction": &graphql.InputObjectFieldConfig{Type: sortDirectionEnum, DefaultValue: sortAsc},
+		},
+	})
+
+	createUserInput = graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "CreateUserInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"userName":   &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"firstName":  &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"lastName":   &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"email":      &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"userStatus": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(userStatusEnum)},
+			"department": &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"managerId":  &graphql.InputObjectFieldConfig{Type: graphql.Int},
+			"attributes": &graphql.InputObjectFieldConfig{Type: graphql.NewList(graphql.NewNonNull(attributeInput))},
+		},
+	})
+
+	updateUserInput = graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "UpdateUserInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"userId":     &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.Int)},
+			"userName":   &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"firstName":  &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"lastName":   &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"email":      &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"userStatus": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(userStatusEnum)},
+			"department": &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"managerId":  &graphql.InputObjectFieldConfig{Type: graphql.Int, Description: "The manager is kept when it is omitted and removed by 0"},
+			"attributes": &graphql.InputObjectFieldConfig{Type: graphql.NewList(graphql.NewNonNull(attributeInput)), Description: "Replaces every custom attribute of the user, they are kept when omitted"},
+		},
+	})
+)
+
+// NewSchema builds the GraphQL schema with every resolver backed by the given controller
+func NewSchema(userController controller.UserController) (graphql.Schema, error) {
+	r := &resolver{controller: userController}
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"user": &graphql.Field{
+				Type: userType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+				},
+				Resolve: r.user,
+			},
+			"users": &graphql.Field{
+				Type: graphql.NewNonNull(userConnectionType),
+				Args: graphql.FieldConfigArgument{
+					"first":  &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultPageSize},
+					"after":  &graphql.ArgumentConfig{Type: graphql.String},
+					"filter": &graphql.ArgumentConfig{Type: userFilterInput},
+					"sort":   &graphql.ArgumentConfig{Type: userSortInput},
+				},
+				Resolve: r.users,
+			},
+		},
+	})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createUser": &graphql.Field{
+				Type: graphql.NewNonNull(userType),
+				Args: graphql.FieldConfigArgument{
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(createUserInput)},
+				},
+				Resolve: r.createUser,
+			},
+			"updateUser": &graphql.Field{
+				Type: graphql.NewNonNull(userType),
+				Args: graphql.FieldConfigArgument{
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(updateUserInput)},
+				},
+				Resolve: r.updateUser,
+			},
+			"deleteUser": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Boolean),
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+				},
+				Resolve: r.deleteUser,
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{
+		Query:    query,
+		Mutation: mutation,
+	})
+}
+
+func userField(get func(u *model.User) interface{}) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		u, ok := p.Source.(*model.User)
+		if !ok {
+			return nil, nil
+		}
+		return get(u), nil
+	}
+}
@@ -0,0 +1,239 @@
+package test
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"users-backend/controller"
+	"users-backend/handler/graph"
+	"users-backend/logging"
+	"users-backend/model"
+	"users-backend/repo/mock"
+
+	"github.com/labstack/echo/v4"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	testifymock "github.com/stretchr/testify/mock"
+)
+
+type graphResponse struct {
+	Data   map[string]interface{} `json:"data"`
+	Errors []struct {
+		Message    string                 `json:"message"`
+		Extensions map[string]interface{} `json:"extensions"`
+	} `json:"errors"`
+}
+
+var _ = ginkgo.Describe("Graph Handler", func() {
+	var (
+		mockRepo *mock.UserRepoMock
+		e        *echo.Echo
+	)
+
+	mockUsers := []model.User{
+		{UserID: 1, UserName: "johndoe", FirstName: "John", LastName: "Doe", Email: "johndoe@email.com", UserStatus: "A", Department: sql.NullString{String: "IT", Valid: true}},
+		{UserID: 2, UserName: "janedoe", FirstName: "Jane", LastName: "Doe", Email: "janedoe@email.com", UserStatus: "I"},
+		{UserID: 3, UserName: "bobsmith", FirstName: "Bob", LastName: "Smith", Email: "bob@email.com", UserStatus: "A"},
+	}
+
+	post := func(query string, variables map[string]interface{}) (*httptest.ResponseRecorder, graphResponse) {
+		body, _ := json.Marshal(graph.GraphRequest{Query: query, Variables: variables})
+		req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		var res graphResponse
+		json.Unmarshal(rec.Body.Bytes(), &res)
+		return rec, res
+	}
+
+	ginkgo.BeforeEach(func() {
+		mockRepo = mock.NewUserRepoMock()
+		e = echo.New()
+		graphHandler, err := graph.NewGraphHandler(controller.NewUserController(mockRepo, logging.Discard()), graph.DefaultLimits)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		graphHandler.RegisterRoutes(e)
+	})
+
+	ginkgo.Describe("user", func() {
+		ginkgo.It("should return only the requested fields", func() {
+			mockRepo.On("GetById", 1).Return(&mockUsers[0], nil)
+
+			rec, res := post(`{ user(id: 1) { userName department userStatus } }`, nil)
+
+			gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusOK))
+			gomega.Expect(res.Data["user"]).Should(gomega.Equal(map[string]interface{}{
+				"userName":   "johndoe",
+				"department": "IT",
+				"userStatus": "ACTIVE",
+			}))
+		})
+
+		ginkgo.It("should return a NOT_FOUND error for a missing user", func() {
+			mockRepo.On("GetById", 9).Return((*model.User)(nil), errors.New("no rows"))
+
+			_, res := post(`{ user(id: 9) { userName } }`, nil)
+
+			gomega.Expect(res.Errors).Should(gomega.HaveLen(1))
+			gomega.Expect(res.Errors[0].Extensions["code"]).Should(gomega.Equal("NOT_FOUND"))
+		})
+	})
+
+	ginkgo.Describe("users", func() {
+		ginkgo.It("should filter, sort and paginate", func() {
+			users := append([]model.User{}, mockUsers...)
+			mockRepo.On("GetAll").Return(&users, nil)
+
+			_, res := post(`{
+				users(first: 1, filter: {lastName: "doe"}, sort: {field: USER_NAME}) {
+					totalCount
+					edges { cursor node { userName } }
+					pageInfo { hasNextPage endCursor }
+				}
+			}`, nil)
+
+			gomega.Expect(res.Errors).Should(gomega.BeEmpty())
+			conn := res.Data["users"].(map[string]interface{})
+			edges := conn["edges"].([]interface{})
+			pageInfo := conn["pageInfo"].(map[string]interface{})
+
+			gomega.Expect(conn["totalCount"]).Should(gomega.BeEquivalentTo(2))
+			gomega.Expect(edges).Should(gomega.HaveLen(1))
+			gomega.Expect(edges[0].(map[string]interface{})["node"]).Should(gomega.Equal(map[string]interface{}{"userName": "janedoe"}))
+			gomega.Expect(pageInfo["hasNextPage"]).Should(gomega.BeTrue())
+
+			_, res = post(`query($after: String) {
+				users(first: 1, after: $after, filter: {lastName: "doe"}, sort: {field: USER_NAME}) {
+					edges { node { userName } }
+					pageInfo { hasNextPage hasPreviousPage }
+				}
+			}`, map[string]interface{}{"after": pageInfo["endCursor"]})
+
+			conn = res.Data["users"].(map[string]interface{})
+			edges = conn["edges"].([]interface{})
+			pageInfo = conn["pageInfo"].(map[string]interface{})
+
+			gomega.Expect(edges[0].(map[string]interface{})["node"]).Should(gomega.Equal(map[string]interface{}{"userName": "johndoe"}))
+			gomega.Expect(pageInfo["hasNextPage"]).Should(gomega.BeFalse())
+			gomega.Expect(pageInfo["hasPreviousPage"]).Should(gomega.BeTrue())
+		})
+
+		ginkgo.It("should filter by attribute and list the attributes of each user", func() {
+			attributes := mock.NewAttributeRepoMock()
+			attributes.On("GetAttributes").Return(&[]model.AttributeDefinition{{Name: "employee_number", Type: model.AttributeNumber}}, nil)
+			graphHandler, _ := graph.NewGraphHandler(controller.NewUserController(mockRepo, logging.Discard(), controller.WithAttributes(attributes)), graph.DefaultLimits)
+			e = echo.New()
+			graphHandler.RegisterRoutes(e)
+
+			user := mockUsers[0]
+			user.Attributes = model.Attributes{"employee_number": float64(42)}
+			mockRepo.On("FindByAttributes", model.Attributes{"employee_number": float64(42)}).Return(&[]model.User{user}, nil)
+
+			_, res := post(`{ users(filter: {attributes: [{name: "employee_number", value: "42"}]}) { edges { node { attributes { name value } } } } }`, nil)
+
+			gomega.Expect(res.Errors).Should(gomega.BeEmpty())
+			edges := res.Data["users"].(map[string]interface{})["edges"].([]interface{})
+			gomega.Expect(edges[0].(map[string]interface{})["node"]).Should(gomega.Equal(map[string]interface{}{
+				"attributes": []interface{}{map[string]interface{}{"name": "employee_number", "value": "42"}},
+			}))
+
+			_, res = post(`{ users(filter: {attributes: [{name: "badge", value: "1"}]}) { totalCount } }`, nil)
+			gomega.Expect(res.Errors[0].Extensions["code"]).Should(gomega.Equal("BAD_USER_INPUT"))
+		})
+
+		ginkgo.It("should reject queries over the complexity limit", func() {
+			graphHandler, _ := graph.NewGraphHandler(controller.NewUserController(mockRepo, logging.Discard()), graph.Limits{MaxComplexity: 50})
+			e = echo.New()
+			graphHandler.RegisterRoutes(e)
+
+			rec, res := post(`{ users(first: 10) { edges { node { userId userName firstName lastName email userStatus department } } } }`, nil)
+
+			gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusBadRequest))
+			gomega.Expect(res.Errors[0].Message).Should(gomega.ContainSubstring("complexity"))
+		})
+
+		ginkgo.It("should reject queries over the depth limit", func() {
+			graphHandler, _ := graph.NewGraphHandler(controller.NewUserController(mockRepo, logging.Discard()), graph.Limits{MaxDepth: 3})
+			e = echo.New()
+			graphHandler.RegisterRoutes(e)
+
+			rec, res := post(`{ users { edges { node { userName } } } }`, nil)
+
+			gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusBadRequest))
+			gomega.Expect(res.Errors[0].Message).Should(gomega.ContainSubstring("depth"))
+		})
+	})
+
+	ginkgo.Describe("createUser", func() {
+		ginkgo.It("should create and return the user", func() {
+			created := mockUsers[0]
+			mockRepo.On("GetByUsername", "johndoe").Return(nil, errors.New("error finding user with username"))
+			mockRepo.On("Create", &model.User{UserName: "johndoe", FirstName: "John", LastName: "Doe", Email: "johndoe@email.com", UserStatus: "A", Department: sql.NullString{String: "IT", Valid: true}}).Return(1, nil)
+			mockRepo.On("GetById", 1).Return(&created, nil)
+
+			_, res := post(`mutation {
+				createUser(input: {userName: "johndoe", firstName: "John", lastName: "Doe", email: "johndoe@email.com", userStatus: ACTIVE, department: "IT"}) { userId }
+			}`, nil)
+
+			gomega.Expect(res.Errors).Should(gomega.BeEmpty())
+			gomega.Expect(res.Data["createUser"]).Should(gomega.Equal(map[string]interface{}{"userId": float64(1)}))
+		})
+
+		ginkgo.It("should return BAD_USER_INPUT when the user already exists", func() {
+			mockRepo.On("GetByUsername", "johndoe").Return(&mockUsers[0], nil)
+
+			_, res := post(`mutation {
+				createUser(input: {userName: "johndoe", firstName: "John", lastName: "Doe", email: "johndoe@email.com", userStatus: ACTIVE}) { userId }
+			}`, nil)
+
+			gomega.Expect(res.Errors).Should(gomega.HaveLen(1))
+			gomega.Expect(res.Errors[0].Extensions["code"]).Should(gomega.Equal("BAD_USER_INPUT"))
+		})
+	})
+
+	ginkgo.Describe("updateUser", func() {
+		ginkgo.It("should keep the manager when managerId is omitted and remove it for 0", func() {
+			managed := mockUsers[2]
+			managed.ManagerID = sql.NullInt64{Int64: 1, Valid: true}
+			mockRepo.On("GetById", 3).Return(&managed, nil)
+			mockRepo.On("GetByUsername", "bobsmith").Return(&managed, nil)
+			mockRepo.On("Update", testifymock.Anything).Return(3, nil)
+
+			for _, managerID := range []string{"", ", managerId: 0"} {
+				_, res := post(`mutation {
+					updateUser(input: {userId: 3, userName: "bobsmith", firstName: "Bob", lastName: "Smith", email: "bob@email.com", userStatus: ACTIVE`+managerID+`}) { userId }
+				}`, nil)
+				gomega.Expect(res.Errors).Should(gomega.BeEmpty())
+			}
+
+			managers := []sql.NullInt64{}
+			for _, call := range mockRepo.Calls {
+				if call.Method == "Update" {
+					managers = append(managers, call.Arguments.Get(0).(*model.User).ManagerID)
+				}
+			}
+			gomega.Expect(managers).Should(gomega.Equal([]sql.NullInt64{{Int64: 1, Valid: true}, {}}))
+		})
+	})
+
+	ginkgo.Describe("deleteUser", func() {
+		ginkgo.It("should not allow mutations over GET", func() {
+			req := httptest.NewRequest(http.MethodGet, "/graphql?query="+strings.ReplaceAll(`mutation { deleteUser(id: 1) }`, " ", "%20"), nil)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusMethodNotAllowed))
+			mockRepo.AssertNotCalled(ginkgo.GinkgoT(), "Delete", 1)
+		})
+	})
+})
+
+func TestGraphHandler(t *testing.T) {
+	gomega.RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "Graph Handler Suite")
+}
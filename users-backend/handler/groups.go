@@ -0,0 +1,395 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"users-backend/controller"
+	"users-backend/model"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	HttpGroupPost struct {
+		Name        string `json:"name" validate:"required"`
+		Description string `json:"description,omitempty"`
+		// ParentID nests the group in another group of the tenant
+		ParentID *int `json:"parent_id,omitempty" validate:"omitempty,min=1"`
+	}
+
+	HttpGroupPut struct {
+		GroupID     int    `json:"group_id" validate:"required"`
+		Name        string `json:"name" validate:"required"`
+		Description string `json:"description,omitempty"`
+		// ParentID nests the group in another group of the tenant, omitting
+		// it moves the group to the top
+		ParentID *int `json:"parent_id,omitempty" validate:"omitempty,min=1"`
+	}
+
+	HttpGroupIdResponse struct {
+		GroupID int `json:"group_id"`
+	}
+
+	HttpGroupResponse struct {
+		GroupID     int    `json:"group_id"`
+		Name        string `json:"name"`
+		Description string `json:"description,omitempty"`
+		ParentID    *int   `json:"parent_id,omitempty"`
+	}
+
+	HttpGroupMembers struct {
+		UserIDs []int `json:"user_ids" validate:"required,min=1,max=100,dive,min=1"`
+	}
+
+	HttpGroupMembersResponse struct {
+		// Count is the number of users added or removed, users that already
+		// were or were not members are not counted
+		Count int `json:"count"`
+	}
+
+	GroupHttpHandler struct {
+		group      *echo.Group
+		users      *echo.Group
+		controller controller.GroupController
+	}
+)
+
+var groupNameTaken = HttpFieldError{Field: "name", Rule: "unique", Message: "is already taken"}
+
+// NewGroupHttpHandler serves the groups under eg and the groups of each user
+// under users
+func NewGroupHttpHandler(eg *echo.Group, users *echo.Group, c controller.GroupController) *GroupHttpHandler {
+	return &GroupHttpHandler{
+		group:      eg,
+		users:      users,
+		controller: c,
+	}
+}
+
+func (h *GroupHttpHandler) RegisterRoutes() {
+	h.group.GET("/:group_id", h.GetGroup)
+	h.group.GET("", h.GetGroups)
+	h.group.POST("", h.CreateGroup)
+	h.group.PUT("", h.UpdateGroup)
+	h.group.DELETE("/:group_id", h.DeleteGroup)
+	h.group.GET("/:group_id/members", h.GetGroupMembers)
+	h.group.POST("/:group_id/members", h.AddGroupMembers)
+	h.group.POST("/:group_id/members/remove", h.RemoveGroupMembers)
+	h.group.DELETE("/:group_id/members/:user_id", h.RemoveGroupMember)
+	h.users.GET("/:user_id/groups", h.GetUserGroups)
+}
+
+// @Summary		Create a new group
+// @Description	Create a new group of the tenant, nested in parent_id when given
+// @ID				CreateGroup
+// @Tags			groups
+// @Produce		json,application/problem+json
+// @Param			group	body		HttpGroupPost	true	"Group Informations"
+// @Param			Idempotency-Key	header	string	false	"Replays the original response when a request is retried with the same key"
+// @Success		201		{object}	HttpSuccess{data=handler.HttpGroupIdResponse,code=int,message=string}
+// @Failure		400		{object}	HttpError	"HttpProblem with field errors when Accept is application/problem+json"
+// @Failure		500		{object}	HttpError
+// @Router			/groups [POST]
+func (h *GroupHttpHandler) CreateGroup(c echo.Context) error {
+	body := HttpGroupPost{}
+
+	if err := c.Bind(&body); err != nil {
+		return respError(c, http.StatusBadRequest, "Invalid body", fmt.Sprintf("Invalid body: %v", err), ProblemInvalidBody)
+	}
+	if err := structValidator.Struct(body); err != nil {
+		return respond(c, http.StatusBadRequest, newValidationError(err))
+	}
+
+	groupID, err := h.controller.CreateGroup(c.Request().Context(), body.Name, body.Description, pointerToInt(body.ParentID))
+	if err != nil {
+		return respGroupError(c, err, body.Name, "create")
+	}
+
+	return respSuccess(c, http.StatusCreated, success, HttpGroupIdResponse{GroupID: groupID})
+}
+
+// @Summary		Gets all the groups
+// @Description	Gets the groups of the tenant ordered by name
+// @ID				GetGroups
+// @Tags			groups
+// @Produce		json
+// @Success		200		{object}	HttpSuccess{data=handler.HttpGroupResponse[],code=int,message=string}
+// @Failure		500		{object}	HttpError
+// @Router			/groups [GET]
+func (h *GroupHttpHandler) GetGroups(c echo.Context) error {
+	groups, err := h.controller.GetGroups(c.Request().Context())
+	if err != nil {
+		return respError(c, http.StatusInternalServerError, "Internal Server Error", "Unexpected error trying to get all groups", ProblemInternal)
+	}
+
+	return respSuccess(c, http.StatusOK, success, newHttpGroupResponses(*groups))
+}
+
+// @Summary		Gets a group
+// @Description	Gets a group of the tenant
+// @ID				GetGroup
+// @Tags			groups
+// @Produce		json
+// @Param			group_id	path		int	true	"Group ID"
+// @Success		200		{object}	HttpSuccess{data=handler.HttpGroupResponse,code=int,message=string}
+// @Failure		400		{object}	HttpError
+// @Failure		404		{object}	HttpError
+// @Router			/groups/{group_id} [GET]
+func (h *GroupHttpHandler) GetGroup(c echo.Context) error {
+	groupIdParam := c.Param("group_id")
+	group_id, err := strconv.Atoi(groupIdParam)
+	if err != nil {
+		return respInvalidGroupID(c, groupIdParam)
+	}
+
+	g, err := h.controller.GetGroup(c.Request().Context(), group_id)
+	if err != nil {
+		return respGroupError(c, err, groupIdParam, "get")
+	}
+
+	return respSuccess(c, http.StatusOK, success, NewHttpGroupResponse(*g))
+}
+
+// @Summary		Updates a group
+// @Description	Updates a group, its parent_id must not be one of its subgroups
+// @ID				UpdateGroup
+// @Tags			groups
+// @Produce		json,application/problem+json
+// @Param			group	body		HttpGroupPut	true	"Group Informations"
+// @Param			Idempotency-Key	header	string	false	"Replays the original response when a request is retried with the same key"
+// @Success		200		{object}	HttpSuccess{data=handler.HttpGroupIdResponse,code=int,message=string}
+// @Failure		400		{object}	HttpError	"HttpProblem with field errors when Accept is application/problem+json"
+// @Failure		404		{object}	HttpError
+// @Failure		500		{object}	HttpError
+// @Router			/groups [PUT]
+func (h *GroupHttpHandler) UpdateGroup(c echo.Context) error {
+	body := HttpGroupPut{}
+
+	if err := c.Bind(&body); err != nil {
+		return respError(c, http.StatusBadRequest, "Invalid body", fmt.Sprintf("Invalid body: %v", err), ProblemInvalidBody)
+	}
+	if err := structValidator.Struct(body); err != nil {
+		return respond(c, http.StatusBadRequest, newValidationError(err))
+	}
+
+	groupID, err := h.controller.UpdateGroup(c.Request().Context(), body.GroupID, body.Name, body.Description, pointerToInt(body.ParentID))
+	if err != nil {
+		return respGroupError(c, err, strconv.Itoa(body.GroupID), "update")
+	}
+
+	return respSuccess(c, http.StatusOK, success, HttpGroupIdResponse{GroupID: groupID})
+}
+
+// @Summary		Deletes a group
+// @Description	Deletes a group and its memberships, its subgroups are moved to its parent
+// @ID				DeleteGroup
+// @Tags			groups
+// @Produce		json
+// @Param			group_id	path		int	true	"Group ID"
+// @Param			Idempotency-Key	header	string	false	"Replays the original response when a request is retried with the same key"
+// @Success		200		{object}	HttpSuccess
+// @Failure		400		{object}	HttpError
+// @Failure		500		{object}	HttpError
+// @Router			/groups/{group_id} [DELETE]
+func (h *GroupHttpHandler) DeleteGroup(c echo.Context) error {
+	groupIdParam := c.Param("group_id")
+	group_id, err := strconv.Atoi(groupIdParam)
+	if err != nil {
+		return respInvalidGroupID(c, groupIdParam)
+	}
+
+	if err := h.controller.DeleteGroup(c.Request().Context(), group_id); err != nil {
+		return respGroupError(c, err, groupIdParam, "delete")
+	}
+
+	return respSuccess(c, http.StatusOK, success)
+}
+
+// @Summary		Gets the members of a group
+// @Description	Gets the users of the group ordered by id, with transitive the users of its subgroups at any depth as well
+// @ID				GetGroupMembers
+// @Tags			groups
+// @Produce		json
+// @Param			group_id	path		int		true	"Group ID"
+// @Param			transitive	query		bool	false	"Include the members of the subgroups"
+// @Success		200		{object}	HttpSuccess{data=handler.HttpUserResponse[],code=int,message=string}
+// @Failure		400		{object}	HttpError
+// @Failure		404		{object}	HttpError
+// @Failure		500		{object}	HttpError
+// @Router			/groups/{group_id}/members [GET]
+func (h *GroupHttpHandler) GetGroupMembers(c echo.Context) error {
+	groupIdParam := c.Param("group_id")
+	group_id, err := strconv.Atoi(groupIdParam)
+	if err != nil {
+		return respInvalidGroupID(c, groupIdParam)
+	}
+
+	users, err := h.controller.GetGroupMembers(c.Request().Context(), group_id, c.QueryParam("transitive") == "true")
+	if err != nil {
+		return respGroupError(c, err, groupIdParam, "get the members of")
+	}
+
+	response := []HttpUserResponse{}
+	for _, u := range *users {
+		response = append(response, NewHttpUserResponse(u))
+	}
+
+	return respSuccess(c, http.StatusOK, success, response)
+}
+
+// @Summary		Adds members to a group
+// @Description	Adds up to 100 users to the group, users that already are members are skipped
+// @ID				AddGroupMembers
+// @Tags			groups
+// @Produce		json,application/problem+json
+// @Param			group_id	path		int					true	"Group ID"
+// @Param			members		body		HttpGroupMembers	true	"Users to add"
+// @Param			Idempotency-Key	header	string	false	"Replays the original response when a request is retried with the same key"
+// @Success		200		{object}	HttpSuccess{data=handler.HttpGroupMembersResponse,code=int,message=string}
+// @Failure		400		{object}	HttpError	"HttpProblem with field errors when Accept is application/problem+json"
+// @Failure		404		{object}	HttpError
+// @Failure		500		{object}	HttpError
+// @Router			/groups/{group_id}/members [POST]
+func (h *GroupHttpHandler) AddGroupMembers(c echo.Context) error {
+	return h.members(c, "add members to", h.controller.AddGroupMembers)
+}
+
+// @Summary		Removes members from a group
+// @Description	Removes up to 100 users from the group, users that are not members are skipped
+// @ID				RemoveGroupMembers
+// @Tags			groups
+// @Produce		json,application/problem+json
+// @Param			group_id	path		int					true	"Group ID"
+// @Param			members		body		HttpGroupMembers	true	"Users to remove"
+// @Param			Idempotency-Key	header	string	false	"Replays the original response when a request is retried with the same key"
+// @Success		200		{object}	HttpSuccess{data=handler.HttpGroupMembersResponse,code=int,message=string}
+// @Failure		400		{object}	HttpError	"HttpProblem with field errors when Accept is application/problem+json"
+// @Failure		404		{object}	HttpError
+// @Failure		500		{object}	HttpError
+// @Router			/groups/{group_id}/members/remove [POST]
+func (h *GroupHttpHandler) RemoveGroupMembers(c echo.Context) error {
+	return h.members(c, "remove members from", h.controller.RemoveGroupMembers)
+}
+
+// members runs update with the group of the path and the users of the body
+func (h *GroupHttpHandler) members(c echo.Context, action string, update func(ctx context.Context, group_id int, user_ids []int) (int, error)) error {
+	groupIdParam := c.Param("group_id")
+	group_id, err := strconv.Atoi(groupIdParam)
+	if err != nil {
+		return respInvalidGroupID(c, groupIdParam)
+	}
+
+	body := HttpGroupMembers{}
+	if err := c.Bind(&body); err != nil {
+		return respError(c, http.StatusBadRequest, "Invalid body", fmt.Sprintf("Invalid body: %v", err), ProblemInvalidBody)
+	}
+	if err := structValidator.Struct(body); err != nil {
+		return respond(c, http.StatusBadRequest, newValidationError(err))
+	}
+
+	n, err := update(c.Request().Context(), group_id, body.UserIDs)
+	if err != nil {
+		return respGroupError(c, err, groupIdParam, action)
+	}
+
+	return respSuccess(c, http.StatusOK, success, HttpGroupMembersResponse{Count: n})
+}
+
+// @Summary		Removes a member from a group
+// @Description	Removes the user from the group, succeeds when the user is not a member
+// @ID				RemoveGroupMember
+// @Tags			groups
+// @Produce		json
+// @Param			group_id	path		int	true	"Group ID"
+// @Param			user_id		path		int	true	"User ID"
+// @Param			Idempotency-Key	header	string	false	"Replays the original response when a request is retried with the same key"
+// @Success		200		{object}	HttpSuccess{data=handler.HttpGroupMembersResponse,code=int,message=string}
+// @Failure		400		{object}	HttpError
+// @Failure		404		{object}	HttpError
+// @Failure		500		{object}	HttpError
+// @Router			/groups/{group_id}/members/{user_id} [DELETE]
+func (h *GroupHttpHandler) RemoveGroupMember(c echo.Context) error {
+	groupIdParam := c.Param("group_id")
+	group_id, err := strconv.Atoi(groupIdParam)
+	if err != nil {
+		return respInvalidGroupID(c, groupIdParam)
+	}
+	userIdParam := c.Param("user_id")
+	user_id, err := strconv.Atoi(userIdParam)
+	if err != nil {
+		return respError(c, http.StatusBadRequest, "Invalid user_id", fmt.Sprintf("user_id %q is not a valid user_id as it is not a number", userIdParam), ProblemInvalidUserID)
+	}
+
+	n, err := h.controller.RemoveGroupMembers(c.Request().Context(), group_id, []int{user_id})
+	if err != nil {
+		return respGroupError(c, err, groupIdParam, "remove a member from")
+	}
+
+	return respSuccess(c, http.StatusOK, success, HttpGroupMembersResponse{Count: n})
+}
+
+// @Summary		Gets the groups of a user
+// @Description	Gets the groups of the user ordered by name, with transitive the groups they are nested in at any depth as well
+// @ID				GetUserGroups
+// @Tags			users
+// @Produce		json
+// @Param			user_id		path		int		true	"User ID"
+// @Param			transitive	query		bool	false	"Include the groups the groups of the user are nested in"
+// @Success		200		{object}	HttpSuccess{data=handler.HttpGroupResponse[],code=int,message=string}
+// @Failure		400		{object}	HttpError
+// @Failure		404		{object}	HttpError
+// @Router			/users/{user_id}/groups [GET]
+func (h *GroupHttpHandler) GetUserGroups(c echo.Context) error {
+	userIdParam := c.Param("user_id")
+	user_id, err := strconv.Atoi(userIdParam)
+	if err != nil {
+		return respError(c, http.StatusBadRequest, "Invalid user_id", fmt.Sprintf("user_id %q is not a valid user_id as it is not a number", userIdParam), ProblemInvalidUserID)
+	}
+
+	groups, err := h.controller.GetUserGroups(c.Request().Context(), user_id, c.QueryParam("transitive") == "true")
+	if err != nil {
+		return respError(c, http.StatusNotFound, "User not found", fmt.Sprintf("Unexpected error trying to get user %q: %s", userIdParam, err), ProblemUserNotFound)
+	}
+
+	return respSuccess(c, http.StatusOK, success, newHttpGroupResponses(*groups))
+}
+
+func respInvalidGroupID(c echo.Context, groupIdParam string) error {
+	return respError(c, http.StatusBadRequest, "Invalid group_id", fmt.Sprintf("group_id %q is not a valid group_id as it is not a number", groupIdParam), ProblemInvalidGroupID)
+}
+
+// respGroupError maps the controller errors to their response, group is the
+// name or id the request was about
+func respGroupError(c echo.Context, err error, group, action string) error {
+	var verr *controller.ValidationError
+	switch {
+	case errors.As(err, &verr):
+		return respond(c, http.StatusBadRequest, newControllerValidationError(verr))
+	case errors.Is(err, controller.ErrGroupAlreadyExists):
+		return respond(c, http.StatusBadRequest, newFieldError("Group already exists", fmt.Sprintf("group %s already exists", group), ProblemGroupAlreadyExists, groupNameTaken))
+	case errors.Is(err, controller.ErrGroupNotFound):
+		return respError(c, http.StatusNotFound, "Group not found", fmt.Sprintf("Group %q does not exist", group), ProblemGroupNotFound)
+	default:
+		return respError(c, http.StatusInternalServerError, "Internal Server Error", fmt.Sprintf("Unexpected error trying to %s group %s", action, group), ProblemInternal)
+	}
+}
+
+func NewHttpGroupResponse(g model.Group) HttpGroupResponse {
+	return HttpGroupResponse{
+		GroupID:     g.GroupID,
+		Name:        g.Name,
+		Description: g.Description,
+		ParentID:    nullInt64ToPointer(g.ParentID),
+	}
+}
+
+func newHttpGroupResponses(groups []model.Group) []HttpGroupResponse {
+	response := []HttpGroupResponse{}
+	for _, g := range groups {
+		response = append(response, NewHttpGroupResponse(g))
+	}
+	return response
+}
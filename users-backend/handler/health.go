@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"net/http"
+	"users-backend/health"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	livenessPath  = "/healthz"
+	readinessPath = "/readyz"
+)
+
+type HealthHttpHandler struct {
+	e      *echo.Echo
+	health *health.Health
+}
+
+func NewHealthHttpHandler(e *echo.Echo, h *health.Health) *HealthHttpHandler {
+	return &HealthHttpHandler{
+		e:      e,
+		health: h,
+	}
+}
+
+func (h *HealthHttpHandler) RegisterRoutes() {
+	h.e.GET(livenessPath, h.Live)
+	h.e.GET(readinessPath, h.Ready)
+}
+
+// Live reports the process is up and able to serve requests
+func (h *HealthHttpHandler) Live(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.health.Live())
+}
+
+// Ready reports whether every readiness check passes, 503 with the failing
+// checks otherwise
+func (h *HealthHttpHandler) Ready(c echo.Context) error {
+	report, ok := h.health.Ready(c.Request().Context())
+	if !ok {
+		return c.JSON(http.StatusServiceUnavailable, report)
+	}
+
+	return c.JSON(http.StatusOK, report)
+}
+
+// isProbe reports whether the request is a health probe, probes are polled
+// every few seconds and are kept out of request logs and traces
+func isProbe(c echo.Context) bool {
+	return c.Path() == livenessPath || c.Path() == readinessPath
+}
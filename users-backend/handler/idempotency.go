@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+	"users-backend/idempotency"
+	"users-backend/logging"
+	"users-backend/tenant"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	HeaderIdempotencyKey     = "Idempotency-Key"
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+)
+
+// captureWriter keeps a copy of everything written to the response
+type captureWriter struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *captureWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// IdempotencyMiddleware honours the Idempotency-Key header on mutations. The
+// first request with a key is processed and its response stored for ttl,
+// retries with the same key and body get that response replayed, the same key
+// with a different request is rejected with 422. Server errors are not stored
+// so the request can be retried. Keys are scoped to the tenant of the request
+// when it has one.
+func IdempotencyMiddleware(store idempotency.Store, ttl time.Duration, log *slog.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			key := req.Header.Get(HeaderIdempotencyKey)
+			if key == "" || req.Method == http.MethodGet || req.Method == http.MethodHead || req.Method == http.MethodOptions {
+				return next(c)
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				return respError(c, http.StatusBadRequest, "Invalid Idempotency-Key", fmt.Sprintf("Idempotency-Key must be at most %d characters", maxIdempotencyKeyLength), ProblemInvalidIdempotencyKey)
+			}
+
+			body, err := io.ReadAll(req.Body)
+			if err != nil {
+				return respError(c, http.StatusBadRequest, "Invalid body", fmt.Sprintf("Invalid body: %v", err), ProblemInvalidBody)
+			}
+			req.Body = io.NopCloser(bytes.NewReader(body))
+
+			ctx := req.Context()
+			storeKey := key
+			if tenant_id, ok := tenant.ID(ctx); ok {
+				storeKey = fmt.Sprintf("%d:%s", tenant_id, key)
+			}
+			fp := fingerprint(req, body)
+			rec, reserved, err := store.Reserve(ctx, storeKey, fp, ttl)
+			if err != nil {
+				return respError(c, http.StatusInternalServerError, "Internal Server Error", "Unexpected error trying to check the Idempotency-Key", ProblemInternal)
+			}
+
+			if !reserved {
+				switch {
+				case rec.Fingerprint != fp:
+					return respError(c, http.StatusUnprocessableEntity, "Idempotency-Key reused", fmt.Sprintf("Idempotency-Key %q was already used for a different request", key), ProblemIdempotencyKeyReused)
+				case rec.Response == nil:
+					return respError(c, http.StatusConflict, "Request in progress", fmt.Sprintf("A request with Idempotency-Key %q is still being processed", key), ProblemRequestInProgress)
+				default:
+					c.Response().Header().Set(HeaderIdempotentReplayed, "true")
+					return c.Blob(rec.Response.Status, rec.Response.ContentType, rec.Response.Body)
+				}
+			}
+
+			writer := &captureWriter{ResponseWriter: c.Response().Writer}
+			c.Response().Writer = writer
+
+			err = next(c)
+
+			status := c.Response().Status
+			if err != nil || status >= http.StatusInternalServerError || !c.Response().Committed {
+				if rerr := store.Release(ctx, storeKey); rerr != nil {
+					logging.FromContext(ctx, log).ErrorContext(ctx, "failed to release idempotency key", "error", rerr)
+				}
+				return err
+			}
+
+			resp := idempotency.Response{
+				Status:      status,
+				ContentType: c.Response().Header().Get(echo.HeaderContentType),
+				Body:        writer.body.Bytes(),
+			}
+			if cerr := store.Complete(ctx, storeKey, resp); cerr != nil {
+				logging.FromContext(ctx, log).ErrorContext(ctx, "failed to store idempotent response", "error", cerr)
+			}
+
+			return nil
+		}
+	}
+}
+
+// fingerprint identifies a request by its method, path, query and body, JSON
+// bodies are compacted first so whitespace differences don't count as a new
+// request
+func fingerprint(req *http.Request, body []byte) string {
+	compacted := &bytes.Buffer{}
+	if err := json.Compact(compacted, body); err != nil {
+		compacted = bytes.NewBuffer(body)
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s?%s\n", req.Method, req.URL.Path, req.URL.RawQuery)
+	h.Write(compacted.Bytes())
+
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"log/slog"
+	"users-backend/logging"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// requestIDMiddleware reuses the caller's X-Request-ID or generates one, echoes
+// it in the response and stores it in the request context so every log line
+// written while serving the request carries it
+func requestIDMiddleware() echo.MiddlewareFunc {
+	return middleware.RequestIDWithConfig(middleware.RequestIDConfig{
+		RequestIDHandler: func(c echo.Context, requestID string) {
+			ctx := logging.WithAttrs(c.Request().Context(), "request_id", requestID)
+			trace.SpanFromContext(ctx).SetAttributes(attribute.String("http.request_id", requestID))
+			c.SetRequest(c.Request().WithContext(ctx))
+		},
+	})
+}
+
+// requestLoggerMiddleware writes one structured line per request
+func requestLoggerMiddleware(log *slog.Logger) echo.MiddlewareFunc {
+	log = log.With("component", "http")
+
+	return middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
+		Skipper:      isProbe,
+		LogMethod:    true,
+		LogURI:       true,
+		LogRoutePath: true,
+		LogStatus:    true,
+		LogLatency:   true,
+		LogRemoteIP:  true,
+		LogError:     true,
+		HandleError:  true,
+		LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
+			ctx := c.Request().Context()
+			attrs := []any{
+				"method", v.Method,
+				"uri", v.URI,
+				"route", v.RoutePath,
+				"status", v.Status,
+				"latency_ms", float64(v.Latency.Microseconds()) / 1000,
+				"remote_ip", v.RemoteIP,
+			}
+			if userID := c.Param("user_id"); userID != "" {
+				attrs = append(attrs, "user_id", userID)
+			}
+
+			level := slog.LevelInfo
+			if v.Error != nil {
+				level = slog.LevelError
+				attrs = append(attrs, "error", v.Error)
+			} else if v.Status >= 500 {
+				level = slog.LevelError
+			}
+
+			logging.FromContext(ctx, log).Log(ctx, level, "request", attrs...)
+			return nil
+		},
+	})
+}
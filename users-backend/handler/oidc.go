@@ -0,0 +1,424 @@
+package handler
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"users-backend/auth"
+	"users-backend/controller"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const (
+	oidcDiscoveryPath = "/.well-known/openid-configuration"
+	oidcAuthorizePath = "/oauth2/authorize"
+	oidcTokenPath     = "/oauth2/token"
+	oidcUserInfoPath  = "/oauth2/userinfo"
+	oidcJWKSPath      = "/oauth2/jwks"
+
+	// oidcCSRFField is the form field and oidcCSRFCookie the cookie carrying
+	// the token that binds the login form to the browser it was shown to
+	oidcCSRFField  = "csrf_token"
+	oidcCSRFCookie = "oauth_csrf"
+
+	// oidcCSP keeps the login page from loading anything or being framed.
+	// There is no form-action, browsers apply it to the redirect back to the
+	// client.
+	oidcCSP = "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'; base-uri 'none'"
+	// cacheMetadata lets clients cache the discovery document and the keys
+	// for a while, the keys change when the service restarts without key file
+	cacheMetadata = "public, max-age=300"
+)
+
+//go:embed templates/authorize.html
+var authorizeTemplateSource string
+
+var authorizeTemplate = template.Must(template.New("authorize").Parse(authorizeTemplateSource))
+
+type (
+	// HttpOIDCConfiguration is the OpenID Connect discovery document
+	HttpOIDCConfiguration struct {
+		Issuer                            string   `json:"issuer"`
+		AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+		TokenEndpoint                     string   `json:"token_endpoint"`
+		UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+		JWKSURI                           string   `json:"jwks_uri"`
+		ScopesSupported                   []string `json:"scopes_supported"`
+		ResponseTypesSupported            []string `json:"response_types_supported"`
+		ResponseModesSupported            []string `json:"response_modes_supported"`
+		GrantTypesSupported               []string `json:"grant_types_supported"`
+		SubjectTypesSupported             []string `json:"subject_types_supported"`
+		IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+		TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+		CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+		ClaimsSupported                   []string `json:"claims_supported"`
+		// AuthorizationResponseIssParameterSupported tells clients the
+		// redirects carry the issuer (RFC 9207)
+		AuthorizationResponseIssParameterSupported bool `json:"authorization_response_iss_parameter_supported"`
+	}
+
+	HttpTokenResponse struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		// ExpiresIn is the lifetime of the access token in seconds
+		ExpiresIn int    `json:"expires_in"`
+		IDToken   string `json:"id_token"`
+		Scope     string `json:"scope"`
+	}
+
+	// HttpOAuthError is the error body of the token endpoint (RFC 6749)
+	HttpOAuthError struct {
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description,omitempty"`
+	}
+
+	// HttpUserInfo holds the claims of the user granted to the client
+	HttpUserInfo struct {
+		Subject string `json:"sub"`
+		auth.UserClaims
+	}
+
+	// authorizePage is rendered by authorizeTemplate
+	authorizePage struct {
+		ClientName string
+		Action     string
+		// Params are the parameters of the authorization request, posted
+		// back with the credentials
+		Params map[string]string
+		// CSRFToken is posted back to match the cookie set with the page
+		CSRFToken string
+		UserName  string
+		Error     string
+		AskCode   bool
+		// Fatal shows Error alone, for requests that can not be sent back
+		// to the client
+		Fatal bool
+	}
+
+	// OIDCHttpHandler serves the OpenID Connect provider, outside of /api/v1
+	// where clients expect to find it
+	OIDCHttpHandler struct {
+		e          *echo.Echo
+		middleware []echo.MiddlewareFunc
+		controller controller.OIDCController
+	}
+)
+
+// NewOIDCHttpHandler serves the discovery document and the endpoints of the
+// provider on e, the endpoints under /oauth2 go through middleware
+func NewOIDCHttpHandler(e *echo.Echo, c controller.OIDCController, middleware ...echo.MiddlewareFunc) *OIDCHttpHandler {
+	return &OIDCHttpHandler{
+		e:          e,
+		middleware: middleware,
+		controller: c,
+	}
+}
+
+func (h *OIDCHttpHandler) RegisterRoutes() {
+	authorizeMW := append(append([]echo.MiddlewareFunc{}, h.middleware...), h.csrfMiddleware())
+
+	h.e.GET(oidcDiscoveryPath, h.Discovery)
+	h.e.GET(oidcJWKSPath, h.JWKS)
+	h.e.GET(oidcAuthorizePath, h.Authorize, authorizeMW...)
+	h.e.POST(oidcAuthorizePath, h.Authorize, authorizeMW...)
+	h.e.POST(oidcTokenPath, h.Token, h.middleware...)
+	h.e.GET(oidcUserInfoPath, h.UserInfo, h.middleware...)
+	h.e.POST(oidcUserInfoPath, h.UserInfo, h.middleware...)
+}
+
+// csrfMiddleware sets a token cookie with the login page and rejects posted
+// credentials that do not carry the same token, so another site can not log
+// the browser in with credentials of its own choosing
+func (h *OIDCHttpHandler) csrfMiddleware() echo.MiddlewareFunc {
+	return middleware.CSRFWithConfig(middleware.CSRFConfig{
+		TokenLookup:    "form:" + oidcCSRFField,
+		ContextKey:     oidcCSRFField,
+		CookieName:     oidcCSRFCookie,
+		CookiePath:     oidcAuthorizePath,
+		CookieSecure:   strings.HasPrefix(h.controller.Issuer(), "https://"),
+		CookieHTTPOnly: true,
+		CookieSameSite: http.SameSiteStrictMode,
+		ErrorHandler: func(err error, c echo.Context) error {
+			return renderAuthorizeError(c, http.StatusForbidden, "The login form expired, go back to the application and try again")
+		},
+	})
+}
+
+// endpoint returns the URL of path under the issuer
+func (h *OIDCHttpHandler) endpoint(path string) string {
+	return strings.TrimSuffix(h.controller.Issuer(), "/") + path
+}
+
+// Discovery serves the metadata clients configure themselves from
+func (h *OIDCHttpHandler) Discovery(c echo.Context) error {
+	c.Response().Header().Set(echo.HeaderCacheControl, cacheMetadata)
+	return c.JSON(http.StatusOK, HttpOIDCConfiguration{
+		Issuer:                            h.controller.Issuer(),
+		AuthorizationEndpoint:             h.endpoint(oidcAuthorizePath),
+		TokenEndpoint:                     h.endpoint(oidcTokenPath),
+		UserInfoEndpoint:                  h.endpoint(oidcUserInfoPath),
+		JWKSURI:                           h.endpoint(oidcJWKSPath),
+		ScopesSupported:                   controller.SupportedScopes,
+		ResponseTypesSupported:            []string{"code"},
+		ResponseModesSupported:            []string{"query"},
+		GrantTypesSupported:               []string{"authorization_code"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{"RS256"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported: []string{
+			"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "tid",
+			"name", "given_name", "family_name", "preferred_username", "department", "user_status",
+			"email", "email_verified",
+		},
+		AuthorizationResponseIssParameterSupported: true,
+	})
+}
+
+// JWKS serves the public keys the tokens are signed with
+func (h *OIDCHttpHandler) JWKS(c echo.Context) error {
+	c.Response().Header().Set(echo.HeaderCacheControl, cacheMetadata)
+	return c.JSON(http.StatusOK, h.controller.KeySet())
+}
+
+func authorizationRequest(c echo.Context) controller.AuthorizationRequest {
+	return controller.AuthorizationRequest{
+		ResponseType:        c.FormValue("response_type"),
+		ClientID:            c.FormValue("client_id"),
+		RedirectURI:         c.FormValue("redirect_uri"),
+		Scope:               c.FormValue("scope"),
+		State:               c.FormValue("state"),
+		Nonce:               c.FormValue("nonce"),
+		CodeChallenge:       c.FormValue("code_challenge"),
+		CodeChallengeMethod: c.FormValue("code_challenge_method"),
+		Prompt:              c.FormValue("prompt"),
+	}
+}
+
+// renderAuthorize writes the login page with the security headers it needs
+func renderAuthorize(c echo.Context, code int, page authorizePage) error {
+	var b bytes.Buffer
+	if err := authorizeTemplate.Execute(&b, page); err != nil {
+		return err
+	}
+
+	header := c.Response().Header()
+	header.Set(echo.HeaderCacheControl, "no-store")
+	header.Set(echo.HeaderContentSecurityPolicy, oidcCSP)
+	header.Set(echo.HeaderXFrameOptions, "DENY")
+	header.Set("Referrer-Policy", "no-referrer")
+	return c.HTMLBlob(code, b.Bytes())
+}
+
+func renderAuthorizeError(c echo.Context, code int, message string) error {
+	return renderAuthorize(c, code, authorizePage{Error: message, Fatal: true})
+}
+
+// redirectAuthorization sends params back to the redirect URI of req, with
+// its state and the issuer
+func (h *OIDCHttpHandler) redirectAuthorization(c echo.Context, req controller.AuthorizationRequest, params url.Values) error {
+	u, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		return renderAuthorizeError(c, http.StatusBadRequest, "The redirect URI of the application is invalid")
+	}
+
+	query := u.Query()
+	for name, values := range params {
+		query[name] = values
+	}
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	query.Set("iss", h.controller.Issuer())
+	u.RawQuery = query.Encode()
+
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	return c.Redirect(http.StatusSeeOther, u.String())
+}
+
+// respAuthorizationError sends an OAuth error to the client when its redirect
+// URI was checked, and shows the error to the user otherwise
+func (h *OIDCHttpHandler) respAuthorizationError(c echo.Context, req controller.AuthorizationRequest, err error) error {
+	var oerr *controller.OAuthError
+	switch {
+	case errors.As(err, &oerr):
+		return h.redirectAuthorization(c, req, url.Values{"error": {oerr.Code}, "error_description": {oerr.Description}})
+	case errors.Is(err, controller.ErrInvalidRedirectURI):
+		return renderAuthorizeError(c, http.StatusBadRequest, "The redirect URI is not registered for this application")
+	default:
+		return renderAuthorizeError(c, http.StatusInternalServerError, "Something went wrong, try again later")
+	}
+}
+
+// Authorize shows the login page of an authorization request and, once the
+// user logged in, redirects back to the client with a code
+func (h *OIDCHttpHandler) Authorize(c echo.Context) error {
+	req := authorizationRequest(c)
+
+	client, err := h.controller.FindClient(c.Request().Context(), req.ClientID)
+	switch {
+	case errors.Is(err, controller.ErrClientNotFound):
+		return renderAuthorizeError(c, http.StatusBadRequest, "The application is unknown")
+	case err != nil:
+		return renderAuthorizeError(c, http.StatusInternalServerError, "Something went wrong, try again later")
+	}
+	ctx := withTenant(c.Request().Context(), client.TenantID)
+	c.SetRequest(c.Request().WithContext(ctx))
+
+	if err := h.controller.CheckAuthorization(ctx, client, &req); err != nil {
+		return h.respAuthorizationError(c, req, err)
+	}
+
+	csrfToken, _ := c.Get(oidcCSRFField).(string)
+	page := authorizePage{
+		ClientName: client.Name,
+		Action:     c.Request().URL.Path,
+		CSRFToken:  csrfToken,
+		Params: map[string]string{
+			"response_type":         req.ResponseType,
+			"client_id":             req.ClientID,
+			"redirect_uri":          req.RedirectURI,
+			"scope":                 req.Scope,
+			"code_challenge":        req.CodeChallenge,
+			"code_challenge_method": req.CodeChallengeMethod,
+		},
+	}
+	for name, value := range map[string]string{"state": req.State, "nonce": req.Nonce} {
+		if value != "" {
+			page.Params[name] = value
+		}
+	}
+	if c.Request().Method != http.MethodPost {
+		return renderAuthorize(c, http.StatusOK, page)
+	}
+
+	page.UserName = c.FormValue("username")
+	code, err := h.controller.Authorize(ctx, client, &req, page.UserName, c.FormValue("password"), c.FormValue("code"))
+	var (
+		locked *controller.LockedError
+		oerr   *controller.OAuthError
+	)
+	switch {
+	case err == nil:
+		return h.redirectAuthorization(c, req, url.Values{"code": {code}})
+	case errors.Is(err, controller.ErrInvalidCredentials):
+		page.Error = "The user name or password is wrong"
+	case errors.Is(err, controller.ErrTwoFactorRequired):
+		page.Error, page.AskCode = "Enter your password again with the code of your authenticator app or a recovery code", true
+	case errors.Is(err, controller.ErrInvalidTwoFactorCode):
+		page.Error, page.AskCode = "The two-factor code is wrong or was already used", true
+	case errors.As(err, &locked):
+		page.Error = fmt.Sprintf("The account is locked after too many failed logins until %s", locked.Until.UTC().Format(time.RFC3339))
+	case errors.Is(err, controller.ErrAccountDisabled):
+		page.Error = "The account is inactive or terminated"
+	case errors.As(err, &oerr), errors.Is(err, controller.ErrInvalidRedirectURI):
+		return h.respAuthorizationError(c, req, err)
+	default:
+		return renderAuthorizeError(c, http.StatusInternalServerError, "Something went wrong, try again later")
+	}
+	return renderAuthorize(c, http.StatusOK, page)
+}
+
+// respOAuthError writes the error body of the token endpoint, failed client
+// authentication is a 401 and server errors a 500
+func respOAuthError(c echo.Context, err *controller.OAuthError, basic bool) error {
+	code := http.StatusBadRequest
+	switch err.Code {
+	case controller.OAuthInvalidClient:
+		code = http.StatusUnauthorized
+		if basic {
+			c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Basic realm="oauth2"`)
+		}
+	case controller.OAuthServerError:
+		code = http.StatusInternalServerError
+	}
+	return c.JSON(code, HttpOAuthError{Error: err.Code, ErrorDescription: err.Description})
+}
+
+// clientCredentials returns the client id and secret of a token request, from
+// HTTP basic authentication or else from the form
+func clientCredentials(c echo.Context) (client_id, secret string, basic bool) {
+	client_id, secret, basic = c.Request().BasicAuth()
+	if !basic {
+		return c.FormValue("client_id"), c.FormValue("client_secret"), false
+	}
+	// Basic credentials are form encoded first (RFC 6749 section 2.3.1)
+	if id, err := url.QueryUnescape(client_id); err == nil {
+		client_id = id
+	}
+	if s, err := url.QueryUnescape(secret); err == nil {
+		secret = s
+	}
+	return client_id, secret, true
+}
+
+// Token exchanges an authorization code for an ID token and an access token
+func (h *OIDCHttpHandler) Token(c echo.Context) error {
+	header := c.Response().Header()
+	header.Set(echo.HeaderCacheControl, "no-store")
+	header.Set("Pragma", "no-cache")
+
+	client_id, secret, basic := clientCredentials(c)
+	client, err := h.controller.FindClient(c.Request().Context(), client_id)
+	switch {
+	case errors.Is(err, controller.ErrClientNotFound):
+		return respOAuthError(c, &controller.OAuthError{Code: controller.OAuthInvalidClient, Description: "client authentication failed"}, basic)
+	case err != nil:
+		return respOAuthError(c, &controller.OAuthError{Code: controller.OAuthServerError, Description: "unexpected error trying to find the client"}, basic)
+	}
+	ctx := withTenant(c.Request().Context(), client.TenantID)
+	c.SetRequest(c.Request().WithContext(ctx))
+
+	tokens, err := h.controller.Exchange(ctx, client, &controller.TokenRequest{
+		GrantType:    c.FormValue("grant_type"),
+		Code:         c.FormValue("code"),
+		RedirectURI:  c.FormValue("redirect_uri"),
+		CodeVerifier: c.FormValue("code_verifier"),
+		ClientSecret: secret,
+	})
+	var oerr *controller.OAuthError
+	switch {
+	case errors.As(err, &oerr):
+		return respOAuthError(c, oerr, basic)
+	case err != nil:
+		return respOAuthError(c, &controller.OAuthError{Code: controller.OAuthServerError, Description: "unexpected error trying to issue the tokens"}, basic)
+	}
+
+	return c.JSON(http.StatusOK, HttpTokenResponse{
+		AccessToken: tokens.AccessToken.Value,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(time.Until(tokens.AccessToken.ExpiresAt).Seconds()),
+		IDToken:     tokens.IDToken,
+		Scope:       tokens.Scope,
+	})
+}
+
+// UserInfo returns the claims of the user an access token was issued to
+func (h *OIDCHttpHandler) UserInfo(c echo.Context) error {
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+
+	token, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+	if !ok {
+		c.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+		return respError(c, http.StatusUnauthorized, "Unauthorized", "An access token is required", ProblemUnauthorized)
+	}
+
+	info, err := h.controller.UserInfo(c.Request().Context(), strings.TrimSpace(token))
+	switch {
+	case errors.Is(err, auth.ErrInvalidToken):
+		c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+		return respError(c, http.StatusUnauthorized, "Unauthorized", "The access token is invalid or expired", ProblemUnauthorized)
+	case err != nil:
+		return respError(c, http.StatusInternalServerError, "Internal Server Error", "Unexpected error trying to get the user info", ProblemInternal)
+	}
+
+	return c.JSON(http.StatusOK, HttpUserInfo{Subject: info.Subject, UserClaims: info.UserClaims})
+}
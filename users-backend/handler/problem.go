@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// MIMEApplicationProblemJSON is the RFC 7807 media type. Clients opt into it
+// with the Accept header, everyone else keeps receiving HttpError.
+const MIMEApplicationProblemJSON = "application/problem+json"
+
+// Problem type URIs. They identify the kind of error and do not change
+// between releases, clients should branch on them rather than on the title.
+const (
+	problemTypePrefix = "urn:problem-type:users-backend:"
+
+	ProblemInvalidBody            = problemTypePrefix + "invalid-body"
+	ProblemValidationFailed       = problemTypePrefix + "validation-failed"
+	ProblemUserAlreadyExists      = problemTypePrefix + "user-already-exists"
+	ProblemInvalidUserStatus      = problemTypePrefix + "invalid-user-status"
+	ProblemInvalidUserID          = problemTypePrefix + "invalid-user-id"
+	ProblemUserNotFound           = problemTypePrefix + "user-not-found"
+	ProblemEndpointNotFound       = problemTypePrefix + "endpoint-not-found"
+	ProblemInvalidOperation       = problemTypePrefix + "invalid-operation"
+	ProblemBatchRolledBack        = problemTypePrefix + "batch-rolled-back"
+	ProblemInvalidIdempotencyKey  = problemTypePrefix + "invalid-idempotency-key"
+	ProblemIdempotencyKeyReused   = problemTypePrefix + "idempotency-key-reused"
+	ProblemRequestInProgress      = problemTypePrefix + "request-in-progress"
+	ProblemRateLimited            = problemTypePrefix + "rate-limited"
+	ProblemBodyTooLarge           = problemTypePrefix + "body-too-large"
+	ProblemMissingTenant          = problemTypePrefix + "missing-tenant"
+	ProblemInvalidTenantID        = problemTypePrefix + "invalid-tenant-id"
+	ProblemTenantNotFound         = problemTypePrefix + "tenant-not-found"
+	ProblemTenantAlreadyExists    = problemTypePrefix + "tenant-already-exists"
+	ProblemTenantHasUsers         = problemTypePrefix + "tenant-has-users"
+	ProblemUnauthorized           = problemTypePrefix + "unauthorized"
+	ProblemInvalidToken           = problemTypePrefix + "invalid-token"
+	ProblemInvalidAttributeID     = problemTypePrefix + "invalid-attribute-id"
+	ProblemAttributeNotFound      = problemTypePrefix + "attribute-not-found"
+	ProblemAttributeAlreadyExists = problemTypePrefix + "attribute-already-exists"
+	ProblemInvalidGroupID         = problemTypePrefix + "invalid-group-id"
+	ProblemGroupNotFound          = problemTypePrefix + "group-not-found"
+	ProblemGroupAlreadyExists     = problemTypePrefix + "group-already-exists"
+	ProblemInvalidCredentials     = problemTypePrefix + "invalid-credentials"
+	ProblemAccountLocked          = problemTypePrefix + "account-locked"
+	ProblemAccountDisabled        = problemTypePrefix + "account-disabled"
+	ProblemInvalidLink            = problemTypePrefix + "invalid-link"
+	ProblemEmailAlreadyVerified   = problemTypePrefix + "email-already-verified"
+	ProblemTwoFactorRequired      = problemTypePrefix + "two-factor-required"
+	ProblemInvalidTwoFactorCode   = problemTypePrefix + "invalid-two-factor-code"
+	ProblemTwoFactorEnabled       = problemTypePrefix + "two-factor-enabled"
+	ProblemTwoFactorNotEnrolled   = problemTypePrefix + "two-factor-not-enrolled"
+	ProblemTwoFactorUnavailable   = problemTypePrefix + "two-factor-unavailable"
+	ProblemClientNotFound         = problemTypePrefix + "client-not-found"
+	ProblemPublicClient           = problemTypePrefix + "public-client"
+	ProblemInternal               = problemTypePrefix + "internal-error"
+)
+
+type (
+	// HttpProblem is an RFC 7807 problem details object
+	HttpProblem struct {
+		Type     string           `json:"type"`
+		Title    string           `json:"title"`
+		Status   int              `json:"status"`
+		Detail   string           `json:"detail,omitempty"`
+		Instance string           `json:"instance,omitempty"`
+		Errors   []HttpFieldError `json:"errors,omitempty"`
+	}
+
+	// HttpFieldError describes why one field of the request body was rejected,
+	// Field is the json name of the field and Rule the validation that failed
+	HttpFieldError struct {
+		Field   string `json:"field"`
+		Rule    string `json:"rule"`
+		Message string `json:"message"`
+	}
+)
+
+// wantsProblem reports whether the client asked for problem+json responses
+func wantsProblem(c echo.Context) bool {
+	return strings.Contains(c.Request().Header.Get(echo.HeaderAccept), MIMEApplicationProblemJSON)
+}
+
+func newHttpProblem(e HttpError, instance string) HttpProblem {
+	problemType := e.problemType
+	if problemType == "" {
+		problemType = "about:blank"
+	}
+
+	return HttpProblem{
+		Type:     problemType,
+		Title:    e.Message,
+		Status:   e.Code,
+		Detail:   strings.TrimSpace(e.Details),
+		Instance: instance,
+		Errors:   e.fieldErrors,
+	}
+}
+
+// problemBody converts the HttpError bodies to problems when the client asked
+// for them, any other body is returned as is
+func problemBody(c echo.Context, body interface{}) interface{} {
+	if e, ok := body.(HttpError); ok && wantsProblem(c) {
+		return newHttpProblem(e, c.Request().URL.Path)
+	}
+	return body
+}
+
+// respond writes body with code, negotiating the error format with the client
+func respond(c echo.Context, code int, body interface{}) error {
+	e, ok := body.(HttpError)
+	if !ok || !wantsProblem(c) {
+		return c.JSON(code, body)
+	}
+
+	b, err := json.Marshal(newHttpProblem(e, c.Request().URL.Path))
+	if err != nil {
+		return err
+	}
+	return c.Blob(code, MIMEApplicationProblemJSON, b)
+}
@@ -0,0 +1,172 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"users-backend/controller"
+	"users-backend/logging"
+	"users-backend/ratelimit"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	HeaderRateLimitLimit     = "RateLimit-Limit"
+	HeaderRateLimitRemaining = "RateLimit-Remaining"
+	HeaderRateLimitReset     = "RateLimit-Reset"
+	HeaderRateLimitPolicy    = "RateLimit-Policy"
+	HeaderRetryAfter         = "Retry-After"
+
+	// DefaultMaxBodySize caps request bodies at 1 MiB
+	DefaultMaxBodySize = 1 << 20
+)
+
+// DefaultRateLimitRules keep a client from listing every user more than once a
+// second on average, other routes get a generous limit
+var DefaultRateLimitRules = mustParseRules("GET /api/v1/users=60/m:20; *=1200/m:200")
+
+var httpRateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "users",
+	Subsystem: "http",
+	Name:      "rate_limited_total",
+	Help:      "Number of requests rejected by the rate limiter by method and route.",
+}, []string{"method", "route"})
+
+// RateLimitConfig sets the limits of RateLimitMiddleware
+type RateLimitConfig struct {
+	Store ratelimit.Store
+	// Rules are matched in order against the method and route template, the
+	// first match applies. Requests matching no rule are not limited.
+	Rules []ratelimit.Rule
+	// APIKeyHeader names a header identifying the caller, e.g. X-API-Key.
+	// Only the keys listed in APIKeys identify the caller, requests with any
+	// other value are keyed like requests without one.
+	APIKeyHeader string
+	APIKeys      []string
+	// Auth verifies bearer login tokens, callers with a valid one are keyed by
+	// the user it was issued to
+	Auth controller.AuthController
+}
+
+func mustParseRules(s string) []ratelimit.Rule {
+	rules, err := ratelimit.ParseRules(s)
+	if err != nil {
+		panic(err)
+	}
+	return rules
+}
+
+// clientKey identifies the caller by known API key, login token subject,
+// verified client certificate or IP address, in that order. Credentials that
+// do not verify are ignored so rotating them does not give a fresh bucket.
+func clientKey(c echo.Context, cfg RateLimitConfig, apiKeys map[[sha256.Size]byte]bool) string {
+	req := c.Request()
+	if cfg.APIKeyHeader != "" {
+		if key := req.Header.Get(cfg.APIKeyHeader); key != "" {
+			if sum := sha256.Sum256([]byte(key)); apiKeys[sum] {
+				return "key:" + hex.EncodeToString(sum[:16])
+			}
+		}
+	}
+	if cfg.Auth != nil {
+		if token, ok := strings.CutPrefix(req.Header.Get(echo.HeaderAuthorization), "Bearer "); ok {
+			if tenant_id, user_id, err := cfg.Auth.VerifyToken(strings.TrimSpace(token)); err == nil {
+				return fmt.Sprintf("user:%d:%d", tenant_id, user_id)
+			}
+		}
+	}
+	if req.TLS != nil && len(req.TLS.VerifiedChains) > 0 {
+		return "cert:" + req.TLS.VerifiedChains[0][0].Subject.String()
+	}
+	return "ip:" + c.RealIP()
+}
+
+// RateLimitMiddleware takes a token from the bucket of the caller for the
+// first rule matching the request. Responses carry the RateLimit-* headers
+// and requests over the limit get a 429 with Retry-After. The request is let
+// through when the store fails.
+func RateLimitMiddleware(cfg RateLimitConfig, log *slog.Logger) echo.MiddlewareFunc {
+	apiKeys := make(map[[sha256.Size]byte]bool, len(cfg.APIKeys))
+	for _, key := range cfg.APIKeys {
+		apiKeys[sha256.Sum256([]byte(key))] = true
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			i := ratelimit.Match(cfg.Rules, req.Method, c.Path())
+			if i < 0 {
+				return next(c)
+			}
+			rule := cfg.Rules[i]
+
+			ctx := req.Context()
+			res, err := cfg.Store.Take(ctx, fmt.Sprintf("%d|%s", i, clientKey(c, cfg, apiKeys)), rule.Limit)
+			if err != nil {
+				logging.FromContext(ctx, log).ErrorContext(ctx, "failed to check the rate limit", "error", err)
+				return next(c)
+			}
+
+			h := c.Response().Header()
+			h.Set(HeaderRateLimitLimit, strconv.Itoa(res.Limit))
+			h.Set(HeaderRateLimitRemaining, strconv.Itoa(res.Remaining))
+			h.Set(HeaderRateLimitReset, ceilSeconds(res.Reset))
+			h.Set(HeaderRateLimitPolicy, rule.Policy)
+
+			if !res.Allowed {
+				httpRateLimited.WithLabelValues(req.Method, c.Path()).Inc()
+				retryAfter := ceilSeconds(res.RetryAfter)
+				h.Set(HeaderRetryAfter, retryAfter)
+				return respError(c, http.StatusTooManyRequests, "Too many requests", fmt.Sprintf("Rate limit exceeded, retry in %s seconds", retryAfter), ProblemRateLimited)
+			}
+
+			return next(c)
+		}
+	}
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// BodyLimitMiddleware rejects request bodies larger than limit bytes with a
+// 413, whether or not they declare a Content-Length
+func BodyLimitMiddleware(limit int64) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			tooLarge := func() error {
+				return respError(c, http.StatusRequestEntityTooLarge, "Request body too large", fmt.Sprintf("Request body must be at most %d bytes", limit), ProblemBodyTooLarge)
+			}
+
+			if req.ContentLength > limit {
+				return tooLarge()
+			}
+			if req.Body == nil || req.Body == http.NoBody {
+				return next(c)
+			}
+
+			body, err := io.ReadAll(io.LimitReader(req.Body, limit+1))
+			if err != nil {
+				return respError(c, http.StatusBadRequest, "Invalid body", fmt.Sprintf("Invalid body: %v", err), ProblemInvalidBody)
+			}
+			if int64(len(body)) > limit {
+				return tooLarge()
+			}
+			req.Body = io.NopCloser(bytes.NewReader(body))
+
+			return next(c)
+		}
+	}
+}
@@ -6,16 +6,26 @@ type HttpError struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
 	Details string `json:"details,omitempty"`
+
+	// problemType and fieldErrors are only rendered for problem+json clients,
+	// the type is set along with the message so rewording it keeps the type
+	problemType string
+	fieldErrors []HttpFieldError
 }
 
-func respError(c echo.Context, code int, message, details string) error {
-	h := HttpError{
-		Code:    code,
-		Message: message,
-		Details: details,
+// newHttpError builds an error with one of the Problem type URIs, an empty
+// problemType is reported as about:blank
+func newHttpError(code int, message, details, problemType string) HttpError {
+	return HttpError{
+		Code:        code,
+		Message:     message,
+		Details:     details,
+		problemType: problemType,
 	}
+}
 
-	return c.JSON(code, h)
+func respError(c echo.Context, code int, message, details, problemType string) error {
+	return respond(c, code, newHttpError(code, message, details, problemType))
 }
 
 type HttpSuccess struct {
@@ -24,7 +34,7 @@ type HttpSuccess struct {
 	Data    interface{} `json:"data,omitempty"`
 }
 
-func respSuccess(c echo.Context, code int, message string, data ...interface{}) error {
+func newHttpSuccess(code int, message string, data ...interface{}) HttpSuccess {
 	h := HttpSuccess{
 		Code:    code,
 		Message: message,
@@ -34,5 +44,9 @@ func respSuccess(c echo.Context, code int, message string, data ...interface{})
 		h.Data = data[0]
 	}
 
-	return c.JSON(code, h)
+	return h
+}
+
+func respSuccess(c echo.Context, code int, message string, data ...interface{}) error {
+	return c.JSON(code, newHttpSuccess(code, message, data...))
 }
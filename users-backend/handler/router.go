@@ -2,14 +2,91 @@ package handler
 
 import (
 	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
+	"strings"
+	"time"
 	"users-backend/controller"
+	"users-backend/handler/graph"
+	"users-backend/health"
+	"users-backend/idempotency"
+	"users-backend/model"
+	"users-backend/tracing"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	echoSwagger "github.com/swaggo/echo-swagger"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/labstack/echo/otelecho"
 )
 
+// RouterConfig holds the dependencies and settings InitRouter wires into the
+// middleware and handlers
+type RouterConfig struct {
+	Health *health.Health
+	Logger *slog.Logger
+
+	// IdempotencyStore keeps the responses of mutations sent with an
+	// Idempotency-Key for IdempotencyTTL
+	IdempotencyStore idempotency.Store
+	IdempotencyTTL   time.Duration
+
+	// AllowOrigins are the origins browsers may call the API from, defaults
+	// to the Angular dev server. Not needed when SPA serves the frontend.
+	AllowOrigins []string
+
+	// SPA serves a frontend build for the paths not handled by the API, nil
+	// serves the API only
+	SPA *SPAConfig
+
+	// RateLimit limits the requests of each client to /api/v1, nil disables it
+	RateLimit *RateLimitConfig
+	// MaxBodySize caps request bodies, DefaultMaxBodySize when zero
+	MaxBodySize int64
+	// TrustedProxies are the networks of the proxies allowed to set the client
+	// IP with X-Forwarded-For, the connection address is used otherwise
+	TrustedProxies []*net.IPNet
+
+	// Tenant resolves the tenant the users and GraphQL requests are scoped to,
+	// nil scopes every request to the default tenant
+	Tenant *TenantConfig
+
+	// Attributes serves the custom attribute definitions of each tenant under
+	// /tenants/{tenant_id}/attributes, nil disables the endpoints
+	Attributes controller.AttributeController
+
+	// Groups serves the groups of the tenant of each request under /groups and
+	// /users/{user_id}/groups, nil disables the endpoints
+	Groups controller.GroupController
+
+	// Auth serves the password login and the password of the logged in user
+	// under /auth, and the passwords of the users of each tenant under
+	// /tenants/{tenant_id}/users along with the admin token. Nil disables
+	// the endpoints.
+	Auth controller.AuthController
+
+	// Account serves the email verification and password reset links under
+	// /auth and the verification mails under /users/{user_id}/email, nil
+	// disables the endpoints
+	Account controller.AccountController
+
+	// TwoFactor serves the second factor of the logged in user under
+	// /auth/two-factor, along with Auth, and the second factor of the users
+	// of each tenant under /tenants/{tenant_id}/users, along with the admin
+	// token. Nil disables the endpoints.
+	TwoFactor controller.TwoFactorController
+
+	// OIDC serves the OpenID Connect provider under /.well-known and
+	// /oauth2, and the clients of each tenant under
+	// /tenants/{tenant_id}/oauth-clients along with the admin token. Nil
+	// disables the endpoints.
+	OIDC controller.OIDCController
+}
+
+// DefaultAllowOrigins is the Angular dev server
+var DefaultAllowOrigins = []string{"http://localhost:4200"}
+
 // Swagger spec:
 //
 //	@title			User Service
@@ -17,24 +94,167 @@ import (
 //	@description	User Management Service
 //	@host			localhost:8080
 //	@BasePath		/api/v1
-func InitRouter(e *echo.Echo, userController *controller.UserControllerImpl) {
-	e.Use(middleware.Logger())
+//
+//	@securityDefinitions.apikey	AdminToken
+//	@in							header
+//	@name						Authorization
+//	@description				Bearer token set with ADMIN_API_TOKEN
+//
+//	@securityDefinitions.apikey	UserToken
+//	@in							header
+//	@name						Authorization
+//	@description				Bearer token returned by the login
+func InitRouter(e *echo.Echo, userController controller.UserController, cfg RouterConfig) {
+	e.IPExtractor = echo.ExtractIPDirect()
+	if len(cfg.TrustedProxies) > 0 {
+		trust := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+		for _, proxy := range cfg.TrustedProxies {
+			trust = append(trust, echo.TrustIPRange(proxy))
+		}
+		e.IPExtractor = echo.ExtractIPFromXFFHeader(trust...)
+	}
+
+	e.Use(otelecho.Middleware(tracing.ServiceName, otelecho.WithSkipper(func(c echo.Context) bool {
+		return isProbe(c) || c.Path() == "/metrics" || strings.HasPrefix(c.Path(), "/swagger")
+	})))
+	e.Use(requestIDMiddleware())
+	e.Use(requestLoggerMiddleware(cfg.Logger))
 	e.Use(middleware.Recover())
+	e.Use(metricsMiddleware)
 
+	allowOrigins := cfg.AllowOrigins
+	if allowOrigins == nil {
+		allowOrigins = DefaultAllowOrigins
+	}
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
-		AllowOrigins: []string{"http://localhost:4200"},
+		AllowOrigins: allowOrigins,
 		AllowMethods: []string{http.MethodGet, http.MethodPut, http.MethodPost, http.MethodDelete},
+		ExposeHeaders: []string{
+			echo.HeaderXRequestID, HeaderIdempotentReplayed,
+			HeaderRateLimitLimit, HeaderRateLimitRemaining, HeaderRateLimitReset, HeaderRateLimitPolicy, HeaderRetryAfter,
+		},
 	}))
 
+	maxBodySize := cfg.MaxBodySize
+	if maxBodySize == 0 {
+		maxBodySize = DefaultMaxBodySize
+	}
+	e.Use(BodyLimitMiddleware(maxBodySize))
+
 	echo.NotFoundHandler = func(c echo.Context) error {
-		return respError(c, http.StatusNotFound, "Invalid endpoint", fmt.Sprintf("Endpoint %s does not exist", c.Request().URL.Path))
+		return respError(c, http.StatusNotFound, "Invalid endpoint", fmt.Sprintf("Endpoint %s does not exist", c.Request().URL.Path), ProblemEndpointNotFound)
 	}
 
 	e.GET("/swagger/*", echoSwagger.WrapHandler)
+	e.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
+
+	healthHttpHandler := NewHealthHttpHandler(e, cfg.Health)
+	healthHttpHandler.RegisterRoutes()
+
+	graphHandler, err := graph.NewGraphHandler(userController, graph.DefaultLimits)
+	if err != nil {
+		panic(err)
+	}
 
-	api := e.Group("/api/v1")
-	user := api.Group("/users")
+	tenantMW := defaultTenantMiddleware(model.DefaultTenantID)
+	if cfg.Tenant != nil {
+		tenantMW = TenantMiddleware(*cfg.Tenant, cfg.Logger)
+	}
+	var rateLimitMW []echo.MiddlewareFunc
+	if cfg.RateLimit != nil {
+		rateLimit := *cfg.RateLimit
+		if rateLimit.Auth == nil {
+			rateLimit.Auth = cfg.Auth
+		}
+		rateLimitMW = append(rateLimitMW, RateLimitMiddleware(rateLimit, cfg.Logger))
+	}
+
+	graphHandler.RegisterRoutes(e, append(rateLimitMW, tenantMW)...)
+
+	api := e.Group("/api/v1", rateLimitMW...)
+	idempotencyMW := IdempotencyMiddleware(cfg.IdempotencyStore, cfg.IdempotencyTTL, cfg.Logger)
+	user := api.Group("/users", tenantMW, idempotencyMW)
 
 	userHttpHandler := NewUserHttpHandler(user, userController)
 	userHttpHandler.RegisterRoutes()
+
+	if cfg.Groups != nil {
+		groups := api.Group("/groups", tenantMW, idempotencyMW)
+
+		groupHttpHandler := NewGroupHttpHandler(groups, user, cfg.Groups)
+		groupHttpHandler.RegisterRoutes()
+	}
+
+	if cfg.Auth != nil || cfg.Account != nil {
+		// Login responses carry a token and the links are single use, they
+		// are not kept for replays
+		authTenantMW := tenantMW
+		if cfg.Auth != nil {
+			authTenantMW = loginTenantMiddleware(cfg.Auth, tenantMW)
+		}
+		auth := api.Group("/auth", authTenantMW)
+
+		if cfg.Auth != nil {
+			authHttpHandler := NewAuthHttpHandler(auth, nil, cfg.Auth)
+			authHttpHandler.RegisterRoutes()
+		}
+		if cfg.Account != nil {
+			accountHttpHandler := NewAccountHttpHandler(auth, user, cfg.Account)
+			accountHttpHandler.RegisterRoutes()
+		}
+		if cfg.Auth != nil && cfg.TwoFactor != nil {
+			twoFactor := auth.Group("/two-factor", UserTokenMiddleware(cfg.Auth))
+
+			twoFactorHttpHandler := NewTwoFactorHttpHandler(twoFactor, nil, cfg.TwoFactor)
+			twoFactorHttpHandler.RegisterRoutes()
+		}
+	}
+
+	if cfg.OIDC != nil {
+		oidcHttpHandler := NewOIDCHttpHandler(e, cfg.OIDC, rateLimitMW...)
+		oidcHttpHandler.RegisterRoutes()
+	}
+
+	if cfg.Tenant != nil && cfg.Tenant.AdminToken != "" {
+		tenants := api.Group("/tenants", AdminTokenMiddleware(cfg.Tenant.AdminToken), idempotencyMW)
+
+		tenantHttpHandler := NewTenantHttpHandler(tenants, cfg.Tenant.Controller)
+		tenantHttpHandler.RegisterRoutes()
+
+		if cfg.Attributes != nil {
+			attributes := tenants.Group("/:tenant_id/attributes", tenantPathMiddleware(cfg.Tenant.Controller))
+
+			attributeHttpHandler := NewAttributeHttpHandler(attributes, cfg.Attributes)
+			attributeHttpHandler.RegisterRoutes()
+		}
+
+		if cfg.Auth != nil || cfg.TwoFactor != nil {
+			users := tenants.Group("/:tenant_id/users", tenantPathMiddleware(cfg.Tenant.Controller))
+
+			if cfg.Auth != nil {
+				authHttpHandler := NewAuthHttpHandler(nil, users, cfg.Auth)
+				authHttpHandler.RegisterRoutes()
+			}
+			if cfg.TwoFactor != nil {
+				twoFactorHttpHandler := NewTwoFactorHttpHandler(nil, users, cfg.TwoFactor)
+				twoFactorHttpHandler.RegisterRoutes()
+			}
+		}
+
+		if cfg.OIDC != nil {
+			// Client secrets are returned once, they are not kept for replays
+			clients := api.Group("/tenants/:tenant_id/oauth-clients", AdminTokenMiddleware(cfg.Tenant.AdminToken), tenantPathMiddleware(cfg.Tenant.Controller))
+
+			clientHttpHandler := NewClientHttpHandler(clients, cfg.OIDC)
+			clientHttpHandler.RegisterRoutes()
+		}
+	}
+
+	if cfg.SPA != nil {
+		spaHttpHandler, err := NewSPAHttpHandler(e, *cfg.SPA)
+		if err != nil {
+			panic(err)
+		}
+		spaHttpHandler.RegisterRoutes()
+	}
 }
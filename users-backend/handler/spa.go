@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	spaIndex = "index.html"
+
+	// spaConfigGlobal is the window property the runtime config is assigned to
+	spaConfigGlobal = "__USERS_CONFIG__"
+
+	cacheImmutable  = "public, max-age=31536000, immutable"
+	cacheRevalidate = "no-cache"
+)
+
+var (
+	// hashedAssetPattern matches the content hash the Angular build adds to
+	// file names, main-QH7UQXJN.js for esbuild and main.3f2a9c1b7d4e6f80.js
+	// for webpack. A new build changes the name so these are cached forever.
+	hashedAssetPattern = regexp.MustCompile(`[.-]([A-Z0-9]{8}|[a-f0-9]{16,20})\.[A-Za-z0-9]+$`)
+
+	// spaReservedPrefixes belong to the server, unknown paths under them get the
+	// JSON 404 instead of index.html
+	spaReservedPrefixes = []string{"/api/", "/graphql", "/swagger/", "/metrics", "/oauth2/", "/.well-known/", livenessPath, readinessPath}
+)
+
+// SPAConfig is a built single page application served next to the API
+type SPAConfig struct {
+	// FS holds index.html and the assets it loads
+	FS fs.FS
+	// RuntimeConfig is serialized to JSON and assigned to
+	// window.__USERS_CONFIG__ before the application scripts run, so one build
+	// can be deployed against any API
+	RuntimeConfig any
+}
+
+// SPAHttpHandler serves the files of the application and index.html for any
+// other path, letting the client side router handle it
+type SPAHttpHandler struct {
+	e             *echo.Echo
+	fs            fs.FS
+	runtimeConfig []byte
+}
+
+func NewSPAHttpHandler(e *echo.Echo, cfg SPAConfig) (*SPAHttpHandler, error) {
+	if _, err := fs.Stat(cfg.FS, spaIndex); err != nil {
+		return nil, fmt.Errorf("spa: %w", err)
+	}
+
+	runtimeConfig, err := json.Marshal(cfg.RuntimeConfig)
+	if err != nil {
+		return nil, fmt.Errorf("spa: runtime config: %w", err)
+	}
+
+	return &SPAHttpHandler{
+		e:             e,
+		fs:            cfg.FS,
+		runtimeConfig: runtimeConfig,
+	}, nil
+}
+
+// RegisterRoutes serves the application for every path no other route
+// matches, register it after the API routes
+func (h *SPAHttpHandler) RegisterRoutes() {
+	h.e.RouteNotFound("/*", h.Serve)
+}
+
+// Serve returns the requested file, index.html for paths without an extension
+// and a 404 for missing assets and dot files
+func (h *SPAHttpHandler) Serve(c echo.Context) error {
+	req := c.Request()
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return echo.NotFoundHandler(c)
+	}
+	for _, prefix := range spaReservedPrefixes {
+		if strings.HasPrefix(req.URL.Path, prefix) {
+			return echo.NotFoundHandler(c)
+		}
+	}
+
+	name := strings.TrimPrefix(path.Clean("/"+req.URL.Path), "/")
+	if name == "" || name == spaIndex {
+		return h.serveIndex(c)
+	}
+
+	if strings.HasPrefix(name, ".") || strings.Contains(name, "/.") {
+		return echo.NotFoundHandler(c)
+	}
+
+	f, err := h.fs.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		if path.Ext(name) != "" {
+			return echo.NotFoundHandler(c)
+		}
+		return h.serveIndex(c)
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return h.serveIndex(c)
+	}
+
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		b, err := io.ReadAll(f)
+		if err != nil {
+			return err
+		}
+		content = bytes.NewReader(b)
+	}
+
+	if hashedAssetPattern.MatchString(name) {
+		c.Response().Header().Set(echo.HeaderCacheControl, cacheImmutable)
+	} else {
+		c.Response().Header().Set(echo.HeaderCacheControl, cacheRevalidate)
+	}
+	http.ServeContent(c.Response(), req, name, info.ModTime(), content)
+	return nil
+}
+
+// serveIndex returns index.html with the runtime config injected, it is never
+// cached so a deploy takes effect on the next page load
+func (h *SPAHttpHandler) serveIndex(c echo.Context) error {
+	index, err := fs.ReadFile(h.fs, spaIndex)
+	if err != nil {
+		return err
+	}
+
+	script := []byte("<script>window." + spaConfigGlobal + " = " + string(h.runtimeConfig) + ";</script>\n")
+	if i := bytes.Index(index, []byte("</head>")); i >= 0 {
+		index = append(index[:i:i], append(script, index[i:]...)...)
+	} else {
+		index = append(script, index...)
+	}
+
+	c.Response().Header().Set(echo.HeaderCacheControl, cacheRevalidate)
+	http.ServeContent(c.Response(), c.Request(), spaIndex, time.Time{}, bytes.NewReader(index))
+	return nil
+}
@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"users-backend/controller"
+	"users-backend/logging"
+	"users-backend/tenant"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// HeaderTenant is the default header naming the tenant of a request
+const HeaderTenant = "X-Tenant"
+
+var errInvalidToken = errors.New("invalid token")
+
+// TenantResolver returns the slug of the tenant a request is for, an empty
+// slug when the request does not name one
+type TenantResolver func(c echo.Context) (string, error)
+
+// TenantConfig sets how TenantMiddleware finds the tenant of a request
+type TenantConfig struct {
+	Controller controller.TenantController
+	// Resolvers are tried in order, the first slug found is used
+	Resolvers []TenantResolver
+	// Default is the slug used when no resolver finds one, requests without a
+	// tenant are rejected when it is empty
+	Default string
+	// AdminToken is the bearer token of the tenant administration endpoints,
+	// they are not registered when it is empty
+	AdminToken string
+}
+
+// TenantFromHeader reads the slug from the header name. Clients can pick any
+// tenant with it, only use it behind a gateway that sets the header.
+func TenantFromHeader(name string) TenantResolver {
+	return func(c echo.Context) (string, error) {
+		return strings.TrimSpace(c.Request().Header.Get(name)), nil
+	}
+}
+
+// TenantFromSubdomain reads the slug from the label in front of domain, a
+// request for acme.users.example.com is for the acme tenant when domain is
+// users.example.com. Requests for other hosts do not name a tenant.
+func TenantFromSubdomain(domain string) TenantResolver {
+	suffix := "." + strings.ToLower(strings.Trim(domain, "."))
+	return func(c echo.Context) (string, error) {
+		host := c.Request().Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+
+		label, ok := strings.CutSuffix(strings.ToLower(host), suffix)
+		if !ok || label == "" || strings.Contains(label, ".") {
+			return "", nil
+		}
+		return label, nil
+	}
+}
+
+// TenantFromToken reads the slug from the claim of the HS256 JWT sent as a
+// bearer token, signed with secret. Requests without a bearer token do not
+// name a tenant, invalid or expired tokens are rejected.
+func TenantFromToken(secret []byte, claim string) TenantResolver {
+	parser := &jwt.Parser{ValidMethods: []string{jwt.SigningMethodHS256.Alg()}}
+	keyFunc := func(*jwt.Token) (interface{}, error) { return secret, nil }
+
+	return func(c echo.Context) (string, error) {
+		raw, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+		if !ok {
+			return "", nil
+		}
+
+		claims := jwt.MapClaims{}
+		if _, err := parser.ParseWithClaims(strings.TrimSpace(raw), claims, keyFunc); err != nil {
+			return "", fmt.Errorf("%w: %w", errInvalidToken, err)
+		}
+
+		slug, _ := claims[claim].(string)
+		if slug == "" {
+			return "", fmt.Errorf("%w: no %s claim", errInvalidToken, claim)
+		}
+		return slug, nil
+	}
+}
+
+// TenantMiddleware scopes the request context to the tenant named by the
+// first resolver that finds one, cfg.Default otherwise. Unknown tenants get a
+// 404 and invalid tokens a 401.
+func TenantMiddleware(cfg TenantConfig, log *slog.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ctx := c.Request().Context()
+
+			var slug string
+			for _, resolve := range cfg.Resolvers {
+				s, err := resolve(c)
+				if errors.Is(err, errInvalidToken) {
+					logging.FromContext(ctx, log).InfoContext(ctx, "rejected tenant token", "error", err)
+					c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+					return respError(c, http.StatusUnauthorized, "Invalid token", "The bearer token is invalid or expired", ProblemInvalidToken)
+				}
+				if err != nil {
+					return err
+				}
+				if s != "" {
+					slug = s
+					break
+				}
+			}
+			if slug == "" {
+				slug = cfg.Default
+			}
+			if slug == "" {
+				return respError(c, http.StatusBadRequest, "Missing tenant", "The request does not name a tenant", ProblemMissingTenant)
+			}
+
+			t, err := cfg.Controller.GetTenantBySlug(ctx, slug)
+			if errors.Is(err, controller.ErrTenantNotFound) {
+				return respError(c, http.StatusNotFound, "Tenant not found", fmt.Sprintf("Tenant %q does not exist", slug), ProblemTenantNotFound)
+			}
+			if err != nil {
+				logging.FromContext(ctx, log).ErrorContext(ctx, "failed to resolve tenant", "tenant_slug", slug, "error", err)
+				return respError(c, http.StatusInternalServerError, "Internal Server Error", "Unexpected error trying to resolve the tenant", ProblemInternal)
+			}
+
+			c.SetRequest(c.Request().WithContext(withTenant(ctx, t.TenantID)))
+			return next(c)
+		}
+	}
+}
+
+// defaultTenantMiddleware scopes every request to tenant_id, for deployments
+// without tenant resolution
+func defaultTenantMiddleware(tenant_id int) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.SetRequest(c.Request().WithContext(withTenant(c.Request().Context(), tenant_id)))
+			return next(c)
+		}
+	}
+}
+
+// tenantPathMiddleware scopes the request to the tenant of the tenant_id path
+// parameter, for the admin endpoints managing the data of a tenant
+func tenantPathMiddleware(tc controller.TenantController) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			tenantIdParam := c.Param("tenant_id")
+			tenant_id, err := strconv.Atoi(tenantIdParam)
+			if err != nil {
+				return respError(c, http.StatusBadRequest, "Invalid tenant_id", fmt.Sprintf("tenant_id %q is not a valid tenant_id as it is not a number", tenantIdParam), ProblemInvalidTenantID)
+			}
+
+			if _, err := tc.GetTenant(c.Request().Context(), tenant_id); err != nil {
+				return respTenantError(c, err, tenantIdParam, "get")
+			}
+
+			c.SetRequest(c.Request().WithContext(withTenant(c.Request().Context(), tenant_id)))
+			return next(c)
+		}
+	}
+}
+
+// withTenant scopes ctx to tenant_id and adds it to the logs and the span of
+// the request
+func withTenant(ctx context.Context, tenant_id int) context.Context {
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("tenant.id", tenant_id))
+	return logging.WithAttrs(tenant.WithID(ctx, tenant_id), "tenant_id", tenant_id)
+}
@@ -0,0 +1,243 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"users-backend/controller"
+	"users-backend/model"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	HttpTenantPost struct {
+		Slug string `json:"slug" validate:"required"`
+		Name string `json:"name" validate:"required"`
+	}
+
+	HttpTenantPut struct {
+		TenantID int    `json:"tenant_id" validate:"required"`
+		Slug     string `json:"slug" validate:"required"`
+		Name     string `json:"name" validate:"required"`
+	}
+
+	HttpTenantIdResponse struct {
+		TenantID int `json:"tenant_id"`
+	}
+
+	HttpTenantResponse struct {
+		TenantID int    `json:"tenant_id"`
+		Slug     string `json:"slug"`
+		Name     string `json:"name"`
+	}
+
+	TenantHttpHandler struct {
+		group      *echo.Group
+		controller controller.TenantController
+	}
+)
+
+var slugTaken = HttpFieldError{Field: "slug", Rule: "unique", Message: "is already taken"}
+
+func NewTenantHttpHandler(eg *echo.Group, c controller.TenantController) *TenantHttpHandler {
+	return &TenantHttpHandler{
+		group:      eg,
+		controller: c,
+	}
+}
+
+func (h *TenantHttpHandler) RegisterRoutes() {
+	h.group.GET("/:tenant_id", h.GetTenant)
+	h.group.GET("", h.GetAllTenants)
+	h.group.POST("", h.CreateTenant)
+	h.group.PUT("", h.UpdateTenant)
+	h.group.DELETE("/:tenant_id", h.DeleteTenant)
+}
+
+// AdminTokenMiddleware only lets through requests sending token as their
+// bearer token
+func AdminTokenMiddleware(token string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			sent, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(strings.TrimSpace(sent)), []byte(token)) != 1 {
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+				return respError(c, http.StatusUnauthorized, "Unauthorized", "A valid admin token is required", ProblemUnauthorized)
+			}
+			return next(c)
+		}
+	}
+}
+
+// @Summary		Create a new tenant
+// @Description	Create a new tenant, requires the admin token
+// @ID				CreateTenant
+// @Tags			tenants
+// @Produce		json,application/problem+json
+// @Param			tenant	body		HttpTenantPost	true	"Tenant Informations"
+// @Param			Idempotency-Key	header	string	false	"Replays the original response when a request is retried with the same key"
+// @Success		201		{object}	HttpSuccess{data=handler.HttpTenantIdResponse,code=int,message=string}
+// @Failure		400		{object}	HttpError	"HttpProblem with field errors when Accept is application/problem+json"
+// @Failure		401		{object}	HttpError
+// @Failure		500		{object}	HttpError
+// @Security		AdminToken
+// @Router			/tenants [POST]
+func (h *TenantHttpHandler) CreateTenant(c echo.Context) error {
+	body := HttpTenantPost{}
+
+	if err := c.Bind(&body); err != nil {
+		return respError(c, http.StatusBadRequest, "Invalid body", fmt.Sprintf("Invalid body: %v", err), ProblemInvalidBody)
+	}
+	if err := structValidator.Struct(body); err != nil {
+		return respond(c, http.StatusBadRequest, newValidationError(err))
+	}
+
+	tenantID, err := h.controller.CreateTenant(c.Request().Context(), body.Slug, body.Name)
+	if err != nil {
+		return respTenantError(c, err, body.Slug, "create")
+	}
+
+	return respSuccess(c, http.StatusCreated, success, HttpTenantIdResponse{TenantID: tenantID})
+}
+
+// @Summary		Gets all the tenants
+// @Description	Gets all the tenants, requires the admin token
+// @ID				GetAllTenants
+// @Tags			tenants
+// @Produce		json
+// @Success		200		{object}	HttpSuccess{data=handler.HttpTenantResponse[],code=int,message=string}
+// @Failure		401		{object}	HttpError
+// @Failure		500		{object}	HttpError
+// @Security		AdminToken
+// @Router			/tenants [GET]
+func (h *TenantHttpHandler) GetAllTenants(c echo.Context) error {
+	tenants, err := h.controller.GetAllTenants(c.Request().Context())
+	if err != nil {
+		return respError(c, http.StatusInternalServerError, "Internal Server Error", "Unexpected error trying to get all tenants", ProblemInternal)
+	}
+
+	var response []HttpTenantResponse
+	for _, t := range *tenants {
+		response = append(response, NewHttpTenantResponse(t))
+	}
+
+	return respSuccess(c, http.StatusOK, success, response)
+}
+
+// @Summary		Gets a tenant
+// @Description	Gets a tenant, requires the admin token
+// @ID				GetTenant
+// @Tags			tenants
+// @Produce		json
+// @Param			tenant_id	path		int	true	"Tenant ID"
+// @Success		200		{object}	HttpSuccess{data=handler.HttpTenantResponse,code=int,message=string}
+// @Failure		400		{object}	HttpError
+// @Failure		401		{object}	HttpError
+// @Failure		404		{object}	HttpError
+// @Security		AdminToken
+// @Router			/tenants/{tenant_id} [GET]
+func (h *TenantHttpHandler) GetTenant(c echo.Context) error {
+	tenantIdParam := c.Param("tenant_id")
+	tenant_id, err := strconv.Atoi(tenantIdParam)
+	if err != nil {
+		return respError(c, http.StatusBadRequest, "Invalid tenant_id", fmt.Sprintf("tenant_id %q is not a valid tenant_id as it is not a number", tenantIdParam), ProblemInvalidTenantID)
+	}
+
+	t, err := h.controller.GetTenant(c.Request().Context(), tenant_id)
+	if err != nil {
+		return respTenantError(c, err, tenantIdParam, "get")
+	}
+
+	return respSuccess(c, http.StatusOK, success, NewHttpTenantResponse(*t))
+}
+
+// @Summary		Updates a tenant
+// @Description	Updates a tenant, requires the admin token
+// @ID				UpdateTenant
+// @Tags			tenants
+// @Produce		json,application/problem+json
+// @Param			tenant	body		HttpTenantPut	true	"Tenant Informations"
+// @Param			Idempotency-Key	header	string	false	"Replays the original response when a request is retried with the same key"
+// @Success		200		{object}	HttpSuccess{data=handler.HttpTenantIdResponse,code=int,message=string}
+// @Failure		400		{object}	HttpError	"HttpProblem with field errors when Accept is application/problem+json"
+// @Failure		401		{object}	HttpError
+// @Failure		404		{object}	HttpError
+// @Failure		500		{object}	HttpError
+// @Security		AdminToken
+// @Router			/tenants [PUT]
+func (h *TenantHttpHandler) UpdateTenant(c echo.Context) error {
+	body := HttpTenantPut{}
+
+	if err := c.Bind(&body); err != nil {
+		return respError(c, http.StatusBadRequest, "Invalid body", fmt.Sprintf("Invalid body: %v", err), ProblemInvalidBody)
+	}
+	if err := structValidator.Struct(body); err != nil {
+		return respond(c, http.StatusBadRequest, newValidationError(err))
+	}
+
+	tenantID, err := h.controller.UpdateTenant(c.Request().Context(), body.TenantID, body.Slug, body.Name)
+	if err != nil {
+		return respTenantError(c, err, body.Slug, "update")
+	}
+
+	return respSuccess(c, http.StatusOK, success, HttpTenantIdResponse{TenantID: tenantID})
+}
+
+// @Summary		Deletes a tenant
+// @Description	Deletes a tenant without users, requires the admin token
+// @ID				DeleteTenant
+// @Tags			tenants
+// @Produce		json
+// @Param			tenant_id	path		int	true	"Tenant ID"
+// @Param			Idempotency-Key	header	string	false	"Replays the original response when a request is retried with the same key"
+// @Success		200		{object}	HttpSuccess
+// @Failure		400		{object}	HttpError
+// @Failure		401		{object}	HttpError
+// @Failure		404		{object}	HttpError
+// @Failure		409		{object}	HttpError
+// @Failure		500		{object}	HttpError
+// @Security		AdminToken
+// @Router			/tenants/{tenant_id} [DELETE]
+func (h *TenantHttpHandler) DeleteTenant(c echo.Context) error {
+	tenantIdParam := c.Param("tenant_id")
+	tenant_id, err := strconv.Atoi(tenantIdParam)
+	if err != nil {
+		return respError(c, http.StatusBadRequest, "Invalid tenant_id", fmt.Sprintf("tenant_id %q is not a valid tenant_id as it is not a number", tenantIdParam), ProblemInvalidTenantID)
+	}
+
+	if err := h.controller.DeleteTenant(c.Request().Context(), tenant_id); err != nil {
+		return respTenantError(c, err, tenantIdParam, "delete")
+	}
+
+	return respSuccess(c, http.StatusOK, success)
+}
+
+// respTenantError maps the controller errors to their response, tenant is the
+// slug or id the request was about
+func respTenantError(c echo.Context, err error, tenant, action string) error {
+	var verr *controller.ValidationError
+	switch {
+	case errors.As(err, &verr):
+		return respond(c, http.StatusBadRequest, newControllerValidationError(verr))
+	case errors.Is(err, controller.ErrTenantAlreadyExists):
+		return respond(c, http.StatusBadRequest, newFieldError("Tenant already exists", fmt.Sprintf("tenant with slug %s already exists", tenant), ProblemTenantAlreadyExists, slugTaken))
+	case errors.Is(err, controller.ErrTenantNotFound):
+		return respError(c, http.StatusNotFound, "Tenant not found", fmt.Sprintf("Tenant %q does not exist", tenant), ProblemTenantNotFound)
+	case errors.Is(err, controller.ErrTenantHasUsers):
+		return respError(c, http.StatusConflict, "Tenant has users", fmt.Sprintf("Tenant %q still has users, delete them first", tenant), ProblemTenantHasUsers)
+	default:
+		return respError(c, http.StatusInternalServerError, "Internal Server Error", fmt.Sprintf("Unexpected error trying to %s tenant %s", action, tenant), ProblemInternal)
+	}
+}
+
+func NewHttpTenantResponse(t model.Tenant) HttpTenantResponse {
+	return HttpTenantResponse{
+		TenantID: t.TenantID,
+		Slug:     t.Slug,
+		Name:     t.Name,
+	}
+}
@@ -0,0 +1,156 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+	"users-backend/auth"
+	"users-backend/controller"
+	"users-backend/handler"
+	"users-backend/health"
+	"users-backend/idempotency"
+	"users-backend/logging"
+	"users-backend/mail"
+	"users-backend/model"
+	"users-backend/repo"
+	"users-backend/repo/mock"
+
+	"github.com/labstack/echo/v4"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	testifymock "github.com/stretchr/testify/mock"
+)
+
+// discardMailer counts the messages it drops
+type discardMailer struct {
+	sent int
+}
+
+func (m *discardMailer) Send(ctx context.Context, msg mail.Message) error {
+	m.sent++
+	return nil
+}
+
+var _ = ginkgo.Describe("Account", func() {
+	var (
+		e               *echo.Echo
+		mockUsers       *mock.UserRepoMock
+		mockTokens      *mock.UserTokenRepoMock
+		mockCredentials *mock.CredentialRepoMock
+		mailer          *discardMailer
+		alice           *model.User
+	)
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(echo.HeaderAccept, handler.MIMEApplicationProblemJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	problem := func(rec *httptest.ResponseRecorder) handler.HttpProblem {
+		var p handler.HttpProblem
+		gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &p)).Should(gomega.Succeed())
+		return p
+	}
+
+	ginkgo.BeforeEach(func() {
+		alice = &model.User{UserID: 1, TenantID: model.DefaultTenantID, UserName: "alice", FirstName: "Alice", Email: "alice@email.com", UserStatus: model.Active}
+		mockUsers = mock.NewUserRepoMock()
+		mockTokens = mock.NewUserTokenRepoMock()
+		mockCredentials = mock.NewCredentialRepoMock()
+		mailer = &discardMailer{}
+		mockUsers.On("GetById", 1).Return(alice, nil)
+		mockUsers.On("GetById", 42).Return((*model.User)(nil), fmt.Errorf("%w: no rows", repo.ErrNotFound))
+		mockUsers.On("GetByUsername", "alice").Return(alice, nil)
+		mockUsers.On("GetByUsername", "nobody").Return(nil, fmt.Errorf("%w: no rows", repo.ErrNotFound))
+
+		hasher := auth.NewArgon2idHasher(auth.Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+		passwords := controller.NewAuthController(mockUsers, mockCredentials, nil, logging.Discard(), controller.WithHasher(hasher))
+
+		e = echo.New()
+		handler.InitRouter(e, controller.NewUserController(mockUsers, logging.Discard()), handler.RouterConfig{
+			Health:           health.New(time.Second),
+			Logger:           logging.Discard(),
+			IdempotencyStore: idempotency.NewMemoryStore(),
+			IdempotencyTTL:   time.Hour,
+			Account:          controller.NewAccountController(mockUsers, mockTokens, passwords, mailer, "https://app.example.com", logging.Discard()),
+		})
+	})
+
+	ginkgo.It("should mail a verification link to unverified users", func() {
+		mockTokens.On("CreateUserToken", testifymock.Anything).Return(1, nil)
+
+		rec := request(http.MethodPost, "/api/v1/users/1/email/verification", "")
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusAccepted))
+		gomega.Expect(mailer.sent).Should(gomega.Equal(1))
+
+		alice.EmailVerified = true
+		rec = request(http.MethodPost, "/api/v1/users/1/email/verification", "")
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusConflict))
+		gomega.Expect(problem(rec).Type).Should(gomega.Equal(handler.ProblemEmailAlreadyVerified))
+
+		rec = request(http.MethodPost, "/api/v1/users/42/email/verification", "")
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusNotFound))
+	})
+
+	ginkgo.It("should verify an email with a valid token only", func() {
+		mockTokens.On("ConsumeUserToken", model.TokenVerifyEmail, auth.HashOpaqueToken("valid")).Return(&model.UserToken{UserID: 1, Email: "alice@email.com"}, nil)
+		mockTokens.On("ConsumeUserToken", model.TokenVerifyEmail, auth.HashOpaqueToken("used")).Return(nil, fmt.Errorf("%w: no rows", repo.ErrUserTokenNotFound))
+		mockTokens.On("MarkEmailVerified", 1, "alice@email.com").Return(true, nil)
+
+		rec := request(http.MethodPost, "/api/v1/auth/verify-email", `{"token":"valid"}`)
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusOK))
+
+		rec = request(http.MethodPost, "/api/v1/auth/verify-email", `{"token":"used"}`)
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusBadRequest))
+		gomega.Expect(problem(rec).Type).Should(gomega.Equal(handler.ProblemInvalidLink))
+
+		rec = request(http.MethodPost, "/api/v1/auth/verify-email", `{}`)
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusBadRequest))
+		gomega.Expect(problem(rec).Errors).Should(gomega.ConsistOf(handler.HttpFieldError{Field: "token", Rule: "required", Message: "is required"}))
+	})
+
+	ginkgo.It("should answer password reset requests alike for unknown users", func() {
+		mockTokens.On("CreateUserToken", testifymock.Anything).Return(1, nil)
+
+		known := request(http.MethodPost, "/api/v1/auth/password-reset", `{"user_name":"alice"}`)
+		unknown := request(http.MethodPost, "/api/v1/auth/password-reset", `{"user_name":"nobody"}`)
+
+		gomega.Expect(known.Code).Should(gomega.Equal(http.StatusAccepted))
+		gomega.Expect(unknown.Code).Should(gomega.Equal(known.Code))
+		gomega.Expect(unknown.Body.String()).Should(gomega.Equal(known.Body.String()))
+		gomega.Expect(mailer.sent).Should(gomega.Equal(1))
+	})
+
+	ginkgo.It("should reset the password with a valid token", func() {
+		mockTokens.On("ConsumeUserToken", model.TokenResetPassword, auth.HashOpaqueToken("valid")).Return(&model.UserToken{UserID: 1, Email: "alice@email.com"}, nil)
+		mockTokens.On("ConsumeUserToken", model.TokenResetPassword, auth.HashOpaqueToken("expired")).Return(nil, fmt.Errorf("%w: no rows", repo.ErrUserTokenNotFound))
+		mockTokens.On("MarkEmailVerified", 1, "alice@email.com").Return(true, nil)
+		mockCredentials.On("SetPassword", 1, testifymock.AnythingOfType("string")).Return(nil)
+
+		rec := request(http.MethodPost, "/api/v1/auth/password-reset/confirm", `{"token":"valid","password":"short"}`)
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusBadRequest))
+		gomega.Expect(problem(rec).Errors).Should(gomega.ConsistOf(handler.HttpFieldError{Field: "password", Rule: "min", Message: "must be at least 12 characters"}))
+
+		rec = request(http.MethodPost, "/api/v1/auth/password-reset/confirm", `{"token":"valid","password":"correct horse battery staple"}`)
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusOK))
+		mockCredentials.AssertNumberOfCalls(ginkgo.GinkgoT(), "SetPassword", 1)
+
+		rec = request(http.MethodPost, "/api/v1/auth/password-reset/confirm", `{"token":"expired","password":"correct horse battery staple"}`)
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusBadRequest))
+		gomega.Expect(problem(rec).Type).Should(gomega.Equal(handler.ProblemInvalidLink))
+	})
+
+	ginkgo.It("should not serve the login without an auth controller", func() {
+		rec := request(http.MethodPost, "/api/v1/auth/login", `{"user_name":"alice","password":"x"}`)
+
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusNotFound))
+	})
+})
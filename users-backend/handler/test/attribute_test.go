@@ -0,0 +1,201 @@
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+	"users-backend/controller"
+	"users-backend/handler"
+	"users-backend/health"
+	"users-backend/idempotency"
+	"users-backend/logging"
+	"users-backend/model"
+	"users-backend/repo"
+	"users-backend/repo/mock"
+
+	"github.com/labstack/echo/v4"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	testifymock "github.com/stretchr/testify/mock"
+)
+
+var _ = ginkgo.Describe("Attributes", func() {
+	var (
+		e              *echo.Echo
+		mockUsers      *mock.UserRepoMock
+		mockTenants    *mock.TenantRepoMock
+		mockAttributes *mock.AttributeRepoMock
+	)
+
+	definitions := []model.AttributeDefinition{
+		{AttributeID: 1, TenantID: 2, Name: "employee_number", Type: model.AttributeNumber, Unique: true},
+		{AttributeID: 2, TenantID: 2, Name: "location", Type: model.AttributeEnum, EnumValues: []string{"Paris", "Berlin"}},
+	}
+
+	request := func(method, path, body string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	admin := []string{echo.HeaderAuthorization, "Bearer admin-token"}
+	problem := []string{echo.HeaderAccept, handler.MIMEApplicationProblemJSON}
+
+	ginkgo.BeforeEach(func() {
+		mockUsers = mock.NewUserRepoMock()
+		mockUsers.On("LockAttribute", testifymock.Anything).Return(nil)
+		mockTenants = mock.NewTenantRepoMock()
+		mockAttributes = mock.NewAttributeRepoMock()
+		mockTenants.On("GetTenant", 2).Return(&model.Tenant{TenantID: 2, Slug: "acme"}, nil)
+		mockTenants.On("GetTenant", 9).Return(nil, fmt.Errorf("%w: no rows", repo.ErrTenantNotFound))
+		mockTenants.On("GetTenantBySlug", "acme").Return(&model.Tenant{TenantID: 2, Slug: "acme"}, nil)
+		mockAttributes.On("GetAttributes").Return(&definitions, nil)
+
+		e = echo.New()
+		userController := controller.NewUserController(mockUsers, logging.Discard(), controller.WithAttributes(mockAttributes))
+		handler.InitRouter(e, userController, handler.RouterConfig{
+			Health:           health.New(time.Second),
+			Logger:           logging.Discard(),
+			IdempotencyStore: idempotency.NewMemoryStore(),
+			IdempotencyTTL:   time.Hour,
+			Tenant: &handler.TenantConfig{
+				Controller: controller.NewTenantController(mockTenants, logging.Discard()),
+				Default:    "acme",
+				AdminToken: "admin-token",
+			},
+			Attributes: controller.NewAttributeController(mockAttributes, logging.Discard()),
+		})
+	})
+
+	ginkgo.Describe("admin endpoints", func() {
+		ginkgo.It("should define an attribute for the tenant of the path", func() {
+			mockAttributes.On("CreateAttribute", &model.AttributeDefinition{Name: "location", Type: model.AttributeEnum, EnumValues: []string{"Paris", "Berlin"}}).Return(2, nil)
+
+			rec := request(http.MethodPost, "/api/v1/tenants/2/attributes", `{"name":"location","type":"enum","enum_values":["Paris","Berlin"]}`, admin...)
+
+			var res handler.HttpSuccess
+			gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &res)).Should(gomega.Succeed())
+			gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusCreated))
+			gomega.Expect(res.Data).Should(gomega.Equal(map[string]interface{}{"attribute_id": float64(2)}))
+		})
+
+		ginkgo.It("should list the attributes and require the admin token", func() {
+			rec := request(http.MethodGet, "/api/v1/tenants/2/attributes", "", admin...)
+
+			var res struct {
+				Data []handler.HttpAttributeResponse `json:"data"`
+			}
+			gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &res)).Should(gomega.Succeed())
+			gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusOK))
+			gomega.Expect(res.Data).Should(gomega.Equal([]handler.HttpAttributeResponse{
+				{AttributeID: 1, Name: "employee_number", Type: "number", Unique: true},
+				{AttributeID: 2, Name: "location", Type: "enum", EnumValues: []string{"Paris", "Berlin"}},
+			}))
+
+			gomega.Expect(request(http.MethodGet, "/api/v1/tenants/2/attributes", "").Code).Should(gomega.Equal(http.StatusUnauthorized))
+		})
+
+		ginkgo.It("should report unknown tenants and attributes and duplicate names as problems", func() {
+			mockAttributes.On("GetAttribute", 5).Return(nil, fmt.Errorf("%w: no rows", repo.ErrAttributeNotFound))
+			mockAttributes.On("CreateAttribute", testifymock.Anything).Return(-1, fmt.Errorf("%w: duplicate key", repo.ErrDuplicateAttribute))
+
+			for _, tc := range []struct {
+				method, path, body, problemType string
+				status                          int
+			}{
+				{http.MethodGet, "/api/v1/tenants/9/attributes", "", handler.ProblemTenantNotFound, http.StatusNotFound},
+				{http.MethodGet, "/api/v1/tenants/2/attributes/5", "", handler.ProblemAttributeNotFound, http.StatusNotFound},
+				{http.MethodDelete, "/api/v1/tenants/2/attributes/x", "", handler.ProblemInvalidAttributeID, http.StatusBadRequest},
+				{http.MethodPost, "/api/v1/tenants/2/attributes", `{"name":"location","type":"string"}`, handler.ProblemAttributeAlreadyExists, http.StatusBadRequest},
+				{http.MethodPost, "/api/v1/tenants/2/attributes", `{"name":"Location","type":"string"}`, handler.ProblemValidationFailed, http.StatusBadRequest},
+			} {
+				rec := request(tc.method, tc.path, tc.body, append(admin, problem...)...)
+
+				var res handler.HttpProblem
+				gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &res)).Should(gomega.Succeed())
+				gomega.Expect(rec.Code).Should(gomega.Equal(tc.status), tc.path)
+				gomega.Expect(res.Type).Should(gomega.Equal(tc.problemType), tc.path)
+			}
+		})
+	})
+
+	ginkgo.Describe("users", func() {
+		ginkgo.It("should create a user with attributes and return them", func() {
+			stored := &model.User{
+				TenantID: 2, UserName: "johndoe", FirstName: "John", LastName: "Doe", Email: "johndoe@email.com", UserStatus: "A",
+				Attributes: model.Attributes{"employee_number": float64(42), "location": "Paris"},
+			}
+			mockUsers.On("GetByUsername", "johndoe").Return(nil, errors.New("no rows"))
+			mockUsers.On("FindByAttributes", model.Attributes{"employee_number": float64(42)}).Return(&[]model.User{}, nil)
+			mockUsers.On("Create", testifymock.MatchedBy(func(u *model.User) bool {
+				return u.Attributes["employee_number"] == float64(42) && u.Attributes["location"] == "Paris"
+			})).Return(1, nil)
+			mockUsers.On("GetById", 1).Return(stored, nil)
+
+			rec := request(http.MethodPost, "/api/v1/users", `{"user_name":"johndoe","first_name":"John","last_name":"Doe","email":"johndoe@email.com","user_status":"A","attributes":{"employee_number":42,"location":"Paris"}}`)
+			gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusCreated))
+
+			rec = request(http.MethodGet, "/api/v1/users/1", "")
+			var res struct {
+				Data handler.HttpUserResponse `json:"data"`
+			}
+			gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &res)).Should(gomega.Succeed())
+			gomega.Expect(res.Data.Attributes).Should(gomega.Equal(map[string]interface{}{"employee_number": float64(42), "location": "Paris"}))
+		})
+
+		ginkgo.It("should report invalid attributes as field errors", func() {
+			rec := request(http.MethodPost, "/api/v1/users", `{"user_name":"johndoe","first_name":"John","last_name":"Doe","email":"johndoe@email.com","user_status":"A","attributes":{"location":"Rome","badge":1}}`, problem...)
+
+			var res handler.HttpProblem
+			gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &res)).Should(gomega.Succeed())
+			gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusBadRequest))
+			gomega.Expect(res.Errors).Should(gomega.ConsistOf(
+				handler.HttpFieldError{Field: "attributes.badge", Rule: "unknown", Message: "is not a defined attribute"},
+				handler.HttpFieldError{Field: "attributes.location", Rule: "enum", Message: "must be one of: Paris, Berlin"},
+			))
+		})
+
+		ginkgo.It("should filter the users by attribute", func() {
+			mockUsers.On("FindByAttributes", model.Attributes{"employee_number": float64(42)}).Return(&[]model.User{{UserID: 1, UserName: "johndoe"}}, nil)
+
+			rec := request(http.MethodGet, "/api/v1/users?attr.employee_number=42", "")
+			var res struct {
+				Data []handler.HttpUserResponse `json:"data"`
+			}
+			gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &res)).Should(gomega.Succeed())
+			gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusOK))
+			gomega.Expect(res.Data).Should(gomega.HaveLen(1))
+
+			rec = request(http.MethodGet, "/api/v1/users?attr.badge=1", "", problem...)
+			var p handler.HttpProblem
+			gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &p)).Should(gomega.Succeed())
+			gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusBadRequest))
+			gomega.Expect(p.Errors[0].Field).Should(gomega.Equal("attributes.badge"))
+			mockUsers.AssertNotCalled(ginkgo.GinkgoT(), "GetAll")
+		})
+
+		ginkgo.It("should merge patched attributes and drop null ones", func() {
+			mockUsers.On("GetById", 1).Return(&model.User{
+				UserID: 1, TenantID: 2, UserName: "johndoe", FirstName: "John", LastName: "Doe", Email: "johndoe@email.com", UserStatus: "A",
+				Attributes: model.Attributes{"employee_number": float64(42), "location": "Paris"},
+			}, nil)
+			mockUsers.On("GetByUsername", "johndoe").Return(&model.User{UserID: 1, UserName: "johndoe"}, nil)
+			mockUsers.On("Update", testifymock.Anything).Return(1, nil)
+
+			rec := request(http.MethodPost, "/api/v1/users/batch", `{"operations":[{"op":"patch","user_id":1,"body":{"attributes":{"employee_number":null,"location":"Berlin"}}}]}`)
+			gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusOK))
+
+			updated := mockUsers.Calls[len(mockUsers.Calls)-1].Arguments.Get(0).(*model.User)
+			gomega.Expect(updated.Attributes).Should(gomega.Equal(model.Attributes{"location": "Berlin"}))
+		})
+	})
+})
@@ -0,0 +1,309 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+	"users-backend/auth"
+	"users-backend/controller"
+	"users-backend/handler"
+	"users-backend/health"
+	"users-backend/idempotency"
+	"users-backend/logging"
+	"users-backend/model"
+	"users-backend/repo"
+	"users-backend/repo/mock"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	testifymock "github.com/stretchr/testify/mock"
+)
+
+var _ = ginkgo.Describe("Auth", func() {
+	const password = "correct horse battery staple"
+
+	var (
+		e               *echo.Echo
+		mockUsers       *mock.UserRepoMock
+		mockCredentials *mock.CredentialRepoMock
+		tokens          *auth.TokenSigner
+		hasher          = auth.NewArgon2idHasher(auth.Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+		alice           *model.User
+	)
+
+	request := func(method, path, body string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(echo.HeaderAccept, handler.MIMEApplicationProblemJSON)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	problem := func(rec *httptest.ResponseRecorder) handler.HttpProblem {
+		var p handler.HttpProblem
+		gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &p)).Should(gomega.Succeed())
+		return p
+	}
+
+	credential := func(lockedUntil time.Time) *model.Credential {
+		hash, err := hasher.Hash(password)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		return &model.Credential{UserID: 1, PasswordHash: hash, LockedUntil: lockedUntil}
+	}
+
+	admin := []string{echo.HeaderAuthorization, "Bearer admin-token"}
+
+	bearer := func() []string {
+		signed, err := tokens.Sign(1, model.DefaultTenantID, "alice", time.Now())
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		return []string{echo.HeaderAuthorization, "Bearer " + signed.Value}
+	}
+
+	ginkgo.BeforeEach(func() {
+		var err error
+		tokens, err = auth.NewTokenSigner([]byte(strings.Repeat("s", auth.MinSecretLength)), time.Hour)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+		alice = &model.User{UserID: 1, TenantID: model.DefaultTenantID, UserName: "alice", Email: "alice@email.com", UserStatus: model.Active}
+		mockUsers = mock.NewUserRepoMock()
+		mockCredentials = mock.NewCredentialRepoMock()
+		mockUsers.On("GetByUsername", "alice").Return(alice, nil)
+		mockUsers.On("GetById", 1).Return(alice, nil)
+		mockUsers.On("GetById", 42).Return((*model.User)(nil), fmt.Errorf("%w: no rows", repo.ErrNotFound))
+		mockTenants := mock.NewTenantRepoMock()
+		mockTenants.On("GetTenant", model.DefaultTenantID).Return(&model.Tenant{TenantID: model.DefaultTenantID, Slug: model.DefaultTenantSlug}, nil)
+		mockTenants.On("GetTenantBySlug", model.DefaultTenantSlug).Return(&model.Tenant{TenantID: model.DefaultTenantID, Slug: model.DefaultTenantSlug}, nil)
+
+		e = echo.New()
+		handler.InitRouter(e, controller.NewUserController(mockUsers, logging.Discard()), handler.RouterConfig{
+			Health:           health.New(time.Second),
+			Logger:           logging.Discard(),
+			IdempotencyStore: idempotency.NewMemoryStore(),
+			IdempotencyTTL:   time.Hour,
+			Tenant: &handler.TenantConfig{
+				Controller: controller.NewTenantController(mockTenants, logging.Discard()),
+				Default:    model.DefaultTenantSlug,
+				AdminToken: "admin-token",
+			},
+			Auth: controller.NewAuthController(mockUsers, mockCredentials, tokens, logging.Discard(), controller.WithHasher(hasher)),
+		})
+	})
+
+	ginkgo.It("should return a token for the right password", func() {
+		mockCredentials.On("GetCredential", 1).Return(credential(time.Time{}), nil)
+
+		rec := request(http.MethodPost, "/api/v1/auth/login", fmt.Sprintf(`{"user_name":"alice","password":%q}`, password))
+
+		var res struct {
+			Data handler.HttpLoginResponse `json:"data"`
+		}
+		gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &res)).Should(gomega.Succeed())
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusOK))
+		gomega.Expect(rec.Header().Get(echo.HeaderCacheControl)).Should(gomega.Equal("no-store"))
+		gomega.Expect(res.Data.TokenType).Should(gomega.Equal("Bearer"))
+		gomega.Expect(res.Data.ExpiresIn).Should(gomega.BeNumerically("~", 3600, 2))
+
+		claims, err := tokens.Verify(res.Data.AccessToken)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(claims.Subject).Should(gomega.Equal("1"))
+		gomega.Expect(claims.TenantID).Should(gomega.Equal(model.DefaultTenantID))
+	})
+
+	ginkgo.It("should return 401 for a wrong password", func() {
+		mockCredentials.On("GetCredential", 1).Return(credential(time.Time{}), nil)
+		mockCredentials.On("RecordLoginFailure", 1).Return(1, nil)
+
+		rec := request(http.MethodPost, "/api/v1/auth/login", `{"user_name":"alice","password":"wrong password"}`)
+
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusUnauthorized))
+		gomega.Expect(problem(rec).Type).Should(gomega.Equal(handler.ProblemInvalidCredentials))
+	})
+
+	ginkgo.It("should return 403 with Retry-After for a locked account", func() {
+		mockCredentials.On("GetCredential", 1).Return(credential(time.Now().Add(time.Minute)), nil)
+
+		rec := request(http.MethodPost, "/api/v1/auth/login", fmt.Sprintf(`{"user_name":"alice","password":%q}`, password))
+
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusForbidden))
+		gomega.Expect(problem(rec).Type).Should(gomega.Equal(handler.ProblemAccountLocked))
+		gomega.Expect(rec.Header().Get(handler.HeaderRetryAfter)).Should(gomega.Equal("60"))
+	})
+
+	ginkgo.It("should return 403 for a terminated user", func() {
+		alice.UserStatus = model.Terminated
+		mockCredentials.On("GetCredential", 1).Return(credential(time.Time{}), nil)
+
+		rec := request(http.MethodPost, "/api/v1/auth/login", fmt.Sprintf(`{"user_name":"alice","password":%q}`, password))
+
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusForbidden))
+		gomega.Expect(problem(rec).Type).Should(gomega.Equal(handler.ProblemAccountDisabled))
+	})
+
+	ginkgo.It("should require a user name and a password", func() {
+		rec := request(http.MethodPost, "/api/v1/auth/login", `{"user_name":"alice"}`)
+
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusBadRequest))
+		gomega.Expect(problem(rec).Errors).Should(gomega.ConsistOf(handler.HttpFieldError{Field: "password", Rule: "required", Message: "is required"}))
+	})
+
+	ginkgo.It("should set a password that follows the policy", func() {
+		mockCredentials.On("SetPassword", 1, testifymock.AnythingOfType("string")).Return(nil)
+
+		rec := request(http.MethodPut, "/api/v1/tenants/1/users/1/password", fmt.Sprintf(`{"password":%q}`, password), admin...)
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusOK))
+
+		rec = request(http.MethodPut, "/api/v1/tenants/1/users/1/password", `{"password":"short"}`, admin...)
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusBadRequest))
+		gomega.Expect(problem(rec).Errors).Should(gomega.ConsistOf(handler.HttpFieldError{Field: "password", Rule: "min", Message: "must be at least 12 characters"}))
+
+		rec = request(http.MethodPut, "/api/v1/tenants/1/users/42/password", fmt.Sprintf(`{"password":%q}`, password), admin...)
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusNotFound))
+		mockCredentials.AssertNumberOfCalls(ginkgo.GinkgoT(), "SetPassword", 1)
+	})
+
+	ginkgo.It("should delete a password", func() {
+		mockCredentials.On("DeleteCredential", 1).Return(nil)
+
+		rec := request(http.MethodDelete, "/api/v1/tenants/1/users/1/password", "", admin...)
+
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusOK))
+		mockCredentials.AssertExpectations(ginkgo.GinkgoT())
+	})
+
+	ginkgo.It("should only let admins set and delete passwords", func() {
+		body := fmt.Sprintf(`{"password":%q}`, password)
+		gomega.Expect(request(http.MethodPut, "/api/v1/tenants/1/users/1/password", body).Code).Should(gomega.Equal(http.StatusUnauthorized))
+		gomega.Expect(request(http.MethodPut, "/api/v1/tenants/1/users/1/password", body, bearer()...).Code).Should(gomega.Equal(http.StatusUnauthorized))
+		gomega.Expect(request(http.MethodDelete, "/api/v1/tenants/1/users/1/password", "").Code).Should(gomega.Equal(http.StatusUnauthorized))
+		gomega.Expect(request(http.MethodPut, "/api/v1/users/1/password", body).Code).Should(gomega.Equal(http.StatusNotFound))
+		gomega.Expect(request(http.MethodDelete, "/api/v1/users/1/password", "").Code).Should(gomega.Equal(http.StatusNotFound))
+		mockCredentials.AssertNotCalled(ginkgo.GinkgoT(), "SetPassword", testifymock.Anything, testifymock.Anything)
+		mockCredentials.AssertNotCalled(ginkgo.GinkgoT(), "DeleteCredential", testifymock.Anything)
+	})
+
+	ginkgo.It("should change the password of the logged in user", func() {
+		const newPassword = "a brand new passphrase"
+		mockCredentials.On("GetCredential", 1).Return(credential(time.Time{}), nil)
+		mockCredentials.On("SetPassword", 1, testifymock.AnythingOfType("string")).Return(nil)
+
+		body := fmt.Sprintf(`{"current_password":%q,"password":%q}`, password, newPassword)
+		rec := request(http.MethodPut, "/api/v1/auth/password", body)
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusUnauthorized))
+
+		rec = request(http.MethodPut, "/api/v1/auth/password", body, bearer()...)
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusOK))
+		hash := mockCredentials.Calls[len(mockCredentials.Calls)-1].Arguments.String(1)
+		ok, err := hasher.Verify(hash, newPassword)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(ok).Should(gomega.BeTrue())
+	})
+
+	ginkgo.It("should not change the password without the current one", func() {
+		mockCredentials.On("GetCredential", 1).Return(credential(time.Time{}), nil)
+		mockCredentials.On("RecordLoginFailure", 1).Return(1, nil)
+
+		rec := request(http.MethodPut, "/api/v1/auth/password", `{"current_password":"wrong password","password":"a brand new passphrase"}`, bearer()...)
+
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusUnauthorized))
+		gomega.Expect(problem(rec).Type).Should(gomega.Equal(handler.ProblemInvalidCredentials))
+		mockCredentials.AssertCalled(ginkgo.GinkgoT(), "RecordLoginFailure", 1)
+		mockCredentials.AssertNotCalled(ginkgo.GinkgoT(), "SetPassword", testifymock.Anything, testifymock.Anything)
+
+		rec = request(http.MethodPut, "/api/v1/auth/password", `{"password":"a brand new passphrase"}`, bearer()...)
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusBadRequest))
+	})
+})
+
+var _ = ginkgo.Describe("Auth with tenants resolved from tokens", func() {
+	const (
+		password = "correct horse battery staple"
+		acme     = 2
+	)
+
+	var (
+		e               *echo.Echo
+		mockCredentials *mock.CredentialRepoMock
+		tokens          *auth.TokenSigner
+		hasher          = auth.NewArgon2idHasher(auth.Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+		tenantSecret    = []byte("tenant-secret")
+	)
+
+	request := func(method, path, body, authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(echo.HeaderAuthorization, authorization)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	tenantToken := func(slug string) string {
+		signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"tenant": slug}).SignedString(tenantSecret)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		return "Bearer " + signed
+	}
+
+	ginkgo.BeforeEach(func() {
+		var err error
+		tokens, err = auth.NewTokenSigner([]byte(strings.Repeat("s", auth.MinSecretLength)), time.Hour)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+		hash, err := hasher.Hash(password)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		alice := &model.User{UserID: 1, TenantID: acme, UserName: "alice", Email: "alice@email.com", UserStatus: model.Active}
+		mockUsers := mock.NewUserRepoMock()
+		mockUsers.On("GetByUsername", "alice").Return(alice, nil)
+		mockUsers.On("GetById", 1).Return(alice, nil)
+		mockCredentials = mock.NewCredentialRepoMock()
+		mockCredentials.On("GetCredential", 1).Return(&model.Credential{UserID: 1, TenantID: acme, PasswordHash: hash}, nil)
+		mockCredentials.On("SetPassword", 1, testifymock.AnythingOfType("string")).Return(nil)
+		mockTenants := mock.NewTenantRepoMock()
+		mockTenants.On("GetTenantBySlug", "acme").Return(&model.Tenant{TenantID: acme, Slug: "acme"}, nil)
+
+		e = echo.New()
+		handler.InitRouter(e, controller.NewUserController(mockUsers, logging.Discard()), handler.RouterConfig{
+			Health:           health.New(time.Second),
+			Logger:           logging.Discard(),
+			IdempotencyStore: idempotency.NewMemoryStore(),
+			IdempotencyTTL:   time.Hour,
+			Tenant: &handler.TenantConfig{
+				Controller: controller.NewTenantController(mockTenants, logging.Discard()),
+				Resolvers:  []handler.TenantResolver{handler.TenantFromToken(tenantSecret, "tenant")},
+			},
+			Auth: controller.NewAuthController(mockUsers, mockCredentials, tokens, logging.Discard(), controller.WithHasher(hasher)),
+		})
+	})
+
+	ginkgo.It("should scope the routes of a logged in user to the tenant of its login token", func() {
+		rec := request(http.MethodPost, "/api/v1/auth/login", fmt.Sprintf(`{"user_name":"alice","password":%q}`, password), tenantToken("acme"))
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusOK), rec.Body.String())
+		var res struct {
+			Data handler.HttpLoginResponse `json:"data"`
+		}
+		gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &res)).Should(gomega.Succeed())
+
+		rec = request(http.MethodPut, "/api/v1/auth/password", fmt.Sprintf(`{"current_password":%q,"password":"a brand new passphrase"}`, password), "Bearer "+res.Data.AccessToken)
+
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusOK), rec.Body.String())
+		mockCredentials.AssertCalled(ginkgo.GinkgoT(), "SetPassword", 1, testifymock.AnythingOfType("string"))
+	})
+
+	ginkgo.It("should still reject tokens signed by neither secret", func() {
+		forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "1", "tid": acme, "iss": auth.TokenIssuer}).SignedString([]byte("guessed"))
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+		rec := request(http.MethodPut, "/api/v1/auth/password", fmt.Sprintf(`{"current_password":%q,"password":"a brand new passphrase"}`, password), "Bearer "+forged)
+
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusUnauthorized))
+		mockCredentials.AssertNotCalled(ginkgo.GinkgoT(), "SetPassword", testifymock.Anything, testifymock.Anything)
+	})
+})
@@ -0,0 +1,156 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"users-backend/controller"
+	"users-backend/handler"
+	"users-backend/logging"
+	"users-backend/model"
+	"users-backend/repo"
+	"users-backend/repo/mock"
+
+	"github.com/labstack/echo/v4"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Batch Handler", func() {
+	var (
+		mockRepo *mock.UserRepoMock
+		e        *echo.Echo
+	)
+
+	batch := func(body string) (*httptest.ResponseRecorder, handler.HttpBatchResponse) {
+		req := httptest.NewRequest(http.MethodPost, "/user/batch", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		var res handler.HttpSuccess
+		var resData handler.HttpBatchResponse
+		json.Unmarshal(rec.Body.Bytes(), &res)
+		jsonData, _ := json.Marshal(res.Data)
+		json.Unmarshal(jsonData, &resData)
+		return rec, resData
+	}
+
+	ginkgo.BeforeEach(func() {
+		mockRepo = mock.NewUserRepoMock()
+		e = echo.New()
+		handler.NewUserHttpHandler(e.Group("/user"), controller.NewUserController(mockRepo, logging.Discard())).RegisterRoutes()
+	})
+
+	ginkgo.It("should run every operation and report each status", func() {
+		stored := &model.User{UserID: 2, UserName: "janedoe", FirstName: "Jane", LastName: "Doe", Email: "jane@email.com", UserStatus: "A"}
+		patched := *stored
+		patched.UserStatus = "I"
+
+		mockRepo.On("GetByUsername", "johndoe").Return(nil, errors.New("error finding user with username"))
+		mockRepo.On("Create", &model.User{UserName: "johndoe", FirstName: "John", LastName: "Doe", Email: "johndoe@email.com", UserStatus: "A"}).Return(1, nil)
+		mockRepo.On("GetById", 2).Return(stored, nil)
+		mockRepo.On("GetByUsername", "janedoe").Return(stored, nil)
+		mockRepo.On("Update", &patched).Return(2, nil)
+		mockRepo.On("GetById", 3).Return(&model.User{UserID: 3}, nil)
+		mockRepo.On("ReassignReports", 3, 0).Return(0, nil)
+		mockRepo.On("Delete", 3).Return(errors.New("no rows"))
+
+		rec, res := batch(`{"operations": [
+			{"op": "create", "body": {"user_name": "johndoe", "first_name": "John", "last_name": "Doe", "email": "johndoe@email.com", "user_status": "A"}},
+			{"op": "patch", "user_id": 2, "body": {"user_status": "Inactive"}},
+			{"op": "delete", "user_id": 3},
+			{"op": "create", "body": {"user_name": "nobody"}}
+		]}`)
+
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusOK))
+		gomega.Expect(res.Committed).Should(gomega.BeTrue())
+		gomega.Expect(res.Results).Should(gomega.HaveLen(4))
+		gomega.Expect(res.Results[0].Status).Should(gomega.Equal(http.StatusCreated))
+		gomega.Expect(res.Results[1].Status).Should(gomega.Equal(http.StatusOK))
+		gomega.Expect(res.Results[2].Status).Should(gomega.Equal(http.StatusNotFound))
+		gomega.Expect(res.Results[3].Status).Should(gomega.Equal(http.StatusBadRequest))
+	})
+
+	ginkgo.It("should roll back every operation of an atomic batch when one fails", func() {
+		for _, id := range []int{1, 2} {
+			mockRepo.On("GetById", id).Return(&model.User{UserID: id}, nil)
+			mockRepo.On("ReassignReports", id, 0).Return(0, nil)
+		}
+		mockRepo.On("Delete", 1).Return(nil)
+		mockRepo.On("Delete", 2).Return(errors.New("no rows"))
+
+		rec, res := batch(`{"atomic": true, "operations": [
+			{"op": "delete", "user_id": 1},
+			{"op": "delete", "user_id": 2},
+			{"op": "delete", "user_id": 3}
+		]}`)
+
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusOK))
+		gomega.Expect(res.Committed).Should(gomega.BeFalse())
+		gomega.Expect(res.Results[0].Status).Should(gomega.Equal(http.StatusFailedDependency))
+		gomega.Expect(res.Results[1].Status).Should(gomega.Equal(http.StatusNotFound))
+		gomega.Expect(res.Results[2].Status).Should(gomega.Equal(http.StatusFailedDependency))
+		mockRepo.AssertNotCalled(ginkgo.GinkgoT(), "Delete", 3)
+	})
+
+	ginkgo.It("should only report a missing user as not found when patching", func() {
+		mockRepo.On("GetById", 4).Return((*model.User)(nil), fmt.Errorf("%w: no rows", repo.ErrNotFound))
+		mockRepo.On("GetById", 5).Return((*model.User)(nil), errors.New("connection reset by peer"))
+
+		rec, res := batch(`{"operations": [
+			{"op": "patch", "user_id": 4, "body": {"user_status": "Inactive"}},
+			{"op": "patch", "user_id": 5, "body": {"user_status": "Inactive"}}
+		]}`)
+
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusOK))
+		gomega.Expect(res.Results[0].Status).Should(gomega.Equal(http.StatusNotFound))
+		gomega.Expect(res.Results[1].Status).Should(gomega.Equal(http.StatusInternalServerError))
+		gomega.Expect(rec.Body.String()).ShouldNot(gomega.ContainSubstring("connection reset"))
+	})
+
+	ginkgo.It("should only mail verification links once an atomic batch commits", func() {
+		accounts := &recordingAccounts{}
+		e = echo.New()
+		handler.NewUserHttpHandler(e.Group("/user"), controller.Chain(controller.NewUserController(mockRepo, logging.Discard()),
+			controller.WithEmailVerification(accounts, logging.Discard()))).RegisterRoutes()
+		mockRepo.On("GetByUsername", "johndoe").Return(nil, errors.New("error finding user with username"))
+		mockRepo.On("Create", &model.User{UserName: "johndoe", FirstName: "John", LastName: "Doe", Email: "johndoe@email.com", UserStatus: "A"}).Return(1, nil)
+		create := `{"op": "create", "body": {"user_name": "johndoe", "first_name": "John", "last_name": "Doe", "email": "johndoe@email.com", "user_status": "A"}}`
+
+		_, res := batch(`{"atomic": true, "operations": [` + create + `, {"op": "create", "body": {"user_name": "nobody"}}]}`)
+		gomega.Expect(res.Committed).Should(gomega.BeFalse())
+		gomega.Expect(accounts.sent).Should(gomega.BeEmpty())
+
+		_, res = batch(`{"atomic": true, "operations": [` + create + `]}`)
+		gomega.Expect(res.Committed).Should(gomega.BeTrue())
+		gomega.Expect(accounts.sent).Should(gomega.Equal([]int{1}))
+	})
+
+	ginkgo.It("should return 400 Bad Request for an unknown operation", func() {
+		rec, _ := batch(`{"operations": [{"op": "merge"}]}`)
+
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusBadRequest))
+	})
+
+	ginkgo.It("should return 400 Bad Request without operations", func() {
+		rec, _ := batch(`{"operations": []}`)
+
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusBadRequest))
+	})
+})
+
+// recordingAccounts records the users sent a verification link
+type recordingAccounts struct {
+	controller.AccountController
+	sent []int
+}
+
+func (a *recordingAccounts) SendEmailVerification(ctx context.Context, user_id int) error {
+	a.sent = append(a.sent, user_id)
+	return nil
+}
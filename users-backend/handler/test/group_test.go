@@ -0,0 +1,159 @@
+package test
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+	"users-backend/controller"
+	"users-backend/handler"
+	"users-backend/health"
+	"users-backend/idempotency"
+	"users-backend/logging"
+	"users-backend/model"
+	"users-backend/repo"
+	"users-backend/repo/mock"
+
+	"github.com/labstack/echo/v4"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	testifymock "github.com/stretchr/testify/mock"
+)
+
+var _ = ginkgo.Describe("Groups", func() {
+	var (
+		e          *echo.Echo
+		mockUsers  *mock.UserRepoMock
+		mockGroups *mock.GroupRepoMock
+	)
+
+	eng := model.Group{GroupID: 1, Name: "Engineering"}
+	backend := model.Group{GroupID: 2, Name: "Backend", Description: "APIs", ParentID: sql.NullInt64{Int64: 1, Valid: true}}
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(echo.HeaderAccept, handler.MIMEApplicationProblemJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	ginkgo.BeforeEach(func() {
+		mockUsers = mock.NewUserRepoMock()
+		mockGroups = mock.NewGroupRepoMock()
+		mockGroups.On("GetGroup", 1).Return(&eng, nil)
+		mockGroups.On("GetGroup", 2).Return(&backend, nil)
+		mockGroups.On("LockGroupHierarchy").Return(nil)
+		mockGroups.On("GetGroup", 9).Return(nil, fmt.Errorf("%w: no rows", repo.ErrGroupNotFound))
+		mockUsers.On("GetById", 1).Return(&model.User{UserID: 1, UserName: "johndoe"}, nil)
+		mockUsers.On("GetById", 42).Return((*model.User)(nil), fmt.Errorf("%w: no rows", repo.ErrNotFound))
+
+		e = echo.New()
+		handler.InitRouter(e, controller.NewUserController(mockUsers, logging.Discard()), handler.RouterConfig{
+			Health:           health.New(time.Second),
+			Logger:           logging.Discard(),
+			IdempotencyStore: idempotency.NewMemoryStore(),
+			IdempotencyTTL:   time.Hour,
+			Groups:           controller.NewGroupController(mockGroups, mockUsers, logging.Discard()),
+		})
+	})
+
+	ginkgo.It("should create a nested group", func() {
+		mockGroups.On("CreateGroup", &model.Group{Name: "Backend", Description: "APIs", ParentID: sql.NullInt64{Int64: 1, Valid: true}}).Return(2, nil)
+
+		rec := request(http.MethodPost, "/api/v1/groups", `{"name":"Backend","description":"APIs","parent_id":1}`)
+
+		var res handler.HttpSuccess
+		gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &res)).Should(gomega.Succeed())
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusCreated))
+		gomega.Expect(res.Data).Should(gomega.Equal(map[string]interface{}{"group_id": float64(2)}))
+	})
+
+	ginkgo.It("should list the groups with their parent", func() {
+		mockGroups.On("GetGroups").Return(&[]model.Group{backend, eng}, nil)
+
+		rec := request(http.MethodGet, "/api/v1/groups", "")
+
+		var res struct {
+			Data []handler.HttpGroupResponse `json:"data"`
+		}
+		gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &res)).Should(gomega.Succeed())
+		parentID := 1
+		gomega.Expect(res.Data).Should(gomega.Equal([]handler.HttpGroupResponse{
+			{GroupID: 2, Name: "Backend", Description: "APIs", ParentID: &parentID},
+			{GroupID: 1, Name: "Engineering"},
+		}))
+	})
+
+	ginkgo.It("should resolve the members and the groups of a user transitively on demand", func() {
+		mockGroups.On("GetGroupMembers", 1, false).Return(&[]model.User{}, nil)
+		mockGroups.On("GetGroupMembers", 1, true).Return(&[]model.User{{UserID: 1, UserName: "johndoe"}}, nil)
+		mockGroups.On("GetUserGroups", 1, true).Return(&[]model.Group{backend, eng}, nil)
+
+		var members struct {
+			Data []handler.HttpUserResponse `json:"data"`
+		}
+		gomega.Expect(json.Unmarshal(request(http.MethodGet, "/api/v1/groups/1/members", "").Body.Bytes(), &members)).Should(gomega.Succeed())
+		gomega.Expect(members.Data).Should(gomega.BeEmpty())
+		gomega.Expect(json.Unmarshal(request(http.MethodGet, "/api/v1/groups/1/members?transitive=true", "").Body.Bytes(), &members)).Should(gomega.Succeed())
+		gomega.Expect(members.Data).Should(gomega.HaveLen(1))
+
+		var groups struct {
+			Data []handler.HttpGroupResponse `json:"data"`
+		}
+		gomega.Expect(json.Unmarshal(request(http.MethodGet, "/api/v1/users/1/groups?transitive=true", "").Body.Bytes(), &groups)).Should(gomega.Succeed())
+		gomega.Expect(groups.Data).Should(gomega.HaveLen(2))
+		gomega.Expect(request(http.MethodGet, "/api/v1/users/42/groups", "").Code).Should(gomega.Equal(http.StatusNotFound))
+	})
+
+	ginkgo.It("should add and remove members in bulk", func() {
+		mockGroups.On("AddGroupMembers", 2, []int{1}).Return(1, nil)
+		mockGroups.On("RemoveGroupMembers", 2, []int{1, 42}).Return(1, nil)
+		mockGroups.On("RemoveGroupMembers", 2, []int{1}).Return(0, nil)
+
+		for _, tc := range []struct {
+			method, path, body string
+			count              float64
+		}{
+			{http.MethodPost, "/api/v1/groups/2/members", `{"user_ids":[1]}`, 1},
+			{http.MethodPost, "/api/v1/groups/2/members/remove", `{"user_ids":[1,42]}`, 1},
+			{http.MethodDelete, "/api/v1/groups/2/members/1", "", 0},
+		} {
+			rec := request(tc.method, tc.path, tc.body)
+
+			var res handler.HttpSuccess
+			gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &res)).Should(gomega.Succeed())
+			gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusOK), tc.path)
+			gomega.Expect(res.Data).Should(gomega.Equal(map[string]interface{}{"count": tc.count}), tc.path)
+		}
+	})
+
+	ginkgo.It("should report unknown groups, bad ids, missing users and duplicate names as problems", func() {
+		mockGroups.On("CreateGroup", testifymock.Anything).Return(-1, fmt.Errorf("%w: duplicate key", repo.ErrDuplicateGroupName))
+
+		for _, tc := range []struct {
+			method, path, body, problemType string
+			status                          int
+		}{
+			{http.MethodGet, "/api/v1/groups/9", "", handler.ProblemGroupNotFound, http.StatusNotFound},
+			{http.MethodGet, "/api/v1/groups/x/members", "", handler.ProblemInvalidGroupID, http.StatusBadRequest},
+			{http.MethodPost, "/api/v1/groups/9/members", `{"user_ids":[1]}`, handler.ProblemGroupNotFound, http.StatusNotFound},
+			{http.MethodPost, "/api/v1/groups/2/members", `{"user_ids":[]}`, handler.ProblemValidationFailed, http.StatusBadRequest},
+			{http.MethodPost, "/api/v1/groups/2/members", `{"user_ids":[1,42]}`, handler.ProblemValidationFailed, http.StatusBadRequest},
+			{http.MethodPost, "/api/v1/groups", `{"name":"Engineering"}`, handler.ProblemGroupAlreadyExists, http.StatusBadRequest},
+			{http.MethodPut, "/api/v1/groups", `{"group_id":1,"name":"Engineering","parent_id":1}`, handler.ProblemValidationFailed, http.StatusBadRequest},
+		} {
+			rec := request(tc.method, tc.path, tc.body)
+
+			var res handler.HttpProblem
+			gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &res)).Should(gomega.Succeed())
+			gomega.Expect(rec.Code).Should(gomega.Equal(tc.status), tc.path)
+			gomega.Expect(res.Type).Should(gomega.Equal(tc.problemType), tc.path)
+		}
+		mockGroups.AssertNotCalled(ginkgo.GinkgoT(), "AddGroupMembers", testifymock.Anything, testifymock.Anything)
+	})
+})
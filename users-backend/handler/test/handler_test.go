@@ -10,6 +10,7 @@ import (
 	"testing"
 	"users-backend/controller"
 	"users-backend/handler"
+	"users-backend/logging"
 	"users-backend/model"
 	"users-backend/repo/mock"
 
@@ -53,7 +54,7 @@ var _ = ginkgo.Describe("User Handler", ginkgo.Ordered, func() {
 
 	ginkgo.BeforeEach(func() {
 		mockRepo = mock.NewUserRepoMock()
-		userController = controller.NewUserController(mockRepo)
+		userController = controller.NewUserController(mockRepo, logging.Discard())
 		e = echo.New()
 		group := e.Group("/user")
 		userHttpHandler = handler.NewUserHttpHandler(group, userController)
@@ -184,6 +185,7 @@ var _ = ginkgo.Describe("User Handler", ginkgo.Ordered, func() {
 			rec := httptest.NewRecorder()
 			ec := e.NewContext(req, rec)
 
+			mockRepo.On("GetById", 1).Return(&mockUserUpdate, nil)
 			mockRepo.On("GetByUsername", "johndoe").Return(&mockUserUpdate, nil)
 			mockRepo.On("Update", &mockUserUpdate).Return(1, nil)
 
@@ -212,6 +214,7 @@ var _ = ginkgo.Describe("User Handler", ginkgo.Ordered, func() {
 			rec := httptest.NewRecorder()
 			ec := e.NewContext(req, rec)
 
+			mockRepo.On("GetById", 1).Return(&mockUserUpdate, nil)
 			mockRepo.On("GetByUsername", "johndoe").Return(&mockUserD, nil)
 			mockRepo.On("Update", &mockUserD).Return(1, nil)
 
@@ -268,6 +271,7 @@ var _ = ginkgo.Describe("User Handler", ginkgo.Ordered, func() {
 			rec := httptest.NewRecorder()
 			ec := e.NewContext(req, rec)
 
+			mockRepo.On("GetById", 1).Return(&mockUserUpdate, nil)
 			mockRepo.On("GetByUsername", "johndoe").Return(&mockUserD, nil)
 
 			userHttpHandler.UpdateUser(ec)
@@ -430,6 +434,8 @@ var _ = ginkgo.Describe("User Handler", ginkgo.Ordered, func() {
 			ec.SetParamNames("user_id")
 			ec.SetParamValues("1")
 
+			mockRepo.On("GetById", 1).Return(&model.User{UserID: 1}, nil)
+			mockRepo.On("ReassignReports", 1, 0).Return(0, nil)
 			mockRepo.On("Delete", 1).Return(nil)
 
 			userHttpHandler.DeleteUser(ec)
@@ -482,7 +488,7 @@ var _ = ginkgo.Describe("User Handler", ginkgo.Ordered, func() {
 			ec.SetParamNames("user_id")
 			ec.SetParamValues("1")
 
-			mockRepo.On("Delete", 1).Return(errors.New("error"))
+			mockRepo.On("GetById", 1).Return(&model.User{}, errors.New("error"))
 
 			userHttpHandler.DeleteUser(ec)
 
@@ -0,0 +1,91 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+	"users-backend/handler"
+	"users-backend/health"
+
+	"github.com/labstack/echo/v4"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Health Handler", func() {
+	var (
+		e      *echo.Echo
+		h      *health.Health
+		dbErr  error
+		report health.Report
+	)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		report = health.Report{}
+		json.Unmarshal(rec.Body.Bytes(), &report)
+		return rec
+	}
+
+	ginkgo.BeforeEach(func() {
+		dbErr = nil
+		h = health.New(50 * time.Millisecond)
+		h.AddReadinessCheck("database", func(ctx context.Context) error { return dbErr })
+
+		e = echo.New()
+		handler.NewHealthHttpHandler(e, h).RegisterRoutes()
+	})
+
+	ginkgo.It("should report live even when a dependency is down", func() {
+		dbErr = errors.New("connection refused")
+
+		rec := get("/healthz")
+
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusOK))
+		gomega.Expect(report.Status).Should(gomega.Equal(health.StatusOK))
+	})
+
+	ginkgo.It("should report ready with the result of every check", func() {
+		rec := get("/readyz")
+
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusOK))
+		gomega.Expect(report.Checks).Should(gomega.HaveKey("database"))
+		gomega.Expect(report.Checks).Should(gomega.HaveKey("shutdown"))
+	})
+
+	ginkgo.It("should return 503 with the failing check", func() {
+		dbErr = errors.New("connection refused")
+
+		rec := get("/readyz")
+
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusServiceUnavailable))
+		gomega.Expect(report.Status).Should(gomega.Equal(health.StatusFail))
+		gomega.Expect(report.Checks["database"].Error).Should(gomega.Equal("connection refused"))
+	})
+
+	ginkgo.It("should fail a check that exceeds the timeout", func() {
+		h.AddReadinessCheck("slow", func(ctx context.Context) error {
+			time.Sleep(time.Second)
+			return nil
+		})
+
+		rec := get("/readyz")
+
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusServiceUnavailable))
+		gomega.Expect(report.Checks["slow"].Status).Should(gomega.Equal(health.StatusFail))
+	})
+
+	ginkgo.It("should stop being ready once shutdown starts", func() {
+		h.Shutdown()
+
+		rec := get("/readyz")
+
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusServiceUnavailable))
+		gomega.Expect(report.Checks["shutdown"].Error).Should(gomega.Equal(health.ErrShuttingDown.Error()))
+	})
+})
@@ -0,0 +1,132 @@
+package test
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+	"users-backend/controller"
+	"users-backend/handler"
+	"users-backend/idempotency"
+	"users-backend/logging"
+	"users-backend/model"
+	"users-backend/repo/mock"
+
+	"github.com/labstack/echo/v4"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Idempotency Middleware", func() {
+	var (
+		mockRepo *mock.UserRepoMock
+		e        *echo.Echo
+		userJSON = `{"user_name": "johndoe", "first_name": "John", "last_name": "Doe", "email": "johndoe@email.com", "user_status": "A", "department": "IT"}`
+	)
+
+	mockUser := model.User{
+		UserName:   "johndoe",
+		FirstName:  "John",
+		LastName:   "Doe",
+		Email:      "johndoe@email.com",
+		UserStatus: "A",
+		Department: sql.NullString{String: "IT", Valid: true},
+	}
+
+	postTo := func(target, body, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if key != "" {
+			req.Header.Set(handler.HeaderIdempotencyKey, key)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	post := func(body, key string) *httptest.ResponseRecorder {
+		return postTo("/user", body, key)
+	}
+
+	ginkgo.BeforeEach(func() {
+		mockRepo = mock.NewUserRepoMock()
+		e = echo.New()
+		group := e.Group("/user", handler.IdempotencyMiddleware(idempotency.NewMemoryStore(), time.Hour, logging.Discard()))
+		handler.NewUserHttpHandler(group, controller.NewUserController(mockRepo, logging.Discard())).RegisterRoutes()
+	})
+
+	ginkgo.It("should replay the original 201 response on a retry", func() {
+		mockRepo.On("GetByUsername", "johndoe").Return(nil, errors.New("error finding user with username")).Once()
+		mockRepo.On("Create", &mockUser).Return(1, nil).Once()
+
+		first := post(userJSON, "import-1")
+		retry := post(userJSON, "import-1")
+
+		var res handler.HttpSuccess
+		json.Unmarshal(retry.Body.Bytes(), &res)
+
+		gomega.Expect(first.Code).Should(gomega.Equal(http.StatusCreated))
+		gomega.Expect(retry.Code).Should(gomega.Equal(http.StatusCreated))
+		gomega.Expect(retry.Body.String()).Should(gomega.Equal(first.Body.String()))
+		gomega.Expect(retry.Header().Get(handler.HeaderIdempotentReplayed)).Should(gomega.Equal("true"))
+		mockRepo.AssertNumberOfCalls(ginkgo.GinkgoT(), "Create", 1)
+	})
+
+	ginkgo.It("should return 422 when the key is reused with a different body", func() {
+		mockRepo.On("GetByUsername", "johndoe").Return(nil, errors.New("error finding user with username")).Once()
+		mockRepo.On("Create", &mockUser).Return(1, nil).Once()
+
+		post(userJSON, "import-2")
+		rec := post(strings.Replace(userJSON, "johndoe", "janedoe", 1), "import-2")
+
+		var res handler.HttpError
+		json.Unmarshal(rec.Body.Bytes(), &res)
+
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusUnprocessableEntity))
+		gomega.Expect(res.Message).Should(gomega.Equal("Idempotency-Key reused"))
+	})
+
+	ginkgo.It("should return 422 when the key is reused with a different query", func() {
+		mockRepo.On("GetById", 1).Return(&model.User{UserID: 1}, nil)
+		mockRepo.On("ReassignReports", 1, 0).Return(0, nil)
+		mockRepo.On("Delete", 1).Return(nil)
+		batch := `{"operations": [{"op": "delete", "user_id": 1}]}`
+
+		first := postTo("/user/batch?atomic=true", batch, "import-4")
+		rec := postTo("/user/batch", batch, "import-4")
+
+		var res handler.HttpError
+		json.Unmarshal(rec.Body.Bytes(), &res)
+
+		gomega.Expect(first.Code).Should(gomega.Equal(http.StatusOK))
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusUnprocessableEntity))
+		gomega.Expect(res.Message).Should(gomega.Equal("Idempotency-Key reused"))
+		mockRepo.AssertNumberOfCalls(ginkgo.GinkgoT(), "Delete", 1)
+	})
+
+	ginkgo.It("should not store server errors so the request can be retried", func() {
+		mockRepo.On("GetByUsername", "johndoe").Return(nil, errors.New("error finding user with username"))
+		mockRepo.On("Create", &mockUser).Return(-1, errors.New("connection reset")).Once()
+		mockRepo.On("Create", &mockUser).Return(1, nil).Once()
+
+		first := post(userJSON, "import-3")
+		retry := post(userJSON, "import-3")
+
+		gomega.Expect(first.Code).Should(gomega.Equal(http.StatusInternalServerError))
+		gomega.Expect(retry.Code).Should(gomega.Equal(http.StatusCreated))
+		gomega.Expect(retry.Header().Get(handler.HeaderIdempotentReplayed)).Should(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should process every request without a key", func() {
+		mockRepo.On("GetByUsername", "johndoe").Return(nil, errors.New("error finding user with username"))
+		mockRepo.On("Create", &mockUser).Return(1, nil)
+
+		post(userJSON, "")
+		post(userJSON, "")
+
+		mockRepo.AssertNumberOfCalls(ginkgo.GinkgoT(), "Create", 2)
+	})
+})
@@ -0,0 +1,168 @@
+package test
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"users-backend/controller"
+	"users-backend/handler"
+	"users-backend/logging"
+	"users-backend/model"
+	"users-backend/repo"
+	"users-backend/repo/mock"
+
+	"github.com/labstack/echo/v4"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	testifymock "github.com/stretchr/testify/mock"
+)
+
+var _ = ginkgo.Describe("Manager Handler", func() {
+	var (
+		mockRepo *mock.UserRepoMock
+		e        *echo.Echo
+	)
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(echo.HeaderAccept, handler.MIMEApplicationProblemJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	managedBy := func(user_id, manager_id int) model.User {
+		return model.User{
+			UserID: user_id, UserName: fmt.Sprintf("user%d", user_id), FirstName: "John", LastName: "Doe", Email: fmt.Sprintf("user%d@email.com", user_id), UserStatus: model.Active,
+			ManagerID: sql.NullInt64{Int64: int64(manager_id), Valid: manager_id != 0},
+		}
+	}
+
+	ginkgo.BeforeEach(func() {
+		mockRepo = mock.NewUserRepoMock()
+		e = echo.New()
+		handler.NewUserHttpHandler(e.Group("/user"), controller.NewUserController(mockRepo, logging.Discard())).RegisterRoutes()
+
+		ceo, vp, dev := managedBy(1, 0), managedBy(2, 1), managedBy(3, 2)
+		mockRepo.On("GetById", 1).Return(&ceo, nil)
+		mockRepo.On("GetById", 2).Return(&vp, nil)
+		mockRepo.On("GetById", 9).Return((*model.User)(nil), fmt.Errorf("%w: no rows", repo.ErrNotFound))
+		mockRepo.On("GetDirectReports", 1).Return(&[]model.User{vp}, nil)
+		mockRepo.On("GetManagementChain", 3).Return(&[]model.User{vp, ceo}, nil)
+		mockRepo.On("GetManagementChain", 2).Return(&[]model.User{ceo}, nil)
+		mockRepo.On("GetSubordinates", 1).Return(&[]model.User{vp, dev}, nil)
+		mockRepo.On("GetById", 3).Return(&dev, nil)
+		mockRepo.On("LockHierarchy").Return(nil)
+	})
+
+	ginkgo.It("should list the reports, the chain and the subtree of a user", func() {
+		for _, tc := range []struct {
+			path string
+			ids  []int
+		}{
+			{"/user/1/reports", []int{2}},
+			{"/user/3/chain", []int{2, 1}},
+			{"/user/1/subtree", []int{2, 3}},
+		} {
+			rec := request(http.MethodGet, tc.path, "")
+
+			var res struct {
+				Data []handler.HttpUserResponse `json:"data"`
+			}
+			gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &res)).Should(gomega.Succeed())
+			gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusOK), tc.path)
+
+			ids := []int{}
+			for _, u := range res.Data {
+				ids = append(ids, u.UserID)
+			}
+			gomega.Expect(ids).Should(gomega.Equal(tc.ids), tc.path)
+		}
+	})
+
+	ginkgo.It("should return the manager of a user", func() {
+		rec := request(http.MethodGet, "/user/3", "")
+
+		var res struct {
+			Data handler.HttpUserResponse `json:"data"`
+		}
+		gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &res)).Should(gomega.Succeed())
+		gomega.Expect(*res.Data.ManagerID).Should(gomega.Equal(2))
+	})
+
+	ginkgo.It("should return 404 for a missing user and 400 for a bad id", func() {
+		gomega.Expect(request(http.MethodGet, "/user/9/subtree", "").Code).Should(gomega.Equal(http.StatusNotFound))
+		gomega.Expect(request(http.MethodGet, "/user/abc/reports", "").Code).Should(gomega.Equal(http.StatusBadRequest))
+	})
+
+	ginkgo.It("should keep the manager when a PUT leaves it out", func() {
+		mockRepo.On("GetByUsername", "user3").Return(nil, fmt.Errorf("%w: no rows", repo.ErrNotFound))
+		mockRepo.On("Update", testifymock.Anything).Return(3, nil)
+
+		rec := request(http.MethodPut, "/user", `{"user_id": 3, "user_name": "user3", "first_name": "John", "last_name": "Doe", "email": "user3@email.com", "user_status": "A"}`)
+
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusOK), rec.Body.String())
+		mockRepo.AssertCalled(ginkgo.GinkgoT(), "Update", testifymock.MatchedBy(func(u *model.User) bool {
+			return u.ManagerID == sql.NullInt64{Int64: 2, Valid: true}
+		}))
+		mockRepo.AssertNotCalled(ginkgo.GinkgoT(), "LockHierarchy")
+	})
+
+	ginkgo.It("should remove the manager when a PUT sends null or 0", func() {
+		mockRepo.On("GetByUsername", "user3").Return(nil, fmt.Errorf("%w: no rows", repo.ErrNotFound))
+		mockRepo.On("Update", testifymock.Anything).Return(3, nil)
+
+		for _, managerID := range []string{"null", "0"} {
+			rec := request(http.MethodPut, "/user", `{"user_id": 3, "user_name": "user3", "first_name": "John", "last_name": "Doe", "email": "user3@email.com", "user_status": "A", "manager_id": `+managerID+`}`)
+
+			gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusOK), managerID)
+		}
+		mockRepo.AssertNumberOfCalls(ginkgo.GinkgoT(), "Update", 2)
+		for _, call := range mockRepo.Calls {
+			if call.Method == "Update" {
+				gomega.Expect(call.Arguments.Get(0).(*model.User).ManagerID.Valid).Should(gomega.BeFalse())
+			}
+		}
+	})
+
+	ginkgo.It("should keep the manager when a patch leaves it out", func() {
+		mockRepo.On("GetByUsername", "user3").Return(nil, fmt.Errorf("%w: no rows", repo.ErrNotFound))
+		mockRepo.On("Update", testifymock.Anything).Return(3, nil)
+
+		rec := request(http.MethodPost, "/user/batch", `{"operations": [{"op": "patch", "user_id": 3, "body": {"first_name": "Jane"}}, {"op": "patch", "user_id": 3, "body": {"manager_id": null}}]}`)
+
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusOK), rec.Body.String())
+		managers := []sql.NullInt64{}
+		for _, call := range mockRepo.Calls {
+			if call.Method == "Update" {
+				managers = append(managers, call.Arguments.Get(0).(*model.User).ManagerID)
+			}
+		}
+		gomega.Expect(managers).Should(gomega.Equal([]sql.NullInt64{{Int64: 2, Valid: true}, {}}))
+	})
+
+	ginkgo.It("should reject a manager that reports to the user", func() {
+		mockRepo.On("GetByUsername", "user1").Return(nil, fmt.Errorf("%w: no rows", repo.ErrNotFound))
+
+		rec := request(http.MethodPost, "/user/batch", `{"operations": [{"op": "patch", "user_id": 1, "body": {"manager_id": 2}}]}`)
+
+		var res struct {
+			Data struct {
+				Results []struct {
+					Status int                 `json:"status"`
+					Body   handler.HttpProblem `json:"body"`
+				} `json:"results"`
+			} `json:"data"`
+		}
+		gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &res)).Should(gomega.Succeed())
+		gomega.Expect(res.Data.Results[0].Status).Should(gomega.Equal(http.StatusBadRequest))
+		gomega.Expect(res.Data.Results[0].Body.Errors).Should(gomega.ConsistOf(
+			handler.HttpFieldError{Field: "manager_id", Rule: "cycle", Message: "must not report to the user"},
+		))
+		mockRepo.AssertNotCalled(ginkgo.GinkgoT(), "Update", testifymock.Anything)
+	})
+})
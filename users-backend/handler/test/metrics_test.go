@@ -0,0 +1,133 @@
+package test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"time"
+	"users-backend/controller"
+	"users-backend/handler"
+	"users-backend/health"
+	"users-backend/idempotency"
+	"users-backend/logging"
+	"users-backend/model"
+	"users-backend/repo"
+	"users-backend/repo/mock"
+
+	"github.com/labstack/echo/v4"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var _ = ginkgo.Describe("Metrics Middleware", func() {
+	const route = "/api/v1/users/:user_id"
+
+	var e *echo.Echo
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// series returns the series of the metric in the default registry, every
+	// router of the suite records to it so specs compare before and after
+	series := func(name string) []*dto.Metric {
+		families, err := prometheus.DefaultGatherer.Gather()
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		for _, f := range families {
+			if f.GetName() == name {
+				return f.GetMetric()
+			}
+		}
+		return nil
+	}
+
+	labels := func(m *dto.Metric) map[string]string {
+		l := map[string]string{}
+		for _, pair := range m.GetLabel() {
+			l[pair.GetName()] = pair.GetValue()
+		}
+		return l
+	}
+
+	// value returns the counter or gauge value, or the histogram sample
+	// count, of the series of name with labels
+	value := func(name string, want map[string]string) float64 {
+		for _, m := range series(name) {
+			if !reflect.DeepEqual(labels(m), want) {
+				continue
+			}
+			switch {
+			case m.GetHistogram() != nil:
+				return float64(m.GetHistogram().GetSampleCount())
+			case m.GetGauge() != nil:
+				return m.GetGauge().GetValue()
+			default:
+				return m.GetCounter().GetValue()
+			}
+		}
+		return 0
+	}
+
+	ginkgo.BeforeEach(func() {
+		mockRepo := mock.NewUserRepoMock()
+		mockRepo.On("GetById", 1).Return(&model.User{UserID: 1, UserName: "johndoe", UserStatus: "A"}, nil)
+		mockRepo.On("GetById", 2).Return((*model.User)(nil), fmt.Errorf("%w: no rows", repo.ErrNotFound))
+
+		e = echo.New()
+		handler.InitRouter(e, controller.NewUserController(mockRepo, logging.Discard()), handler.RouterConfig{
+			Health:           health.New(time.Second),
+			Logger:           logging.Discard(),
+			IdempotencyStore: idempotency.NewMemoryStore(),
+			IdempotencyTTL:   time.Hour,
+		})
+	})
+
+	ginkgo.It("should count requests by route template and status", func() {
+		ok := map[string]string{"method": http.MethodGet, "route": route, "status": "200"}
+		notFound := map[string]string{"method": http.MethodGet, "route": route, "status": "404"}
+		okBefore, notFoundBefore := value("users_http_requests_total", ok), value("users_http_requests_total", notFound)
+
+		gomega.Expect(get("/api/v1/users/1").Code).Should(gomega.Equal(http.StatusOK))
+		gomega.Expect(get("/api/v1/users/1").Code).Should(gomega.Equal(http.StatusOK))
+		gomega.Expect(get("/api/v1/users/2").Code).Should(gomega.Equal(http.StatusNotFound))
+
+		gomega.Expect(value("users_http_requests_total", ok) - okBefore).Should(gomega.Equal(2.0))
+		gomega.Expect(value("users_http_requests_total", notFound) - notFoundBefore).Should(gomega.Equal(1.0))
+		for _, m := range series("users_http_requests_total") {
+			gomega.Expect(labels(m)["route"]).ShouldNot(gomega.MatchRegexp(`^/api/v1/users/\d+$`), "raw paths must not become labels")
+		}
+	})
+
+	ginkgo.It("should observe the latency of each request", func() {
+		key := map[string]string{"method": http.MethodGet, "route": route}
+		before := value("users_http_request_duration_seconds", key)
+
+		get("/api/v1/users/1")
+		get("/api/v1/users/2")
+
+		gomega.Expect(value("users_http_request_duration_seconds", key) - before).Should(gomega.Equal(2.0))
+		gomega.Expect(value("users_http_requests_in_flight", map[string]string{})).Should(gomega.BeZero())
+	})
+
+	ginkgo.It("should expose the metrics on /metrics", func() {
+		get("/api/v1/users/1")
+
+		rec := get("/metrics")
+
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusOK))
+		gomega.Expect(rec.Body.String()).Should(gomega.ContainSubstring(`users_http_requests_total{method="GET",route="/api/v1/users/:user_id",status="200"}`))
+		gomega.Expect(rec.Body.String()).Should(gomega.ContainSubstring(`users_http_request_duration_seconds_bucket{method="GET",route="/api/v1/users/:user_id",le="+Inf"}`))
+
+		problems, err := testutil.GatherAndLint(prometheus.DefaultGatherer,
+			"users_http_requests_total", "users_http_request_duration_seconds", "users_http_requests_in_flight")
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(problems).Should(gomega.BeEmpty())
+	})
+})
@@ -0,0 +1,380 @@
+package test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"users-backend/auth"
+	"users-backend/controller"
+	"users-backend/handler"
+	"users-backend/health"
+	"users-backend/idempotency"
+	"users-backend/logging"
+	"users-backend/model"
+	"users-backend/repo"
+	"users-backend/repo/mock"
+
+	"github.com/labstack/echo/v4"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	testifymock "github.com/stretchr/testify/mock"
+)
+
+var _ = ginkgo.Describe("OpenID Connect", func() {
+	const (
+		password    = "correct horse battery staple"
+		issuer      = "https://users.example.com"
+		verifier    = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+		secret      = "the client secret"
+		redirectURI = "https://app.example.com/callback"
+	)
+
+	var (
+		key             *rsa.PrivateKey
+		e               *echo.Echo
+		mockUsers       *mock.UserRepoMock
+		mockCredentials *mock.CredentialRepoMock
+		mockClients     *mock.ClientRepoMock
+		mockCodes       *mock.AuthorizationCodeRepoMock
+		hasher          = auth.NewArgon2idHasher(auth.Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+		client          *model.OAuthClient
+	)
+
+	send := func(method, target string, form url.Values, header ...string) *httptest.ResponseRecorder {
+		var body *strings.Reader
+		if form != nil {
+			body = strings.NewReader(form.Encode())
+		} else {
+			body = strings.NewReader("")
+		}
+		req := httptest.NewRequest(method, target, body)
+		if form != nil {
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		}
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	authorizeParams := func() url.Values {
+		return url.Values{
+			"response_type":         {"code"},
+			"client_id":             {client.ClientID},
+			"redirect_uri":          {redirectURI},
+			"scope":                 {"openid profile"},
+			"state":                 {"xyz"},
+			"nonce":                 {"n-0S6_WzA2Mj"},
+			"code_challenge":        {auth.PKCEChallenge(verifier)},
+			"code_challenge_method": {"S256"},
+		}
+	}
+
+	// csrfToken matches the token the login page posts back
+	csrfToken := regexp.MustCompile(`name="csrf_token" value="([^"]+)"`)
+
+	// login loads the login page and posts form with its CSRF token and cookie
+	login := func(form url.Values) *httptest.ResponseRecorder {
+		page := send(http.MethodGet, "/oauth2/authorize?"+authorizeParams().Encode(), nil)
+		gomega.Expect(page.Code).Should(gomega.Equal(http.StatusOK))
+		token := csrfToken.FindStringSubmatch(page.Body.String())
+		gomega.Expect(token).Should(gomega.HaveLen(2))
+		cookies := page.Result().Cookies()
+		gomega.Expect(cookies).Should(gomega.HaveLen(1))
+
+		form.Set("csrf_token", token[1])
+		return send(http.MethodPost, "/oauth2/authorize", form, "Cookie", cookies[0].String())
+	}
+
+	// redirected returns the query of the redirect back to the client
+	redirected := func(rec *httptest.ResponseRecorder) url.Values {
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusSeeOther), rec.Body.String())
+		location, err := url.Parse(rec.Header().Get(echo.HeaderLocation))
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(location.Scheme + "://" + location.Host + location.Path).Should(gomega.Equal(redirectURI))
+		return location.Query()
+	}
+
+	oauthError := func(rec *httptest.ResponseRecorder) handler.HttpOAuthError {
+		var res handler.HttpOAuthError
+		gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &res)).Should(gomega.Succeed())
+		return res
+	}
+
+	problem := func(rec *httptest.ResponseRecorder) handler.HttpProblem {
+		var p handler.HttpProblem
+		gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &p)).Should(gomega.Succeed())
+		return p
+	}
+
+	// basicAuth encodes client credentials the way RFC 6749 section 2.3.1 asks
+	basicAuth := func(user, password string) string {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.SetBasicAuth(url.QueryEscape(user), url.QueryEscape(password))
+		return strings.TrimPrefix(req.Header.Get(echo.HeaderAuthorization), "Basic ")
+	}
+
+	admin := []string{echo.HeaderAuthorization, "Bearer admin-token", echo.HeaderContentType, echo.MIMEApplicationJSON, echo.HeaderAccept, handler.MIMEApplicationProblemJSON}
+
+	ginkgo.BeforeEach(func() {
+		if key == nil {
+			var err error
+			key, err = rsa.GenerateKey(rand.Reader, auth.MinRSAKeyBits)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		}
+		signer, err := auth.NewOIDCSigner(key, issuer, time.Hour)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		tokens, err := auth.NewTokenSigner([]byte(strings.Repeat("s", auth.MinSecretLength)), time.Hour)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+		alice := &model.User{UserID: 1, TenantID: 2, UserName: "alice", FirstName: "Alice", LastName: "Liddell", Email: "alice@email.com", UserStatus: model.Active}
+		client = &model.OAuthClient{ClientID: "c0ffee", TenantID: 2, Name: "Wiki", SecretHash: auth.HashOpaqueToken(secret), RedirectURIs: []string{redirectURI}}
+		mockUsers = mock.NewUserRepoMock()
+		mockCredentials = mock.NewCredentialRepoMock()
+		mockClients = mock.NewClientRepoMock()
+		mockCodes = mock.NewAuthorizationCodeRepoMock()
+		mockTenants := mock.NewTenantRepoMock()
+		mockUsers.On("GetByUsername", "alice").Return(alice, nil)
+		mockUsers.On("GetById", 1).Return(alice, nil)
+		mockClients.On("FindClient", client.ClientID).Return(client, nil)
+		mockClients.On("FindClient", testifymock.Anything).Return(nil, fmt.Errorf("%w: no rows", repo.ErrClientNotFound))
+		mockClients.On("GetClient", client.ClientID).Return(client, nil)
+		mockTenants.On("GetTenant", 2).Return(&model.Tenant{TenantID: 2, Slug: "acme"}, nil)
+		mockTenants.On("GetTenantBySlug", "acme").Return(&model.Tenant{TenantID: 2, Slug: "acme"}, nil)
+
+		hash, err := hasher.Hash(password)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		mockCredentials.On("GetCredential", 1).Return(&model.Credential{UserID: 1, TenantID: 2, PasswordHash: hash}, nil)
+
+		authController := controller.NewAuthController(mockUsers, mockCredentials, tokens, logging.Discard(),
+			controller.WithHasher(hasher), controller.WithOIDC(mockClients, mockCodes, signer))
+
+		e = echo.New()
+		handler.InitRouter(e, controller.NewUserController(mockUsers, logging.Discard()), handler.RouterConfig{
+			Health:           health.New(time.Second),
+			Logger:           logging.Discard(),
+			IdempotencyStore: idempotency.NewMemoryStore(),
+			IdempotencyTTL:   time.Hour,
+			Tenant: &handler.TenantConfig{
+				Controller: controller.NewTenantController(mockTenants, logging.Discard()),
+				Default:    "acme",
+				AdminToken: "admin-token",
+			},
+			Auth: authController,
+			OIDC: authController,
+		})
+	})
+
+	ginkgo.It("should publish the discovery document and the keys", func() {
+		rec := send(http.MethodGet, "/.well-known/openid-configuration", nil)
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusOK))
+		var config handler.HttpOIDCConfiguration
+		gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &config)).Should(gomega.Succeed())
+		gomega.Expect(config.Issuer).Should(gomega.Equal(issuer))
+		gomega.Expect(config.AuthorizationEndpoint).Should(gomega.Equal(issuer + "/oauth2/authorize"))
+		gomega.Expect(config.TokenEndpoint).Should(gomega.Equal(issuer + "/oauth2/token"))
+		gomega.Expect(config.CodeChallengeMethodsSupported).Should(gomega.Equal([]string{"S256"}))
+
+		rec = send(http.MethodGet, "/oauth2/jwks", nil)
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusOK))
+		var keys auth.JWKSet
+		gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &keys)).Should(gomega.Succeed())
+		gomega.Expect(keys.Keys).Should(gomega.HaveLen(1))
+		gomega.Expect(keys.Keys[0].Algorithm).Should(gomega.Equal("RS256"))
+	})
+
+	ginkgo.It("should log the user in and exchange the code for tokens", func() {
+		rec := send(http.MethodGet, "/oauth2/authorize?"+authorizeParams().Encode(), nil)
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusOK))
+		gomega.Expect(rec.Header().Get(echo.HeaderContentType)).Should(gomega.HavePrefix(echo.MIMETextHTML))
+		gomega.Expect(rec.Header().Get(echo.HeaderXFrameOptions)).Should(gomega.Equal("DENY"))
+		gomega.Expect(rec.Header().Get(echo.HeaderContentSecurityPolicy)).Should(gomega.ContainSubstring("frame-ancestors 'none'"))
+		gomega.Expect(rec.Body.String()).Should(gomega.ContainSubstring("Log in to Wiki"))
+		gomega.Expect(rec.Body.String()).Should(gomega.ContainSubstring(`name="client_id" value="c0ffee"`))
+
+		var stored *model.AuthorizationCode
+		mockCodes.On("CreateAuthorizationCode", testifymock.Anything).Run(func(args testifymock.Arguments) {
+			stored = args.Get(0).(*model.AuthorizationCode)
+		}).Return(nil)
+		form := authorizeParams()
+		form.Set("username", "alice")
+		form.Set("password", password)
+		query := redirected(login(form))
+		gomega.Expect(query.Get("state")).Should(gomega.Equal("xyz"))
+		gomega.Expect(query.Get("iss")).Should(gomega.Equal(issuer))
+		gomega.Expect(stored.CodeHash).Should(gomega.Equal(auth.HashOpaqueToken(query.Get("code"))))
+
+		mockCodes.On("ConsumeAuthorizationCode", stored.CodeHash).Return(stored, nil)
+		rec = send(http.MethodPost, "/oauth2/token", url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {query.Get("code")},
+			"redirect_uri":  {redirectURI},
+			"code_verifier": {verifier},
+		}, echo.HeaderAuthorization, "Basic "+basicAuth(client.ClientID, secret))
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusOK), rec.Body.String())
+		gomega.Expect(rec.Header().Get(echo.HeaderCacheControl)).Should(gomega.Equal("no-store"))
+		var tokens handler.HttpTokenResponse
+		gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &tokens)).Should(gomega.Succeed())
+		gomega.Expect(tokens.TokenType).Should(gomega.Equal("Bearer"))
+		gomega.Expect(tokens.IDToken).ShouldNot(gomega.BeEmpty())
+		gomega.Expect(tokens.Scope).Should(gomega.Equal("openid profile"))
+
+		rec = send(http.MethodGet, "/oauth2/userinfo", nil, echo.HeaderAuthorization, "Bearer "+tokens.AccessToken)
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusOK))
+		var info map[string]interface{}
+		gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &info)).Should(gomega.Succeed())
+		gomega.Expect(info).Should(gomega.Equal(map[string]interface{}{
+			"sub": "1", "name": "Alice Liddell", "given_name": "Alice", "family_name": "Liddell",
+			"preferred_username": "alice", "user_status": "A",
+		}))
+	})
+
+	ginkgo.It("should only redirect errors to registered redirect URIs", func() {
+		params := authorizeParams()
+		params.Set("client_id", "unknown")
+		rec := send(http.MethodGet, "/oauth2/authorize?"+params.Encode(), nil)
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusBadRequest))
+		gomega.Expect(rec.Body.String()).Should(gomega.ContainSubstring("The application is unknown"))
+
+		params = authorizeParams()
+		params.Set("redirect_uri", "https://evil.example.com/callback")
+		rec = send(http.MethodGet, "/oauth2/authorize?"+params.Encode(), nil)
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusBadRequest))
+		gomega.Expect(rec.Header().Get(echo.HeaderLocation)).Should(gomega.BeEmpty())
+
+		params = authorizeParams()
+		params.Del("code_challenge")
+		query := redirected(send(http.MethodGet, "/oauth2/authorize?"+params.Encode(), nil))
+		gomega.Expect(query.Get("error")).Should(gomega.Equal(controller.OAuthInvalidRequest))
+		gomega.Expect(query.Get("state")).Should(gomega.Equal("xyz"))
+	})
+
+	ginkgo.It("should show the login page again for a wrong password", func() {
+		mockCredentials.On("RecordLoginFailure", 1).Return(1, nil)
+		form := authorizeParams()
+		form.Set("username", "alice")
+		form.Set("password", "wrong")
+
+		rec := login(form)
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusOK))
+		gomega.Expect(rec.Body.String()).Should(gomega.ContainSubstring("The user name or password is wrong"))
+		gomega.Expect(rec.Body.String()).Should(gomega.ContainSubstring(`value="alice"`))
+		mockCodes.AssertNotCalled(ginkgo.GinkgoT(), "CreateAuthorizationCode", testifymock.Anything)
+	})
+
+	ginkgo.It("should refuse credentials posted without the token of the login page", func() {
+		page := send(http.MethodGet, "/oauth2/authorize?"+authorizeParams().Encode(), nil)
+		cookie := page.Result().Cookies()[0]
+		gomega.Expect(cookie.Name).Should(gomega.Equal("oauth_csrf"))
+		gomega.Expect(cookie.HttpOnly).Should(gomega.BeTrue())
+		gomega.Expect(cookie.Secure).Should(gomega.BeTrue())
+		gomega.Expect(cookie.SameSite).Should(gomega.Equal(http.SameSiteStrictMode))
+
+		form := authorizeParams()
+		form.Set("username", "alice")
+		form.Set("password", password)
+		rec := send(http.MethodPost, "/oauth2/authorize", form)
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusForbidden))
+		gomega.Expect(rec.Body.String()).Should(gomega.ContainSubstring("The login form expired"))
+
+		form.Set("csrf_token", csrfToken.FindStringSubmatch(page.Body.String())[1])
+		rec = send(http.MethodPost, "/oauth2/authorize", form)
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusForbidden))
+
+		rec = send(http.MethodPost, "/oauth2/authorize", form, "Cookie", "oauth_csrf=another-token")
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusForbidden))
+		mockCredentials.AssertNotCalled(ginkgo.GinkgoT(), "GetCredential", testifymock.Anything)
+		mockCodes.AssertNotCalled(ginkgo.GinkgoT(), "CreateAuthorizationCode", testifymock.Anything)
+	})
+
+	ginkgo.It("should report unexpected token errors as an OAuth server error", func() {
+		mockCodes.On("ConsumeAuthorizationCode", auth.HashOpaqueToken("code")).Return(nil, errors.New("connection reset by peer"))
+
+		rec := send(http.MethodPost, "/oauth2/token", url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {"code"},
+			"redirect_uri":  {redirectURI},
+			"code_verifier": {verifier},
+		}, echo.HeaderAuthorization, "Basic "+basicAuth(client.ClientID, secret))
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusInternalServerError))
+		gomega.Expect(rec.Header().Get(echo.HeaderContentType)).Should(gomega.HavePrefix(echo.MIMEApplicationJSON))
+		gomega.Expect(oauthError(rec).Error).Should(gomega.Equal(controller.OAuthServerError))
+		gomega.Expect(rec.Body.String()).ShouldNot(gomega.ContainSubstring("connection reset"))
+	})
+
+	ginkgo.It("should refuse unauthenticated clients and tokens", func() {
+		rec := send(http.MethodPost, "/oauth2/token", url.Values{"grant_type": {"authorization_code"}, "client_id": {"unknown"}})
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusUnauthorized))
+		gomega.Expect(oauthError(rec).Error).Should(gomega.Equal(controller.OAuthInvalidClient))
+
+		rec = send(http.MethodPost, "/oauth2/token", url.Values{"grant_type": {"authorization_code"}, "code": {"code"}},
+			echo.HeaderAuthorization, "Basic "+basicAuth(client.ClientID, "wrong"))
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusUnauthorized))
+		gomega.Expect(rec.Header().Get(echo.HeaderWWWAuthenticate)).Should(gomega.HavePrefix("Basic"))
+		gomega.Expect(oauthError(rec).Error).Should(gomega.Equal(controller.OAuthInvalidClient))
+
+		rec = send(http.MethodPost, "/oauth2/token", url.Values{"grant_type": {"authorization_code"}, "client_id": {client.ClientID}, "client_secret": {secret}})
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusBadRequest))
+		gomega.Expect(oauthError(rec).Error).Should(gomega.Equal(controller.OAuthInvalidRequest))
+
+		rec = send(http.MethodGet, "/oauth2/userinfo", nil)
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusUnauthorized))
+		gomega.Expect(rec.Header().Get(echo.HeaderWWWAuthenticate)).Should(gomega.Equal("Bearer"))
+
+		rec = send(http.MethodGet, "/oauth2/userinfo", nil, echo.HeaderAuthorization, "Bearer not-a-token")
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusUnauthorized))
+		gomega.Expect(rec.Header().Get(echo.HeaderWWWAuthenticate)).Should(gomega.Equal(`Bearer error="invalid_token"`))
+	})
+
+	ginkgo.Describe("clients", func() {
+		ginkgo.It("should return the secret of a new client once", func() {
+			mockClients.On("CreateClient", testifymock.Anything).Return(nil)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/tenants/2/oauth-clients", strings.NewReader(`{"name":"Wiki","redirect_uris":["https://wiki.example.com/cb"]}`))
+			for i := 0; i+1 < len(admin); i += 2 {
+				req.Header.Set(admin[i], admin[i+1])
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusCreated), rec.Body.String())
+
+			var res struct {
+				Data handler.HttpClientResponse `json:"data"`
+			}
+			gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &res)).Should(gomega.Succeed())
+			gomega.Expect(res.Data.ClientSecret).ShouldNot(gomega.BeEmpty())
+			gomega.Expect(res.Data.Public).Should(gomega.BeFalse())
+			created := mockClients.Calls[len(mockClients.Calls)-1].Arguments.Get(0).(*model.OAuthClient)
+			gomega.Expect(created.SecretHash).Should(gomega.Equal(auth.HashOpaqueToken(res.Data.ClientSecret)))
+
+			rec = send(http.MethodGet, "/api/v1/tenants/2/oauth-clients/"+client.ClientID, nil, admin...)
+			gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusOK))
+			gomega.Expect(rec.Body.String()).ShouldNot(gomega.ContainSubstring("client_secret"))
+		})
+
+		ginkgo.It("should map the client errors", func() {
+			rec := send(http.MethodGet, "/api/v1/tenants/2/oauth-clients", nil)
+			gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusUnauthorized))
+
+			mockClients.On("GetClient", "unknown").Return(nil, fmt.Errorf("%w: no rows", repo.ErrClientNotFound))
+			rec = send(http.MethodGet, "/api/v1/tenants/2/oauth-clients/unknown", nil, admin...)
+			gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusNotFound))
+			gomega.Expect(problem(rec).Type).Should(gomega.Equal(handler.ProblemClientNotFound))
+
+			mockClients.On("GetClient", "public").Return(&model.OAuthClient{ClientID: "public", TenantID: 2}, nil)
+			rec = send(http.MethodPost, "/api/v1/tenants/2/oauth-clients/public/secret", nil, admin...)
+			gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusConflict))
+			gomega.Expect(problem(rec).Type).Should(gomega.Equal(handler.ProblemPublicClient))
+		})
+	})
+})
@@ -0,0 +1,114 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"users-backend/controller"
+	"users-backend/handler"
+	"users-backend/logging"
+	"users-backend/model"
+	"users-backend/repo/mock"
+
+	"github.com/labstack/echo/v4"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Problem Details", func() {
+	var (
+		mockRepo *mock.UserRepoMock
+		e        *echo.Echo
+	)
+
+	send := func(method, target, body, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if accept != "" {
+			req.Header.Set(echo.HeaderAccept, accept)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	ginkgo.BeforeEach(func() {
+		mockRepo = mock.NewUserRepoMock()
+		e = echo.New()
+		handler.NewUserHttpHandler(e.Group("/user"), controller.NewUserController(mockRepo, logging.Discard())).RegisterRoutes()
+	})
+
+	ginkgo.It("should keep the legacy envelope by default", func() {
+		rec := send(http.MethodPost, "/user", `{"user_name": "johndoe"}`, "")
+
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusBadRequest))
+		gomega.Expect(rec.Header().Get(echo.HeaderContentType)).Should(gomega.HavePrefix(echo.MIMEApplicationJSON))
+
+		var res handler.HttpError
+		json.Unmarshal(rec.Body.Bytes(), &res)
+		gomega.Expect(res.Message).Should(gomega.Equal("Invalid body"))
+		gomega.Expect(res.Details).Should(gomega.ContainSubstring("HttpUserPost"))
+	})
+
+	ginkgo.It("should report each invalid field by its json name", func() {
+		rec := send(http.MethodPost, "/user", `{"user_name": "johndoe", "first_name": "John", "email": "not-an-email", "user_status": "A"}`, handler.MIMEApplicationProblemJSON)
+
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusBadRequest))
+		gomega.Expect(rec.Header().Get(echo.HeaderContentType)).Should(gomega.Equal(handler.MIMEApplicationProblemJSON))
+
+		var res handler.HttpProblem
+		json.Unmarshal(rec.Body.Bytes(), &res)
+		gomega.Expect(res.Type).Should(gomega.Equal(handler.ProblemValidationFailed))
+		gomega.Expect(res.Status).Should(gomega.Equal(http.StatusBadRequest))
+		gomega.Expect(res.Instance).Should(gomega.Equal("/user"))
+		gomega.Expect(res.Errors).Should(gomega.ConsistOf(
+			handler.HttpFieldError{Field: "last_name", Rule: "required", Message: "is required"},
+			handler.HttpFieldError{Field: "email", Rule: "email", Message: "must be a valid email address"},
+		))
+	})
+
+	ginkgo.It("should point a taken username at the user_name field", func() {
+		mockRepo.On("GetByUsername", "johndoe").Return(&model.User{UserID: 1, UserName: "johndoe"}, nil)
+
+		rec := send(http.MethodPost, "/user", `{"user_name": "johndoe", "first_name": "John", "last_name": "Doe", "email": "johndoe@email.com", "user_status": "A"}`, handler.MIMEApplicationProblemJSON)
+
+		var res handler.HttpProblem
+		json.Unmarshal(rec.Body.Bytes(), &res)
+		gomega.Expect(res.Type).Should(gomega.Equal(handler.ProblemUserAlreadyExists))
+		gomega.Expect(res.Errors).Should(gomega.Equal([]handler.HttpFieldError{{Field: "user_name", Rule: "unique", Message: "is already taken"}}))
+	})
+
+	ginkgo.It("should report the controller validation rules per field", func() {
+		rec := send(http.MethodPost, "/user", `{"user_name": "john doe", "first_name": "John", "last_name": "Doe", "email": "johndoe@email.com", "user_status": "A"}`, handler.MIMEApplicationProblemJSON)
+
+		var res handler.HttpProblem
+		json.Unmarshal(rec.Body.Bytes(), &res)
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusBadRequest))
+		gomega.Expect(res.Type).Should(gomega.Equal(handler.ProblemValidationFailed))
+		gomega.Expect(res.Errors).Should(gomega.HaveLen(1))
+		gomega.Expect(res.Errors[0].Field).Should(gomega.Equal("user_name"))
+		gomega.Expect(res.Errors[0].Rule).Should(gomega.Equal("pattern"))
+	})
+
+	ginkgo.It("should use a stable type for errors without field details", func() {
+		rec := send(http.MethodGet, "/user/abc", "", handler.MIMEApplicationProblemJSON)
+
+		var res handler.HttpProblem
+		json.Unmarshal(rec.Body.Bytes(), &res)
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusBadRequest))
+		gomega.Expect(res.Type).Should(gomega.Equal(handler.ProblemInvalidUserID))
+		gomega.Expect(res.Title).Should(gomega.Equal("Invalid user_id"))
+		gomega.Expect(res.Errors).Should(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should report batch operation paths from the request root", func() {
+		rec := send(http.MethodPost, "/user/batch", `{"operations": [{"op": "rename"}]}`, handler.MIMEApplicationProblemJSON)
+
+		var res handler.HttpProblem
+		json.Unmarshal(rec.Body.Bytes(), &res)
+		gomega.Expect(res.Errors).Should(gomega.Equal([]handler.HttpFieldError{
+			{Field: "operations[0].op", Rule: "oneof", Message: "must be one of: create, update, patch, delete"},
+		}))
+	})
+})
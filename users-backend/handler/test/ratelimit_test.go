@@ -0,0 +1,278 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+	"users-backend/auth"
+	"users-backend/controller"
+	"users-backend/handler"
+	"users-backend/health"
+	"users-backend/idempotency"
+	"users-backend/logging"
+	"users-backend/model"
+	"users-backend/ratelimit"
+	"users-backend/repo/mock"
+
+	"github.com/labstack/echo/v4"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Rate Limit Middleware", func() {
+	var (
+		e   *echo.Echo
+		now time.Time
+		cfg handler.RateLimitConfig
+	)
+
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+
+	request := func(method, path, remoteAddr string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = remoteAddr
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	ginkgo.BeforeEach(func() {
+		now = time.Unix(1700000000, 0)
+		rules, err := ratelimit.ParseRules("GET /api/v1/users=2/m; POST *=1/s:3")
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		cfg = handler.RateLimitConfig{
+			Store: ratelimit.NewMemoryStoreWithClock(func() time.Time { return now }),
+			Rules: rules,
+		}
+	})
+
+	setup := func() {
+		e = echo.New()
+		e.IPExtractor = echo.ExtractIPDirect()
+		api := e.Group("/api/v1", handler.RateLimitMiddleware(cfg, logging.Discard()))
+		api.GET("/users", ok)
+		api.POST("/users", ok)
+		api.GET("/users/:user_id", ok)
+	}
+
+	ginkgo.It("should reject a client over the limit with 429 and Retry-After", func() {
+		setup()
+
+		rec := request(http.MethodGet, "/api/v1/users", "10.0.0.1:1234")
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusOK))
+		gomega.Expect(rec.Header().Get(handler.HeaderRateLimitLimit)).Should(gomega.Equal("2"))
+		gomega.Expect(rec.Header().Get(handler.HeaderRateLimitRemaining)).Should(gomega.Equal("1"))
+		gomega.Expect(rec.Header().Get(handler.HeaderRateLimitReset)).Should(gomega.Equal("30"))
+		gomega.Expect(rec.Header().Get(handler.HeaderRateLimitPolicy)).Should(gomega.Equal("2;w=60"))
+
+		request(http.MethodGet, "/api/v1/users", "10.0.0.1:1234")
+		rec = request(http.MethodGet, "/api/v1/users", "10.0.0.1:1234")
+
+		var res handler.HttpError
+		gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &res)).Should(gomega.Succeed())
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusTooManyRequests))
+		gomega.Expect(res.Message).Should(gomega.Equal("Too many requests"))
+		gomega.Expect(rec.Header().Get(handler.HeaderRetryAfter)).Should(gomega.Equal("30"))
+		gomega.Expect(rec.Header().Get(handler.HeaderRateLimitRemaining)).Should(gomega.Equal("0"))
+	})
+
+	ginkgo.It("should refill the bucket over time", func() {
+		setup()
+		request(http.MethodGet, "/api/v1/users", "10.0.0.1:1234")
+		request(http.MethodGet, "/api/v1/users", "10.0.0.1:1234")
+
+		now = now.Add(30 * time.Second)
+
+		gomega.Expect(request(http.MethodGet, "/api/v1/users", "10.0.0.1:1234").Code).Should(gomega.Equal(http.StatusOK))
+		gomega.Expect(request(http.MethodGet, "/api/v1/users", "10.0.0.1:1234").Code).Should(gomega.Equal(http.StatusTooManyRequests))
+	})
+
+	ginkgo.It("should keep a bucket per client and rule", func() {
+		setup()
+		request(http.MethodGet, "/api/v1/users", "10.0.0.1:1234")
+		request(http.MethodGet, "/api/v1/users", "10.0.0.1:1234")
+
+		gomega.Expect(request(http.MethodGet, "/api/v1/users", "10.0.0.2:1234").Code).Should(gomega.Equal(http.StatusOK))
+		gomega.Expect(request(http.MethodPost, "/api/v1/users", "10.0.0.1:1234").Code).Should(gomega.Equal(http.StatusOK))
+
+		// No rule matches GET /api/v1/users/:user_id
+		rec := request(http.MethodGet, "/api/v1/users/1", "10.0.0.1:1234")
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusOK))
+		gomega.Expect(rec.Header().Get(handler.HeaderRateLimitLimit)).Should(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should not trust X-Forwarded-For from the client", func() {
+		setup()
+		request(http.MethodGet, "/api/v1/users", "10.0.0.1:1234", echo.HeaderXForwardedFor, "1.1.1.1")
+		request(http.MethodGet, "/api/v1/users", "10.0.0.1:1234", echo.HeaderXForwardedFor, "2.2.2.2")
+
+		rec := request(http.MethodGet, "/api/v1/users", "10.0.0.1:1234", echo.HeaderXForwardedFor, "3.3.3.3")
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusTooManyRequests))
+	})
+
+	ginkgo.It("should key the bucket by API key when configured", func() {
+		cfg.APIKeyHeader = "X-API-Key"
+		cfg.APIKeys = []string{"first", "second"}
+		setup()
+		request(http.MethodGet, "/api/v1/users", "10.0.0.1:1234", "X-API-Key", "first")
+		request(http.MethodGet, "/api/v1/users", "10.0.0.1:1234", "X-API-Key", "first")
+
+		gomega.Expect(request(http.MethodGet, "/api/v1/users", "10.0.0.1:1234", "X-API-Key", "first").Code).Should(gomega.Equal(http.StatusTooManyRequests))
+		gomega.Expect(request(http.MethodGet, "/api/v1/users", "10.0.0.1:1234", "X-API-Key", "second").Code).Should(gomega.Equal(http.StatusOK))
+	})
+
+	ginkgo.It("should not reset the bucket for unknown API keys", func() {
+		cfg.APIKeyHeader = "X-API-Key"
+		cfg.APIKeys = []string{"first"}
+		setup()
+		request(http.MethodGet, "/api/v1/users", "10.0.0.1:1234", "X-API-Key", "random-1")
+		request(http.MethodGet, "/api/v1/users", "10.0.0.1:1234", "X-API-Key", "random-2")
+
+		gomega.Expect(request(http.MethodGet, "/api/v1/users", "10.0.0.1:1234", "X-API-Key", "random-3").Code).Should(gomega.Equal(http.StatusTooManyRequests))
+		gomega.Expect(request(http.MethodGet, "/api/v1/users", "10.0.0.1:1234", "X-API-Key", "first").Code).Should(gomega.Equal(http.StatusOK))
+	})
+
+	ginkgo.It("should key the bucket by the user of a valid login token", func() {
+		tokens, err := auth.NewTokenSigner([]byte(strings.Repeat("s", auth.MinSecretLength)), time.Hour)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		cfg.Auth = controller.NewAuthController(mock.NewUserRepoMock(), mock.NewCredentialRepoMock(), tokens, logging.Discard())
+		setup()
+
+		bearer := func(user_id int) string {
+			signed, err := tokens.Sign(user_id, model.DefaultTenantID, "alice", time.Now())
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			return "Bearer " + signed.Value
+		}
+
+		request(http.MethodGet, "/api/v1/users", "10.0.0.1:1234", echo.HeaderAuthorization, bearer(1))
+		request(http.MethodGet, "/api/v1/users", "10.0.0.2:1234", echo.HeaderAuthorization, bearer(1))
+
+		gomega.Expect(request(http.MethodGet, "/api/v1/users", "10.0.0.3:1234", echo.HeaderAuthorization, bearer(1)).Code).Should(gomega.Equal(http.StatusTooManyRequests))
+		gomega.Expect(request(http.MethodGet, "/api/v1/users", "10.0.0.1:1234", echo.HeaderAuthorization, bearer(2)).Code).Should(gomega.Equal(http.StatusOK))
+
+		// Forged tokens fall back to the IP address
+		request(http.MethodGet, "/api/v1/users", "10.0.0.4:1234", echo.HeaderAuthorization, "Bearer forged-1")
+		request(http.MethodGet, "/api/v1/users", "10.0.0.4:1234", echo.HeaderAuthorization, "Bearer forged-2")
+		gomega.Expect(request(http.MethodGet, "/api/v1/users", "10.0.0.4:1234", echo.HeaderAuthorization, "Bearer forged-3").Code).Should(gomega.Equal(http.StatusTooManyRequests))
+	})
+
+	ginkgo.It("should limit GraphQL requests", func() {
+		rules, err := ratelimit.ParseRules("POST /graphql=1/m")
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		cfg.Rules = rules
+
+		e = echo.New()
+		handler.InitRouter(e, controller.NewUserController(mock.NewUserRepoMock(), logging.Discard()), handler.RouterConfig{
+			Health:           health.New(time.Second),
+			Logger:           logging.Discard(),
+			IdempotencyStore: idempotency.NewMemoryStore(),
+			IdempotencyTTL:   time.Hour,
+			RateLimit:        &cfg,
+		})
+
+		graphql := func() *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(`{"query": "{ __typename }"}`))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			req.RemoteAddr = "10.0.0.1:1234"
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			return rec
+		}
+
+		gomega.Expect(graphql().Code).Should(gomega.Equal(http.StatusOK))
+		gomega.Expect(graphql().Code).Should(gomega.Equal(http.StatusTooManyRequests))
+	})
+
+	ginkgo.It("should report rate limiting as a problem type", func() {
+		setup()
+		request(http.MethodGet, "/api/v1/users", "10.0.0.1:1234")
+		request(http.MethodGet, "/api/v1/users", "10.0.0.1:1234")
+
+		rec := request(http.MethodGet, "/api/v1/users", "10.0.0.1:1234", echo.HeaderAccept, handler.MIMEApplicationProblemJSON)
+
+		var problem handler.HttpProblem
+		gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &problem)).Should(gomega.Succeed())
+		gomega.Expect(problem.Type).Should(gomega.Equal(handler.ProblemRateLimited))
+		gomega.Expect(problem.Status).Should(gomega.Equal(http.StatusTooManyRequests))
+	})
+
+	ginkgo.It("should let requests through when the store fails", func() {
+		cfg.Store = failingStore{}
+		setup()
+
+		gomega.Expect(request(http.MethodGet, "/api/v1/users", "10.0.0.1:1234").Code).Should(gomega.Equal(http.StatusOK))
+	})
+
+	ginkgo.Describe("ParseRules", func() {
+		ginkgo.It("should default the method and burst", func() {
+			rules, err := ratelimit.ParseRules("/api/v1/users=10/s")
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(rules).Should(gomega.Equal([]ratelimit.Rule{
+				{Method: "*", Path: "/api/v1/users", Limit: ratelimit.Limit{Rate: 10, Burst: 10}, Policy: "10;w=1"},
+			}))
+		})
+
+		ginkgo.It("should reject malformed rules", func() {
+			for _, s := range []string{"/api/v1/users", "/api/v1/users=10", "/api/v1/users=10/d", "/api/v1/users=0/s", "GET /a /b=1/s", "*=1/s:x"} {
+				_, err := ratelimit.ParseRules(s)
+				gomega.Expect(errors.Is(err, ratelimit.ErrInvalidRule)).Should(gomega.BeTrue(), s)
+			}
+		})
+	})
+})
+
+var _ = ginkgo.Describe("Body Limit Middleware", func() {
+	var e *echo.Echo
+
+	ginkgo.BeforeEach(func() {
+		e = echo.New()
+		e.Use(handler.BodyLimitMiddleware(16))
+		e.POST("/echo", func(c echo.Context) error {
+			body, err := io.ReadAll(c.Request().Body)
+			if err != nil {
+				return err
+			}
+			return c.String(http.StatusOK, string(body))
+		})
+	})
+
+	post := func(body io.Reader, contentLength int64) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/echo", body)
+		req.ContentLength = contentLength
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	ginkgo.It("should pass bodies within the limit", func() {
+		rec := post(strings.NewReader(`{"a":1}`), 7)
+
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusOK))
+		gomega.Expect(rec.Body.String()).Should(gomega.Equal(`{"a":1}`))
+	})
+
+	ginkgo.It("should reject a declared or streamed body over the limit", func() {
+		for _, contentLength := range []int64{32, -1} {
+			rec := post(strings.NewReader(strings.Repeat("a", 32)), contentLength)
+
+			var res handler.HttpError
+			gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &res)).Should(gomega.Succeed())
+			gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusRequestEntityTooLarge))
+			gomega.Expect(res.Message).Should(gomega.Equal("Request body too large"))
+		}
+	})
+})
+
+type failingStore struct{}
+
+func (failingStore) Take(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("store down")
+}
@@ -0,0 +1,124 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing/fstest"
+	"time"
+	"users-backend/controller"
+	"users-backend/handler"
+	"users-backend/health"
+	"users-backend/idempotency"
+	"users-backend/logging"
+	"users-backend/repo/mock"
+
+	"github.com/labstack/echo/v4"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("SPA Handler", func() {
+	var e *echo.Echo
+
+	files := fstest.MapFS{
+		"index.html":           {Data: []byte("<html><head><title>Users</title></head><body><app-root></app-root></body></html>")},
+		"main-QH7UQXJN.js":     {Data: []byte("console.log('main')")},
+		"styles-5INURTSO.css":  {Data: []byte("body {}")},
+		"favicon.ico":          {Data: []byte("icon")},
+		"media/logo.svg":       {Data: []byte("<svg></svg>")},
+		".env":                 {Data: []byte("SECRET=1")},
+		"assets/.hidden/a.txt": {Data: []byte("hidden")},
+	}
+
+	request := func(method, path string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	ginkgo.BeforeEach(func() {
+		e = echo.New()
+		handler.InitRouter(e, controller.NewUserController(mock.NewUserRepoMock(), logging.Discard()), handler.RouterConfig{
+			Health:           health.New(time.Second),
+			Logger:           logging.Discard(),
+			IdempotencyStore: idempotency.NewMemoryStore(),
+			IdempotencyTTL:   time.Hour,
+			AllowOrigins:     []string{"https://users.example.com"},
+			SPA: &handler.SPAConfig{
+				FS:            files,
+				RuntimeConfig: map[string]string{"apiBaseUrl": "https://api.example.com"},
+			},
+		})
+	})
+
+	ginkgo.It("should serve index.html with the runtime config", func() {
+		rec := request(http.MethodGet, "/")
+
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusOK))
+		gomega.Expect(rec.Header().Get(echo.HeaderContentType)).Should(gomega.HavePrefix("text/html"))
+		gomega.Expect(rec.Header().Get(echo.HeaderCacheControl)).Should(gomega.Equal("no-cache"))
+		gomega.Expect(rec.Body.String()).Should(gomega.ContainSubstring(
+			`<script>window.__USERS_CONFIG__ = {"apiBaseUrl":"https://api.example.com"};</script>` + "\n</head>"))
+	})
+
+	ginkgo.It("should fall back to index.html for client side routes", func() {
+		for _, path := range []string{"/users", "/users/42/edit", "/media"} {
+			rec := request(http.MethodGet, path)
+
+			gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusOK), path)
+			gomega.Expect(rec.Body.String()).Should(gomega.ContainSubstring("<app-root>"), path)
+		}
+	})
+
+	ginkgo.It("should cache hashed assets forever and revalidate the others", func() {
+		rec := request(http.MethodGet, "/main-QH7UQXJN.js")
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusOK))
+		gomega.Expect(rec.Body.String()).Should(gomega.Equal("console.log('main')"))
+		gomega.Expect(rec.Header().Get(echo.HeaderCacheControl)).Should(gomega.Equal("public, max-age=31536000, immutable"))
+
+		rec = request(http.MethodGet, "/styles-5INURTSO.css")
+		gomega.Expect(rec.Header().Get(echo.HeaderCacheControl)).Should(gomega.Equal("public, max-age=31536000, immutable"))
+
+		rec = request(http.MethodGet, "/media/logo.svg")
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusOK))
+		gomega.Expect(rec.Header().Get(echo.HeaderCacheControl)).Should(gomega.Equal("no-cache"))
+	})
+
+	ginkgo.It("should return 404 for missing assets and dot files", func() {
+		for _, path := range []string{"/main-MISSING0.js", "/.env", "/assets/.hidden/a.txt"} {
+			rec := request(http.MethodGet, path)
+
+			gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusNotFound), path)
+			gomega.Expect(rec.Body.String()).ShouldNot(gomega.ContainSubstring("<app-root>"), path)
+		}
+	})
+
+	ginkgo.It("should keep the JSON 404 for unknown API paths", func() {
+		rec := request(http.MethodGet, "/api/v1/unknown")
+
+		var res handler.HttpError
+		gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &res)).Should(gomega.Succeed())
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusNotFound))
+		gomega.Expect(res.Message).Should(gomega.Equal("Invalid endpoint"))
+	})
+
+	ginkgo.It("should only allow the configured origins", func() {
+		rec := request(http.MethodOptions, "/api/v1/users",
+			echo.HeaderOrigin, "https://users.example.com", echo.HeaderAccessControlRequestMethod, http.MethodGet)
+		gomega.Expect(rec.Header().Get(echo.HeaderAccessControlAllowOrigin)).Should(gomega.Equal("https://users.example.com"))
+
+		rec = request(http.MethodOptions, "/api/v1/users",
+			echo.HeaderOrigin, "http://localhost:4200", echo.HeaderAccessControlRequestMethod, http.MethodGet)
+		gomega.Expect(rec.Header().Get(echo.HeaderAccessControlAllowOrigin)).Should(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should refuse a build without index.html", func() {
+		_, err := handler.NewSPAHttpHandler(echo.New(), handler.SPAConfig{FS: fstest.MapFS{}})
+		gomega.Expect(err).Should(gomega.HaveOccurred())
+	})
+})
@@ -0,0 +1,307 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+	"users-backend/controller"
+	"users-backend/handler"
+	"users-backend/health"
+	"users-backend/idempotency"
+	"users-backend/logging"
+	"users-backend/model"
+	"users-backend/repo"
+	"users-backend/repo/mock"
+	"users-backend/tenant"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Tenant Middleware", func() {
+	var (
+		e        *echo.Echo
+		mockRepo *mock.TenantRepoMock
+		cfg      handler.TenantConfig
+		secret   = []byte("tenant-secret")
+	)
+
+	// echoTenant responds with the tenant id the request was scoped to
+	echoTenant := func(c echo.Context) error {
+		id, ok := tenant.ID(c.Request().Context())
+		if !ok {
+			return c.String(http.StatusOK, "none")
+		}
+		return c.String(http.StatusOK, fmt.Sprint(id))
+	}
+
+	request := func(host string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/users", nil)
+		req.Host = host
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	sign := func(method jwt.SigningMethod, key interface{}, claims jwt.MapClaims) string {
+		token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		return "Bearer " + token
+	}
+
+	ginkgo.BeforeEach(func() {
+		mockRepo = mock.NewTenantRepoMock()
+		mockRepo.On("GetTenantBySlug", model.DefaultTenantSlug).Return(&model.Tenant{TenantID: 1, Slug: "default", Name: "Default"}, nil)
+		mockRepo.On("GetTenantBySlug", "acme").Return(&model.Tenant{TenantID: 2, Slug: "acme", Name: "Acme"}, nil)
+		mockRepo.On("GetTenantBySlug", "initech").Return(&model.Tenant{TenantID: 3, Slug: "initech", Name: "Initech"}, nil)
+		mockRepo.On("GetTenantBySlug", "nope").Return(nil, repo.ErrTenantNotFound)
+
+		cfg = handler.TenantConfig{
+			Controller: controller.NewTenantController(mockRepo, logging.Discard()),
+			Resolvers: []handler.TenantResolver{
+				handler.TenantFromToken(secret, "tenant"),
+				handler.TenantFromSubdomain("users.example.com"),
+				handler.TenantFromHeader(handler.HeaderTenant),
+			},
+			Default: model.DefaultTenantSlug,
+		}
+	})
+
+	setup := func() {
+		e = echo.New()
+		e.GET("/api/v1/users", echoTenant, handler.TenantMiddleware(cfg, logging.Discard()))
+	}
+
+	ginkgo.It("should resolve the tenant from the header", func() {
+		setup()
+		rec := request("users.example.com", handler.HeaderTenant, "Acme")
+
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusOK))
+		gomega.Expect(rec.Body.String()).Should(gomega.Equal("2"))
+	})
+
+	ginkgo.It("should resolve the tenant from the subdomain", func() {
+		setup()
+
+		gomega.Expect(request("acme.users.example.com:8443").Body.String()).Should(gomega.Equal("2"))
+		gomega.Expect(request("a.b.users.example.com").Body.String()).Should(gomega.Equal("1"))
+		gomega.Expect(request("acme.other.example.com").Body.String()).Should(gomega.Equal("1"))
+	})
+
+	ginkgo.It("should resolve the tenant from the token before the other resolvers", func() {
+		setup()
+		token := sign(jwt.SigningMethodHS256, secret, jwt.MapClaims{"tenant": "initech"})
+
+		rec := request("acme.users.example.com", echo.HeaderAuthorization, token, handler.HeaderTenant, "acme")
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusOK))
+		gomega.Expect(rec.Body.String()).Should(gomega.Equal("3"))
+	})
+
+	ginkgo.It("should reject invalid, expired and unsigned tokens", func() {
+		setup()
+		tokens := []string{
+			sign(jwt.SigningMethodHS256, []byte("other-secret"), jwt.MapClaims{"tenant": "acme"}),
+			sign(jwt.SigningMethodHS256, secret, jwt.MapClaims{"tenant": "acme", "exp": time.Now().Add(-time.Minute).Unix()}),
+			sign(jwt.SigningMethodHS256, secret, jwt.MapClaims{"sub": "johndoe"}),
+			sign(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, jwt.MapClaims{"tenant": "acme"}),
+			"Bearer garbage",
+		}
+
+		for _, token := range tokens {
+			rec := request("users.example.com", echo.HeaderAuthorization, token, echo.HeaderAccept, handler.MIMEApplicationProblemJSON)
+
+			var problem handler.HttpProblem
+			gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &problem)).Should(gomega.Succeed())
+			gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusUnauthorized), token)
+			gomega.Expect(problem.Type).Should(gomega.Equal(handler.ProblemInvalidToken))
+			gomega.Expect(rec.Header().Get(echo.HeaderWWWAuthenticate)).Should(gomega.ContainSubstring("invalid_token"))
+		}
+	})
+
+	ginkgo.It("should fall back to the default tenant", func() {
+		setup()
+		rec := request("localhost:8080")
+
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusOK))
+		gomega.Expect(rec.Body.String()).Should(gomega.Equal("1"))
+	})
+
+	ginkgo.It("should reject requests without a tenant when there is no default", func() {
+		cfg.Default = ""
+		setup()
+		rec := request("localhost:8080")
+
+		var res handler.HttpError
+		gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &res)).Should(gomega.Succeed())
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusBadRequest))
+		gomega.Expect(res.Message).Should(gomega.Equal("Missing tenant"))
+	})
+
+	ginkgo.It("should return 404 for unknown tenants", func() {
+		setup()
+		rec := request("nope.users.example.com")
+
+		var res handler.HttpError
+		gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &res)).Should(gomega.Succeed())
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusNotFound))
+		gomega.Expect(res.Message).Should(gomega.Equal("Tenant not found"))
+	})
+
+	ginkgo.It("should scope Idempotency-Keys to the tenant", func() {
+		calls := 0
+		e = echo.New()
+		e.POST("/api/v1/users", func(c echo.Context) error {
+			calls++
+			return echoTenant(c)
+		}, handler.TenantMiddleware(cfg, logging.Discard()), handler.IdempotencyMiddleware(idempotency.NewMemoryStore(), time.Hour, logging.Discard()))
+
+		post := func(slug string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/users", strings.NewReader(`{}`))
+			req.Header.Set(handler.HeaderTenant, slug)
+			req.Header.Set(handler.HeaderIdempotencyKey, "key-1")
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			return rec
+		}
+
+		gomega.Expect(post("acme").Body.String()).Should(gomega.Equal("2"))
+		gomega.Expect(post("initech").Body.String()).Should(gomega.Equal("3"))
+
+		rec := post("acme")
+		gomega.Expect(rec.Body.String()).Should(gomega.Equal("2"))
+		gomega.Expect(rec.Header().Get(handler.HeaderIdempotentReplayed)).Should(gomega.Equal("true"))
+		gomega.Expect(calls).Should(gomega.Equal(2))
+	})
+})
+
+var _ = ginkgo.Describe("Tenant Handler", func() {
+	var (
+		e        *echo.Echo
+		mockRepo *mock.TenantRepoMock
+	)
+
+	request := func(method, path, body string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	setup := func(adminToken string) {
+		e = echo.New()
+		handler.InitRouter(e, controller.NewUserController(mock.NewUserRepoMock(), logging.Discard()), handler.RouterConfig{
+			Health:           health.New(time.Second),
+			Logger:           logging.Discard(),
+			IdempotencyStore: idempotency.NewMemoryStore(),
+			IdempotencyTTL:   time.Hour,
+			Tenant: &handler.TenantConfig{
+				Controller: controller.NewTenantController(mockRepo, logging.Discard()),
+				Default:    model.DefaultTenantSlug,
+				AdminToken: adminToken,
+			},
+		})
+	}
+
+	admin := []string{echo.HeaderAuthorization, "Bearer admin-token"}
+
+	ginkgo.BeforeEach(func() {
+		mockRepo = mock.NewTenantRepoMock()
+	})
+
+	ginkgo.It("should not register the endpoints without an admin token", func() {
+		setup("")
+		rec := request(http.MethodGet, "/api/v1/tenants", "", admin...)
+
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusNotFound))
+	})
+
+	ginkgo.It("should reject requests without the admin token", func() {
+		setup("admin-token")
+
+		for _, header := range [][]string{nil, {echo.HeaderAuthorization, "Bearer wrong"}, {echo.HeaderAuthorization, "admin-token"}} {
+			rec := request(http.MethodGet, "/api/v1/tenants", "", header...)
+
+			var res handler.HttpError
+			gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &res)).Should(gomega.Succeed())
+			gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusUnauthorized))
+			gomega.Expect(res.Message).Should(gomega.Equal("Unauthorized"))
+			gomega.Expect(rec.Header().Get(echo.HeaderWWWAuthenticate)).Should(gomega.Equal("Bearer"))
+		}
+	})
+
+	ginkgo.It("should create a tenant with a normalized slug", func() {
+		setup("admin-token")
+		mockRepo.On("CreateTenant", &model.Tenant{Slug: "acme", Name: "Acme Corp"}).Return(2, nil)
+
+		rec := request(http.MethodPost, "/api/v1/tenants", `{"slug": " ACME ", "name": "Acme Corp"}`, admin...)
+
+		var res handler.HttpSuccess
+		gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &res)).Should(gomega.Succeed())
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusCreated))
+		gomega.Expect(res.Data).Should(gomega.Equal(map[string]interface{}{"tenant_id": float64(2)}))
+	})
+
+	ginkgo.It("should report invalid and duplicate slugs as field errors", func() {
+		setup("admin-token")
+		mockRepo.On("CreateTenant", &model.Tenant{Slug: "acme", Name: "Acme Corp"}).Return(-1, repo.ErrDuplicateTenantSlug)
+		problem := append([]string{echo.HeaderAccept, handler.MIMEApplicationProblemJSON}, admin...)
+
+		var p handler.HttpProblem
+		rec := request(http.MethodPost, "/api/v1/tenants", `{"slug": "acme_corp", "name": "Acme Corp"}`, problem...)
+		gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &p)).Should(gomega.Succeed())
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusBadRequest))
+		gomega.Expect(p.Type).Should(gomega.Equal(handler.ProblemValidationFailed))
+		gomega.Expect(p.Errors).Should(gomega.ConsistOf(gomega.HaveField("Field", "slug")))
+
+		rec = request(http.MethodPost, "/api/v1/tenants", `{"slug": "acme", "name": "Acme Corp"}`, problem...)
+		gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &p)).Should(gomega.Succeed())
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusBadRequest))
+		gomega.Expect(p.Type).Should(gomega.Equal(handler.ProblemTenantAlreadyExists))
+	})
+
+	ginkgo.It("should get, list and update tenants", func() {
+		setup("admin-token")
+		acme := model.Tenant{TenantID: 2, Slug: "acme", Name: "Acme"}
+		mockRepo.On("GetTenant", 2).Return(&acme, nil)
+		mockRepo.On("GetTenant", 9).Return(nil, repo.ErrTenantNotFound)
+		mockRepo.On("GetAllTenants").Return(&[]model.Tenant{acme}, nil)
+		mockRepo.On("UpdateTenant", &model.Tenant{TenantID: 2, Slug: "acme", Name: "Acme Corp"}).Return(2, nil)
+
+		var res handler.HttpSuccess
+		rec := request(http.MethodGet, "/api/v1/tenants/2", "", admin...)
+		gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &res)).Should(gomega.Succeed())
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusOK))
+		gomega.Expect(res.Data).Should(gomega.Equal(map[string]interface{}{"tenant_id": float64(2), "slug": "acme", "name": "Acme"}))
+
+		gomega.Expect(request(http.MethodGet, "/api/v1/tenants/9", "", admin...).Code).Should(gomega.Equal(http.StatusNotFound))
+		gomega.Expect(request(http.MethodGet, "/api/v1/tenants/acme", "", admin...).Code).Should(gomega.Equal(http.StatusBadRequest))
+		gomega.Expect(request(http.MethodGet, "/api/v1/tenants", "", admin...).Code).Should(gomega.Equal(http.StatusOK))
+		gomega.Expect(request(http.MethodPut, "/api/v1/tenants", `{"tenant_id": 2, "slug": "acme", "name": "Acme Corp"}`, admin...).Code).Should(gomega.Equal(http.StatusOK))
+	})
+
+	ginkgo.It("should refuse to delete a tenant with users", func() {
+		setup("admin-token")
+		mockRepo.On("DeleteTenant", 2).Return(repo.ErrTenantInUse)
+		mockRepo.On("DeleteTenant", 3).Return(nil)
+
+		var res handler.HttpError
+		rec := request(http.MethodDelete, "/api/v1/tenants/2", "", admin...)
+		gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &res)).Should(gomega.Succeed())
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusConflict))
+		gomega.Expect(res.Message).Should(gomega.Equal("Tenant has users"))
+
+		gomega.Expect(request(http.MethodDelete, "/api/v1/tenants/3", "", admin...).Code).Should(gomega.Equal(http.StatusOK))
+	})
+})
@@ -0,0 +1,210 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+	"users-backend/auth"
+	"users-backend/controller"
+	"users-backend/handler"
+	"users-backend/health"
+	"users-backend/idempotency"
+	"users-backend/logging"
+	"users-backend/model"
+	"users-backend/repo"
+	"users-backend/repo/mock"
+
+	"github.com/labstack/echo/v4"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	testifymock "github.com/stretchr/testify/mock"
+)
+
+var _ = ginkgo.Describe("Two-factor", func() {
+	const (
+		password = "correct horse battery staple"
+		secret   = "JBSWY3DPEHPK3PXP"
+	)
+
+	var (
+		e               *echo.Echo
+		mockUsers       *mock.UserRepoMock
+		mockCredentials *mock.CredentialRepoMock
+		mockFactors     *mock.TwoFactorRepoMock
+		tokens          *auth.TokenSigner
+		secrets         *auth.SecretBox
+		hasher          = auth.NewArgon2idHasher(auth.Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+		token           string
+	)
+
+	request := func(method, path, body string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(echo.HeaderAccept, handler.MIMEApplicationProblemJSON)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	problem := func(rec *httptest.ResponseRecorder) handler.HttpProblem {
+		var p handler.HttpProblem
+		gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &p)).Should(gomega.Succeed())
+		return p
+	}
+
+	bearer := func() []string {
+		return []string{echo.HeaderAuthorization, "Bearer " + token}
+	}
+	admin := []string{echo.HeaderAuthorization, "Bearer admin-token"}
+
+	confirmed := func() *model.TwoFactor {
+		sealed, err := secrets.Seal(secret)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		return &model.TwoFactor{UserID: 1, TenantID: 2, Secret: sealed, ConfirmedAt: time.Now().Add(-time.Hour)}
+	}
+
+	currentCode := func() string {
+		code, err := auth.TOTPCode(secret, auth.TOTPStep(time.Now()))
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		return code
+	}
+
+	ginkgo.BeforeEach(func() {
+		var err error
+		tokens, err = auth.NewTokenSigner([]byte(strings.Repeat("s", auth.MinSecretLength)), time.Hour)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		secrets, err = auth.NewSecretBox([]byte(strings.Repeat("k", auth.MinSecretBoxKeyLength)))
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		signed, err := tokens.Sign(1, 2, "alice", time.Now())
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		token = signed.Value
+
+		alice := &model.User{UserID: 1, TenantID: 2, UserName: "alice", Email: "alice@email.com", UserStatus: model.Active}
+		mockUsers = mock.NewUserRepoMock()
+		mockCredentials = mock.NewCredentialRepoMock()
+		mockFactors = mock.NewTwoFactorRepoMock()
+		mockTenants := mock.NewTenantRepoMock()
+		mockUsers.On("GetByUsername", "alice").Return(alice, nil)
+		mockUsers.On("GetById", 1).Return(alice, nil)
+		mockUsers.On("GetById", 42).Return((*model.User)(nil), fmt.Errorf("%w: no rows", repo.ErrNotFound))
+		mockTenants.On("GetTenant", 2).Return(&model.Tenant{TenantID: 2, Slug: "acme"}, nil)
+		mockTenants.On("GetTenantBySlug", "acme").Return(&model.Tenant{TenantID: 2, Slug: "acme"}, nil)
+
+		hash, err := hasher.Hash(password)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		mockCredentials.On("GetCredential", 1).Return(&model.Credential{UserID: 1, TenantID: 2, PasswordHash: hash}, nil)
+
+		authController := controller.NewAuthController(mockUsers, mockCredentials, tokens, logging.Discard(),
+			controller.WithHasher(hasher), controller.WithTwoFactor(mockFactors, secrets, "Users"))
+
+		e = echo.New()
+		handler.InitRouter(e, controller.NewUserController(mockUsers, logging.Discard()), handler.RouterConfig{
+			Health:           health.New(time.Second),
+			Logger:           logging.Discard(),
+			IdempotencyStore: idempotency.NewMemoryStore(),
+			IdempotencyTTL:   time.Hour,
+			Tenant: &handler.TenantConfig{
+				Controller: controller.NewTenantController(mockTenants, logging.Discard()),
+				Default:    "acme",
+				AdminToken: "admin-token",
+			},
+			Auth:      authController,
+			TwoFactor: authController,
+		})
+	})
+
+	ginkgo.It("should ask for the code at login", func() {
+		mockFactors.On("GetTwoFactor", 1).Return(confirmed(), nil)
+		mockFactors.On("UseTwoFactorStep", 1, testifymock.Anything).Return(true, nil)
+		mockFactors.On("UseRecoveryCode", 1, testifymock.Anything).Return(false, nil)
+		mockCredentials.On("RecordLoginFailure", 1).Return(1, nil)
+
+		rec := request(http.MethodPost, "/api/v1/auth/login", fmt.Sprintf(`{"user_name":"alice","password":%q}`, password))
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusUnauthorized))
+		gomega.Expect(problem(rec).Type).Should(gomega.Equal(handler.ProblemTwoFactorRequired))
+
+		rec = request(http.MethodPost, "/api/v1/auth/login", fmt.Sprintf(`{"user_name":"alice","password":%q,"code":"not-a-code"}`, password))
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusUnauthorized))
+		gomega.Expect(problem(rec).Type).Should(gomega.Equal(handler.ProblemInvalidTwoFactorCode))
+
+		rec = request(http.MethodPost, "/api/v1/auth/login", fmt.Sprintf(`{"user_name":"alice","password":%q,"code":%q}`, password, currentCode()))
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusOK))
+	})
+
+	ginkgo.It("should enroll and confirm the factor of the logged in user", func() {
+		var sealed string
+		mockFactors.On("GetTwoFactor", 1).Return(nil, fmt.Errorf("%w: no rows", repo.ErrTwoFactorNotFound)).Once()
+		mockFactors.On("EnrollTwoFactor", 1, testifymock.Anything).Run(func(args testifymock.Arguments) {
+			sealed = args.String(1)
+		}).Return(nil)
+
+		rec := request(http.MethodPost, "/api/v1/auth/two-factor", "", bearer()...)
+		var enrolled struct {
+			Data handler.HttpTwoFactorEnrollment `json:"data"`
+		}
+		gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &enrolled)).Should(gomega.Succeed())
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusCreated))
+		gomega.Expect(rec.Header().Get(echo.HeaderCacheControl)).Should(gomega.Equal("no-store"))
+		gomega.Expect(enrolled.Data.OtpauthURI).Should(gomega.HavePrefix("otpauth://totp/Users:alice?"))
+		gomega.Expect(enrolled.Data.QRCode).Should(gomega.HavePrefix("data:image/png;base64,"))
+
+		mockFactors.On("GetTwoFactor", 1).Return(&model.TwoFactor{UserID: 1, Secret: sealed}, nil)
+		mockFactors.On("ConfirmTwoFactor", 1, testifymock.Anything, testifymock.Anything).Return(nil)
+		code, err := auth.TOTPCode(enrolled.Data.Secret, auth.TOTPStep(time.Now()))
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+		rec = request(http.MethodPost, "/api/v1/auth/two-factor/confirm", fmt.Sprintf(`{"code":%q}`, code), bearer()...)
+		var codes struct {
+			Data handler.HttpRecoveryCodes `json:"data"`
+		}
+		gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &codes)).Should(gomega.Succeed())
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusOK))
+		gomega.Expect(codes.Data.RecoveryCodes).Should(gomega.HaveLen(controller.RecoveryCodeCount))
+
+		rec = request(http.MethodPost, "/api/v1/auth/two-factor/confirm", `{}`, bearer()...)
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusBadRequest))
+	})
+
+	ginkgo.It("should require a valid login token", func() {
+		rec := request(http.MethodGet, "/api/v1/auth/two-factor", "")
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusUnauthorized))
+		gomega.Expect(rec.Header().Get(echo.HeaderWWWAuthenticate)).Should(gomega.Equal("Bearer"))
+
+		rec = request(http.MethodGet, "/api/v1/auth/two-factor", "", echo.HeaderAuthorization, "Bearer "+token+"x")
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusUnauthorized))
+		gomega.Expect(problem(rec).Type).Should(gomega.Equal(handler.ProblemUnauthorized))
+
+		rec = request(http.MethodGet, "/api/v1/auth/two-factor", "", admin...)
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusUnauthorized))
+	})
+
+	ginkgo.It("should let admins read and reset the factor of a user", func() {
+		mockFactors.On("GetTwoFactor", 1).Return(confirmed(), nil)
+		mockFactors.On("CountRecoveryCodes", 1).Return(9, nil)
+		mockFactors.On("DeleteTwoFactor", 1).Return(nil)
+
+		rec := request(http.MethodGet, "/api/v1/tenants/2/users/1/two-factor", "", admin...)
+		var status struct {
+			Data handler.HttpTwoFactorStatus `json:"data"`
+		}
+		gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &status)).Should(gomega.Succeed())
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusOK))
+		gomega.Expect(status.Data.Enabled).Should(gomega.BeTrue())
+		gomega.Expect(status.Data.ConfirmedAt).ShouldNot(gomega.BeNil())
+		gomega.Expect(status.Data.RecoveryCodesLeft).Should(gomega.Equal(9))
+
+		gomega.Expect(request(http.MethodDelete, "/api/v1/tenants/2/users/1/two-factor", "", admin...).Code).Should(gomega.Equal(http.StatusOK))
+		mockFactors.AssertCalled(ginkgo.GinkgoT(), "DeleteTwoFactor", 1)
+
+		rec = request(http.MethodDelete, "/api/v1/tenants/2/users/42/two-factor", "", admin...)
+		gomega.Expect(rec.Code).Should(gomega.Equal(http.StatusNotFound))
+		gomega.Expect(problem(rec).Type).Should(gomega.Equal(handler.ProblemUserNotFound))
+		gomega.Expect(request(http.MethodDelete, "/api/v1/tenants/2/users/1/two-factor", "", bearer()...).Code).Should(gomega.Equal(http.StatusUnauthorized))
+	})
+})
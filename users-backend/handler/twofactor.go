@@ -0,0 +1,283 @@
+package handler
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"users-backend/controller"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	HttpTwoFactorCode struct {
+		// Code is the current TOTP code of the authenticator app
+		Code string `json:"code" validate:"required"`
+	}
+
+	HttpTwoFactorEnrollment struct {
+		// Secret is the base32 TOTP secret, for apps that can not scan
+		Secret     string `json:"secret"`
+		OtpauthURI string `json:"otpauth_uri"`
+		// QRCode is a PNG data URI of a QR code of the otpauth URI
+		QRCode string `json:"qr_code"`
+	}
+
+	// HttpRecoveryCodes are shown once, each logs the user in once without
+	// the authenticator app
+	HttpRecoveryCodes struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	HttpTwoFactorStatus struct {
+		Enabled bool `json:"enabled"`
+		// Pending is true between enrolling and confirming
+		Pending           bool       `json:"pending"`
+		ConfirmedAt       *time.Time `json:"confirmed_at,omitempty"`
+		RecoveryCodesLeft int        `json:"recovery_codes_left"`
+	}
+
+	TwoFactorHttpHandler struct {
+		group      *echo.Group
+		admin      *echo.Group
+		controller controller.TwoFactorController
+	}
+)
+
+// NewTwoFactorHttpHandler serves the second factor of the logged in user
+// under eg and the second factor of each user of a tenant under admin, a nil
+// group disables its endpoints
+func NewTwoFactorHttpHandler(eg *echo.Group, admin *echo.Group, c controller.TwoFactorController) *TwoFactorHttpHandler {
+	return &TwoFactorHttpHandler{
+		group:      eg,
+		admin:      admin,
+		controller: c,
+	}
+}
+
+func (h *TwoFactorHttpHandler) RegisterRoutes() {
+	if h.group != nil {
+		h.group.GET("", h.GetOwnTwoFactor)
+		h.group.POST("", h.EnrollTwoFactor)
+		h.group.POST("/confirm", h.ConfirmTwoFactor)
+		h.group.POST("/recovery-codes", h.RegenerateRecoveryCodes)
+	}
+	if h.admin != nil {
+		h.admin.GET("/:user_id/two-factor", h.GetTwoFactor)
+		h.admin.DELETE("/:user_id/two-factor", h.ResetTwoFactor)
+	}
+}
+
+func NewHttpTwoFactorStatus(s *controller.TwoFactorStatus) HttpTwoFactorStatus {
+	status := HttpTwoFactorStatus{Enabled: s.Enabled, Pending: s.Pending, RecoveryCodesLeft: s.RecoveryCodesLeft}
+	if !s.ConfirmedAt.IsZero() {
+		confirmedAt := s.ConfirmedAt.UTC()
+		status.ConfirmedAt = &confirmedAt
+	}
+	return status
+}
+
+// respTwoFactorError maps the non nil errors of the TwoFactorController,
+// action is the operation that failed for the internal error message
+func respTwoFactorError(c echo.Context, err error, userIdParam, action string) error {
+	var locked *controller.LockedError
+	switch {
+	case errors.Is(err, controller.ErrUserNotFound):
+		return respError(c, http.StatusNotFound, "User not found", fmt.Sprintf("User %q does not exist", userIdParam), ProblemUserNotFound)
+	case errors.Is(err, controller.ErrInvalidTwoFactorCode):
+		return respError(c, http.StatusBadRequest, "Invalid two-factor code", "The TOTP code is wrong, expired or was already used", ProblemInvalidTwoFactorCode)
+	case errors.Is(err, controller.ErrTwoFactorEnabled):
+		return respError(c, http.StatusConflict, "Two-factor enabled", "The second factor is already enabled, it must be reset to enroll again", ProblemTwoFactorEnabled)
+	case errors.Is(err, controller.ErrTwoFactorNotEnrolled):
+		return respError(c, http.StatusConflict, "Two-factor not enrolled", "No second factor is enrolled for the user", ProblemTwoFactorNotEnrolled)
+	case errors.Is(err, controller.ErrTwoFactorUnavailable):
+		return respError(c, http.StatusServiceUnavailable, "Two-factor unavailable", "Second factors are disabled, no encryption key is configured", ProblemTwoFactorUnavailable)
+	case errors.As(err, &locked):
+		c.Response().Header().Set(HeaderRetryAfter, strconv.Itoa(int(time.Until(locked.Until).Seconds())+1))
+		return respError(c, http.StatusForbidden, "Account locked", fmt.Sprintf("The account is locked after too many failed attempts until %s", locked.Until.UTC().Format(time.RFC3339)), ProblemAccountLocked)
+	default:
+		return respError(c, http.StatusInternalServerError, "Internal Server Error", fmt.Sprintf("Unexpected error trying to %s the second factor of user %s", action, userIdParam), ProblemInternal)
+	}
+}
+
+// @Summary		Gets the second factor of the logged in user
+// @Description	Tells whether the logged in user logs in with a TOTP second factor and how many recovery codes are left
+// @ID				GetOwnTwoFactor
+// @Tags			auth
+// @Produce		json
+// @Success		200		{object}	HttpSuccess{data=handler.HttpTwoFactorStatus,code=int,message=string}
+// @Failure		401		{object}	HttpError
+// @Failure		500		{object}	HttpError
+// @Failure		503		{object}	HttpError
+// @Security		UserToken
+// @Router			/auth/two-factor [GET]
+func (h *TwoFactorHttpHandler) GetOwnTwoFactor(c echo.Context) error {
+	user_id := authenticatedUser(c)
+
+	status, err := h.controller.GetTwoFactor(c.Request().Context(), user_id)
+	if err != nil {
+		return respTwoFactorError(c, err, strconv.Itoa(user_id), "get")
+	}
+
+	return respSuccess(c, http.StatusOK, success, NewHttpTwoFactorStatus(status))
+}
+
+// @Summary		Enrolls a second factor
+// @Description	Generates a TOTP secret for the logged in user to add to an authenticator app, as a secret, an otpauth URI or a QR code.
+// @Description	It is only asked at login once confirmed, enrolling again replaces an unconfirmed secret.
+// @ID				EnrollTwoFactor
+// @Tags			auth
+// @Produce		json,application/problem+json
+// @Success		201		{object}	HttpSuccess{data=handler.HttpTwoFactorEnrollment,code=int,message=string}
+// @Failure		401		{object}	HttpError
+// @Failure		409		{object}	HttpError	"The second factor is already enabled"
+// @Failure		500		{object}	HttpError
+// @Failure		503		{object}	HttpError	"No encryption key is configured"
+// @Security		UserToken
+// @Router			/auth/two-factor [POST]
+func (h *TwoFactorHttpHandler) EnrollTwoFactor(c echo.Context) error {
+	user_id := authenticatedUser(c)
+
+	enrollment, err := h.controller.EnrollTwoFactor(c.Request().Context(), user_id)
+	if err != nil {
+		return respTwoFactorError(c, err, strconv.Itoa(user_id), "enroll")
+	}
+
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	return respSuccess(c, http.StatusCreated, success, HttpTwoFactorEnrollment{
+		Secret:     enrollment.Secret,
+		OtpauthURI: enrollment.URI,
+		QRCode:     "data:image/png;base64," + base64.StdEncoding.EncodeToString(enrollment.QRCode),
+	})
+}
+
+// @Summary		Confirms a second factor
+// @Description	Enables the enrolled second factor of the logged in user with a code of the authenticator app and returns its recovery codes. They are not shown again.
+// @ID				ConfirmTwoFactor
+// @Tags			auth
+// @Accept			json
+// @Produce		json,application/problem+json
+// @Param			code	body		HttpTwoFactorCode	true	"TOTP code"
+// @Success		200		{object}	HttpSuccess{data=handler.HttpRecoveryCodes,code=int,message=string}
+// @Failure		400		{object}	HttpError	"Wrong code"
+// @Failure		401		{object}	HttpError
+// @Failure		409		{object}	HttpError	"Nothing enrolled or already enabled"
+// @Failure		500		{object}	HttpError
+// @Failure		503		{object}	HttpError
+// @Security		UserToken
+// @Router			/auth/two-factor/confirm [POST]
+func (h *TwoFactorHttpHandler) ConfirmTwoFactor(c echo.Context) error {
+	body := HttpTwoFactorCode{}
+	if err := c.Bind(&body); err != nil {
+		return respError(c, http.StatusBadRequest, "Invalid body", fmt.Sprintf("Invalid body: %v", err), ProblemInvalidBody)
+	}
+	if err := structValidator.Struct(body); err != nil {
+		return respond(c, http.StatusBadRequest, newValidationError(err))
+	}
+
+	user_id := authenticatedUser(c)
+	codes, err := h.controller.ConfirmTwoFactor(c.Request().Context(), user_id, body.Code)
+	if err != nil {
+		return respTwoFactorError(c, err, strconv.Itoa(user_id), "confirm")
+	}
+
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	return respSuccess(c, http.StatusOK, success, HttpRecoveryCodes{RecoveryCodes: codes})
+}
+
+// @Summary		Regenerates the recovery codes
+// @Description	Replaces the recovery codes of the logged in user when the code of the authenticator app is right, the previous codes stop working.
+// @Description	Wrong codes count as failed logins.
+// @ID				RegenerateRecoveryCodes
+// @Tags			auth
+// @Accept			json
+// @Produce		json,application/problem+json
+// @Param			code	body		HttpTwoFactorCode	true	"TOTP code"
+// @Success		200		{object}	HttpSuccess{data=handler.HttpRecoveryCodes,code=int,message=string}
+// @Failure		400		{object}	HttpError	"Wrong code"
+// @Failure		401		{object}	HttpError
+// @Failure		403		{object}	HttpError	"Account locked, with Retry-After"
+// @Failure		409		{object}	HttpError	"No second factor enabled"
+// @Failure		500		{object}	HttpError
+// @Failure		503		{object}	HttpError
+// @Security		UserToken
+// @Router			/auth/two-factor/recovery-codes [POST]
+func (h *TwoFactorHttpHandler) RegenerateRecoveryCodes(c echo.Context) error {
+	body := HttpTwoFactorCode{}
+	if err := c.Bind(&body); err != nil {
+		return respError(c, http.StatusBadRequest, "Invalid body", fmt.Sprintf("Invalid body: %v", err), ProblemInvalidBody)
+	}
+	if err := structValidator.Struct(body); err != nil {
+		return respond(c, http.StatusBadRequest, newValidationError(err))
+	}
+
+	user_id := authenticatedUser(c)
+	codes, err := h.controller.RegenerateRecoveryCodes(c.Request().Context(), user_id, body.Code)
+	if err != nil {
+		return respTwoFactorError(c, err, strconv.Itoa(user_id), "regenerate the recovery codes of")
+	}
+
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	return respSuccess(c, http.StatusOK, success, HttpRecoveryCodes{RecoveryCodes: codes})
+}
+
+// @Summary		Gets the second factor of a user
+// @Description	Tells whether the user logs in with a TOTP second factor and how many recovery codes are left, requires the admin token
+// @ID				GetTwoFactor
+// @Tags			tenants
+// @Produce		json
+// @Param			tenant_id	path		int	true	"Tenant ID"
+// @Param			user_id		path		int	true	"User ID"
+// @Success		200		{object}	HttpSuccess{data=handler.HttpTwoFactorStatus,code=int,message=string}
+// @Failure		400		{object}	HttpError
+// @Failure		401		{object}	HttpError
+// @Failure		404		{object}	HttpError
+// @Failure		500		{object}	HttpError
+// @Security		AdminToken
+// @Router			/tenants/{tenant_id}/users/{user_id}/two-factor [GET]
+func (h *TwoFactorHttpHandler) GetTwoFactor(c echo.Context) error {
+	userIdParam := c.Param("user_id")
+	user_id, err := strconv.Atoi(userIdParam)
+	if err != nil {
+		return respError(c, http.StatusBadRequest, "Invalid user_id", fmt.Sprintf("user_id %q is not a valid user_id as it is not a number", userIdParam), ProblemInvalidUserID)
+	}
+
+	status, err := h.controller.GetTwoFactor(c.Request().Context(), user_id)
+	if err != nil {
+		return respTwoFactorError(c, err, userIdParam, "get")
+	}
+
+	return respSuccess(c, http.StatusOK, success, NewHttpTwoFactorStatus(status))
+}
+
+// @Summary		Resets the second factor of a user
+// @Description	Removes the second factor and the recovery codes of a user who lost their device, requires the admin token. The user logs in with the password alone until enrolling again.
+// @ID				ResetTwoFactor
+// @Tags			tenants
+// @Produce		json
+// @Param			tenant_id	path		int	true	"Tenant ID"
+// @Param			user_id		path		int	true	"User ID"
+// @Param			Idempotency-Key	header	string	false	"Replays the original response when a request is retried with the same key"
+// @Success		200		{object}	HttpSuccess
+// @Failure		400		{object}	HttpError
+// @Failure		401		{object}	HttpError
+// @Failure		404		{object}	HttpError
+// @Failure		500		{object}	HttpError
+// @Security		AdminToken
+// @Router			/tenants/{tenant_id}/users/{user_id}/two-factor [DELETE]
+func (h *TwoFactorHttpHandler) ResetTwoFactor(c echo.Context) error {
+	userIdParam := c.Param("user_id")
+	user_id, err := strconv.Atoi(userIdParam)
+	if err != nil {
+		return respError(c, http.StatusBadRequest, "Invalid user_id", fmt.Sprintf("user_id %q is not a valid user_id as it is not a number", userIdParam), ProblemInvalidUserID)
+	}
+
+	if err := h.controller.ResetTwoFactor(c.Request().Context(), user_id); err != nil {
+		return respTwoFactorError(c, err, userIdParam, "reset")
+	}
+
+	return respSuccess(c, http.StatusOK, success)
+}
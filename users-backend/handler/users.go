@@ -1,14 +1,19 @@
 package handler
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"users-backend/controller"
 	"users-backend/model"
 
-	"github.com/go-playground/validator/v10"
 	"github.com/labstack/echo/v4"
 )
 
@@ -20,6 +25,10 @@ type (
 		Email      string  `json:"email" validate:"required,email"`
 		UserStatus string  `json:"user_status" validate:"required"`
 		Department *string `json:"department,omitempty"`
+		// ManagerID is the user this user reports to
+		ManagerID *int `json:"manager_id,omitempty" validate:"omitempty,min=1"`
+		// Attributes are the values of the custom attributes of the tenant
+		Attributes map[string]interface{} `json:"attributes,omitempty" swaggertype:"object"`
 	}
 
 	HttpUserPut struct {
@@ -30,6 +39,12 @@ type (
 		Email      string  `json:"email" validate:"required,email"`
 		UserStatus string  `json:"user_status" validate:"required"`
 		Department *string `json:"department,omitempty"`
+		// ManagerID is the user this user reports to, the manager is kept when
+		// it is omitted and removed by 0 or null
+		ManagerID *int `json:"manager_id,omitempty" validate:"omitempty,min=0"`
+		// Attributes replace the custom attributes of the user, they are kept
+		// when omitted and cleared by an empty object
+		Attributes map[string]interface{} `json:"attributes,omitempty" swaggertype:"object"`
 	}
 
 	HttpUserIdResponse struct {
@@ -37,18 +52,22 @@ type (
 	}
 
 	HttpUserResponse struct {
-		UserID     int     `json:"user_id"`
-		UserName   string  `json:"user_name"`
-		FirstName  string  `json:"first_name"`
-		LastName   string  `json:"last_name"`
-		Email      string  `json:"email"`
-		UserStatus string  `json:"user_status"`
-		Department *string `json:"department,omitempty"`
+		UserID    int    `json:"user_id"`
+		UserName  string `json:"user_name"`
+		FirstName string `json:"first_name"`
+		LastName  string `json:"last_name"`
+		Email     string `json:"email"`
+		// EmailVerified is set once the user followed a verification link
+		EmailVerified bool                   `json:"email_verified"`
+		UserStatus    string                 `json:"user_status"`
+		Department    *string                `json:"department,omitempty"`
+		ManagerID     *int                   `json:"manager_id,omitempty"`
+		Attributes    map[string]interface{} `json:"attributes,omitempty" swaggertype:"object"`
 	}
 
 	UserHttpHandler struct {
 		group      *echo.Group
-		controller *controller.UserControllerImpl
+		controller controller.UserController
 	}
 
 	HttpUserPostResponse struct {
@@ -60,9 +79,20 @@ type (
 	}
 )
 
-const success = "Success"
+const (
+	success = "Success"
+
+	// attributeQueryPrefix prefixes the query parameters filtering users by
+	// custom attribute
+	attributeQueryPrefix = "attr."
+)
+
+var (
+	usernameTaken   = HttpFieldError{Field: "user_name", Rule: "unique", Message: "is already taken"}
+	incorrectStatus = HttpFieldError{Field: "user_status", Rule: "oneof", Message: "must be one of: Active, A, Inactive, I, Terminated, T"}
+)
 
-func NewUserHttpHandler(eg *echo.Group, c *controller.UserControllerImpl) *UserHttpHandler {
+func NewUserHttpHandler(eg *echo.Group, c controller.UserController) *UserHttpHandler {
 	return &UserHttpHandler{
 		group:      eg,
 		controller: c,
@@ -73,58 +103,91 @@ func (h *UserHttpHandler) RegisterRoutes() {
 	h.group.GET("/:user_id", h.GetUser)
 	h.group.GET("", h.GetAllUsers)
 	h.group.POST("", h.CreateUser)
+	h.group.POST("/batch", h.Batch)
 	h.group.PUT("", h.UpdateUser)
 	h.group.DELETE("/:user_id", h.DeleteUser)
+	h.group.GET("/:user_id/reports", h.GetDirectReports)
+	h.group.GET("/:user_id/chain", h.GetManagementChain)
+	h.group.GET("/:user_id/subtree", h.GetSubordinates)
 }
 
 // @Summary		Create a new user
 // @Description	Create a new user
 // @ID				CreateUser
 // @Tags			users
-// @Produce		json
+// @Produce		json,application/problem+json
 // @Param			user	body		HttpUserPost	true	"User Informations"
+// @Param			Idempotency-Key	header	string	false	"Replays the original response when a request is retried with the same key"
 // @Success		200		{object}	HttpSuccess{data=handler.HttpUserPostResponse,code=int,message=string}
-// @Failure		400		{object}	HttpError
+// @Failure		400		{object}	HttpError	"HttpProblem with field errors when Accept is application/problem+json"
+// @Failure		409		{object}	HttpError
+// @Failure		422		{object}	HttpError
 // @Failure		500		{object}	HttpError
 // @Router			/users [POST]
 func (h *UserHttpHandler) CreateUser(c echo.Context) error {
 	body := HttpUserPost{}
-	validate := validator.New()
 
 	if err := c.Bind(&body); err != nil {
-		return respError(c, http.StatusBadRequest, "Invalid body", fmt.Sprintf("Invalid body: %v", err))
+		return respError(c, http.StatusBadRequest, "Invalid body", fmt.Sprintf("Invalid body: %v", err), ProblemInvalidBody)
 	}
-	if err := validate.Struct(body); err != nil {
-		return respError(c, http.StatusBadRequest, "Invalid body", fmt.Sprintf("Invalid body: %v", err))
+
+	status, resp := h.createUser(c.Request().Context(), body)
+	return respond(c, status, resp)
+}
+
+// createUser validates and creates the user, returning the status code and
+// body to respond with so the batch endpoint can reuse it
+func (h *UserHttpHandler) createUser(ctx context.Context, body HttpUserPost) (int, interface{}) {
+	if err := structValidator.Struct(body); err != nil {
+		return http.StatusBadRequest, newValidationError(err)
 	}
 
-	newUserID, err := h.controller.CreateUser(body.UserName, body.FirstName, body.LastName, body.Email, body.UserStatus, pointerToString(body.Department))
+	newUserID, err := h.controller.CreateUser(ctx, body.UserName, body.FirstName, body.LastName, body.Email, body.UserStatus, pointerToString(body.Department), pointerToInt(body.ManagerID), body.Attributes)
 	if err != nil {
-		if err == controller.ErrUserAlreadyExists {
-			return respError(c, http.StatusBadRequest, "User already exists", fmt.Sprintf("user with username %s already exists", body.UserName))
+		var verr *controller.ValidationError
+		if errors.As(err, &verr) {
+			return http.StatusBadRequest, newControllerValidationError(verr)
+		} else if err == controller.ErrUserAlreadyExists {
+			return http.StatusBadRequest, newFieldError("User already exists", fmt.Sprintf("user with username %s already exists", body.UserName), ProblemUserAlreadyExists, usernameTaken)
 		} else if err == controller.ErrUserStatusIncorrect {
-			return respError(c, http.StatusBadRequest, "Incorrect Status", fmt.Sprintln("Accepted statuses are: Active, A, Inactive, I, Terminated, T"))
+			return http.StatusBadRequest, newFieldError("Incorrect Status", fmt.Sprintln("Accepted statuses are: Active, A, Inactive, I, Terminated, T"), ProblemInvalidUserStatus, incorrectStatus)
 		} else {
-			return respError(c, http.StatusInternalServerError, "Internal Server Error", fmt.Sprintf("Unexpected error trying to create user %s", body.UserName))
+			return http.StatusInternalServerError, newHttpError(http.StatusInternalServerError, "Internal Server Error", fmt.Sprintf("Unexpected error trying to create user %s", body.UserName), ProblemInternal)
 		}
 	}
 
-	return respSuccess(c, http.StatusCreated, success, HttpUserPostResponse{UserID: newUserID})
+	return http.StatusCreated, newHttpSuccess(http.StatusCreated, success, HttpUserPostResponse{UserID: newUserID})
 }
 
 // @Summary		Gets all the users
-// @Description	Gets all the users
+// @Description	Gets all the users, attr.<name>=<value> query parameters only keep the users whose custom attribute
+// @Description	<name> equals <value>
 // @ID				GetAllUsers
 // @Tags			users
-// @Produce		json
+// @Produce		json,application/problem+json
+// @Param			attr.name	query		string	false	"Custom attribute value to filter on, repeat for every attribute"
 // @Success		200		{object}	HttpSuccess{data=handler.HttpUserPostResponse[],code=int,message=string}
-// @Failure		400		{object}	HttpError
+// @Failure		400		{object}	HttpError	"HttpProblem with field errors when Accept is application/problem+json"
 // @Failure		500		{object}	HttpError
 // @Router			/users [GET]
 func (h *UserHttpHandler) GetAllUsers(c echo.Context) error {
-	users, err := h.controller.GetAllUsers()
+	ctx := c.Request().Context()
+
+	var (
+		users *[]model.User
+		err   error
+	)
+	if filters := attributeFilters(c.QueryParams()); len(filters) > 0 {
+		users, err = h.controller.GetUsersByAttributes(ctx, filters)
+	} else {
+		users, err = h.controller.GetAllUsers(ctx)
+	}
+	var verr *controller.ValidationError
+	if errors.As(err, &verr) {
+		return respond(c, http.StatusBadRequest, newControllerValidationError(verr))
+	}
 	if err != nil {
-		return respError(c, http.StatusInternalServerError, "Internal Server Error", fmt.Sprintln("Unexpected error trying to get all users"))
+		return respError(c, http.StatusInternalServerError, "Internal Server Error", fmt.Sprintln("Unexpected error trying to get all users"), ProblemInternal)
 	}
 
 	var response []HttpUserResponse
@@ -149,12 +212,12 @@ func (h *UserHttpHandler) GetUser(c echo.Context) error {
 	userIdParam := c.Param("user_id")
 	user_id, err := strconv.Atoi(userIdParam)
 	if err != nil {
-		return respError(c, http.StatusBadRequest, "Invalid user_id", fmt.Sprintf("user_id %q is not a valid user_id as it is not a number", userIdParam))
+		return respError(c, http.StatusBadRequest, "Invalid user_id", fmt.Sprintf("user_id %q is not a valid user_id as it is not a number", userIdParam), ProblemInvalidUserID)
 	}
 
-	user, err := h.controller.GetUser(user_id)
+	user, err := h.controller.GetUser(c.Request().Context(), user_id)
 	if err != nil {
-		return respError(c, http.StatusNotFound, "User not found", fmt.Sprintf("Unexpected error trying to get user %q: %s", userIdParam, err))
+		return respError(c, http.StatusNotFound, "User not found", fmt.Sprintf("Unexpected error trying to get user %q: %s", userIdParam, err), ProblemUserNotFound)
 	}
 
 	return respSuccess(c, http.StatusOK, success, NewHttpUserResponse(*user))
@@ -164,36 +227,44 @@ func (h *UserHttpHandler) GetUser(c echo.Context) error {
 // @Description	Updates a user
 // @ID				UpdateUser
 // @Tags			users
-// @Produce		json
+// @Produce		json,application/problem+json
 // @Param			user	body		HttpUserPut	true	"User Informations"
+// @Param			Idempotency-Key	header	string	false	"Replays the original response when a request is retried with the same key"
 // @Success		200		{object}	HttpSuccess{data=handler.HttpUserPostResponse,code=int,message=string}
-// @Failure		400		{object}	HttpError
+// @Failure		400		{object}	HttpError	"HttpProblem with field errors when Accept is application/problem+json"
 // @Failure		500		{object}	HttpError
 // @Router			/users [PUT]
 func (h *UserHttpHandler) UpdateUser(c echo.Context) error {
 	body := HttpUserPut{}
-	validate := validator.New()
 
 	if err := c.Bind(&body); err != nil {
-		return respError(c, http.StatusBadRequest, "Invalid body", fmt.Sprintf("Invalid body: %v", err))
+		return respError(c, http.StatusBadRequest, "Invalid body", fmt.Sprintf("Invalid body: %v", err), ProblemInvalidBody)
 	}
-	if err := validate.Struct(body); err != nil {
-		return respError(c, http.StatusBadRequest, "Invalid body", fmt.Sprintf("Invalid body: %v", err))
+
+	status, resp := h.updateUser(c.Request().Context(), body)
+	return respond(c, status, resp)
+}
+
+func (h *UserHttpHandler) updateUser(ctx context.Context, body HttpUserPut) (int, interface{}) {
+	if err := structValidator.Struct(body); err != nil {
+		return http.StatusBadRequest, newValidationError(err)
 	}
 
-	updatedUserID, err := h.controller.UpdateUser(body.UserID, body.UserName, body.FirstName, body.LastName, body.Email, body.UserStatus, pointerToString(body.Department))
+	updatedUserID, err := h.controller.UpdateUser(ctx, body.UserID, body.UserName, body.FirstName, body.LastName, body.Email, body.UserStatus, pointerToString(body.Department), body.ManagerID, body.Attributes)
 	if err != nil {
-		if err == controller.ErrUsernameCollision {
-			return respError(c, http.StatusBadRequest, "User already exists", fmt.Sprintf("User with username %s already exists", body.UserName))
+		var verr *controller.ValidationError
+		if errors.As(err, &verr) {
+			return http.StatusBadRequest, newControllerValidationError(verr)
+		} else if err == controller.ErrUsernameCollision {
+			return http.StatusBadRequest, newFieldError("User already exists", fmt.Sprintf("User with username %s already exists", body.UserName), ProblemUserAlreadyExists, usernameTaken)
 		} else if err == controller.ErrUserStatusIncorrect {
-			return respError(c, http.StatusBadRequest, "Incorrect Status", fmt.Sprintln("Accepted statuses are: Active, A, Inactive, I, Terminated, T"))
+			return http.StatusBadRequest, newFieldError("Incorrect Status", fmt.Sprintln("Accepted statuses are: Active, A, Inactive, I, Terminated, T"), ProblemInvalidUserStatus, incorrectStatus)
 		} else {
-			return respError(c, http.StatusInternalServerError, "Internal Server Error", fmt.Sprintf("Unexpected error trying to create user %s", body.UserName))
+			return http.StatusInternalServerError, newHttpError(http.StatusInternalServerError, "Internal Server Error", fmt.Sprintf("Unexpected error trying to create user %s", body.UserName), ProblemInternal)
 		}
 	}
 
-	return respSuccess(c, http.StatusOK, success, HttpUserPutResponse{UserID: updatedUserID})
-
+	return http.StatusOK, newHttpSuccess(http.StatusOK, success, HttpUserPutResponse{UserID: updatedUserID})
 }
 
 // @Summary		Deletes a user
@@ -202,6 +273,7 @@ func (h *UserHttpHandler) UpdateUser(c echo.Context) error {
 // @Tags			users
 // @Produce		json
 // @Param			user_id	path		int	true	"User ID"
+// @Param			Idempotency-Key	header	string	false	"Replays the original response when a request is retried with the same key"
 // @Success		200		{object}	HttpSuccess
 // @Failure		400		{object}	HttpError
 // @Failure		500		{object}	HttpError
@@ -210,27 +282,110 @@ func (h *UserHttpHandler) DeleteUser(c echo.Context) error {
 	userIdParam := c.Param("user_id")
 	user_id, err := strconv.Atoi(userIdParam)
 	if err != nil {
-		return respError(c, http.StatusBadRequest, "Invalid user_id", fmt.Sprintf("user_id %q is not a valid user_id as it is not a number", userIdParam))
+		return respError(c, http.StatusBadRequest, "Invalid user_id", fmt.Sprintf("user_id %q is not a valid user_id as it is not a number", userIdParam), ProblemInvalidUserID)
+	}
+
+	status, resp := h.deleteUser(c.Request().Context(), user_id)
+	return respond(c, status, resp)
+}
+
+func (h *UserHttpHandler) deleteUser(ctx context.Context, user_id int) (int, interface{}) {
+	err := h.controller.DeleteUser(ctx, user_id)
+	if err != nil {
+		return http.StatusNotFound, newHttpError(http.StatusNotFound, "User not found", fmt.Sprintf("Unexpected error trying to delete user %q", strconv.Itoa(user_id)), ProblemUserNotFound)
+	}
+
+	return http.StatusOK, newHttpSuccess(http.StatusOK, success)
+}
+
+// @Summary		Gets the direct reports of a user
+// @Description	Gets the users whose manager is the user, ordered by id
+// @ID				GetDirectReports
+// @Tags			users
+// @Produce		json
+// @Param			user_id	path		int	true	"User ID"
+// @Success		200		{object}	HttpSuccess{data=handler.HttpUserResponse[],code=int,message=string}
+// @Failure		400		{object}	HttpError
+// @Failure		404		{object}	HttpError
+// @Router			/users/{user_id}/reports [GET]
+func (h *UserHttpHandler) GetDirectReports(c echo.Context) error {
+	return h.hierarchy(c, h.controller.GetDirectReports)
+}
+
+// @Summary		Gets the management chain of a user
+// @Description	Gets the managers of the user, from its direct manager up to the top of the hierarchy
+// @ID				GetManagementChain
+// @Tags			users
+// @Produce		json
+// @Param			user_id	path		int	true	"User ID"
+// @Success		200		{object}	HttpSuccess{data=handler.HttpUserResponse[],code=int,message=string}
+// @Failure		400		{object}	HttpError
+// @Failure		404		{object}	HttpError
+// @Router			/users/{user_id}/chain [GET]
+func (h *UserHttpHandler) GetManagementChain(c echo.Context) error {
+	return h.hierarchy(c, h.controller.GetManagementChain)
+}
+
+// @Summary		Gets the subtree of a user
+// @Description	Gets every user reporting to the user directly or through other managers, ordered by depth then id
+// @ID				GetSubordinates
+// @Tags			users
+// @Produce		json
+// @Param			user_id	path		int	true	"User ID"
+// @Success		200		{object}	HttpSuccess{data=handler.HttpUserResponse[],code=int,message=string}
+// @Failure		400		{object}	HttpError
+// @Failure		404		{object}	HttpError
+// @Router			/users/{user_id}/subtree [GET]
+func (h *UserHttpHandler) GetSubordinates(c echo.Context) error {
+	return h.hierarchy(c, h.controller.GetSubordinates)
+}
+
+// hierarchy responds with the users query returns for the user of the path
+func (h *UserHttpHandler) hierarchy(c echo.Context, query func(ctx context.Context, user_id int) (*[]model.User, error)) error {
+	userIdParam := c.Param("user_id")
+	user_id, err := strconv.Atoi(userIdParam)
+	if err != nil {
+		return respError(c, http.StatusBadRequest, "Invalid user_id", fmt.Sprintf("user_id %q is not a valid user_id as it is not a number", userIdParam), ProblemInvalidUserID)
 	}
 
-	err = h.controller.DeleteUser(user_id)
+	users, err := query(c.Request().Context(), user_id)
 	if err != nil {
-		return respError(c, http.StatusNotFound, "User not found", fmt.Sprintf("Unexpected error trying to delete user %q", userIdParam))
+		return respError(c, http.StatusNotFound, "User not found", fmt.Sprintf("Unexpected error trying to get user %q: %s", userIdParam, err), ProblemUserNotFound)
 	}
 
-	return respSuccess(c, http.StatusOK, success)
+	response := []HttpUserResponse{}
+	for _, u := range *users {
+		response = append(response, NewHttpUserResponse(u))
+	}
+
+	return respSuccess(c, http.StatusOK, success, response)
 }
 
 func NewHttpUserResponse(user model.User) HttpUserResponse {
 	return HttpUserResponse{
-		UserID:     user.UserID,
-		UserName:   user.UserName,
-		FirstName:  user.FirstName,
-		LastName:   user.LastName,
-		Email:      user.Email,
-		UserStatus: user.UserStatus,
-		Department: nullStringToPointer(user.Department),
+		UserID:        user.UserID,
+		UserName:      user.UserName,
+		FirstName:     user.FirstName,
+		LastName:      user.LastName,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		UserStatus:    user.UserStatus,
+		Department:    nullStringToPointer(user.Department),
+		ManagerID:     nullInt64ToPointer(user.ManagerID),
+		Attributes:    user.Attributes,
+	}
+}
+
+// attributeFilters reads the attr.<name> query parameters, the first value of
+// each is used
+func attributeFilters(params url.Values) map[string]string {
+	filters := map[string]string{}
+	for key, values := range params {
+		if name, ok := strings.CutPrefix(key, attributeQueryPrefix); ok && len(values) > 0 {
+			filters[name] = values[0]
+		}
 	}
+	return filters
 }
 
 func pointerToString(dept *string) string {
@@ -248,3 +403,57 @@ func nullStringToPointer(dept sql.NullString) *string {
 
 	return nil
 }
+
+// UnmarshalJSON reads an explicit null manager_id as 0, which removes the
+// manager, while an omitted one keeps it
+func (u *HttpUserPut) UnmarshalJSON(data []byte) error {
+	type plain HttpUserPut
+	if err := json.Unmarshal(data, (*plain)(u)); err != nil {
+		return err
+	}
+	u.ManagerID = nullAsZero(data, "manager_id", u.ManagerID)
+	return nil
+}
+
+// UnmarshalJSON reads an explicit null manager_id as 0 like HttpUserPut
+func (u *HttpUserPatch) UnmarshalJSON(data []byte) error {
+	type plain HttpUserPatch
+	if err := json.Unmarshal(data, (*plain)(u)); err != nil {
+		return err
+	}
+	u.ManagerID = nullAsZero(data, "manager_id", u.ManagerID)
+	return nil
+}
+
+// nullAsZero returns a pointer to 0 when field is null in the JSON object
+// data, id otherwise
+func nullAsZero(data []byte, field string, id *int) *int {
+	if id != nil {
+		return id
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil
+	}
+	if raw, ok := fields[field]; ok && bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+		return new(int)
+	}
+	return nil
+}
+
+func pointerToInt(id *int) int {
+	if id == nil {
+		return 0
+	}
+
+	return *id
+}
+
+func nullInt64ToPointer(id sql.NullInt64) *int {
+	if id.Valid {
+		v := int(id.Int64)
+		return &v
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"users-backend/controller"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// structValidator reports fields by their json name so the field errors match
+// what the client sent
+var structValidator = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return f.Name
+		}
+		return name
+	})
+	return v
+}
+
+// newValidationError builds the 400 returned when body fails validation. The
+// legacy details keep the validator output, problem+json clients get one
+// entry per rejected field instead.
+func newValidationError(err error) HttpError {
+	e := newHttpError(http.StatusBadRequest, "Invalid body", fmt.Sprintf("Invalid body: %v", err), ProblemInvalidBody)
+
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return e
+	}
+
+	e.problemType = ProblemValidationFailed
+	for _, fe := range verrs {
+		e.fieldErrors = append(e.fieldErrors, HttpFieldError{
+			Field:   fieldPath(fe),
+			Rule:    fe.Tag(),
+			Message: fieldMessage(fe),
+		})
+	}
+
+	return e
+}
+
+// newControllerValidationError builds the 400 returned when the controller
+// rejects the user or tenant fields
+func newControllerValidationError(verr *controller.ValidationError) HttpError {
+	e := newHttpError(http.StatusBadRequest, "Invalid body", fmt.Sprintf("Invalid body: %v", verr), ProblemValidationFailed)
+	for _, f := range verr.Fields {
+		e.fieldErrors = append(e.fieldErrors, HttpFieldError(f))
+	}
+	return e
+}
+
+// newFieldError builds a 400 for a single field rejected outside of struct
+// validation, such as a username that is already taken
+func newFieldError(message, details, problemType string, field HttpFieldError) HttpError {
+	e := newHttpError(http.StatusBadRequest, message, details, problemType)
+	e.fieldErrors = []HttpFieldError{field}
+	return e
+}
+
+// fieldPath drops the struct name from the namespace, turning
+// HttpBatchRequest.operations[0].op into operations[0].op
+func fieldPath(fe validator.FieldError) string {
+	_, path, found := strings.Cut(fe.Namespace(), ".")
+	if !found {
+		return fe.Field()
+	}
+	return path
+}
+
+func fieldMessage(fe validator.FieldError) string {
+	unit := "characters"
+	if k := fe.Kind(); k == reflect.Slice || k == reflect.Array || k == reflect.Map {
+		unit = "items"
+	}
+
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "oneof":
+		return fmt.Sprintf("must be one of: %s", strings.ReplaceAll(fe.Param(), " ", ", "))
+	case "min":
+		return fmt.Sprintf("must be at least %s %s", fe.Param(), unit)
+	case "max":
+		return fmt.Sprintf("must be at most %s %s", fe.Param(), unit)
+	default:
+		return fmt.Sprintf("failed the %s rule", fe.Tag())
+	}
+}
@@ -0,0 +1,135 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+
+	shutdownCheck = "shutdown"
+)
+
+var ErrShuttingDown = errors.New("server is shutting down")
+
+type (
+	// Check returns nil when the dependency it covers is usable
+	Check func(ctx context.Context) error
+
+	CheckResult struct {
+		Status    string  `json:"status"`
+		Error     string  `json:"error,omitempty"`
+		LatencyMs float64 `json:"latency_ms"`
+	}
+
+	Report struct {
+		Status string                 `json:"status"`
+		Checks map[string]CheckResult `json:"checks,omitempty"`
+	}
+
+	namedCheck struct {
+		name  string
+		check Check
+	}
+
+	// Health tracks the readiness checks of the service. Liveness only means the
+	// process can serve requests, readiness additionally requires every check to
+	// pass and the server not to be shutting down.
+	Health struct {
+		mu           sync.RWMutex
+		checks       []namedCheck
+		timeout      time.Duration
+		shuttingDown atomic.Bool
+	}
+)
+
+// New returns a Health where each readiness check is given at most timeout to
+// complete
+func New(timeout time.Duration) *Health {
+	return &Health{timeout: timeout}
+}
+
+func (h *Health) AddReadinessCheck(name string, check Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.checks = append(h.checks, namedCheck{name: name, check: check})
+}
+
+// Shutdown makes every following readiness report fail so load balancers stop
+// routing new requests while in flight ones drain
+func (h *Health) Shutdown() {
+	h.shuttingDown.Store(true)
+}
+
+func (h *Health) Live() Report {
+	return Report{Status: StatusOK}
+}
+
+// Ready runs every readiness check concurrently and reports whether all passed
+func (h *Health) Ready(ctx context.Context) (Report, bool) {
+	h.mu.RLock()
+	checks := append([]namedCheck{}, h.checks...)
+	h.mu.RUnlock()
+
+	checks = append(checks, namedCheck{name: shutdownCheck, check: func(context.Context) error {
+		if h.shuttingDown.Load() {
+			return ErrShuttingDown
+		}
+		return nil
+	}})
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	report := Report{Status: StatusOK, Checks: make(map[string]CheckResult, len(checks))}
+
+	for _, c := range checks {
+		wg.Add(1)
+		go func(c namedCheck) {
+			defer wg.Done()
+
+			result := h.run(ctx, c.check)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[c.name] = result
+			if result.Status != StatusOK {
+				report.Status = StatusFail
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	return report, report.Status == StatusOK
+}
+
+func (h *Health) run(ctx context.Context, check Check) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	start := time.Now()
+	errc := make(chan error, 1)
+	go func() { errc <- check(ctx) }()
+
+	var err error
+	select {
+	case err = <-errc:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	result := CheckResult{Status: StatusOK, LatencyMs: float64(time.Since(start).Microseconds()) / 1000}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+
+	return result
+}
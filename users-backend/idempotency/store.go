@@ -0,0 +1,114 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+var (
+	_ Store = new(MemoryStore)
+)
+
+type (
+	// Response is the part of an HTTP response that is replayed on retries
+	Response struct {
+		Status      int
+		ContentType string
+		Body        []byte
+	}
+
+	// Record is what is stored against an idempotency key. Response is nil while
+	// the original request is still being processed.
+	Record struct {
+		Fingerprint string
+		Response    *Response
+		ExpiresAt   time.Time
+	}
+
+	// Store keeps idempotency records until they expire. Implementations must
+	// make Reserve atomic so that two concurrent requests with the same key
+	// cannot both be processed.
+	Store interface {
+		// Reserve claims key for a request with the given fingerprint. When the key
+		// is already known its record is returned and reserved is false.
+		Reserve(ctx context.Context, key, fingerprint string, ttl time.Duration) (rec *Record, reserved bool, err error)
+		// Complete stores the response of a reserved key
+		Complete(ctx context.Context, key string, resp Response) error
+		// Release forgets a reserved key so the request can be retried
+		Release(ctx context.Context, key string) error
+	}
+)
+
+const sweepInterval = time.Minute
+
+// MemoryStore is an in-process Store, records are lost on restart and are not
+// shared between replicas
+type MemoryStore struct {
+	mu        sync.Mutex
+	records   map[string]*Record
+	now       func() time.Time
+	nextSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		records: map[string]*Record{},
+		now:     time.Now,
+	}
+}
+
+func (s *MemoryStore) Reserve(ctx context.Context, key, fingerprint string, ttl time.Duration) (*Record, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	if rec, ok := s.records[key]; ok && now.Before(rec.ExpiresAt) {
+		copied := *rec
+		return &copied, false, nil
+	}
+
+	s.records[key] = &Record{
+		Fingerprint: fingerprint,
+		ExpiresAt:   now.Add(ttl),
+	}
+
+	return nil, true, nil
+}
+
+func (s *MemoryStore) Complete(ctx context.Context, key string, resp Response) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if rec, ok := s.records[key]; ok {
+		rec.Response = &resp
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, key)
+
+	return nil
+}
+
+// sweep drops expired records at most once per sweepInterval, must be called
+// with the lock held
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Before(s.nextSweep) {
+		return
+	}
+
+	for key, rec := range s.records {
+		if !now.Before(rec.ExpiresAt) {
+			delete(s.records, key)
+		}
+	}
+	s.nextSweep = now.Add(sweepInterval)
+}
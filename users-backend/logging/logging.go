@@ -0,0 +1,105 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+)
+
+type attrsKey struct{}
+
+var emailPattern = regexp.MustCompile(`([A-Za-z0-9._%+\-])[A-Za-z0-9._%+\-]*@([A-Za-z0-9.\-]+\.[A-Za-z]{2,})`)
+
+// New returns a JSON logger writing to w. Emails are masked in the message
+// and in every string or error attribute before they are written.
+func New(w io.Writer, level slog.Leveler) *slog.Logger {
+	h := slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redactAttr,
+	})
+
+	return slog.New(&redactHandler{Handler: h})
+}
+
+// NewFromEnv returns a JSON logger writing to stdout at the level set in
+// LOG_LEVEL (debug, info, warn or error), info when unset or invalid
+func NewFromEnv() *slog.Logger {
+	level := slog.LevelInfo
+	if err := level.UnmarshalText([]byte(os.Getenv("LOG_LEVEL"))); err != nil {
+		level = slog.LevelInfo
+	}
+
+	return New(os.Stdout, level)
+}
+
+// Discard returns a logger that drops every record, for tests
+func Discard() *slog.Logger {
+	return slog.New(slog.NewJSONHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError + 1}))
+}
+
+// RedactEmails masks every email address in s, keeping the first character
+// and the domain (johndoe@email.com becomes j***@email.com)
+func RedactEmails(s string) string {
+	if !strings.Contains(s, "@") {
+		return s
+	}
+	return emailPattern.ReplaceAllString(s, "$1***@$2")
+}
+
+func redactAttr(_ []string, a slog.Attr) slog.Attr {
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, RedactEmails(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, RedactEmails(err.Error()))
+		}
+	}
+	return a
+}
+
+// redactHandler masks emails in the record message, attributes are handled by
+// the ReplaceAttr hook of the wrapped handler
+type redactHandler struct {
+	slog.Handler
+}
+
+func (h *redactHandler) Handle(ctx context.Context, r slog.Record) error {
+	redacted := slog.NewRecord(r.Time, r.Level, RedactEmails(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		redacted.AddAttrs(a)
+		return true
+	})
+
+	return h.Handler.Handle(ctx, redacted)
+}
+
+func (h *redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &redactHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *redactHandler) WithGroup(name string) slog.Handler {
+	return &redactHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// WithAttrs returns a copy of ctx carrying request scoped attributes (such as
+// the request id) that FromContext adds to every logger
+func WithAttrs(ctx context.Context, args ...any) context.Context {
+	existing, _ := ctx.Value(attrsKey{}).([]any)
+	merged := make([]any, 0, len(existing)+len(args))
+	merged = append(merged, existing...)
+	merged = append(merged, args...)
+
+	return context.WithValue(ctx, attrsKey{}, merged)
+}
+
+// FromContext returns l with the request scoped attributes stored in ctx
+func FromContext(ctx context.Context, l *slog.Logger) *slog.Logger {
+	if attrs, ok := ctx.Value(attrsKey{}).([]any); ok && len(attrs) > 0 {
+		return l.With(attrs...)
+	}
+	return l
+}
@@ -0,0 +1,78 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+	"users-backend/logging"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Logging", func() {
+	var (
+		buf *bytes.Buffer
+		log *slog.Logger
+	)
+
+	lastLine := func() map[string]interface{} {
+		var line map[string]interface{}
+		lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+		json.Unmarshal(lines[len(lines)-1], &line)
+		return line
+	}
+
+	ginkgo.BeforeEach(func() {
+		buf = &bytes.Buffer{}
+		log = logging.New(buf, slog.LevelInfo)
+	})
+
+	ginkgo.Describe("RedactEmails", func() {
+		ginkgo.It("should keep the first character and the domain", func() {
+			gomega.Expect(logging.RedactEmails("sent to johndoe@email.com and x@y.org")).Should(gomega.Equal("sent to j***@email.com and x***@y.org"))
+		})
+
+		ginkgo.It("should leave other text untouched", func() {
+			gomega.Expect(logging.RedactEmails("user @johndoe")).Should(gomega.Equal("user @johndoe"))
+		})
+	})
+
+	ginkgo.Describe("New", func() {
+		ginkgo.It("should redact emails in messages, attributes and errors", func() {
+			log.With("email", "johndoe@email.com").Info("created johndoe@email.com", "error", errors.New("duplicate johndoe@email.com"))
+
+			line := lastLine()
+			gomega.Expect(line["msg"]).Should(gomega.Equal("created j***@email.com"))
+			gomega.Expect(line["email"]).Should(gomega.Equal("j***@email.com"))
+			gomega.Expect(line["error"]).Should(gomega.Equal("duplicate j***@email.com"))
+		})
+
+		ginkgo.It("should drop records below the configured level", func() {
+			log.Debug("hidden")
+
+			gomega.Expect(buf.Len()).Should(gomega.BeZero())
+		})
+	})
+
+	ginkgo.Describe("FromContext", func() {
+		ginkgo.It("should add the request scoped attributes", func() {
+			ctx := logging.WithAttrs(context.Background(), "request_id", "abc")
+			ctx = logging.WithAttrs(ctx, "user_id", 1)
+
+			logging.FromContext(ctx, log).Info("request")
+
+			line := lastLine()
+			gomega.Expect(line["request_id"]).Should(gomega.Equal("abc"))
+			gomega.Expect(line["user_id"]).Should(gomega.BeEquivalentTo(1))
+		})
+	})
+})
+
+func TestLogging(t *testing.T) {
+	gomega.RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "Logging Suite")
+}
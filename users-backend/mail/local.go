@@ -0,0 +1,69 @@
+package mail
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var (
+	_ Mailer = new(FileMailer)
+	_ Mailer = new(LogMailer)
+)
+
+// FileMailer writes every message to its own .eml file in a directory, for
+// development. The files can be opened with any mail client.
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+// NewFileMailer writes the messages sent from from in dir, creating it
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if _, err := Address(from); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	now := time.Now()
+	data, err := Format(m.from, msg, now)
+	if err != nil {
+		return err
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	// The name sorts the files in the order they were sent
+	name := fmt.Sprintf("%s-%s.eml", now.UTC().Format("20060102T150405.000000000Z"), hex.EncodeToString(suffix))
+	return os.WriteFile(filepath.Join(m.dir, name), data, 0o600)
+}
+
+// LogMailer logs every message instead of sending it, for development. The
+// body is logged, with the links and tokens it holds.
+type LogMailer struct {
+	log *slog.Logger
+}
+
+func NewLogMailer(log *slog.Logger) *LogMailer {
+	return &LogMailer{log: log.With("component", "mail")}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	if _, err := Address(msg.To); err != nil {
+		return err
+	}
+	m.log.InfoContext(ctx, "mail not sent, logged instead", "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+	return nil
+}
@@ -0,0 +1,92 @@
+// Package mail sends the messages mailed to users, like email verification
+// and password reset links. SMTPMailer delivers them, FileMailer and
+// LogMailer keep them local for development.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	netmail "net/mail"
+	"strings"
+	"time"
+)
+
+// ErrInvalidMessage is wrapped by the errors returned for messages that
+// cannot be sent as is, like a malformed recipient
+var ErrInvalidMessage = errors.New("invalid message")
+
+type (
+	// Message is a plain text message to a single recipient
+	Message struct {
+		To      string
+		Subject string
+		Body    string
+	}
+
+	// Mailer sends messages, Send returns once the message is handed over
+	Mailer interface {
+		Send(ctx context.Context, msg Message) error
+	}
+)
+
+// Format encodes msg from from as an RFC 5322 message with CRLF line endings,
+// the body is quoted-printable UTF-8
+func Format(from string, msg Message, now time.Time) ([]byte, error) {
+	sender, err := netmail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("%w: from %q: %w", ErrInvalidMessage, from, err)
+	}
+	to, err := netmail.ParseAddress(msg.To)
+	if err != nil {
+		return nil, fmt.Errorf("%w: to %q: %w", ErrInvalidMessage, msg.To, err)
+	}
+	if strings.ContainsAny(msg.Subject, "\r\n") {
+		return nil, fmt.Errorf("%w: subject spans several lines", ErrInvalidMessage)
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	_, domain, _ := strings.Cut(sender.Address, "@")
+
+	var b bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&b, "%s: %s\r\n", name, value)
+	}
+	header("From", sender.String())
+	header("To", to.String())
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", now.Format(time.RFC1123Z))
+	header("Message-ID", fmt.Sprintf("<%s@%s>", hex.EncodeToString(id), domain))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	b.WriteString("\r\n")
+
+	w := quotedprintable.NewWriter(&b)
+	body := strings.ReplaceAll(msg.Body, "\r\n", "\n")
+	if _, err := w.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// Address returns the bare address of a recipient or sender like
+// "Alice <alice@example.com>"
+func Address(s string) (string, error) {
+	a, err := netmail.ParseAddress(s)
+	if err != nil {
+		return "", fmt.Errorf("%w: address %q: %w", ErrInvalidMessage, s, err)
+	}
+	return a.Address, nil
+}
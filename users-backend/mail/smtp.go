@@ -0,0 +1,129 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/smtp"
+	"time"
+)
+
+var _ Mailer = new(SMTPMailer)
+
+// DefaultSMTPTimeout bounds a delivery when the context has no deadline
+const DefaultSMTPTimeout = 30 * time.Second
+
+// SMTPConfig is the server messages are relayed through
+type SMTPConfig struct {
+	// Addr is the host:port of the server
+	Addr string
+	// Username and Password authenticate with PLAIN when Username is set,
+	// which needs TLS unless the server is on localhost
+	Username string
+	Password string
+	// From is the sender of the messages, like "Users <no-reply@example.com>"
+	From string
+	// ImplicitTLS connects over TLS, usually on port 465. Otherwise the
+	// connection is upgraded with STARTTLS when the server offers it.
+	ImplicitTLS bool
+	// Timeout bounds a delivery when the context has no deadline,
+	// DefaultSMTPTimeout when zero
+	Timeout time.Duration
+}
+
+// SMTPMailer relays every message through an SMTP server on a new connection
+type SMTPMailer struct {
+	cfg  SMTPConfig
+	host string
+	from string
+}
+
+func NewSMTPMailer(cfg SMTPConfig) (*SMTPMailer, error) {
+	host, _, err := net.SplitHostPort(cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+	from, err := Address(cfg.From)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultSMTPTimeout
+	}
+	return &SMTPMailer{cfg: cfg, host: host, from: from}, nil
+}
+
+func (m *SMTPMailer) tlsConfig() *tls.Config {
+	return &tls.Config{ServerName: m.host, MinVersion: tls.VersionTLS12}
+}
+
+func (m *SMTPMailer) dial(ctx context.Context) (net.Conn, error) {
+	d := &net.Dialer{Timeout: m.cfg.Timeout}
+	if m.cfg.ImplicitTLS {
+		return (&tls.Dialer{NetDialer: d, Config: m.tlsConfig()}).DialContext(ctx, "tcp", m.cfg.Addr)
+	}
+	return d.DialContext(ctx, "tcp", m.cfg.Addr)
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	data, err := Format(m.cfg.From, msg, time.Now())
+	if err != nil {
+		return err
+	}
+	to, err := Address(msg.To)
+	if err != nil {
+		return err
+	}
+
+	conn, err := m.dial(ctx)
+	if err != nil {
+		return err
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(m.cfg.Timeout)
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return err
+	}
+
+	c, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	// Quit closes the connection once the message is accepted
+	defer c.Close()
+
+	if !m.cfg.ImplicitTLS {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(m.tlsConfig()); err != nil {
+				return err
+			}
+		}
+	}
+	if m.cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.host)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(m.from); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,68 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"strings"
+	"text/template"
+)
+
+// The messages mailed to users
+const (
+	TemplateVerifyEmail   = "verify_email"
+	TemplateResetPassword = "reset_password"
+)
+
+//go:embed templates/*.tmpl
+var defaultTemplates embed.FS
+
+// Templates renders messages from text/template files named <name>.tmpl. A
+// template starts with a "Subject: " line and a blank line, the rest is the
+// body.
+type Templates struct {
+	t *template.Template
+}
+
+// DefaultTemplates returns the templates embedded in the binary
+func DefaultTemplates() *Templates {
+	return &Templates{t: template.Must(template.ParseFS(defaultTemplates, "templates/*.tmpl"))}
+}
+
+// ParseTemplates reads the *.tmpl files of fsys over the default templates,
+// the messages without a file in fsys keep the default one
+func ParseTemplates(fsys fs.FS) (*Templates, error) {
+	t := DefaultTemplates()
+	matches, err := fs.Glob(fsys, "*.tmpl")
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return t, nil
+	}
+	if _, err := t.t.ParseFS(fsys, "*.tmpl"); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Render executes the template name with data and returns the message to to
+func (t *Templates) Render(name, to string, data any) (Message, error) {
+	var b bytes.Buffer
+	if err := t.t.ExecuteTemplate(&b, name+".tmpl", data); err != nil {
+		return Message{}, err
+	}
+
+	head, body, ok := strings.Cut(strings.ReplaceAll(b.String(), "\r\n", "\n"), "\n\n")
+	subject, found := strings.CutPrefix(head, "Subject: ")
+	if !ok || !found || strings.Contains(subject, "\n") {
+		return Message{}, fmt.Errorf("%w: template %s must start with a Subject line and a blank line", ErrInvalidMessage, name)
+	}
+
+	return Message{
+		To:      to,
+		Subject: strings.TrimSpace(subject),
+		Body:    body,
+	}, nil
+}
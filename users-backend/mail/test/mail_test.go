@@ -0,0 +1,223 @@
+package test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	netmail "net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+	"users-backend/mail"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+// parse reads a formatted message back
+func parse(data []byte) (*netmail.Message, string) {
+	msg, err := netmail.ReadMessage(strings.NewReader(string(data)))
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	body, err := io.ReadAll(quotedprintable.NewReader(msg.Body))
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	return msg, string(body)
+}
+
+// smtpServer accepts a single message without TLS nor authentication and
+// sends back the envelope and data it received
+func smtpServer() (addr string, received <-chan []string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	ginkgo.DeferCleanup(l.Close)
+
+	ch := make(chan []string, 1)
+	go func() {
+		defer ginkgo.GinkgoRecover()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var lines []string
+		r := bufio.NewReader(conn)
+		reply := func(s string) { _, _ = io.WriteString(conn, s+"\r\n") }
+		reply("220 localhost ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				ch <- lines
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			switch cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); cmd {
+			case "EHLO", "HELO":
+				reply("250 localhost")
+			case "MAIL", "RCPT":
+				lines = append(lines, line)
+				reply("250 OK")
+			case "DATA":
+				reply("354 go ahead")
+				for {
+					data, err := r.ReadString('\n')
+					if err != nil || data == ".\r\n" {
+						break
+					}
+					lines = append(lines, strings.TrimRight(data, "\r\n"))
+				}
+				reply("250 queued")
+			case "QUIT":
+				reply("221 bye")
+				ch <- lines
+				return
+			default:
+				reply("502 not implemented")
+			}
+		}
+	}()
+	return l.Addr().String(), ch
+}
+
+var _ = ginkgo.Describe("Format", func() {
+	ginkgo.It("should encode the headers and the body", func() {
+		now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+		data, err := mail.Format("Users <no-reply@example.com>", mail.Message{
+			To:      "Zoë <zoe@example.com>",
+			Subject: "Vérifiez votre adresse",
+			Body:    "Bonjour Zoë,\n\nhttps://example.com/verify-email?token=" + strings.Repeat("x", 80) + "\n",
+		}, now)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(string(data)).Should(gomega.ContainSubstring("\r\nContent-Type: text/plain; charset=utf-8\r\n"))
+
+		msg, body := parse(data)
+		gomega.Expect(msg.Header.Get("From")).Should(gomega.Equal(`"Users" <no-reply@example.com>`))
+		to, err := msg.Header.AddressList("To")
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(to[0].Name).Should(gomega.Equal("Zoë"))
+		subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(subject).Should(gomega.Equal("Vérifiez votre adresse"))
+		date, err := msg.Header.Date()
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(date.Equal(now)).Should(gomega.BeTrue())
+		gomega.Expect(msg.Header.Get("Message-ID")).Should(gomega.HaveSuffix("@example.com>"))
+		gomega.Expect(body).Should(gomega.Equal("Bonjour Zoë,\r\n\r\nhttps://example.com/verify-email?token=" + strings.Repeat("x", 80) + "\r\n"))
+	})
+
+	ginkgo.It("should refuse malformed recipients and injected headers", func() {
+		for _, msg := range []mail.Message{
+			{To: "not an address", Subject: "Hello"},
+			{To: "alice@example.com\r\nBcc: eve@example.com", Subject: "Hello"},
+			{To: "alice@example.com", Subject: "Hello\r\nBcc: eve@example.com"},
+		} {
+			_, err := mail.Format("no-reply@example.com", msg, time.Now())
+			gomega.Expect(errors.Is(err, mail.ErrInvalidMessage)).Should(gomega.BeTrue(), "%q got %v", msg.To, err)
+		}
+	})
+})
+
+var _ = ginkgo.Describe("Mailers", func() {
+	msg := mail.Message{To: "alice@example.com", Subject: "Hello", Body: "Hello Alice\n"}
+
+	ginkgo.It("should write every message to its own file", func() {
+		dir := filepath.Join(ginkgo.GinkgoT().TempDir(), "mail")
+		m, err := mail.NewFileMailer(dir, "no-reply@example.com")
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+		gomega.Expect(m.Send(context.Background(), msg)).Should(gomega.Succeed())
+		gomega.Expect(m.Send(context.Background(), msg)).Should(gomega.Succeed())
+
+		files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(files).Should(gomega.HaveLen(2))
+		data, err := os.ReadFile(files[0])
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		parsed, body := parse(data)
+		gomega.Expect(parsed.Header.Get("To")).Should(gomega.Equal("<alice@example.com>"))
+		gomega.Expect(body).Should(gomega.Equal("Hello Alice\r\n"))
+	})
+
+	ginkgo.It("should relay messages through an SMTP server", func() {
+		addr, received := smtpServer()
+		m, err := mail.NewSMTPMailer(mail.SMTPConfig{Addr: addr, From: "Users <no-reply@example.com>"})
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+		gomega.Expect(m.Send(context.Background(), msg)).Should(gomega.Succeed())
+
+		var lines []string
+		gomega.Eventually(received).Should(gomega.Receive(&lines))
+		gomega.Expect(lines[0]).Should(gomega.HavePrefix("MAIL FROM:<no-reply@example.com>"))
+		gomega.Expect(lines[1]).Should(gomega.Equal("RCPT TO:<alice@example.com>"))
+		gomega.Expect(lines).Should(gomega.ContainElements("Subject: Hello", "Hello Alice"))
+	})
+
+	ginkgo.It("should validate the SMTP settings", func() {
+		_, err := mail.NewSMTPMailer(mail.SMTPConfig{Addr: "localhost", From: "no-reply@example.com"})
+		gomega.Expect(err).Should(gomega.HaveOccurred())
+		_, err = mail.NewSMTPMailer(mail.SMTPConfig{Addr: "localhost:25", From: "nobody"})
+		gomega.Expect(errors.Is(err, mail.ErrInvalidMessage)).Should(gomega.BeTrue(), "got %v", err)
+	})
+})
+
+var _ = ginkgo.Describe("Templates", func() {
+	type data struct {
+		User      struct{ FirstName, UserName, Email string }
+		Link      string
+		ExpiresAt time.Time
+	}
+	d := data{Link: "https://example.com/reset-password?token=abc", ExpiresAt: time.Date(2024, 5, 1, 13, 0, 0, 0, time.UTC)}
+	d.User.FirstName, d.User.UserName, d.User.Email = "Alice", "alice", "alice@example.com"
+
+	ginkgo.It("should render the default messages", func() {
+		msg, err := mail.DefaultTemplates().Render(mail.TemplateResetPassword, "alice@example.com", d)
+
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(msg.To).Should(gomega.Equal("alice@example.com"))
+		gomega.Expect(msg.Subject).Should(gomega.Equal("Reset your password"))
+		gomega.Expect(msg.Body).Should(gomega.HavePrefix("Hello Alice,\n"))
+		gomega.Expect(msg.Body).Should(gomega.ContainSubstring(d.Link))
+		gomega.Expect(msg.Body).Should(gomega.ContainSubstring("2024-05-01 13:00 UTC"))
+
+		msg, err = mail.DefaultTemplates().Render(mail.TemplateVerifyEmail, "alice@example.com", d)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(msg.Subject).Should(gomega.Equal("Verify your email address"))
+	})
+
+	ginkgo.It("should replace the templates found in a directory", func() {
+		t, err := mail.ParseTemplates(fstest.MapFS{
+			"reset_password.tmpl": {Data: []byte("Subject: Nouveau mot de passe\n\nBonjour {{.User.FirstName}}, {{.Link}}\n")},
+		})
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+		msg, err := t.Render(mail.TemplateResetPassword, "alice@example.com", d)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(msg.Subject).Should(gomega.Equal("Nouveau mot de passe"))
+		gomega.Expect(msg.Body).Should(gomega.Equal("Bonjour Alice, " + d.Link + "\n"))
+
+		msg, err = t.Render(mail.TemplateVerifyEmail, "alice@example.com", d)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(msg.Subject).Should(gomega.Equal("Verify your email address"))
+	})
+
+	ginkgo.It("should refuse templates without a subject", func() {
+		t, err := mail.ParseTemplates(fstest.MapFS{
+			"verify_email.tmpl": {Data: []byte("Hello {{.User.FirstName}}\n")},
+		})
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+		_, err = t.Render(mail.TemplateVerifyEmail, "alice@example.com", d)
+		gomega.Expect(errors.Is(err, mail.ErrInvalidMessage)).Should(gomega.BeTrue(), "got %v", err)
+	})
+})
+
+func TestMail(t *testing.T) {
+	gomega.RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "Mail Suite")
+}
@@ -0,0 +1,76 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// AttributeType is the type of the values of a custom attribute
+type AttributeType string
+
+const (
+	AttributeString AttributeType = "string"
+	AttributeNumber AttributeType = "number"
+	// AttributeDate values are YYYY-MM-DD strings
+	AttributeDate AttributeType = "date"
+	// AttributeEnum values are one of the EnumValues of the definition
+	AttributeEnum AttributeType = "enum"
+)
+
+type (
+	// AttributeDefinition is a custom user attribute defined by the admins of a
+	// tenant, names are unique within a tenant
+	AttributeDefinition struct {
+		AttributeID int `pg:",pk"`
+		TenantID    int
+		Name        string `pg:"type:varchar(63)"`
+		Type        AttributeType
+		Required    bool     `pg:",use_zero"`
+		Unique      bool     `pg:",use_zero"`
+		EnumValues  []string `pg:",array"`
+	}
+
+	// Attributes are the custom attribute values of a user by name. Strings,
+	// dates and enums are stored as strings and numbers as float64. A user
+	// without attributes has nil Attributes.
+	Attributes map[string]interface{}
+)
+
+// Value stores the attributes as a JSON object
+func (a Attributes) Value() (driver.Value, error) {
+	if a == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(map[string]interface{}(a))
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan reads the attributes from a JSON object, an empty object gives nil
+func (a *Attributes) Scan(src interface{}) error {
+	var b []byte
+	switch v := src.(type) {
+	case nil:
+		*a = nil
+		return nil
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		return fmt.Errorf("cannot scan %T into Attributes", src)
+	}
+
+	m := map[string]interface{}{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	if len(m) == 0 {
+		m = nil
+	}
+	*a = m
+	return nil
+}
@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+type (
+	// Credential is the local password of a user, users without one cannot
+	// log in with a password
+	Credential struct {
+		tableName struct{} `pg:"user_credentials"`
+
+		UserID   int `pg:",pk"`
+		TenantID int
+		// PasswordHash is the encoded hash of the password, it names the
+		// algorithm and its parameters
+		PasswordHash string
+		// FailedAttempts counts the failed logins since the last successful
+		// one or the last lockout
+		FailedAttempts int `pg:",use_zero"`
+		// LockedUntil refuses logins until then, zero when not locked
+		LockedUntil time.Time
+		UpdatedAt   time.Time
+	}
+)
@@ -0,0 +1,17 @@
+package model
+
+import "database/sql"
+
+type (
+	// Group is a team or distribution list of a tenant, names are unique
+	// within a tenant. A group nested in a parent group passes its members on
+	// to the parent.
+	Group struct {
+		GroupID     int `pg:",pk"`
+		TenantID    int
+		Name        string `pg:"type:varchar(255)"`
+		Description string `pg:",use_zero"`
+		// ParentID is the group this group is nested in, in the same tenant
+		ParentID sql.NullInt64
+	}
+)
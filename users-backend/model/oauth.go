@@ -0,0 +1,67 @@
+package model
+
+import "time"
+
+type (
+	// OAuthClient is an application logging the users of a tenant in through
+	// the OpenID Connect provider. Client ids are unique across tenants.
+	OAuthClient struct {
+		tableName struct{} `pg:"oauth_clients"`
+
+		ClientID string `pg:",pk"`
+		TenantID int
+		Name     string
+		// SecretHash is the SHA-256 of the client secret, hex encoded. It is
+		// empty for public clients, which can not keep a secret and rely on
+		// PKCE alone.
+		SecretHash string
+		// RedirectURIs are the only URIs the codes are sent back to, they
+		// must match exactly
+		RedirectURIs []string `pg:",array"`
+		CreatedAt    time.Time
+	}
+
+	// AuthorizationCode is a single use code issued to a client for a user,
+	// only the hash of the code is stored
+	AuthorizationCode struct {
+		tableName struct{} `pg:"oauth_authorization_codes"`
+
+		CodeID   int `pg:",pk"`
+		ClientID string
+		UserID   int
+		TenantID int
+		// CodeHash is the SHA-256 of the code, hex encoded
+		CodeHash string
+		// RedirectURI must be sent again with the code
+		RedirectURI string
+		// Scope is the space separated list of granted scopes
+		Scope string
+		// Nonce is copied into the ID token, it may be empty
+		Nonce string `pg:",use_zero"`
+		// CodeChallenge is the S256 PKCE challenge the code verifier must
+		// match
+		CodeChallenge string
+		// AuthTime is when the user entered their password
+		AuthTime  time.Time
+		ExpiresAt time.Time
+		// UsedAt is when the code was exchanged, zero while unused
+		UsedAt    time.Time
+		CreatedAt time.Time
+	}
+)
+
+// Public reports whether the client has no secret
+func (c *OAuthClient) Public() bool {
+	return c.SecretHash == ""
+}
+
+// AllowsRedirectURI reports whether uri is one of the redirect URIs of the
+// client
+func (c *OAuthClient) AllowsRedirectURI(uri string) bool {
+	for _, allowed := range c.RedirectURIs {
+		if uri == allowed {
+			return true
+		}
+	}
+	return false
+}
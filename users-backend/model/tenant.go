@@ -0,0 +1,18 @@
+package model
+
+type (
+	// Tenant is an organization with its own users, user names are unique
+	// within a tenant
+	Tenant struct {
+		TenantID int    `pg:",pk"`
+		Slug     string `pg:"type:varchar(63),unique"`
+		Name     string
+	}
+)
+
+// The default tenant is created by the migrations and owns the users created
+// before tenants were introduced
+const (
+	DefaultTenantID   = 1
+	DefaultTenantSlug = "default"
+)
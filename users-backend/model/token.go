@@ -0,0 +1,32 @@
+package model
+
+import "time"
+
+const (
+	// TokenVerifyEmail tokens verify the email they were sent to
+	TokenVerifyEmail = "verify_email"
+	// TokenResetPassword tokens let the user set a new password
+	TokenResetPassword = "reset_password"
+)
+
+type (
+	// UserToken is a single use token mailed to a user, only the hash of
+	// its value is stored
+	UserToken struct {
+		tableName struct{} `pg:"user_tokens"`
+
+		TokenID  int `pg:",pk"`
+		TenantID int
+		UserID   int
+		// Purpose is TokenVerifyEmail or TokenResetPassword
+		Purpose string
+		// TokenHash is the SHA-256 of the token, hex encoded
+		TokenHash string
+		// Email is the address the token was sent to
+		Email     string
+		ExpiresAt time.Time
+		// UsedAt is when the token was consumed, zero while unused
+		UsedAt    time.Time
+		CreatedAt time.Time
+	}
+)
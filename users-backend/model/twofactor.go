@@ -0,0 +1,42 @@
+package model
+
+import "time"
+
+type (
+	// TwoFactor is the TOTP second factor of a user, it is only asked at
+	// login once confirmed
+	TwoFactor struct {
+		tableName struct{} `pg:"user_two_factor"`
+
+		UserID   int `pg:",pk"`
+		TenantID int
+		// Secret is the encrypted TOTP secret
+		Secret string
+		// ConfirmedAt is when the user proved the enrollment with a code,
+		// zero until then
+		ConfirmedAt time.Time
+		// LastStep is the time step of the last accepted code, codes of
+		// earlier or the same steps are refused
+		LastStep  int64 `pg:",use_zero"`
+		CreatedAt time.Time
+	}
+
+	// RecoveryCode is a one time code logging a user in without the second
+	// factor, only the hash of the code is stored
+	RecoveryCode struct {
+		tableName struct{} `pg:"user_recovery_codes"`
+
+		CodeID   int `pg:",pk"`
+		UserID   int
+		TenantID int
+		// CodeHash is the SHA-256 of the code, hex encoded
+		CodeHash string
+		// UsedAt is zero while the code is unused
+		UsedAt time.Time
+	}
+)
+
+// Confirmed reports whether the factor is asked at login
+func (t *TwoFactor) Confirmed() bool {
+	return !t.ConfirmedAt.IsZero()
+}
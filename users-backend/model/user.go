@@ -6,13 +6,20 @@ import (
 
 type (
 	User struct {
-		UserID     int    `pg:",pk"`
-		UserName   string `pg:"type:varchar(50),unique"`
-		FirstName  string
-		LastName   string
-		Email      string
-		UserStatus string `pg:"type:varchar(1)"`
-		Department sql.NullString
+		UserID    int `pg:",pk"`
+		TenantID  int
+		UserName  string `pg:"type:varchar(50)"`
+		FirstName string
+		LastName  string
+		Email     string
+		// EmailVerified is set once the user followed a verification link
+		// mailed to Email, changing Email clears it
+		EmailVerified bool   `pg:",use_zero"`
+		UserStatus    string `pg:"type:varchar(1)"`
+		Department    sql.NullString
+		Attributes    Attributes `pg:"type:jsonb,use_zero"`
+		// ManagerID is the user this user reports to, in the same tenant
+		ManagerID sql.NullInt64
 	}
 )
 
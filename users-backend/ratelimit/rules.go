@@ -0,0 +1,109 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidRule = errors.New("invalid rate limit rule")
+
+// Rule applies Limit to the requests matching Method and Path, "*" matches
+// any method or route. Path is the route template, e.g. /api/v1/users/:user_id.
+type Rule struct {
+	Method string
+	Path   string
+	Limit  Limit
+	// Policy describes the limit for the RateLimit-Policy header, e.g. 30;w=60
+	Policy string
+}
+
+// Matches reports whether r applies to a request for route with method
+func (r Rule) Matches(method, route string) bool {
+	return (r.Method == "*" || r.Method == method) && (r.Path == "*" || r.Path == route)
+}
+
+// Match returns the index of the first rule matching the request, -1 when none
+// does
+func Match(rules []Rule, method, route string) int {
+	for i, r := range rules {
+		if r.Matches(method, route) {
+			return i
+		}
+	}
+	return -1
+}
+
+var units = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+}
+
+// ParseRules parses rules separated by ";", each written as
+// [METHOD ]PATH=COUNT/UNIT[:BURST] where UNIT is s, m or h:
+//
+//	GET /api/v1/users=30/m:10; *=600/m:100
+//
+// allows 30 listings a minute in bursts of 10 and 600 requests a minute to any
+// other route. BURST defaults to COUNT.
+func ParseRules(s string) ([]Rule, error) {
+	var rules []Rule
+	for _, entry := range strings.Split(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		rule, err := parseRule(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%w %q: %w", ErrInvalidRule, entry, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func parseRule(entry string) (Rule, error) {
+	target, limit, ok := strings.Cut(entry, "=")
+	if !ok {
+		return Rule{}, errors.New("missing =")
+	}
+
+	rule := Rule{Method: "*"}
+	fields := strings.Fields(target)
+	switch len(fields) {
+	case 1:
+		rule.Path = fields[0]
+	case 2:
+		rule.Method, rule.Path = strings.ToUpper(fields[0]), fields[1]
+	default:
+		return Rule{}, errors.New("expected [METHOD ]PATH before =")
+	}
+
+	rate, burst, hasBurst := strings.Cut(strings.TrimSpace(limit), ":")
+	countStr, unit, ok := strings.Cut(rate, "/")
+	if !ok {
+		return Rule{}, errors.New("expected COUNT/UNIT")
+	}
+	count, err := strconv.Atoi(countStr)
+	if err != nil || count < 1 {
+		return Rule{}, fmt.Errorf("invalid count %q", countStr)
+	}
+	window, ok := units[unit]
+	if !ok {
+		return Rule{}, fmt.Errorf("invalid unit %q, expected s, m or h", unit)
+	}
+
+	rule.Limit = Limit{Rate: float64(count) / window.Seconds(), Burst: count}
+	if hasBurst {
+		if rule.Limit.Burst, err = strconv.Atoi(burst); err != nil || rule.Limit.Burst < 1 {
+			return Rule{}, fmt.Errorf("invalid burst %q", burst)
+		}
+	}
+	rule.Policy = fmt.Sprintf("%d;w=%d", count, int(window.Seconds()))
+
+	return rule, nil
+}
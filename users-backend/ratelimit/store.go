@@ -0,0 +1,121 @@
+// Package ratelimit limits requests per client with token buckets
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+var (
+	_ Store = new(MemoryStore)
+)
+
+type (
+	// Limit is a token bucket refilled with Rate tokens per second up to Burst
+	// tokens, every request takes one token
+	Limit struct {
+		Rate  float64
+		Burst int
+	}
+
+	// Result is the state of a bucket after a request took a token from it
+	Result struct {
+		Allowed   bool
+		Limit     int
+		Remaining int
+		// Reset is how long until the bucket is full again
+		Reset time.Duration
+		// RetryAfter is how long until the next token, zero when allowed
+		RetryAfter time.Duration
+	}
+
+	// Store keeps a token bucket per key. Implementations must make Take atomic
+	// so concurrent requests can not spend the same token.
+	Store interface {
+		Take(ctx context.Context, key string, limit Limit) (Result, error)
+	}
+)
+
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time
+}
+
+// MemoryStore is an in-process Store, buckets are not shared between replicas
+// so each replica enforces the limit on its own
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	now       func() time.Time
+	nextSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: map[string]*bucket{},
+		now:     time.Now,
+	}
+}
+
+// NewMemoryStoreWithClock returns a MemoryStore reading the time from now, for
+// tests
+func NewMemoryStoreWithClock(now func() time.Time) *MemoryStore {
+	s := NewMemoryStore()
+	s.now = now
+	return s
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	burst := float64(limit.Burst)
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, updated: now}
+		s.buckets[key] = b
+	}
+
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.updated).Seconds()*limit.Rate)
+	b.updated = now
+
+	res := Result{Limit: limit.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - b.tokens) / limit.Rate)
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = seconds((burst - b.tokens) / limit.Rate)
+	b.full = now.Add(res.Reset)
+
+	return res, nil
+}
+
+// sweep drops the buckets that have refilled, they are the same as a new one.
+// Must be called with the lock held.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Before(s.nextSweep) {
+		return
+	}
+
+	for key, b := range s.buckets {
+		if !now.Before(b.full) {
+			delete(s.buckets, key)
+		}
+	}
+	s.nextSweep = now.Add(sweepInterval)
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,287 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+	"users-backend/model"
+	"users-backend/repo"
+	"users-backend/tenant"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	_ repo.UserRepo = new(CacheRepo)
+
+	lookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "users",
+		Subsystem: "cache",
+		Name:      "lookups_total",
+		Help:      "Number of cached UserRepo lookups by method and result (hit or miss).",
+	}, []string{"method", "result"})
+
+	storeErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "users",
+		Subsystem: "cache",
+		Name:      "errors_total",
+		Help:      "Number of failed cache store calls by operation, failed reads are served from the repo.",
+	}, []string{"operation"})
+)
+
+// CacheRepo wraps another UserRepo and serves GetById and GetByUsername from a
+// Store. Entries are dropped when the user is created, updated or deleted
+// through this repo, writes made elsewhere are only picked up after the ttl.
+//
+// Inside RunInTx lookups bypass the cache, as they can see uncommitted rows,
+// and the written users are dropped again once the transaction ends.
+type CacheRepo struct {
+	repo  repo.UserRepo
+	store Store
+	ttl   time.Duration
+}
+
+// pending collects the keys written in a transaction
+type pending struct {
+	mu   sync.Mutex
+	keys []string
+}
+
+type pendingKey struct{}
+
+func NewCacheRepo(r repo.UserRepo, store Store, ttl time.Duration) *CacheRepo {
+	return &CacheRepo{
+		repo:  r,
+		store: store,
+		ttl:   ttl,
+	}
+}
+
+// Keys carry the tenant so a user is never served to another tenant
+
+func idKey(tenant_id, user_id int) string {
+	return fmt.Sprintf("user:%d:id:%d", tenant_id, user_id)
+}
+
+// nameKey maps a username to the user id, it is checked against the cached
+// user so a stale mapping left by a rename is a miss
+func nameKey(tenant_id int, userName string) string {
+	return fmt.Sprintf("user:%d:name:%s", tenant_id, userName)
+}
+
+func inTx(ctx context.Context) bool {
+	_, ok := ctx.Value(pendingKey{}).(*pending)
+	return ok
+}
+
+func recordLookup(method string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	lookups.WithLabelValues(method, result).Inc()
+}
+
+func (r *CacheRepo) get(ctx context.Context, tenant_id, user_id int) (*model.User, bool) {
+	b, found, err := r.store.Get(ctx, idKey(tenant_id, user_id))
+	if err != nil {
+		storeErrors.WithLabelValues("get").Inc()
+		return nil, false
+	}
+	if !found {
+		return nil, false
+	}
+
+	var user model.User
+	if err := json.Unmarshal(b, &user); err != nil {
+		storeErrors.WithLabelValues("decode").Inc()
+		return nil, false
+	}
+	return &user, true
+}
+
+func (r *CacheRepo) set(ctx context.Context, user *model.User) {
+	b, err := json.Marshal(user)
+	if err != nil {
+		storeErrors.WithLabelValues("encode").Inc()
+		return
+	}
+
+	if err := r.store.Set(ctx, idKey(user.TenantID, user.UserID), b, r.ttl); err != nil {
+		storeErrors.WithLabelValues("set").Inc()
+		return
+	}
+	if err := r.store.Set(ctx, nameKey(user.TenantID, user.UserName), []byte(strconv.Itoa(user.UserID)), r.ttl); err != nil {
+		storeErrors.WithLabelValues("set").Inc()
+	}
+}
+
+// invalidate drops keys now and, inside a transaction, again when it ends so
+// that reads made before the commit are not kept
+func (r *CacheRepo) invalidate(ctx context.Context, keys ...string) {
+	if err := r.store.Delete(ctx, keys...); err != nil {
+		storeErrors.WithLabelValues("delete").Inc()
+	}
+
+	if p, ok := ctx.Value(pendingKey{}).(*pending); ok {
+		p.mu.Lock()
+		p.keys = append(p.keys, keys...)
+		p.mu.Unlock()
+	}
+}
+
+func (r *CacheRepo) GetById(ctx context.Context, user_id int) (*model.User, error) {
+	tenant_id, ok := tenant.ID(ctx)
+	if !ok || inTx(ctx) {
+		return r.repo.GetById(ctx, user_id)
+	}
+
+	if user, ok := r.get(ctx, tenant_id, user_id); ok {
+		recordLookup("GetById", true)
+		return user, nil
+	}
+	recordLookup("GetById", false)
+
+	user, err := r.repo.GetById(ctx, user_id)
+	if err != nil {
+		return nil, err
+	}
+
+	r.set(ctx, user)
+	return user, nil
+}
+
+func (r *CacheRepo) GetByUsername(ctx context.Context, userName string) (*model.User, error) {
+	tenant_id, ok := tenant.ID(ctx)
+	if !ok || inTx(ctx) {
+		return r.repo.GetByUsername(ctx, userName)
+	}
+
+	if b, found, err := r.store.Get(ctx, nameKey(tenant_id, userName)); err != nil {
+		storeErrors.WithLabelValues("get").Inc()
+	} else if found {
+		if id, err := strconv.Atoi(string(b)); err == nil {
+			if user, ok := r.get(ctx, tenant_id, id); ok && user.UserName == userName {
+				recordLookup("GetByUsername", true)
+				return user, nil
+			}
+		}
+	}
+	recordLookup("GetByUsername", false)
+
+	user, err := r.repo.GetByUsername(ctx, userName)
+	if err != nil {
+		return nil, err
+	}
+
+	r.set(ctx, user)
+	return user, nil
+}
+
+// GetAll is not cached, listings change with every write
+func (r *CacheRepo) GetAll(ctx context.Context) (*[]model.User, error) {
+	return r.repo.GetAll(ctx)
+}
+
+func (r *CacheRepo) FindByAttributes(ctx context.Context, attributes model.Attributes) (*[]model.User, error) {
+	return r.repo.FindByAttributes(ctx, attributes)
+}
+
+func (r *CacheRepo) Create(ctx context.Context, user *model.User) (int, error) {
+	id, err := r.repo.Create(ctx, user)
+	if err != nil {
+		return id, err
+	}
+
+	r.invalidate(ctx, idKey(user.TenantID, id), nameKey(user.TenantID, user.UserName))
+	return id, nil
+}
+
+func (r *CacheRepo) Update(ctx context.Context, user *model.User) (int, error) {
+	tenant_id, ok := tenant.ID(ctx)
+	if !ok {
+		return r.repo.Update(ctx, user)
+	}
+
+	// Drop the entry even when the update fails, the row may have changed
+	defer r.invalidate(ctx, idKey(tenant_id, user.UserID), nameKey(tenant_id, user.UserName))
+
+	return r.repo.Update(ctx, user)
+}
+
+func (r *CacheRepo) Delete(ctx context.Context, user_id int) error {
+	tenant_id, ok := tenant.ID(ctx)
+	if !ok {
+		return r.repo.Delete(ctx, user_id)
+	}
+
+	defer r.invalidate(ctx, idKey(tenant_id, user_id))
+
+	return r.repo.Delete(ctx, user_id)
+}
+
+// The hierarchy queries are not cached, like the listings
+
+func (r *CacheRepo) GetDirectReports(ctx context.Context, manager_id int) (*[]model.User, error) {
+	return r.repo.GetDirectReports(ctx, manager_id)
+}
+
+func (r *CacheRepo) GetManagementChain(ctx context.Context, user_id int) (*[]model.User, error) {
+	return r.repo.GetManagementChain(ctx, user_id)
+}
+
+func (r *CacheRepo) GetSubordinates(ctx context.Context, manager_id int) (*[]model.User, error) {
+	return r.repo.GetSubordinates(ctx, manager_id)
+}
+
+// ReassignReports drops the cached reports, which are looked up first as the
+// update does not tell which users it moved
+func (r *CacheRepo) ReassignReports(ctx context.Context, from_manager_id, to_manager_id int) (int, error) {
+	tenant_id, ok := tenant.ID(ctx)
+	if !ok {
+		return r.repo.ReassignReports(ctx, from_manager_id, to_manager_id)
+	}
+
+	reports, err := r.repo.GetDirectReports(ctx, from_manager_id)
+	if err != nil {
+		return 0, err
+	}
+	keys := []string{}
+	for _, u := range *reports {
+		keys = append(keys, idKey(tenant_id, u.UserID))
+	}
+	if len(keys) > 0 {
+		defer r.invalidate(ctx, keys...)
+	}
+
+	return r.repo.ReassignReports(ctx, from_manager_id, to_manager_id)
+}
+
+func (r *CacheRepo) LockHierarchy(ctx context.Context) error {
+	return r.repo.LockHierarchy(ctx)
+}
+
+func (r *CacheRepo) LockAttribute(ctx context.Context, name string) error {
+	return r.repo.LockAttribute(ctx, name)
+}
+
+func (r *CacheRepo) RunInTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if inTx(ctx) {
+		return r.repo.RunInTx(ctx, fn)
+	}
+
+	p := &pending{}
+	err := r.repo.RunInTx(context.WithValue(ctx, pendingKey{}, p), fn)
+
+	if len(p.keys) > 0 {
+		if err := r.store.Delete(ctx, p.keys...); err != nil {
+			storeErrors.WithLabelValues("delete").Inc()
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"context"
+	"users-backend/repo"
+	"users-backend/tenant"
+)
+
+var (
+	_ repo.UserTokenRepo = new(TokenRepo)
+	_ repo.AttributeRepo = new(AttributeRepo)
+)
+
+// TokenRepo wraps a UserTokenRepo writing to the users cached by a CacheRepo,
+// and drops the user whose email it verifies
+type TokenRepo struct {
+	repo.UserTokenRepo
+	users *CacheRepo
+}
+
+func NewTokenRepo(r repo.UserTokenRepo, users *CacheRepo) *TokenRepo {
+	return &TokenRepo{
+		UserTokenRepo: r,
+		users:         users,
+	}
+}
+
+func (r *TokenRepo) MarkEmailVerified(ctx context.Context, user_id int, email string) (bool, error) {
+	tenant_id, ok := tenant.ID(ctx)
+	if !ok {
+		return r.UserTokenRepo.MarkEmailVerified(ctx, user_id, email)
+	}
+
+	// The name key only points at the id, dropping the user is enough
+	defer r.users.invalidate(ctx, idKey(tenant_id, user_id))
+
+	return r.UserTokenRepo.MarkEmailVerified(ctx, user_id, email)
+}
+
+// AttributeRepo wraps an AttributeRepo and drops the cached users of the
+// tenant when a definition is deleted, as the value is removed from every user
+type AttributeRepo struct {
+	repo.AttributeRepo
+	users *CacheRepo
+}
+
+func NewAttributeRepo(r repo.AttributeRepo, users *CacheRepo) *AttributeRepo {
+	return &AttributeRepo{
+		AttributeRepo: r,
+		users:         users,
+	}
+}
+
+// DeleteAttribute looks the users up after the delete, deleting definitions
+// is rare enough to not track which users carried the value. The users stay
+// cached for the ttl when they can not be looked up.
+func (r *AttributeRepo) DeleteAttribute(ctx context.Context, attribute_id int) error {
+	tenant_id, ok := tenant.ID(ctx)
+	if !ok {
+		return r.AttributeRepo.DeleteAttribute(ctx, attribute_id)
+	}
+
+	err := r.AttributeRepo.DeleteAttribute(ctx, attribute_id)
+
+	users, lookupErr := r.users.repo.GetAll(ctx)
+	if lookupErr != nil {
+		return err
+	}
+	keys := []string{}
+	for _, u := range *users {
+		keys = append(keys, idKey(tenant_id, u.UserID))
+	}
+	if len(keys) > 0 {
+		r.users.invalidate(ctx, keys...)
+	}
+	return err
+}
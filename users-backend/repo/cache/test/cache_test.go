@@ -0,0 +1,182 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"users-backend/model"
+	"users-backend/repo/cache"
+	"users-backend/repo/mock"
+	"users-backend/tenant"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Cache Repo", func() {
+	var (
+		mockRepo *mock.UserRepoMock
+		store    *cache.LRUStore
+		r        *cache.CacheRepo
+		ctx      = tenant.WithID(context.Background(), model.DefaultTenantID)
+	)
+
+	johndoe := func() *model.User {
+		return &model.User{UserID: 1, TenantID: model.DefaultTenantID, UserName: "johndoe", FirstName: "John", LastName: "Doe", Email: "johndoe@email.com", UserStatus: "A"}
+	}
+
+	ginkgo.BeforeEach(func() {
+		mockRepo = mock.NewUserRepoMock()
+		store = cache.NewLRUStore(100)
+		r = cache.NewCacheRepo(mockRepo, store, time.Minute)
+	})
+
+	ginkgo.It("should serve repeated lookups from the cache", func() {
+		mockRepo.On("GetById", 1).Return(johndoe(), nil).Once()
+
+		for i := 0; i < 3; i++ {
+			user, err := r.GetById(ctx, 1)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(user).Should(gomega.Equal(johndoe()))
+		}
+
+		user, err := r.GetByUsername(ctx, "johndoe")
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(user.UserID).Should(gomega.Equal(1))
+		mockRepo.AssertNumberOfCalls(ginkgo.GinkgoT(), "GetById", 1)
+		mockRepo.AssertNotCalled(ginkgo.GinkgoT(), "GetByUsername", "johndoe")
+	})
+
+	ginkgo.It("should not serve a user cached for another tenant", func() {
+		mockRepo.On("GetById", 1).Return(johndoe(), nil).Once()
+		mockRepo.On("GetById", 1).Return((*model.User)(nil), errors.New("no rows")).Once()
+
+		r.GetById(ctx, 1)
+		_, err := r.GetById(tenant.WithID(context.Background(), model.DefaultTenantID+1), 1)
+
+		gomega.Expect(err).Should(gomega.HaveOccurred())
+		mockRepo.AssertNumberOfCalls(ginkgo.GinkgoT(), "GetById", 2)
+	})
+
+	ginkgo.It("should not cache lookup errors", func() {
+		mockRepo.On("GetById", 2).Return((*model.User)(nil), errors.New("no rows"))
+
+		r.GetById(ctx, 2)
+		r.GetById(ctx, 2)
+
+		mockRepo.AssertNumberOfCalls(ginkgo.GinkgoT(), "GetById", 2)
+	})
+
+	ginkgo.It("should drop the old username when a user is renamed", func() {
+		renamed := johndoe()
+		renamed.UserName = "john"
+		mockRepo.On("GetByUsername", "johndoe").Return(johndoe(), nil).Once()
+		mockRepo.On("Update", renamed).Return(1, nil)
+		mockRepo.On("GetById", 1).Return(renamed, nil)
+		mockRepo.On("GetByUsername", "johndoe").Return((*model.User)(nil), errors.New("no rows"))
+
+		r.GetByUsername(ctx, "johndoe")
+		r.Update(ctx, renamed)
+
+		user, err := r.GetById(ctx, 1)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(user.UserName).Should(gomega.Equal("john"))
+
+		_, err = r.GetByUsername(ctx, "johndoe")
+		gomega.Expect(err).Should(gomega.HaveOccurred())
+	})
+
+	ginkgo.It("should invalidate on delete", func() {
+		mockRepo.On("GetById", 1).Return(johndoe(), nil)
+		mockRepo.On("Delete", 1).Return(nil)
+
+		r.GetById(ctx, 1)
+		r.Delete(ctx, 1)
+		r.GetById(ctx, 1)
+
+		mockRepo.AssertNumberOfCalls(ginkgo.GinkgoT(), "GetById", 2)
+	})
+
+	ginkgo.It("should bypass the cache inside a transaction", func() {
+		mockRepo.On("GetById", 1).Return(johndoe(), nil)
+		mockRepo.On("Delete", 1).Return(nil)
+
+		r.GetById(ctx, 1)
+		err := r.RunInTx(ctx, func(ctx context.Context) error {
+			r.GetById(ctx, 1)
+			return r.Delete(ctx, 1)
+		})
+
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		mockRepo.AssertNumberOfCalls(ginkgo.GinkgoT(), "GetById", 2)
+		gomega.Expect(store.Len()).Should(gomega.Equal(1))
+	})
+
+	ginkgo.It("should drop the user whose email is verified", func() {
+		verified := johndoe()
+		verified.EmailVerified = true
+		mockRepo.On("GetById", 1).Return(johndoe(), nil).Once()
+		mockRepo.On("GetById", 1).Return(verified, nil).Once()
+		mockTokens := mock.NewUserTokenRepoMock()
+		mockTokens.On("MarkEmailVerified", 1, "johndoe@email.com").Return(true, nil)
+		tokens := cache.NewTokenRepo(mockTokens, r)
+
+		r.GetById(ctx, 1)
+		_, err := tokens.MarkEmailVerified(ctx, 1, "johndoe@email.com")
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		user, err := r.GetById(ctx, 1)
+
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(user.EmailVerified).Should(gomega.BeTrue())
+	})
+
+	ginkgo.It("should drop the users of the tenant when an attribute is deleted", func() {
+		tagged := johndoe()
+		tagged.Attributes = model.Attributes{"badge": "1234"}
+		mockRepo.On("GetById", 1).Return(tagged, nil).Once()
+		mockRepo.On("GetById", 1).Return(johndoe(), nil).Once()
+		mockRepo.On("GetAll").Return(&[]model.User{*johndoe()}, nil)
+		mockAttributes := mock.NewAttributeRepoMock()
+		mockAttributes.On("DeleteAttribute", 7).Return(nil)
+		attributes := cache.NewAttributeRepo(mockAttributes, r)
+
+		r.GetById(ctx, 1)
+		gomega.Expect(attributes.DeleteAttribute(ctx, 7)).Should(gomega.Succeed())
+		user, err := r.GetById(ctx, 1)
+
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(user.Attributes).ShouldNot(gomega.HaveKey("badge"))
+		mockRepo.AssertNumberOfCalls(ginkgo.GinkgoT(), "GetById", 2)
+	})
+
+	ginkgo.Describe("LRUStore", func() {
+		ginkgo.It("should evict the least recently used entry", func() {
+			s := cache.NewLRUStore(2)
+			s.Set(ctx, "a", []byte("1"), time.Minute)
+			s.Set(ctx, "b", []byte("2"), time.Minute)
+			s.Get(ctx, "a")
+			s.Set(ctx, "c", []byte("3"), time.Minute)
+
+			_, found, _ := s.Get(ctx, "b")
+			gomega.Expect(found).Should(gomega.BeFalse())
+			v, found, _ := s.Get(ctx, "a")
+			gomega.Expect(found).Should(gomega.BeTrue())
+			gomega.Expect(v).Should(gomega.Equal([]byte("1")))
+		})
+
+		ginkgo.It("should expire entries after their ttl", func() {
+			s := cache.NewLRUStore(2)
+			s.Set(ctx, "a", []byte("1"), time.Millisecond)
+			time.Sleep(5 * time.Millisecond)
+
+			_, found, _ := s.Get(ctx, "a")
+			gomega.Expect(found).Should(gomega.BeFalse())
+		})
+	})
+})
+
+func TestCacheRepo(t *testing.T) {
+	gomega.RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "Cache Repo Suite")
+}
@@ -0,0 +1,31 @@
+package test
+
+import (
+	"path/filepath"
+	"time"
+	"users-backend/logging"
+	"users-backend/repo"
+	"users-backend/repo/cache"
+	"users-backend/repo/repotest"
+	"users-backend/repo/sqlite"
+
+	"github.com/onsi/ginkgo/v2"
+)
+
+var _ = repotest.Describe("CacheRepo", func() (repo.UserRepo, func()) {
+	r, cleanup := sqlite.NewSQLiteRepo("sqlite://"+filepath.Join(ginkgo.GinkgoT().TempDir(), "users.db"), logging.Discard())
+	repotest.Migrate(r)
+	return cache.NewCacheRepo(r, cache.NewLRUStore(100), time.Minute), cleanup
+})
+
+var _ = repotest.DescribeTenants("CacheRepo", func() (repo.TenantRepo, repo.UserRepo, func()) {
+	r, cleanup := sqlite.NewSQLiteRepo("sqlite://"+filepath.Join(ginkgo.GinkgoT().TempDir(), "users.db"), logging.Discard())
+	repotest.Migrate(r)
+	return r, cache.NewCacheRepo(r, cache.NewLRUStore(100), time.Minute), cleanup
+})
+
+var _ = repotest.DescribeAttributes("CacheRepo", func() (repo.AttributeRepo, repo.UserRepo, func()) {
+	r, cleanup := sqlite.NewSQLiteRepo("sqlite://"+filepath.Join(ginkgo.GinkgoT().TempDir(), "users.db"), logging.Discard())
+	repotest.Migrate(r)
+	return r, cache.NewCacheRepo(r, cache.NewLRUStore(100), time.Minute), cleanup
+})
@@ -1,16 +1,309 @@
 package repo
 
 import (
+	"context"
+	"errors"
+	"time"
 	"users-backend/model"
+	"users-backend/repo/migrate"
+	"users-backend/tenant"
+)
+
+var (
+	// ErrNotFound is wrapped by the errors returned when no user matches
+	ErrNotFound = errors.New("user not found")
+	// ErrDuplicateUserName is wrapped by the errors returned when a write would
+	// give two users the same user name
+	ErrDuplicateUserName = errors.New("user name already in use")
+	// ErrNoTenant is returned by UserRepo calls made with a context that is
+	// not scoped to a tenant
+	ErrNoTenant = errors.New("no tenant in context")
+
+	// ErrTenantNotFound is wrapped by the errors returned when no tenant matches
+	ErrTenantNotFound = errors.New("tenant not found")
+	// ErrDuplicateTenantSlug is wrapped by the errors returned when a write
+	// would give two tenants the same slug
+	ErrDuplicateTenantSlug = errors.New("tenant slug already in use")
+	// ErrTenantInUse is wrapped by the errors returned when deleting a tenant
+	// that still has users
+	ErrTenantInUse = errors.New("tenant still has users")
+
+	// ErrAttributeNotFound is wrapped by the errors returned when no attribute
+	// definition matches
+	ErrAttributeNotFound = errors.New("attribute not found")
+	// ErrDuplicateAttribute is wrapped by the errors returned when a tenant
+	// would have two attributes with the same name
+	ErrDuplicateAttribute = errors.New("attribute already defined")
+
+	// ErrGroupNotFound is wrapped by the errors returned when no group matches
+	ErrGroupNotFound = errors.New("group not found")
+	// ErrDuplicateGroupName is wrapped by the errors returned when a tenant
+	// would have two groups with the same name
+	ErrDuplicateGroupName = errors.New("group name already in use")
+
+	// ErrCredentialNotFound is wrapped by the errors returned when the user
+	// has no password
+	ErrCredentialNotFound = errors.New("credential not found")
+
+	// ErrUserTokenNotFound is wrapped by the errors returned when no unused
+	// and unexpired token matches
+	ErrUserTokenNotFound = errors.New("token not found")
+
+	// ErrTwoFactorNotFound is wrapped by the errors returned when the user
+	// has no second factor, or no unconfirmed one when confirming
+	ErrTwoFactorNotFound = errors.New("two-factor not found")
+
+	// ErrClientNotFound is wrapped by the errors returned when no OAuth
+	// client matches
+	ErrClientNotFound = errors.New("client not found")
+	// ErrAuthorizationCodeNotFound is wrapped by the errors returned when no
+	// unused and unexpired authorization code matches
+	ErrAuthorizationCodeNotFound = errors.New("authorization code not found")
 )
 
 type (
+	// UserRepo stores users. Looking up or updating a missing user returns an
+	// error wrapping ErrNotFound, deleting a missing user succeeds.
+	//
+	// Every call is scoped to the tenant of ctx (see package tenant): users of
+	// other tenants are not found and Create assigns the user to that tenant.
+	// Calls without a tenant return ErrNoTenant.
 	UserRepo interface {
-		GetById(user_id int) (*model.User, error)
-		GetByUsername(userName string) (*model.User, error)
-		GetAll() (*[]model.User, error)
-		Create(user *model.User) (int, error)
-		Update(user *model.User) (int, error)
-		Delete(user_id int) error
+		GetById(ctx context.Context, user_id int) (*model.User, error)
+		GetByUsername(ctx context.Context, userName string) (*model.User, error)
+		// GetAll returns every user ordered by id
+		GetAll(ctx context.Context) (*[]model.User, error)
+		// FindByAttributes returns the users having every given attribute
+		// value, ordered by id
+		FindByAttributes(ctx context.Context, attributes model.Attributes) (*[]model.User, error)
+		Create(ctx context.Context, user *model.User) (int, error)
+		// Update replaces the user, keeping its attributes when
+		// user.Attributes is nil
+		Update(ctx context.Context, user *model.User) (int, error)
+		Delete(ctx context.Context, user_id int) error
+
+		// GetDirectReports returns the users whose manager is manager_id,
+		// ordered by id
+		GetDirectReports(ctx context.Context, manager_id int) (*[]model.User, error)
+		// GetManagementChain returns the managers of the user, from its direct
+		// manager up to the top of the hierarchy. It is empty for a user
+		// without manager or a missing user.
+		GetManagementChain(ctx context.Context, user_id int) (*[]model.User, error)
+		// GetSubordinates returns every user reporting to manager_id directly
+		// or through other managers, ordered by depth then id
+		GetSubordinates(ctx context.Context, manager_id int) (*[]model.User, error)
+		// ReassignReports moves the direct reports of from_manager_id to
+		// to_manager_id, 0 leaves them without manager. It returns the number
+		// of users moved.
+		ReassignReports(ctx context.Context, from_manager_id, to_manager_id int) (int, error)
+		// LockHierarchy blocks the other transactions locking the hierarchy
+		// of the tenant until the transaction of ctx ends, so that a
+		// management chain read to reject a cycle stays true until the
+		// manager is written. It must be called inside RunInTx.
+		LockHierarchy(ctx context.Context) error
+		// LockAttribute blocks the other transactions locking the attribute
+		// name of the tenant until the transaction of ctx ends, so that a
+		// unique value found free stays free until it is written. It must be
+		// called inside RunInTx.
+		LockAttribute(ctx context.Context, name string) error
+
+		// RunInTx runs fn in a transaction, every call made with the context
+		// passed to fn is part of it. The transaction is rolled back when fn
+		// returns an error. Calling RunInTx inside fn joins the outer transaction.
+		RunInTx(ctx context.Context, fn func(ctx context.Context) error) error
+	}
+
+	// TenantRepo stores tenants. Looking up or updating a missing tenant
+	// returns an error wrapping ErrTenantNotFound, deleting a missing tenant
+	// succeeds. Tenant calls are not scoped to the tenant of ctx.
+	TenantRepo interface {
+		GetTenant(ctx context.Context, tenant_id int) (*model.Tenant, error)
+		GetTenantBySlug(ctx context.Context, slug string) (*model.Tenant, error)
+		// GetAllTenants returns every tenant ordered by id
+		GetAllTenants(ctx context.Context) (*[]model.Tenant, error)
+		CreateTenant(ctx context.Context, t *model.Tenant) (int, error)
+		UpdateTenant(ctx context.Context, t *model.Tenant) (int, error)
+		DeleteTenant(ctx context.Context, tenant_id int) error
+	}
+
+	// AttributeRepo stores the custom attribute definitions of the tenant of
+	// ctx, calls without a tenant return ErrNoTenant. Deleting a definition
+	// removes its values from every user, deleting a missing one succeeds.
+	AttributeRepo interface {
+		GetAttribute(ctx context.Context, attribute_id int) (*model.AttributeDefinition, error)
+		// GetAttributes returns every definition ordered by name
+		GetAttributes(ctx context.Context) (*[]model.AttributeDefinition, error)
+		CreateAttribute(ctx context.Context, def *model.AttributeDefinition) (int, error)
+		DeleteAttribute(ctx context.Context, attribute_id int) error
+	}
+
+	// GroupRepo stores the groups of the tenant of ctx and their members,
+	// calls without a tenant return ErrNoTenant. Looking up or updating a
+	// missing group returns an error wrapping ErrGroupNotFound, deleting a
+	// missing group succeeds.
+	GroupRepo interface {
+		GetGroup(ctx context.Context, group_id int) (*model.Group, error)
+		// GetGroups returns every group ordered by name
+		GetGroups(ctx context.Context) (*[]model.Group, error)
+		CreateGroup(ctx context.Context, g *model.Group) (int, error)
+		UpdateGroup(ctx context.Context, g *model.Group) (int, error)
+		// DeleteGroup removes the group and its memberships, its subgroups
+		// are moved to its parent
+		DeleteGroup(ctx context.Context, group_id int) error
+		// GetGroupAncestors returns the groups the group is nested in, from
+		// its parent up to the top. It is empty for a top level group or a
+		// missing group.
+		GetGroupAncestors(ctx context.Context, group_id int) (*[]model.Group, error)
+
+		// GetGroupMembers returns the users of the group ordered by id. With
+		// transitive the users of its subgroups at any depth are included,
+		// each once.
+		GetGroupMembers(ctx context.Context, group_id int, transitive bool) (*[]model.User, error)
+		// GetUserGroups returns the groups of the user ordered by name. With
+		// transitive the groups they are nested in at any depth are included,
+		// each once.
+		GetUserGroups(ctx context.Context, user_id int, transitive bool) (*[]model.Group, error)
+		// AddGroupMembers adds the users to the group, skipping those already
+		// in it and users of other tenants. It returns the number of users
+		// added.
+		AddGroupMembers(ctx context.Context, group_id int, user_ids []int) (int, error)
+		// RemoveGroupMembers removes the users from the group and returns the
+		// number of users removed
+		RemoveGroupMembers(ctx context.Context, group_id int, user_ids []int) (int, error)
+		// LockGroupHierarchy blocks the other transactions locking the group
+		// hierarchy of the tenant until the transaction of ctx ends, so that
+		// the ancestors read to reject a cycle stay true until the parent is
+		// written. It must be called inside RunInTx.
+		LockGroupHierarchy(ctx context.Context) error
+
+		// RunInTx runs fn in a transaction, see UserRepo
+		RunInTx(ctx context.Context, fn func(ctx context.Context) error) error
+	}
+
+	// CredentialRepo stores the passwords of the users of the tenant of ctx,
+	// calls without a tenant return ErrNoTenant. Looking up or updating the
+	// credential of a user without password returns an error wrapping
+	// ErrCredentialNotFound, credentials are deleted with their user.
+	CredentialRepo interface {
+		GetCredential(ctx context.Context, user_id int) (*model.Credential, error)
+		// SetPassword stores the password hash of the user and clears its
+		// failed logins and lockout. It returns an error wrapping ErrNotFound
+		// for a missing user.
+		SetPassword(ctx context.Context, user_id int, hash string) error
+		// DeleteCredential removes the password of the user, deleting a
+		// missing one succeeds
+		DeleteCredential(ctx context.Context, user_id int) error
+		// RecordLoginFailure counts a failed login and returns the failed
+		// logins since the last successful one or the last lockout
+		RecordLoginFailure(ctx context.Context, user_id int) (int, error)
+		// RecordLoginSuccess clears the failed logins and the lockout
+		RecordLoginSuccess(ctx context.Context, user_id int) error
+		// LockCredential refuses logins until until and clears the failed
+		// logins
+		LockCredential(ctx context.Context, user_id int, until time.Time) error
+	}
+
+	// UserTokenRepo stores the single use tokens mailed to the users of the
+	// tenant of ctx, calls without a tenant return ErrNoTenant. Tokens are
+	// looked up by their hash and deleted with their user.
+	UserTokenRepo interface {
+		// CreateUserToken stores the token and drops the earlier tokens of
+		// the user with the same purpose, so only the last one mailed works.
+		// It returns an error wrapping ErrNotFound for a missing user.
+		CreateUserToken(ctx context.Context, t *model.UserToken) (int, error)
+		// ConsumeUserToken marks the token with the purpose and hash used and
+		// returns it. It returns an error wrapping ErrUserTokenNotFound when
+		// the token is unknown, used or expired at now.
+		ConsumeUserToken(ctx context.Context, purpose, hash string, now time.Time) (*model.UserToken, error)
+		// MarkEmailVerified verifies the email of the user if it is still
+		// email and reports whether it was
+		MarkEmailVerified(ctx context.Context, user_id int, email string) (bool, error)
+	}
+
+	// TwoFactorRepo stores the TOTP second factor and the recovery codes of
+	// the users of the tenant of ctx, calls without a tenant return
+	// ErrNoTenant. Looking up or updating the factor of a user without one
+	// returns an error wrapping ErrTwoFactorNotFound, factors are deleted with
+	// their user.
+	TwoFactorRepo interface {
+		GetTwoFactor(ctx context.Context, user_id int) (*model.TwoFactor, error)
+		// EnrollTwoFactor stores an unconfirmed factor with the secret,
+		// replacing the factor and the recovery codes of the user. It returns
+		// an error wrapping ErrNotFound for a missing user.
+		EnrollTwoFactor(ctx context.Context, user_id int, secret string) error
+		// ConfirmTwoFactor confirms the unconfirmed factor of the user with
+		// the step of the code it was proved with and stores the hashes of
+		// its recovery codes
+		ConfirmTwoFactor(ctx context.Context, user_id int, step int64, codeHashes []string) error
+		// UseTwoFactorStep records the step of an accepted code and reports
+		// false when a code of that step or a later one was already accepted
+		UseTwoFactorStep(ctx context.Context, user_id int, step int64) (bool, error)
+		// DeleteTwoFactor removes the factor and the recovery codes of the
+		// user, deleting a missing one succeeds
+		DeleteTwoFactor(ctx context.Context, user_id int) error
+
+		// ReplaceRecoveryCodes replaces the recovery codes of the user with
+		// the hashes
+		ReplaceRecoveryCodes(ctx context.Context, user_id int, codeHashes []string) error
+		// UseRecoveryCode marks the unused code with the hash used and
+		// reports whether there was one
+		UseRecoveryCode(ctx context.Context, user_id int, codeHash string) (bool, error)
+		// CountRecoveryCodes returns the number of unused codes of the user
+		CountRecoveryCodes(ctx context.Context, user_id int) (int, error)
+	}
+
+	// ClientRepo stores the OAuth clients of the tenant of ctx, calls without
+	// a tenant return ErrNoTenant except FindClient. Looking up or updating a
+	// missing client returns an error wrapping ErrClientNotFound, deleting a
+	// missing client succeeds.
+	ClientRepo interface {
+		GetClient(ctx context.Context, client_id string) (*model.OAuthClient, error)
+		// FindClient looks the client up in every tenant, for the requests
+		// of clients which do not name a tenant
+		FindClient(ctx context.Context, client_id string) (*model.OAuthClient, error)
+		// GetClients returns every client ordered by name
+		GetClients(ctx context.Context) (*[]model.OAuthClient, error)
+		CreateClient(ctx context.Context, c *model.OAuthClient) error
+		// UpdateClient replaces the name and the redirect URIs of the client
+		UpdateClient(ctx context.Context, c *model.OAuthClient) error
+		// SetClientSecret replaces the secret hash of the client
+		SetClientSecret(ctx context.Context, client_id, hash string) error
+		// DeleteClient removes the client and its authorization codes
+		DeleteClient(ctx context.Context, client_id string) error
+	}
+
+	// AuthorizationCodeRepo stores the authorization codes issued to the
+	// clients of the tenant of ctx, calls without a tenant return
+	// ErrNoTenant. Codes are looked up by their hash and deleted with their
+	// user or client.
+	AuthorizationCodeRepo interface {
+		// CreateAuthorizationCode stores the code. It returns an error
+		// wrapping ErrNotFound when the user or the client is missing from
+		// the tenant.
+		CreateAuthorizationCode(ctx context.Context, code *model.AuthorizationCode) error
+		// ConsumeAuthorizationCode marks the code with the hash used and
+		// returns it. It returns an error wrapping
+		// ErrAuthorizationCodeNotFound when the code is unknown, used or
+		// expired at now.
+		ConsumeAuthorizationCode(ctx context.Context, hash string, now time.Time) (*model.AuthorizationCode, error)
+	}
+
+	// Migrator is implemented by repos whose schema is managed by versioned
+	// migrations
+	Migrator interface {
+		// MigrateUp applies the pending migrations and returns them
+		MigrateUp(ctx context.Context) ([]migrate.Migration, error)
+		// MigrateDown reverts the last steps applied migrations and returns them
+		MigrateDown(ctx context.Context, steps int) ([]migrate.Migration, error)
+		MigrationStatus(ctx context.Context) ([]migrate.Status, error)
 	}
 )
+
+// TenantID returns the tenant ctx is scoped to, for UserRepo implementations
+func TenantID(ctx context.Context) (int, error) {
+	tenant_id, ok := tenant.ID(ctx)
+	if !ok {
+		return 0, ErrNoTenant
+	}
+	return tenant_id, nil
+}
@@ -0,0 +1,145 @@
+package metrics
+
+import (
+	"context"
+	"time"
+	"users-backend/model"
+	"users-backend/repo"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	_ repo.UserRepo = new(MetricsRepo)
+
+	queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "users",
+		Subsystem: "repo",
+		Name:      "query_duration_seconds",
+		Help:      "Latency of UserRepo calls by method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+
+	queryErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "users",
+		Subsystem: "repo",
+		Name:      "query_errors_total",
+		Help:      "Number of UserRepo calls that returned an error by method, including not found lookups.",
+	}, []string{"method"})
+)
+
+// MetricsRepo wraps another UserRepo and records the latency and error count of
+// every call
+type MetricsRepo struct {
+	repo repo.UserRepo
+}
+
+func NewMetricsRepo(r repo.UserRepo) *MetricsRepo {
+	return &MetricsRepo{repo: r}
+}
+
+func observe(method string, start time.Time, err error) {
+	queryDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		queryErrors.WithLabelValues(method).Inc()
+	}
+}
+
+func (r *MetricsRepo) GetById(ctx context.Context, user_id int) (*model.User, error) {
+	start := time.Now()
+	user, err := r.repo.GetById(ctx, user_id)
+	observe("GetById", start, err)
+	return user, err
+}
+
+func (r *MetricsRepo) GetByUsername(ctx context.Context, userName string) (*model.User, error) {
+	start := time.Now()
+	user, err := r.repo.GetByUsername(ctx, userName)
+	observe("GetByUsername", start, err)
+	return user, err
+}
+
+func (r *MetricsRepo) GetAll(ctx context.Context) (*[]model.User, error) {
+	start := time.Now()
+	users, err := r.repo.GetAll(ctx)
+	observe("GetAll", start, err)
+	return users, err
+}
+
+func (r *MetricsRepo) FindByAttributes(ctx context.Context, attributes model.Attributes) (*[]model.User, error) {
+	start := time.Now()
+	users, err := r.repo.FindByAttributes(ctx, attributes)
+	observe("FindByAttributes", start, err)
+	return users, err
+}
+
+func (r *MetricsRepo) Create(ctx context.Context, user *model.User) (int, error) {
+	start := time.Now()
+	id, err := r.repo.Create(ctx, user)
+	observe("Create", start, err)
+	return id, err
+}
+
+func (r *MetricsRepo) Update(ctx context.Context, user *model.User) (int, error) {
+	start := time.Now()
+	id, err := r.repo.Update(ctx, user)
+	observe("Update", start, err)
+	return id, err
+}
+
+func (r *MetricsRepo) Delete(ctx context.Context, user_id int) error {
+	start := time.Now()
+	err := r.repo.Delete(ctx, user_id)
+	observe("Delete", start, err)
+	return err
+}
+
+func (r *MetricsRepo) GetDirectReports(ctx context.Context, manager_id int) (*[]model.User, error) {
+	start := time.Now()
+	users, err := r.repo.GetDirectReports(ctx, manager_id)
+	observe("GetDirectReports", start, err)
+	return users, err
+}
+
+func (r *MetricsRepo) GetManagementChain(ctx context.Context, user_id int) (*[]model.User, error) {
+	start := time.Now()
+	users, err := r.repo.GetManagementChain(ctx, user_id)
+	observe("GetManagementChain", start, err)
+	return users, err
+}
+
+func (r *MetricsRepo) GetSubordinates(ctx context.Context, manager_id int) (*[]model.User, error) {
+	start := time.Now()
+	users, err := r.repo.GetSubordinates(ctx, manager_id)
+	observe("GetSubordinates", start, err)
+	return users, err
+}
+
+func (r *MetricsRepo) ReassignReports(ctx context.Context, from_manager_id, to_manager_id int) (int, error) {
+	start := time.Now()
+	n, err := r.repo.ReassignReports(ctx, from_manager_id, to_manager_id)
+	observe("ReassignReports", start, err)
+	return n, err
+}
+
+func (r *MetricsRepo) LockHierarchy(ctx context.Context) error {
+	start := time.Now()
+	err := r.repo.LockHierarchy(ctx)
+	observe("LockHierarchy", start, err)
+	return err
+}
+
+func (r *MetricsRepo) LockAttribute(ctx context.Context, name string) error {
+	start := time.Now()
+	err := r.repo.LockAttribute(ctx, name)
+	observe("LockAttribute", start, err)
+	return err
+}
+
+func (r *MetricsRepo) RunInTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	start := time.Now()
+	err := r.repo.RunInTx(ctx, fn)
+	observe("RunInTx", start, err)
+	return err
+}
@@ -0,0 +1,102 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"users-backend/logging"
+	"users-backend/model"
+	"users-backend/repo"
+	"users-backend/repo/metrics"
+	"users-backend/repo/mock"
+	"users-backend/repo/repotest"
+	"users-backend/repo/sqlite"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var _ = repotest.Describe("MetricsRepo", func() (repo.UserRepo, func()) {
+	r, cleanup := sqlite.NewSQLiteRepo("sqlite://"+filepath.Join(ginkgo.GinkgoT().TempDir(), "users.db"), logging.Discard())
+	repotest.Migrate(r)
+	return metrics.NewMetricsRepo(r), cleanup
+})
+
+var _ = ginkgo.Describe("MetricsRepo recording", func() {
+	var (
+		mockRepo *mock.UserRepoMock
+		r        *metrics.MetricsRepo
+		ctx      = context.Background()
+	)
+
+	// value returns the counter value, or the histogram sample count, of the
+	// method in the default registry. The conformance specs record to it as
+	// well so specs compare before and after.
+	value := func(name, method string) float64 {
+		families, err := prometheus.DefaultGatherer.Gather()
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		for _, f := range families {
+			if f.GetName() != name {
+				continue
+			}
+			for _, m := range f.GetMetric() {
+				if len(m.GetLabel()) != 1 || m.GetLabel()[0].GetValue() != method {
+					continue
+				}
+				if h := m.GetHistogram(); h != nil {
+					return float64(h.GetSampleCount())
+				}
+				return m.GetCounter().GetValue()
+			}
+		}
+		return 0
+	}
+
+	ginkgo.BeforeEach(func() {
+		mockRepo = mock.NewUserRepoMock()
+		r = metrics.NewMetricsRepo(mockRepo)
+	})
+
+	ginkgo.It("should observe the latency of every call by method", func() {
+		mockRepo.On("GetById", 1).Return(&model.User{UserID: 1}, nil)
+		mockRepo.On("Delete", 1).Return(nil)
+		getBefore, deleteBefore := value("users_repo_query_duration_seconds", "GetById"), value("users_repo_query_duration_seconds", "Delete")
+		errorsBefore := value("users_repo_query_errors_total", "GetById")
+
+		r.GetById(ctx, 1)
+		r.GetById(ctx, 1)
+		r.Delete(ctx, 1)
+
+		gomega.Expect(value("users_repo_query_duration_seconds", "GetById") - getBefore).Should(gomega.Equal(2.0))
+		gomega.Expect(value("users_repo_query_duration_seconds", "Delete") - deleteBefore).Should(gomega.Equal(1.0))
+		gomega.Expect(value("users_repo_query_errors_total", "GetById")).Should(gomega.Equal(errorsBefore))
+	})
+
+	ginkgo.It("should count the calls that return an error", func() {
+		mockRepo.On("GetById", 2).Return((*model.User)(nil), fmt.Errorf("%w: no rows", repo.ErrNotFound))
+		errorsBefore := value("users_repo_query_errors_total", "GetById")
+		txBefore := value("users_repo_query_errors_total", "RunInTx")
+
+		_, err := r.GetById(ctx, 2)
+		gomega.Expect(err).Should(gomega.MatchError(repo.ErrNotFound))
+		gomega.Expect(r.RunInTx(ctx, func(ctx context.Context) error { return fmt.Errorf("rolled back") })).ShouldNot(gomega.Succeed())
+
+		gomega.Expect(value("users_repo_query_errors_total", "GetById") - errorsBefore).Should(gomega.Equal(1.0))
+		gomega.Expect(value("users_repo_query_errors_total", "RunInTx") - txBefore).Should(gomega.Equal(1.0))
+	})
+
+	ginkgo.It("should follow the metric naming conventions", func() {
+		problems, err := testutil.GatherAndLint(prometheus.DefaultGatherer, "users_repo_query_duration_seconds", "users_repo_query_errors_total")
+
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(problems).Should(gomega.BeEmpty())
+	})
+})
+
+func TestMetricsRepo(t *testing.T) {
+	gomega.RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "Metrics Repo Suite")
+}
@@ -0,0 +1,181 @@
+// Package migrate applies versioned SQL migrations. Each database provides a
+// Store that runs the scripts and records the applied versions, the
+// migrations themselves are NNNN_name.up.sql and NNNN_name.down.sql files.
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	Migration struct {
+		Version int
+		Name    string
+		Up      string
+		Down    string
+	}
+
+	// Status is a migration and when it was applied, AppliedAt is zero for a
+	// pending migration
+	Status struct {
+		Migration
+		AppliedAt time.Time
+	}
+
+	// Store runs migration scripts against a database and records which
+	// versions are applied
+	Store interface {
+		// Init creates the table recording the applied versions
+		Init(ctx context.Context) error
+		// Applied returns when each applied version was applied
+		Applied(ctx context.Context) (map[int]time.Time, error)
+		// Apply runs script and records version as applied, or forgets it when
+		// up is false, in a single transaction
+		Apply(ctx context.Context, m Migration, script string, up bool) error
+	}
+)
+
+func (s Status) Applied() bool {
+	return !s.AppliedAt.IsZero()
+}
+
+// Load reads the migrations in dir of fsys ordered by version
+func Load(fsys fs.FS, dir string) ([]Migration, error) {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.sql"))
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, file := range files {
+		base := path.Base(file)
+		prefix, rest, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s: name must start with a version", base)
+		}
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", base, err)
+		}
+
+		b, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version}
+			byVersion[version] = m
+		}
+
+		switch {
+		case strings.HasSuffix(rest, ".up.sql"):
+			m.Name = strings.TrimSuffix(rest, ".up.sql")
+			m.Up = string(b)
+		case strings.HasSuffix(rest, ".down.sql"):
+			m.Down = string(b)
+		default:
+			return nil, fmt.Errorf("migration %s: must end in .up.sql or .down.sql", base)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d: missing up file", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// StatusOf returns every migration with when it was applied, the Store must
+// have been initialized
+func StatusOf(ctx context.Context, s Store, migrations []Migration) ([]Status, error) {
+	applied, err := s.Applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, len(migrations))
+	for i, m := range migrations {
+		statuses[i] = Status{Migration: m, AppliedAt: applied[m.Version]}
+	}
+	return statuses, nil
+}
+
+// Pending returns the migrations not applied yet
+func Pending(ctx context.Context, s Store, migrations []Migration) ([]Migration, error) {
+	statuses, err := StatusOf(ctx, s, migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, st := range statuses {
+		if !st.Applied() {
+			pending = append(pending, st.Migration)
+		}
+	}
+	return pending, nil
+}
+
+// Up applies the pending migrations in order and returns them
+func Up(ctx context.Context, s Store, migrations []Migration) ([]Migration, error) {
+	if err := s.Init(ctx); err != nil {
+		return nil, err
+	}
+	pending, err := Pending(ctx, s, migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, m := range pending {
+		if err := s.Apply(ctx, m, m.Up, true); err != nil {
+			return pending[:i], fmt.Errorf("migration %s: %w", m, err)
+		}
+	}
+	return pending, nil
+}
+
+// Down reverts the last steps applied migrations, newest first, and returns
+// them
+func Down(ctx context.Context, s Store, migrations []Migration, steps int) ([]Migration, error) {
+	if err := s.Init(ctx); err != nil {
+		return nil, err
+	}
+	statuses, err := StatusOf(ctx, s, migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	var reverted []Migration
+	for i := len(statuses) - 1; i >= 0 && len(reverted) < steps; i-- {
+		m := statuses[i]
+		if !m.Applied() {
+			continue
+		}
+		if m.Down == "" {
+			return reverted, fmt.Errorf("migration %s: no down file", m.Migration)
+		}
+		if err := s.Apply(ctx, m.Migration, m.Down, false); err != nil {
+			return reverted, fmt.Errorf("migration %s: %w", m.Migration, err)
+		}
+		reverted = append(reverted, m.Migration)
+	}
+	return reverted, nil
+}
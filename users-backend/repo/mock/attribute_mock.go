@@ -0,0 +1,44 @@
+package mock
+
+import (
+	"context"
+	"users-backend/model"
+	"users-backend/repo"
+
+	"github.com/stretchr/testify/mock"
+)
+
+var (
+	_ repo.AttributeRepo = new(AttributeRepoMock)
+)
+
+type AttributeRepoMock struct {
+	mock.Mock
+}
+
+func NewAttributeRepoMock() *AttributeRepoMock {
+	return &AttributeRepoMock{}
+}
+
+func (r *AttributeRepoMock) GetAttribute(ctx context.Context, attribute_id int) (*model.AttributeDefinition, error) {
+	args := r.Called(attribute_id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.AttributeDefinition), args.Error(1)
+}
+
+func (r *AttributeRepoMock) GetAttributes(ctx context.Context) (*[]model.AttributeDefinition, error) {
+	args := r.Called()
+	return args.Get(0).(*[]model.AttributeDefinition), args.Error(1)
+}
+
+func (r *AttributeRepoMock) CreateAttribute(ctx context.Context, def *model.AttributeDefinition) (int, error) {
+	args := r.Called(def)
+	return args.Get(0).(int), args.Error(1)
+}
+
+func (r *AttributeRepoMock) DeleteAttribute(ctx context.Context, attribute_id int) error {
+	args := r.Called(attribute_id)
+	return args.Error(0)
+}
@@ -0,0 +1,55 @@
+package mock
+
+import (
+	"context"
+	"time"
+	"users-backend/model"
+	"users-backend/repo"
+
+	"github.com/stretchr/testify/mock"
+)
+
+var (
+	_ repo.CredentialRepo = new(CredentialRepoMock)
+)
+
+type CredentialRepoMock struct {
+	mock.Mock
+}
+
+func NewCredentialRepoMock() *CredentialRepoMock {
+	return &CredentialRepoMock{}
+}
+
+func (r *CredentialRepoMock) GetCredential(ctx context.Context, user_id int) (*model.Credential, error) {
+	args := r.Called(user_id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Credential), args.Error(1)
+}
+
+func (r *CredentialRepoMock) SetPassword(ctx context.Context, user_id int, hash string) error {
+	args := r.Called(user_id, hash)
+	return args.Error(0)
+}
+
+func (r *CredentialRepoMock) DeleteCredential(ctx context.Context, user_id int) error {
+	args := r.Called(user_id)
+	return args.Error(0)
+}
+
+func (r *CredentialRepoMock) RecordLoginFailure(ctx context.Context, user_id int) (int, error) {
+	args := r.Called(user_id)
+	return args.Get(0).(int), args.Error(1)
+}
+
+func (r *CredentialRepoMock) RecordLoginSuccess(ctx context.Context, user_id int) error {
+	args := r.Called(user_id)
+	return args.Error(0)
+}
+
+func (r *CredentialRepoMock) LockCredential(ctx context.Context, user_id int, until time.Time) error {
+	args := r.Called(user_id, until)
+	return args.Error(0)
+}
@@ -0,0 +1,84 @@
+package mock
+
+import (
+	"context"
+	"users-backend/model"
+	"users-backend/repo"
+
+	"github.com/stretchr/testify/mock"
+)
+
+var (
+	_ repo.GroupRepo = new(GroupRepoMock)
+)
+
+type GroupRepoMock struct {
+	mock.Mock
+}
+
+func NewGroupRepoMock() *GroupRepoMock {
+	return &GroupRepoMock{}
+}
+
+func (r *GroupRepoMock) GetGroup(ctx context.Context, group_id int) (*model.Group, error) {
+	args := r.Called(group_id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Group), args.Error(1)
+}
+
+func (r *GroupRepoMock) GetGroups(ctx context.Context) (*[]model.Group, error) {
+	args := r.Called()
+	return args.Get(0).(*[]model.Group), args.Error(1)
+}
+
+func (r *GroupRepoMock) CreateGroup(ctx context.Context, g *model.Group) (int, error) {
+	args := r.Called(g)
+	return args.Get(0).(int), args.Error(1)
+}
+
+func (r *GroupRepoMock) UpdateGroup(ctx context.Context, g *model.Group) (int, error) {
+	args := r.Called(g)
+	return args.Get(0).(int), args.Error(1)
+}
+
+func (r *GroupRepoMock) DeleteGroup(ctx context.Context, group_id int) error {
+	args := r.Called(group_id)
+	return args.Error(0)
+}
+
+func (r *GroupRepoMock) GetGroupAncestors(ctx context.Context, group_id int) (*[]model.Group, error) {
+	args := r.Called(group_id)
+	return args.Get(0).(*[]model.Group), args.Error(1)
+}
+
+func (r *GroupRepoMock) GetGroupMembers(ctx context.Context, group_id int, transitive bool) (*[]model.User, error) {
+	args := r.Called(group_id, transitive)
+	return args.Get(0).(*[]model.User), args.Error(1)
+}
+
+func (r *GroupRepoMock) GetUserGroups(ctx context.Context, user_id int, transitive bool) (*[]model.Group, error) {
+	args := r.Called(user_id, transitive)
+	return args.Get(0).(*[]model.Group), args.Error(1)
+}
+
+func (r *GroupRepoMock) AddGroupMembers(ctx context.Context, group_id int, user_ids []int) (int, error) {
+	args := r.Called(group_id, user_ids)
+	return args.Get(0).(int), args.Error(1)
+}
+
+func (r *GroupRepoMock) RemoveGroupMembers(ctx context.Context, group_id int, user_ids []int) (int, error) {
+	args := r.Called(group_id, user_ids)
+	return args.Get(0).(int), args.Error(1)
+}
+
+func (r *GroupRepoMock) LockGroupHierarchy(ctx context.Context) error {
+	args := r.Called()
+	return args.Error(0)
+}
+
+// RunInTx runs fn straight away, the mock has no transactions to roll back
+func (r *GroupRepoMock) RunInTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
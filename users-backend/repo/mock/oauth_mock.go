@@ -0,0 +1,85 @@
+package mock
+
+import (
+	"context"
+	"time"
+	"users-backend/model"
+	"users-backend/repo"
+
+	"github.com/stretchr/testify/mock"
+)
+
+var (
+	_ repo.ClientRepo            = new(ClientRepoMock)
+	_ repo.AuthorizationCodeRepo = new(AuthorizationCodeRepoMock)
+)
+
+type ClientRepoMock struct {
+	mock.Mock
+}
+
+func NewClientRepoMock() *ClientRepoMock {
+	return &ClientRepoMock{}
+}
+
+func (r *ClientRepoMock) GetClient(ctx context.Context, client_id string) (*model.OAuthClient, error) {
+	args := r.Called(client_id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.OAuthClient), args.Error(1)
+}
+
+func (r *ClientRepoMock) FindClient(ctx context.Context, client_id string) (*model.OAuthClient, error) {
+	args := r.Called(client_id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.OAuthClient), args.Error(1)
+}
+
+func (r *ClientRepoMock) GetClients(ctx context.Context) (*[]model.OAuthClient, error) {
+	args := r.Called()
+	return args.Get(0).(*[]model.OAuthClient), args.Error(1)
+}
+
+func (r *ClientRepoMock) CreateClient(ctx context.Context, c *model.OAuthClient) error {
+	args := r.Called(c)
+	return args.Error(0)
+}
+
+func (r *ClientRepoMock) UpdateClient(ctx context.Context, c *model.OAuthClient) error {
+	args := r.Called(c)
+	return args.Error(0)
+}
+
+func (r *ClientRepoMock) SetClientSecret(ctx context.Context, client_id, hash string) error {
+	args := r.Called(client_id, hash)
+	return args.Error(0)
+}
+
+func (r *ClientRepoMock) DeleteClient(ctx context.Context, client_id string) error {
+	args := r.Called(client_id)
+	return args.Error(0)
+}
+
+type AuthorizationCodeRepoMock struct {
+	mock.Mock
+}
+
+func NewAuthorizationCodeRepoMock() *AuthorizationCodeRepoMock {
+	return &AuthorizationCodeRepoMock{}
+}
+
+func (r *AuthorizationCodeRepoMock) CreateAuthorizationCode(ctx context.Context, code *model.AuthorizationCode) error {
+	args := r.Called(code)
+	return args.Error(0)
+}
+
+func (r *AuthorizationCodeRepoMock) ConsumeAuthorizationCode(ctx context.Context, hash string, now time.Time) (*model.AuthorizationCode, error) {
+	args := r.Called(hash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.AuthorizationCode), args.Error(1)
+}
@@ -1,6 +1,7 @@
 package mock
 
 import (
+	"context"
 	"users-backend/model"
 	"users-backend/repo"
 
@@ -19,12 +20,12 @@ func NewUserRepoMock() *UserRepoMock {
 	return &UserRepoMock{}
 }
 
-func (r *UserRepoMock) GetById(user_id int) (*model.User, error) {
+func (r *UserRepoMock) GetById(ctx context.Context, user_id int) (*model.User, error) {
 	args := r.Called(user_id)
 	return args.Get(0).(*model.User), args.Error(1)
 }
 
-func (r *UserRepoMock) GetByUsername(userName string) (*model.User, error) {
+func (r *UserRepoMock) GetByUsername(ctx context.Context, userName string) (*model.User, error) {
 	args := r.Called(userName)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
@@ -32,22 +33,62 @@ func (r *UserRepoMock) GetByUsername(userName string) (*model.User, error) {
 	return args.Get(0).(*model.User), args.Error(1)
 }
 
-func (r *UserRepoMock) GetAll() (*[]model.User, error) {
+func (r *UserRepoMock) GetAll(ctx context.Context) (*[]model.User, error) {
 	args := r.Called()
 	return args.Get(0).(*[]model.User), args.Error(1)
 }
 
-func (r *UserRepoMock) Create(user *model.User) (int, error) {
+func (r *UserRepoMock) FindByAttributes(ctx context.Context, attributes model.Attributes) (*[]model.User, error) {
+	args := r.Called(attributes)
+	return args.Get(0).(*[]model.User), args.Error(1)
+}
+
+func (r *UserRepoMock) Create(ctx context.Context, user *model.User) (int, error) {
 	args := r.Called(user)
 	return args.Get(0).(int), args.Error(1)
 }
 
-func (r *UserRepoMock) Update(user *model.User) (int, error) {
+func (r *UserRepoMock) Update(ctx context.Context, user *model.User) (int, error) {
 	args := r.Called(user)
 	return args.Get(0).(int), args.Error(1)
 }
 
-func (r *UserRepoMock) Delete(user_id int) error {
+func (r *UserRepoMock) Delete(ctx context.Context, user_id int) error {
 	args := r.Called(user_id)
 	return args.Error(0)
 }
+
+func (r *UserRepoMock) GetDirectReports(ctx context.Context, manager_id int) (*[]model.User, error) {
+	args := r.Called(manager_id)
+	return args.Get(0).(*[]model.User), args.Error(1)
+}
+
+func (r *UserRepoMock) GetManagementChain(ctx context.Context, user_id int) (*[]model.User, error) {
+	args := r.Called(user_id)
+	return args.Get(0).(*[]model.User), args.Error(1)
+}
+
+func (r *UserRepoMock) GetSubordinates(ctx context.Context, manager_id int) (*[]model.User, error) {
+	args := r.Called(manager_id)
+	return args.Get(0).(*[]model.User), args.Error(1)
+}
+
+func (r *UserRepoMock) ReassignReports(ctx context.Context, from_manager_id, to_manager_id int) (int, error) {
+	args := r.Called(from_manager_id, to_manager_id)
+	return args.Get(0).(int), args.Error(1)
+}
+
+func (r *UserRepoMock) LockHierarchy(ctx context.Context) error {
+	args := r.Called()
+	return args.Error(0)
+}
+
+func (r *UserRepoMock) LockAttribute(ctx context.Context, name string) error {
+	args := r.Called(name)
+	return args.Error(0)
+}
+
+// RunInTx runs fn straight away, the mock has no transactions to roll back
+func (r *UserRepoMock) RunInTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
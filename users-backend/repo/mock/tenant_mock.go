@@ -0,0 +1,57 @@
+package mock
+
+import (
+	"context"
+	"users-backend/model"
+	"users-backend/repo"
+
+	"github.com/stretchr/testify/mock"
+)
+
+var (
+	_ repo.TenantRepo = new(TenantRepoMock)
+)
+
+type TenantRepoMock struct {
+	mock.Mock
+}
+
+func NewTenantRepoMock() *TenantRepoMock {
+	return &TenantRepoMock{}
+}
+
+func (r *TenantRepoMock) GetTenant(ctx context.Context, tenant_id int) (*model.Tenant, error) {
+	args := r.Called(tenant_id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Tenant), args.Error(1)
+}
+
+func (r *TenantRepoMock) GetTenantBySlug(ctx context.Context, slug string) (*model.Tenant, error) {
+	args := r.Called(slug)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Tenant), args.Error(1)
+}
+
+func (r *TenantRepoMock) GetAllTenants(ctx context.Context) (*[]model.Tenant, error) {
+	args := r.Called()
+	return args.Get(0).(*[]model.Tenant), args.Error(1)
+}
+
+func (r *TenantRepoMock) CreateTenant(ctx context.Context, t *model.Tenant) (int, error) {
+	args := r.Called(t)
+	return args.Get(0).(int), args.Error(1)
+}
+
+func (r *TenantRepoMock) UpdateTenant(ctx context.Context, t *model.Tenant) (int, error) {
+	args := r.Called(t)
+	return args.Get(0).(int), args.Error(1)
+}
+
+func (r *TenantRepoMock) DeleteTenant(ctx context.Context, tenant_id int) error {
+	args := r.Called(tenant_id)
+	return args.Error(0)
+}
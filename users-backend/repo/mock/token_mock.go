@@ -0,0 +1,40 @@
+package mock
+
+import (
+	"context"
+	"time"
+	"users-backend/model"
+	"users-backend/repo"
+
+	"github.com/stretchr/testify/mock"
+)
+
+var (
+	_ repo.UserTokenRepo = new(UserTokenRepoMock)
+)
+
+type UserTokenRepoMock struct {
+	mock.Mock
+}
+
+func NewUserTokenRepoMock() *UserTokenRepoMock {
+	return &UserTokenRepoMock{}
+}
+
+func (r *UserTokenRepoMock) CreateUserToken(ctx context.Context, t *model.UserToken) (int, error) {
+	args := r.Called(t)
+	return args.Get(0).(int), args.Error(1)
+}
+
+func (r *UserTokenRepoMock) ConsumeUserToken(ctx context.Context, purpose, hash string, now time.Time) (*model.UserToken, error) {
+	args := r.Called(purpose, hash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.UserToken), args.Error(1)
+}
+
+func (r *UserTokenRepoMock) MarkEmailVerified(ctx context.Context, user_id int, email string) (bool, error) {
+	args := r.Called(user_id, email)
+	return args.Get(0).(bool), args.Error(1)
+}
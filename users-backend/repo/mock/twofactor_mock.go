@@ -0,0 +1,64 @@
+package mock
+
+import (
+	"context"
+	"users-backend/model"
+	"users-backend/repo"
+
+	"github.com/stretchr/testify/mock"
+)
+
+var (
+	_ repo.TwoFactorRepo = new(TwoFactorRepoMock)
+)
+
+type TwoFactorRepoMock struct {
+	mock.Mock
+}
+
+func NewTwoFactorRepoMock() *TwoFactorRepoMock {
+	return &TwoFactorRepoMock{}
+}
+
+func (r *TwoFactorRepoMock) GetTwoFactor(ctx context.Context, user_id int) (*model.TwoFactor, error) {
+	args := r.Called(user_id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.TwoFactor), args.Error(1)
+}
+
+func (r *TwoFactorRepoMock) EnrollTwoFactor(ctx context.Context, user_id int, secret string) error {
+	args := r.Called(user_id, secret)
+	return args.Error(0)
+}
+
+func (r *TwoFactorRepoMock) ConfirmTwoFactor(ctx context.Context, user_id int, step int64, codeHashes []string) error {
+	args := r.Called(user_id, step, codeHashes)
+	return args.Error(0)
+}
+
+func (r *TwoFactorRepoMock) UseTwoFactorStep(ctx context.Context, user_id int, step int64) (bool, error) {
+	args := r.Called(user_id, step)
+	return args.Get(0).(bool), args.Error(1)
+}
+
+func (r *TwoFactorRepoMock) DeleteTwoFactor(ctx context.Context, user_id int) error {
+	args := r.Called(user_id)
+	return args.Error(0)
+}
+
+func (r *TwoFactorRepoMock) ReplaceRecoveryCodes(ctx context.Context, user_id int, codeHashes []string) error {
+	args := r.Called(user_id, codeHashes)
+	return args.Error(0)
+}
+
+func (r *TwoFactorRepoMock) UseRecoveryCode(ctx context.Context, user_id int, codeHash string) (bool, error) {
+	args := r.Called(user_id, codeHash)
+	return args.Get(0).(bool), args.Error(1)
+}
+
+func (r *TwoFactorRepoMock) CountRecoveryCodes(ctx context.Context, user_id int) (int, error) {
+	args := r.Called(user_id)
+	return args.Get(0).(int), args.Error(1)
+}
@@ -0,0 +1,100 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"users-backend/model"
+	"users-backend/repo"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+)
+
+// wrapAttributeError adds the repo sentinel errors to the go-pg errors they
+// stand for in the attribute_definitions table
+func wrapAttributeError(err error) error {
+	var pgErr pg.Error
+	switch {
+	case errors.Is(err, pg.ErrNoRows):
+		return fmt.Errorf("%w: %w", repo.ErrAttributeNotFound, err)
+	case errors.As(err, &pgErr) && pgErr.Field('C') == "23505":
+		return fmt.Errorf("%w: %w", repo.ErrDuplicateAttribute, err)
+	}
+	return err
+}
+
+func (r *PostgresRepo) GetAttribute(ctx context.Context, attribute_id int) (*model.AttributeDefinition, error) {
+	def := &model.AttributeDefinition{AttributeID: attribute_id}
+	err := r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+		return db.ModelContext(ctx, def).WherePK().Where("tenant_id = ?", tenant_id).Select()
+	})
+	if err != nil {
+		r.logError(ctx, "failed to get attribute", err, "attribute_id", attribute_id)
+		return nil, wrapAttributeError(err)
+	}
+	if len(def.EnumValues) == 0 {
+		def.EnumValues = nil
+	}
+	return def, nil
+}
+
+func (r *PostgresRepo) GetAttributes(ctx context.Context) (*[]model.AttributeDefinition, error) {
+	var defs []model.AttributeDefinition
+	err := r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+		return db.ModelContext(ctx, &defs).Where("tenant_id = ?", tenant_id).Order("name ASC").Select()
+	})
+	if err != nil {
+		r.logError(ctx, "failed to get attributes", err)
+		return nil, err
+	}
+	for i := range defs {
+		if len(defs[i].EnumValues) == 0 {
+			defs[i].EnumValues = nil
+		}
+	}
+
+	return &defs, nil
+}
+
+func (r *PostgresRepo) CreateAttribute(ctx context.Context, def *model.AttributeDefinition) (int, error) {
+	err := r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+		def.TenantID = tenant_id
+		_, err := db.ModelContext(ctx, def).Insert()
+		return err
+	})
+	if err != nil {
+		r.logError(ctx, "failed to insert attribute", err, "attribute_name", def.Name)
+		return -1, wrapAttributeError(err)
+	}
+	return def.AttributeID, nil
+}
+
+func (r *PostgresRepo) DeleteAttribute(ctx context.Context, attribute_id int) error {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = r.RunInTx(ctx, func(ctx context.Context) error {
+		def := &model.AttributeDefinition{AttributeID: attribute_id}
+		err := r.conn(ctx).ModelContext(ctx, def).WherePK().Where("tenant_id = ?", tenant_id).Select()
+		if errors.Is(err, pg.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = r.conn(ctx).ExecContext(ctx, "UPDATE users SET attributes = attributes - ? WHERE tenant_id = ?", def.Name, tenant_id)
+		if err != nil {
+			return err
+		}
+		_, err = r.conn(ctx).ModelContext(ctx, def).WherePK().Delete()
+		return err
+	})
+	if err != nil {
+		r.logError(ctx, "failed to delete attribute", err, "attribute_id", attribute_id)
+	}
+	return err
+}
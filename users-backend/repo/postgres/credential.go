@@ -0,0 +1,109 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"users-backend/model"
+	"users-backend/repo"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+)
+
+// wrapCredentialError adds ErrCredentialNotFound to the go-pg errors
+// returned for users without password
+func wrapCredentialError(err error) error {
+	if errors.Is(err, pg.ErrNoRows) {
+		return fmt.Errorf("%w: %w", repo.ErrCredentialNotFound, err)
+	}
+	return err
+}
+
+func (r *PostgresRepo) GetCredential(ctx context.Context, user_id int) (*model.Credential, error) {
+	c := &model.Credential{UserID: user_id}
+	err := r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+		return db.ModelContext(ctx, c).WherePK().Where("tenant_id = ?", tenant_id).Select()
+	})
+	if err != nil {
+		r.logError(ctx, "failed to get credential", err, "user_id", user_id)
+		return nil, wrapCredentialError(err)
+	}
+	return c, nil
+}
+
+func (r *PostgresRepo) SetPassword(ctx context.Context, user_id int, hash string) error {
+	err := r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+		// Selecting the user keeps the credential in its tenant
+		res, err := db.ExecContext(ctx, `INSERT INTO user_credentials (user_id, tenant_id, password_hash, failed_attempts, locked_until, updated_at)
+			SELECT user_id, tenant_id, ?, 0, NULL, now() FROM users WHERE tenant_id = ? AND user_id = ?
+			ON CONFLICT (user_id) DO UPDATE SET password_hash = excluded.password_hash, failed_attempts = 0, locked_until = NULL, updated_at = excluded.updated_at`,
+			hash, tenant_id, user_id)
+		if err != nil {
+			return err
+		}
+		if res.RowsAffected() == 0 {
+			return pg.ErrNoRows
+		}
+		return nil
+	})
+	if err != nil {
+		r.logError(ctx, "failed to set password", err, "user_id", user_id)
+		return wrapError(err)
+	}
+	return nil
+}
+
+func (r *PostgresRepo) DeleteCredential(ctx context.Context, user_id int) error {
+	err := r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+		_, err := db.ModelContext(ctx, &model.Credential{UserID: user_id}).WherePK().Where("tenant_id = ?", tenant_id).Delete()
+		return err
+	})
+	if err != nil {
+		r.logError(ctx, "failed to delete credential", err, "user_id", user_id)
+	}
+	return err
+}
+
+func (r *PostgresRepo) RecordLoginFailure(ctx context.Context, user_id int) (int, error) {
+	var n int
+	err := r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+		_, err := db.QueryOneContext(ctx, pg.Scan(&n),
+			"UPDATE user_credentials SET failed_attempts = failed_attempts + 1 WHERE tenant_id = ? AND user_id = ? RETURNING failed_attempts",
+			tenant_id, user_id)
+		return err
+	})
+	if err != nil {
+		r.logError(ctx, "failed to record login failure", err, "user_id", user_id)
+		return 0, wrapCredentialError(err)
+	}
+	return n, nil
+}
+
+func (r *PostgresRepo) RecordLoginSuccess(ctx context.Context, user_id int) error {
+	return r.updateCredential(ctx, "failed to record login success", user_id, "failed_attempts = 0, locked_until = NULL")
+}
+
+func (r *PostgresRepo) LockCredential(ctx context.Context, user_id int, until time.Time) error {
+	return r.updateCredential(ctx, "failed to lock credential", user_id, "failed_attempts = 0, locked_until = ?", until)
+}
+
+// updateCredential runs the set clause on the credential of the user
+func (r *PostgresRepo) updateCredential(ctx context.Context, msg string, user_id int, set string, args ...any) error {
+	err := r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+		res, err := db.ExecContext(ctx, "UPDATE user_credentials SET "+set+" WHERE tenant_id = ? AND user_id = ?", append(args, tenant_id, user_id)...)
+		if err != nil {
+			return err
+		}
+		if res.RowsAffected() == 0 {
+			return pg.ErrNoRows
+		}
+		return nil
+	})
+	if err != nil {
+		r.logError(ctx, msg, err, "user_id", user_id)
+		return wrapCredentialError(err)
+	}
+	return nil
+}
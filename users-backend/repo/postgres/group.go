@@ -0,0 +1,239 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"users-backend/model"
+	"users-backend/repo"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+)
+
+// wrapGroupError adds the repo sentinel errors to the go-pg errors they
+// stand for in the groups table
+func wrapGroupError(err error) error {
+	var pgErr pg.Error
+	switch {
+	case errors.Is(err, pg.ErrNoRows):
+		return fmt.Errorf("%w: %w", repo.ErrGroupNotFound, err)
+	case errors.As(err, &pgErr) && pgErr.Field('C') == "23505":
+		return fmt.Errorf("%w: %w", repo.ErrDuplicateGroupName, err)
+	}
+	return err
+}
+
+func (r *PostgresRepo) GetGroup(ctx context.Context, group_id int) (*model.Group, error) {
+	g := &model.Group{GroupID: group_id}
+	err := r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+		return db.ModelContext(ctx, g).WherePK().Where("tenant_id = ?", tenant_id).Select()
+	})
+	if err != nil {
+		r.logError(ctx, "failed to get group", err, "group_id", group_id)
+		return nil, wrapGroupError(err)
+	}
+	return g, nil
+}
+
+func (r *PostgresRepo) GetGroups(ctx context.Context) (*[]model.Group, error) {
+	groups := []model.Group{}
+	err := r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+		return db.ModelContext(ctx, &groups).Where("tenant_id = ?", tenant_id).Order("name ASC").Select()
+	})
+	if err != nil {
+		r.logError(ctx, "failed to get groups", err)
+		return nil, err
+	}
+
+	return &groups, nil
+}
+
+func (r *PostgresRepo) CreateGroup(ctx context.Context, g *model.Group) (int, error) {
+	err := r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+		g.TenantID = tenant_id
+		_, err := db.ModelContext(ctx, g).Insert()
+		return err
+	})
+	if err != nil {
+		r.logError(ctx, "failed to insert group", err, "group_name", g.Name)
+		return -1, wrapGroupError(err)
+	}
+	return g.GroupID, nil
+}
+
+func (r *PostgresRepo) UpdateGroup(ctx context.Context, g *model.Group) (int, error) {
+	err := r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+		g.TenantID = tenant_id
+		res, err := db.ModelContext(ctx, g).Column("name", "description", "parent_id").WherePK().Where("tenant_id = ?", tenant_id).Update()
+		if err != nil {
+			return err
+		}
+		if res.RowsAffected() == 0 {
+			return pg.ErrNoRows
+		}
+		return nil
+	})
+	if err != nil {
+		r.logError(ctx, "failed to update group", err, "group_id", g.GroupID)
+		return -1, wrapGroupError(err)
+	}
+	return g.GroupID, nil
+}
+
+func (r *PostgresRepo) DeleteGroup(ctx context.Context, group_id int) error {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = r.RunInTx(ctx, func(ctx context.Context) error {
+		g := &model.Group{GroupID: group_id}
+		err := r.conn(ctx).ModelContext(ctx, g).WherePK().Where("tenant_id = ?", tenant_id).Select()
+		if errors.Is(err, pg.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = r.conn(ctx).ExecContext(ctx, "UPDATE groups SET parent_id = ? WHERE parent_id = ?", g.ParentID, group_id)
+		if err != nil {
+			return err
+		}
+		// The memberships go with the group
+		_, err = r.conn(ctx).ModelContext(ctx, g).WherePK().Delete()
+		return err
+	})
+	if err != nil {
+		r.logError(ctx, "failed to delete group", err, "group_id", group_id)
+	}
+	return err
+}
+
+func (r *PostgresRepo) GetGroupAncestors(ctx context.Context, group_id int) (*[]model.Group, error) {
+	groups := []model.Group{}
+	err := r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+		_, err := db.QueryContext(ctx, &groups, `WITH RECURSIVE ancestors (group_id, depth, path) AS (
+			SELECT parent_id, 1, ARRAY[group_id, parent_id] FROM groups
+			WHERE tenant_id = ?0 AND group_id = ?1 AND parent_id IS NOT NULL
+			UNION ALL
+			SELECT g.parent_id, a.depth + 1, a.path || g.parent_id FROM groups g JOIN ancestors a ON g.group_id = a.group_id
+			WHERE g.tenant_id = ?0 AND g.parent_id IS NOT NULL AND NOT g.parent_id = ANY (a.path)
+		)
+		SELECT groups.* FROM groups JOIN ancestors USING (group_id) WHERE groups.tenant_id = ?0 ORDER BY ancestors.depth`, tenant_id, group_id)
+		return err
+	})
+	if err != nil {
+		r.logError(ctx, "failed to get group ancestors", err, "group_id", group_id)
+		return nil, err
+	}
+
+	return &groups, nil
+}
+
+func (r *PostgresRepo) GetGroupMembers(ctx context.Context, group_id int, transitive bool) (*[]model.User, error) {
+	users := []model.User{}
+	err := r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+		// UNION drops the groups already visited, which also stops the recursion
+		_, err := db.QueryContext(ctx, &users, `WITH RECURSIVE subgroups (group_id) AS (
+			SELECT ?1::bigint
+			UNION
+			SELECT g.group_id FROM groups g JOIN subgroups s ON g.parent_id = s.group_id
+			WHERE ?2 AND g.tenant_id = ?0
+		)
+		SELECT users.* FROM users WHERE tenant_id = ?0 AND user_id IN (
+			SELECT user_id FROM group_members WHERE tenant_id = ?0 AND group_id IN (SELECT group_id FROM subgroups)
+		) ORDER BY user_id`, tenant_id, group_id, transitive)
+		return err
+	})
+	if err != nil {
+		r.logError(ctx, "failed to get group members", err, "group_id", group_id)
+		return nil, err
+	}
+
+	return &users, nil
+}
+
+func (r *PostgresRepo) GetUserGroups(ctx context.Context, user_id int, transitive bool) (*[]model.Group, error) {
+	groups := []model.Group{}
+	err := r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+		_, err := db.QueryContext(ctx, &groups, `WITH RECURSIVE ancestors (group_id) AS (
+			SELECT group_id FROM group_members WHERE tenant_id = ?0 AND user_id = ?1
+			UNION
+			SELECT g.parent_id FROM groups g JOIN ancestors a ON g.group_id = a.group_id
+			WHERE ?2 AND g.tenant_id = ?0 AND g.parent_id IS NOT NULL
+		)
+		SELECT groups.* FROM groups WHERE tenant_id = ?0 AND group_id IN (SELECT group_id FROM ancestors) ORDER BY name`, tenant_id, user_id, transitive)
+		return err
+	})
+	if err != nil {
+		r.logError(ctx, "failed to get user groups", err, "user_id", user_id)
+		return nil, err
+	}
+
+	return &groups, nil
+}
+
+func (r *PostgresRepo) AddGroupMembers(ctx context.Context, group_id int, user_ids []int) (int, error) {
+	if len(user_ids) == 0 {
+		return 0, nil
+	}
+
+	var n int
+	err := r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+		res, err := db.ExecContext(ctx, `INSERT INTO group_members (group_id, user_id, tenant_id)
+			SELECT g.group_id, u.user_id, g.tenant_id FROM groups g JOIN users u ON u.tenant_id = g.tenant_id
+			WHERE g.tenant_id = ? AND g.group_id = ? AND u.user_id IN (?)
+			ON CONFLICT DO NOTHING`, tenant_id, group_id, pg.In(user_ids))
+		if err != nil {
+			return err
+		}
+		n = res.RowsAffected()
+		return nil
+	})
+	if err != nil {
+		r.logError(ctx, "failed to add group members", err, "group_id", group_id)
+		return 0, err
+	}
+
+	return n, nil
+}
+
+func (r *PostgresRepo) RemoveGroupMembers(ctx context.Context, group_id int, user_ids []int) (int, error) {
+	if len(user_ids) == 0 {
+		return 0, nil
+	}
+
+	var n int
+	err := r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+		res, err := db.ExecContext(ctx, "DELETE FROM group_members WHERE tenant_id = ? AND group_id = ? AND user_id IN (?)", tenant_id, group_id, pg.In(user_ids))
+		if err != nil {
+			return err
+		}
+		n = res.RowsAffected()
+		return nil
+	})
+	if err != nil {
+		r.logError(ctx, "failed to remove group members", err, "group_id", group_id)
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// LockGroupHierarchy takes a transaction level advisory lock like
+// LockHierarchy, the ancestors of a group are only known once read
+func (r *PostgresRepo) LockGroupHierarchy(ctx context.Context) error {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.conn(ctx).ExecContext(ctx, "SELECT pg_advisory_xact_lock(?, ?)", groupHierarchyLock, tenant_id)
+	if err != nil {
+		r.logError(ctx, "failed to lock group hierarchy", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package postgres
+
+import (
+	"context"
+	"embed"
+	"time"
+	"users-backend/repo/migrate"
+
+	"github.com/go-pg/pg/v10"
+)
+
+var (
+	//go:embed migrations/*.sql
+	migrationFiles embed.FS
+
+	_ migrate.Store = migrationStore{}
+)
+
+// migrationStore records applied migrations in schema_migrations
+type migrationStore struct {
+	db *pg.DB
+}
+
+type appliedMigration struct {
+	Version   int
+	AppliedAt time.Time
+}
+
+func loadMigrations() ([]migrate.Migration, error) {
+	return migrate.Load(migrationFiles, "migrations")
+}
+
+func (s migrationStore) Init(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    integer PRIMARY KEY,
+		name       text NOT NULL,
+		applied_at timestamptz NOT NULL
+	)`)
+	return err
+}
+
+func (s migrationStore) Applied(ctx context.Context) (map[int]time.Time, error) {
+	var rows []appliedMigration
+	if _, err := s.db.QueryContext(ctx, &rows, "SELECT version, applied_at FROM schema_migrations"); err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]time.Time, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row.AppliedAt
+	}
+	return applied, nil
+}
+
+func (s migrationStore) Apply(ctx context.Context, m migrate.Migration, script string, up bool) error {
+	return s.db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		if _, err := tx.ExecContext(ctx, script); err != nil {
+			return err
+		}
+
+		var err error
+		if up {
+			_, err = tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)", m.Version, m.Name, time.Now().UTC())
+		} else {
+			_, err = tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", m.Version)
+		}
+		return err
+	})
+}
+
+// MigrateUp applies the pending migrations and returns them
+func (r *PostgresRepo) MigrateUp(ctx context.Context) ([]migrate.Migration, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	return migrate.Up(ctx, migrationStore{db: r.db}, migrations)
+}
+
+// MigrateDown reverts the last steps applied migrations and returns them
+func (r *PostgresRepo) MigrateDown(ctx context.Context, steps int) ([]migrate.Migration, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	return migrate.Down(ctx, migrationStore{db: r.db}, migrations, steps)
+}
+
+// MigrationStatus returns every migration with when it was applied
+func (r *PostgresRepo) MigrationStatus(ctx context.Context) ([]migrate.Status, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	store := migrationStore{db: r.db}
+	if err := store.Init(ctx); err != nil {
+		return nil, err
+	}
+	return migrate.StatusOf(ctx, store, migrations)
+}
@@ -0,0 +1,11 @@
+-- The table go-pg created for model.User before migrations were versioned,
+-- IF NOT EXISTS adopts the table of existing deployments
+CREATE TABLE IF NOT EXISTS users (
+    user_id     bigserial PRIMARY KEY,
+    user_name   varchar(50) UNIQUE,
+    first_name  text,
+    last_name   text,
+    email       text,
+    user_status varchar(1),
+    department  text
+);
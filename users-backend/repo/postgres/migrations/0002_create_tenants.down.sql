@@ -0,0 +1,8 @@
+-- Fails when two tenants have a user with the same name
+ALTER TABLE users NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE users DISABLE ROW LEVEL SECURITY;
+DROP POLICY tenant_isolation ON users;
+ALTER TABLE users DROP CONSTRAINT users_tenant_id_user_name_key;
+ALTER TABLE users ADD CONSTRAINT users_user_name_key UNIQUE (user_name);
+ALTER TABLE users DROP COLUMN tenant_id;
+DROP TABLE tenants;
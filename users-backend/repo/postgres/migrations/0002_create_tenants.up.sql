@@ -0,0 +1,20 @@
+-- Users belong to a tenant and user names are unique per tenant, the
+-- existing users are moved to the default tenant
+CREATE TABLE tenants (
+    tenant_id bigserial PRIMARY KEY,
+    slug      varchar(63) NOT NULL UNIQUE,
+    name      text NOT NULL
+);
+
+INSERT INTO tenants (tenant_id, slug, name) VALUES (1, 'default', 'Default');
+SELECT setval(pg_get_serial_sequence('tenants', 'tenant_id'), 1);
+
+ALTER TABLE users ADD COLUMN tenant_id bigint NOT NULL DEFAULT 1 REFERENCES tenants (tenant_id);
+ALTER TABLE users ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE users DROP CONSTRAINT users_user_name_key;
+ALTER TABLE users ADD CONSTRAINT users_tenant_id_user_name_key UNIQUE (tenant_id, user_name);
+
+-- Only enforced once row level security is enabled on users, see the README.
+-- The repo sets app.tenant_id in every transaction when it is.
+CREATE POLICY tenant_isolation ON users
+    USING (tenant_id = current_setting('app.tenant_id')::bigint);
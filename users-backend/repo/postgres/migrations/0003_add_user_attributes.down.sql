@@ -0,0 +1,3 @@
+DROP INDEX users_attributes_idx;
+ALTER TABLE users DROP COLUMN attributes;
+DROP TABLE attribute_definitions;
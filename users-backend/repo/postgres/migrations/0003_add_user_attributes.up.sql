@@ -0,0 +1,19 @@
+-- Custom attributes are defined per tenant, their values are kept as a JSON
+-- object on each user
+CREATE TABLE attribute_definitions (
+    attribute_id bigserial PRIMARY KEY,
+    tenant_id    bigint NOT NULL REFERENCES tenants (tenant_id) ON DELETE CASCADE,
+    name         varchar(63) NOT NULL,
+    type         text NOT NULL CHECK (type IN ('string', 'number', 'date', 'enum')),
+    required     boolean NOT NULL DEFAULT false,
+    "unique"     boolean NOT NULL DEFAULT false,
+    enum_values  text[] NOT NULL DEFAULT '{}',
+    UNIQUE (tenant_id, name)
+);
+
+ALTER TABLE users ADD COLUMN attributes jsonb NOT NULL DEFAULT '{}';
+-- Serves the attribute filters of the listings, which use @>
+CREATE INDEX users_attributes_idx ON users USING gin (attributes jsonb_path_ops);
+
+CREATE POLICY tenant_isolation ON attribute_definitions
+    USING (tenant_id = current_setting('app.tenant_id')::bigint);
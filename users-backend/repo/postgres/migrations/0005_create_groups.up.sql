@@ -0,0 +1,26 @@
+-- Groups are the teams and distribution lists of a tenant. A group may be
+-- nested in a parent group, deleting the parent moves it to the top.
+CREATE TABLE groups (
+    group_id    bigserial PRIMARY KEY,
+    tenant_id   bigint NOT NULL REFERENCES tenants (tenant_id) ON DELETE CASCADE,
+    name        varchar(255) NOT NULL,
+    description text NOT NULL DEFAULT '',
+    parent_id   bigint REFERENCES groups (group_id) ON DELETE SET NULL CHECK (parent_id <> group_id),
+    UNIQUE (tenant_id, name)
+);
+-- Serves the subgroup lookups of the transitive queries
+CREATE INDEX groups_parent_id_idx ON groups (parent_id);
+
+CREATE TABLE group_members (
+    group_id  bigint NOT NULL REFERENCES groups (group_id) ON DELETE CASCADE,
+    user_id   bigint NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    tenant_id bigint NOT NULL REFERENCES tenants (tenant_id) ON DELETE CASCADE,
+    PRIMARY KEY (group_id, user_id)
+);
+-- Serves the groups of a user
+CREATE INDEX group_members_user_id_idx ON group_members (user_id);
+
+CREATE POLICY tenant_isolation ON groups
+    USING (tenant_id = current_setting('app.tenant_id')::bigint);
+CREATE POLICY tenant_isolation ON group_members
+    USING (tenant_id = current_setting('app.tenant_id')::bigint);
@@ -0,0 +1,13 @@
+-- The local password of a user, users without one cannot log in with a
+-- password. Failed logins are counted until the account is locked.
+CREATE TABLE user_credentials (
+    user_id         bigint PRIMARY KEY REFERENCES users (user_id) ON DELETE CASCADE,
+    tenant_id       bigint NOT NULL REFERENCES tenants (tenant_id) ON DELETE CASCADE,
+    password_hash   text NOT NULL,
+    failed_attempts integer NOT NULL DEFAULT 0,
+    locked_until    timestamptz,
+    updated_at      timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE POLICY tenant_isolation ON user_credentials
+    USING (tenant_id = current_setting('app.tenant_id')::bigint);
@@ -0,0 +1,23 @@
+-- The email of a user is verified once a verification link mailed to it is
+-- followed, changing the email clears it
+ALTER TABLE users ADD COLUMN email_verified boolean NOT NULL DEFAULT false;
+
+-- The single use tokens mailed to users to verify their email or reset their
+-- password. Only the SHA-256 of a token is stored.
+CREATE TABLE user_tokens (
+    token_id   bigserial PRIMARY KEY,
+    user_id    bigint NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    tenant_id  bigint NOT NULL REFERENCES tenants (tenant_id) ON DELETE CASCADE,
+    purpose    varchar(20) NOT NULL,
+    token_hash char(64) NOT NULL UNIQUE,
+    -- email is the address the token was sent to
+    email      text NOT NULL,
+    expires_at timestamptz NOT NULL,
+    used_at    timestamptz,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+-- Serves dropping the earlier tokens of a user
+CREATE INDEX user_tokens_user_id_idx ON user_tokens (user_id, purpose);
+
+CREATE POLICY tenant_isolation ON user_tokens
+    USING (tenant_id = current_setting('app.tenant_id')::bigint);
@@ -0,0 +1,28 @@
+-- The TOTP second factor of a user, asked at login once confirmed. The
+-- secret is encrypted by the application.
+CREATE TABLE user_two_factor (
+    user_id      bigint PRIMARY KEY REFERENCES users (user_id) ON DELETE CASCADE,
+    tenant_id    bigint NOT NULL REFERENCES tenants (tenant_id) ON DELETE CASCADE,
+    secret       text NOT NULL,
+    confirmed_at timestamptz,
+    -- last_step is the time step of the last accepted code, so that a code
+    -- is accepted once
+    last_step    bigint NOT NULL DEFAULT 0,
+    created_at   timestamptz NOT NULL DEFAULT now()
+);
+
+-- The one time codes logging in without the second factor, only the SHA-256
+-- of a code is stored
+CREATE TABLE user_recovery_codes (
+    code_id   bigserial PRIMARY KEY,
+    user_id   bigint NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    tenant_id bigint NOT NULL REFERENCES tenants (tenant_id) ON DELETE CASCADE,
+    code_hash char(64) NOT NULL,
+    used_at   timestamptz,
+    UNIQUE (user_id, code_hash)
+);
+
+CREATE POLICY tenant_isolation ON user_two_factor
+    USING (tenant_id = current_setting('app.tenant_id')::bigint);
+CREATE POLICY tenant_isolation ON user_recovery_codes
+    USING (tenant_id = current_setting('app.tenant_id')::bigint);
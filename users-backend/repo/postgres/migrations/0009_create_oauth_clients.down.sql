@@ -0,0 +1,2 @@
+DROP TABLE oauth_authorization_codes;
+DROP TABLE oauth_clients;
@@ -0,0 +1,33 @@
+-- The OpenID Connect clients of a tenant. Their requests name no tenant, so
+-- clients are looked up in every tenant by their id and have no policy.
+-- Public clients have no secret.
+CREATE TABLE oauth_clients (
+    client_id     varchar(64) PRIMARY KEY,
+    tenant_id     bigint NOT NULL REFERENCES tenants (tenant_id) ON DELETE CASCADE,
+    name          text NOT NULL,
+    secret_hash   char(64),
+    redirect_uris text[] NOT NULL,
+    created_at    timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX oauth_clients_tenant_id_idx ON oauth_clients (tenant_id);
+
+-- The single use codes a client exchanges for the tokens of a user, with the
+-- request they were issued for. Only the SHA-256 of a code is stored.
+CREATE TABLE oauth_authorization_codes (
+    code_id        bigserial PRIMARY KEY,
+    client_id      varchar(64) NOT NULL REFERENCES oauth_clients (client_id) ON DELETE CASCADE,
+    user_id        bigint NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    tenant_id      bigint NOT NULL REFERENCES tenants (tenant_id) ON DELETE CASCADE,
+    code_hash      char(64) NOT NULL UNIQUE,
+    redirect_uri   text NOT NULL,
+    scope          text NOT NULL,
+    nonce          text NOT NULL,
+    code_challenge text NOT NULL,
+    auth_time      timestamptz NOT NULL,
+    expires_at     timestamptz NOT NULL,
+    used_at        timestamptz,
+    created_at     timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE POLICY tenant_isolation ON oauth_authorization_codes
+    USING (tenant_id = current_setting('app.tenant_id')::bigint);
@@ -0,0 +1,175 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"users-backend/model"
+	"users-backend/repo"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+)
+
+// wrapClientError adds ErrClientNotFound to the go-pg errors returned for
+// unknown clients
+func wrapClientError(err error) error {
+	if errors.Is(err, pg.ErrNoRows) {
+		return fmt.Errorf("%w: %w", repo.ErrClientNotFound, err)
+	}
+	return err
+}
+
+// wrapAuthorizationCodeError adds ErrAuthorizationCodeNotFound to the go-pg
+// errors returned for unknown codes
+func wrapAuthorizationCodeError(err error) error {
+	if errors.Is(err, pg.ErrNoRows) {
+		return fmt.Errorf("%w: %w", repo.ErrAuthorizationCodeNotFound, err)
+	}
+	return err
+}
+
+func (r *PostgresRepo) GetClient(ctx context.Context, client_id string) (*model.OAuthClient, error) {
+	c := &model.OAuthClient{ClientID: client_id}
+	err := r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+		return db.ModelContext(ctx, c).WherePK().Where("tenant_id = ?", tenant_id).Select()
+	})
+	if err != nil {
+		r.logError(ctx, "failed to get client", err, "client_id", client_id)
+		return nil, wrapClientError(err)
+	}
+	return c, nil
+}
+
+func (r *PostgresRepo) FindClient(ctx context.Context, client_id string) (*model.OAuthClient, error) {
+	c := &model.OAuthClient{ClientID: client_id}
+	err := r.conn(ctx).ModelContext(ctx, c).WherePK().Select()
+	if err != nil {
+		r.logError(ctx, "failed to find client", err, "client_id", client_id)
+		return nil, wrapClientError(err)
+	}
+	return c, nil
+}
+
+func (r *PostgresRepo) GetClients(ctx context.Context) (*[]model.OAuthClient, error) {
+	var clients []model.OAuthClient
+	err := r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+		return db.ModelContext(ctx, &clients).Where("tenant_id = ?", tenant_id).Order("name ASC", "client_id ASC").Select()
+	})
+	if err != nil {
+		r.logError(ctx, "failed to get clients", err)
+		return nil, err
+	}
+	if clients == nil {
+		clients = []model.OAuthClient{}
+	}
+	return &clients, nil
+}
+
+func (r *PostgresRepo) CreateClient(ctx context.Context, c *model.OAuthClient) error {
+	err := r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+		_, err := db.QueryOneContext(ctx, pg.Scan(&c.TenantID, &c.CreatedAt),
+			`INSERT INTO oauth_clients (client_id, tenant_id, name, secret_hash, redirect_uris)
+			VALUES (?, ?, ?, NULLIF(?, ''), ?)
+			RETURNING tenant_id, created_at`,
+			c.ClientID, tenant_id, c.Name, c.SecretHash, pg.Array(c.RedirectURIs))
+		return err
+	})
+	if err != nil {
+		r.logError(ctx, "failed to insert client", err, "client_id", c.ClientID)
+		return err
+	}
+	return nil
+}
+
+func (r *PostgresRepo) UpdateClient(ctx context.Context, c *model.OAuthClient) error {
+	err := r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+		res, err := db.ExecContext(ctx, "UPDATE oauth_clients SET name = ?, redirect_uris = ? WHERE tenant_id = ? AND client_id = ?",
+			c.Name, pg.Array(c.RedirectURIs), tenant_id, c.ClientID)
+		if err != nil {
+			return err
+		}
+		if res.RowsAffected() == 0 {
+			return pg.ErrNoRows
+		}
+		return nil
+	})
+	if err != nil {
+		r.logError(ctx, "failed to update client", err, "client_id", c.ClientID)
+		return wrapClientError(err)
+	}
+	return nil
+}
+
+func (r *PostgresRepo) SetClientSecret(ctx context.Context, client_id, hash string) error {
+	err := r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+		res, err := db.ExecContext(ctx, "UPDATE oauth_clients SET secret_hash = NULLIF(?, '') WHERE tenant_id = ? AND client_id = ?",
+			hash, tenant_id, client_id)
+		if err != nil {
+			return err
+		}
+		if res.RowsAffected() == 0 {
+			return pg.ErrNoRows
+		}
+		return nil
+	})
+	if err != nil {
+		r.logError(ctx, "failed to set client secret", err, "client_id", client_id)
+		return wrapClientError(err)
+	}
+	return nil
+}
+
+func (r *PostgresRepo) DeleteClient(ctx context.Context, client_id string) error {
+	// The codes of the client are deleted by the cascade
+	err := r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+		_, err := db.ExecContext(ctx, "DELETE FROM oauth_clients WHERE tenant_id = ? AND client_id = ?", tenant_id, client_id)
+		return err
+	})
+	if err != nil {
+		r.logError(ctx, "failed to delete client", err, "client_id", client_id)
+	}
+	return err
+}
+
+func (r *PostgresRepo) CreateAuthorizationCode(ctx context.Context, code *model.AuthorizationCode) error {
+	err := r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+		// Joining the user and the client keeps the code in their tenant
+		_, err := db.QueryOneContext(ctx, pg.Scan(&code.CodeID, &code.TenantID, &code.CreatedAt), `INSERT INTO oauth_authorization_codes
+				(client_id, user_id, tenant_id, code_hash, redirect_uri, scope, nonce, code_challenge, auth_time, expires_at)
+			SELECT c.client_id, u.user_id, u.tenant_id, ?, ?, ?, ?, ?, ?, ?
+			FROM users u JOIN oauth_clients c ON c.tenant_id = u.tenant_id
+			WHERE u.tenant_id = ? AND u.user_id = ? AND c.client_id = ?
+			RETURNING code_id, tenant_id, created_at`,
+			code.CodeHash, code.RedirectURI, code.Scope, code.Nonce, code.CodeChallenge, code.AuthTime, code.ExpiresAt,
+			tenant_id, code.UserID, code.ClientID)
+		return err
+	})
+	if err != nil {
+		r.logError(ctx, "failed to create authorization code", err, "client_id", code.ClientID, "user_id", code.UserID)
+		return wrapError(err)
+	}
+	return nil
+}
+
+func (r *PostgresRepo) ConsumeAuthorizationCode(ctx context.Context, hash string, now time.Time) (*model.AuthorizationCode, error) {
+	code := &model.AuthorizationCode{}
+	err := r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+		// Marking the code used in the lookup lets a single caller consume it
+		_, err := db.ModelContext(ctx, code).
+			Set("used_at = ?", now).
+			Where("tenant_id = ?", tenant_id).
+			Where("code_hash = ?", hash).
+			Where("used_at IS NULL").
+			Where("expires_at > ?", now).
+			Returning("*").
+			Update()
+		return err
+	})
+	if err != nil {
+		r.logError(ctx, "failed to consume authorization code", err)
+		return nil, wrapAuthorizationCodeError(err)
+	}
+	return code, nil
+}
@@ -1,73 +1,193 @@
 package postgres
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
+	"strconv"
+	"users-backend/logging"
 	"users-backend/model"
 	"users-backend/repo"
+	"users-backend/repo/migrate"
+	"users-backend/tenant"
 
 	"github.com/go-pg/pg/v10"
 	"github.com/go-pg/pg/v10/orm"
 )
 
 var (
-	_ repo.UserRepo = new(PostgresRepo)
+	_ repo.UserRepo              = new(PostgresRepo)
+	_ repo.TenantRepo            = new(PostgresRepo)
+	_ repo.AttributeRepo         = new(PostgresRepo)
+	_ repo.GroupRepo             = new(PostgresRepo)
+	_ repo.CredentialRepo        = new(PostgresRepo)
+	_ repo.UserTokenRepo         = new(PostgresRepo)
+	_ repo.TwoFactorRepo         = new(PostgresRepo)
+	_ repo.ClientRepo            = new(PostgresRepo)
+	_ repo.AuthorizationCodeRepo = new(PostgresRepo)
+	_ repo.Migrator              = new(PostgresRepo)
+
+	ErrSchemaMissing = errors.New("database schema is missing")
 )
 
+// PostgresRepo stores users in Postgres, its schema is created by MigrateUp
 type PostgresRepo struct {
-	db *pg.DB
+	db  *pg.DB
+	log *slog.Logger
+
+	// rowLevelSecurity runs user queries in a transaction setting
+	// app.tenant_id for the tenant_isolation policy
+	rowLevelSecurity bool
+}
+
+// Option configures a PostgresRepo
+type Option func(r *PostgresRepo)
+
+// WithRowLevelSecurity sets app.tenant_id to the tenant of every user query so
+// the tenant_isolation policy can be enforced by Postgres as well. Every user
+// query then runs in a transaction.
+func WithRowLevelSecurity() Option {
+	return func(r *PostgresRepo) {
+		r.rowLevelSecurity = true
+	}
 }
 
-func NewPostgresRepo() (*PostgresRepo, func()) {
+type txKey struct{}
+
+// pgLogger routes go-pg's internal logging (reconnects, pool errors) to slog
+type pgLogger struct {
+	log *slog.Logger
+}
+
+func (l pgLogger) Printf(ctx context.Context, format string, v ...interface{}) {
+	l.log.WarnContext(ctx, fmt.Sprintf(format, v...))
+}
+
+func NewPostgresRepo(log *slog.Logger, opts ...Option) (*PostgresRepo, func()) {
+	log = log.With("component", "postgres")
+	pg.SetLogger(pgLogger{log: log})
+
 	opt, err := pg.ParseURL(os.Getenv("DATABASE_URL"))
 	if err != nil {
 		panic(err)
 	}
 
 	db := pg.Connect(opt)
+	db.AddQueryHook(tracingHook{})
 
-	err = createSchema(db)
-	if err != nil {
-		panic(err)
+	r := &PostgresRepo{db: db, log: log}
+	for _, opt := range opts {
+		opt(r)
 	}
 
 	// Return the repo and a cleanup function to close the connection
-	return &PostgresRepo{db: db}, func() {
+	return r, func() {
 		if err := db.Close(); err != nil {
-			// log.Fatalf("Failed to close DB connection: %v", err)
-			fmt.Printf("Failed to close DB connection: %v", err)
+			log.Error("failed to close database connection", "error", err)
+			return
 		}
-		// log.Println("Database connection closed.")
-		fmt.Println("Database connection closed.")
+		log.Info("database connection closed")
 	}
 }
 
-func createSchema(db *pg.DB) error {
-	models := []interface{}{
-		(*model.User)(nil),
+// logError logs unexpected query errors, a missing row is an expected outcome
+// of lookups and is only logged at debug level
+func (r *PostgresRepo) logError(ctx context.Context, msg string, err error, args ...any) {
+	l := logging.FromContext(ctx, r.log).With(args...)
+	if errors.Is(err, pg.ErrNoRows) {
+		l.DebugContext(ctx, msg, "error", err)
+		return
 	}
+	l.ErrorContext(ctx, msg, "error", err)
+}
 
-	for _, model := range models {
-		err := db.Model(model).CreateTable(&orm.CreateTableOptions{
-			Temp:        true,
-			IfNotExists: true,
-			Varchar:     255,
-		})
-		if err != nil {
-			return err
+// wrapError adds the repo sentinel errors to the go-pg errors they stand for
+func wrapError(err error) error {
+	var pgErr pg.Error
+	switch {
+	case errors.Is(err, pg.ErrNoRows):
+		return fmt.Errorf("%w: %w", repo.ErrNotFound, err)
+	case errors.As(err, &pgErr) && pgErr.Field('C') == "23505":
+		return fmt.Errorf("%w: %w", repo.ErrDuplicateUserName, err)
+	}
+	return err
+}
+
+// conn returns the transaction started by RunInTx when ctx carries one
+func (r *PostgresRepo) conn(ctx context.Context) orm.DB {
+	if tx, ok := ctx.Value(txKey{}).(*pg.Tx); ok {
+		return tx
+	}
+	return r.db
+}
+
+func (r *PostgresRepo) RunInTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*pg.Tx); ok {
+		return fn(ctx)
+	}
+
+	return r.db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		if tenant_id, ok := tenant.ID(ctx); ok && r.rowLevelSecurity {
+			if _, err := tx.ExecContext(ctx, "SELECT set_config('app.tenant_id', ?, true)", strconv.Itoa(tenant_id)); err != nil {
+				return err
+			}
 		}
+		return fn(context.WithValue(ctx, txKey{}, tx))
+	})
+}
+
+// scoped runs fn with the tenant of ctx, inside a transaction setting
+// app.tenant_id when row level security is on
+func (r *PostgresRepo) scoped(ctx context.Context, fn func(ctx context.Context, db orm.DB, tenant_id int) error) error {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
 	}
+
+	if !r.rowLevelSecurity {
+		return fn(ctx, r.conn(ctx), tenant_id)
+	}
+	return r.RunInTx(ctx, func(ctx context.Context) error {
+		return fn(ctx, r.conn(ctx), tenant_id)
+	})
+}
+
+// Ping checks the database can be reached
+func (r *PostgresRepo) Ping(ctx context.Context) error {
+	return r.db.Ping(ctx)
+}
+
+// CheckSchema checks every migration has been applied
+func (r *PostgresRepo) CheckSchema(ctx context.Context) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	pending, err := migrate.Pending(ctx, migrationStore{db: r.db}, migrations)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrSchemaMissing, err)
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%w: migration %s is not applied", ErrSchemaMissing, pending[0])
+	}
+
 	return nil
 }
 
-func (r *PostgresRepo) GetById(user_id int) (*model.User, error) {
+func (r *PostgresRepo) GetById(ctx context.Context, user_id int) (*model.User, error) {
 	var user model.User
-	err := r.db.Model(&user).
-		Where("user_id = ?", user_id).
-		Select()
+	err := r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+		return db.ModelContext(ctx, &user).
+			Where("tenant_id = ?", tenant_id).
+			Where("user_id = ?", user_id).
+			Select()
+	})
 	if err != nil {
-		print(err)
-		return nil, err
+		r.logError(ctx, "failed to get user by id", err, "user_id", user_id)
+		return nil, wrapError(err)
 		// return nil, ErrUserNotFound{
 		// 	Message: fmt.Sprintf("User with username %s is not found", username),
 		// }
@@ -75,13 +195,17 @@ func (r *PostgresRepo) GetById(user_id int) (*model.User, error) {
 	return &user, nil
 }
 
-func (r *PostgresRepo) GetByUsername(username string) (*model.User, error) {
+func (r *PostgresRepo) GetByUsername(ctx context.Context, username string) (*model.User, error) {
 	var user model.User
-	err := r.db.Model(&user).
-		Where("user_name = ?", username).
-		Select()
+	err := r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+		return db.ModelContext(ctx, &user).
+			Where("tenant_id = ?", tenant_id).
+			Where("user_name = ?", username).
+			Select()
+	})
 	if err != nil {
-		return nil, err
+		r.logError(ctx, "failed to get user by username", err, "user_name", username)
+		return nil, wrapError(err)
 		// return nil, ErrUserNotFound{
 		// 	Message: fmt.Sprintf("User with username %s is not found", username),
 		// }
@@ -89,48 +213,223 @@ func (r *PostgresRepo) GetByUsername(username string) (*model.User, error) {
 	return &user, nil
 }
 
-func (r *PostgresRepo) GetAll() (*[]model.User, error) {
+func (r *PostgresRepo) GetAll(ctx context.Context) (*[]model.User, error) {
 	var users []model.User
-	err := r.db.Model(&users).Select()
+	err := r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+		return db.ModelContext(ctx, &users).Where("tenant_id = ?", tenant_id).Order("user_id ASC").Select()
+	})
 	if err != nil {
+		r.logError(ctx, "failed to get all users", err)
 		return nil, err
 	}
 
 	return &users, nil
 }
 
-func (r *PostgresRepo) Create(user *model.User) (int, error) {
-	_, err := r.db.Model(user).Insert()
+func (r *PostgresRepo) FindByAttributes(ctx context.Context, attributes model.Attributes) (*[]model.User, error) {
+	var users []model.User
+	err := r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+		return db.ModelContext(ctx, &users).
+			Where("tenant_id = ?", tenant_id).
+			Where("attributes @> ?", attributes).
+			Order("user_id ASC").
+			Select()
+	})
 	if err != nil {
-		return -1, err
+		r.logError(ctx, "failed to find users by attributes", err)
+		return nil, err
 	}
-	return user.UserID, nil
+
+	return &users, nil
 }
 
-func (r *PostgresRepo) Update(user *model.User) (int, error) {
-	u := &model.User{UserID: user.UserID}
-	err := r.db.Model(u).WherePK().Select()
+func (r *PostgresRepo) Create(ctx context.Context, user *model.User) (int, error) {
+	err := r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+		user.TenantID = tenant_id
+		_, err := db.ModelContext(ctx, user).Insert()
+		return err
+	})
 	if err != nil {
-		return -1, err
+		r.logError(ctx, "failed to insert user", err, "user_name", user.UserName)
+		return -1, wrapError(err)
 	}
+	return user.UserID, nil
+}
 
-	u.UserName = user.UserName
-	u.FirstName = user.FirstName
-	u.LastName = user.LastName
-	u.Email = user.Email
-	u.UserStatus = user.UserStatus
-	u.Department = user.Department
+func (r *PostgresRepo) Update(ctx context.Context, user *model.User) (int, error) {
+	u := &model.User{UserID: user.UserID}
+	err := r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+		err := db.ModelContext(ctx, u).WherePK().Where("tenant_id = ?", tenant_id).Select()
+		if err != nil {
+			r.logError(ctx, "failed to get user for update", err, "user_id", user.UserID)
+			return err
+		}
 
-	_, err = r.db.Model(u).WherePK().Update()
+		u.UserName = user.UserName
+		u.FirstName = user.FirstName
+		u.LastName = user.LastName
+		// A new email is no longer verified
+		u.EmailVerified = u.EmailVerified && u.Email == user.Email
+		u.Email = user.Email
+		u.UserStatus = user.UserStatus
+		u.Department = user.Department
+		u.ManagerID = user.ManagerID
+		if user.Attributes != nil {
+			u.Attributes = user.Attributes
+		}
+
+		_, err = db.ModelContext(ctx, u).WherePK().Where("tenant_id = ?", tenant_id).Update()
+		if err != nil {
+			r.logError(ctx, "failed to update user", err, "user_id", user.UserID)
+		}
+		return err
+	})
 	if err != nil {
-		return -1, err
+		return -1, wrapError(err)
 	}
 
+	user.TenantID = u.TenantID
 	return u.UserID, nil
 }
 
-func (r *PostgresRepo) Delete(user_id int) error {
+func (r *PostgresRepo) Delete(ctx context.Context, user_id int) error {
 	user := &model.User{UserID: user_id}
-	_, err := r.db.Model(user).WherePK().Delete()
+	err := r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+		_, err := db.ModelContext(ctx, user).WherePK().Where("tenant_id = ?", tenant_id).Delete()
+		return err
+	})
+	if err != nil {
+		r.logError(ctx, "failed to delete user", err, "user_id", user_id)
+	}
 	return err
 }
+
+func (r *PostgresRepo) GetDirectReports(ctx context.Context, manager_id int) (*[]model.User, error) {
+	var users []model.User
+	err := r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+		return db.ModelContext(ctx, &users).
+			Where("tenant_id = ?", tenant_id).
+			Where("manager_id = ?", manager_id).
+			Order("user_id ASC").
+			Select()
+	})
+	if err != nil {
+		r.logError(ctx, "failed to get direct reports", err, "user_id", manager_id)
+		return nil, err
+	}
+
+	return &users, nil
+}
+
+// The recursive queries keep the ids visited in path, so a cycle written
+// outside the controller ends the walk instead of looping
+
+func (r *PostgresRepo) GetManagementChain(ctx context.Context, user_id int) (*[]model.User, error) {
+	users := []model.User{}
+	err := r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+		_, err := db.QueryContext(ctx, &users, `WITH RECURSIVE chain (user_id, depth, path) AS (
+			SELECT manager_id, 1, ARRAY[user_id, manager_id] FROM users
+			WHERE tenant_id = ?0 AND user_id = ?1 AND manager_id IS NOT NULL
+			UNION ALL
+			SELECT u.manager_id, c.depth + 1, c.path || u.manager_id FROM users u JOIN chain c ON u.user_id = c.user_id
+			WHERE u.tenant_id = ?0 AND u.manager_id IS NOT NULL AND NOT u.manager_id = ANY (c.path)
+		)
+		SELECT users.* FROM users JOIN chain USING (user_id) WHERE users.tenant_id = ?0 ORDER BY chain.depth`, tenant_id, user_id)
+		return err
+	})
+	if err != nil {
+		r.logError(ctx, "failed to get management chain", err, "user_id", user_id)
+		return nil, err
+	}
+
+	return &users, nil
+}
+
+func (r *PostgresRepo) GetSubordinates(ctx context.Context, manager_id int) (*[]model.User, error) {
+	users := []model.User{}
+	err := r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+		_, err := db.QueryContext(ctx, &users, `WITH RECURSIVE subtree (user_id, depth, path) AS (
+			SELECT user_id, 1, ARRAY[manager_id, user_id] FROM users
+			WHERE tenant_id = ?0 AND manager_id = ?1
+			UNION ALL
+			SELECT u.user_id, s.depth + 1, s.path || u.user_id FROM users u JOIN subtree s ON u.manager_id = s.user_id
+			WHERE u.tenant_id = ?0 AND NOT u.user_id = ANY (s.path)
+		)
+		SELECT users.* FROM users JOIN subtree USING (user_id) ORDER BY subtree.depth, users.user_id`, tenant_id, manager_id)
+		return err
+	})
+	if err != nil {
+		r.logError(ctx, "failed to get subordinates", err, "user_id", manager_id)
+		return nil, err
+	}
+
+	return &users, nil
+}
+
+func (r *PostgresRepo) ReassignReports(ctx context.Context, from_manager_id, to_manager_id int) (int, error) {
+	// NULL leaves the reports without manager
+	var manager any
+	if to_manager_id != 0 {
+		manager = to_manager_id
+	}
+
+	var n int
+	err := r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+		res, err := db.ExecContext(ctx, "UPDATE users SET manager_id = ? WHERE tenant_id = ? AND manager_id = ?", manager, tenant_id, from_manager_id)
+		if err != nil {
+			return err
+		}
+		n = res.RowsAffected()
+		return nil
+	})
+	if err != nil {
+		r.logError(ctx, "failed to reassign reports", err, "user_id", from_manager_id, "manager_id", to_manager_id)
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// hierarchyLock and groupHierarchyLock are the first keys of the advisory
+// locks on the management and group hierarchies, the second one is the tenant
+// id. attributeLock is the first key of the locks on an attribute, the second
+// one a hash of the tenant id and attribute name.
+const (
+	hierarchyLock      = 0x75736572
+	groupHierarchyLock = 0x67727073
+	attributeLock      = 0x61747472
+)
+
+// LockHierarchy takes a transaction level advisory lock rather than locking
+// the rows of the chain, which is only known once read and would deadlock
+// two updates locking it in opposite orders
+func (r *PostgresRepo) LockHierarchy(ctx context.Context) error {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.conn(ctx).ExecContext(ctx, "SELECT pg_advisory_xact_lock(?, ?)", hierarchyLock, tenant_id)
+	if err != nil {
+		r.logError(ctx, "failed to lock hierarchy", err)
+		return err
+	}
+	return nil
+}
+
+// LockAttribute takes a transaction level advisory lock as the values of the
+// attributes live in a JSON column no unique index covers. Two attributes
+// whose keys collide only wait for each other.
+func (r *PostgresRepo) LockAttribute(ctx context.Context, name string) error {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.conn(ctx).ExecContext(ctx, "SELECT pg_advisory_xact_lock(?, hashtext(? || '/' || ?))", attributeLock, tenant_id, name)
+	if err != nil {
+		r.logError(ctx, "failed to lock attribute", err, "attribute", name)
+		return err
+	}
+	return nil
+}
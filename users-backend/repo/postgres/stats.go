@@ -0,0 +1,46 @@
+package postgres
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	_ prometheus.Collector = new(PoolStatsCollector)
+
+	poolHits       = prometheus.NewDesc("users_pg_pool_hits_total", "Number of times a free connection was found in the pool.", nil, nil)
+	poolMisses     = prometheus.NewDesc("users_pg_pool_misses_total", "Number of times a free connection was not found in the pool.", nil, nil)
+	poolTimeouts   = prometheus.NewDesc("users_pg_pool_timeouts_total", "Number of times a wait for a connection timed out.", nil, nil)
+	poolTotalConns = prometheus.NewDesc("users_pg_pool_connections", "Number of connections in the pool.", nil, nil)
+	poolIdleConns  = prometheus.NewDesc("users_pg_pool_idle_connections", "Number of idle connections in the pool.", nil, nil)
+	poolStaleConns = prometheus.NewDesc("users_pg_pool_stale_connections_total", "Number of stale connections removed from the pool.", nil, nil)
+)
+
+// PoolStatsCollector exports the go-pg connection pool stats of a PostgresRepo
+// at scrape time
+type PoolStatsCollector struct {
+	repo *PostgresRepo
+}
+
+func NewPoolStatsCollector(r *PostgresRepo) *PoolStatsCollector {
+	return &PoolStatsCollector{repo: r}
+}
+
+func (c *PoolStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- poolHits
+	ch <- poolMisses
+	ch <- poolTimeouts
+	ch <- poolTotalConns
+	ch <- poolIdleConns
+	ch <- poolStaleConns
+}
+
+func (c *PoolStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.repo.db.PoolStats()
+
+	ch <- prometheus.MustNewConstMetric(poolHits, prometheus.CounterValue, float64(stats.Hits))
+	ch <- prometheus.MustNewConstMetric(poolMisses, prometheus.CounterValue, float64(stats.Misses))
+	ch <- prometheus.MustNewConstMetric(poolTimeouts, prometheus.CounterValue, float64(stats.Timeouts))
+	ch <- prometheus.MustNewConstMetric(poolTotalConns, prometheus.GaugeValue, float64(stats.TotalConns))
+	ch <- prometheus.MustNewConstMetric(poolIdleConns, prometheus.GaugeValue, float64(stats.IdleConns))
+	ch <- prometheus.MustNewConstMetric(poolStaleConns, prometheus.CounterValue, float64(stats.StaleConns))
+}
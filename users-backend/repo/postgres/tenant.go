@@ -0,0 +1,87 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"users-backend/model"
+	"users-backend/repo"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// wrapTenantError adds the repo sentinel errors to the go-pg errors they
+// stand for in the tenants table
+func wrapTenantError(err error) error {
+	var pgErr pg.Error
+	switch {
+	case errors.Is(err, pg.ErrNoRows):
+		return fmt.Errorf("%w: %w", repo.ErrTenantNotFound, err)
+	case errors.As(err, &pgErr) && pgErr.Field('C') == "23505":
+		return fmt.Errorf("%w: %w", repo.ErrDuplicateTenantSlug, err)
+	case errors.As(err, &pgErr) && pgErr.Field('C') == "23503":
+		return fmt.Errorf("%w: %w", repo.ErrTenantInUse, err)
+	}
+	return err
+}
+
+func (r *PostgresRepo) GetTenant(ctx context.Context, tenant_id int) (*model.Tenant, error) {
+	t := &model.Tenant{TenantID: tenant_id}
+	err := r.conn(ctx).ModelContext(ctx, t).WherePK().Select()
+	if err != nil {
+		r.logError(ctx, "failed to get tenant by id", err, "tenant_id", tenant_id)
+		return nil, wrapTenantError(err)
+	}
+	return t, nil
+}
+
+func (r *PostgresRepo) GetTenantBySlug(ctx context.Context, slug string) (*model.Tenant, error) {
+	var t model.Tenant
+	err := r.conn(ctx).ModelContext(ctx, &t).Where("slug = ?", slug).Select()
+	if err != nil {
+		r.logError(ctx, "failed to get tenant by slug", err, "tenant_slug", slug)
+		return nil, wrapTenantError(err)
+	}
+	return &t, nil
+}
+
+func (r *PostgresRepo) GetAllTenants(ctx context.Context) (*[]model.Tenant, error) {
+	var tenants []model.Tenant
+	err := r.conn(ctx).ModelContext(ctx, &tenants).Order("tenant_id ASC").Select()
+	if err != nil {
+		r.logError(ctx, "failed to get all tenants", err)
+		return nil, err
+	}
+	return &tenants, nil
+}
+
+func (r *PostgresRepo) CreateTenant(ctx context.Context, t *model.Tenant) (int, error) {
+	_, err := r.conn(ctx).ModelContext(ctx, t).Insert()
+	if err != nil {
+		r.logError(ctx, "failed to insert tenant", err, "tenant_slug", t.Slug)
+		return -1, wrapTenantError(err)
+	}
+	return t.TenantID, nil
+}
+
+func (r *PostgresRepo) UpdateTenant(ctx context.Context, t *model.Tenant) (int, error) {
+	res, err := r.conn(ctx).ModelContext(ctx, t).Column("slug", "name").WherePK().Update()
+	if err != nil {
+		r.logError(ctx, "failed to update tenant", err, "tenant_id", t.TenantID)
+		return -1, wrapTenantError(err)
+	}
+	if res.RowsAffected() == 0 {
+		r.logError(ctx, "failed to get tenant for update", pg.ErrNoRows, "tenant_id", t.TenantID)
+		return -1, wrapTenantError(pg.ErrNoRows)
+	}
+	return t.TenantID, nil
+}
+
+func (r *PostgresRepo) DeleteTenant(ctx context.Context, tenant_id int) error {
+	_, err := r.conn(ctx).ModelContext(ctx, &model.Tenant{TenantID: tenant_id}).WherePK().Delete()
+	if err != nil {
+		r.logError(ctx, "failed to delete tenant", err, "tenant_id", tenant_id)
+		return wrapTenantError(err)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package test
+
+import (
+	"os"
+	"testing"
+	"users-backend/logging"
+	"users-backend/repo"
+	"users-backend/repo/postgres"
+	"users-backend/repo/repotest"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+// The specs need a disposable database, every user, attribute, group and tenant
+// in it is deleted before each spec. They are skipped unless TEST_DATABASE_URL is set.
+func newRepo(opts ...postgres.Option) (*postgres.PostgresRepo, func()) {
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	if databaseURL == "" {
+		ginkgo.Skip("TEST_DATABASE_URL is not set")
+	}
+	ginkgo.GinkgoT().Setenv("DATABASE_URL", databaseURL)
+
+	r, cleanup := postgres.NewPostgresRepo(logging.Discard(), opts...)
+	repotest.Migrate(r)
+	repotest.Reset(r, r, r, r)
+
+	return r, cleanup
+}
+
+var _ = repotest.Describe("PostgresRepo", func() (repo.UserRepo, func()) {
+	return newRepo()
+})
+
+var _ = repotest.DescribeTenants("PostgresRepo", func() (repo.TenantRepo, repo.UserRepo, func()) {
+	r, cleanup := newRepo()
+	return r, r, cleanup
+})
+
+var _ = repotest.DescribeAttributes("PostgresRepo", func() (repo.AttributeRepo, repo.UserRepo, func()) {
+	r, cleanup := newRepo()
+	return r, r, cleanup
+})
+
+var _ = repotest.DescribeGroups("PostgresRepo", func() (repo.GroupRepo, repo.UserRepo, func()) {
+	r, cleanup := newRepo()
+	return r, r, cleanup
+})
+
+var _ = repotest.DescribeCredentials("PostgresRepo", func() (repo.CredentialRepo, repo.UserRepo, func()) {
+	r, cleanup := newRepo()
+	return r, r, cleanup
+})
+
+var _ = repotest.DescribeUserTokens("PostgresRepo", func() (repo.UserTokenRepo, repo.UserRepo, func()) {
+	r, cleanup := newRepo()
+	return r, r, cleanup
+})
+
+var _ = repotest.DescribeTwoFactor("PostgresRepo", func() (repo.TwoFactorRepo, repo.UserRepo, func()) {
+	r, cleanup := newRepo()
+	return r, r, cleanup
+})
+
+var _ = repotest.DescribeOAuth("PostgresRepo", func() (repo.ClientRepo, repo.AuthorizationCodeRepo, repo.UserRepo, func()) {
+	r, cleanup := newRepo()
+	repotest.ResetClients(r)
+	return r, r, r, cleanup
+})
+
+// Row level security is only enforced for roles that do not own users or once
+// it is forced, these specs check the repo keeps working with it enabled
+var _ = repotest.Describe("PostgresRepo with row level security", func() (repo.UserRepo, func()) {
+	return newRepo(postgres.WithRowLevelSecurity())
+})
+
+func TestPostgresRepo(t *testing.T) {
+	gomega.RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "Postgres Repo Suite")
+}
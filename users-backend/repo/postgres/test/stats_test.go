@@ -0,0 +1,61 @@
+package test
+
+import (
+	"context"
+	"strings"
+	"users-backend/repo/postgres"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var _ = ginkgo.Describe("PoolStatsCollector", func() {
+	var (
+		r       *postgres.PostgresRepo
+		c       *postgres.PoolStatsCollector
+		cleanup func()
+	)
+
+	ginkgo.BeforeEach(func() {
+		r, cleanup = newRepo()
+		c = postgres.NewPoolStatsCollector(r)
+	})
+
+	ginkgo.AfterEach(func() {
+		cleanup()
+	})
+
+	ginkgo.It("should export the pool stats", func() {
+		gomega.Expect(testutil.CollectAndCount(c)).Should(gomega.Equal(6))
+
+		problems, err := testutil.CollectAndLint(c)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(problems).Should(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should report the connections of the pool", func() {
+		_, err := r.GetAllTenants(context.Background())
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+		registry := prometheus.NewPedanticRegistry()
+		registry.MustRegister(c)
+		families, err := registry.Gather()
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+		values := map[string]float64{}
+		for _, f := range families {
+			m := f.GetMetric()[0]
+			if strings.HasSuffix(f.GetName(), "_total") {
+				values[f.GetName()] = m.GetCounter().GetValue()
+			} else {
+				values[f.GetName()] = m.GetGauge().GetValue()
+			}
+		}
+		gomega.Expect(values["users_pg_pool_connections"]).Should(gomega.BeNumerically(">=", 1))
+		gomega.Expect(values["users_pg_pool_idle_connections"]).Should(gomega.BeNumerically("<=", values["users_pg_pool_connections"]))
+		gomega.Expect(values["users_pg_pool_hits_total"] + values["users_pg_pool_misses_total"]).Should(gomega.BeNumerically(">=", 1))
+		gomega.Expect(values["users_pg_pool_timeouts_total"]).Should(gomega.BeZero())
+	})
+})
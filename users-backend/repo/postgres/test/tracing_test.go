@@ -0,0 +1,108 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"users-backend/model"
+	"users-backend/repo"
+	"users-backend/repo/postgres"
+	"users-backend/tenant"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// spans records the query spans of the whole suite, the repo tracer is only
+// bound to the first global provider so it is installed once
+var spans = func() *tracetest.SpanRecorder {
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	return sr
+}()
+
+var _ = ginkgo.Describe("PostgresRepo tracing", func() {
+	var (
+		r       *postgres.PostgresRepo
+		cleanup func()
+		ctx     = tenant.WithID(context.Background(), model.DefaultTenantID)
+		mark    int
+	)
+
+	// ended returns the spans of name ended since the spec started
+	ended := func(name string) []sdktrace.ReadOnlySpan {
+		var found []sdktrace.ReadOnlySpan
+		for _, s := range spans.Ended()[mark:] {
+			if s.Name() == name {
+				found = append(found, s)
+			}
+		}
+		gomega.Expect(found).ShouldNot(gomega.BeEmpty(), fmt.Sprintf("no span %q was ended", name))
+		return found
+	}
+
+	attributes := func(s sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+		a := map[attribute.Key]attribute.Value{}
+		for _, kv := range s.Attributes() {
+			a[kv.Key] = kv.Value
+		}
+		return a
+	}
+
+	user := func() *model.User {
+		return &model.User{UserName: "traced.user", FirstName: "Traced", LastName: "User", Email: "traced.user@email.com", UserStatus: model.Active}
+	}
+
+	ginkgo.BeforeEach(func() {
+		r, cleanup = newRepo()
+		mark = len(spans.Ended())
+	})
+
+	ginkgo.AfterEach(func() {
+		cleanup()
+	})
+
+	ginkgo.It("should start a client span per query without the parameter values", func() {
+		id, err := r.Create(ctx, user())
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		_, err = r.GetById(ctx, id)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+		s := ended("SELECT users")[0]
+		gomega.Expect(s.SpanKind()).Should(gomega.Equal(trace.SpanKindClient))
+		gomega.Expect(attributes(s)).Should(gomega.HaveKeyWithValue(attribute.Key("db.system"), attribute.StringValue("postgresql")))
+		gomega.Expect(attributes(s)).Should(gomega.HaveKeyWithValue(attribute.Key("db.operation.name"), attribute.StringValue("SELECT")))
+		gomega.Expect(attributes(s)).Should(gomega.HaveKeyWithValue(attribute.Key("db.response.returned_rows"), attribute.IntValue(1)))
+		gomega.Expect(s.Status().Code).Should(gomega.Equal(codes.Unset))
+
+		for _, s := range ended("INSERT users") {
+			query := attributes(s)[attribute.Key("db.query.text")].AsString()
+			gomega.Expect(query).ShouldNot(gomega.BeEmpty())
+			gomega.Expect(query).ShouldNot(gomega.ContainSubstring("traced.user"))
+		}
+	})
+
+	ginkgo.It("should not mark a missing row as an error", func() {
+		_, err := r.GetById(ctx, 1<<30)
+		gomega.Expect(err).Should(gomega.MatchError(repo.ErrNotFound))
+
+		gomega.Expect(ended("SELECT users")[0].Status().Code).Should(gomega.Equal(codes.Unset))
+	})
+
+	ginkgo.It("should record the error of a failed query", func() {
+		_, err := r.Create(ctx, user())
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		_, err = r.Create(ctx, user())
+		gomega.Expect(err).Should(gomega.MatchError(repo.ErrDuplicateUserName))
+
+		inserts := ended("INSERT users")
+		failed := inserts[len(inserts)-1]
+		gomega.Expect(failed.Status().Code).Should(gomega.Equal(codes.Error))
+		gomega.Expect(failed.Events()).Should(gomega.ContainElement(gomega.HaveField("Name", "exception")))
+	})
+})
@@ -0,0 +1,81 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"users-backend/model"
+	"users-backend/repo"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+)
+
+// wrapUserTokenError adds ErrUserTokenNotFound to the go-pg errors returned
+// for unknown tokens
+func wrapUserTokenError(err error) error {
+	if errors.Is(err, pg.ErrNoRows) {
+		return fmt.Errorf("%w: %w", repo.ErrUserTokenNotFound, err)
+	}
+	return err
+}
+
+func (r *PostgresRepo) CreateUserToken(ctx context.Context, t *model.UserToken) (int, error) {
+	err := r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+		if _, err := db.ExecContext(ctx, "DELETE FROM user_tokens WHERE tenant_id = ? AND user_id = ? AND purpose = ?", tenant_id, t.UserID, t.Purpose); err != nil {
+			return err
+		}
+
+		// Selecting the user keeps the token in its tenant
+		_, err := db.QueryOneContext(ctx, pg.Scan(&t.TokenID, &t.TenantID, &t.CreatedAt), `INSERT INTO user_tokens (user_id, tenant_id, purpose, token_hash, email, expires_at)
+			SELECT user_id, tenant_id, ?, ?, ?, ? FROM users WHERE tenant_id = ? AND user_id = ?
+			RETURNING token_id, tenant_id, created_at`,
+			t.Purpose, t.TokenHash, t.Email, t.ExpiresAt, tenant_id, t.UserID)
+		return err
+	})
+	if err != nil {
+		r.logError(ctx, "failed to create user token", err, "user_id", t.UserID, "purpose", t.Purpose)
+		return -1, wrapError(err)
+	}
+	return t.TokenID, nil
+}
+
+func (r *PostgresRepo) ConsumeUserToken(ctx context.Context, purpose, hash string, now time.Time) (*model.UserToken, error) {
+	t := &model.UserToken{}
+	err := r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+		// Marking the token used in the lookup lets a single caller consume it
+		_, err := db.ModelContext(ctx, t).
+			Set("used_at = ?", now).
+			Where("tenant_id = ?", tenant_id).
+			Where("purpose = ?", purpose).
+			Where("token_hash = ?", hash).
+			Where("used_at IS NULL").
+			Where("expires_at > ?", now).
+			Returning("*").
+			Update()
+		return err
+	})
+	if err != nil {
+		r.logError(ctx, "failed to consume user token", err, "purpose", purpose)
+		return nil, wrapUserTokenError(err)
+	}
+	return t, nil
+}
+
+func (r *PostgresRepo) MarkEmailVerified(ctx context.Context, user_id int, email string) (bool, error) {
+	var verified bool
+	err := r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+		res, err := db.ExecContext(ctx, "UPDATE users SET email_verified = true WHERE tenant_id = ? AND user_id = ? AND email = ?", tenant_id, user_id, email)
+		if err != nil {
+			return err
+		}
+		verified = res.RowsAffected() > 0
+		return nil
+	})
+	if err != nil {
+		r.logError(ctx, "failed to mark email verified", err, "user_id", user_id)
+		return false, err
+	}
+	return verified, nil
+}
@@ -0,0 +1,72 @@
+package postgres
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	_ pg.QueryHook = tracingHook{}
+
+	tracer = otel.Tracer("users-backend/repo/postgres")
+)
+
+// tracingHook starts a client span for every query go-pg runs. Only the
+// unformatted query is recorded so parameter values (emails, names) never end
+// up in the trace backend.
+type tracingHook struct{}
+
+type querySpanKey struct{}
+
+func (tracingHook) BeforeQuery(ctx context.Context, evt *pg.QueryEvent) (context.Context, error) {
+	query, err := evt.UnformattedQuery()
+	if err != nil {
+		return ctx, nil
+	}
+
+	operation := string(query)
+	if i := strings.IndexByte(operation, ' '); i > 0 {
+		operation = operation[:i]
+	}
+
+	name := operation
+	if tm, ok := evt.Model.(orm.TableModel); ok {
+		name += " " + strings.Trim(string(tm.Table().SQLName), `"`)
+	}
+
+	ctx, span := tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.operation.name", operation),
+			attribute.String("db.query.text", string(query)),
+		),
+	)
+
+	return context.WithValue(ctx, querySpanKey{}, span), nil
+}
+
+func (tracingHook) AfterQuery(ctx context.Context, evt *pg.QueryEvent) error {
+	span, ok := ctx.Value(querySpanKey{}).(trace.Span)
+	if !ok {
+		return nil
+	}
+
+	if evt.Err != nil && evt.Err != pg.ErrNoRows {
+		span.RecordError(evt.Err)
+		span.SetStatus(codes.Error, evt.Err.Error())
+	}
+	if evt.Result != nil {
+		span.SetAttributes(attribute.Int("db.response.returned_rows", evt.Result.RowsReturned()))
+	}
+	span.End()
+
+	return nil
+}
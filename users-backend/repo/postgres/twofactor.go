@@ -0,0 +1,191 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"users-backend/model"
+	"users-backend/repo"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+)
+
+// wrapTwoFactorError adds ErrTwoFactorNotFound to the go-pg errors returned
+// for users without second factor
+func wrapTwoFactorError(err error) error {
+	if errors.Is(err, pg.ErrNoRows) {
+		return fmt.Errorf("%w: %w", repo.ErrTwoFactorNotFound, err)
+	}
+	return err
+}
+
+func (r *PostgresRepo) GetTwoFactor(ctx context.Context, user_id int) (*model.TwoFactor, error) {
+	t := &model.TwoFactor{UserID: user_id}
+	err := r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+		return db.ModelContext(ctx, t).WherePK().Where("tenant_id = ?", tenant_id).Select()
+	})
+	if err != nil {
+		r.logError(ctx, "failed to get two-factor", err, "user_id", user_id)
+		return nil, wrapTwoFactorError(err)
+	}
+	return t, nil
+}
+
+func (r *PostgresRepo) EnrollTwoFactor(ctx context.Context, user_id int, secret string) error {
+	err := r.RunInTx(ctx, func(ctx context.Context) error {
+		return r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+			if _, err := db.ExecContext(ctx, "DELETE FROM user_recovery_codes WHERE tenant_id = ? AND user_id = ?", tenant_id, user_id); err != nil {
+				return err
+			}
+
+			// Selecting the user keeps the factor in its tenant
+			res, err := db.ExecContext(ctx, `INSERT INTO user_two_factor (user_id, tenant_id, secret, confirmed_at, last_step, created_at)
+				SELECT user_id, tenant_id, ?, NULL, 0, now() FROM users WHERE tenant_id = ? AND user_id = ?
+				ON CONFLICT (user_id) DO UPDATE SET secret = excluded.secret, confirmed_at = NULL, last_step = 0, created_at = excluded.created_at`,
+				secret, tenant_id, user_id)
+			if err != nil {
+				return err
+			}
+			if res.RowsAffected() == 0 {
+				return pg.ErrNoRows
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		r.logError(ctx, "failed to enroll two-factor", err, "user_id", user_id)
+		return wrapError(err)
+	}
+	return nil
+}
+
+func (r *PostgresRepo) ConfirmTwoFactor(ctx context.Context, user_id int, step int64, codeHashes []string) error {
+	err := r.RunInTx(ctx, func(ctx context.Context) error {
+		return r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+			res, err := db.ExecContext(ctx, "UPDATE user_two_factor SET confirmed_at = now(), last_step = ? WHERE tenant_id = ? AND user_id = ? AND confirmed_at IS NULL",
+				step, tenant_id, user_id)
+			if err != nil {
+				return err
+			}
+			if res.RowsAffected() == 0 {
+				return pg.ErrNoRows
+			}
+			return replaceRecoveryCodes(ctx, db, tenant_id, user_id, codeHashes)
+		})
+	})
+	if err != nil {
+		r.logError(ctx, "failed to confirm two-factor", err, "user_id", user_id)
+		return wrapTwoFactorError(err)
+	}
+	return nil
+}
+
+func (r *PostgresRepo) UseTwoFactorStep(ctx context.Context, user_id int, step int64) (bool, error) {
+	var used bool
+	err := r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+		res, err := db.ExecContext(ctx, "UPDATE user_two_factor SET last_step = ? WHERE tenant_id = ? AND user_id = ? AND last_step < ?",
+			step, tenant_id, user_id, step)
+		if err != nil {
+			return err
+		}
+		used = res.RowsAffected() > 0
+		return nil
+	})
+	if err != nil {
+		r.logError(ctx, "failed to use two-factor step", err, "user_id", user_id)
+		return false, err
+	}
+	return used, nil
+}
+
+func (r *PostgresRepo) DeleteTwoFactor(ctx context.Context, user_id int) error {
+	err := r.RunInTx(ctx, func(ctx context.Context) error {
+		return r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+			if _, err := db.ExecContext(ctx, "DELETE FROM user_recovery_codes WHERE tenant_id = ? AND user_id = ?", tenant_id, user_id); err != nil {
+				return err
+			}
+			_, err := db.ExecContext(ctx, "DELETE FROM user_two_factor WHERE tenant_id = ? AND user_id = ?", tenant_id, user_id)
+			return err
+		})
+	})
+	if err != nil {
+		r.logError(ctx, "failed to delete two-factor", err, "user_id", user_id)
+	}
+	return err
+}
+
+func (r *PostgresRepo) ReplaceRecoveryCodes(ctx context.Context, user_id int, codeHashes []string) error {
+	err := r.RunInTx(ctx, func(ctx context.Context) error {
+		return r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+			return replaceRecoveryCodes(ctx, db, tenant_id, user_id, codeHashes)
+		})
+	})
+	if err != nil {
+		r.logError(ctx, "failed to replace recovery codes", err, "user_id", user_id)
+		return wrapTwoFactorError(err)
+	}
+	return nil
+}
+
+// replaceRecoveryCodes swaps the codes of the user in the transaction db, it
+// returns pg.ErrNoRows when the user has no second factor
+func replaceRecoveryCodes(ctx context.Context, db orm.DB, tenant_id, user_id int, codeHashes []string) error {
+	exists, err := db.ModelContext(ctx, (*model.TwoFactor)(nil)).Where("tenant_id = ?", tenant_id).Where("user_id = ?", user_id).Exists()
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return pg.ErrNoRows
+	}
+
+	if _, err := db.ExecContext(ctx, "DELETE FROM user_recovery_codes WHERE tenant_id = ? AND user_id = ?", tenant_id, user_id); err != nil {
+		return err
+	}
+	if len(codeHashes) == 0 {
+		return nil
+	}
+
+	codes := make([]model.RecoveryCode, len(codeHashes))
+	for i, hash := range codeHashes {
+		codes[i] = model.RecoveryCode{UserID: user_id, TenantID: tenant_id, CodeHash: hash}
+	}
+	_, err = db.ModelContext(ctx, &codes).Insert()
+	return err
+}
+
+func (r *PostgresRepo) UseRecoveryCode(ctx context.Context, user_id int, codeHash string) (bool, error) {
+	var used bool
+	err := r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+		res, err := db.ExecContext(ctx, "UPDATE user_recovery_codes SET used_at = now() WHERE tenant_id = ? AND user_id = ? AND code_hash = ? AND used_at IS NULL",
+			tenant_id, user_id, codeHash)
+		if err != nil {
+			return err
+		}
+		used = res.RowsAffected() > 0
+		return nil
+	})
+	if err != nil {
+		r.logError(ctx, "failed to use recovery code", err, "user_id", user_id)
+		return false, err
+	}
+	return used, nil
+}
+
+func (r *PostgresRepo) CountRecoveryCodes(ctx context.Context, user_id int) (int, error) {
+	var n int
+	err := r.scoped(ctx, func(ctx context.Context, db orm.DB, tenant_id int) error {
+		var err error
+		n, err = db.ModelContext(ctx, (*model.RecoveryCode)(nil)).
+			Where("tenant_id = ?", tenant_id).
+			Where("user_id = ?", user_id).
+			Where("used_at IS NULL").
+			Count()
+		return err
+	})
+	if err != nil {
+		r.logError(ctx, "failed to count recovery codes", err, "user_id", user_id)
+		return 0, err
+	}
+	return n, nil
+}
@@ -0,0 +1,1556 @@
+// Package repotest is a conformance suite for repo.UserRepo implementations.
+// Register it from a ginkgo test package of the implementation:
+//
+//	var _ = repotest.Describe("SQLiteRepo", func() (repo.UserRepo, func()) {
+//		r, cleanup := sqlite.NewSQLiteRepo("sqlite://"+filepath.Join(ginkgo.GinkgoT().TempDir(), "users.db"), logging.Discard())
+//		repotest.Migrate(r)
+//		return r, cleanup
+//	})
+//
+// Repos that also store tenants, attribute definitions, groups, credentials,
+// user tokens, second factors or OAuth clients register DescribeTenants,
+// DescribeAttributes, DescribeGroups, DescribeCredentials, DescribeUserTokens,
+// DescribeTwoFactor and DescribeOAuth the same way.
+package repotest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"users-backend/model"
+	"users-backend/repo"
+	"users-backend/tenant"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+// Factory returns an empty repo and a function releasing it, it is called
+// before every spec
+type Factory func() (repo.UserRepo, func())
+
+// TenantFactory returns a repo holding only the default tenant, the UserRepo
+// on top of the same database and a function releasing them
+type TenantFactory func() (repo.TenantRepo, repo.UserRepo, func())
+
+// AttributeFactory returns a repo without attribute definitions, the UserRepo
+// on top of the same database and a function releasing them
+type AttributeFactory func() (repo.AttributeRepo, repo.UserRepo, func())
+
+// GroupFactory returns a repo without groups, the UserRepo on top of the same
+// database and a function releasing them
+type GroupFactory func() (repo.GroupRepo, repo.UserRepo, func())
+
+// CredentialFactory returns a repo without credentials, the UserRepo on top
+// of the same database and a function releasing them
+type CredentialFactory func() (repo.CredentialRepo, repo.UserRepo, func())
+
+// UserTokenFactory returns a repo without tokens, the UserRepo on top of the
+// same database and a function releasing them
+type UserTokenFactory func() (repo.UserTokenRepo, repo.UserRepo, func())
+
+// TwoFactorFactory returns a repo without second factors, the UserRepo on top
+// of the same database and a function releasing them
+type TwoFactorFactory func() (repo.TwoFactorRepo, repo.UserRepo, func())
+
+// OAuthFactory returns a repo without OAuth clients, the repo storing their
+// authorization codes and the UserRepo on top of the same database and a
+// function releasing them
+type OAuthFactory func() (repo.ClientRepo, repo.AuthorizationCodeRepo, repo.UserRepo, func())
+
+// otherTenantID is a tenant the specs never create users in
+const otherTenantID = model.DefaultTenantID + 4241
+
+const concurrentWriters = 20
+
+func newUser(userName string) *model.User {
+	return &model.User{
+		UserName:   userName,
+		FirstName:  "John",
+		LastName:   "Doe",
+		Email:      userName + "@email.com",
+		UserStatus: model.Active,
+		Department: sql.NullString{String: "IT", Valid: true},
+	}
+}
+
+// Migrate applies every migration of m, for factories of repos whose schema
+// is created by MigrateUp
+func Migrate(m repo.Migrator) {
+	_, err := m.MigrateUp(context.Background())
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+}
+
+// Reset deletes every user, attribute definition, group and tenant but the
+// default one, for factories of repos that are not empty to begin with
+func Reset(t repo.TenantRepo, u repo.UserRepo, a repo.AttributeRepo, g repo.GroupRepo) {
+	ctx := context.Background()
+	tenants, err := t.GetAllTenants(ctx)
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	for _, tn := range *tenants {
+		ctx := tenant.WithID(ctx, tn.TenantID)
+		users, err := u.GetAll(ctx)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		for _, user := range *users {
+			gomega.Expect(u.Delete(ctx, user.UserID)).Should(gomega.Succeed())
+		}
+		defs, err := a.GetAttributes(ctx)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		for _, def := range *defs {
+			gomega.Expect(a.DeleteAttribute(ctx, def.AttributeID)).Should(gomega.Succeed())
+		}
+		groups, err := g.GetGroups(ctx)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		for _, group := range *groups {
+			gomega.Expect(g.DeleteGroup(ctx, group.GroupID)).Should(gomega.Succeed())
+		}
+
+		if tn.TenantID != model.DefaultTenantID {
+			gomega.Expect(t.DeleteTenant(ctx, tn.TenantID)).Should(gomega.Succeed())
+		}
+	}
+}
+
+// Describe registers the conformance specs for the repos built by newRepo
+func Describe(name string, newRepo Factory) bool {
+	return ginkgo.Describe(name+" conformance", func() {
+		var (
+			r       repo.UserRepo
+			cleanup func()
+			ctx     = tenant.WithID(context.Background(), model.DefaultTenantID)
+		)
+
+		create := func(userName string) *model.User {
+			user := newUser(userName)
+			id, err := r.Create(ctx, user)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(id).Should(gomega.Equal(user.UserID))
+			return user
+		}
+
+		ginkgo.BeforeEach(func() {
+			r, cleanup = newRepo()
+		})
+
+		ginkgo.AfterEach(func() {
+			cleanup()
+		})
+
+		ginkgo.Describe("Create", func() {
+			ginkgo.It("should assign an id and store every field", func() {
+				user := create("johndoe")
+				gomega.Expect(user.UserID).Should(gomega.BeNumerically(">", 0))
+
+				gomega.Expect(user.TenantID).Should(gomega.Equal(model.DefaultTenantID))
+
+				byID, err := r.GetById(ctx, user.UserID)
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+				gomega.Expect(byID).Should(gomega.Equal(user))
+
+				byName, err := r.GetByUsername(ctx, "johndoe")
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+				gomega.Expect(byName).Should(gomega.Equal(user))
+			})
+
+			ginkgo.It("should keep a missing department as null", func() {
+				user := newUser("johndoe")
+				user.Department = sql.NullString{}
+				_, err := r.Create(ctx, user)
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+				stored, err := r.GetById(ctx, user.UserID)
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+				gomega.Expect(stored.Department.Valid).Should(gomega.BeFalse())
+			})
+
+			ginkgo.It("should reject a duplicate user name", func() {
+				create("johndoe")
+
+				_, err := r.Create(ctx, newUser("johndoe"))
+				gomega.Expect(errors.Is(err, repo.ErrDuplicateUserName)).Should(gomega.BeTrue(), "got %v", err)
+			})
+		})
+
+		ginkgo.Describe("attributes", func() {
+			ginkgo.It("should store the attributes of a user", func() {
+				user := newUser("johndoe")
+				user.Attributes = model.Attributes{"employee_number": float64(42), "location": "Paris", "hired": "2024-01-31"}
+				_, err := r.Create(ctx, user)
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+				stored, err := r.GetById(ctx, user.UserID)
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+				gomega.Expect(stored.Attributes).Should(gomega.Equal(user.Attributes))
+			})
+
+			ginkgo.It("should keep the attributes on updates without them", func() {
+				user := newUser("johndoe")
+				user.Attributes = model.Attributes{"location": "Paris"}
+				_, err := r.Create(ctx, user)
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+				user.Attributes = nil
+				user.FirstName = "Johnny"
+				_, err = r.Update(ctx, user)
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+				stored, err := r.GetById(ctx, user.UserID)
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+				gomega.Expect(stored.Attributes).Should(gomega.Equal(model.Attributes{"location": "Paris"}))
+
+				user.Attributes = model.Attributes{}
+				_, err = r.Update(ctx, user)
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+				stored, err = r.GetById(ctx, user.UserID)
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+				gomega.Expect(stored.Attributes).Should(gomega.BeEmpty())
+			})
+
+			ginkgo.It("should find users having every given attribute", func() {
+				for i, attrs := range []model.Attributes{
+					{"location": "Paris", "level": float64(3)},
+					{"location": "Paris", "level": float64(4)},
+					{"location": "Berlin", "level": float64(3)},
+					nil,
+				} {
+					user := newUser(fmt.Sprintf("user%d", i))
+					user.Attributes = attrs
+					_, err := r.Create(ctx, user)
+					gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+				}
+
+				names := func(attrs model.Attributes) []string {
+					users, err := r.FindByAttributes(ctx, attrs)
+					gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+					names := []string{}
+					for _, u := range *users {
+						names = append(names, u.UserName)
+					}
+					return names
+				}
+
+				gomega.Expect(names(model.Attributes{"location": "Paris"})).Should(gomega.Equal([]string{"user0", "user1"}))
+				gomega.Expect(names(model.Attributes{"location": "Paris", "level": float64(3)})).Should(gomega.Equal([]string{"user0"}))
+				gomega.Expect(names(model.Attributes{"level": float64(3)})).Should(gomega.Equal([]string{"user0", "user2"}))
+				gomega.Expect(names(model.Attributes{"location": "Rome"})).Should(gomega.BeEmpty())
+
+				other := tenant.WithID(context.Background(), otherTenantID)
+				users, err := r.FindByAttributes(other, model.Attributes{"location": "Paris"})
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+				gomega.Expect(*users).Should(gomega.BeEmpty())
+			})
+
+			ginkgo.It("should hold the attribute lock until the transaction ends", func() {
+				locked, release, second := make(chan struct{}), make(chan struct{}), make(chan error, 1)
+				go func() {
+					defer ginkgo.GinkgoRecover()
+					err := r.RunInTx(ctx, func(ctx context.Context) error {
+						if err := r.LockAttribute(ctx, "employee_number"); err != nil {
+							return err
+						}
+						close(locked)
+						<-release
+						return nil
+					})
+					gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+				}()
+				gomega.Eventually(locked).Should(gomega.BeClosed())
+
+				go func() {
+					second <- r.RunInTx(ctx, func(ctx context.Context) error {
+						return r.LockAttribute(ctx, "employee_number")
+					})
+				}()
+				gomega.Consistently(second, 200*time.Millisecond).ShouldNot(gomega.Receive())
+
+				close(release)
+				gomega.Eventually(second).Should(gomega.Receive(gomega.BeNil()))
+			})
+		})
+
+		ginkgo.Describe("managers", func() {
+			// org creates ceo <- vp <- (lead, eng) and lead <- dev
+			org := func() map[string]*model.User {
+				users := map[string]*model.User{}
+				for _, u := range []struct{ name, manager string }{
+					{"ceo", ""}, {"vp", "ceo"}, {"lead", "vp"}, {"eng", "vp"}, {"dev", "lead"},
+				} {
+					user := newUser(u.name)
+					if m, ok := users[u.manager]; ok {
+						user.ManagerID = sql.NullInt64{Int64: int64(m.UserID), Valid: true}
+					}
+					_, err := r.Create(ctx, user)
+					gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+					users[u.name] = user
+				}
+				return users
+			}
+
+			names := func(users *[]model.User, err error) []string {
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+				names := []string{}
+				for _, u := range *users {
+					names = append(names, u.UserName)
+				}
+				return names
+			}
+
+			ginkgo.It("should store the manager of a user", func() {
+				users := org()
+
+				stored, err := r.GetById(ctx, users["vp"].UserID)
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+				gomega.Expect(stored).Should(gomega.Equal(users["vp"]))
+
+				stored.ManagerID = sql.NullInt64{}
+				_, err = r.Update(ctx, stored)
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+				stored, err = r.GetById(ctx, users["vp"].UserID)
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+				gomega.Expect(stored.ManagerID.Valid).Should(gomega.BeFalse())
+			})
+
+			ginkgo.It("should walk the hierarchy both ways", func() {
+				users := org()
+
+				gomega.Expect(names(r.GetDirectReports(ctx, users["vp"].UserID))).Should(gomega.Equal([]string{"lead", "eng"}))
+				gomega.Expect(names(r.GetManagementChain(ctx, users["dev"].UserID))).Should(gomega.Equal([]string{"lead", "vp", "ceo"}))
+				gomega.Expect(names(r.GetSubordinates(ctx, users["ceo"].UserID))).Should(gomega.Equal([]string{"vp", "lead", "eng", "dev"}))
+
+				gomega.Expect(names(r.GetDirectReports(ctx, users["dev"].UserID))).Should(gomega.BeEmpty())
+				gomega.Expect(names(r.GetManagementChain(ctx, users["ceo"].UserID))).Should(gomega.BeEmpty())
+				gomega.Expect(names(r.GetManagementChain(ctx, 4242))).Should(gomega.BeEmpty())
+
+				other := tenant.WithID(context.Background(), otherTenantID)
+				gomega.Expect(names(r.GetSubordinates(other, users["ceo"].UserID))).Should(gomega.BeEmpty())
+				gomega.Expect(names(r.GetManagementChain(other, users["dev"].UserID))).Should(gomega.BeEmpty())
+			})
+
+			ginkgo.It("should reassign the direct reports", func() {
+				users := org()
+
+				n, err := r.ReassignReports(ctx, users["vp"].UserID, users["ceo"].UserID)
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+				gomega.Expect(n).Should(gomega.Equal(2))
+				gomega.Expect(names(r.GetDirectReports(ctx, users["ceo"].UserID))).Should(gomega.Equal([]string{"vp", "lead", "eng"}))
+				lead, err := r.GetById(ctx, users["lead"].UserID)
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+				gomega.Expect(lead.ManagerID.Int64).Should(gomega.Equal(int64(users["ceo"].UserID)))
+
+				n, err = r.ReassignReports(ctx, users["lead"].UserID, 0)
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+				gomega.Expect(n).Should(gomega.Equal(1))
+				gomega.Expect(names(r.GetManagementChain(ctx, users["dev"].UserID))).Should(gomega.BeEmpty())
+			})
+
+			ginkgo.It("should leave the reports of a deleted manager without one", func() {
+				users := org()
+
+				gomega.Expect(r.Delete(ctx, users["lead"].UserID)).Should(gomega.Succeed())
+				dev, err := r.GetById(ctx, users["dev"].UserID)
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+				gomega.Expect(dev.ManagerID.Valid).Should(gomega.BeFalse())
+			})
+
+			ginkgo.It("should hold the hierarchy lock until the transaction ends", func() {
+				locked, release, second := make(chan struct{}), make(chan struct{}), make(chan error, 1)
+				go func() {
+					defer ginkgo.GinkgoRecover()
+					err := r.RunInTx(ctx, func(ctx context.Context) error {
+						if err := r.LockHierarchy(ctx); err != nil {
+							return err
+						}
+						close(locked)
+						<-release
+						return nil
+					})
+					gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+				}()
+				gomega.Eventually(locked).Should(gomega.BeClosed())
+
+				go func() {
+					second <- r.RunInTx(ctx, func(ctx context.Context) error {
+						return r.LockHierarchy(ctx)
+					})
+				}()
+				gomega.Consistently(second, 200*time.Millisecond).ShouldNot(gomega.Receive())
+
+				close(release)
+				gomega.Eventually(second).Should(gomega.Receive(gomega.BeNil()))
+			})
+		})
+
+		ginkgo.Describe("GetById / GetByUsername", func() {
+			ginkgo.It("should return ErrNotFound for a missing user", func() {
+				_, err := r.GetById(ctx, 4242)
+				gomega.Expect(errors.Is(err, repo.ErrNotFound)).Should(gomega.BeTrue(), "got %v", err)
+
+				_, err = r.GetByUsername(ctx, "nobody")
+				gomega.Expect(errors.Is(err, repo.ErrNotFound)).Should(gomega.BeTrue(), "got %v", err)
+			})
+		})
+
+		ginkgo.Describe("GetAll", func() {
+			ginkgo.It("should return no users for an empty repo", func() {
+				users, err := r.GetAll(ctx)
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+				gomega.Expect(*users).Should(gomega.BeEmpty())
+			})
+
+			ginkgo.It("should order users by id", func() {
+				for _, name := range []string{"charlie", "alice", "bob"} {
+					create(name)
+				}
+
+				users, err := r.GetAll(ctx)
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+				gomega.Expect(*users).Should(gomega.HaveLen(3))
+				for i, name := range []string{"charlie", "alice", "bob"} {
+					gomega.Expect((*users)[i].UserName).Should(gomega.Equal(name))
+				}
+				gomega.Expect((*users)[0].UserID).Should(gomega.BeNumerically("<", (*users)[1].UserID))
+				gomega.Expect((*users)[1].UserID).Should(gomega.BeNumerically("<", (*users)[2].UserID))
+			})
+		})
+
+		ginkgo.Describe("Update", func() {
+			ginkgo.It("should replace every field", func() {
+				user := create("johndoe")
+				updated := &model.User{UserID: user.UserID, TenantID: model.DefaultTenantID, UserName: "jdoe", FirstName: "Johnny", LastName: "Doe", Email: "jdoe@email.com", UserStatus: model.Inactive}
+
+				id, err := r.Update(ctx, updated)
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+				gomega.Expect(id).Should(gomega.Equal(user.UserID))
+
+				stored, err := r.GetById(ctx, user.UserID)
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+				gomega.Expect(stored).Should(gomega.Equal(updated))
+
+				_, err = r.GetByUsername(ctx, "johndoe")
+				gomega.Expect(errors.Is(err, repo.ErrNotFound)).Should(gomega.BeTrue(), "got %v", err)
+			})
+
+			ginkgo.It("should return ErrNotFound for a missing user", func() {
+				missing := newUser("nobody")
+				missing.UserID = 4242
+
+				_, err := r.Update(ctx, missing)
+				gomega.Expect(errors.Is(err, repo.ErrNotFound)).Should(gomega.BeTrue(), "got %v", err)
+			})
+
+			ginkgo.It("should reject renaming to a taken user name", func() {
+				create("johndoe")
+				jane := create("janedoe")
+				jane.UserName = "johndoe"
+
+				_, err := r.Update(ctx, jane)
+				gomega.Expect(errors.Is(err, repo.ErrDuplicateUserName)).Should(gomega.BeTrue(), "got %v", err)
+			})
+		})
+
+		ginkgo.Describe("Delete", func() {
+			ginkgo.It("should remove the user", func() {
+				user := create("johndoe")
+
+				gomega.Expect(r.Delete(ctx, user.UserID)).Should(gomega.Succeed())
+
+				_, err := r.GetById(ctx, user.UserID)
+				gomega.Expect(errors.Is(err, repo.ErrNotFound)).Should(gomega.BeTrue(), "got %v", err)
+			})
+
+			ginkgo.It("should succeed for a missing user", func() {
+				gomega.Expect(r.Delete(ctx, 4242)).Should(gomega.Succeed())
+			})
+
+			ginkgo.It("should free the user name", func() {
+				user := create("johndoe")
+				gomega.Expect(r.Delete(ctx, user.UserID)).Should(gomega.Succeed())
+
+				create("johndoe")
+			})
+		})
+
+		ginkgo.Describe("tenants", func() {
+			ginkgo.It("should hide users from other tenants", func() {
+				user := create("johndoe")
+				other := tenant.WithID(context.Background(), otherTenantID)
+
+				_, err := r.GetById(other, user.UserID)
+				gomega.Expect(errors.Is(err, repo.ErrNotFound)).Should(gomega.BeTrue(), "got %v", err)
+				_, err = r.GetByUsername(other, "johndoe")
+				gomega.Expect(errors.Is(err, repo.ErrNotFound)).Should(gomega.BeTrue(), "got %v", err)
+
+				users, err := r.GetAll(other)
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+				gomega.Expect(*users).Should(gomega.BeEmpty())
+			})
+
+			ginkgo.It("should not let other tenants change users", func() {
+				user := create("johndoe")
+				other := tenant.WithID(context.Background(), otherTenantID)
+
+				renamed := newUser("jdoe")
+				renamed.UserID = user.UserID
+				_, err := r.Update(other, renamed)
+				gomega.Expect(errors.Is(err, repo.ErrNotFound)).Should(gomega.BeTrue(), "got %v", err)
+				gomega.Expect(r.Delete(other, user.UserID)).Should(gomega.Succeed())
+
+				stored, err := r.GetById(ctx, user.UserID)
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+				gomega.Expect(stored).Should(gomega.Equal(user))
+			})
+
+			ginkgo.It("should return ErrNoTenant without a tenant", func() {
+				noTenant := context.Background()
+
+				_, err := r.GetById(noTenant, 1)
+				gomega.Expect(errors.Is(err, repo.ErrNoTenant)).Should(gomega.BeTrue(), "got %v", err)
+				_, err = r.GetAll(noTenant)
+				gomega.Expect(errors.Is(err, repo.ErrNoTenant)).Should(gomega.BeTrue(), "got %v", err)
+				_, err = r.Create(noTenant, newUser("johndoe"))
+				gomega.Expect(errors.Is(err, repo.ErrNoTenant)).Should(gomega.BeTrue(), "got %v", err)
+				gomega.Expect(errors.Is(r.Delete(noTenant, 1), repo.ErrNoTenant)).Should(gomega.BeTrue())
+			})
+		})
+
+		ginkgo.Describe("RunInTx", func() {
+			ginkgo.It("should commit when fn succeeds", func() {
+				err := r.RunInTx(ctx, func(ctx context.Context) error {
+					_, err := r.Create(ctx, newUser("johndoe"))
+					return err
+				})
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+				_, err = r.GetByUsername(ctx, "johndoe")
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			})
+
+			ginkgo.It("should roll back every write when a nested call fails", func() {
+				errAbort := errors.New("abort")
+				user := create("janedoe")
+
+				err := r.RunInTx(ctx, func(ctx context.Context) error {
+					if _, err := r.Create(ctx, newUser("johndoe")); err != nil {
+						return err
+					}
+					if err := r.Delete(ctx, user.UserID); err != nil {
+						return err
+					}
+
+					// Reads in the transaction see its writes
+					if _, err := r.GetByUsername(ctx, "johndoe"); err != nil {
+						return err
+					}
+
+					return r.RunInTx(ctx, func(ctx context.Context) error {
+						return errAbort
+					})
+				})
+				gomega.Expect(errors.Is(err, errAbort)).Should(gomega.BeTrue(), "got %v", err)
+
+				_, err = r.GetByUsername(ctx, "johndoe")
+				gomega.Expect(errors.Is(err, repo.ErrNotFound)).Should(gomega.BeTrue(), "got %v", err)
+				_, err = r.GetById(ctx, user.UserID)
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			})
+		})
+
+		ginkgo.Describe("concurrent writers", func() {
+			ginkgo.It("should create distinct users without losing any", func() {
+				var wg sync.WaitGroup
+				errs := make([]error, concurrentWriters)
+				for i := 0; i < concurrentWriters; i++ {
+					wg.Add(1)
+					go func(i int) {
+						defer wg.Done()
+						_, errs[i] = r.Create(ctx, newUser(fmt.Sprintf("user%d", i)))
+					}(i)
+				}
+				wg.Wait()
+
+				for _, err := range errs {
+					gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+				}
+
+				users, err := r.GetAll(ctx)
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+				gomega.Expect(*users).Should(gomega.HaveLen(concurrentWriters))
+			})
+
+			ginkgo.It("should let exactly one writer claim a user name", func() {
+				var wg sync.WaitGroup
+				errs := make([]error, concurrentWriters)
+				for i := 0; i < concurrentWriters; i++ {
+					wg.Add(1)
+					go func(i int) {
+						defer wg.Done()
+						_, errs[i] = r.Create(ctx, newUser("johndoe"))
+					}(i)
+				}
+				wg.Wait()
+
+				created := 0
+				for _, err := range errs {
+					if err == nil {
+						created++
+						continue
+					}
+					gomega.Expect(errors.Is(err, repo.ErrDuplicateUserName)).Should(gomega.BeTrue(), "got %v", err)
+				}
+				gomega.Expect(created).Should(gomega.Equal(1))
+			})
+		})
+	})
+}
+
+// DescribeTenants registers the conformance specs for the tenant repos built
+// by newRepo
+func DescribeTenants(name string, newRepo TenantFactory) bool {
+	return ginkgo.Describe(name+" tenant conformance", func() {
+		var (
+			t       repo.TenantRepo
+			r       repo.UserRepo
+			cleanup func()
+			ctx     = context.Background()
+		)
+
+		createTenant := func(slug string) *model.Tenant {
+			tn := &model.Tenant{Slug: slug, Name: "Tenant " + slug}
+			id, err := t.CreateTenant(ctx, tn)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(id).Should(gomega.Equal(tn.TenantID))
+			return tn
+		}
+
+		ginkgo.BeforeEach(func() {
+			t, r, cleanup = newRepo()
+		})
+
+		ginkgo.AfterEach(func() {
+			cleanup()
+		})
+
+		ginkgo.It("should hold the default tenant", func() {
+			tn, err := t.GetTenantBySlug(ctx, model.DefaultTenantSlug)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(tn.TenantID).Should(gomega.Equal(model.DefaultTenantID))
+		})
+
+		ginkgo.It("should create, update and delete tenants", func() {
+			tn := createTenant("acme")
+
+			byID, err := t.GetTenant(ctx, tn.TenantID)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(byID).Should(gomega.Equal(tn))
+
+			tn.Slug, tn.Name = "acme-corp", "Acme Corp"
+			_, err = t.UpdateTenant(ctx, tn)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			bySlug, err := t.GetTenantBySlug(ctx, "acme-corp")
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(bySlug).Should(gomega.Equal(tn))
+
+			tenants, err := t.GetAllTenants(ctx)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(*tenants).Should(gomega.HaveLen(2))
+			gomega.Expect((*tenants)[0].TenantID).Should(gomega.Equal(model.DefaultTenantID))
+
+			gomega.Expect(t.DeleteTenant(ctx, tn.TenantID)).Should(gomega.Succeed())
+			_, err = t.GetTenant(ctx, tn.TenantID)
+			gomega.Expect(errors.Is(err, repo.ErrTenantNotFound)).Should(gomega.BeTrue(), "got %v", err)
+		})
+
+		ginkgo.It("should report missing tenants as not found", func() {
+			_, err := t.GetTenant(ctx, 4242)
+			gomega.Expect(errors.Is(err, repo.ErrTenantNotFound)).Should(gomega.BeTrue(), "got %v", err)
+			_, err = t.GetTenantBySlug(ctx, "nobody")
+			gomega.Expect(errors.Is(err, repo.ErrTenantNotFound)).Should(gomega.BeTrue(), "got %v", err)
+			_, err = t.UpdateTenant(ctx, &model.Tenant{TenantID: 4242, Slug: "nobody", Name: "Nobody"})
+			gomega.Expect(errors.Is(err, repo.ErrTenantNotFound)).Should(gomega.BeTrue(), "got %v", err)
+			gomega.Expect(t.DeleteTenant(ctx, 4242)).Should(gomega.Succeed())
+		})
+
+		ginkgo.It("should reject a duplicate slug", func() {
+			createTenant("acme")
+
+			_, err := t.CreateTenant(ctx, &model.Tenant{Slug: "acme", Name: "Other"})
+			gomega.Expect(errors.Is(err, repo.ErrDuplicateTenantSlug)).Should(gomega.BeTrue(), "got %v", err)
+		})
+
+		ginkgo.It("should let two tenants have a user with the same name", func() {
+			acme := tenant.WithID(ctx, createTenant("acme").TenantID)
+			globex := tenant.WithID(ctx, createTenant("globex").TenantID)
+
+			for _, tctx := range []context.Context{acme, globex} {
+				_, err := r.Create(tctx, newUser("johndoe"))
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			}
+
+			a, err := r.GetByUsername(acme, "johndoe")
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			g, err := r.GetByUsername(globex, "johndoe")
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(a.UserID).ShouldNot(gomega.Equal(g.UserID))
+			gomega.Expect(a.TenantID).ShouldNot(gomega.Equal(g.TenantID))
+		})
+
+		ginkgo.It("should refuse to delete a tenant that has users", func() {
+			acme := createTenant("acme")
+			_, err := r.Create(tenant.WithID(ctx, acme.TenantID), newUser("johndoe"))
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+			err = t.DeleteTenant(ctx, acme.TenantID)
+			gomega.Expect(errors.Is(err, repo.ErrTenantInUse)).Should(gomega.BeTrue(), "got %v", err)
+		})
+	})
+}
+
+// DescribeAttributes registers the conformance specs for the attribute repos
+// built by newRepo
+func DescribeAttributes(name string, newRepo AttributeFactory) bool {
+	return ginkgo.Describe(name+" attribute conformance", func() {
+		var (
+			a       repo.AttributeRepo
+			r       repo.UserRepo
+			cleanup func()
+			ctx     = tenant.WithID(context.Background(), model.DefaultTenantID)
+		)
+
+		define := func(name string, attrType model.AttributeType, enumValues ...string) *model.AttributeDefinition {
+			def := &model.AttributeDefinition{Name: name, Type: attrType, EnumValues: enumValues}
+			id, err := a.CreateAttribute(ctx, def)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(id).Should(gomega.Equal(def.AttributeID))
+			return def
+		}
+
+		ginkgo.BeforeEach(func() {
+			a, r, cleanup = newRepo()
+		})
+
+		ginkgo.AfterEach(func() {
+			cleanup()
+		})
+
+		ginkgo.It("should create and list definitions ordered by name", func() {
+			location := define("location", model.AttributeString)
+			level := &model.AttributeDefinition{Name: "level", Type: model.AttributeEnum, Required: true, Unique: true, EnumValues: []string{"junior", "senior"}}
+			_, err := a.CreateAttribute(ctx, level)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(level.TenantID).Should(gomega.Equal(model.DefaultTenantID))
+
+			byID, err := a.GetAttribute(ctx, level.AttributeID)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(byID).Should(gomega.Equal(level))
+
+			defs, err := a.GetAttributes(ctx)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(*defs).Should(gomega.Equal([]model.AttributeDefinition{*level, *location}))
+		})
+
+		ginkgo.It("should reject a duplicate name", func() {
+			define("location", model.AttributeString)
+
+			_, err := a.CreateAttribute(ctx, &model.AttributeDefinition{Name: "location", Type: model.AttributeNumber})
+			gomega.Expect(errors.Is(err, repo.ErrDuplicateAttribute)).Should(gomega.BeTrue(), "got %v", err)
+		})
+
+		ginkgo.It("should report a missing definition as not found", func() {
+			_, err := a.GetAttribute(ctx, 4242)
+			gomega.Expect(errors.Is(err, repo.ErrAttributeNotFound)).Should(gomega.BeTrue(), "got %v", err)
+			gomega.Expect(a.DeleteAttribute(ctx, 4242)).Should(gomega.Succeed())
+		})
+
+		ginkgo.It("should hide definitions from other tenants", func() {
+			def := define("location", model.AttributeString)
+			other := tenant.WithID(context.Background(), otherTenantID)
+
+			_, err := a.GetAttribute(other, def.AttributeID)
+			gomega.Expect(errors.Is(err, repo.ErrAttributeNotFound)).Should(gomega.BeTrue(), "got %v", err)
+			defs, err := a.GetAttributes(other)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(*defs).Should(gomega.BeEmpty())
+
+			gomega.Expect(a.DeleteAttribute(other, def.AttributeID)).Should(gomega.Succeed())
+			_, err = a.GetAttribute(ctx, def.AttributeID)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+			_, err = a.GetAttributes(context.Background())
+			gomega.Expect(errors.Is(err, repo.ErrNoTenant)).Should(gomega.BeTrue(), "got %v", err)
+		})
+
+		ginkgo.It("should remove the values of a deleted definition", func() {
+			def := define("location", model.AttributeString)
+			define("level", model.AttributeNumber)
+			user := newUser("johndoe")
+			user.Attributes = model.Attributes{"location": "Paris", "level": float64(3)}
+			_, err := r.Create(ctx, user)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+			gomega.Expect(a.DeleteAttribute(ctx, def.AttributeID)).Should(gomega.Succeed())
+
+			_, err = a.GetAttribute(ctx, def.AttributeID)
+			gomega.Expect(errors.Is(err, repo.ErrAttributeNotFound)).Should(gomega.BeTrue(), "got %v", err)
+			stored, err := r.GetById(ctx, user.UserID)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(stored.Attributes).Should(gomega.Equal(model.Attributes{"level": float64(3)}))
+		})
+	})
+}
+
+// DescribeGroups registers the conformance specs for the group repos built by
+// newRepo
+func DescribeGroups(name string, newRepo GroupFactory) bool {
+	return ginkgo.Describe(name+" group conformance", func() {
+		var (
+			g       repo.GroupRepo
+			r       repo.UserRepo
+			cleanup func()
+			ctx     = tenant.WithID(context.Background(), model.DefaultTenantID)
+		)
+
+		createGroup := func(name string, parent *model.Group) *model.Group {
+			group := &model.Group{Name: name, Description: "The " + name + " team"}
+			if parent != nil {
+				group.ParentID = sql.NullInt64{Int64: int64(parent.GroupID), Valid: true}
+			}
+			id, err := g.CreateGroup(ctx, group)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(id).Should(gomega.Equal(group.GroupID))
+			return group
+		}
+
+		createUser := func(userName string) int {
+			id, err := r.Create(ctx, newUser(userName))
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			return id
+		}
+
+		userNames := func(users *[]model.User, err error) []string {
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			names := []string{}
+			for _, u := range *users {
+				names = append(names, u.UserName)
+			}
+			return names
+		}
+
+		groupNames := func(groups *[]model.Group, err error) []string {
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			names := []string{}
+			for _, g := range *groups {
+				names = append(names, g.Name)
+			}
+			return names
+		}
+
+		ginkgo.BeforeEach(func() {
+			g, r, cleanup = newRepo()
+		})
+
+		ginkgo.AfterEach(func() {
+			cleanup()
+		})
+
+		ginkgo.It("should create, update and list groups ordered by name", func() {
+			eng := createGroup("engineering", nil)
+			backend := createGroup("backend", eng)
+			gomega.Expect(backend.TenantID).Should(gomega.Equal(model.DefaultTenantID))
+
+			byID, err := g.GetGroup(ctx, backend.GroupID)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(byID).Should(gomega.Equal(backend))
+
+			backend.Name, backend.Description, backend.ParentID = "platform", "", sql.NullInt64{}
+			_, err = g.UpdateGroup(ctx, backend)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			byID, err = g.GetGroup(ctx, backend.GroupID)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(byID).Should(gomega.Equal(backend))
+
+			groups, err := g.GetGroups(ctx)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(*groups).Should(gomega.Equal([]model.Group{*eng, *backend}))
+		})
+
+		ginkgo.It("should reject a duplicate name and report missing groups as not found", func() {
+			createGroup("engineering", nil)
+
+			_, err := g.CreateGroup(ctx, &model.Group{Name: "engineering"})
+			gomega.Expect(errors.Is(err, repo.ErrDuplicateGroupName)).Should(gomega.BeTrue(), "got %v", err)
+
+			_, err = g.GetGroup(ctx, 4242)
+			gomega.Expect(errors.Is(err, repo.ErrGroupNotFound)).Should(gomega.BeTrue(), "got %v", err)
+			_, err = g.UpdateGroup(ctx, &model.Group{GroupID: 4242, Name: "nobody"})
+			gomega.Expect(errors.Is(err, repo.ErrGroupNotFound)).Should(gomega.BeTrue(), "got %v", err)
+			gomega.Expect(g.DeleteGroup(ctx, 4242)).Should(gomega.Succeed())
+		})
+
+		ginkgo.It("should hold the group hierarchy lock until the transaction ends", func() {
+			locked, release, second := make(chan struct{}), make(chan struct{}), make(chan error, 1)
+			go func() {
+				defer ginkgo.GinkgoRecover()
+				err := g.RunInTx(ctx, func(ctx context.Context) error {
+					if err := g.LockGroupHierarchy(ctx); err != nil {
+						return err
+					}
+					close(locked)
+					<-release
+					return nil
+				})
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			}()
+			gomega.Eventually(locked).Should(gomega.BeClosed())
+
+			go func() {
+				second <- g.RunInTx(ctx, func(ctx context.Context) error {
+					return g.LockGroupHierarchy(ctx)
+				})
+			}()
+			gomega.Consistently(second, 200*time.Millisecond).ShouldNot(gomega.Receive())
+
+			close(release)
+			gomega.Eventually(second).Should(gomega.Receive(gomega.BeNil()))
+		})
+
+		ginkgo.Describe("members", func() {
+			// engineering <- backend <- api and engineering <- frontend, alice
+			// is in api and frontend, bob in backend and carol in frontend
+			var (
+				eng, backend, api, frontend *model.Group
+				alice, bob, carol           int
+			)
+
+			ginkgo.BeforeEach(func() {
+				eng = createGroup("engineering", nil)
+				backend = createGroup("backend", eng)
+				api = createGroup("api", backend)
+				frontend = createGroup("frontend", eng)
+				alice, bob, carol = createUser("alice"), createUser("bob"), createUser("carol")
+
+				for _, m := range []struct {
+					group *model.Group
+					users []int
+				}{{api, []int{alice}}, {backend, []int{bob}}, {frontend, []int{alice, carol}}} {
+					n, err := g.AddGroupMembers(ctx, m.group.GroupID, m.users)
+					gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+					gomega.Expect(n).Should(gomega.Equal(len(m.users)))
+				}
+			})
+
+			ginkgo.It("should resolve the members directly and transitively", func() {
+				gomega.Expect(userNames(g.GetGroupMembers(ctx, backend.GroupID, false))).Should(gomega.Equal([]string{"bob"}))
+				gomega.Expect(userNames(g.GetGroupMembers(ctx, backend.GroupID, true))).Should(gomega.Equal([]string{"alice", "bob"}))
+				gomega.Expect(userNames(g.GetGroupMembers(ctx, eng.GroupID, false))).Should(gomega.BeEmpty())
+				gomega.Expect(userNames(g.GetGroupMembers(ctx, eng.GroupID, true))).Should(gomega.Equal([]string{"alice", "bob", "carol"}))
+				gomega.Expect(userNames(g.GetGroupMembers(ctx, 4242, true))).Should(gomega.BeEmpty())
+			})
+
+			ginkgo.It("should resolve the groups of a user directly and transitively", func() {
+				gomega.Expect(groupNames(g.GetUserGroups(ctx, alice, false))).Should(gomega.Equal([]string{"api", "frontend"}))
+				gomega.Expect(groupNames(g.GetUserGroups(ctx, alice, true))).Should(gomega.Equal([]string{"api", "backend", "engineering", "frontend"}))
+				gomega.Expect(groupNames(g.GetUserGroups(ctx, carol, true))).Should(gomega.Equal([]string{"engineering", "frontend"}))
+				gomega.Expect(groupNames(g.GetGroupAncestors(ctx, api.GroupID))).Should(gomega.Equal([]string{"backend", "engineering"}))
+				gomega.Expect(groupNames(g.GetGroupAncestors(ctx, eng.GroupID))).Should(gomega.BeEmpty())
+			})
+
+			ginkgo.It("should skip existing members and users of other tenants", func() {
+				n, err := g.AddGroupMembers(ctx, backend.GroupID, []int{alice, bob, 4242})
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+				gomega.Expect(n).Should(gomega.Equal(1))
+
+				n, err = g.RemoveGroupMembers(ctx, backend.GroupID, []int{bob, carol})
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+				gomega.Expect(n).Should(gomega.Equal(1))
+				gomega.Expect(userNames(g.GetGroupMembers(ctx, backend.GroupID, false))).Should(gomega.Equal([]string{"alice"}))
+			})
+
+			ginkgo.It("should move the subgroups of a deleted group to its parent", func() {
+				gomega.Expect(g.DeleteGroup(ctx, backend.GroupID)).Should(gomega.Succeed())
+
+				moved, err := g.GetGroup(ctx, api.GroupID)
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+				gomega.Expect(moved.ParentID).Should(gomega.Equal(sql.NullInt64{Int64: int64(eng.GroupID), Valid: true}))
+				gomega.Expect(groupNames(g.GetUserGroups(ctx, bob, true))).Should(gomega.BeEmpty())
+				gomega.Expect(userNames(g.GetGroupMembers(ctx, eng.GroupID, true))).Should(gomega.Equal([]string{"alice", "carol"}))
+			})
+
+			ginkgo.It("should drop the memberships of a deleted user", func() {
+				gomega.Expect(r.Delete(ctx, alice)).Should(gomega.Succeed())
+
+				gomega.Expect(userNames(g.GetGroupMembers(ctx, frontend.GroupID, false))).Should(gomega.Equal([]string{"carol"}))
+			})
+
+			ginkgo.It("should hide groups and members from other tenants", func() {
+				other := tenant.WithID(context.Background(), otherTenantID)
+
+				_, err := g.GetGroup(other, eng.GroupID)
+				gomega.Expect(errors.Is(err, repo.ErrGroupNotFound)).Should(gomega.BeTrue(), "got %v", err)
+				gomega.Expect(groupNames(g.GetGroups(other))).Should(gomega.BeEmpty())
+				gomega.Expect(userNames(g.GetGroupMembers(other, eng.GroupID, true))).Should(gomega.BeEmpty())
+				gomega.Expect(groupNames(g.GetUserGroups(other, alice, true))).Should(gomega.BeEmpty())
+
+				n, err := g.RemoveGroupMembers(other, frontend.GroupID, []int{alice})
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+				gomega.Expect(n).Should(gomega.BeZero())
+				gomega.Expect(g.DeleteGroup(other, eng.GroupID)).Should(gomega.Succeed())
+				_, err = g.GetGroup(ctx, eng.GroupID)
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+				_, err = g.GetGroups(context.Background())
+				gomega.Expect(errors.Is(err, repo.ErrNoTenant)).Should(gomega.BeTrue(), "got %v", err)
+			})
+		})
+	})
+}
+
+// DescribeCredentials registers the conformance specs for the credential
+// repos built by newRepo
+func DescribeCredentials(name string, newRepo CredentialFactory) bool {
+	return ginkgo.Describe(name+" credential conformance", func() {
+		var (
+			c       repo.CredentialRepo
+			r       repo.UserRepo
+			cleanup func()
+			user_id int
+			ctx     = tenant.WithID(context.Background(), model.DefaultTenantID)
+		)
+
+		ginkgo.BeforeEach(func() {
+			c, r, cleanup = newRepo()
+
+			var err error
+			user_id, err = r.Create(ctx, newUser("alice"))
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		})
+
+		ginkgo.AfterEach(func() {
+			cleanup()
+		})
+
+		ginkgo.It("should store and replace the password of a user", func() {
+			_, err := c.GetCredential(ctx, user_id)
+			gomega.Expect(errors.Is(err, repo.ErrCredentialNotFound)).Should(gomega.BeTrue(), "got %v", err)
+
+			gomega.Expect(c.SetPassword(ctx, user_id, "hash-1")).Should(gomega.Succeed())
+			gomega.Expect(c.SetPassword(ctx, user_id, "hash-2")).Should(gomega.Succeed())
+
+			cred, err := c.GetCredential(ctx, user_id)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(cred.UserID).Should(gomega.Equal(user_id))
+			gomega.Expect(cred.TenantID).Should(gomega.Equal(model.DefaultTenantID))
+			gomega.Expect(cred.PasswordHash).Should(gomega.Equal("hash-2"))
+			gomega.Expect(cred.FailedAttempts).Should(gomega.BeZero())
+			gomega.Expect(cred.LockedUntil.IsZero()).Should(gomega.BeTrue())
+			gomega.Expect(cred.UpdatedAt.IsZero()).Should(gomega.BeFalse())
+
+			err = c.SetPassword(ctx, 4242, "hash")
+			gomega.Expect(errors.Is(err, repo.ErrNotFound)).Should(gomega.BeTrue(), "got %v", err)
+		})
+
+		ginkgo.It("should count failed logins until the credential is locked or used", func() {
+			gomega.Expect(c.SetPassword(ctx, user_id, "hash")).Should(gomega.Succeed())
+
+			for i := 1; i <= 3; i++ {
+				n, err := c.RecordLoginFailure(ctx, user_id)
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+				gomega.Expect(n).Should(gomega.Equal(i))
+			}
+
+			until := time.Now().Add(time.Hour).Truncate(time.Second)
+			gomega.Expect(c.LockCredential(ctx, user_id, until)).Should(gomega.Succeed())
+			cred, err := c.GetCredential(ctx, user_id)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(cred.FailedAttempts).Should(gomega.BeZero())
+			gomega.Expect(cred.LockedUntil.Equal(until)).Should(gomega.BeTrue(), "got %v", cred.LockedUntil)
+
+			_, err = c.RecordLoginFailure(ctx, user_id)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(c.RecordLoginSuccess(ctx, user_id)).Should(gomega.Succeed())
+			cred, err = c.GetCredential(ctx, user_id)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(cred.FailedAttempts).Should(gomega.BeZero())
+			gomega.Expect(cred.LockedUntil.IsZero()).Should(gomega.BeTrue())
+
+			_, err = c.RecordLoginFailure(ctx, 4242)
+			gomega.Expect(errors.Is(err, repo.ErrCredentialNotFound)).Should(gomega.BeTrue(), "got %v", err)
+		})
+
+		ginkgo.It("should delete the credential alone or with its user", func() {
+			gomega.Expect(c.SetPassword(ctx, user_id, "hash")).Should(gomega.Succeed())
+			gomega.Expect(c.DeleteCredential(ctx, user_id)).Should(gomega.Succeed())
+			gomega.Expect(c.DeleteCredential(ctx, user_id)).Should(gomega.Succeed())
+			_, err := c.GetCredential(ctx, user_id)
+			gomega.Expect(errors.Is(err, repo.ErrCredentialNotFound)).Should(gomega.BeTrue(), "got %v", err)
+
+			gomega.Expect(c.SetPassword(ctx, user_id, "hash")).Should(gomega.Succeed())
+			gomega.Expect(r.Delete(ctx, user_id)).Should(gomega.Succeed())
+			_, err = c.GetCredential(ctx, user_id)
+			gomega.Expect(errors.Is(err, repo.ErrCredentialNotFound)).Should(gomega.BeTrue(), "got %v", err)
+		})
+
+		ginkgo.It("should hide credentials from other tenants", func() {
+			gomega.Expect(c.SetPassword(ctx, user_id, "hash")).Should(gomega.Succeed())
+			other := tenant.WithID(context.Background(), otherTenantID)
+
+			_, err := c.GetCredential(other, user_id)
+			gomega.Expect(errors.Is(err, repo.ErrCredentialNotFound)).Should(gomega.BeTrue(), "got %v", err)
+			err = c.SetPassword(other, user_id, "stolen")
+			gomega.Expect(errors.Is(err, repo.ErrNotFound)).Should(gomega.BeTrue(), "got %v", err)
+			gomega.Expect(c.DeleteCredential(other, user_id)).Should(gomega.Succeed())
+
+			cred, err := c.GetCredential(ctx, user_id)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(cred.PasswordHash).Should(gomega.Equal("hash"))
+
+			_, err = c.GetCredential(context.Background(), user_id)
+			gomega.Expect(errors.Is(err, repo.ErrNoTenant)).Should(gomega.BeTrue(), "got %v", err)
+		})
+	})
+}
+
+// ResetClients deletes the OAuth clients of the default tenant, Reset drops
+// those of the other tenants with them
+func ResetClients(c repo.ClientRepo) {
+	ctx := tenant.WithID(context.Background(), model.DefaultTenantID)
+	clients, err := c.GetClients(ctx)
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	for _, client := range *clients {
+		gomega.Expect(c.DeleteClient(ctx, client.ClientID)).Should(gomega.Succeed())
+	}
+}
+
+// DescribeUserTokens registers the conformance specs for the user token repos
+// built by newRepo
+func DescribeUserTokens(name string, newRepo UserTokenFactory) bool {
+	return ginkgo.Describe(name+" user token conformance", func() {
+		var (
+			t       repo.UserTokenRepo
+			r       repo.UserRepo
+			cleanup func()
+			user_id int
+			ctx     = tenant.WithID(context.Background(), model.DefaultTenantID)
+			now     = time.Now().Truncate(time.Second)
+		)
+
+		newToken := func(purpose, hash string, expiresAt time.Time) *model.UserToken {
+			return &model.UserToken{UserID: user_id, Purpose: purpose, TokenHash: hash, Email: "alice@email.com", ExpiresAt: expiresAt}
+		}
+
+		ginkgo.BeforeEach(func() {
+			t, r, cleanup = newRepo()
+
+			var err error
+			user_id, err = r.Create(ctx, newUser("alice"))
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		})
+
+		ginkgo.AfterEach(func() {
+			cleanup()
+		})
+
+		ginkgo.It("should consume a token once", func() {
+			id, err := t.CreateUserToken(ctx, newToken(model.TokenVerifyEmail, "hash-1", now.Add(time.Hour)))
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+			_, err = t.ConsumeUserToken(ctx, model.TokenResetPassword, "hash-1", now)
+			gomega.Expect(errors.Is(err, repo.ErrUserTokenNotFound)).Should(gomega.BeTrue(), "got %v", err)
+
+			token, err := t.ConsumeUserToken(ctx, model.TokenVerifyEmail, "hash-1", now)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(token.TokenID).Should(gomega.Equal(id))
+			gomega.Expect(token.UserID).Should(gomega.Equal(user_id))
+			gomega.Expect(token.TenantID).Should(gomega.Equal(model.DefaultTenantID))
+			gomega.Expect(token.Email).Should(gomega.Equal("alice@email.com"))
+			gomega.Expect(token.ExpiresAt.Equal(now.Add(time.Hour))).Should(gomega.BeTrue(), "got %v", token.ExpiresAt)
+			gomega.Expect(token.UsedAt.Equal(now)).Should(gomega.BeTrue(), "got %v", token.UsedAt)
+
+			_, err = t.ConsumeUserToken(ctx, model.TokenVerifyEmail, "hash-1", now)
+			gomega.Expect(errors.Is(err, repo.ErrUserTokenNotFound)).Should(gomega.BeTrue(), "got %v", err)
+		})
+
+		ginkgo.It("should refuse expired and replaced tokens", func() {
+			_, err := t.CreateUserToken(ctx, newToken(model.TokenResetPassword, "expired", now))
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			_, err = t.ConsumeUserToken(ctx, model.TokenResetPassword, "expired", now)
+			gomega.Expect(errors.Is(err, repo.ErrUserTokenNotFound)).Should(gomega.BeTrue(), "got %v", err)
+
+			_, err = t.CreateUserToken(ctx, newToken(model.TokenResetPassword, "first", now.Add(time.Hour)))
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			_, err = t.CreateUserToken(ctx, newToken(model.TokenVerifyEmail, "other purpose", now.Add(time.Hour)))
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			_, err = t.CreateUserToken(ctx, newToken(model.TokenResetPassword, "second", now.Add(time.Hour)))
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+			_, err = t.ConsumeUserToken(ctx, model.TokenResetPassword, "first", now)
+			gomega.Expect(errors.Is(err, repo.ErrUserTokenNotFound)).Should(gomega.BeTrue(), "got %v", err)
+			_, err = t.ConsumeUserToken(ctx, model.TokenResetPassword, "second", now)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			_, err = t.ConsumeUserToken(ctx, model.TokenVerifyEmail, "other purpose", now)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		})
+
+		ginkgo.It("should verify the email until it changes", func() {
+			ok, err := t.MarkEmailVerified(ctx, user_id, "bob@email.com")
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(ok).Should(gomega.BeFalse())
+
+			ok, err = t.MarkEmailVerified(ctx, user_id, "alice@email.com")
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(ok).Should(gomega.BeTrue())
+			user, err := r.GetById(ctx, user_id)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(user.EmailVerified).Should(gomega.BeTrue())
+
+			user.FirstName = "Alice"
+			_, err = r.Update(ctx, user)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			user, err = r.GetById(ctx, user_id)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(user.EmailVerified).Should(gomega.BeTrue())
+
+			user.Email = "alice@example.com"
+			_, err = r.Update(ctx, user)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			user, err = r.GetById(ctx, user_id)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(user.EmailVerified).Should(gomega.BeFalse())
+		})
+
+		ginkgo.It("should hide tokens from other tenants and drop them with their user", func() {
+			_, err := t.CreateUserToken(ctx, newToken(model.TokenVerifyEmail, "hash", now.Add(time.Hour)))
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			other := tenant.WithID(context.Background(), otherTenantID)
+
+			_, err = t.ConsumeUserToken(other, model.TokenVerifyEmail, "hash", now)
+			gomega.Expect(errors.Is(err, repo.ErrUserTokenNotFound)).Should(gomega.BeTrue(), "got %v", err)
+			_, err = t.CreateUserToken(other, newToken(model.TokenVerifyEmail, "stolen", now.Add(time.Hour)))
+			gomega.Expect(errors.Is(err, repo.ErrNotFound)).Should(gomega.BeTrue(), "got %v", err)
+			ok, err := t.MarkEmailVerified(other, user_id, "alice@email.com")
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(ok).Should(gomega.BeFalse())
+			_, err = t.ConsumeUserToken(context.Background(), model.TokenVerifyEmail, "hash", now)
+			gomega.Expect(errors.Is(err, repo.ErrNoTenant)).Should(gomega.BeTrue(), "got %v", err)
+
+			gomega.Expect(r.Delete(ctx, user_id)).Should(gomega.Succeed())
+			_, err = t.ConsumeUserToken(ctx, model.TokenVerifyEmail, "hash", now)
+			gomega.Expect(errors.Is(err, repo.ErrUserTokenNotFound)).Should(gomega.BeTrue(), "got %v", err)
+		})
+	})
+}
+
+// DescribeTwoFactor registers the conformance specs for the second factor
+// repos built by newRepo
+func DescribeTwoFactor(name string, newRepo TwoFactorFactory) bool {
+	return ginkgo.Describe(name+" two-factor conformance", func() {
+		var (
+			t       repo.TwoFactorRepo
+			r       repo.UserRepo
+			cleanup func()
+			user_id int
+			ctx     = tenant.WithID(context.Background(), model.DefaultTenantID)
+		)
+
+		ginkgo.BeforeEach(func() {
+			t, r, cleanup = newRepo()
+
+			var err error
+			user_id, err = r.Create(ctx, newUser("alice"))
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		})
+
+		ginkgo.AfterEach(func() {
+			cleanup()
+		})
+
+		ginkgo.It("should enroll and confirm a factor once", func() {
+			_, err := t.GetTwoFactor(ctx, user_id)
+			gomega.Expect(errors.Is(err, repo.ErrTwoFactorNotFound)).Should(gomega.BeTrue(), "got %v", err)
+			err = t.ConfirmTwoFactor(ctx, user_id, 10, nil)
+			gomega.Expect(errors.Is(err, repo.ErrTwoFactorNotFound)).Should(gomega.BeTrue(), "got %v", err)
+
+			gomega.Expect(t.EnrollTwoFactor(ctx, user_id, "secret")).Should(gomega.Succeed())
+			f, err := t.GetTwoFactor(ctx, user_id)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(f.UserID).Should(gomega.Equal(user_id))
+			gomega.Expect(f.TenantID).Should(gomega.Equal(model.DefaultTenantID))
+			gomega.Expect(f.Secret).Should(gomega.Equal("secret"))
+			gomega.Expect(f.Confirmed()).Should(gomega.BeFalse())
+
+			gomega.Expect(t.ConfirmTwoFactor(ctx, user_id, 10, []string{"a", "b"})).Should(gomega.Succeed())
+			f, err = t.GetTwoFactor(ctx, user_id)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(f.Confirmed()).Should(gomega.BeTrue())
+			gomega.Expect(f.LastStep).Should(gomega.Equal(int64(10)))
+			n, err := t.CountRecoveryCodes(ctx, user_id)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(n).Should(gomega.Equal(2))
+
+			err = t.ConfirmTwoFactor(ctx, user_id, 11, nil)
+			gomega.Expect(errors.Is(err, repo.ErrTwoFactorNotFound)).Should(gomega.BeTrue(), "got %v", err)
+
+			// Enrolling again starts over
+			gomega.Expect(t.EnrollTwoFactor(ctx, user_id, "other")).Should(gomega.Succeed())
+			f, err = t.GetTwoFactor(ctx, user_id)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(f.Secret).Should(gomega.Equal("other"))
+			gomega.Expect(f.Confirmed()).Should(gomega.BeFalse())
+			gomega.Expect(f.LastStep).Should(gomega.Equal(int64(0)))
+			n, err = t.CountRecoveryCodes(ctx, user_id)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(n).Should(gomega.Equal(0))
+		})
+
+		ginkgo.It("should accept each step and recovery code once", func() {
+			gomega.Expect(t.EnrollTwoFactor(ctx, user_id, "secret")).Should(gomega.Succeed())
+			gomega.Expect(t.ConfirmTwoFactor(ctx, user_id, 10, []string{"a", "b"})).Should(gomega.Succeed())
+
+			for _, c := range []struct {
+				step int64
+				ok   bool
+			}{{10, false}, {9, false}, {11, true}, {11, false}, {13, true}} {
+				ok, err := t.UseTwoFactorStep(ctx, user_id, c.step)
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+				gomega.Expect(ok).Should(gomega.Equal(c.ok), "step %d", c.step)
+			}
+
+			ok, err := t.UseRecoveryCode(ctx, user_id, "a")
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(ok).Should(gomega.BeTrue())
+			ok, err = t.UseRecoveryCode(ctx, user_id, "a")
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(ok).Should(gomega.BeFalse())
+			n, err := t.CountRecoveryCodes(ctx, user_id)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(n).Should(gomega.Equal(1))
+
+			gomega.Expect(t.ReplaceRecoveryCodes(ctx, user_id, []string{"a", "c", "d"})).Should(gomega.Succeed())
+			ok, err = t.UseRecoveryCode(ctx, user_id, "a")
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(ok).Should(gomega.BeTrue())
+			ok, err = t.UseRecoveryCode(ctx, user_id, "b")
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(ok).Should(gomega.BeFalse())
+			n, err = t.CountRecoveryCodes(ctx, user_id)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(n).Should(gomega.Equal(2))
+		})
+
+		ginkgo.It("should delete factors and keep them in their tenant", func() {
+			other := tenant.WithID(context.Background(), otherTenantID)
+			err := t.EnrollTwoFactor(other, user_id, "stolen")
+			gomega.Expect(errors.Is(err, repo.ErrNotFound)).Should(gomega.BeTrue(), "got %v", err)
+			err = t.EnrollTwoFactor(ctx, user_id+1000, "secret")
+			gomega.Expect(errors.Is(err, repo.ErrNotFound)).Should(gomega.BeTrue(), "got %v", err)
+			err = t.ReplaceRecoveryCodes(ctx, user_id, []string{"a"})
+			gomega.Expect(errors.Is(err, repo.ErrTwoFactorNotFound)).Should(gomega.BeTrue(), "got %v", err)
+			_, err = t.GetTwoFactor(context.Background(), user_id)
+			gomega.Expect(errors.Is(err, repo.ErrNoTenant)).Should(gomega.BeTrue(), "got %v", err)
+
+			gomega.Expect(t.EnrollTwoFactor(ctx, user_id, "secret")).Should(gomega.Succeed())
+			gomega.Expect(t.ConfirmTwoFactor(ctx, user_id, 10, []string{"a"})).Should(gomega.Succeed())
+			_, err = t.GetTwoFactor(other, user_id)
+			gomega.Expect(errors.Is(err, repo.ErrTwoFactorNotFound)).Should(gomega.BeTrue(), "got %v", err)
+			ok, err := t.UseTwoFactorStep(other, user_id, 20)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(ok).Should(gomega.BeFalse())
+			ok, err = t.UseRecoveryCode(other, user_id, "a")
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(ok).Should(gomega.BeFalse())
+			gomega.Expect(t.DeleteTwoFactor(other, user_id)).Should(gomega.Succeed())
+			_, err = t.GetTwoFactor(ctx, user_id)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+			gomega.Expect(t.DeleteTwoFactor(ctx, user_id)).Should(gomega.Succeed())
+			gomega.Expect(t.DeleteTwoFactor(ctx, user_id)).Should(gomega.Succeed())
+			_, err = t.GetTwoFactor(ctx, user_id)
+			gomega.Expect(errors.Is(err, repo.ErrTwoFactorNotFound)).Should(gomega.BeTrue(), "got %v", err)
+			n, err := t.CountRecoveryCodes(ctx, user_id)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(n).Should(gomega.Equal(0))
+
+			gomega.Expect(t.EnrollTwoFactor(ctx, user_id, "secret")).Should(gomega.Succeed())
+			gomega.Expect(r.Delete(ctx, user_id)).Should(gomega.Succeed())
+			_, err = t.GetTwoFactor(ctx, user_id)
+			gomega.Expect(errors.Is(err, repo.ErrTwoFactorNotFound)).Should(gomega.BeTrue(), "got %v", err)
+		})
+	})
+}
+
+// DescribeOAuth registers the conformance specs for the OAuth client and
+// authorization code repos built by newRepo
+func DescribeOAuth(name string, newRepo OAuthFactory) bool {
+	return ginkgo.Describe(name+" OAuth conformance", func() {
+		var (
+			c       repo.ClientRepo
+			codes   repo.AuthorizationCodeRepo
+			r       repo.UserRepo
+			cleanup func()
+			user_id int
+			ctx     = tenant.WithID(context.Background(), model.DefaultTenantID)
+			now     = time.Now().Truncate(time.Second)
+		)
+
+		newClient := func(client_id, name, secretHash string) *model.OAuthClient {
+			return &model.OAuthClient{ClientID: client_id, Name: name, SecretHash: secretHash, RedirectURIs: []string{"https://app.example.com/callback"}}
+		}
+
+		newCode := func(client_id, hash string, expiresAt time.Time) *model.AuthorizationCode {
+			return &model.AuthorizationCode{
+				ClientID:      client_id,
+				UserID:        user_id,
+				CodeHash:      hash,
+				RedirectURI:   "https://app.example.com/callback",
+				Scope:         "openid profile",
+				Nonce:         "nonce",
+				CodeChallenge: "challenge",
+				AuthTime:      now.Add(-time.Minute),
+				ExpiresAt:     expiresAt,
+			}
+		}
+
+		ginkgo.BeforeEach(func() {
+			c, codes, r, cleanup = newRepo()
+
+			var err error
+			user_id, err = r.Create(ctx, newUser("alice"))
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		})
+
+		ginkgo.AfterEach(func() {
+			cleanup()
+		})
+
+		ginkgo.It("should create, update and delete clients", func() {
+			_, err := c.GetClient(ctx, "wiki")
+			gomega.Expect(errors.Is(err, repo.ErrClientNotFound)).Should(gomega.BeTrue(), "got %v", err)
+
+			gomega.Expect(c.CreateClient(ctx, newClient("wiki", "Wiki", "hash"))).Should(gomega.Succeed())
+			gomega.Expect(c.CreateClient(ctx, newClient("board", "Board", ""))).Should(gomega.Succeed())
+
+			client, err := c.GetClient(ctx, "wiki")
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(client.TenantID).Should(gomega.Equal(model.DefaultTenantID))
+			gomega.Expect(client.Name).Should(gomega.Equal("Wiki"))
+			gomega.Expect(client.SecretHash).Should(gomega.Equal("hash"))
+			gomega.Expect(client.RedirectURIs).Should(gomega.Equal([]string{"https://app.example.com/callback"}))
+			gomega.Expect(client.CreatedAt).ShouldNot(gomega.BeZero())
+			client, err = c.GetClient(ctx, "board")
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(client.Public()).Should(gomega.BeTrue())
+
+			clients, err := c.GetClients(ctx)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(*clients).Should(gomega.HaveLen(2))
+			gomega.Expect((*clients)[0].ClientID).Should(gomega.Equal("board"))
+
+			client = newClient("wiki", "Team wiki", "")
+			client.RedirectURIs = []string{"https://wiki.example.com/a", "https://wiki.example.com/b"}
+			gomega.Expect(c.UpdateClient(ctx, client)).Should(gomega.Succeed())
+			gomega.Expect(c.SetClientSecret(ctx, "wiki", "new hash")).Should(gomega.Succeed())
+			client, err = c.GetClient(ctx, "wiki")
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(client.Name).Should(gomega.Equal("Team wiki"))
+			gomega.Expect(client.RedirectURIs).Should(gomega.Equal([]string{"https://wiki.example.com/a", "https://wiki.example.com/b"}))
+			gomega.Expect(client.SecretHash).Should(gomega.Equal("new hash"))
+
+			err = c.UpdateClient(ctx, newClient("missing", "Missing", ""))
+			gomega.Expect(errors.Is(err, repo.ErrClientNotFound)).Should(gomega.BeTrue(), "got %v", err)
+			err = c.SetClientSecret(ctx, "missing", "hash")
+			gomega.Expect(errors.Is(err, repo.ErrClientNotFound)).Should(gomega.BeTrue(), "got %v", err)
+
+			gomega.Expect(c.DeleteClient(ctx, "wiki")).Should(gomega.Succeed())
+			gomega.Expect(c.DeleteClient(ctx, "wiki")).Should(gomega.Succeed())
+			_, err = c.GetClient(ctx, "wiki")
+			gomega.Expect(errors.Is(err, repo.ErrClientNotFound)).Should(gomega.BeTrue(), "got %v", err)
+		})
+
+		ginkgo.It("should find clients in every tenant and hide them from the others", func() {
+			gomega.Expect(c.CreateClient(ctx, newClient("wiki", "Wiki", "hash"))).Should(gomega.Succeed())
+			other := tenant.WithID(context.Background(), otherTenantID)
+
+			client, err := c.FindClient(context.Background(), "wiki")
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(client.TenantID).Should(gomega.Equal(model.DefaultTenantID))
+			_, err = c.FindClient(context.Background(), "missing")
+			gomega.Expect(errors.Is(err, repo.ErrClientNotFound)).Should(gomega.BeTrue(), "got %v", err)
+
+			_, err = c.GetClient(other, "wiki")
+			gomega.Expect(errors.Is(err, repo.ErrClientNotFound)).Should(gomega.BeTrue(), "got %v", err)
+			clients, err := c.GetClients(other)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(*clients).Should(gomega.BeEmpty())
+			err = c.UpdateClient(other, newClient("wiki", "Stolen", ""))
+			gomega.Expect(errors.Is(err, repo.ErrClientNotFound)).Should(gomega.BeTrue(), "got %v", err)
+			err = c.SetClientSecret(other, "wiki", "stolen")
+			gomega.Expect(errors.Is(err, repo.ErrClientNotFound)).Should(gomega.BeTrue(), "got %v", err)
+			gomega.Expect(c.DeleteClient(other, "wiki")).Should(gomega.Succeed())
+			_, err = c.GetClients(context.Background())
+			gomega.Expect(errors.Is(err, repo.ErrNoTenant)).Should(gomega.BeTrue(), "got %v", err)
+
+			client, err = c.GetClient(ctx, "wiki")
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(client.Name).Should(gomega.Equal("Wiki"))
+			gomega.Expect(client.SecretHash).Should(gomega.Equal("hash"))
+		})
+
+		ginkgo.It("should consume an authorization code once", func() {
+			gomega.Expect(c.CreateClient(ctx, newClient("wiki", "Wiki", ""))).Should(gomega.Succeed())
+			code := newCode("wiki", "hash", now.Add(time.Minute))
+			gomega.Expect(codes.CreateAuthorizationCode(ctx, code)).Should(gomega.Succeed())
+			gomega.Expect(code.CodeID).ShouldNot(gomega.BeZero())
+
+			_, err := codes.ConsumeAuthorizationCode(ctx, "other", now)
+			gomega.Expect(errors.Is(err, repo.ErrAuthorizationCodeNotFound)).Should(gomega.BeTrue(), "got %v", err)
+
+			got, err := codes.ConsumeAuthorizationCode(ctx, "hash", now)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(got.CodeID).Should(gomega.Equal(code.CodeID))
+			gomega.Expect(got.ClientID).Should(gomega.Equal("wiki"))
+			gomega.Expect(got.UserID).Should(gomega.Equal(user_id))
+			gomega.Expect(got.TenantID).Should(gomega.Equal(model.DefaultTenantID))
+			gomega.Expect(got.RedirectURI).Should(gomega.Equal("https://app.example.com/callback"))
+			gomega.Expect(got.Scope).Should(gomega.Equal("openid profile"))
+			gomega.Expect(got.Nonce).Should(gomega.Equal("nonce"))
+			gomega.Expect(got.CodeChallenge).Should(gomega.Equal("challenge"))
+			gomega.Expect(got.AuthTime.Equal(now.Add(-time.Minute))).Should(gomega.BeTrue(), "got %v", got.AuthTime)
+			gomega.Expect(got.UsedAt.Equal(now)).Should(gomega.BeTrue(), "got %v", got.UsedAt)
+
+			_, err = codes.ConsumeAuthorizationCode(ctx, "hash", now)
+			gomega.Expect(errors.Is(err, repo.ErrAuthorizationCodeNotFound)).Should(gomega.BeTrue(), "got %v", err)
+
+			gomega.Expect(codes.CreateAuthorizationCode(ctx, newCode("wiki", "expired", now))).Should(gomega.Succeed())
+			_, err = codes.ConsumeAuthorizationCode(ctx, "expired", now)
+			gomega.Expect(errors.Is(err, repo.ErrAuthorizationCodeNotFound)).Should(gomega.BeTrue(), "got %v", err)
+		})
+
+		ginkgo.It("should keep codes in their tenant and drop them with their user or client", func() {
+			gomega.Expect(c.CreateClient(ctx, newClient("wiki", "Wiki", ""))).Should(gomega.Succeed())
+			other := tenant.WithID(context.Background(), otherTenantID)
+
+			err := codes.CreateAuthorizationCode(other, newCode("wiki", "stolen", now.Add(time.Minute)))
+			gomega.Expect(errors.Is(err, repo.ErrNotFound)).Should(gomega.BeTrue(), "got %v", err)
+			err = codes.CreateAuthorizationCode(ctx, newCode("missing", "hash", now.Add(time.Minute)))
+			gomega.Expect(errors.Is(err, repo.ErrNotFound)).Should(gomega.BeTrue(), "got %v", err)
+
+			gomega.Expect(codes.CreateAuthorizationCode(ctx, newCode("wiki", "hash", now.Add(time.Minute)))).Should(gomega.Succeed())
+			_, err = codes.ConsumeAuthorizationCode(other, "hash", now)
+			gomega.Expect(errors.Is(err, repo.ErrAuthorizationCodeNotFound)).Should(gomega.BeTrue(), "got %v", err)
+			_, err = codes.ConsumeAuthorizationCode(context.Background(), "hash", now)
+			gomega.Expect(errors.Is(err, repo.ErrNoTenant)).Should(gomega.BeTrue(), "got %v", err)
+
+			gomega.Expect(c.DeleteClient(ctx, "wiki")).Should(gomega.Succeed())
+			_, err = codes.ConsumeAuthorizationCode(ctx, "hash", now)
+			gomega.Expect(errors.Is(err, repo.ErrAuthorizationCodeNotFound)).Should(gomega.BeTrue(), "got %v", err)
+
+			gomega.Expect(c.CreateClient(ctx, newClient("wiki", "Wiki", ""))).Should(gomega.Succeed())
+			gomega.Expect(codes.CreateAuthorizationCode(ctx, newCode("wiki", "hash", now.Add(time.Minute)))).Should(gomega.Succeed())
+			gomega.Expect(r.Delete(ctx, user_id)).Should(gomega.Succeed())
+			_, err = codes.ConsumeAuthorizationCode(ctx, "hash", now)
+			gomega.Expect(errors.Is(err, repo.ErrAuthorizationCodeNotFound)).Should(gomega.BeTrue(), "got %v", err)
+		})
+	})
+}
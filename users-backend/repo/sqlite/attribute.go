@@ -0,0 +1,155 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"users-backend/model"
+	"users-backend/repo"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+const attributeColumns = `attribute_id, tenant_id, name, type, required, "unique", enum_values`
+
+// wrapAttributeError adds the repo sentinel errors to the driver errors they
+// stand for in the attribute_definitions table
+func wrapAttributeError(err error) error {
+	var sqliteErr *sqlite.Error
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return fmt.Errorf("%w: %w", repo.ErrAttributeNotFound, err)
+	case errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE:
+		return fmt.Errorf("%w: %w", repo.ErrDuplicateAttribute, err)
+	}
+	return err
+}
+
+// attributePath is the JSON path of the attribute name in users.attributes
+func attributePath(name string) string {
+	b, _ := json.Marshal(name)
+	return "$." + string(b)
+}
+
+func scanAttribute(row scanner) (*model.AttributeDefinition, error) {
+	var (
+		def        model.AttributeDefinition
+		enumValues string
+	)
+	if err := row.Scan(&def.AttributeID, &def.TenantID, &def.Name, &def.Type, &def.Required, &def.Unique, &enumValues); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(enumValues), &def.EnumValues); err != nil {
+		return nil, err
+	}
+	if len(def.EnumValues) == 0 {
+		def.EnumValues = nil
+	}
+	return &def, nil
+}
+
+func (r *SQLiteRepo) GetAttribute(ctx context.Context, attribute_id int) (*model.AttributeDefinition, error) {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	def, err := scanAttribute(r.conn(ctx).QueryRowContext(ctx, "SELECT "+attributeColumns+" FROM attribute_definitions WHERE tenant_id = ? AND attribute_id = ?", tenant_id, attribute_id))
+	if err != nil {
+		r.logError(ctx, "failed to get attribute", err, "attribute_id", attribute_id)
+		return nil, wrapAttributeError(err)
+	}
+	return def, nil
+}
+
+func (r *SQLiteRepo) GetAttributes(ctx context.Context) (*[]model.AttributeDefinition, error) {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.conn(ctx).QueryContext(ctx, "SELECT "+attributeColumns+" FROM attribute_definitions WHERE tenant_id = ? ORDER BY name", tenant_id)
+	if err != nil {
+		r.logError(ctx, "failed to get attributes", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	defs := []model.AttributeDefinition{}
+	for rows.Next() {
+		def, err := scanAttribute(rows)
+		if err != nil {
+			r.logError(ctx, "failed to read attribute", err)
+			return nil, err
+		}
+		defs = append(defs, *def)
+	}
+	if err := rows.Err(); err != nil {
+		r.logError(ctx, "failed to get attributes", err)
+		return nil, err
+	}
+
+	return &defs, nil
+}
+
+func (r *SQLiteRepo) CreateAttribute(ctx context.Context, def *model.AttributeDefinition) (int, error) {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return -1, err
+	}
+
+	enumValues, err := json.Marshal(append([]string{}, def.EnumValues...))
+	if err != nil {
+		return -1, err
+	}
+
+	res, err := r.conn(ctx).ExecContext(ctx,
+		`INSERT INTO attribute_definitions (tenant_id, name, type, required, "unique", enum_values) VALUES (?, ?, ?, ?, ?, ?)`,
+		tenant_id, def.Name, def.Type, def.Required, def.Unique, string(enumValues))
+	if err != nil {
+		r.logError(ctx, "failed to insert attribute", err, "attribute_name", def.Name)
+		return -1, wrapAttributeError(err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		r.logError(ctx, "failed to read inserted attribute id", err, "attribute_name", def.Name)
+		return -1, err
+	}
+
+	def.AttributeID = int(id)
+	def.TenantID = tenant_id
+	return def.AttributeID, nil
+}
+
+func (r *SQLiteRepo) DeleteAttribute(ctx context.Context, attribute_id int) error {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = r.RunInTx(ctx, func(ctx context.Context) error {
+		var name string
+		err := r.conn(ctx).QueryRowContext(ctx, "SELECT name FROM attribute_definitions WHERE tenant_id = ? AND attribute_id = ?", tenant_id, attribute_id).Scan(&name)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = r.conn(ctx).ExecContext(ctx, "UPDATE users SET attributes = json_remove(attributes, ?) WHERE tenant_id = ?", attributePath(name), tenant_id)
+		if err != nil {
+			return err
+		}
+		_, err = r.conn(ctx).ExecContext(ctx, "DELETE FROM attribute_definitions WHERE attribute_id = ?", attribute_id)
+		return err
+	})
+	if err != nil {
+		r.logError(ctx, "failed to delete attribute", err, "attribute_id", attribute_id)
+	}
+	return err
+}
@@ -0,0 +1,132 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+	"users-backend/model"
+	"users-backend/repo"
+)
+
+// wrapCredentialError adds ErrCredentialNotFound to the driver errors
+// returned for users without password
+func wrapCredentialError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %w", repo.ErrCredentialNotFound, err)
+	}
+	return err
+}
+
+func (r *SQLiteRepo) GetCredential(ctx context.Context, user_id int) (*model.Credential, error) {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		c           model.Credential
+		lockedUntil sql.NullTime
+	)
+	err = r.conn(ctx).QueryRowContext(ctx,
+		"SELECT user_id, tenant_id, password_hash, failed_attempts, locked_until, updated_at FROM user_credentials WHERE tenant_id = ? AND user_id = ?",
+		tenant_id, user_id).Scan(&c.UserID, &c.TenantID, &c.PasswordHash, &c.FailedAttempts, &lockedUntil, &c.UpdatedAt)
+	if err != nil {
+		r.logError(ctx, "failed to get credential", err, "user_id", user_id)
+		return nil, wrapCredentialError(err)
+	}
+	c.LockedUntil = lockedUntil.Time
+	return &c, nil
+}
+
+func (r *SQLiteRepo) SetPassword(ctx context.Context, user_id int, hash string) error {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Selecting the user keeps the credential in its tenant
+	res, err := r.conn(ctx).ExecContext(ctx, `INSERT INTO user_credentials (user_id, tenant_id, password_hash, failed_attempts, locked_until, updated_at)
+		SELECT user_id, tenant_id, ?, 0, NULL, ? FROM users WHERE tenant_id = ? AND user_id = ?
+		ON CONFLICT (user_id) DO UPDATE SET password_hash = excluded.password_hash, failed_attempts = 0, locked_until = NULL, updated_at = excluded.updated_at`,
+		hash, time.Now().UTC(), tenant_id, user_id)
+	if err != nil {
+		r.logError(ctx, "failed to set password", err, "user_id", user_id)
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		r.logError(ctx, "failed to set password", err, "user_id", user_id)
+		return err
+	}
+	if n == 0 {
+		r.logError(ctx, "failed to get user for password", sql.ErrNoRows, "user_id", user_id)
+		return wrapError(sql.ErrNoRows)
+	}
+	return nil
+}
+
+func (r *SQLiteRepo) DeleteCredential(ctx context.Context, user_id int) error {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	if _, err := r.conn(ctx).ExecContext(ctx, "DELETE FROM user_credentials WHERE tenant_id = ? AND user_id = ?", tenant_id, user_id); err != nil {
+		r.logError(ctx, "failed to delete credential", err, "user_id", user_id)
+		return err
+	}
+	return nil
+}
+
+func (r *SQLiteRepo) RecordLoginFailure(ctx context.Context, user_id int) (int, error) {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	err = r.conn(ctx).QueryRowContext(ctx,
+		"UPDATE user_credentials SET failed_attempts = failed_attempts + 1 WHERE tenant_id = ? AND user_id = ? RETURNING failed_attempts",
+		tenant_id, user_id).Scan(&n)
+	if err != nil {
+		r.logError(ctx, "failed to record login failure", err, "user_id", user_id)
+		return 0, wrapCredentialError(err)
+	}
+	return n, nil
+}
+
+func (r *SQLiteRepo) RecordLoginSuccess(ctx context.Context, user_id int) error {
+	return r.updateCredential(ctx, "failed to record login success", user_id, "failed_attempts = 0, locked_until = NULL")
+}
+
+func (r *SQLiteRepo) LockCredential(ctx context.Context, user_id int, until time.Time) error {
+	return r.updateCredential(ctx, "failed to lock credential", user_id, "failed_attempts = 0, locked_until = ?", until.UTC())
+}
+
+// updateCredential runs the set clause on the credential of the user
+func (r *SQLiteRepo) updateCredential(ctx context.Context, msg string, user_id int, set string, args ...any) error {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	res, err := r.conn(ctx).ExecContext(ctx, "UPDATE user_credentials SET "+set+" WHERE tenant_id = ? AND user_id = ?", append(args, tenant_id, user_id)...)
+	if err != nil {
+		r.logError(ctx, msg, err, "user_id", user_id)
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		r.logError(ctx, msg, err, "user_id", user_id)
+		return err
+	}
+	if n == 0 {
+		r.logError(ctx, msg, sql.ErrNoRows, "user_id", user_id)
+		return wrapCredentialError(sql.ErrNoRows)
+	}
+	return nil
+}
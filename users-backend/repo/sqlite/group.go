@@ -0,0 +1,302 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"users-backend/model"
+	"users-backend/repo"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+const groupColumns = "group_id, tenant_id, name, description, parent_id"
+
+// wrapGroupError adds the repo sentinel errors to the driver errors they
+// stand for in the groups table
+func wrapGroupError(err error) error {
+	var sqliteErr *sqlite.Error
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return fmt.Errorf("%w: %w", repo.ErrGroupNotFound, err)
+	case errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE:
+		return fmt.Errorf("%w: %w", repo.ErrDuplicateGroupName, err)
+	}
+	return err
+}
+
+// idList returns the placeholders of an IN list of the ids and their values
+func idList(ids []int) (string, []any) {
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", "), args
+}
+
+func scanGroup(row scanner) (*model.Group, error) {
+	var g model.Group
+	if err := row.Scan(&g.GroupID, &g.TenantID, &g.Name, &g.Description, &g.ParentID); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// queryGroups runs a query selecting groupColumns
+func (r *SQLiteRepo) queryGroups(ctx context.Context, query string, args ...any) (*[]model.Group, error) {
+	rows, err := r.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []model.Group{}
+	for rows.Next() {
+		g, err := scanGroup(rows)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, *g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &groups, nil
+}
+
+func (r *SQLiteRepo) GetGroup(ctx context.Context, group_id int) (*model.Group, error) {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	g, err := scanGroup(r.conn(ctx).QueryRowContext(ctx, "SELECT "+groupColumns+" FROM groups WHERE tenant_id = ? AND group_id = ?", tenant_id, group_id))
+	if err != nil {
+		r.logError(ctx, "failed to get group", err, "group_id", group_id)
+		return nil, wrapGroupError(err)
+	}
+	return g, nil
+}
+
+func (r *SQLiteRepo) GetGroups(ctx context.Context) (*[]model.Group, error) {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	groups, err := r.queryGroups(ctx, "SELECT "+groupColumns+" FROM groups WHERE tenant_id = ? ORDER BY name", tenant_id)
+	if err != nil {
+		r.logError(ctx, "failed to get groups", err)
+		return nil, err
+	}
+	return groups, nil
+}
+
+func (r *SQLiteRepo) CreateGroup(ctx context.Context, g *model.Group) (int, error) {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return -1, err
+	}
+
+	res, err := r.conn(ctx).ExecContext(ctx,
+		"INSERT INTO groups (tenant_id, name, description, parent_id) VALUES (?, ?, ?, ?)",
+		tenant_id, g.Name, g.Description, g.ParentID)
+	if err != nil {
+		r.logError(ctx, "failed to insert group", err, "group_name", g.Name)
+		return -1, wrapGroupError(err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		r.logError(ctx, "failed to read inserted group id", err, "group_name", g.Name)
+		return -1, err
+	}
+
+	g.GroupID = int(id)
+	g.TenantID = tenant_id
+	return g.GroupID, nil
+}
+
+func (r *SQLiteRepo) UpdateGroup(ctx context.Context, g *model.Group) (int, error) {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return -1, err
+	}
+
+	res, err := r.conn(ctx).ExecContext(ctx,
+		"UPDATE groups SET name = ?, description = ?, parent_id = ? WHERE tenant_id = ? AND group_id = ?",
+		g.Name, g.Description, g.ParentID, tenant_id, g.GroupID)
+	if err != nil {
+		r.logError(ctx, "failed to update group", err, "group_id", g.GroupID)
+		return -1, wrapGroupError(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		r.logError(ctx, "failed to update group", err, "group_id", g.GroupID)
+		return -1, err
+	}
+	if n == 0 {
+		r.logError(ctx, "failed to get group for update", sql.ErrNoRows, "group_id", g.GroupID)
+		return -1, wrapGroupError(sql.ErrNoRows)
+	}
+
+	g.TenantID = tenant_id
+	return g.GroupID, nil
+}
+
+func (r *SQLiteRepo) DeleteGroup(ctx context.Context, group_id int) error {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = r.RunInTx(ctx, func(ctx context.Context) error {
+		var parent_id sql.NullInt64
+		err := r.conn(ctx).QueryRowContext(ctx, "SELECT parent_id FROM groups WHERE tenant_id = ? AND group_id = ?", tenant_id, group_id).Scan(&parent_id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = r.conn(ctx).ExecContext(ctx, "UPDATE groups SET parent_id = ? WHERE parent_id = ?", parent_id, group_id)
+		if err != nil {
+			return err
+		}
+		// The memberships go with the group
+		_, err = r.conn(ctx).ExecContext(ctx, "DELETE FROM groups WHERE group_id = ?", group_id)
+		return err
+	})
+	if err != nil {
+		r.logError(ctx, "failed to delete group", err, "group_id", group_id)
+	}
+	return err
+}
+
+func (r *SQLiteRepo) GetGroupAncestors(ctx context.Context, group_id int) (*[]model.Group, error) {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	groups, err := r.queryGroups(ctx, `WITH RECURSIVE ancestors (group_id, depth) AS (
+		SELECT parent_id, 1 FROM groups WHERE tenant_id = ?1 AND group_id = ?2 AND parent_id IS NOT NULL
+		UNION ALL
+		SELECT g.parent_id, a.depth + 1 FROM groups g JOIN ancestors a ON g.group_id = a.group_id
+		WHERE g.tenant_id = ?1 AND g.parent_id IS NOT NULL AND a.depth < ?3
+	)
+	SELECT `+groupColumns+` FROM groups JOIN ancestors USING (group_id) WHERE tenant_id = ?1 ORDER BY depth`, tenant_id, group_id, maxHierarchyDepth)
+	if err != nil {
+		r.logError(ctx, "failed to get group ancestors", err, "group_id", group_id)
+		return nil, err
+	}
+	return groups, nil
+}
+
+func (r *SQLiteRepo) GetGroupMembers(ctx context.Context, group_id int, transitive bool) (*[]model.User, error) {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// UNION drops the groups already visited, which also stops the recursion
+	users, err := r.queryUsers(ctx, `WITH RECURSIVE subgroups (group_id) AS (
+		SELECT ?2
+		UNION
+		SELECT g.group_id FROM groups g JOIN subgroups s ON g.parent_id = s.group_id
+		WHERE ?3 AND g.tenant_id = ?1
+	)
+	SELECT `+userColumns+` FROM users WHERE tenant_id = ?1 AND user_id IN (
+		SELECT user_id FROM group_members WHERE tenant_id = ?1 AND group_id IN (SELECT group_id FROM subgroups)
+	) ORDER BY user_id`, tenant_id, group_id, transitive)
+	if err != nil {
+		r.logError(ctx, "failed to get group members", err, "group_id", group_id)
+		return nil, err
+	}
+	return users, nil
+}
+
+func (r *SQLiteRepo) GetUserGroups(ctx context.Context, user_id int, transitive bool) (*[]model.Group, error) {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	groups, err := r.queryGroups(ctx, `WITH RECURSIVE ancestors (group_id) AS (
+		SELECT group_id FROM group_members WHERE tenant_id = ?1 AND user_id = ?2
+		UNION
+		SELECT g.parent_id FROM groups g JOIN ancestors a ON g.group_id = a.group_id
+		WHERE ?3 AND g.tenant_id = ?1 AND g.parent_id IS NOT NULL
+	)
+	SELECT `+groupColumns+` FROM groups WHERE tenant_id = ?1 AND group_id IN (SELECT group_id FROM ancestors) ORDER BY name`, tenant_id, user_id, transitive)
+	if err != nil {
+		r.logError(ctx, "failed to get user groups", err, "user_id", user_id)
+		return nil, err
+	}
+	return groups, nil
+}
+
+func (r *SQLiteRepo) AddGroupMembers(ctx context.Context, group_id int, user_ids []int) (int, error) {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if len(user_ids) == 0 {
+		return 0, nil
+	}
+
+	in, ids := idList(user_ids)
+	res, err := r.conn(ctx).ExecContext(ctx, `INSERT INTO group_members (group_id, user_id, tenant_id)
+		SELECT g.group_id, u.user_id, g.tenant_id FROM groups g JOIN users u ON u.tenant_id = g.tenant_id
+		WHERE g.tenant_id = ? AND g.group_id = ? AND u.user_id IN (`+in+`)
+		ON CONFLICT DO NOTHING`, append([]any{tenant_id, group_id}, ids...)...)
+	if err != nil {
+		r.logError(ctx, "failed to add group members", err, "group_id", group_id)
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		r.logError(ctx, "failed to add group members", err, "group_id", group_id)
+		return 0, err
+	}
+	return int(n), nil
+}
+
+func (r *SQLiteRepo) RemoveGroupMembers(ctx context.Context, group_id int, user_ids []int) (int, error) {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if len(user_ids) == 0 {
+		return 0, nil
+	}
+
+	in, ids := idList(user_ids)
+	res, err := r.conn(ctx).ExecContext(ctx, "DELETE FROM group_members WHERE tenant_id = ? AND group_id = ? AND user_id IN ("+in+")",
+		append([]any{tenant_id, group_id}, ids...)...)
+	if err != nil {
+		r.logError(ctx, "failed to remove group members", err, "group_id", group_id)
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		r.logError(ctx, "failed to remove group members", err, "group_id", group_id)
+		return 0, err
+	}
+	return int(n), nil
+}
+
+// LockGroupHierarchy has nothing to wait for, the single connection already
+// runs one transaction at a time
+func (r *SQLiteRepo) LockGroupHierarchy(ctx context.Context) error {
+	_, err := repo.TenantID(ctx)
+	return err
+}
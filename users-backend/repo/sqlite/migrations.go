@@ -0,0 +1,114 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"time"
+	"users-backend/repo/migrate"
+)
+
+var (
+	//go:embed migrations/*.sql
+	migrationFiles embed.FS
+
+	_ migrate.Store = migrationStore{}
+)
+
+// migrationStore records applied migrations in schema_migrations
+type migrationStore struct {
+	db *sql.DB
+}
+
+func loadMigrations() ([]migrate.Migration, error) {
+	return migrate.Load(migrationFiles, "migrations")
+}
+
+func (s migrationStore) Init(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)`)
+	return err
+}
+
+func (s migrationStore) Applied(ctx context.Context) (map[int]time.Time, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var (
+			version   int
+			appliedAt time.Time
+		)
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+func (s migrationStore) Apply(ctx context.Context, m migrate.Migration, script string, up bool) error {
+	return runInTx(ctx, s.db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, script); err != nil {
+			return err
+		}
+
+		var err error
+		if up {
+			_, err = tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)", m.Version, m.Name, time.Now().UTC())
+		} else {
+			_, err = tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", m.Version)
+		}
+		return err
+	})
+}
+
+func runInTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// MigrateUp applies the pending migrations and returns them
+func (r *SQLiteRepo) MigrateUp(ctx context.Context) ([]migrate.Migration, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	return migrate.Up(ctx, migrationStore{db: r.db}, migrations)
+}
+
+// MigrateDown reverts the last steps applied migrations and returns them
+func (r *SQLiteRepo) MigrateDown(ctx context.Context, steps int) ([]migrate.Migration, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	return migrate.Down(ctx, migrationStore{db: r.db}, migrations, steps)
+}
+
+// MigrationStatus returns every migration with when it was applied
+func (r *SQLiteRepo) MigrationStatus(ctx context.Context) ([]migrate.Status, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	store := migrationStore{db: r.db}
+	if err := store.Init(ctx); err != nil {
+		return nil, err
+	}
+	return migrate.StatusOf(ctx, store, migrations)
+}
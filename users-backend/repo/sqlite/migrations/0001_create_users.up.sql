@@ -0,0 +1,11 @@
+-- Mirrors the users table go-pg creates for model.User. SQLite does not
+-- enforce varchar lengths, the checks keep the Postgres limits.
+CREATE TABLE users (
+    user_id     INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_name   VARCHAR(50) UNIQUE CHECK (length(user_name) <= 50),
+    first_name  VARCHAR(255) CHECK (length(first_name) <= 255),
+    last_name   VARCHAR(255) CHECK (length(last_name) <= 255),
+    email       VARCHAR(255) CHECK (length(email) <= 255),
+    user_status VARCHAR(1) CHECK (length(user_status) <= 1),
+    department  VARCHAR(255) CHECK (length(department) <= 255)
+);
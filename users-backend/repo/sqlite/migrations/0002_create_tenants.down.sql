@@ -0,0 +1,17 @@
+-- Fails when two tenants have a user with the same name
+CREATE TABLE users_old (
+    user_id     INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_name   VARCHAR(50) UNIQUE CHECK (length(user_name) <= 50),
+    first_name  VARCHAR(255) CHECK (length(first_name) <= 255),
+    last_name   VARCHAR(255) CHECK (length(last_name) <= 255),
+    email       VARCHAR(255) CHECK (length(email) <= 255),
+    user_status VARCHAR(1) CHECK (length(user_status) <= 1),
+    department  VARCHAR(255) CHECK (length(department) <= 255)
+);
+
+INSERT INTO users_old (user_id, user_name, first_name, last_name, email, user_status, department)
+SELECT user_id, user_name, first_name, last_name, email, user_status, department FROM users;
+
+DROP TABLE users;
+ALTER TABLE users_old RENAME TO users;
+DROP TABLE tenants;
@@ -0,0 +1,28 @@
+-- Users belong to a tenant and user names are unique per tenant. SQLite can
+-- not drop a constraint, so users is rebuilt and the existing users are
+-- moved to the default tenant.
+CREATE TABLE tenants (
+    tenant_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    slug      VARCHAR(63) NOT NULL UNIQUE CHECK (length(slug) <= 63),
+    name      VARCHAR(255) NOT NULL CHECK (length(name) <= 255)
+);
+
+INSERT INTO tenants (tenant_id, slug, name) VALUES (1, 'default', 'Default');
+
+CREATE TABLE users_new (
+    user_id     INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant_id   INTEGER NOT NULL REFERENCES tenants (tenant_id),
+    user_name   VARCHAR(50) CHECK (length(user_name) <= 50),
+    first_name  VARCHAR(255) CHECK (length(first_name) <= 255),
+    last_name   VARCHAR(255) CHECK (length(last_name) <= 255),
+    email       VARCHAR(255) CHECK (length(email) <= 255),
+    user_status VARCHAR(1) CHECK (length(user_status) <= 1),
+    department  VARCHAR(255) CHECK (length(department) <= 255),
+    UNIQUE (tenant_id, user_name)
+);
+
+INSERT INTO users_new (user_id, tenant_id, user_name, first_name, last_name, email, user_status, department)
+SELECT user_id, 1, user_name, first_name, last_name, email, user_status, department FROM users;
+
+DROP TABLE users;
+ALTER TABLE users_new RENAME TO users;
@@ -0,0 +1,14 @@
+-- Custom attributes are defined per tenant, their values are kept as a JSON
+-- object on each user
+CREATE TABLE attribute_definitions (
+    attribute_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant_id    INTEGER NOT NULL REFERENCES tenants (tenant_id) ON DELETE CASCADE,
+    name         VARCHAR(63) NOT NULL CHECK (length(name) <= 63),
+    type         TEXT NOT NULL CHECK (type IN ('string', 'number', 'date', 'enum')),
+    required     BOOLEAN NOT NULL DEFAULT FALSE,
+    "unique"     BOOLEAN NOT NULL DEFAULT FALSE,
+    enum_values  TEXT NOT NULL DEFAULT '[]' CHECK (json_valid(enum_values)),
+    UNIQUE (tenant_id, name)
+);
+
+ALTER TABLE users ADD COLUMN attributes TEXT NOT NULL DEFAULT '{}' CHECK (json_valid(attributes));
@@ -0,0 +1,2 @@
+DROP INDEX users_manager_id_idx;
+ALTER TABLE users DROP COLUMN manager_id;
@@ -0,0 +1,6 @@
+-- A user may report to a manager of the same tenant. Deleting the manager
+-- leaves the reports without one.
+ALTER TABLE users ADD COLUMN manager_id INTEGER REFERENCES users (user_id) ON DELETE SET NULL
+    CHECK (manager_id <> user_id);
+-- Serves the direct reports and subtree queries
+CREATE INDEX users_manager_id_idx ON users (manager_id);
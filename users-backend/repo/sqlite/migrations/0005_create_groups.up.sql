@@ -0,0 +1,21 @@
+-- Groups are the teams and distribution lists of a tenant. A group may be
+-- nested in a parent group, deleting the parent moves it to the top.
+CREATE TABLE groups (
+    group_id    INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant_id   INTEGER NOT NULL REFERENCES tenants (tenant_id) ON DELETE CASCADE,
+    name        VARCHAR(255) NOT NULL CHECK (length(name) <= 255),
+    description TEXT NOT NULL DEFAULT '',
+    parent_id   INTEGER REFERENCES groups (group_id) ON DELETE SET NULL CHECK (parent_id <> group_id),
+    UNIQUE (tenant_id, name)
+);
+-- Serves the subgroup lookups of the transitive queries
+CREATE INDEX groups_parent_id_idx ON groups (parent_id);
+
+CREATE TABLE group_members (
+    group_id  INTEGER NOT NULL REFERENCES groups (group_id) ON DELETE CASCADE,
+    user_id   INTEGER NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    tenant_id INTEGER NOT NULL REFERENCES tenants (tenant_id) ON DELETE CASCADE,
+    PRIMARY KEY (group_id, user_id)
+);
+-- Serves the groups of a user
+CREATE INDEX group_members_user_id_idx ON group_members (user_id);
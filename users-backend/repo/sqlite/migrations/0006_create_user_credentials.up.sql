@@ -0,0 +1,10 @@
+-- The local password of a user, users without one cannot log in with a
+-- password. Failed logins are counted until the account is locked.
+CREATE TABLE user_credentials (
+    user_id         INTEGER PRIMARY KEY REFERENCES users (user_id) ON DELETE CASCADE,
+    tenant_id       INTEGER NOT NULL REFERENCES tenants (tenant_id) ON DELETE CASCADE,
+    password_hash   TEXT NOT NULL,
+    failed_attempts INTEGER NOT NULL DEFAULT 0,
+    locked_until    TIMESTAMP,
+    updated_at      TIMESTAMP NOT NULL
+);
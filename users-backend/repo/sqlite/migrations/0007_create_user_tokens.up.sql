@@ -0,0 +1,20 @@
+-- The email of a user is verified once a verification link mailed to it is
+-- followed, changing the email clears it
+ALTER TABLE users ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT false;
+
+-- The single use tokens mailed to users to verify their email or reset their
+-- password. Only the SHA-256 of a token is stored.
+CREATE TABLE user_tokens (
+    token_id   INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id    INTEGER NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    tenant_id  INTEGER NOT NULL REFERENCES tenants (tenant_id) ON DELETE CASCADE,
+    purpose    TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    -- email is the address the token was sent to
+    email      TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at    TIMESTAMP,
+    created_at TIMESTAMP NOT NULL
+);
+-- Serves dropping the earlier tokens of a user
+CREATE INDEX user_tokens_user_id_idx ON user_tokens (user_id, purpose);
@@ -0,0 +1,23 @@
+-- The TOTP second factor of a user, asked at login once confirmed. The
+-- secret is encrypted by the application.
+CREATE TABLE user_two_factor (
+    user_id      INTEGER PRIMARY KEY REFERENCES users (user_id) ON DELETE CASCADE,
+    tenant_id    INTEGER NOT NULL REFERENCES tenants (tenant_id) ON DELETE CASCADE,
+    secret       TEXT NOT NULL,
+    confirmed_at TIMESTAMP,
+    -- last_step is the time step of the last accepted code, so that a code
+    -- is accepted once
+    last_step    INTEGER NOT NULL DEFAULT 0,
+    created_at   TIMESTAMP NOT NULL
+);
+
+-- The one time codes logging in without the second factor, only the SHA-256
+-- of a code is stored
+CREATE TABLE user_recovery_codes (
+    code_id   INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id   INTEGER NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    tenant_id INTEGER NOT NULL REFERENCES tenants (tenant_id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    used_at   TIMESTAMP,
+    UNIQUE (user_id, code_hash)
+);
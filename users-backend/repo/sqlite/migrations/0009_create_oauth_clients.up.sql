@@ -0,0 +1,31 @@
+-- The OpenID Connect clients of a tenant. Their requests name no tenant, so
+-- clients are looked up in every tenant by their id. Public clients have no
+-- secret.
+CREATE TABLE oauth_clients (
+    client_id     TEXT PRIMARY KEY,
+    tenant_id     INTEGER NOT NULL REFERENCES tenants (tenant_id) ON DELETE CASCADE,
+    name          TEXT NOT NULL,
+    secret_hash   TEXT,
+    -- redirect_uris is a JSON array
+    redirect_uris TEXT NOT NULL,
+    created_at    TIMESTAMP NOT NULL
+);
+CREATE INDEX oauth_clients_tenant_id_idx ON oauth_clients (tenant_id);
+
+-- The single use codes a client exchanges for the tokens of a user, with the
+-- request they were issued for. Only the SHA-256 of a code is stored.
+CREATE TABLE oauth_authorization_codes (
+    code_id        INTEGER PRIMARY KEY AUTOINCREMENT,
+    client_id      TEXT NOT NULL REFERENCES oauth_clients (client_id) ON DELETE CASCADE,
+    user_id        INTEGER NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    tenant_id      INTEGER NOT NULL REFERENCES tenants (tenant_id) ON DELETE CASCADE,
+    code_hash      TEXT NOT NULL UNIQUE,
+    redirect_uri   TEXT NOT NULL,
+    scope          TEXT NOT NULL,
+    nonce          TEXT NOT NULL,
+    code_challenge TEXT NOT NULL,
+    auth_time      TIMESTAMP NOT NULL,
+    expires_at     TIMESTAMP NOT NULL,
+    used_at        TIMESTAMP,
+    created_at     TIMESTAMP NOT NULL
+);
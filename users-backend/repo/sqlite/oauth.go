@@ -0,0 +1,240 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+	"users-backend/model"
+	"users-backend/repo"
+)
+
+const clientColumns = "client_id, tenant_id, name, secret_hash, redirect_uris, created_at"
+
+// wrapClientError adds ErrClientNotFound to the driver errors returned for
+// unknown clients
+func wrapClientError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %w", repo.ErrClientNotFound, err)
+	}
+	return err
+}
+
+// wrapAuthorizationCodeError adds ErrAuthorizationCodeNotFound to the driver
+// errors returned for unknown codes
+func wrapAuthorizationCodeError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %w", repo.ErrAuthorizationCodeNotFound, err)
+	}
+	return err
+}
+
+func scanClient(row scanner) (*model.OAuthClient, error) {
+	var (
+		c            model.OAuthClient
+		secretHash   sql.NullString
+		redirectURIs string
+	)
+	if err := row.Scan(&c.ClientID, &c.TenantID, &c.Name, &secretHash, &redirectURIs, &c.CreatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(redirectURIs), &c.RedirectURIs); err != nil {
+		return nil, err
+	}
+	c.SecretHash = secretHash.String
+	return &c, nil
+}
+
+// nullString stores an empty string as NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func (r *SQLiteRepo) GetClient(ctx context.Context, client_id string) (*model.OAuthClient, error) {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := scanClient(r.conn(ctx).QueryRowContext(ctx, "SELECT "+clientColumns+" FROM oauth_clients WHERE tenant_id = ? AND client_id = ?", tenant_id, client_id))
+	if err != nil {
+		r.logError(ctx, "failed to get client", err, "client_id", client_id)
+		return nil, wrapClientError(err)
+	}
+	return c, nil
+}
+
+func (r *SQLiteRepo) FindClient(ctx context.Context, client_id string) (*model.OAuthClient, error) {
+	c, err := scanClient(r.conn(ctx).QueryRowContext(ctx, "SELECT "+clientColumns+" FROM oauth_clients WHERE client_id = ?", client_id))
+	if err != nil {
+		r.logError(ctx, "failed to find client", err, "client_id", client_id)
+		return nil, wrapClientError(err)
+	}
+	return c, nil
+}
+
+func (r *SQLiteRepo) GetClients(ctx context.Context) (*[]model.OAuthClient, error) {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.conn(ctx).QueryContext(ctx, "SELECT "+clientColumns+" FROM oauth_clients WHERE tenant_id = ? ORDER BY name, client_id", tenant_id)
+	if err != nil {
+		r.logError(ctx, "failed to get clients", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	clients := []model.OAuthClient{}
+	for rows.Next() {
+		c, err := scanClient(rows)
+		if err != nil {
+			r.logError(ctx, "failed to read client", err)
+			return nil, err
+		}
+		clients = append(clients, *c)
+	}
+	if err := rows.Err(); err != nil {
+		r.logError(ctx, "failed to get clients", err)
+		return nil, err
+	}
+
+	return &clients, nil
+}
+
+func (r *SQLiteRepo) CreateClient(ctx context.Context, c *model.OAuthClient) error {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	redirectURIs, err := json.Marshal(append([]string{}, c.RedirectURIs...))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	_, err = r.conn(ctx).ExecContext(ctx, "INSERT INTO oauth_clients ("+clientColumns+") VALUES (?, ?, ?, ?, ?, ?)",
+		c.ClientID, tenant_id, c.Name, nullString(c.SecretHash), string(redirectURIs), now)
+	if err != nil {
+		r.logError(ctx, "failed to insert client", err, "client_id", c.ClientID)
+		return err
+	}
+
+	c.TenantID = tenant_id
+	c.CreatedAt = now
+	return nil
+}
+
+func (r *SQLiteRepo) UpdateClient(ctx context.Context, c *model.OAuthClient) error {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	redirectURIs, err := json.Marshal(append([]string{}, c.RedirectURIs...))
+	if err != nil {
+		return err
+	}
+
+	res, err := r.conn(ctx).ExecContext(ctx, "UPDATE oauth_clients SET name = ?, redirect_uris = ? WHERE tenant_id = ? AND client_id = ?",
+		c.Name, string(redirectURIs), tenant_id, c.ClientID)
+	if err == nil {
+		err = requireRows(res)
+	}
+	if err != nil {
+		r.logError(ctx, "failed to update client", err, "client_id", c.ClientID)
+		return wrapClientError(err)
+	}
+	return nil
+}
+
+func (r *SQLiteRepo) SetClientSecret(ctx context.Context, client_id, hash string) error {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	res, err := r.conn(ctx).ExecContext(ctx, "UPDATE oauth_clients SET secret_hash = ? WHERE tenant_id = ? AND client_id = ?",
+		nullString(hash), tenant_id, client_id)
+	if err == nil {
+		err = requireRows(res)
+	}
+	if err != nil {
+		r.logError(ctx, "failed to set client secret", err, "client_id", client_id)
+		return wrapClientError(err)
+	}
+	return nil
+}
+
+func (r *SQLiteRepo) DeleteClient(ctx context.Context, client_id string) error {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = r.RunInTx(ctx, func(ctx context.Context) error {
+		if _, err := r.conn(ctx).ExecContext(ctx, "DELETE FROM oauth_authorization_codes WHERE tenant_id = ? AND client_id = ?", tenant_id, client_id); err != nil {
+			return err
+		}
+		_, err := r.conn(ctx).ExecContext(ctx, "DELETE FROM oauth_clients WHERE tenant_id = ? AND client_id = ?", tenant_id, client_id)
+		return err
+	})
+	if err != nil {
+		r.logError(ctx, "failed to delete client", err, "client_id", client_id)
+	}
+	return err
+}
+
+func (r *SQLiteRepo) CreateAuthorizationCode(ctx context.Context, code *model.AuthorizationCode) error {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Joining the user and the client keeps the code in their tenant
+	now := time.Now().UTC()
+	err = r.conn(ctx).QueryRowContext(ctx, `INSERT INTO oauth_authorization_codes
+			(client_id, user_id, tenant_id, code_hash, redirect_uri, scope, nonce, code_challenge, auth_time, expires_at, created_at)
+		SELECT c.client_id, u.user_id, u.tenant_id, ?, ?, ?, ?, ?, ?, ?, ?
+		FROM users u JOIN oauth_clients c ON c.tenant_id = u.tenant_id
+		WHERE u.tenant_id = ? AND u.user_id = ? AND c.client_id = ?
+		RETURNING code_id`,
+		code.CodeHash, code.RedirectURI, code.Scope, code.Nonce, code.CodeChallenge, code.AuthTime.UTC(), code.ExpiresAt.UTC(), now,
+		tenant_id, code.UserID, code.ClientID).Scan(&code.CodeID)
+	if err != nil {
+		r.logError(ctx, "failed to create authorization code", err, "client_id", code.ClientID, "user_id", code.UserID)
+		return wrapError(err)
+	}
+
+	code.TenantID = tenant_id
+	code.CreatedAt = now
+	return nil
+}
+
+func (r *SQLiteRepo) ConsumeAuthorizationCode(ctx context.Context, hash string, now time.Time) (*model.AuthorizationCode, error) {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Marking the code used in the lookup lets a single caller consume it,
+	// expired codes are refused after being marked as they are dead anyway
+	var code model.AuthorizationCode
+	err = r.conn(ctx).QueryRowContext(ctx, `UPDATE oauth_authorization_codes SET used_at = ?
+		WHERE tenant_id = ? AND code_hash = ? AND used_at IS NULL
+		RETURNING code_id, client_id, user_id, tenant_id, code_hash, redirect_uri, scope, nonce, code_challenge, auth_time, expires_at, used_at, created_at`,
+		now.UTC(), tenant_id, hash).Scan(&code.CodeID, &code.ClientID, &code.UserID, &code.TenantID, &code.CodeHash, &code.RedirectURI,
+		&code.Scope, &code.Nonce, &code.CodeChallenge, &code.AuthTime, &code.ExpiresAt, &code.UsedAt, &code.CreatedAt)
+	if err == nil && !code.ExpiresAt.After(now) {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		r.logError(ctx, "failed to consume authorization code", err)
+		return nil, wrapAuthorizationCodeError(err)
+	}
+	return &code, nil
+}
@@ -0,0 +1,430 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"users-backend/logging"
+	"users-backend/model"
+	"users-backend/repo"
+	"users-backend/repo/migrate"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+var (
+	_ repo.UserRepo              = new(SQLiteRepo)
+	_ repo.TenantRepo            = new(SQLiteRepo)
+	_ repo.AttributeRepo         = new(SQLiteRepo)
+	_ repo.GroupRepo             = new(SQLiteRepo)
+	_ repo.CredentialRepo        = new(SQLiteRepo)
+	_ repo.UserTokenRepo         = new(SQLiteRepo)
+	_ repo.TwoFactorRepo         = new(SQLiteRepo)
+	_ repo.ClientRepo            = new(SQLiteRepo)
+	_ repo.AuthorizationCodeRepo = new(SQLiteRepo)
+	_ repo.Migrator              = new(SQLiteRepo)
+
+	ErrSchemaMissing = errors.New("database schema is missing")
+)
+
+// defaultPragmas wait for locks instead of failing with SQLITE_BUSY and let
+// readers run alongside the writer
+const defaultPragmas = "_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)"
+
+const userColumns = "user_id, tenant_id, user_name, first_name, last_name, email, email_verified, user_status, department, attributes, manager_id"
+
+// maxHierarchyDepth stops the recursive manager queries should the managers
+// ever form a cycle, which the controller prevents
+const maxHierarchyDepth = 1000
+
+// SQLiteRepo stores users in a SQLite database file, for single node
+// deployments that do not run Postgres. Its schema is created by MigrateUp.
+type SQLiteRepo struct {
+	db  *sql.DB
+	log *slog.Logger
+}
+
+type txKey struct{}
+
+// querier is what *sql.DB and *sql.Tx have in common
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// ParseURL turns a sqlite://path/to/file.db URL into a driver DSN. Three
+// slashes give an absolute path, sqlite://:memory: an in-memory database.
+func ParseURL(databaseURL string) (string, error) {
+	rest, ok := strings.CutPrefix(databaseURL, "sqlite:")
+	if !ok {
+		return "", fmt.Errorf("database url %q does not use the sqlite scheme", databaseURL)
+	}
+
+	dsn := strings.TrimPrefix(rest, "//")
+	if dsn == "" || strings.HasPrefix(dsn, "?") {
+		return "", fmt.Errorf("database url %q has no path", databaseURL)
+	}
+
+	if strings.Contains(dsn, "?") {
+		return dsn + "&" + defaultPragmas, nil
+	}
+	return dsn + "?" + defaultPragmas, nil
+}
+
+func NewSQLiteRepo(databaseURL string, log *slog.Logger) (*SQLiteRepo, func()) {
+	log = log.With("component", "sqlite")
+
+	dsn, err := ParseURL(databaseURL)
+	if err != nil {
+		panic(err)
+	}
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		panic(err)
+	}
+	// SQLite allows a single writer, one connection serializes writes instead
+	// of failing them and keeps :memory: databases on a single connection
+	db.SetMaxOpenConns(1)
+
+	return &SQLiteRepo{db: db, log: log}, func() {
+		if err := db.Close(); err != nil {
+			log.Error("failed to close database", "error", err)
+			return
+		}
+		log.Info("database closed")
+	}
+}
+
+// logError logs unexpected query errors, a missing row is an expected outcome
+// of lookups and is only logged at debug level
+func (r *SQLiteRepo) logError(ctx context.Context, msg string, err error, args ...any) {
+	l := logging.FromContext(ctx, r.log).With(args...)
+	if errors.Is(err, sql.ErrNoRows) {
+		l.DebugContext(ctx, msg, "error", err)
+		return
+	}
+	l.ErrorContext(ctx, msg, "error", err)
+}
+
+// wrapError adds the repo sentinel errors to the driver errors they stand for
+func wrapError(err error) error {
+	var sqliteErr *sqlite.Error
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return fmt.Errorf("%w: %w", repo.ErrNotFound, err)
+	case errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE:
+		return fmt.Errorf("%w: %w", repo.ErrDuplicateUserName, err)
+	}
+	return err
+}
+
+// conn returns the transaction started by RunInTx when ctx carries one
+func (r *SQLiteRepo) conn(ctx context.Context) querier {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return r.db
+}
+
+func (r *SQLiteRepo) RunInTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+
+	return runInTx(ctx, r.db, func(tx *sql.Tx) error {
+		return fn(context.WithValue(ctx, txKey{}, tx))
+	})
+}
+
+// Ping checks the database can be opened
+func (r *SQLiteRepo) Ping(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
+
+// CheckSchema checks every migration has been applied
+func (r *SQLiteRepo) CheckSchema(ctx context.Context) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	pending, err := migrate.Pending(ctx, migrationStore{db: r.db}, migrations)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrSchemaMissing, err)
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%w: migration %s is not applied", ErrSchemaMissing, pending[0])
+	}
+
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanUser(row scanner) (*model.User, error) {
+	var user model.User
+	err := row.Scan(&user.UserID, &user.TenantID, &user.UserName, &user.FirstName, &user.LastName, &user.Email, &user.EmailVerified, &user.UserStatus, &user.Department, &user.Attributes, &user.ManagerID)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *SQLiteRepo) GetById(ctx context.Context, user_id int) (*model.User, error) {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := scanUser(r.conn(ctx).QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE tenant_id = ? AND user_id = ?", tenant_id, user_id))
+	if err != nil {
+		r.logError(ctx, "failed to get user by id", err, "user_id", user_id)
+		return nil, wrapError(err)
+	}
+	return user, nil
+}
+
+func (r *SQLiteRepo) GetByUsername(ctx context.Context, username string) (*model.User, error) {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := scanUser(r.conn(ctx).QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE tenant_id = ? AND user_name = ?", tenant_id, username))
+	if err != nil {
+		r.logError(ctx, "failed to get user by username", err, "user_name", username)
+		return nil, wrapError(err)
+	}
+	return user, nil
+}
+
+func (r *SQLiteRepo) GetAll(ctx context.Context) (*[]model.User, error) {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := r.queryUsers(ctx, "SELECT "+userColumns+" FROM users WHERE tenant_id = ? ORDER BY user_id", tenant_id)
+	if err != nil {
+		r.logError(ctx, "failed to get all users", err)
+		return nil, err
+	}
+	return users, nil
+}
+
+func (r *SQLiteRepo) FindByAttributes(ctx context.Context, attributes model.Attributes) (*[]model.User, error) {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := "SELECT " + userColumns + " FROM users WHERE tenant_id = ?"
+	args := []any{tenant_id}
+	for name, value := range attributes {
+		query += " AND json_extract(attributes, ?) = ?"
+		args = append(args, attributePath(name), value)
+	}
+
+	users, err := r.queryUsers(ctx, query+" ORDER BY user_id", args...)
+	if err != nil {
+		r.logError(ctx, "failed to find users by attributes", err)
+		return nil, err
+	}
+	return users, nil
+}
+
+// queryUsers runs a query selecting userColumns
+func (r *SQLiteRepo) queryUsers(ctx context.Context, query string, args ...any) (*[]model.User, error) {
+	rows, err := r.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []model.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &users, nil
+}
+
+func (r *SQLiteRepo) Create(ctx context.Context, user *model.User) (int, error) {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return -1, err
+	}
+
+	res, err := r.conn(ctx).ExecContext(ctx,
+		"INSERT INTO users (tenant_id, user_name, first_name, last_name, email, email_verified, user_status, department, attributes, manager_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		tenant_id, user.UserName, user.FirstName, user.LastName, user.Email, user.EmailVerified, user.UserStatus, user.Department, user.Attributes, user.ManagerID)
+	if err != nil {
+		r.logError(ctx, "failed to insert user", err, "user_name", user.UserName)
+		return -1, wrapError(err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		r.logError(ctx, "failed to read inserted user id", err, "user_name", user.UserName)
+		return -1, err
+	}
+
+	user.UserID = int(id)
+	user.TenantID = tenant_id
+	return user.UserID, nil
+}
+
+func (r *SQLiteRepo) Update(ctx context.Context, user *model.User) (int, error) {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return -1, err
+	}
+
+	// NULL keeps the stored attributes. A new email is no longer verified.
+	var attributes any
+	if user.Attributes != nil {
+		attributes = user.Attributes
+	}
+
+	res, err := r.conn(ctx).ExecContext(ctx,
+		"UPDATE users SET user_name = ?, first_name = ?, last_name = ?, email = ?, email_verified = email_verified AND email = ?, user_status = ?, department = ?, attributes = coalesce(?, attributes), manager_id = ? WHERE tenant_id = ? AND user_id = ?",
+		user.UserName, user.FirstName, user.LastName, user.Email, user.Email, user.UserStatus, user.Department, attributes, user.ManagerID, tenant_id, user.UserID)
+	if err != nil {
+		r.logError(ctx, "failed to update user", err, "user_id", user.UserID)
+		return -1, wrapError(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		r.logError(ctx, "failed to update user", err, "user_id", user.UserID)
+		return -1, err
+	}
+	if n == 0 {
+		r.logError(ctx, "failed to get user for update", sql.ErrNoRows, "user_id", user.UserID)
+		return -1, wrapError(sql.ErrNoRows)
+	}
+
+	user.TenantID = tenant_id
+	return user.UserID, nil
+}
+
+func (r *SQLiteRepo) Delete(ctx context.Context, user_id int) error {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.conn(ctx).ExecContext(ctx, "DELETE FROM users WHERE tenant_id = ? AND user_id = ?", tenant_id, user_id)
+	if err != nil {
+		r.logError(ctx, "failed to delete user", err, "user_id", user_id)
+	}
+	return err
+}
+
+func (r *SQLiteRepo) GetDirectReports(ctx context.Context, manager_id int) (*[]model.User, error) {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := r.queryUsers(ctx, "SELECT "+userColumns+" FROM users WHERE tenant_id = ? AND manager_id = ? ORDER BY user_id", tenant_id, manager_id)
+	if err != nil {
+		r.logError(ctx, "failed to get direct reports", err, "user_id", manager_id)
+		return nil, err
+	}
+	return users, nil
+}
+
+func (r *SQLiteRepo) GetManagementChain(ctx context.Context, user_id int) (*[]model.User, error) {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := r.queryUsers(ctx, `WITH RECURSIVE chain (user_id, depth) AS (
+		SELECT manager_id, 1 FROM users WHERE tenant_id = ?1 AND user_id = ?2 AND manager_id IS NOT NULL
+		UNION ALL
+		SELECT u.manager_id, c.depth + 1 FROM users u JOIN chain c ON u.user_id = c.user_id
+		WHERE u.tenant_id = ?1 AND u.manager_id IS NOT NULL AND c.depth < ?3
+	)
+	SELECT `+userColumns+` FROM users JOIN chain USING (user_id) WHERE tenant_id = ?1 ORDER BY depth`, tenant_id, user_id, maxHierarchyDepth)
+	if err != nil {
+		r.logError(ctx, "failed to get management chain", err, "user_id", user_id)
+		return nil, err
+	}
+	return users, nil
+}
+
+func (r *SQLiteRepo) GetSubordinates(ctx context.Context, manager_id int) (*[]model.User, error) {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := r.queryUsers(ctx, `WITH RECURSIVE subtree (user_id, depth) AS (
+		SELECT user_id, 1 FROM users WHERE tenant_id = ?1 AND manager_id = ?2
+		UNION ALL
+		SELECT u.user_id, s.depth + 1 FROM users u JOIN subtree s ON u.manager_id = s.user_id
+		WHERE u.tenant_id = ?1 AND s.depth < ?3
+	)
+	SELECT `+userColumns+` FROM users JOIN subtree USING (user_id) ORDER BY depth, user_id`, tenant_id, manager_id, maxHierarchyDepth)
+	if err != nil {
+		r.logError(ctx, "failed to get subordinates", err, "user_id", manager_id)
+		return nil, err
+	}
+	return users, nil
+}
+
+func (r *SQLiteRepo) ReassignReports(ctx context.Context, from_manager_id, to_manager_id int) (int, error) {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	// NULL leaves the reports without manager
+	var manager any
+	if to_manager_id != 0 {
+		manager = to_manager_id
+	}
+
+	res, err := r.conn(ctx).ExecContext(ctx, "UPDATE users SET manager_id = ? WHERE tenant_id = ? AND manager_id = ?", manager, tenant_id, from_manager_id)
+	if err != nil {
+		r.logError(ctx, "failed to reassign reports", err, "user_id", from_manager_id, "manager_id", to_manager_id)
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		r.logError(ctx, "failed to reassign reports", err, "user_id", from_manager_id, "manager_id", to_manager_id)
+		return 0, err
+	}
+	return int(n), nil
+}
+
+// LockHierarchy has nothing to wait for, the single connection already runs
+// one transaction at a time
+func (r *SQLiteRepo) LockHierarchy(ctx context.Context) error {
+	_, err := repo.TenantID(ctx)
+	return err
+}
+
+// LockAttribute has nothing to wait for either
+func (r *SQLiteRepo) LockAttribute(ctx context.Context, name string) error {
+	_, err := repo.TenantID(ctx)
+	return err
+}
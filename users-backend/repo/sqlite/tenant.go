@@ -0,0 +1,127 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"users-backend/model"
+	"users-backend/repo"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+const tenantColumns = "tenant_id, slug, name"
+
+// wrapTenantError adds the repo sentinel errors to the driver errors they
+// stand for in the tenants table
+func wrapTenantError(err error) error {
+	var sqliteErr *sqlite.Error
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return fmt.Errorf("%w: %w", repo.ErrTenantNotFound, err)
+	case errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE:
+		return fmt.Errorf("%w: %w", repo.ErrDuplicateTenantSlug, err)
+	case errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY:
+		return fmt.Errorf("%w: %w", repo.ErrTenantInUse, err)
+	}
+	return err
+}
+
+func scanTenant(row scanner) (*model.Tenant, error) {
+	var t model.Tenant
+	if err := row.Scan(&t.TenantID, &t.Slug, &t.Name); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r *SQLiteRepo) GetTenant(ctx context.Context, tenant_id int) (*model.Tenant, error) {
+	t, err := scanTenant(r.conn(ctx).QueryRowContext(ctx, "SELECT "+tenantColumns+" FROM tenants WHERE tenant_id = ?", tenant_id))
+	if err != nil {
+		r.logError(ctx, "failed to get tenant by id", err, "tenant_id", tenant_id)
+		return nil, wrapTenantError(err)
+	}
+	return t, nil
+}
+
+func (r *SQLiteRepo) GetTenantBySlug(ctx context.Context, slug string) (*model.Tenant, error) {
+	t, err := scanTenant(r.conn(ctx).QueryRowContext(ctx, "SELECT "+tenantColumns+" FROM tenants WHERE slug = ?", slug))
+	if err != nil {
+		r.logError(ctx, "failed to get tenant by slug", err, "tenant_slug", slug)
+		return nil, wrapTenantError(err)
+	}
+	return t, nil
+}
+
+func (r *SQLiteRepo) GetAllTenants(ctx context.Context) (*[]model.Tenant, error) {
+	rows, err := r.conn(ctx).QueryContext(ctx, "SELECT "+tenantColumns+" FROM tenants ORDER BY tenant_id")
+	if err != nil {
+		r.logError(ctx, "failed to get all tenants", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	tenants := []model.Tenant{}
+	for rows.Next() {
+		t, err := scanTenant(rows)
+		if err != nil {
+			r.logError(ctx, "failed to read tenant", err)
+			return nil, err
+		}
+		tenants = append(tenants, *t)
+	}
+	if err := rows.Err(); err != nil {
+		r.logError(ctx, "failed to get all tenants", err)
+		return nil, err
+	}
+
+	return &tenants, nil
+}
+
+func (r *SQLiteRepo) CreateTenant(ctx context.Context, t *model.Tenant) (int, error) {
+	res, err := r.conn(ctx).ExecContext(ctx, "INSERT INTO tenants (slug, name) VALUES (?, ?)", t.Slug, t.Name)
+	if err != nil {
+		r.logError(ctx, "failed to insert tenant", err, "tenant_slug", t.Slug)
+		return -1, wrapTenantError(err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		r.logError(ctx, "failed to read inserted tenant id", err, "tenant_slug", t.Slug)
+		return -1, err
+	}
+
+	t.TenantID = int(id)
+	return t.TenantID, nil
+}
+
+func (r *SQLiteRepo) UpdateTenant(ctx context.Context, t *model.Tenant) (int, error) {
+	res, err := r.conn(ctx).ExecContext(ctx, "UPDATE tenants SET slug = ?, name = ? WHERE tenant_id = ?", t.Slug, t.Name, t.TenantID)
+	if err != nil {
+		r.logError(ctx, "failed to update tenant", err, "tenant_id", t.TenantID)
+		return -1, wrapTenantError(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		r.logError(ctx, "failed to update tenant", err, "tenant_id", t.TenantID)
+		return -1, err
+	}
+	if n == 0 {
+		r.logError(ctx, "failed to get tenant for update", sql.ErrNoRows, "tenant_id", t.TenantID)
+		return -1, wrapTenantError(sql.ErrNoRows)
+	}
+
+	return t.TenantID, nil
+}
+
+func (r *SQLiteRepo) DeleteTenant(ctx context.Context, tenant_id int) error {
+	_, err := r.conn(ctx).ExecContext(ctx, "DELETE FROM tenants WHERE tenant_id = ?", tenant_id)
+	if err != nil {
+		r.logError(ctx, "failed to delete tenant", err, "tenant_id", tenant_id)
+		return wrapTenantError(err)
+	}
+	return nil
+}
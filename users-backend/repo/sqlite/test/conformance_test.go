@@ -0,0 +1,59 @@
+package test
+
+import (
+	"path/filepath"
+	"users-backend/logging"
+	"users-backend/repo"
+	"users-backend/repo/repotest"
+	"users-backend/repo/sqlite"
+
+	"github.com/onsi/ginkgo/v2"
+)
+
+var _ = repotest.Describe("SQLiteRepo", func() (repo.UserRepo, func()) {
+	r, cleanup := sqlite.NewSQLiteRepo("sqlite://"+filepath.Join(ginkgo.GinkgoT().TempDir(), "users.db"), logging.Discard())
+	repotest.Migrate(r)
+	return r, cleanup
+})
+
+var _ = repotest.DescribeTenants("SQLiteRepo", func() (repo.TenantRepo, repo.UserRepo, func()) {
+	r, cleanup := sqlite.NewSQLiteRepo("sqlite://"+filepath.Join(ginkgo.GinkgoT().TempDir(), "users.db"), logging.Discard())
+	repotest.Migrate(r)
+	return r, r, cleanup
+})
+
+var _ = repotest.DescribeAttributes("SQLiteRepo", func() (repo.AttributeRepo, repo.UserRepo, func()) {
+	r, cleanup := sqlite.NewSQLiteRepo("sqlite://"+filepath.Join(ginkgo.GinkgoT().TempDir(), "users.db"), logging.Discard())
+	repotest.Migrate(r)
+	return r, r, cleanup
+})
+
+var _ = repotest.DescribeGroups("SQLiteRepo", func() (repo.GroupRepo, repo.UserRepo, func()) {
+	r, cleanup := sqlite.NewSQLiteRepo("sqlite://"+filepath.Join(ginkgo.GinkgoT().TempDir(), "users.db"), logging.Discard())
+	repotest.Migrate(r)
+	return r, r, cleanup
+})
+
+var _ = repotest.DescribeCredentials("SQLiteRepo", func() (repo.CredentialRepo, repo.UserRepo, func()) {
+	r, cleanup := sqlite.NewSQLiteRepo("sqlite://"+filepath.Join(ginkgo.GinkgoT().TempDir(), "users.db"), logging.Discard())
+	repotest.Migrate(r)
+	return r, r, cleanup
+})
+
+var _ = repotest.DescribeUserTokens("SQLiteRepo", func() (repo.UserTokenRepo, repo.UserRepo, func()) {
+	r, cleanup := sqlite.NewSQLiteRepo("sqlite://"+filepath.Join(ginkgo.GinkgoT().TempDir(), "users.db"), logging.Discard())
+	repotest.Migrate(r)
+	return r, r, cleanup
+})
+
+var _ = repotest.DescribeTwoFactor("SQLiteRepo", func() (repo.TwoFactorRepo, repo.UserRepo, func()) {
+	r, cleanup := sqlite.NewSQLiteRepo("sqlite://"+filepath.Join(ginkgo.GinkgoT().TempDir(), "users.db"), logging.Discard())
+	repotest.Migrate(r)
+	return r, r, cleanup
+})
+
+var _ = repotest.DescribeOAuth("SQLiteRepo", func() (repo.ClientRepo, repo.AuthorizationCodeRepo, repo.UserRepo, func()) {
+	r, cleanup := sqlite.NewSQLiteRepo("sqlite://"+filepath.Join(ginkgo.GinkgoT().TempDir(), "users.db"), logging.Discard())
+	repotest.Migrate(r)
+	return r, r, r, cleanup
+})
@@ -0,0 +1,185 @@
+package test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"users-backend/logging"
+	"users-backend/model"
+	"users-backend/repo"
+	"users-backend/repo/sqlite"
+	"users-backend/tenant"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("SQLite Repo", func() {
+	var (
+		r       *sqlite.SQLiteRepo
+		cleanup func()
+		dbURL   string
+		dbPath  string
+		ctx     = tenant.WithID(context.Background(), model.DefaultTenantID)
+	)
+
+	newUser := func(userName string) *model.User {
+		return &model.User{UserName: userName, FirstName: "John", LastName: "Doe", Email: userName + "@email.com", UserStatus: "A", Department: sql.NullString{String: "IT", Valid: true}}
+	}
+
+	ginkgo.BeforeEach(func() {
+		dbPath = filepath.Join(ginkgo.GinkgoT().TempDir(), "users.db")
+		dbURL = "sqlite://" + dbPath
+		r, cleanup = sqlite.NewSQLiteRepo(dbURL, logging.Discard())
+		_, err := r.MigrateUp(ctx)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	})
+
+	ginkgo.AfterEach(func() {
+		cleanup()
+	})
+
+	ginkgo.It("should create and read back a user", func() {
+		id, err := r.Create(ctx, newUser("johndoe"))
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+		user, err := r.GetById(ctx, id)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		expected := newUser("johndoe")
+		expected.UserID = id
+		expected.TenantID = model.DefaultTenantID
+		gomega.Expect(user).Should(gomega.Equal(expected))
+	})
+
+	ginkgo.It("should reject duplicate user names", func() {
+		_, err := r.Create(ctx, newUser("johndoe"))
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+		_, err = r.Create(ctx, newUser("johndoe"))
+		gomega.Expect(errors.Is(err, repo.ErrDuplicateUserName)).Should(gomega.BeTrue())
+	})
+
+	ginkgo.It("should keep the Postgres length limits", func() {
+		_, err := r.Create(ctx, newUser(strings.Repeat("a", 51)))
+		gomega.Expect(err).Should(gomega.HaveOccurred())
+	})
+
+	ginkgo.It("should report missing users as not found", func() {
+		_, err := r.GetById(ctx, 42)
+		gomega.Expect(errors.Is(err, repo.ErrNotFound)).Should(gomega.BeTrue())
+
+		_, err = r.Update(ctx, &model.User{UserID: 42, UserName: "nobody"})
+		gomega.Expect(errors.Is(err, repo.ErrNotFound)).Should(gomega.BeTrue())
+
+		gomega.Expect(r.Delete(ctx, 42)).Should(gomega.Succeed())
+	})
+
+	ginkgo.It("should roll back a failed transaction", func() {
+		err := r.RunInTx(ctx, func(ctx context.Context) error {
+			if _, err := r.Create(ctx, newUser("johndoe")); err != nil {
+				return err
+			}
+			return errors.New("abort")
+		})
+		gomega.Expect(err).Should(gomega.MatchError("abort"))
+
+		_, err = r.GetByUsername(ctx, "johndoe")
+		gomega.Expect(errors.Is(err, repo.ErrNotFound)).Should(gomega.BeTrue())
+	})
+
+	ginkgo.It("should not reapply migrations when reopened", func() {
+		_, err := r.Create(ctx, newUser("johndoe"))
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		cleanup()
+
+		r, cleanup = sqlite.NewSQLiteRepo(dbURL, logging.Discard())
+		gomega.Expect(r.CheckSchema(ctx)).Should(gomega.Succeed())
+		applied, err := r.MigrateUp(ctx)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(applied).Should(gomega.BeEmpty())
+		_, err = r.GetByUsername(ctx, "johndoe")
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	})
+
+	ginkgo.Describe("migrations", func() {
+		ginkgo.It("should report every migration as applied", func() {
+			statuses, err := r.MigrationStatus(ctx)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(statuses).ShouldNot(gomega.BeEmpty())
+			for _, st := range statuses {
+				gomega.Expect(st.Applied()).Should(gomega.BeTrue(), "%s", st.Migration)
+			}
+		})
+
+		ginkgo.It("should revert the last migration and apply it again", func() {
+			reverted, err := r.MigrateDown(ctx, 1)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(reverted).Should(gomega.HaveLen(1))
+			gomega.Expect(errors.Is(r.CheckSchema(ctx), sqlite.ErrSchemaMissing)).Should(gomega.BeTrue())
+
+			applied, err := r.MigrateUp(ctx)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(applied).Should(gomega.Equal(reverted))
+			gomega.Expect(r.CheckSchema(ctx)).Should(gomega.Succeed())
+		})
+
+		ginkgo.It("should move existing users to the default tenant", func() {
+			// Back to 0001_create_users
+			statuses, err := r.MigrationStatus(ctx)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			_, err = r.MigrateDown(ctx, len(statuses)-1)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+			db, err := sql.Open("sqlite", dbPath)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			_, err = db.Exec("INSERT INTO users (user_name, first_name, last_name, email, user_status) VALUES ('johndoe', 'John', 'Doe', 'johndoe@email.com', 'A')")
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(db.Close()).Should(gomega.Succeed())
+
+			_, err = r.MigrateUp(ctx)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			user, err := r.GetByUsername(ctx, "johndoe")
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(user.TenantID).Should(gomega.Equal(model.DefaultTenantID))
+
+			// New ids continue after the moved users
+			id, err := r.Create(ctx, newUser("janedoe"))
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(id).Should(gomega.BeNumerically(">", user.UserID))
+		})
+
+		ginkgo.It("should report a new database as missing its schema", func() {
+			fresh, closeFresh := sqlite.NewSQLiteRepo("sqlite://"+filepath.Join(ginkgo.GinkgoT().TempDir(), "fresh.db"), logging.Discard())
+			defer closeFresh()
+
+			gomega.Expect(errors.Is(fresh.CheckSchema(ctx), sqlite.ErrSchemaMissing)).Should(gomega.BeTrue())
+
+			statuses, err := fresh.MigrationStatus(ctx)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			for _, st := range statuses {
+				gomega.Expect(st.Applied()).Should(gomega.BeFalse())
+			}
+		})
+	})
+
+	ginkgo.Describe("ParseURL", func() {
+		ginkgo.It("should keep absolute paths and driver options", func() {
+			dsn, err := sqlite.ParseURL("sqlite:///var/lib/users.db?_pragma=synchronous(1)")
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(dsn).Should(gomega.HavePrefix("/var/lib/users.db?_pragma=synchronous(1)&"))
+		})
+
+		ginkgo.It("should reject other schemes", func() {
+			_, err := sqlite.ParseURL("postgres://localhost/users")
+			gomega.Expect(err).Should(gomega.HaveOccurred())
+		})
+	})
+})
+
+func TestSQLiteRepo(t *testing.T) {
+	gomega.RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "SQLite Repo Suite")
+}
@@ -0,0 +1,91 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+	"users-backend/model"
+	"users-backend/repo"
+)
+
+// wrapUserTokenError adds ErrUserTokenNotFound to the driver errors returned
+// for unknown tokens
+func wrapUserTokenError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %w", repo.ErrUserTokenNotFound, err)
+	}
+	return err
+}
+
+func (r *SQLiteRepo) CreateUserToken(ctx context.Context, t *model.UserToken) (int, error) {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return -1, err
+	}
+
+	now := time.Now().UTC()
+	err = r.RunInTx(ctx, func(ctx context.Context) error {
+		if _, err := r.conn(ctx).ExecContext(ctx, "DELETE FROM user_tokens WHERE tenant_id = ? AND user_id = ? AND purpose = ?", tenant_id, t.UserID, t.Purpose); err != nil {
+			return err
+		}
+
+		// Selecting the user keeps the token in its tenant
+		return r.conn(ctx).QueryRowContext(ctx, `INSERT INTO user_tokens (user_id, tenant_id, purpose, token_hash, email, expires_at, created_at)
+			SELECT user_id, tenant_id, ?, ?, ?, ?, ? FROM users WHERE tenant_id = ? AND user_id = ?
+			RETURNING token_id`,
+			t.Purpose, t.TokenHash, t.Email, t.ExpiresAt.UTC(), now, tenant_id, t.UserID).Scan(&t.TokenID)
+	})
+	if err != nil {
+		r.logError(ctx, "failed to create user token", err, "user_id", t.UserID, "purpose", t.Purpose)
+		return -1, wrapError(err)
+	}
+
+	t.TenantID = tenant_id
+	t.CreatedAt = now
+	return t.TokenID, nil
+}
+
+func (r *SQLiteRepo) ConsumeUserToken(ctx context.Context, purpose, hash string, now time.Time) (*model.UserToken, error) {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Marking the token used in the lookup lets a single caller consume it,
+	// expired tokens are refused after being marked as they are dead anyway
+	var t model.UserToken
+	err = r.conn(ctx).QueryRowContext(ctx, `UPDATE user_tokens SET used_at = ?
+		WHERE tenant_id = ? AND purpose = ? AND token_hash = ? AND used_at IS NULL
+		RETURNING token_id, tenant_id, user_id, purpose, token_hash, email, expires_at, used_at, created_at`,
+		now.UTC(), tenant_id, purpose, hash).Scan(&t.TokenID, &t.TenantID, &t.UserID, &t.Purpose, &t.TokenHash, &t.Email, &t.ExpiresAt, &t.UsedAt, &t.CreatedAt)
+	if err == nil && !t.ExpiresAt.After(now) {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		r.logError(ctx, "failed to consume user token", err, "purpose", purpose)
+		return nil, wrapUserTokenError(err)
+	}
+	return &t, nil
+}
+
+func (r *SQLiteRepo) MarkEmailVerified(ctx context.Context, user_id int, email string) (bool, error) {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	res, err := r.conn(ctx).ExecContext(ctx, "UPDATE users SET email_verified = true WHERE tenant_id = ? AND user_id = ? AND email = ?", tenant_id, user_id, email)
+	if err != nil {
+		r.logError(ctx, "failed to mark email verified", err, "user_id", user_id)
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		r.logError(ctx, "failed to mark email verified", err, "user_id", user_id)
+		return false, err
+	}
+	return n > 0, nil
+}
@@ -0,0 +1,220 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+	"users-backend/model"
+	"users-backend/repo"
+)
+
+// wrapTwoFactorError adds ErrTwoFactorNotFound to the driver errors returned
+// for users without second factor
+func wrapTwoFactorError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %w", repo.ErrTwoFactorNotFound, err)
+	}
+	return err
+}
+
+func (r *SQLiteRepo) GetTwoFactor(ctx context.Context, user_id int) (*model.TwoFactor, error) {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		t           model.TwoFactor
+		confirmedAt sql.NullTime
+	)
+	err = r.conn(ctx).QueryRowContext(ctx,
+		"SELECT user_id, tenant_id, secret, confirmed_at, last_step, created_at FROM user_two_factor WHERE tenant_id = ? AND user_id = ?",
+		tenant_id, user_id).Scan(&t.UserID, &t.TenantID, &t.Secret, &confirmedAt, &t.LastStep, &t.CreatedAt)
+	if err != nil {
+		r.logError(ctx, "failed to get two-factor", err, "user_id", user_id)
+		return nil, wrapTwoFactorError(err)
+	}
+	t.ConfirmedAt = confirmedAt.Time
+	return &t, nil
+}
+
+func (r *SQLiteRepo) EnrollTwoFactor(ctx context.Context, user_id int, secret string) error {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = r.RunInTx(ctx, func(ctx context.Context) error {
+		if _, err := r.conn(ctx).ExecContext(ctx, "DELETE FROM user_recovery_codes WHERE tenant_id = ? AND user_id = ?", tenant_id, user_id); err != nil {
+			return err
+		}
+
+		// Selecting the user keeps the factor in its tenant
+		res, err := r.conn(ctx).ExecContext(ctx, `INSERT INTO user_two_factor (user_id, tenant_id, secret, confirmed_at, last_step, created_at)
+			SELECT user_id, tenant_id, ?, NULL, 0, ? FROM users WHERE tenant_id = ? AND user_id = ?
+			ON CONFLICT (user_id) DO UPDATE SET secret = excluded.secret, confirmed_at = NULL, last_step = 0, created_at = excluded.created_at`,
+			secret, time.Now().UTC(), tenant_id, user_id)
+		if err != nil {
+			return err
+		}
+		return requireRows(res)
+	})
+	if err != nil {
+		r.logError(ctx, "failed to enroll two-factor", err, "user_id", user_id)
+		return wrapError(err)
+	}
+	return nil
+}
+
+func (r *SQLiteRepo) ConfirmTwoFactor(ctx context.Context, user_id int, step int64, codeHashes []string) error {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = r.RunInTx(ctx, func(ctx context.Context) error {
+		res, err := r.conn(ctx).ExecContext(ctx, "UPDATE user_two_factor SET confirmed_at = ?, last_step = ? WHERE tenant_id = ? AND user_id = ? AND confirmed_at IS NULL",
+			time.Now().UTC(), step, tenant_id, user_id)
+		if err != nil {
+			return err
+		}
+		if err := requireRows(res); err != nil {
+			return err
+		}
+		return r.replaceRecoveryCodes(ctx, tenant_id, user_id, codeHashes)
+	})
+	if err != nil {
+		r.logError(ctx, "failed to confirm two-factor", err, "user_id", user_id)
+		return wrapTwoFactorError(err)
+	}
+	return nil
+}
+
+func (r *SQLiteRepo) UseTwoFactorStep(ctx context.Context, user_id int, step int64) (bool, error) {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	res, err := r.conn(ctx).ExecContext(ctx, "UPDATE user_two_factor SET last_step = ? WHERE tenant_id = ? AND user_id = ? AND last_step < ?",
+		step, tenant_id, user_id, step)
+	if err != nil {
+		r.logError(ctx, "failed to use two-factor step", err, "user_id", user_id)
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		r.logError(ctx, "failed to use two-factor step", err, "user_id", user_id)
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (r *SQLiteRepo) DeleteTwoFactor(ctx context.Context, user_id int) error {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = r.RunInTx(ctx, func(ctx context.Context) error {
+		if _, err := r.conn(ctx).ExecContext(ctx, "DELETE FROM user_recovery_codes WHERE tenant_id = ? AND user_id = ?", tenant_id, user_id); err != nil {
+			return err
+		}
+		_, err := r.conn(ctx).ExecContext(ctx, "DELETE FROM user_two_factor WHERE tenant_id = ? AND user_id = ?", tenant_id, user_id)
+		return err
+	})
+	if err != nil {
+		r.logError(ctx, "failed to delete two-factor", err, "user_id", user_id)
+	}
+	return err
+}
+
+func (r *SQLiteRepo) ReplaceRecoveryCodes(ctx context.Context, user_id int, codeHashes []string) error {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = r.RunInTx(ctx, func(ctx context.Context) error {
+		return r.replaceRecoveryCodes(ctx, tenant_id, user_id, codeHashes)
+	})
+	if err != nil {
+		r.logError(ctx, "failed to replace recovery codes", err, "user_id", user_id)
+		return wrapTwoFactorError(err)
+	}
+	return nil
+}
+
+// replaceRecoveryCodes swaps the codes of the user in the transaction of ctx,
+// it returns sql.ErrNoRows when the user has no second factor
+func (r *SQLiteRepo) replaceRecoveryCodes(ctx context.Context, tenant_id, user_id int, codeHashes []string) error {
+	var exists bool
+	err := r.conn(ctx).QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM user_two_factor WHERE tenant_id = ? AND user_id = ?)", tenant_id, user_id).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return sql.ErrNoRows
+	}
+
+	if _, err := r.conn(ctx).ExecContext(ctx, "DELETE FROM user_recovery_codes WHERE tenant_id = ? AND user_id = ?", tenant_id, user_id); err != nil {
+		return err
+	}
+	for _, hash := range codeHashes {
+		if _, err := r.conn(ctx).ExecContext(ctx, "INSERT INTO user_recovery_codes (user_id, tenant_id, code_hash) VALUES (?, ?, ?)", user_id, tenant_id, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *SQLiteRepo) UseRecoveryCode(ctx context.Context, user_id int, codeHash string) (bool, error) {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	res, err := r.conn(ctx).ExecContext(ctx, "UPDATE user_recovery_codes SET used_at = ? WHERE tenant_id = ? AND user_id = ? AND code_hash = ? AND used_at IS NULL",
+		time.Now().UTC(), tenant_id, user_id, codeHash)
+	if err != nil {
+		r.logError(ctx, "failed to use recovery code", err, "user_id", user_id)
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		r.logError(ctx, "failed to use recovery code", err, "user_id", user_id)
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (r *SQLiteRepo) CountRecoveryCodes(ctx context.Context, user_id int) (int, error) {
+	tenant_id, err := repo.TenantID(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	err = r.conn(ctx).QueryRowContext(ctx, "SELECT count(*) FROM user_recovery_codes WHERE tenant_id = ? AND user_id = ? AND used_at IS NULL", tenant_id, user_id).Scan(&n)
+	if err != nil {
+		r.logError(ctx, "failed to count recovery codes", err, "user_id", user_id)
+		return 0, err
+	}
+	return n, nil
+}
+
+// requireRows returns sql.ErrNoRows when the statement changed nothing
+func requireRows(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+// Package tenant carries the tenant a request is scoped to. The HTTP handlers
+// and the CLI put it in the context, the repos scope every user query by it.
+package tenant
+
+import "context"
+
+type idKey struct{}
+
+// WithID returns a copy of ctx scoped to the tenant with id tenant_id
+func WithID(ctx context.Context, tenant_id int) context.Context {
+	return context.WithValue(ctx, idKey{}, tenant_id)
+}
+
+// ID returns the tenant ctx is scoped to, ok is false when it has none
+func ID(ctx context.Context) (tenant_id int, ok bool) {
+	tenant_id, ok = ctx.Value(idKey{}).(int)
+	return tenant_id, ok
+}
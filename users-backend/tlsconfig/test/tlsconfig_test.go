@@ -0,0 +1,302 @@
+package test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"users-backend/logging"
+	"users-backend/tlsconfig"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+// authority is a CA issuing certificates for the tests
+type authority struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+var serial int64
+
+func newAuthority() *authority {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	serial++
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	cert, err := x509.ParseCertificate(der)
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	return &authority{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns the PEM certificate and key of a leaf, its serial number
+// identifies it in the specs
+func (a *authority) issue(usage x509.ExtKeyUsage) (certPEM, keyPEM []byte, serialNumber int64) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	serial++
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, a.cert, &key.PublicKey, a.key)
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+		serial
+}
+
+var _ = ginkgo.Describe("TLS Config", func() {
+	ginkgo.Describe("parsing", func() {
+		ginkgo.It("should only accept TLS 1.2 and 1.3", func() {
+			v, err := tlsconfig.ParseVersion("")
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(v).Should(gomega.Equal(uint16(tls.VersionTLS12)))
+
+			v, err = tlsconfig.ParseVersion("1.3")
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(v).Should(gomega.Equal(uint16(tls.VersionTLS13)))
+
+			_, err = tlsconfig.ParseVersion("1.0")
+			gomega.Expect(errors.Is(err, tlsconfig.ErrUnknownVersion)).Should(gomega.BeTrue())
+		})
+
+		ginkgo.It("should reject insecure cipher suites", func() {
+			ids, err := tlsconfig.ParseCipherSuites("TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256")
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(ids).Should(gomega.Equal([]uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}))
+
+			_, err = tlsconfig.ParseCipherSuites("TLS_RSA_WITH_RC4_128_SHA")
+			gomega.Expect(errors.Is(err, tlsconfig.ErrUnknownCipherSuite)).Should(gomega.BeTrue())
+		})
+
+		ginkgo.It("should read the environment", func() {
+			ginkgo.GinkgoT().Setenv("TLS_CERT_FILE", "")
+			ginkgo.GinkgoT().Setenv("TLS_KEY_FILE", "")
+			_, ok, err := tlsconfig.FromEnv()
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(ok).Should(gomega.BeFalse())
+
+			ginkgo.GinkgoT().Setenv("TLS_CERT_FILE", "server.crt")
+			_, _, err = tlsconfig.FromEnv()
+			gomega.Expect(errors.Is(err, tlsconfig.ErrMissingKey)).Should(gomega.BeTrue())
+
+			ginkgo.GinkgoT().Setenv("TLS_KEY_FILE", "server.key")
+			ginkgo.GinkgoT().Setenv("TLS_MIN_VERSION", "1.3")
+			ginkgo.GinkgoT().Setenv("TLS_CLIENT_AUTH", "verify-if-given")
+			ginkgo.GinkgoT().Setenv("TLS_RELOAD_INTERVAL", "5s")
+			cfg, ok, err := tlsconfig.FromEnv()
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(ok).Should(gomega.BeTrue())
+			gomega.Expect(cfg.MinVersion).Should(gomega.Equal(uint16(tls.VersionTLS13)))
+			gomega.Expect(cfg.ClientAuth).Should(gomega.Equal(tls.VerifyClientCertIfGiven))
+			gomega.Expect(cfg.ReloadInterval).Should(gomega.Equal(5 * time.Second))
+		})
+	})
+
+	ginkgo.Describe("Reloader", func() {
+		var (
+			ca, clientCA *authority
+			cfg          tlsconfig.Config
+			certs        *tlsconfig.Reloader
+			addr         string
+			serverSerial int64
+		)
+
+		writeServerCert := func() int64 {
+			certPEM, keyPEM, n := ca.issue(x509.ExtKeyUsageServerAuth)
+			gomega.Expect(os.WriteFile(cfg.CertFile, certPEM, 0o600)).Should(gomega.Succeed())
+			gomega.Expect(os.WriteFile(cfg.KeyFile, keyPEM, 0o600)).Should(gomega.Succeed())
+			return n
+		}
+
+		start := func() {
+			var err error
+			certs, err = tlsconfig.NewReloader(cfg, logging.Discard())
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			addr = ln.Addr().String()
+
+			server := &http.Server{
+				Handler:   http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+				TLSConfig: certs.TLSConfig(),
+			}
+			go server.ServeTLS(ln, "", "")
+			ginkgo.DeferCleanup(server.Close)
+		}
+
+		newClient := func(clientCerts ...tls.Certificate) *http.Client {
+			roots := x509.NewCertPool()
+			roots.AddCert(ca.cert)
+			return &http.Client{Transport: &http.Transport{
+				TLSClientConfig:   &tls.Config{RootCAs: roots, Certificates: clientCerts},
+				ForceAttemptHTTP2: true,
+			}}
+		}
+
+		get := func(client *http.Client) (*http.Response, error) {
+			resp, err := client.Get("https://" + addr)
+			if err == nil {
+				resp.Body.Close()
+			}
+			return resp, err
+		}
+
+		peerSerial := func(resp *http.Response) int64 {
+			return resp.TLS.PeerCertificates[0].SerialNumber.Int64()
+		}
+
+		ginkgo.BeforeEach(func() {
+			dir := ginkgo.GinkgoT().TempDir()
+			ca = newAuthority()
+			cfg = tlsconfig.Config{
+				CertFile:   filepath.Join(dir, "server.crt"),
+				KeyFile:    filepath.Join(dir, "server.key"),
+				MinVersion: tls.VersionTLS12,
+			}
+			serverSerial = writeServerCert()
+		})
+
+		ginkgo.It("should serve HTTP/2 with the loaded certificate", func() {
+			start()
+
+			resp, err := get(newClient())
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(resp.ProtoMajor).Should(gomega.Equal(2))
+			gomega.Expect(peerSerial(resp)).Should(gomega.Equal(serverSerial))
+		})
+
+		ginkgo.It("should present a renewed certificate without dropping open connections", func() {
+			start()
+			open := newClient()
+			resp, err := get(open)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(peerSerial(resp)).Should(gomega.Equal(serverSerial))
+
+			renewed := writeServerCert()
+			changed, err := certs.Reload()
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(changed).Should(gomega.BeTrue())
+
+			resp, err = get(newClient())
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(peerSerial(resp)).Should(gomega.Equal(renewed))
+
+			resp, err = get(open)
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(peerSerial(resp)).Should(gomega.Equal(serverSerial))
+		})
+
+		ginkgo.It("should keep the loaded certificate when the new files are invalid", func() {
+			start()
+			gomega.Expect(os.WriteFile(cfg.CertFile, []byte("not a certificate"), 0o600)).Should(gomega.Succeed())
+
+			_, err := certs.Reload()
+			gomega.Expect(err).Should(gomega.HaveOccurred())
+
+			resp, err := get(newClient())
+			gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			gomega.Expect(peerSerial(resp)).Should(gomega.Equal(serverSerial))
+		})
+
+		ginkgo.It("should reload changed files on its own", func() {
+			cfg.ReloadInterval = 10 * time.Millisecond
+			start()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go certs.Run(ctx)
+
+			renewed := writeServerCert()
+			gomega.Eventually(func() int64 {
+				resp, err := get(newClient())
+				if err != nil {
+					return 0
+				}
+				return peerSerial(resp)
+			}).Should(gomega.Equal(renewed))
+		})
+
+		ginkgo.Describe("mutual TLS", func() {
+			var clientCert tls.Certificate
+
+			ginkgo.BeforeEach(func() {
+				clientCA = newAuthority()
+				cfg.ClientCAFile = filepath.Join(filepath.Dir(cfg.CertFile), "clients.crt")
+				gomega.Expect(os.WriteFile(cfg.ClientCAFile, clientCA.pem, 0o600)).Should(gomega.Succeed())
+
+				certPEM, keyPEM, _ := clientCA.issue(x509.ExtKeyUsageClientAuth)
+				var err error
+				clientCert, err = tls.X509KeyPair(certPEM, keyPEM)
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			})
+
+			ginkgo.It("should require a certificate signed by a client CA", func() {
+				cfg.ClientAuth = tls.RequireAndVerifyClientCert
+				start()
+
+				_, err := get(newClient())
+				gomega.Expect(err).Should(gomega.HaveOccurred())
+
+				certPEM, keyPEM, _ := ca.issue(x509.ExtKeyUsageClientAuth)
+				untrusted, err := tls.X509KeyPair(certPEM, keyPEM)
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+				_, err = get(newClient(untrusted))
+				gomega.Expect(err).Should(gomega.HaveOccurred())
+
+				_, err = get(newClient(clientCert))
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			})
+
+			ginkgo.It("should let clients without a certificate in when verify-if-given", func() {
+				cfg.ClientAuth = tls.VerifyClientCertIfGiven
+				start()
+
+				_, err := get(newClient())
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+				_, err = get(newClient(clientCert))
+				gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+			})
+		})
+	})
+})
+
+func TestTLSConfig(t *testing.T) {
+	gomega.RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "TLS Config Suite")
+}
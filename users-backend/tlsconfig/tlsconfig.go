@@ -0,0 +1,267 @@
+// Package tlsconfig builds the TLS configuration of the server. Certificates
+// are read through a Reloader so renewed files on disk are picked up by new
+// handshakes while open connections keep the certificate they started with.
+package tlsconfig
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ClientAuthRequire       = "require"
+	ClientAuthVerifyIfGiven = "verify-if-given"
+
+	DefaultReloadInterval = 30 * time.Second
+)
+
+var (
+	ErrMissingKey           = errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	ErrUnknownVersion       = errors.New("unknown TLS version")
+	ErrUnknownCipherSuite   = errors.New("unknown or insecure cipher suite")
+	ErrUnknownClientAuth    = errors.New("unknown client auth mode")
+	ErrNoClientCertificates = errors.New("no certificates in client CA file")
+)
+
+// Config locates the certificate files and restricts the handshakes accepted
+type Config struct {
+	CertFile string
+	KeyFile  string
+
+	// ClientCAFile enables mutual TLS, client certificates must be signed by
+	// one of its CAs
+	ClientCAFile string
+	ClientAuth   tls.ClientAuthType
+
+	MinVersion uint16
+	// CipherSuites restricts the TLS 1.2 cipher suites, Go's defaults when
+	// empty. TLS 1.3 suites are not configurable.
+	CipherSuites []uint16
+
+	// ReloadInterval is how often the files are checked for changes
+	ReloadInterval time.Duration
+}
+
+// FromEnv reads the configuration from the environment, ok is false when
+// TLS_CERT_FILE is not set and the server should use plain HTTP:
+//
+//	TLS_CERT_FILE, TLS_KEY_FILE	PEM certificate chain and private key
+//	TLS_MIN_VERSION	1.2 (default) or 1.3
+//	TLS_CIPHER_SUITES	comma separated Go names, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256
+//	TLS_CLIENT_CA_FILE	PEM CAs of the clients, enables mutual TLS
+//	TLS_CLIENT_AUTH	require (default) or verify-if-given
+//	TLS_RELOAD_INTERVAL	how often the files are checked for changes, 30s by default
+func FromEnv() (cfg Config, ok bool, err error) {
+	cfg = Config{
+		CertFile:       os.Getenv("TLS_CERT_FILE"),
+		KeyFile:        os.Getenv("TLS_KEY_FILE"),
+		ClientCAFile:   os.Getenv("TLS_CLIENT_CA_FILE"),
+		ReloadInterval: DefaultReloadInterval,
+	}
+	if cfg.CertFile == "" && cfg.KeyFile == "" {
+		return cfg, false, nil
+	}
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return cfg, false, ErrMissingKey
+	}
+
+	if cfg.MinVersion, err = ParseVersion(os.Getenv("TLS_MIN_VERSION")); err != nil {
+		return cfg, false, err
+	}
+	if cfg.CipherSuites, err = ParseCipherSuites(os.Getenv("TLS_CIPHER_SUITES")); err != nil {
+		return cfg, false, err
+	}
+	if cfg.ClientAuth, err = ParseClientAuth(os.Getenv("TLS_CLIENT_AUTH")); err != nil {
+		return cfg, false, err
+	}
+	if s := os.Getenv("TLS_RELOAD_INTERVAL"); s != "" {
+		if cfg.ReloadInterval, err = time.ParseDuration(s); err != nil || cfg.ReloadInterval <= 0 {
+			return cfg, false, fmt.Errorf("invalid TLS_RELOAD_INTERVAL %q", s)
+		}
+	}
+
+	return cfg, true, nil
+}
+
+// ParseVersion parses 1.2 or 1.3, older versions are not accepted. An empty
+// string is TLS 1.2.
+func ParseVersion(s string) (uint16, error) {
+	switch strings.TrimPrefix(strings.ToUpper(s), "TLS") {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("%w %q", ErrUnknownVersion, s)
+}
+
+// ParseCipherSuites parses comma separated cipher suite names, only the suites
+// Go considers secure are accepted
+func ParseCipherSuites(s string) ([]uint16, error) {
+	byName := map[string]uint16{}
+	for _, suite := range tls.CipherSuites() {
+		byName[suite.Name] = suite.ID
+	}
+
+	var ids []uint16
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		id, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("%w %q", ErrUnknownCipherSuite, name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// ParseClientAuth parses the mode used when a client CA file is set, require
+// when empty
+func ParseClientAuth(s string) (tls.ClientAuthType, error) {
+	switch s {
+	case "", ClientAuthRequire:
+		return tls.RequireAndVerifyClientCert, nil
+	case ClientAuthVerifyIfGiven:
+		return tls.VerifyClientCertIfGiven, nil
+	}
+	return tls.NoClientCert, fmt.Errorf("%w %q", ErrUnknownClientAuth, s)
+}
+
+// Reloader holds the certificate and client CAs loaded from the files of a
+// Config and reloads them when the files change
+type Reloader struct {
+	cfg Config
+	log *slog.Logger
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	digest    []byte
+}
+
+// NewReloader loads the files of cfg, failing when they are not valid
+func NewReloader(cfg Config, log *slog.Logger) (*Reloader, error) {
+	r := &Reloader{cfg: cfg, log: log.With("component", "tls")}
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// TLSConfig returns a server configuration offering HTTP/2 and HTTP/1.1 that
+// reads the certificate and client CAs from r on every handshake
+func (r *Reloader) TLSConfig() *tls.Config {
+	cfg := &tls.Config{
+		MinVersion:   r.cfg.MinVersion,
+		CipherSuites: r.cfg.CipherSuites,
+		NextProtos:   []string{"h2", "http/1.1"},
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			return r.cert, nil
+		},
+	}
+
+	if r.cfg.ClientCAFile != "" {
+		cfg.ClientAuth = r.cfg.ClientAuth
+		cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+
+			handshake := cfg.Clone()
+			handshake.ClientCAs = r.clientCAs
+			handshake.GetConfigForClient = nil
+			return handshake, nil
+		}
+	}
+
+	return cfg
+}
+
+// Reload reads the files again and swaps in their content when it changed,
+// the loaded files are kept when the new ones are invalid
+func (r *Reloader) Reload() (changed bool, err error) {
+	files := [][]byte{}
+	for _, name := range []string{r.cfg.CertFile, r.cfg.KeyFile, r.cfg.ClientCAFile} {
+		if name == "" {
+			files = append(files, nil)
+			continue
+		}
+		b, err := os.ReadFile(name)
+		if err != nil {
+			return false, err
+		}
+		files = append(files, b)
+	}
+
+	h := sha256.New()
+	for _, b := range files {
+		h.Write(b)
+	}
+	digest := h.Sum(nil)
+
+	r.mu.RLock()
+	unchanged := bytes.Equal(digest, r.digest)
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.X509KeyPair(files[0], files[1])
+	if err != nil {
+		return false, fmt.Errorf("loading %s: %w", r.cfg.CertFile, err)
+	}
+
+	var clientCAs *x509.CertPool
+	if r.cfg.ClientCAFile != "" {
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(files[2]) {
+			return false, fmt.Errorf("loading %s: %w", r.cfg.ClientCAFile, ErrNoClientCertificates)
+		}
+	}
+
+	r.mu.Lock()
+	r.cert, r.clientCAs, r.digest = &cert, clientCAs, digest
+	r.mu.Unlock()
+
+	return true, nil
+}
+
+// Run checks the files every ReloadInterval until ctx is done
+func (r *Reloader) Run(ctx context.Context) {
+	interval := r.cfg.ReloadInterval
+	if interval <= 0 {
+		interval = DefaultReloadInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		changed, err := r.Reload()
+		if err != nil {
+			r.log.ErrorContext(ctx, "failed to reload certificates, keeping the loaded ones", "error", err)
+			continue
+		}
+		if changed {
+			r.log.InfoContext(ctx, "certificates reloaded", "cert_file", r.cfg.CertFile)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"users-backend/tracing"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+)
+
+var _ = ginkgo.Describe("Init", func() {
+	ctx := context.Background()
+
+	ginkgo.It("should not export spans by default", func() {
+		ginkgo.GinkgoT().Setenv("OTEL_TRACES_EXPORTER", "")
+
+		shutdown, err := tracing.Init(ctx)
+
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(shutdown(ctx)).Should(gomega.Succeed())
+	})
+
+	ginkgo.It("should reject unknown exporters", func() {
+		ginkgo.GinkgoT().Setenv("OTEL_TRACES_EXPORTER", "zipkin")
+
+		_, err := tracing.Init(ctx)
+
+		gomega.Expect(err).Should(gomega.MatchError(tracing.ErrUnknownExporter))
+	})
+
+	ginkgo.It("should append the spans to the traces file on shutdown", func() {
+		path := filepath.Join(ginkgo.GinkgoT().TempDir(), "traces.json")
+		ginkgo.GinkgoT().Setenv("OTEL_TRACES_EXPORTER", "file")
+		ginkgo.GinkgoT().Setenv("OTEL_TRACES_FILE", path)
+
+		shutdown, err := tracing.Init(ctx)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+		_, span := otel.Tracer("users-backend/tracing/test").Start(ctx, "Test.Span")
+		span.SetStatus(codes.Error, "went wrong")
+		span.End()
+		gomega.Expect(shutdown(ctx)).Should(gomega.Succeed())
+
+		traces, err := os.ReadFile(path)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		gomega.Expect(string(traces)).Should(gomega.ContainSubstring(`"Name":"Test.Span"`))
+		gomega.Expect(string(traces)).Should(gomega.ContainSubstring(`"service.name"`))
+		gomega.Expect(string(traces)).Should(gomega.ContainSubstring(`"Description":"went wrong"`))
+	})
+})
+
+func TestTracing(t *testing.T) {
+	gomega.RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "Tracing Suite")
+}
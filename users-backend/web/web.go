@@ -0,0 +1,25 @@
+// Package web embeds the users-frontend build. The Dockerfile copies the
+// Angular output into dist before compiling, a plain go build embeds an empty
+// directory and the server runs without the frontend.
+package web
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed all:dist
+var dist embed.FS
+
+// Dist returns the embedded build, ok is false when the binary was built
+// without it
+func Dist() (fsys fs.FS, ok bool) {
+	fsys, err := fs.Sub(dist, "dist")
+	if err != nil {
+		return nil, false
+	}
+	if _, err := fs.Stat(fsys, "index.html"); err != nil {
+		return nil, false
+	}
+	return fsys, true
+}
@@ -8,6 +8,14 @@ const testUsers = [
   {user_id: 2, user_name: "janedoe", first_name: "Jane", last_name: "Doe", email:"janedoe@gmail.com", user_status: UserStatus.Inactive, department:"IT"}
 ]
 
+declare global {
+  interface Window {
+    // Set by the backend when it serves the app, apiBaseUrl is empty when the
+    // API is on the same origin
+    __USERS_CONFIG__?: { apiBaseUrl?: string };
+  }
+}
+
 export type Response = {
     code:    number,
 		message: string,
@@ -19,7 +27,7 @@ export type Response = {
   providedIn: 'root'
 })
 export class UserService {
-  private apiUrl = 'http://localhost:8080';
+  private apiUrl = window.__USERS_CONFIG__?.apiBaseUrl ?? 'http://localhost:8080';
   private usersUrl = `${this.apiUrl}/api/v1/users`;
 
   constructor(private http: HttpClient) { }